@@ -0,0 +1,201 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// numericReader extracts the number an aggregate folds in from a value,
+// reporting false for values it cannot read.
+type numericReader func(value []byte) (float64, bool)
+
+// compileNumeric parses an aggregate value spec: a fixed-width little-endian
+// type (i32, u32, i64, u64, f32, f64), "text" for decimal ASCII such as the
+// counters IncrBy keeps, or a JSON path such as "$.price". A Python wrapper
+// tag in front of a value is skipped.
+func compileNumeric(spec string) (numericReader, error) {
+	spec = strings.TrimSpace(spec)
+	fixed := func(width int, conv func([]byte) float64) numericReader {
+		return func(v []byte) (float64, bool) {
+			if len(v) == width+1 {
+				v = v[pythonTagLen(v):]
+			}
+			if len(v) != width {
+				return 0, false
+			}
+			return conv(v), true
+		}
+	}
+	switch spec {
+	case "i32":
+		return fixed(4, func(v []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(v))) }), nil
+	case "u32":
+		return fixed(4, func(v []byte) float64 { return float64(binary.LittleEndian.Uint32(v)) }), nil
+	case "i64":
+		return fixed(8, func(v []byte) float64 { return float64(int64(binary.LittleEndian.Uint64(v))) }), nil
+	case "u64":
+		return fixed(8, func(v []byte) float64 { return float64(binary.LittleEndian.Uint64(v)) }), nil
+	case "f32":
+		return fixed(4, func(v []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(v))) }), nil
+	case "f64":
+		return fixed(8, func(v []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(v)) }), nil
+	case "text":
+		return func(v []byte) (float64, bool) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(string(v[pythonTagLen(v):])), 64)
+			return n, err == nil
+		}, nil
+	}
+	if !strings.HasPrefix(spec, "$") {
+		return nil, fmt.Errorf("unknown aggregate value type %q", spec)
+	}
+	path, err := parseJSONPath(spec)
+	if err != nil {
+		return nil, err
+	}
+	return func(v []byte) (float64, bool) {
+		doc, err := decodeJSON(v[pythonTagLen(v):])
+		if err != nil {
+			return 0, false
+		}
+		node, _ := lookupJSONPath(doc, path)
+		num, ok := node.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		n, err := num.Float64()
+		return n, err == nil
+	}, nil
+}
+
+// aggregateResult is the document returned by Aggregate. Min, Max and Avg
+// are null when no value was read; Skipped counts values that were not
+// numbers of the requested type.
+type aggregateResult struct {
+	Count   int64    `json:"count"`
+	Sum     float64  `json:"sum"`
+	Min     *float64 `json:"min"`
+	Max     *float64 `json:"max"`
+	Avg     *float64 `json:"avg"`
+	Skipped int64    `json:"skipped"`
+}
+
+func (r *aggregateResult) add(n float64) {
+	r.Count++
+	r.Sum += n
+	if r.Min == nil || n < *r.Min {
+		r.Min = &n
+	}
+	if r.Max == nil || n > *r.Max {
+		r.Max = &n
+	}
+}
+
+// aggregate folds the values of the entries in [start, end) that pass
+// filter (an expression for compileFilter, empty for all) into count, sum,
+// min, max and avg.
+func aggregate(store kvStore, start, end []byte, spec, filter string) (aggregateResult, error) {
+	var res aggregateResult
+	read, err := compileNumeric(spec)
+	if err != nil {
+		return res, err
+	}
+	f, err := compileFilter(filter)
+	if err != nil {
+		return res, err
+	}
+	start, end, ok := userRange(start, end)
+	if !ok {
+		return res, nil
+	}
+	err = store.IterateRange(start, end, func(k, v []byte) error {
+		if !f.match(k, v) {
+			return nil
+		}
+		if n, ok := read(v); ok {
+			res.add(n)
+		} else {
+			res.Skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return aggregateResult{}, err
+	}
+	if res.Count > 0 {
+		avg := res.Sum / float64(res.Count)
+		res.Avg = &avg
+	}
+	return res, nil
+}
+
+func aggregateExport(handle C.uintptr_t, start, end []byte, spec, filter *C.char) *C.char {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	var filterExpr string
+	if filter != nil {
+		filterExpr = C.GoString(filter)
+	}
+	res, err := aggregate(store, start, end, C.GoString(spec), filterExpr)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	doc, err := json.Marshal(res)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.CString(string(doc))
+}
+
+// Aggregate folds the values under prefix into one JSON document (count,
+// sum, min, max, avg, skipped) without returning the entries. spec says how
+// to read each value: "i32", "u32", "i64", "u64", "f32" or "f64" for
+// little-endian numbers, "text" for decimal ASCII, or a JSON path such as
+// "$.price". filter, which may be NULL, is a ScanFilter expression. Release
+// the result with FreeCString.
+//
+//export Aggregate
+func Aggregate(handle C.uintptr_t, prefix *C.char, prefixLen C.int, spec *C.char, filter *C.char) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "aggregate", time.Now())
+	var start, end []byte
+	if prefixLen > 0 {
+		start = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+		end = nextPrefix(start)
+	}
+	return aggregateExport(handle, start, end, spec, filter)
+}
+
+// AggregateRange is Aggregate over the keys in [start, end); an empty start
+// or end leaves that side of the range open.
+//
+//export AggregateRange
+func AggregateRange(handle C.uintptr_t, start *C.char, startLen C.int, end *C.char, endLen C.int, spec *C.char, filter *C.char) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "aggregate", time.Now())
+	var from, to []byte
+	if startLen > 0 {
+		from = C.GoBytes(unsafe.Pointer(start), startLen)
+	}
+	if endLen > 0 {
+		to = C.GoBytes(unsafe.Pointer(end), endLen)
+	}
+	return aggregateExport(handle, from, to, spec, filter)
+}
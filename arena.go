@@ -0,0 +1,124 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"math/bits"
+	"sync"
+	"unsafe"
+)
+
+// Result buffers handed to the host come from an arena of C blocks in
+// power-of-two size classes. FreeBuffer returns a block to its class's free
+// list instead of freeing it, so steady Scan and Get traffic stops hitting
+// malloc. Small buffers skip the arena, and idle blocks beyond
+// arenaMaxIdle bytes are freed.
+const (
+	arenaMinShift = 12 // 4 KiB
+	arenaMaxShift = 26 // 64 MiB
+	arenaClasses  = arenaMaxShift - arenaMinShift + 1
+	arenaMaxIdle  = 64 << 20
+	// maxPooledScratch caps the Go buffers kept for reuse, so one huge scan
+	// does not pin its buffer for the life of the process.
+	maxPooledScratch = 4 << 20
+)
+
+var arena = struct {
+	mu   sync.Mutex
+	free [arenaClasses][]unsafe.Pointer
+	idle int
+	// class records the size class of every block the arena handed out.
+	class map[unsafe.Pointer]int
+}{class: make(map[unsafe.Pointer]int)}
+
+// scratchPool recycles the Go buffers results are assembled in.
+var scratchPool sync.Pool
+
+func getScratch() []byte {
+	if p, ok := scratchPool.Get().(*[]byte); ok {
+		return (*p)[:0]
+	}
+	return nil
+}
+
+func putScratch(buf []byte) {
+	if buf == nil || cap(buf) > maxPooledScratch {
+		return
+	}
+	buf = buf[:0]
+	scratchPool.Put(&buf)
+}
+
+// sizeClass returns the arena class for size, or -1 for sizes the arena
+// does not serve.
+func sizeClass(size int) int {
+	if size <= 1<<(arenaMinShift-1) || size > 1<<arenaMaxShift {
+		return -1
+	}
+	shift := bits.Len(uint(size - 1))
+	return max(shift, arenaMinShift) - arenaMinShift
+}
+
+// arenaAlloc returns size bytes of C memory for the host to release with
+// FreeBuffer, or nil if malloc fails.
+func arenaAlloc(size int) unsafe.Pointer {
+	class := sizeClass(size)
+	if class < 0 {
+		return C.malloc(C.size_t(size))
+	}
+
+	arena.mu.Lock()
+	defer arena.mu.Unlock()
+	if n := len(arena.free[class]); n > 0 {
+		mem := arena.free[class][n-1]
+		arena.free[class] = arena.free[class][:n-1]
+		arena.idle -= 1 << (class + arenaMinShift)
+		arena.class[mem] = class
+		return mem
+	}
+	mem := C.malloc(C.size_t(1) << (class + arenaMinShift))
+	if mem != nil {
+		arena.class[mem] = class
+	}
+	return mem
+}
+
+func arenaFree(mem unsafe.Pointer) {
+	arena.mu.Lock()
+	defer arena.mu.Unlock()
+	class, ok := arena.class[mem]
+	if !ok {
+		C.free(mem)
+		return
+	}
+	delete(arena.class, mem)
+	size := 1 << (class + arenaMinShift)
+	if arena.idle+size > arenaMaxIdle {
+		C.free(mem)
+		return
+	}
+	arena.free[class] = append(arena.free[class], mem)
+	arena.idle += size
+}
+
+// FreeArena releases every idle block the arena is holding for reuse, for
+// hosts that want the memory back after a burst of large reads. Buffers the
+// host still holds are unaffected.
+//
+//export FreeArena
+func FreeArena() {
+	defer recoverVoid(0)
+	arena.mu.Lock()
+	defer arena.mu.Unlock()
+	for class := range arena.free {
+		for _, mem := range arena.free[class] {
+			C.free(mem)
+		}
+		arena.free[class] = nil
+	}
+	arena.idle = 0
+}
@@ -0,0 +1,251 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+typedef void (*skyshelve_done_cb)(void *user_data, int status, const char *message);
+
+static inline void skyshelve_call_done_cb(skyshelve_done_cb cb, void *user_data, int status, const char *message) {
+	cb(user_data, status, message);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// asyncQueueDepth bounds the writes waiting on one handle; submitting to a
+// full queue blocks until the writer catches up.
+const asyncQueueDepth = 1024
+
+// future records the outcome of an async write for FutureWait.
+type future struct {
+	done chan struct{}
+	err  error
+}
+
+type asyncWrite struct {
+	ops []operation
+	// Exactly one of cb and fut is set.
+	cb       C.skyshelve_done_cb
+	userData unsafe.Pointer
+	fut      *future
+}
+
+// writeQueue applies a handle's async writes in submission order on one
+// goroutine. mu guards closed against sends racing the shutdown. With group
+// commit on, the goroutine coalesces up to maxBatch queued writes into one
+// Apply, and synchronous Set and Delete calls queue here too.
+type writeQueue struct {
+	mu       sync.RWMutex
+	closed   bool
+	requests chan *asyncWrite
+	done     chan struct{}
+	grouped  bool
+	maxBatch int
+	maxDelay time.Duration
+}
+
+func newWriteQueue() *writeQueue {
+	return &writeQueue{
+		requests: make(chan *asyncWrite, asyncQueueDepth),
+		done:     make(chan struct{}),
+		maxBatch: 1,
+	}
+}
+
+var (
+	asyncMu      sync.Mutex
+	writeQueues  = make(map[uintptr]*writeQueue)
+	futureMu     sync.Mutex
+	futures            = make(map[int64]*future)
+	nextFutureID int64 = 1
+)
+
+func getWriteQueue(id uintptr, store kvStore) *writeQueue {
+	asyncMu.Lock()
+	defer asyncMu.Unlock()
+	if q, ok := writeQueues[id]; ok {
+		return q
+	}
+	q := newWriteQueue()
+	writeQueues[id] = q
+	go q.run(store)
+	return q
+}
+
+func (q *writeQueue) run(store kvStore) {
+	defer close(q.done)
+	for req := range q.requests {
+		q.commit(store, q.collect(req))
+	}
+}
+
+func (q *writeQueue) submit(req *asyncWrite) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return errors.New("store is closing")
+	}
+	q.requests <- req
+	return nil
+}
+
+func (req *asyncWrite) complete(err error) {
+	if req.fut != nil {
+		req.fut.err = err
+		close(req.fut.done)
+		return
+	}
+	var message *C.char
+	if err != nil {
+		message = C.CString(err.Error())
+		defer C.free(unsafe.Pointer(message))
+	}
+	C.skyshelve_call_done_cb(req.cb, req.userData, errorCode(err), message)
+}
+
+// flushAsyncFor waits for every queued write on a store handle to finish and
+// stops its writer. It must run before the store closes.
+func flushAsyncFor(id uintptr) {
+	asyncMu.Lock()
+	q := writeQueues[id]
+	delete(writeQueues, id)
+	asyncMu.Unlock()
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	q.closed = true
+	close(q.requests)
+	q.mu.Unlock()
+	<-q.done
+}
+
+// submitAsync queues ops on handle. It returns a future ID when cb is NULL,
+// 0 when cb will be called instead, or a negative status code.
+func submitAsync(handle C.uintptr_t, ops []operation, cb C.skyshelve_done_cb, userData unsafe.Pointer) C.int64_t {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if err := userOps(ops); err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	req := &asyncWrite{ops: ops, cb: cb, userData: userData}
+	var id int64
+	if cb == nil {
+		req.fut = &future{done: make(chan struct{})}
+		futureMu.Lock()
+		id = nextFutureID
+		nextFutureID++
+		futures[id] = req.fut
+		futureMu.Unlock()
+	}
+	if err := getWriteQueue(uintptr(handle), store).submit(req); err != nil {
+		forgetFuture(id)
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(id)
+}
+
+func forgetFuture(id int64) {
+	futureMu.Lock()
+	defer futureMu.Unlock()
+	delete(futures, id)
+}
+
+// SetAsync queues a Set and returns without waiting for it. Async writes
+// through one handle are applied in submission order, and all of them finish
+// before Close returns. When cb is non-NULL it is called as cb(userData,
+// status, message) from a background thread once the write has committed or
+// failed (message is NULL on success and only valid during the call), and
+// SetAsync returns 0. Otherwise it returns a future ID for FutureWait and
+// FutureClose. Errors queueing the write return a negative status code.
+//
+//export SetAsync
+func SetAsync(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int, cb C.skyshelve_done_cb, userData unsafe.Pointer) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	op := operation{
+		op:    opSet,
+		key:   C.GoBytes(unsafe.Pointer(key), keyLen),
+		value: C.GoBytes(unsafe.Pointer(value), valueLen),
+	}
+	return submitAsync(handle, []operation{op}, cb, userData)
+}
+
+// DeleteAsync queues a Delete; see SetAsync.
+//
+//export DeleteAsync
+func DeleteAsync(handle C.uintptr_t, key *C.char, keyLen C.int, cb C.skyshelve_done_cb, userData unsafe.Pointer) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	op := operation{op: opDelete, key: C.GoBytes(unsafe.Pointer(key), keyLen)}
+	return submitAsync(handle, []operation{op}, cb, userData)
+}
+
+// ApplyAsync queues an Apply batch, which still commits atomically; see
+// SetAsync. Malformed batches are rejected immediately.
+//
+//export ApplyAsync
+func ApplyAsync(handle C.uintptr_t, ops *C.char, opsLen C.int, cb C.skyshelve_done_cb, userData unsafe.Pointer) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	decoded, err := decodeOperations(C.GoBytes(unsafe.Pointer(ops), opsLen))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if hasPreconditions(decoded) {
+		return C.int64_t(setHandleError(uintptr(handle), errPreconditionsUnsupported))
+	}
+	return submitAsync(handle, decoded, cb, userData)
+}
+
+// FutureWait waits up to timeoutMs (forever if negative) for an async write.
+// It returns the write's status code, recording any error for LastError, or
+// 1 if the write is still pending. The future stays valid until FutureClose.
+//
+//export FutureWait
+func FutureWait(futureID C.int64_t, timeoutMs C.int) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	futureMu.Lock()
+	f, ok := futures[int64(futureID)]
+	futureMu.Unlock()
+	if !ok {
+		return setError(unknownHandleError("future"))
+	}
+
+	if timeoutMs < 0 {
+		<-f.done
+	} else {
+		timer := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case <-f.done:
+		case <-timer.C:
+			setError(nil)
+			return 1
+		}
+	}
+	return setError(f.err)
+}
+
+// FutureClose releases a future. The write itself is unaffected.
+//
+//export FutureClose
+func FutureClose(futureID C.int64_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	futureMu.Lock()
+	_, ok := futures[int64(futureID)]
+	delete(futures, int64(futureID))
+	futureMu.Unlock()
+	if !ok {
+		return setError(unknownHandleError("future"))
+	}
+	return setError(nil)
+}
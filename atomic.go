@@ -0,0 +1,396 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// maxUpdateAttempts bounds how often a read-modify-write is retried after
+// losing an optimistic-concurrency race.
+const maxUpdateAttempts = 16
+
+// updateKey runs a read-modify-write of one key inside a transaction,
+// retrying on conflicts. fn receives the current value (found reports whether
+// the key exists) and returns the value to write, or write=false to leave the
+// key untouched.
+func updateKey(store kvStore, key []byte, fn func(current []byte, found bool) (next []byte, write bool, err error)) error {
+	return retryConflicts(func() error { return updateKeyOnce(store, key, false, fn) })
+}
+
+// editKey is updateKey for edits of a value in place, such as counters: the
+// new value keeps the expiry the key already had.
+func editKey(store kvStore, key []byte, fn func(current []byte, found bool) (next []byte, write bool, err error)) error {
+	return retryConflicts(func() error { return updateKeyOnce(store, key, true, fn) })
+}
+
+// retryConflicts runs attempt until it succeeds, fails with something other
+// than a conflict, or has been tried maxUpdateAttempts times.
+func retryConflicts(attempt func() error) error {
+	for n := 0; ; n++ {
+		err := attempt()
+		if !errors.Is(err, errConflict) || n+1 >= maxUpdateAttempts {
+			return err
+		}
+	}
+}
+
+func updateKeyOnce(store kvStore, key []byte, keepTTL bool, fn func([]byte, bool) ([]byte, bool, error)) error {
+	txn, err := beginTxn(store)
+	if err != nil {
+		return err
+	}
+	defer txn.Discard()
+
+	current, err := txn.Get(key)
+	found := true
+	if isNotFound(err) {
+		found = false
+	} else if err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if keepTTL && found {
+		// Read outside the transaction. A concurrent write to key, which
+		// could change its TTL, fails the commit instead, unless it rewrote
+		// the same value on a backend with emulated transactions.
+		ttl, err = keyTTL(store, key)
+		if isNotFound(err) {
+			return errConflict
+		} else if err != nil {
+			return err
+		}
+	}
+	next, write, err := fn(current, found)
+	if err != nil || !write {
+		return err
+	}
+	if err := txnSetWithTTL(txn, key, next, ttl); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// compareAndSwap replaces key's value with next only if it currently equals
+// expected. A nil expected means the key must not exist.
+func compareAndSwap(store kvStore, key, expected, next []byte) (bool, error) {
+	var swapped bool
+	err := updateKey(store, key, func(current []byte, found bool) ([]byte, bool, error) {
+		if expected == nil {
+			swapped = !found
+		} else {
+			swapped = found && bytes.Equal(current, expected)
+		}
+		return next, swapped, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return swapped, nil
+}
+
+// incrBy adds delta to the decimal integer stored at key, treating a missing
+// key as zero, and returns the new value. Counters are stored as ASCII text
+// so hosts can read them with a plain Get, and keep any TTL they were given.
+func incrBy(store kvStore, key []byte, delta int64) (int64, error) {
+	var result int64
+	err := editKey(store, key, func(current []byte, found bool) ([]byte, bool, error) {
+		var n int64
+		if found {
+			var err error
+			n, err = strconv.ParseInt(string(current), 10, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("value is not an integer: %w", err)
+			}
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, false, errors.New("increment would overflow")
+		}
+		result = n + delta
+		return strconv.AppendInt(nil, result, 10), true, nil
+	})
+	return result, err
+}
+
+// CompareAndSwap atomically replaces the value of key with newVal when its
+// current value equals expected. Passing a NULL expected pointer requires the
+// key to be absent instead. Returns 1 when the value was replaced, 0 when the
+// comparison failed and a negative status code on error.
+//
+//export CompareAndSwap
+func CompareAndSwap(handle C.uintptr_t, key *C.char, keyLen C.int, expected *C.char, expectedLen C.int, newVal *C.char, newValLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "compare_and_swap", time.Now())
+	return compareAndSwapExport(handle, key, keyLen, expected, expectedLen, newVal, newValLen)
+}
+
+func compareAndSwapExport(handle C.uintptr_t, key *C.char, keyLen C.int, expected *C.char, expectedLen C.int, newVal *C.char, newValLen C.int) C.int {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	var gotExpected []byte
+	if expected != nil {
+		gotExpected = C.GoBytes(unsafe.Pointer(expected), expectedLen)
+	}
+	gotValue := C.GoBytes(unsafe.Pointer(newVal), newValLen)
+
+	swapped, err := compareAndSwap(store, gotKey, gotExpected, gotValue)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	setHandleError(uintptr(handle), nil)
+	if swapped {
+		return 1
+	}
+	return 0
+}
+
+// IncrBy atomically adds delta (which may be negative) to the integer counter
+// at key and stores the new value in result.
+//
+//export IncrBy
+func IncrBy(handle C.uintptr_t, key *C.char, keyLen C.int, delta C.int64_t, result *C.int64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "incr_by", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+
+	n, err := incrBy(store, gotKey, int64(delta))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	*result = C.int64_t(n)
+	return setHandleError(uintptr(handle), nil)
+}
+
+// SetNX stores value only when key does not exist yet. Returns 1 when the
+// value was written, 0 when the key was already present and a negative
+// status code on error.
+//
+//export SetNX
+func SetNX(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "set_nx", time.Now())
+	return compareAndSwapExport(handle, key, keyLen, nil, 0, value, valueLen)
+}
+
+// getSet stores value at key and returns the value it replaced, if any.
+func getSet(store kvStore, key, value []byte) (old []byte, found bool, err error) {
+	err = updateKey(store, key, func(current []byte, exists bool) ([]byte, bool, error) {
+		old, found = current, exists
+		return value, true, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return old, found, nil
+}
+
+// GetSet atomically stores value at key and returns the previous value. When
+// the key did not exist the value is still written and NULL is returned with
+// a zero status, so hosts can tell a miss from a failure via ErrorCode.
+//
+//export GetSet
+func GetSet(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int, oldLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "get_set", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotValue := C.GoBytes(unsafe.Pointer(value), valueLen)
+
+	old, found, err := getSet(store, gotKey, gotValue)
+	if err != nil || !found {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	buf, err := returnValue(old, oldLen)
+	setHandleError(uintptr(handle), err)
+	return buf
+}
+
+// copyKey writes src's value to dst in one transaction, overwriting dst, and
+// deletes src as well when move is set. A missing src is a not-found error.
+func copyKey(store kvStore, src, dst []byte, move bool) error {
+	return retryConflicts(func() error {
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+
+		value, err := txn.Get(src)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(src, dst) {
+			return nil
+		}
+		if err := txn.Set(dst, value); err != nil {
+			return err
+		}
+		if move {
+			if err := txn.Delete(src); err != nil {
+				return err
+			}
+		}
+		return txn.Commit()
+	})
+}
+
+func copyKeyExport(handle C.uintptr_t, src *C.char, srcLen C.int, dst *C.char, dstLen C.int, move bool) C.int {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotSrc, err := userKey(src, srcLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotDst, err := userKey(dst, dstLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), copyKey(store, gotSrc, gotDst, move))
+}
+
+// CopyKey atomically copies the value of src to dst, replacing any value dst
+// already has. Returns the not-found status when src does not exist.
+//
+//export CopyKey
+func CopyKey(handle C.uintptr_t, src *C.char, srcLen C.int, dst *C.char, dstLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "copy_key", time.Now())
+	return copyKeyExport(handle, src, srcLen, dst, dstLen, false)
+}
+
+// RenameKey atomically moves the value of src to dst, replacing any value dst
+// already has, so readers see the key under exactly one name. Returns the
+// not-found status when src does not exist.
+//
+//export RenameKey
+func RenameKey(handle C.uintptr_t, src *C.char, srcLen C.int, dst *C.char, dstLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "rename_key", time.Now())
+	return copyKeyExport(handle, src, srcLen, dst, dstLen, true)
+}
+
+// getDel deletes key and returns the value it held, in one transaction.
+func getDel(store kvStore, key []byte) ([]byte, error) {
+	var value []byte
+	err := retryConflicts(func() error {
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+
+		value, err = txn.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+		return txn.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// GetDel atomically removes key and returns the value it held, so competing
+// consumers never receive the same value twice. A missing key returns NULL
+// with the not-found status.
+//
+//export GetDel
+func GetDel(handle C.uintptr_t, key *C.char, keyLen C.int, valueLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "get_del", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	value, err := getDel(store, gotKey)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	buf, err := returnValue(value, valueLen)
+	setHandleError(uintptr(handle), err)
+	return buf
+}
+
+// appendValue appends data to the value at key, creating the key when it is
+// missing, and returns the new length. The key keeps its TTL.
+func appendValue(store kvStore, key, data []byte) (int, error) {
+	var length int
+	err := editKey(store, key, func(current []byte, _ bool) ([]byte, bool, error) {
+		next := append(append(make([]byte, 0, len(current)+len(data)), current...), data...)
+		length = len(next)
+		return next, true, nil
+	})
+	return length, err
+}
+
+// Append atomically appends data to the value at key, creating it when the
+// key is missing. Returns the new length of the value or a negative status
+// code.
+//
+//export Append
+func Append(handle C.uintptr_t, key *C.char, keyLen C.int, data *C.char, dataLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "append", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	gotData := C.GoBytes(unsafe.Pointer(data), dataLen)
+
+	length, err := appendValue(store, gotKey, gotData)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(length)
+}
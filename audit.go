@@ -0,0 +1,503 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// auditPrefix holds one record per audited write, keyed by its big-endian
+// sequence number. A record is, little-endian: u64 time in Unix
+// milliseconds, u8 op, u32 key length, the key, u32 value size, the
+// SHA-256 of the write as a watch event, u32 actor length, the actor, and
+// the chain hash: SHA-256 of the previous record's chain hash followed by
+// everything before it in this record. The first record chains from 32 zero
+// bytes.
+var auditPrefix = []byte("\xffaudit/")
+
+// auditOpDropAll is the op of the record left by DropAll, which clears the
+// earlier records along with everything else.
+const auditOpDropAll byte = 0xff
+
+var (
+	errNoAudit          = errors.New("the store was not opened with audit")
+	errAuditChainBroken = errors.New("audit log hash chain is broken")
+)
+
+func auditKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte(nil), auditPrefix...), seq)
+}
+
+// appendAudit frames an audit record for op chained from prev.
+func appendAudit(buf []byte, prev [sha256.Size]byte, at time.Time, op operation, actor string) []byte {
+	start := len(buf)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(at.UnixMilli()))
+	buf = append(buf, op.op)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(op.key)))
+	buf = append(buf, op.key...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(op.value)))
+	opHash := sha256.Sum256(appendEvent(nil, watchEvent{op: op.op, key: op.key, value: op.value}))
+	buf = append(buf, opHash[:]...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(actor)))
+	buf = append(buf, actor...)
+	chain := auditChain(prev, buf[start:])
+	return append(buf, chain[:]...)
+}
+
+func auditChain(prev [sha256.Size]byte, body []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(prev[:])
+	h.Write(body)
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// auditRecordKey returns the key of the write record describes.
+func auditRecordKey(record []byte) ([]byte, bool) {
+	if len(record) < 13 {
+		return nil, false
+	}
+	n := int(binary.LittleEndian.Uint32(record[9:13]))
+	if len(record)-13 < n {
+		return nil, false
+	}
+	return record[13 : 13+n], true
+}
+
+// checkAudit verifies that record chains from prev and returns its op and
+// chain hash, which are also returned with errAuditChainBroken.
+func checkAudit(prev [sha256.Size]byte, record []byte) (byte, [sha256.Size]byte, error) {
+	var chain [sha256.Size]byte
+	if len(record) < 9+4+4+sha256.Size+4+sha256.Size {
+		return 0, chain, errors.New("malformed audit record")
+	}
+	body := record[:len(record)-sha256.Size]
+	copy(chain[:], record[len(body):])
+	if auditChain(prev, body) != chain {
+		return record[8], chain, errAuditChainBroken
+	}
+	return record[8], chain, nil
+}
+
+// auditStore records every write to inner in a hash-chained log, in the
+// same batch as the write. Writes are serialised so the chain follows
+// commit order. It sits below the change log, whose records are not
+// audited, and above index upkeep.
+type auditStore struct {
+	inner kvStore
+	mu    sync.Mutex
+	seq   uint64
+	head  [sha256.Size]byte
+	// actor tags the records of later writes; see SetActor.
+	actor string
+}
+
+// newAuditStore layers an audit log over store, carrying on the chain from
+// the last record already in it.
+func newAuditStore(store kvStore) (*auditStore, error) {
+	s := &auditStore{inner: store}
+	err := iterateReverse(store, auditPrefix, nextPrefix(auditPrefix), func(k, v []byte) error {
+		if len(v) < sha256.Size {
+			return errors.New("malformed audit record")
+		}
+		s.seq = binary.BigEndian.Uint64(k[len(auditPrefix):])
+		copy(s.head[:], v[len(v)-sha256.Size:])
+		return errStopIteration
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// audited appends an audit record for each write in ops and returns the new
+// chain head with the number of records. The caller holds s.mu and calls
+// committed once the batch is in.
+func (s *auditStore) audited(ops []operation) ([]operation, [sha256.Size]byte, int) {
+	batch := append(make([]operation, 0, 2*len(ops)), ops...)
+	now := time.Now()
+	head := s.head
+	n := 0
+	for _, op := range ops {
+		switch op.op {
+		case opSet, opDelete, opSetTTL:
+		default:
+			continue
+		}
+		if bytes.HasPrefix(op.key, changeLogPrefix) {
+			continue
+		}
+		n++
+		record := appendAudit(nil, head, now, op, s.actor)
+		copy(head[:], record[len(record)-sha256.Size:])
+		batch = append(batch, operation{op: opSet, key: auditKey(s.seq + uint64(n)), value: record})
+	}
+	return batch, head, n
+}
+
+func (s *auditStore) committed(head [sha256.Size]byte, n int) {
+	s.seq += uint64(n)
+	s.head = head
+}
+
+func (s *auditStore) apply(ops []operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, head, n := s.audited(ops)
+	if err := s.inner.Apply(batch); err != nil {
+		return err
+	}
+	s.committed(head, n)
+	return nil
+}
+
+func (s *auditStore) setActor(actor string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actor = actor
+}
+
+func (s *auditStore) unwrap() kvStore { return s.inner }
+
+func (s *auditStore) Close() error { return s.inner.Close() }
+
+func (s *auditStore) Set(key, value []byte) error {
+	return s.apply([]operation{{op: opSet, key: key, value: value}})
+}
+
+func (s *auditStore) Get(key []byte) ([]byte, error) { return s.inner.Get(key) }
+
+func (s *auditStore) Has(key []byte) (bool, error) { return hasKey(s.inner, key) }
+
+func (s *auditStore) Delete(key []byte) error {
+	return s.apply([]operation{{op: opDelete, key: key}})
+}
+
+func (s *auditStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, fn)
+}
+
+func (s *auditStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, fn)
+}
+
+func (s *auditStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, fn)
+}
+
+func (s *auditStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *auditStore) Sync() error { return s.inner.Sync() }
+
+func (s *auditStore) Apply(ops []operation) error { return s.apply(ops) }
+
+func (s *auditStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return s.apply([]operation{{op: opSetTTL, key: key, value: value, ttl: ttl}})
+}
+
+func (s *auditStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+func (s *auditStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, head, n := s.audited(ops)
+	seq, err := applyDurable(s.inner, batch, level)
+	if err != nil {
+		return 0, err
+	}
+	s.committed(head, n)
+	return seq, nil
+}
+
+func (s *auditStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+// SetWithMeta cannot carry the meta byte in an Apply batch, so the audit
+// record follows the value in a second write.
+func (s *auditStore) SetWithMeta(key, value []byte, meta byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, head, n := s.audited([]operation{{op: opSet, key: key, value: value}})
+	if err := setWithMeta(s.inner, key, value, meta); err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	if err := s.inner.Apply(batch[1:]); err != nil {
+		return err
+	}
+	s.committed(head, n)
+	return nil
+}
+
+func (s *auditStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	return getWithMeta(s.inner, key)
+}
+
+// DeleteRange audits each deleted key in the batch that deletes it. The log
+// itself is skipped, so a range covering it cannot break the chain.
+func (s *auditStore) DeleteRange(start, end []byte) (int, error) {
+	return deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		err := s.inner.IterateRange(from, end, func(k, _ []byte) error {
+			if len(keys) >= deleteBatchSize {
+				return errStopIteration
+			}
+			if !bytes.HasPrefix(k, auditPrefix) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		return keys, nil
+	}, func(keys [][]byte) error {
+		ops := make([]operation, len(keys))
+		for i, k := range keys {
+			ops[i] = operation{op: opDelete, key: k}
+		}
+		return s.apply(ops)
+	})
+}
+
+func (s *auditStore) CurrentVersion() (uint64, error) {
+	return versionsBelow{s.inner}.CurrentVersion()
+}
+
+func (s *auditStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	return versionsBelow{s.inner}.GetAt(key, version)
+}
+
+func (s *auditStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return versionsBelow{s.inner}.IterateAt(prefix, version, fn)
+}
+
+func (s *auditStore) Versions(key []byte) ([]keyVersion, error) {
+	return versionsBelow{s.inner}.Versions(key)
+}
+
+func (s *auditStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &auditTxn{txn: txn, store: s}, nil
+}
+
+// DropAll clears the store, audit log included, and leaves a record chained
+// from the old head so the log shows where it was cleared.
+func (s *auditStore) DropAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := dropAll(s.inner); err != nil {
+		return err
+	}
+	record := appendAudit(nil, s.head, time.Now(), operation{op: auditOpDropAll}, s.actor)
+	if err := s.inner.Set(auditKey(s.seq+1), record); err != nil {
+		return err
+	}
+	var head [sha256.Size]byte
+	copy(head[:], record[len(record)-sha256.Size:])
+	s.committed(head, 1)
+	return nil
+}
+
+func (s *auditStore) Compact() error { return compactStore(s.inner) }
+
+func (s *auditStore) Snapshot() (kvStore, error) { return openSnapshot(s.inner) }
+
+func (s *auditStore) Stats() (storeStats, error) { return collectStats(s.inner) }
+
+// A dump includes the log. Restoring one writes around the log, so the
+// restored keys are not audited.
+func (s *auditStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+func (s *auditStore) Load(r io.Reader) error { return restoreStore(s.inner, r) }
+
+// scan appends up to max records after since to buf, each framed as a u64
+// little-endian sequence number followed by the record, checking each
+// record's chain hash against the one before it, from the record at since
+// or from the start of the log when since is 0. A cleared log starts with a
+// DropAll record, whose predecessor is gone.
+func (s *auditStore) scan(buf []byte, since uint64, max int) ([]byte, error) {
+	var prev [sha256.Size]byte
+	if since > 0 {
+		record, err := s.inner.Get(auditKey(since))
+		if err != nil {
+			return nil, fmt.Errorf("audit record %d: %w", since, err)
+		}
+		if len(record) < sha256.Size {
+			return nil, errors.New("malformed audit record")
+		}
+		copy(prev[:], record[len(record)-sha256.Size:])
+	}
+
+	n := 0
+	next := since + 1
+	err := s.inner.IterateRange(auditKey(next), nextPrefix(auditPrefix), func(k, v []byte) error {
+		seq := binary.BigEndian.Uint64(k[len(auditPrefix):])
+		op, chain, err := checkAudit(prev, v)
+		if errors.Is(err, errAuditChainBroken) && since == 0 && n == 0 && op == auditOpDropAll {
+			err = nil
+		} else if err == nil && seq != next {
+			err = errAuditChainBroken
+		}
+		if err != nil {
+			return fmt.Errorf("audit record %d: %w", seq, err)
+		}
+		prev, next = chain, seq+1
+		buf = binary.LittleEndian.AppendUint64(buf, seq)
+		buf = append(buf, v...)
+		if n++; n >= max {
+			return errStopIteration
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// auditTxn audits a transaction's writes when it commits.
+type auditTxn struct {
+	txn   kvTxn
+	store *auditStore
+	ops   []operation
+}
+
+func (t *auditTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(key) }
+
+func (t *auditTxn) Set(key, value []byte) error {
+	if err := t.txn.Set(key, value); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opSet, key: append([]byte(nil), key...), value: append([]byte(nil), value...)})
+	return nil
+}
+
+func (t *auditTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := txnSetWithTTL(t.txn, key, value, ttl); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opSetTTL, key: append([]byte(nil), key...), value: append([]byte(nil), value...), ttl: ttl})
+	return nil
+}
+
+func (t *auditTxn) Delete(key []byte) error {
+	if err := t.txn.Delete(key); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opDelete, key: append([]byte(nil), key...)})
+	return nil
+}
+
+func (t *auditTxn) Commit() error {
+	s := t.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, head, n := s.audited(t.ops)
+	for _, op := range batch[len(t.ops):] {
+		if err := t.txn.Set(op.key, op.value); err != nil {
+			return err
+		}
+	}
+	if err := t.txn.Commit(); err != nil {
+		return err
+	}
+	s.committed(head, n)
+	return nil
+}
+
+func (t *auditTxn) Discard() { t.txn.Discard() }
+
+func auditFor(handle C.uintptr_t) (*auditStore, error) {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return nil, err
+	}
+	audit, ok := layerOf[*auditStore](store)
+	if !ok {
+		return nil, errNoAudit
+	}
+	return audit, nil
+}
+
+// SetActor tags the audit records of every later write on handle with
+// actor, such as the user or service making them, until it is changed.
+// NULL or "" clears it. The store must be opened with "audit": true.
+//
+//export SetActor
+func SetActor(handle C.uintptr_t, actor *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	audit, err := auditFor(handle)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	var a string
+	if actor != nil {
+		a = C.GoString(actor)
+	}
+	audit.setActor(a)
+	return setHandleError(uintptr(handle), nil)
+}
+
+// AuditScan returns up to maxRecords audit records with a sequence number
+// above seq, oldest first, each framed as a u64 sequence number followed by
+// the record: u64 time in Unix milliseconds, u8 op (0 set, 1 delete, 2 set
+// with TTL, 255 DropAll), u32 key length, key, u32 value size, 32-byte
+// SHA-256 of the write, u32 actor length, actor, and the 32-byte chain hash.
+// Every record's chain hash is checked against the one before it, starting
+// from record seq, and the call fails if any was altered or removed. No
+// newer records returns NULL with a zero status.
+//
+//export AuditScan
+func AuditScan(handle C.uintptr_t, seq C.int64_t, maxRecords C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	*resultLen = 0
+	audit, err := auditFor(handle)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if seq < 0 {
+		setHandleError(uintptr(handle), fmt.Errorf("invalid sequence %d", seq))
+		return nil
+	}
+	if maxRecords <= 0 {
+		maxRecords = 1
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	buffer, err = audit.scan(buffer, uint64(seq), int(maxRecords))
+	if err != nil || len(buffer) == 0 {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
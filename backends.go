@@ -0,0 +1,79 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// backendOpener opens the store named by a full path, scheme included.
+type backendOpener func(path string) (kvStore, error)
+
+// Backends register their URI scheme from an init function, so a backend
+// compiled in behind a build tag only needs its own file:
+//
+//	func init() { registerBackend("bolt", openBolt) }
+var (
+	backendMu sync.RWMutex
+	backends  = make(map[string]backendOpener)
+)
+
+// registerBackend makes paths of the form "scheme:..." open through open.
+// Schemes are case-insensitive; registering one twice is a programming error.
+func registerBackend(scheme string, open backendOpener) {
+	scheme = strings.ToLower(scheme)
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if _, dup := backends[scheme]; dup {
+		panic(fmt.Sprintf("skyshelve: backend %q registered twice", scheme))
+	}
+	backends[scheme] = open
+}
+
+// lookupBackend returns the opener for path's scheme. Paths without a
+// registered scheme, including Windows drive letters, are not matched and
+// open as badger directories.
+func lookupBackend(path string) (backendOpener, bool) {
+	scheme, _, ok := strings.Cut(path, ":")
+	if !ok {
+		return nil, false
+	}
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	open, ok := backends[strings.ToLower(scheme)]
+	return open, ok
+}
+
+func backendSchemes() []string {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// ListBackends returns a JSON array of the URI schemes this build can open,
+// for the host to release with FreeCString. Plain paths always open badger.
+//
+//export ListBackends
+func ListBackends() (ret *C.char) {
+	defer recoverExport(0, &ret, nil)
+	doc, err := json.Marshal(backendSchemes())
+	if err != nil {
+		setError(err)
+		return nil
+	}
+	setError(nil)
+	return C.CString(string(doc))
+}
@@ -0,0 +1,323 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Backends without a native backup format are dumped portably: dumpMagic,
+// then one record per entry of u32 key length, u32 value length, i64 expiry
+// in Unix nanoseconds (0 for none), key, value; all little-endian. A dump can
+// be restored into any backend.
+var dumpMagic = []byte("SKYDUMP1")
+
+const (
+	dumpRecordHeaderLen = 4 + 4 + 8
+	restoreBatchSize    = 1000
+)
+
+// backuper is implemented by backends with a native backup stream. Backup
+// writes every entry changed after version since (0 for a full backup) and
+// returns the version to pass as since for the next incremental backup.
+type backuper interface {
+	Backup(w io.Writer, since uint64) (uint64, error)
+}
+
+// loader is implemented by backends that can ingest their native backup
+// stream.
+type loader interface {
+	Load(r io.Reader) error
+}
+
+func backupStore(store kvStore, w io.Writer, since uint64) (uint64, error) {
+	if b, ok := store.(backuper); ok {
+		return b.Backup(w, since)
+	}
+	if since != 0 {
+		return 0, errors.New("incremental backups are not supported by this backend")
+	}
+	return 0, writeDump(w, func(fn func(k, v []byte, expiresAt int64) error) error {
+		return store.IterateRange(nil, nil, func(k, v []byte) error {
+			return fn(k, v, 0)
+		})
+	})
+}
+
+// restoreStore loads a backup into store, detecting portable dumps by their
+// magic and handing anything else to the backend's native loader. Dumps
+// taken through codec layers hold encoded values, so on a store with codecs
+// every layer loads them like a native backup, down to the backend, and
+// they go unreported to callbacks and logs.
+func restoreStore(store kvStore, r io.Reader) error {
+	if _, ok := layerOf[*codecStore](store); ok {
+		if l, ok := store.(loader); ok {
+			return l.Load(r)
+		}
+	}
+	br := bufio.NewReader(r)
+	head, err := br.Peek(max(len(dumpMagic), len(ndjsonDumpMagic)))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if bytes.HasPrefix(head, dumpMagic) {
+		return readDump(store, br)
+	}
+	if bytes.HasPrefix(head, ndjsonDumpMagic) {
+		return readNDJSONDump(store, br)
+	}
+	l, ok := store.(loader)
+	if !ok {
+		return errors.New("backup is not a skyshelve dump and this backend has no native restore")
+	}
+	return l.Load(br)
+}
+
+func writeDump(w io.Writer, iterate func(fn func(k, v []byte, expiresAt int64) error) error) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(dumpMagic); err != nil {
+		return err
+	}
+	var header [dumpRecordHeaderLen]byte
+	err := iterate(func(k, v []byte, expiresAt int64) error {
+		binary.LittleEndian.PutUint32(header[0:4], uint32(len(k)))
+		binary.LittleEndian.PutUint32(header[4:8], uint32(len(v)))
+		binary.LittleEndian.PutUint64(header[8:16], uint64(expiresAt))
+		if _, err := bw.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(k); err != nil {
+			return err
+		}
+		_, err := bw.Write(v)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readDump applies a portable dump in batches. Entries that expired since the
+// dump was taken are skipped; the rest keep their remaining time-to-live.
+func readDump(store kvStore, r io.Reader) error {
+	if _, err := io.ReadFull(r, make([]byte, len(dumpMagic))); err != nil {
+		return err
+	}
+	var header [dumpRecordHeaderLen]byte
+	var ops []operation
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("truncated dump: %w", err)
+		}
+		keyLen := binary.LittleEndian.Uint32(header[0:4])
+		valueLen := binary.LittleEndian.Uint32(header[4:8])
+		expiresAt := int64(binary.LittleEndian.Uint64(header[8:16]))
+		entry := make([]byte, int(keyLen)+int(valueLen))
+		if _, err := io.ReadFull(r, entry); err != nil {
+			return fmt.Errorf("truncated dump: %w", err)
+		}
+
+		op := operation{op: opSet, key: entry[:keyLen], value: entry[keyLen:]}
+		if expiresAt != 0 {
+			ttl := time.Until(time.Unix(0, expiresAt))
+			if ttl <= 0 {
+				continue
+			}
+			op.op, op.ttl = opSetTTL, ttl
+		}
+		ops = append(ops, op)
+		if len(ops) == restoreBatchSize {
+			if err := store.Apply(ops); err != nil {
+				return err
+			}
+			ops = ops[:0]
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return store.Apply(ops)
+}
+
+// Backup writes badger's native backup stream, which keeps TTLs and other
+// entry metadata. Versions are badger commit timestamps; the stream skips
+// versions <= since, so the highest version dumped is the next since. An
+// empty delta reports 0, which must not restart the chain from scratch.
+//
+// Deletes reach a delta only as the delete markers badger keeps for them.
+// DropAll and Erase drop keys without leaving markers, and
+// compaction discards markers once no older version is left, so a delta can
+// miss those deletions and a restore brings the keys back.
+func (s *badgerStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	version, err := s.db.Backup(w, since)
+	return max(version, since), err
+}
+
+// Load restores a native badger backup stream.
+func (s *badgerStore) Load(r io.Reader) error {
+	return s.db.Load(r, 256)
+}
+
+// Backup writes a portable dump, carrying expiry envelopes across as explicit
+// expiry times. SlateDB does not expose entry versions, so only full backups
+// are possible.
+func (s *slateStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	if since != 0 {
+		return 0, errors.New("incremental backups are not supported by the slatedb backend")
+	}
+	now := time.Now()
+	return 0, writeDump(w, func(fn func(k, v []byte, expiresAt int64) error) error {
+		return s.scan(nil, nil, func(k, raw []byte) error {
+			value, live := unwrapExpiry(raw, now)
+			if !live {
+				return nil
+			}
+			return fn(k, value, envelopeExpiry(raw))
+		})
+	})
+}
+
+// writeBackupFile writes through a temporary file and renames it into place,
+// so a failed backup never leaves a truncated file at dest.
+func writeBackupFile(dest string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".skyshelve-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// Backup writes a full backup of the store to destPath. Badger stores produce
+// a native badger backup; other backends produce a portable dump.
+//
+//export Backup
+func Backup(handle C.uintptr_t, destPath *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	var next C.uint64_t
+	return BackupSince(handle, 0, destPath, &next)
+}
+
+// BackupSince writes only the entries changed after sinceVersion (0 for a
+// full backup) and stores the version to pass next time in nextVersion.
+// Restore the full backup first, then each delta in the order taken.
+// Incremental backups are only available for Badger stores, and may not
+// carry every deletion: take a new full backup after DropAll or Erase, or
+// whenever restored deletes matter.
+//
+//export BackupSince
+func BackupSince(handle C.uintptr_t, sinceVersion C.uint64_t, destPath *C.char, nextVersion *C.uint64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	var next uint64
+	err = writeBackupFile(C.GoString(destPath), func(w io.Writer) error {
+		var err error
+		next, err = backupStore(store, w, uint64(sinceVersion))
+		return err
+	})
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	*nextVersion = C.uint64_t(next)
+	return setHandleError(uintptr(handle), nil)
+}
+
+// restoreFile loads the backup at backupPath into store and closes it.
+func restoreFile(store kvStore, backupPath string) error {
+	f, err := os.Open(backupPath)
+	if err != nil {
+		store.Close()
+		return err
+	}
+	defer f.Close()
+
+	err = restoreStore(store, f)
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Restore opens the store at path (any form accepted by Open), loads the
+// backup at backupPath into it and closes it again. Existing keys that are
+// not in the backup are left in place. Backups of stores opened with
+// encryption, compression or checksums need RestoreWithOptions.
+//
+//export Restore
+func Restore(path *C.char, backupPath *C.char) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	store, err := openStore(C.GoString(path), false)
+	if err != nil {
+		return setError(err)
+	}
+	return setError(restoreFile(store, C.GoString(backupPath)))
+}
+
+// RestoreWithOptions is Restore for a store described by an OpenWithOptions
+// document. The backup holds values as the source's codecs wrote them, so
+// pass the source's options: the store is opened with the same codecs, and
+// with Badger's encryption key, and any indexes are rebuilt after the load.
+//
+//export RestoreWithOptions
+func RestoreWithOptions(jsonOptions *C.char, backupPath *C.char) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	opts, err := parseOpenOptions(C.GoString(jsonOptions))
+	if err != nil {
+		return setError(err)
+	}
+	store, err := openWithOptions(opts)
+	if err != nil {
+		return setError(err)
+	}
+	return setError(restoreFile(store, C.GoString(backupPath)))
+}
+
+// RestoreInto loads a full or incremental backup into an already open store,
+// which lets hosts apply a chain of deltas without reopening the store. No
+// other writes should run against the handle while it loads.
+//
+//export RestoreInto
+func RestoreInto(handle C.uintptr_t, backupPath *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	f, err := os.Open(C.GoString(backupPath))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	defer f.Close()
+	return setHandleError(uintptr(handle), restoreStore(store, f))
+}
@@ -0,0 +1,575 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Blobs are stored in blobChunkSize pieces beside a manifest:
+//
+//	blobPrefix | u32 key length | key                        manifest
+//	manifest key | u64 generation | u32 chunk index          chunk
+//
+// The manifest value is the u64 generation, u64 size and u32 chunk size, all
+// big-endian. Each write gets a new generation, and the manifest switches to
+// it only once every chunk is in place, so readers never see half a blob.
+// Generations follow the order writes start in, and of two writes to one key
+// the later one wins whichever commits first.
+const blobChunkSize = 256 << 10
+
+var (
+	blobPrefix = []byte("\xffblob/")
+
+	errBlobClosed  = errors.New("blob handle closed")
+	errBlobChanged = fmt.Errorf("blob was overwritten or deleted while being read: %w", errConflict)
+	errBlobStale   = fmt.Errorf("a blob written later was committed first: %w", errConflict)
+
+	// blobCommitMu makes checking and replacing a manifest one step.
+	blobCommitMu sync.Mutex
+	lastBlobGen  atomic.Uint64
+)
+
+// nextBlobGen returns the current time in nanoseconds, bumped past the last
+// generation handed out.
+func nextBlobGen() uint64 {
+	for {
+		last := lastBlobGen.Load()
+		gen := max(uint64(time.Now().UnixNano()), last+1)
+		if lastBlobGen.CompareAndSwap(last, gen) {
+			return gen
+		}
+	}
+}
+
+func blobKey(key []byte) []byte {
+	return appendLenPrefixed(append([]byte(nil), blobPrefix...), key)
+}
+
+// blobRuns returns the key prefixes holding the blobs, with their chunks,
+// whose keys start with prefix. Blob keys are length-prefixed, so those
+// blobs sit in one run per key length; blobRuns seeks from one length in use
+// to the next instead of reading every blob.
+func blobRuns(store kvStore, prefix []byte) ([][]byte, error) {
+	var runs [][]byte
+	end := nextPrefix(blobPrefix)
+	for n := uint64(len(prefix)); n <= math.MaxUint32; {
+		run := binary.BigEndian.AppendUint32(bytes.Clone(blobPrefix), uint32(n))
+		run = append(run, prefix...)
+		var first []byte
+		err := store.IterateRange(run, end, func(k, _ []byte) error {
+			first = bytes.Clone(k)
+			return errStopIteration
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		switch {
+		case first == nil:
+			return runs, nil
+		case bytes.HasPrefix(first, run):
+			runs = append(runs, run)
+			n++
+		case len(first) >= len(blobPrefix)+4 && uint64(binary.BigEndian.Uint32(first[len(blobPrefix):])) > n:
+			n = uint64(binary.BigEndian.Uint32(first[len(blobPrefix):]))
+		default:
+			n++
+		}
+	}
+	return runs, nil
+}
+
+func blobGenKey(manifest []byte, gen uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte(nil), manifest...), gen)
+}
+
+func blobChunkKey(manifest []byte, gen uint64, index uint32) []byte {
+	return binary.BigEndian.AppendUint32(blobGenKey(manifest, gen), index)
+}
+
+type blobManifest struct {
+	gen       uint64
+	size      uint64
+	chunkSize uint32
+}
+
+func readBlobManifest(store kvStore, manifest []byte) (blobManifest, error) {
+	v, err := store.Get(manifest)
+	if err != nil {
+		return blobManifest{}, err
+	}
+	if len(v) != 20 {
+		return blobManifest{}, fmt.Errorf("%w: blob manifest of %d bytes", errCorrupt, len(v))
+	}
+	m := blobManifest{
+		gen:       binary.BigEndian.Uint64(v),
+		size:      binary.BigEndian.Uint64(v[8:]),
+		chunkSize: binary.BigEndian.Uint32(v[16:]),
+	}
+	if m.chunkSize == 0 {
+		return blobManifest{}, fmt.Errorf("%w: blob manifest with zero chunk size", errCorrupt)
+	}
+	return m, nil
+}
+
+// blobWriter buffers one chunk at a time and writes each as it fills.
+type blobWriter struct {
+	mu       sync.Mutex
+	storeID  uintptr
+	store    kvStore
+	manifest []byte
+	gen      uint64
+	buf      []byte
+	chunks   uint32
+	size     uint64
+	closed   bool
+}
+
+func newBlobWriter(storeID uintptr, store kvStore, key []byte) *blobWriter {
+	return &blobWriter{
+		storeID:  storeID,
+		store:    store,
+		manifest: blobKey(key),
+		gen:      nextBlobGen(),
+		buf:      make([]byte, 0, blobChunkSize),
+	}
+}
+
+func (w *blobWriter) write(p []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errBlobClosed
+	}
+	for len(p) > 0 {
+		n := min(len(p), blobChunkSize-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		if len(w.buf) == blobChunkSize {
+			if err := w.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush writes the buffered chunk. The buffer is not reused, as layers such
+// as the value cache may keep it.
+func (w *blobWriter) flush() error {
+	if err := w.store.Set(blobChunkKey(w.manifest, w.gen, w.chunks), w.buf); err != nil {
+		return err
+	}
+	w.chunks++
+	w.size += uint64(len(w.buf))
+	w.buf = make([]byte, 0, blobChunkSize)
+	return nil
+}
+
+// commit writes the last chunk and points the manifest at this generation,
+// then removes the chunks of earlier ones, including any left by writers
+// that never finished. It fails with errBlobStale if a later write to the
+// key has already committed.
+func (w *blobWriter) commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errBlobClosed
+	}
+	w.closed = true
+	if len(w.buf) > 0 {
+		if err := w.flush(); err != nil {
+			w.discard()
+			return err
+		}
+	}
+	manifest := binary.BigEndian.AppendUint64(nil, w.gen)
+	manifest = binary.BigEndian.AppendUint64(manifest, w.size)
+	manifest = binary.BigEndian.AppendUint32(manifest, blobChunkSize)
+	blobCommitMu.Lock()
+	current, err := readBlobManifest(w.store, w.manifest)
+	switch {
+	case err == nil && current.gen > w.gen:
+		err = errBlobStale
+	case err == nil, isNotFound(err), errors.Is(err, errCorrupt):
+		err = w.store.Set(w.manifest, manifest)
+	}
+	blobCommitMu.Unlock()
+	if err != nil {
+		w.discard()
+		return err
+	}
+	_, err = deleteRange(w.store, blobGenKey(w.manifest, 0), blobGenKey(w.manifest, w.gen))
+	return err
+}
+
+func (w *blobWriter) abort() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errBlobClosed
+	}
+	w.closed = true
+	return w.discard()
+}
+
+// discard removes the chunks written so far. The caller holds w.mu.
+func (w *blobWriter) discard() error {
+	gen := blobGenKey(w.manifest, w.gen)
+	_, err := deleteRange(w.store, gen, nextPrefix(gen))
+	return err
+}
+
+// blobReader streams a blob's chunks in order, holding one in memory.
+type blobReader struct {
+	mu       sync.Mutex
+	storeID  uintptr
+	store    kvStore
+	manifest []byte
+	blobManifest
+	offset uint64
+	chunk  []byte
+	index  uint32
+}
+
+func openBlobReader(storeID uintptr, store kvStore, key []byte) (*blobReader, error) {
+	manifest := blobKey(key)
+	m, err := readBlobManifest(store, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &blobReader{storeID: storeID, store: store, manifest: manifest, blobManifest: m, index: math.MaxUint32}, nil
+}
+
+// read fills p from the current offset and returns how many bytes it copied,
+// which is less than len(p) only at the end of the blob.
+func (r *blobReader) read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(p) && r.offset < r.size {
+		index := uint32(r.offset / uint64(r.chunkSize))
+		if index != r.index {
+			chunk, err := r.store.Get(blobChunkKey(r.manifest, r.gen, index))
+			if isNotFound(err) {
+				return n, errBlobChanged
+			}
+			if err != nil {
+				return n, err
+			}
+			r.chunk, r.index = chunk, index
+		}
+		within := r.offset - uint64(index)*uint64(r.chunkSize)
+		if within >= uint64(len(r.chunk)) {
+			return n, fmt.Errorf("%w: blob chunk %d is short", errCorrupt, index)
+		}
+		copied := copy(p[n:], r.chunk[within:])
+		n += copied
+		r.offset += uint64(copied)
+	}
+	return n, nil
+}
+
+var (
+	blobMu      sync.Mutex
+	blobWriters         = make(map[uintptr]*blobWriter)
+	blobReaders         = make(map[uintptr]*blobReader)
+	nextBlobID  uintptr = 1
+)
+
+func storeBlobWriter(w *blobWriter) uintptr {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	id := nextBlobID
+	nextBlobID++
+	blobWriters[id] = w
+	return id
+}
+
+func storeBlobReader(r *blobReader) uintptr {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	id := nextBlobID
+	nextBlobID++
+	blobReaders[id] = r
+	return id
+}
+
+func getBlobWriter(id uintptr) (*blobWriter, error) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	w, ok := blobWriters[id]
+	if !ok {
+		return nil, unknownHandleError("blob writer")
+	}
+	return w, nil
+}
+
+func getBlobReader(id uintptr) (*blobReader, error) {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	r, ok := blobReaders[id]
+	if !ok {
+		return nil, unknownHandleError("blob reader")
+	}
+	return r, nil
+}
+
+func deleteBlobWriter(id uintptr) *blobWriter {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	w := blobWriters[id]
+	delete(blobWriters, id)
+	return w
+}
+
+func deleteBlobReader(id uintptr) *blobReader {
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	r := blobReaders[id]
+	delete(blobReaders, id)
+	return r
+}
+
+// closeBlobsFor drops the blob readers of a store handle and aborts its
+// unfinished writes before the store closes.
+func closeBlobsFor(storeID uintptr) {
+	blobMu.Lock()
+	var open []*blobWriter
+	for id, w := range blobWriters {
+		if w.storeID == storeID {
+			open = append(open, w)
+			delete(blobWriters, id)
+		}
+	}
+	for id, r := range blobReaders {
+		if r.storeID == storeID {
+			delete(blobReaders, id)
+		}
+	}
+	blobMu.Unlock()
+
+	for _, w := range open {
+		if err := w.abort(); err != nil && !errors.Is(err, errBlobClosed) {
+			logf(logWarn, "blob", "handle %d: %v", storeID, err)
+		}
+	}
+}
+
+// BlobCreate starts writing a blob under key, which may be larger than the
+// backend allows for one value, and returns a writer handle, or 0 on error.
+// Feed it with BlobWrite and finish with BlobCommit, or BlobAbort to drop
+// it. Blobs live in their own keyspace: key does not clash with a plain
+// value of the same name.
+//
+//export BlobCreate
+func BlobCreate(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.uintptr_t) {
+	defer recoverExport(uintptr(handle), &ret, 0)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	if isSnapshot(uintptr(handle)) {
+		setHandleError(uintptr(handle), errReadOnly)
+		return 0
+	}
+	w := newBlobWriter(uintptr(handle), store, C.GoBytes(unsafe.Pointer(key), keyLen))
+	setHandleError(uintptr(handle), nil)
+	return C.uintptr_t(storeBlobWriter(w))
+}
+
+// BlobWrite appends dataLen bytes to a blob being written.
+//
+//export BlobWrite
+func BlobWrite(writer C.uintptr_t, data *C.char, dataLen C.int) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	w, err := getBlobWriter(uintptr(writer))
+	if err != nil {
+		return setError(err)
+	}
+	if dataLen < 0 {
+		return setHandleError(w.storeID, errors.New("negative data length"))
+	}
+	p := unsafe.Slice((*byte)(unsafe.Pointer(data)), int(dataLen))
+	if err := admitWrites(w.storeID, []operation{{op: opSet, value: p}}); err != nil {
+		return setHandleError(w.storeID, err)
+	}
+	return setHandleError(w.storeID, w.write(p))
+}
+
+// BlobCommit finishes a blob and releases the writer handle. The blob
+// replaces any earlier one under the same key only now; readers still
+// streaming the earlier blob then fail with status -3.
+//
+//export BlobCommit
+func BlobCommit(writer C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	w := deleteBlobWriter(uintptr(writer))
+	if w == nil {
+		return setError(unknownHandleError("blob writer"))
+	}
+	return setHandleError(w.storeID, w.commit())
+}
+
+// BlobAbort drops an unfinished blob and releases the writer handle. Any
+// earlier blob under the key is left as it was.
+//
+//export BlobAbort
+func BlobAbort(writer C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	w := deleteBlobWriter(uintptr(writer))
+	if w == nil {
+		return setError(unknownHandleError("blob writer"))
+	}
+	return setHandleError(w.storeID, w.abort())
+}
+
+// BlobPut writes a whole blob from one buffer. valueLen is 64-bit so values
+// past 2 GiB can be passed.
+//
+//export BlobPut
+func BlobPut(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if isSnapshot(uintptr(handle)) {
+		return setHandleError(uintptr(handle), errReadOnly)
+	}
+	if valueLen < 0 {
+		return setHandleError(uintptr(handle), errors.New("negative value length"))
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	p := unsafe.Slice((*byte)(unsafe.Pointer(value)), int(valueLen))
+	if err := admitWrites(uintptr(handle), []operation{{op: opSet, key: gotKey, value: p}}); err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	w := newBlobWriter(uintptr(handle), store, gotKey)
+	if err := w.write(p); err != nil {
+		w.abort()
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), w.commit())
+}
+
+// BlobOpen opens the blob under key for streaming with BlobRead and stores
+// its size in size. It returns a reader handle, or 0 on error; a missing
+// blob reports status -2.
+//
+//export BlobOpen
+func BlobOpen(handle C.uintptr_t, key *C.char, keyLen C.int, size *C.int64_t) (ret C.uintptr_t) {
+	defer recoverExport(uintptr(handle), &ret, 0)
+	*size = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	r, err := openBlobReader(uintptr(handle), store, C.GoBytes(unsafe.Pointer(key), keyLen))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	*size = C.int64_t(r.size)
+	setHandleError(uintptr(handle), nil)
+	return C.uintptr_t(storeBlobReader(r))
+}
+
+// BlobRead copies the next bytes of a blob into buf, which the caller owns,
+// and returns how many it copied: bufCap until the end of the blob, then
+// fewer, then 0. Errors return a negative status code.
+//
+//export BlobRead
+func BlobRead(reader C.uintptr_t, buf *C.char, bufCap C.int) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	r, err := getBlobReader(uintptr(reader))
+	if err != nil {
+		return setError(err)
+	}
+	if bufCap < 0 {
+		return setHandleError(r.storeID, errors.New("negative buffer capacity"))
+	}
+	n, err := r.read(unsafe.Slice((*byte)(unsafe.Pointer(buf)), int(bufCap)))
+	if err != nil {
+		return setHandleError(r.storeID, err)
+	}
+	setHandleError(r.storeID, nil)
+	return C.int(n)
+}
+
+//export BlobClose
+func BlobClose(reader C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	r := deleteBlobReader(uintptr(reader))
+	if r == nil {
+		return setError(unknownHandleError("blob reader"))
+	}
+	return setHandleError(r.storeID, nil)
+}
+
+// BlobGet returns a whole blob in one buffer for the host to release with
+// FreeBuffer. Blobs of 2 GiB or more must be streamed with BlobOpen.
+//
+//export BlobGet
+func BlobGet(handle C.uintptr_t, key *C.char, keyLen C.int, valueLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	*valueLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	r, err := openBlobReader(uintptr(handle), store, C.GoBytes(unsafe.Pointer(key), keyLen))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if r.size > math.MaxInt32 {
+		setHandleError(uintptr(handle), errors.New("blob too large for BlobGet; stream it with BlobOpen"))
+		return nil
+	}
+	data := make([]byte, r.size)
+	if _, err := r.read(data); err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	buf, err := returnValue(data, valueLen)
+	setHandleError(uintptr(handle), err)
+	return buf
+}
+
+// BlobDelete removes the blob under key with all its chunks. Deleting a
+// missing blob succeeds.
+//
+//export BlobDelete
+func BlobDelete(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if isSnapshot(uintptr(handle)) {
+		return setHandleError(uintptr(handle), errReadOnly)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	if err := admitWrites(uintptr(handle), []operation{{op: opDelete, key: gotKey}}); err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	start, end := prefixRange(blobKey(gotKey))
+	_, err = deleteRange(store, start, end)
+	return setHandleError(uintptr(handle), err)
+}
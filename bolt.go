@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket holds every entry; bbolt keeps keys sorted within a bucket.
+var boltBucket = []byte("skyshelve")
+
+// boltOpenTimeout bounds how long Open waits for another process to release
+// the database file lock.
+const boltOpenTimeout = 5 * time.Second
+
+// boltStore keeps the whole store in a single bbolt file. Every write is its
+// own durable transaction; reads are served from bbolt's memory map.
+type boltStore struct {
+	db *bolt.DB
+	// commitMu is held shared by every write and exclusively by emulated
+	// transaction commits.
+	commitMu sync.RWMutex
+}
+
+func init() { registerBackend("bolt", openBolt) }
+
+// openBolt opens a "bolt:" path. The part after the scheme (and an optional
+// "//") names the database file, defaulting to ./data/bolt.db.
+func openBolt(raw string) (kvStore, error) {
+	path := strings.TrimSpace(raw[len("bolt:"):])
+	return openBoltFile(strings.TrimPrefix(path, "//"))
+}
+
+func openBoltFile(path string) (kvStore, error) {
+	if path == "" {
+		path = defaultDataDir("bolt") + ".db"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Close() error { return s.db.Close() }
+
+func (s *boltStore) view(fn func(b *bolt.Bucket) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(boltBucket))
+	})
+}
+
+func (s *boltStore) update(fn func(b *bolt.Bucket) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(boltBucket))
+	})
+}
+
+func (s *boltStore) Set(key, value []byte) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.update(func(b *bolt.Bucket) error { return b.Put(key, value) })
+}
+
+// Get copies the value out, as bbolt's slices point into the memory map and
+// are only valid inside the transaction.
+func (s *boltStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.view(func(b *bolt.Bucket) error {
+		v := b.Get(key)
+		if v == nil {
+			return badger.ErrKeyNotFound
+		}
+		value = append([]byte{}, v...)
+		return nil
+	})
+	return value, err
+}
+
+func (s *boltStore) Has(key []byte) (bool, error) {
+	found := false
+	err := s.view(func(b *bolt.Bucket) error {
+		found = b.Get(key) != nil
+		return nil
+	})
+	return found, err
+}
+
+func (s *boltStore) Delete(key []byte) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.update(func(b *bolt.Bucket) error { return b.Delete(key) })
+}
+
+// scan walks [start, end) in key order. The slices passed to fn are only
+// valid during the call.
+func (s *boltStore) scan(start, end []byte, fn func(k, v []byte) error) error {
+	return s.view(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		var k, v []byte
+		if start == nil {
+			k, v = c.First()
+		} else {
+			k, v = c.Seek(start)
+		}
+		for ; k != nil; k, v = c.Next() {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				return nil
+			}
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	start, end := prefixRange(prefix)
+	return s.IterateRange(start, end, fn)
+}
+
+func (s *boltStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.scan(start, end, func(k, v []byte) error {
+		return fn(append([]byte(nil), k...), append([]byte(nil), v...))
+	})
+}
+
+func (s *boltStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return s.view(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		var k, v []byte
+		if end == nil {
+			k, v = c.Last()
+		} else if k, v = c.Seek(end); k == nil {
+			k, v = c.Last()
+		} else {
+			// Seek lands on the first key >= end, which is excluded.
+			k, v = c.Prev()
+		}
+		for ; k != nil; k, v = c.Prev() {
+			if start != nil && bytes.Compare(k, start) < 0 {
+				return nil
+			}
+			if err := fn(append([]byte(nil), k...), append([]byte(nil), v...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Count(start, end []byte) (int, error) {
+	n := 0
+	err := s.scan(start, end, func(_, _ []byte) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// Sync is a no-op in practice: bbolt fsyncs every committed write.
+func (s *boltStore) Sync() error { return s.db.Sync() }
+
+// Apply commits the batch as a single bbolt transaction.
+func (s *boltStore) Apply(ops []operation) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.apply(ops)
+}
+
+// apply is Apply without commitMu, for commits that already hold it.
+func (s *boltStore) apply(ops []operation) error {
+	return s.update(func(b *bolt.Bucket) error {
+		for _, op := range ops {
+			switch op.op {
+			case opSet:
+				if err := b.Put(op.key, op.value); err != nil {
+					return err
+				}
+			case opDelete:
+				if err := b.Delete(op.key); err != nil {
+					return err
+				}
+			case opSetTTL:
+				return errors.New("TTLs are not supported by the bolt backend")
+			default:
+				return errors.New("unknown operation code")
+			}
+		}
+		return nil
+	})
+}
+
+// Begin emulates interactive transactions rather than holding a bbolt write
+// transaction open, which would block every other writer until the host
+// committed.
+func (s *boltStore) Begin() (kvTxn, error) {
+	return newEmulatedTxn(s, &s.commitMu, s.apply), nil
+}
@@ -0,0 +1,329 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bucket data lives under bucketDataPrefix, a uvarint name length and the
+// name, so no bucket's keys are a prefix of another's. Each bucket also has
+// a marker record under bucketMarkerPrefix + name for ListBuckets, holding
+// its quota as JSON once one is set.
+var (
+	bucketDataPrefix   = []byte("\xffbkt/")
+	bucketMarkerPrefix = []byte("\xffbkt!")
+)
+
+func bucketPrefix(name string) []byte {
+	prefix := append([]byte(nil), bucketDataPrefix...)
+	prefix = binary.AppendUvarint(prefix, uint64(len(name)))
+	return append(prefix, name...)
+}
+
+func bucketMarker(name string) []byte {
+	return append(append([]byte(nil), bucketMarkerPrefix...), name...)
+}
+
+// bucketStore is a view of the keys under one bucket's prefix. Keys passed
+// in are prefixed and keys passed out have the prefix stripped, so the host
+// never sees the encoding. Closing it leaves the parent store open.
+type bucketStore struct {
+	inner  kvStore
+	prefix []byte
+	usage  *bucketUsage
+}
+
+func (s *bucketStore) key(k []byte) []byte {
+	return append(append(make([]byte, 0, len(s.prefix)+len(k)), s.prefix...), k...)
+}
+
+// bounds maps [start, end) inside the bucket onto the parent's key space.
+func (s *bucketStore) bounds(start, end []byte) ([]byte, []byte) {
+	from, to := s.key(start), nextPrefix(s.prefix)
+	if end != nil {
+		to = s.key(end)
+	}
+	return from, to
+}
+
+func (s *bucketStore) strip(fn func(k, v []byte) error) func(k, v []byte) error {
+	return func(k, v []byte) error { return fn(k[len(s.prefix):], v) }
+}
+
+func (s *bucketStore) Close() error { return nil }
+
+func (s *bucketStore) Set(key, value []byte) error {
+	if s.usage.limited() {
+		return s.usage.apply(s, []operation{{op: opSet, key: key, value: value}})
+	}
+	return s.inner.Set(s.key(key), value)
+}
+
+func (s *bucketStore) Get(key []byte) ([]byte, error) { return s.inner.Get(s.key(key)) }
+
+func (s *bucketStore) Has(key []byte) (bool, error) { return hasKey(s.inner, s.key(key)) }
+
+func (s *bucketStore) Delete(key []byte) error {
+	if s.usage.limited() {
+		return s.usage.apply(s, []operation{{op: opDelete, key: key}})
+	}
+	return s.inner.Delete(s.key(key))
+}
+
+func (s *bucketStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(s.key(prefix), s.strip(fn))
+}
+
+func (s *bucketStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	from, to := s.bounds(start, end)
+	return s.inner.IterateRange(from, to, s.strip(fn))
+}
+
+func (s *bucketStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	from, to := s.bounds(start, end)
+	return iterateReverse(s.inner, from, to, s.strip(fn))
+}
+
+func (s *bucketStore) Count(start, end []byte) (int, error) {
+	from, to := s.bounds(start, end)
+	return countKeys(s.inner, from, to)
+}
+
+func (s *bucketStore) DeleteRange(start, end []byte) (int, error) {
+	from, to := s.bounds(start, end)
+	defer s.usage.invalidate()
+	return deleteRange(s.inner, from, to)
+}
+
+func (s *bucketStore) Sync() error { return s.inner.Sync() }
+
+func (s *bucketStore) Apply(ops []operation) error {
+	if s.usage.limited() {
+		return s.usage.apply(s, ops)
+	}
+	return s.applyPrefixed(ops)
+}
+
+func (s *bucketStore) applyPrefixed(ops []operation) error {
+	prefixed := make([]operation, len(ops))
+	for i, op := range ops {
+		prefixed[i] = op
+		prefixed[i].key = s.key(op.key)
+	}
+	return s.inner.Apply(prefixed)
+}
+
+func (s *bucketStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if s.usage.limited() {
+		return s.usage.apply(s, []operation{{op: opSetTTL, key: key, value: value, ttl: ttl}})
+	}
+	return setWithTTL(s.inner, s.key(key), value, ttl)
+}
+
+func (s *bucketStore) KeyTTL(key []byte) (time.Duration, error) {
+	return keyTTL(s.inner, s.key(key))
+}
+
+func (s *bucketStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &bucketTxn{txn: txn, bucket: s}, nil
+}
+
+type bucketTxn struct {
+	txn    kvTxn
+	bucket *bucketStore
+}
+
+func (t *bucketTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(t.bucket.key(key)) }
+
+func (t *bucketTxn) Set(key, value []byte) error { return t.txn.Set(t.bucket.key(key), value) }
+
+func (t *bucketTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return txnSetWithTTL(t.txn, t.bucket.key(key), value, ttl)
+}
+
+func (t *bucketTxn) Delete(key []byte) error { return t.txn.Delete(t.bucket.key(key)) }
+
+// Commit bypasses the bucket's quota; the counts are taken afresh on the
+// next checked write.
+func (t *bucketTxn) Commit() error {
+	defer t.bucket.usage.invalidate()
+	return t.txn.Commit()
+}
+
+func (t *bucketTxn) Discard() { t.txn.Discard() }
+
+// openBucket returns the named bucket of store, recording it for
+// ListBuckets the first time and loading its quota otherwise.
+func openBucket(store kvStore, name string) (*bucketStore, error) {
+	if name == "" {
+		return nil, errors.New("bucket name must not be empty")
+	}
+	var meta bucketMeta
+	marker := bucketMarker(name)
+	doc, err := store.Get(marker)
+	switch {
+	case isNotFound(err):
+		if err := store.Set(marker, []byte{}); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case len(doc) > 0:
+		if err := json.Unmarshal(doc, &meta); err != nil {
+			return nil, fmt.Errorf("bucket %q: bad quota record: %w", name, err)
+		}
+	}
+	bucket := &bucketStore{inner: store, prefix: bucketPrefix(name)}
+	bucket.usage = bucketUsageFor(bucket, name)
+	bucket.usage.setLimits(meta)
+	return bucket, nil
+}
+
+func deleteBucket(store kvStore, name string) error {
+	if name == "" {
+		return errors.New("bucket name must not be empty")
+	}
+	prefix := bucketPrefix(name)
+	if _, err := deleteRange(store, prefix, nextPrefix(prefix)); err != nil {
+		return err
+	}
+	if err := store.Delete(bucketMarker(name)); err != nil {
+		return err
+	}
+	bucketUsageFor(&bucketStore{inner: store, prefix: prefix}, name).setLimits(bucketMeta{})
+	return nil
+}
+
+func listBuckets(store kvStore) ([]string, error) {
+	names := []string{}
+	err := store.Iterate(bucketMarkerPrefix, func(k, _ []byte) error {
+		names = append(names, string(k[len(bucketMarkerPrefix):]))
+		return nil
+	})
+	return names, err
+}
+
+// Bucket handles live in the store handle table like any other; this maps
+// each to the handle it was opened from, so closing that handle closes its
+// buckets first.
+var (
+	bucketMu      sync.Mutex
+	bucketParents = make(map[uintptr]uintptr)
+)
+
+func isBucket(id uintptr) bool {
+	bucketMu.Lock()
+	defer bucketMu.Unlock()
+	_, ok := bucketParents[id]
+	return ok
+}
+
+func forgetBucket(id uintptr) {
+	bucketMu.Lock()
+	defer bucketMu.Unlock()
+	delete(bucketParents, id)
+}
+
+// closeBucketsFor closes every bucket handle opened from parent, and their
+// own buckets and snapshots in turn.
+func closeBucketsFor(parent uintptr) {
+	bucketMu.Lock()
+	var open []uintptr
+	for id, p := range bucketParents {
+		if p == parent {
+			open = append(open, id)
+		}
+	}
+	bucketMu.Unlock()
+
+	for _, id := range open {
+		closeBucketsFor(id)
+		closeSnapshotsFor(id)
+		_ = closeHandle(id)
+	}
+}
+
+// OpenBucket returns a handle to the named bucket of handle: a separate
+// keyspace on the same store, created on first use. Every export accepts the
+// bucket handle; its keys are prefixed transparently and its scans see only
+// its own keys. Close it with Close, which leaves the parent open; closing
+// the parent closes its buckets. Buckets can be nested.
+//
+//export OpenBucket
+func OpenBucket(handle C.uintptr_t, name *C.char) (ret C.uintptr_t) {
+	defer recoverExport(uintptr(handle), &ret, 0)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	bucketName := C.GoString(name)
+	bucket, err := openBucket(store, bucketName)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+
+	id := storeHandle(bucket)
+	bucketMu.Lock()
+	bucketParents[id] = uintptr(handle)
+	bucketMu.Unlock()
+	info, _ := lookupHandleInfo(uintptr(handle))
+	info.Bucket = bucketName
+	info.BucketOf = uintptr(handle)
+	describeHandle(id, info)
+	setHandleError(uintptr(handle), nil)
+	return C.uintptr_t(id)
+}
+
+// DeleteBucket removes the named bucket and every key in it. Handles still
+// open on the bucket stay valid and see it empty.
+//
+//export DeleteBucket
+func DeleteBucket(handle C.uintptr_t, name *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), deleteBucket(store, C.GoString(name)))
+}
+
+// ListBuckets returns a JSON array of the bucket names in handle, sorted,
+// for the host to release with FreeCString.
+//
+//export ListBuckets
+func ListBuckets(handle C.uintptr_t) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	names, err := listBuckets(store)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	doc, err := json.Marshal(names)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.CString(string(doc))
+}
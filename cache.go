@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/ristretto"
+)
+
+// cacheStripes spreads the read/invalidate handshake over this many locks.
+const cacheStripes = 64
+
+// cacheConfig is the "cache" section of the open options.
+type cacheConfig struct {
+	// MaxBytes bounds the keys and values held, in bytes.
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	// MaxMissing bounds how many keys found missing are remembered, so
+	// repeated reads of them skip the backend.
+	MaxMissing int64 `json:"max_missing,omitempty"`
+	// MaxAge drops cached entries after this long, as a Go duration string.
+	// It bounds staleness for entries written by other processes; zero
+	// keeps entries until evicted.
+	MaxAge string `json:"max_age,omitempty"`
+}
+
+// cacheStripe orders a reader filling the cache against writers of the same
+// keys: a reader only caches what it read if no write invalidated the
+// stripe meanwhile.
+type cacheStripe struct {
+	mu    sync.Mutex
+	epoch uint64
+}
+
+// cacheStore keeps recently read values, and keys recently found missing,
+// in memory in front of inner. Either cache may be off. Every write through
+// the store invalidates the keys it touches; range deletes,
+// DropAll and restores clear the whole cache. Transactions read inner
+// directly and invalidate their keys on commit.
+type cacheStore struct {
+	inner   kvStore
+	cache   *ristretto.Cache
+	missing *ristretto.Cache
+	maxAge  time.Duration
+	seed    maphash.Seed
+	stripes [cacheStripes]cacheStripe
+}
+
+func newCacheStore(inner kvStore, cfg *cacheConfig) (*cacheStore, error) {
+	if cfg.MaxBytes < 0 || cfg.MaxMissing < 0 {
+		return nil, errors.New("cache max_bytes and max_missing must not be negative")
+	}
+	if cfg.MaxBytes == 0 && cfg.MaxMissing == 0 {
+		return nil, errors.New("cache needs max_bytes or max_missing")
+	}
+	var maxAge time.Duration
+	if cfg.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.MaxAge)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid cache max_age %q", cfg.MaxAge)
+		}
+		maxAge = d
+	}
+	s := &cacheStore{inner: inner, maxAge: maxAge, seed: maphash.MakeSeed()}
+	var err error
+	if cfg.MaxBytes > 0 {
+		// Assume values of about 100 bytes.
+		if s.cache, err = newRistretto(cfg.MaxBytes/100, cfg.MaxBytes); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.MaxMissing > 0 {
+		// Missing keys cost one each.
+		if s.missing, err = newRistretto(cfg.MaxMissing, cfg.MaxMissing); err != nil {
+			s.closeCaches()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// newRistretto sizes a cache expected to hold about entries items.
+func newRistretto(entries, maxCost int64) (*ristretto.Cache, error) {
+	// Ristretto wants about ten counters per entry it may hold.
+	counters := entries * 10
+	if counters < 1000 {
+		counters = 1000
+	}
+	return ristretto.NewCache(&ristretto.Config{
+		NumCounters:        counters,
+		MaxCost:            maxCost,
+		BufferItems:        64,
+		Metrics:            true,
+		IgnoreInternalCost: true,
+	})
+}
+
+// caches returns the caches in use.
+func (s *cacheStore) caches() []*ristretto.Cache {
+	var caches []*ristretto.Cache
+	for _, c := range []*ristretto.Cache{s.cache, s.missing} {
+		if c != nil {
+			caches = append(caches, c)
+		}
+	}
+	return caches
+}
+
+func (s *cacheStore) closeCaches() {
+	for _, c := range s.caches() {
+		c.Close()
+	}
+}
+
+func (s *cacheStore) stripe(key []byte) *cacheStripe {
+	return &s.stripes[maphash.Bytes(s.seed, key)%cacheStripes]
+}
+
+// invalidate drops keys from the cache. Call it after the write to inner,
+// whether or not the write succeeded.
+func (s *cacheStore) invalidate(keys ...[]byte) {
+	for _, key := range keys {
+		st := s.stripe(key)
+		st.mu.Lock()
+		st.epoch++
+		for _, c := range s.caches() {
+			c.Del(key)
+		}
+		st.mu.Unlock()
+	}
+}
+
+func (s *cacheStore) invalidateAll() {
+	for i := range s.stripes {
+		s.stripes[i].mu.Lock()
+		s.stripes[i].epoch++
+	}
+	for _, c := range s.caches() {
+		c.Clear()
+	}
+	for i := range s.stripes {
+		s.stripes[i].mu.Unlock()
+	}
+}
+
+// cached reports what the caches know about key: its value, or that it is
+// missing. ok is false when neither cache holds it.
+func (s *cacheStore) cached(key []byte) (value []byte, found, ok bool) {
+	if s.cache != nil {
+		if v, hit := s.cache.Get(key); hit {
+			return append([]byte(nil), v.([]byte)...), true, true
+		}
+	}
+	if s.missing != nil {
+		if _, hit := s.missing.Get(key); hit {
+			return nil, false, true
+		}
+	}
+	return nil, false, false
+}
+
+func (s *cacheStore) Get(key []byte) ([]byte, error) {
+	if value, found, ok := s.cached(key); ok {
+		if !found {
+			return nil, badger.ErrKeyNotFound
+		}
+		return value, nil
+	}
+	st := s.stripe(key)
+	st.mu.Lock()
+	epoch := st.epoch
+	st.mu.Unlock()
+
+	value, err := s.inner.Get(key)
+	missing := isNotFound(err)
+	if err != nil && !missing {
+		return nil, err
+	}
+	age := s.maxAge
+	if !missing && s.cache != nil {
+		// An entry must not outlive the key's own TTL, so it is cached for
+		// no longer than the key has left; if that cannot be read, not at all.
+		ttl, ttlErr := keyTTL(s.inner, key)
+		switch {
+		case ttlErr != nil:
+			return value, nil
+		case ttl > 0 && (age == 0 || ttl < age):
+			age = ttl
+		}
+	}
+	st.mu.Lock()
+	if st.epoch == epoch {
+		switch {
+		case missing && s.missing != nil:
+			s.missing.SetWithTTL(key, struct{}{}, 1, s.maxAge)
+		case !missing && s.cache != nil:
+			kept := append([]byte(nil), value...)
+			s.cache.SetWithTTL(key, kept, int64(len(key)+len(kept)), age)
+		}
+	}
+	st.mu.Unlock()
+	return value, err
+}
+
+func (s *cacheStore) Has(key []byte) (bool, error) {
+	if _, found, ok := s.cached(key); ok {
+		return found, nil
+	}
+	return hasKey(s.inner, key)
+}
+
+func (s *cacheStore) Set(key, value []byte) error {
+	err := s.inner.Set(key, value)
+	s.invalidate(key)
+	return err
+}
+
+func (s *cacheStore) Delete(key []byte) error {
+	err := s.inner.Delete(key)
+	s.invalidate(key)
+	return err
+}
+
+func (s *cacheStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	err := setWithTTL(s.inner, key, value, ttl)
+	s.invalidate(key)
+	return err
+}
+
+func (s *cacheStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+func (s *cacheStore) invalidateOps(ops []operation) {
+	for _, op := range ops {
+		s.invalidate(op.key)
+	}
+}
+
+func (s *cacheStore) Apply(ops []operation) error {
+	err := s.inner.Apply(ops)
+	s.invalidateOps(ops)
+	return err
+}
+
+func (s *cacheStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	seq, err := applyDurable(s.inner, ops, level)
+	s.invalidateOps(ops)
+	return seq, err
+}
+
+func (s *cacheStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+func (s *cacheStore) DeleteRange(start, end []byte) (int, error) {
+	n, err := deleteRange(s.inner, start, end)
+	s.invalidateAll()
+	return n, err
+}
+
+func (s *cacheStore) DropAll() error {
+	err := dropAll(s.inner)
+	s.invalidateAll()
+	return err
+}
+
+func (s *cacheStore) Load(r io.Reader) error {
+	err := restoreStore(s.inner, r)
+	s.invalidateAll()
+	return err
+}
+
+func (s *cacheStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, fn)
+}
+
+func (s *cacheStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, fn)
+}
+
+func (s *cacheStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, fn)
+}
+
+func (s *cacheStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *cacheStore) Sync() error { return s.inner.Sync() }
+
+func (s *cacheStore) Compact() error { return compactStore(s.inner) }
+
+func (s *cacheStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheTxn{txn: txn, store: s}, nil
+}
+
+// Snapshots read inner directly; cached values may be newer than them.
+func (s *cacheStore) Snapshot() (kvStore, error) { return openSnapshot(s.inner) }
+
+func (s *cacheStore) Stats() (storeStats, error) {
+	stats, err := collectStats(s.inner)
+	if err != nil {
+		return stats, err
+	}
+	if s.cache != nil {
+		stats.ValueCache = newCacheStats(s.cache.Metrics)
+	}
+	if s.missing != nil {
+		stats.MissingCache = newCacheStats(s.missing.Metrics)
+	}
+	return stats, nil
+}
+
+func (s *cacheStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+func (s *cacheStore) unwrap() kvStore { return s.inner }
+
+func (s *cacheStore) Close() error {
+	err := s.inner.Close()
+	s.closeCaches()
+	return err
+}
+
+// cacheTxn remembers the keys a transaction writes so their cached values
+// can be dropped once it commits.
+type cacheTxn struct {
+	txn     kvTxn
+	store   *cacheStore
+	written [][]byte
+}
+
+func (t *cacheTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(key) }
+
+func (t *cacheTxn) Set(key, value []byte) error {
+	t.written = append(t.written, append([]byte(nil), key...))
+	return t.txn.Set(key, value)
+}
+
+func (t *cacheTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	t.written = append(t.written, append([]byte(nil), key...))
+	return txnSetWithTTL(t.txn, key, value, ttl)
+}
+
+func (t *cacheTxn) Delete(key []byte) error {
+	t.written = append(t.written, append([]byte(nil), key...))
+	return t.txn.Delete(key)
+}
+
+func (t *cacheTxn) Commit() error {
+	err := t.txn.Commit()
+	t.store.invalidate(t.written...)
+	return err
+}
+
+func (t *cacheTxn) Discard() { t.txn.Discard() }
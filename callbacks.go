@@ -0,0 +1,366 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+typedef void (*skyshelve_write_cb)(void *user_data, const char *key, int key_len, int op, const char *value, int value_len);
+
+static inline void skyshelve_call_write_cb(skyshelve_write_cb cb, void *user_data, const char *key, int key_len, int op, const char *value, int value_len) {
+	cb(user_data, key, key_len, op, value, value_len);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// writeCallback is a host function registered with RegisterWriteCallback.
+type writeCallback struct {
+	fn       C.skyshelve_write_cb
+	userData unsafe.Pointer
+}
+
+var (
+	callbackMu     sync.RWMutex
+	callbacks            = make(map[uintptr]map[int64]writeCallback)
+	nextCallbackID int64 = 1
+)
+
+func hasWriteCallbacks(id uintptr) bool {
+	callbackMu.RLock()
+	defer callbackMu.RUnlock()
+	return len(callbacks[id]) > 0
+}
+
+// notifyWriteCallbacks runs the host callbacks registered on a store handle
+// for each applied write, on the calling thread. TTL writes are reported as
+// opSet; preconditions are skipped.
+func notifyWriteCallbacks(id uintptr, ops []operation) {
+	callbackMu.RLock()
+	registered := make([]writeCallback, 0, len(callbacks[id]))
+	for _, cb := range callbacks[id] {
+		registered = append(registered, cb)
+	}
+	callbackMu.RUnlock()
+
+	for _, cb := range registered {
+		for _, op := range ops {
+			var code byte
+			switch op.op {
+			case opSet, opSetTTL:
+				code = opSet
+			case opDelete:
+				code = opDelete
+			default:
+				continue
+			}
+			C.skyshelve_call_write_cb(cb.fn, cb.userData,
+				bytesPtr(op.key), C.int(len(op.key)), C.int(code),
+				bytesPtr(op.value), C.int(len(op.value)))
+		}
+	}
+}
+
+// bytesPtr returns a pointer to b's data for the duration of a C call, or
+// NULL when b is empty.
+func bytesPtr(b []byte) *C.char {
+	if len(b) == 0 {
+		return nil
+	}
+	return (*C.char)(unsafe.Pointer(&b[0]))
+}
+
+func forgetWriteCallbacks(id uintptr) {
+	callbackMu.Lock()
+	defer callbackMu.Unlock()
+	delete(callbacks, id)
+}
+
+// notifyStore is the outermost layer of every handle's store. It reports
+// each write made through it to the callbacks registered on the handle once
+// the write has succeeded, so every export, server and data structure that
+// writes through the handle is covered without a call of its own.
+type notifyStore struct {
+	inner kvStore
+	id    uintptr
+}
+
+func (s *notifyStore) notify(ops ...operation) { notifyWriteCallbacks(s.id, ops) }
+
+func (s *notifyStore) unwrap() kvStore { return s.inner }
+
+func (s *notifyStore) Close() error { return s.inner.Close() }
+
+func (s *notifyStore) Set(key, value []byte) error {
+	if err := s.inner.Set(key, value); err != nil {
+		return err
+	}
+	s.notify(operation{op: opSet, key: key, value: value})
+	return nil
+}
+
+func (s *notifyStore) Get(key []byte) ([]byte, error) { return s.inner.Get(key) }
+
+func (s *notifyStore) Has(key []byte) (bool, error) { return hasKey(s.inner, key) }
+
+func (s *notifyStore) GetMany(keys [][]byte) ([]lookup, error) { return getMany(s.inner, keys) }
+
+func (s *notifyStore) Delete(key []byte) error {
+	if err := s.inner.Delete(key); err != nil {
+		return err
+	}
+	s.notify(operation{op: opDelete, key: key})
+	return nil
+}
+
+func (s *notifyStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, fn)
+}
+
+func (s *notifyStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, fn)
+}
+
+func (s *notifyStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, fn)
+}
+
+func (s *notifyStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *notifyStore) Sync() error { return s.inner.Sync() }
+
+func (s *notifyStore) Apply(ops []operation) error {
+	if err := s.inner.Apply(ops); err != nil {
+		return err
+	}
+	s.notify(ops...)
+	return nil
+}
+
+func (s *notifyStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := setWithTTL(s.inner, key, value, ttl); err != nil {
+		return err
+	}
+	s.notify(operation{op: opSetTTL, key: key, value: value, ttl: ttl})
+	return nil
+}
+
+func (s *notifyStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+func (s *notifyStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	seq, err := applyDurable(s.inner, ops, level)
+	if err != nil {
+		return 0, err
+	}
+	s.notify(ops...)
+	return seq, nil
+}
+
+func (s *notifyStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+func (s *notifyStore) SetWithMeta(key, value []byte, meta byte) error {
+	if err := setWithMeta(s.inner, key, value, meta); err != nil {
+		return err
+	}
+	s.notify(operation{op: opSet, key: key, value: value})
+	return nil
+}
+
+func (s *notifyStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	return getWithMeta(s.inner, key)
+}
+
+// DeleteRange keeps the backend's fast path until a callback is registered.
+// From then on it lists the keys it deletes, in batches, to report them.
+func (s *notifyStore) DeleteRange(start, end []byte) (int, error) {
+	if !hasWriteCallbacks(s.id) {
+		return deleteRange(s.inner, start, end)
+	}
+	return deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		err := s.inner.IterateRange(from, end, func(k, _ []byte) error {
+			if len(keys) >= deleteBatchSize {
+				return errStopIteration
+			}
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		return keys, nil
+	}, func(keys [][]byte) error {
+		ops := make([]operation, len(keys))
+		for i, k := range keys {
+			ops[i] = operation{op: opDelete, key: k}
+		}
+		return s.Apply(ops)
+	})
+}
+
+// DropAll reports a delete for each key the store held when it started,
+// which it only lists while a callback is registered.
+func (s *notifyStore) DropAll() error {
+	var keys [][]byte
+	if hasWriteCallbacks(s.id) {
+		err := s.inner.IterateRange(nil, nil, func(k, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := dropAll(s.inner); err != nil {
+		return err
+	}
+	ops := make([]operation, len(keys))
+	for i, k := range keys {
+		ops[i] = operation{op: opDelete, key: k}
+	}
+	s.notify(ops...)
+	return nil
+}
+
+func (s *notifyStore) CurrentVersion() (uint64, error) {
+	return versionsBelow{s.inner}.CurrentVersion()
+}
+
+func (s *notifyStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	return versionsBelow{s.inner}.GetAt(key, version)
+}
+
+func (s *notifyStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return versionsBelow{s.inner}.IterateAt(prefix, version, fn)
+}
+
+func (s *notifyStore) Versions(key []byte) ([]keyVersion, error) {
+	return versionsBelow{s.inner}.Versions(key)
+}
+
+func (s *notifyStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &notifyTxn{txn: txn, store: s}, nil
+}
+
+func (s *notifyStore) Sequence(key []byte, bandwidth uint64) (sequence, error) {
+	return openSequence(s.inner, key, bandwidth)
+}
+
+func (s *notifyStore) Compact() error { return compactStore(s.inner) }
+
+func (s *notifyStore) Snapshot() (kvStore, error) { return openSnapshot(s.inner) }
+
+func (s *notifyStore) Stats() (storeStats, error) { return collectStats(s.inner) }
+
+func (s *notifyStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+// Load is only reached for a backend's native backups, and for dumps on a
+// store with codecs, which are restored without reporting. restoreStore
+// applies other skyshelve dumps through Apply, so their entries are
+// reported.
+func (s *notifyStore) Load(r io.Reader) error { return restoreStore(s.inner, r) }
+
+// notifyTxn reports a transaction's writes once it commits.
+type notifyTxn struct {
+	txn   kvTxn
+	store *notifyStore
+	ops   []operation
+}
+
+func (t *notifyTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(key) }
+
+func (t *notifyTxn) Set(key, value []byte) error {
+	if err := t.txn.Set(key, value); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opSet, key: append([]byte(nil), key...), value: append([]byte(nil), value...)})
+	return nil
+}
+
+func (t *notifyTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := txnSetWithTTL(t.txn, key, value, ttl); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opSetTTL, key: append([]byte(nil), key...), value: append([]byte(nil), value...), ttl: ttl})
+	return nil
+}
+
+func (t *notifyTxn) Delete(key []byte) error {
+	if err := t.txn.Delete(key); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opDelete, key: append([]byte(nil), key...)})
+	return nil
+}
+
+func (t *notifyTxn) Commit() error {
+	if err := t.txn.Commit(); err != nil {
+		return err
+	}
+	t.store.notify(t.ops...)
+	return nil
+}
+
+func (t *notifyTxn) Discard() { t.txn.Discard() }
+
+// RegisterWriteCallback arranges for fn(userData, key, keyLen, op, value,
+// valueLen) to be called after every successful write through handle,
+// whichever export, server or data structure makes it, with op using the
+// Apply operation codes (value is NULL for deletes). Data structure writes
+// are reported under the reserved keys they are stored at, and a bucket's
+// writes under its prefix on the parent as well as on the bucket handle. The
+// pointers are only valid during the call. Callbacks run synchronously on the
+// writing thread, so they should be quick and must not call back into the
+// store handle that invoked them. Returns a callback id for
+// UnregisterWriteCallback, or a negative status code on error.
+//
+//export RegisterWriteCallback
+func RegisterWriteCallback(handle C.uintptr_t, fn C.skyshelve_write_cb, userData unsafe.Pointer) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	if _, err := getHandle(uintptr(handle)); err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if fn == nil {
+		return C.int64_t(setHandleError(uintptr(handle), errors.New("callback is NULL")))
+	}
+
+	callbackMu.Lock()
+	id := nextCallbackID
+	nextCallbackID++
+	if callbacks[uintptr(handle)] == nil {
+		callbacks[uintptr(handle)] = make(map[int64]writeCallback)
+	}
+	callbacks[uintptr(handle)][id] = writeCallback{fn: fn, userData: userData}
+	callbackMu.Unlock()
+
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(id)
+}
+
+//export UnregisterWriteCallback
+func UnregisterWriteCallback(handle C.uintptr_t, callbackID C.int64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	callbackMu.Lock()
+	registered := callbacks[uintptr(handle)]
+	_, ok := registered[int64(callbackID)]
+	delete(registered, int64(callbackID))
+	callbackMu.Unlock()
+	if !ok {
+		return setError(unknownHandleError("callback"))
+	}
+	return setHandleError(uintptr(handle), nil)
+}
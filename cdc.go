@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCDCBatch    = 500
+	defaultCDCInterval = time.Second
+	defaultCDCRetries  = 5
+	// cdcRetryDelay is the first backoff after a failed delivery; it doubles
+	// up to the sink's interval.
+	cdcRetryDelay = 100 * time.Millisecond
+)
+
+// cdcCursorPrefix holds each sink's last delivered sequence number, so a
+// reopened store resumes where it left off. Cursors are written around the
+// change log.
+var cdcCursorPrefix = []byte("\xffcdc/")
+
+// cdcConfig is the "cdc" section of the open options. It turns on the change
+// log and ships every logged write to any of a webhook, an NDJSON file, a
+// Kafka topic and a NATS subject.
+type cdcConfig struct {
+	// Webhook receives each batch as an NDJSON POST. Headers are added to
+	// every request, for example to authenticate.
+	Webhook string            `json:"webhook,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// File has each batch appended to it as NDJSON and fsynced.
+	File string `json:"file,omitempty"`
+	// Kafka and NATS publish each change as its own message; see broker.go.
+	Kafka *kafkaConfig `json:"kafka,omitempty"`
+	NATS  *natsConfig  `json:"nats,omitempty"`
+	// BatchSize caps the changes sent at once.
+	BatchSize int `json:"batch_size,omitempty"`
+	// Interval, as a Go duration string, is how often an idle sink polls the
+	// log and how long it waits after giving up on a batch.
+	Interval string `json:"interval,omitempty"`
+	// MaxRetries is how many times a failed batch is retried, with backoff,
+	// before the sink waits out an interval.
+	MaxRetries int `json:"max_retries,omitempty"`
+}
+
+type cdcSettings struct {
+	batch    int
+	interval time.Duration
+	retries  int
+}
+
+func (c *cdcConfig) settings() (cdcSettings, error) {
+	set := cdcSettings{batch: c.BatchSize, interval: defaultCDCInterval, retries: c.MaxRetries}
+	if c.Webhook == "" && c.File == "" && c.Kafka == nil && c.NATS == nil {
+		return set, errors.New("cdc needs a webhook, file, kafka or nats sink")
+	}
+	if set.batch == 0 {
+		set.batch = defaultCDCBatch
+	}
+	if set.batch < 1 {
+		return set, fmt.Errorf("cdc batch_size must be positive, got %d", set.batch)
+	}
+	if set.retries == 0 {
+		set.retries = defaultCDCRetries
+	}
+	if set.retries < 0 {
+		return set, fmt.Errorf("cdc max_retries must not be negative, got %d", set.retries)
+	}
+	if c.Interval != "" {
+		var err error
+		if set.interval, err = time.ParseDuration(c.Interval); err != nil {
+			return set, fmt.Errorf("invalid cdc interval: %w", err)
+		}
+		if set.interval <= 0 {
+			return set, fmt.Errorf("cdc interval must be positive, got %s", c.Interval)
+		}
+	}
+	return set, nil
+}
+
+// cdcEvent is one delivered change. Keys and values are base64 in JSON, and
+// Time is the commit time in Unix milliseconds.
+type cdcEvent struct {
+	Seq   uint64 `json:"seq"`
+	Time  int64  `json:"ts"`
+	Op    string `json:"op"`
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	TTL   int64  `json:"ttl,omitempty"`
+}
+
+func newCDCEvent(seq uint64, at time.Time, op operation) cdcEvent {
+	ev := cdcEvent{Seq: seq, Time: at.UnixMilli(), Op: "set", Key: op.key, Value: op.value}
+	switch op.op {
+	case opDelete:
+		ev.Op, ev.Value = "delete", nil
+	case opSetTTL:
+		ev.TTL = int64(op.ttl / time.Second)
+	}
+	return ev
+}
+
+// cdcSink delivers batches of changes. A batch is delivered at least once:
+// one that failed part-way is sent again in full.
+type cdcSink interface {
+	name() string
+	deliver(events []cdcEvent) error
+	close() error
+}
+
+// encodeNDJSON renders events one JSON object per line.
+func encodeNDJSON(events []cdcEvent) ([]byte, error) {
+	var body []byte
+	for _, ev := range events {
+		line, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		body = append(append(body, line...), '\n')
+	}
+	return body, nil
+}
+
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhookSink(raw string, headers map[string]string) (*webhookSink, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid cdc webhook %q", displayPath(raw))
+	}
+	return &webhookSink{url: raw, headers: headers, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (w *webhookSink) name() string { return "webhook" }
+
+func (w *webhookSink) deliver(events []cdcEvent) error {
+	body, err := encodeNDJSON(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *webhookSink) close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+type fileSink struct {
+	f *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+func (f *fileSink) name() string { return "file" }
+
+func (f *fileSink) deliver(events []cdcEvent) error {
+	body, err := encodeNDJSON(events)
+	if err != nil {
+		return err
+	}
+	if _, err := f.f.Write(body); err != nil {
+		return err
+	}
+	return f.f.Sync()
+}
+
+func (f *fileSink) close() error { return f.f.Close() }
+
+// cdcRunner tails the change log for one sink.
+type cdcRunner struct {
+	log  *changeLogStore
+	sink cdcSink
+	set  cdcSettings
+	// replica runners keep their cursor in memory and fail on trimmed
+	// changes rather than skip them, which would leave the replica out of
+	// sync; see replicate.go.
+	replica bool
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+
+	// mu guards cursor and err for readers outside the runner goroutine,
+	// which is the only writer.
+	mu     sync.Mutex
+	cursor uint64
+	err    error
+}
+
+func newCDCRunner(log *changeLogStore, sink cdcSink, set cdcSettings) *cdcRunner {
+	return &cdcRunner{
+		log:  log,
+		sink: sink,
+		set:  set,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (r *cdcRunner) cursorKey() []byte {
+	return append(append([]byte(nil), cdcCursorPrefix...), r.sink.name()...)
+}
+
+func (r *cdcRunner) loadCursor() error {
+	raw, err := r.log.inner.Get(r.cursorKey())
+	switch {
+	case isNotFound(err):
+		return nil
+	case err != nil:
+		return err
+	case len(raw) != 8:
+		return fmt.Errorf("cdc %s cursor: %w", r.sink.name(), errCorrupt)
+	}
+	r.cursor = binary.BigEndian.Uint64(raw)
+	return nil
+}
+
+func (r *cdcRunner) saveCursor(seq uint64) error {
+	if !r.replica {
+		if err := r.log.inner.Set(r.cursorKey(), binary.BigEndian.AppendUint64(nil, seq)); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cursor = seq
+	return nil
+}
+
+// status returns the last delivered sequence number and the error that
+// stopped the latest drain, if any.
+func (r *cdcRunner) status() (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cursor, r.err
+}
+
+func (r *cdcRunner) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// notify wakes the runner without blocking the writer.
+func (r *cdcRunner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *cdcRunner) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.set.interval)
+	defer ticker.Stop()
+	for {
+		r.drain(r.set.retries)
+		select {
+		case <-r.stop:
+			// One last attempt, so a clean close usually leaves nothing behind.
+			r.drain(0)
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain delivers batches until the sink has caught up or one fails.
+func (r *cdcRunner) drain(retries int) {
+	for {
+		events, last, err := r.collect()
+		if errors.Is(err, errChangesTrimmed) && !r.replica {
+			err = r.skipTrimmed()
+			if err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("reading changes after %d: %w", r.cursor, err)
+		} else if len(events) == 0 {
+			r.setErr(nil)
+			return
+		} else if err = r.deliver(events, retries); err != nil {
+			err = fmt.Errorf("delivering changes %d-%d: %w", r.cursor+1, last, err)
+		} else if err = r.saveCursor(last); err != nil {
+			err = fmt.Errorf("saving cursor %d: %w", last, err)
+		}
+		if err != nil {
+			logf(logError, "cdc", "%s: %v", r.sink.name(), err)
+			r.setErr(err)
+			return
+		}
+	}
+}
+
+// collect reads the next batch after the cursor.
+func (r *cdcRunner) collect() ([]cdcEvent, uint64, error) {
+	var (
+		events []cdcEvent
+		last   uint64
+	)
+	err := r.log.scanChanges(r.cursor, r.set.batch, func(seq uint64, record []byte) error {
+		at, op, err := parseChange(record)
+		if err != nil {
+			return fmt.Errorf("change %d: %w", seq, err)
+		}
+		events = append(events, newCDCEvent(seq, at, op))
+		last = seq
+		return nil
+	})
+	return events, last, err
+}
+
+func (r *cdcRunner) deliver(events []cdcEvent, retries int) error {
+	delay := cdcRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := r.sink.deliver(events)
+		if err == nil || attempt >= retries {
+			return err
+		}
+		select {
+		case <-r.stop:
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, r.set.interval)
+	}
+}
+
+// skipTrimmed moves the cursor past changes that were trimmed or dropped
+// before the sink saw them.
+func (r *cdcRunner) skipTrimmed() error {
+	next := r.cursor
+	err := r.log.inner.IterateRange(changeKey(r.cursor+1), nextPrefix(changeLogPrefix), func(k, v []byte) error {
+		next = binary.BigEndian.Uint64(k[len(changeLogPrefix):])
+		if len(v) > 0 {
+			next--
+		}
+		return errStopIteration
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return err
+	}
+	if next == r.cursor {
+		next = r.log.lastSeq()
+	}
+	logf(logWarn, "cdc", "%s: changes %d-%d were trimmed before delivery", r.sink.name(), r.cursor+1, next)
+	return r.saveCursor(next)
+}
+
+// startCDC opens the sinks in cfg and starts tailing the log into them.
+func (s *changeLogStore) startCDC(cfg *cdcConfig) error {
+	set, err := cfg.settings()
+	if err != nil {
+		return err
+	}
+	var sinks []cdcSink
+	if cfg.Webhook != "" {
+		sink, err := newWebhookSink(cfg.Webhook, cfg.Headers)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.File != "" {
+		sink, err := newFileSink(cfg.File)
+		if err != nil {
+			closeSinks(sinks)
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.Kafka != nil {
+		sink, err := newKafkaSink(cfg.Kafka)
+		if err != nil {
+			closeSinks(sinks)
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.NATS != nil {
+		sink, err := newNATSSink(cfg.NATS)
+		if err != nil {
+			closeSinks(sinks)
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	runners := make([]*cdcRunner, 0, len(sinks))
+	for _, sink := range sinks {
+		r := newCDCRunner(s, sink, set)
+		if err := r.loadCursor(); err != nil {
+			closeSinks(sinks)
+			return err
+		}
+		runners = append(runners, r)
+	}
+	for _, r := range runners {
+		s.addSink(r)
+	}
+	return nil
+}
+
+func closeSinks(sinks []cdcSink) {
+	for _, sink := range sinks {
+		sink.close()
+	}
+}
+
+// addSink starts r and has commits wake it.
+func (s *changeLogStore) addSink(r *cdcRunner) {
+	s.mu.Lock()
+	s.sinks = append(s.sinks, r)
+	s.mu.Unlock()
+	go r.run()
+}
+
+// stopSink makes a last delivery attempt on r, detaches it and closes its
+// sink.
+func (s *changeLogStore) stopSink(r *cdcRunner) error {
+	close(r.stop)
+	<-r.done
+	s.mu.Lock()
+	for i, other := range s.sinks {
+		if other == r {
+			s.sinks = append(s.sinks[:i:i], s.sinks[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	return r.sink.close()
+}
+
+// stopCDC stops every sink still attached.
+func (s *changeLogStore) stopCDC() error {
+	s.mu.Lock()
+	sinks := append([]*cdcRunner(nil), s.sinks...)
+	s.mu.Unlock()
+	var errs []error
+	for _, r := range sinks {
+		errs = append(errs, s.stopSink(r))
+	}
+	return errors.Join(errs...)
+}
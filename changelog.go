@@ -0,0 +1,566 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// changeLogPrefix holds one record per logged write, keyed by its big-endian
+// sequence number so the log scans in commit order. A record is the change
+// as ChangesSince returns it, without the sequence number. An empty record
+// marks a DropAll, which readers behind it cannot replay.
+var changeLogPrefix = []byte("\xffchg/")
+
+var (
+	errNoChangeLog    = errors.New("the store was not opened with change_log")
+	errChangesTrimmed = errors.New("changes after that sequence have been trimmed")
+)
+
+func changeKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte(nil), changeLogPrefix...), seq)
+}
+
+// appendChange frames a write as a u64 commit time in Unix milliseconds
+// followed by a watch event, with a trailing u64 time-to-live in seconds for
+// TTL writes.
+func appendChange(buf []byte, at time.Time, op operation) []byte {
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(at.UnixMilli()))
+	buf = appendEvent(buf, watchEvent{op: op.op, key: op.key, value: op.value})
+	if op.op == opSetTTL {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(op.ttl/time.Second))
+	}
+	return buf
+}
+
+// parseChange decodes a log record written by appendChange.
+func parseChange(record []byte) (time.Time, operation, error) {
+	malformed := errors.New("malformed change record")
+	if len(record) < 17 {
+		return time.Time{}, operation{}, malformed
+	}
+	at := time.UnixMilli(int64(binary.LittleEndian.Uint64(record)))
+	op := operation{op: record[8]}
+	keyLen := int(binary.LittleEndian.Uint32(record[9:]))
+	valLen := int(binary.LittleEndian.Uint32(record[13:]))
+	rest := record[17:]
+	if len(rest) < keyLen+valLen {
+		return time.Time{}, operation{}, malformed
+	}
+	op.key, op.value = rest[:keyLen], rest[keyLen:keyLen+valLen]
+	if op.op == opSetTTL {
+		if len(rest) < keyLen+valLen+8 {
+			return time.Time{}, operation{}, malformed
+		}
+		op.ttl = time.Duration(binary.LittleEndian.Uint64(rest[keyLen+valLen:])) * time.Second
+	}
+	return at, op, nil
+}
+
+// changeLogStore numbers every write to inner and records it in the same
+// batch, so the log never disagrees with the data. Writes are serialised so
+// sequence order is commit order.
+type changeLogStore struct {
+	inner kvStore
+	mu    sync.Mutex
+	seq   uint64
+	// sinks ship the log to CDC consumers; see cdc.go.
+	sinks []*cdcRunner
+	// holds counts the sequence numbers trim must keep the changes after,
+	// for replicas still making their initial copy.
+	holds map[uint64]int
+}
+
+// newChangeLogStore layers a change log over store, carrying on from the
+// last sequence number already logged in it.
+func newChangeLogStore(store kvStore) (*changeLogStore, error) {
+	s := &changeLogStore{inner: store}
+	err := iterateReverse(store, changeLogPrefix, nextPrefix(changeLogPrefix), func(k, _ []byte) error {
+		s.seq = binary.BigEndian.Uint64(k[len(changeLogPrefix):])
+		return errStopIteration
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// logged appends a log record for each of ops, numbered from s.seq+1. The
+// caller holds s.mu.
+func (s *changeLogStore) logged(ops []operation) []operation {
+	batch := append(make([]operation, 0, 2*len(ops)), ops...)
+	now := time.Now()
+	for i, op := range ops {
+		batch = append(batch, operation{op: opSet, key: changeKey(s.seq + uint64(i) + 1), value: appendChange(nil, now, op)})
+	}
+	return batch
+}
+
+// applySeq commits ops and returns the sequence number of the last one.
+func (s *changeLogStore) applySeq(ops []operation) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.inner.Apply(s.logged(ops)); err != nil {
+		return 0, err
+	}
+	s.committed(len(ops))
+	return s.seq, nil
+}
+
+// committed advances the sequence past n newly logged writes and wakes the
+// CDC sinks. The caller holds s.mu.
+func (s *changeLogStore) committed(n int) {
+	s.seq += uint64(n)
+	for _, r := range s.sinks {
+		r.notify()
+	}
+}
+
+func (s *changeLogStore) lastSeq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// hold returns the current sequence number and keeps trim from dropping
+// the changes after it until release is called with it.
+func (s *changeLogStore) hold() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holds == nil {
+		s.holds = make(map[uint64]int)
+	}
+	s.holds[s.seq]++
+	return s.seq
+}
+
+func (s *changeLogStore) release(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holds[seq]--; s.holds[seq] <= 0 {
+		delete(s.holds, seq)
+	}
+}
+
+func (s *changeLogStore) unwrap() kvStore { return s.inner }
+
+func (s *changeLogStore) Close() error {
+	return errors.Join(s.stopCDC(), s.inner.Close())
+}
+
+func (s *changeLogStore) Set(key, value []byte) error {
+	_, err := s.applySeq([]operation{{op: opSet, key: key, value: value}})
+	return err
+}
+
+func (s *changeLogStore) Get(key []byte) ([]byte, error) { return s.inner.Get(key) }
+
+func (s *changeLogStore) Has(key []byte) (bool, error) { return hasKey(s.inner, key) }
+
+func (s *changeLogStore) Delete(key []byte) error {
+	_, err := s.applySeq([]operation{{op: opDelete, key: key}})
+	return err
+}
+
+func (s *changeLogStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, fn)
+}
+
+func (s *changeLogStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, fn)
+}
+
+func (s *changeLogStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, fn)
+}
+
+func (s *changeLogStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *changeLogStore) Sync() error { return s.inner.Sync() }
+
+func (s *changeLogStore) Apply(ops []operation) error {
+	_, err := s.applySeq(ops)
+	return err
+}
+
+func (s *changeLogStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	_, err := s.applySeq([]operation{{op: opSetTTL, key: key, value: value, ttl: ttl}})
+	return err
+}
+
+func (s *changeLogStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+func (s *changeLogStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq, err := applyDurable(s.inner, s.logged(ops), level)
+	if err != nil {
+		return 0, err
+	}
+	s.committed(len(ops))
+	return seq, nil
+}
+
+func (s *changeLogStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+// SetWithMeta cannot carry the meta byte in an Apply batch, so the log
+// record follows the value in a second write.
+func (s *changeLogStore) SetWithMeta(key, value []byte, meta byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := s.logged([]operation{{op: opSet, key: key, value: value}})
+	if err := setWithMeta(s.inner, key, value, meta); err != nil {
+		return err
+	}
+	if err := s.inner.Apply(batch[1:]); err != nil {
+		return err
+	}
+	s.committed(1)
+	return nil
+}
+
+func (s *changeLogStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	return getWithMeta(s.inner, key)
+}
+
+// DeleteRange logs each deleted key in the batch that deletes it. The log
+// itself is skipped, so a range covering it leaves the records of the
+// deletes behind.
+func (s *changeLogStore) DeleteRange(start, end []byte) (int, error) {
+	return deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		err := s.inner.IterateRange(from, end, func(k, _ []byte) error {
+			if len(keys) >= deleteBatchSize {
+				return errStopIteration
+			}
+			if !bytes.HasPrefix(k, changeLogPrefix) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		return keys, nil
+	}, func(keys [][]byte) error {
+		ops := make([]operation, len(keys))
+		for i, k := range keys {
+			ops[i] = operation{op: opDelete, key: k}
+		}
+		_, err := s.applySeq(ops)
+		return err
+	})
+}
+
+func (s *changeLogStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &changeLogTxn{txn: txn, store: s}, nil
+}
+
+// DropAll clears the store, log included, and leaves a marker at the next
+// sequence number so readers find out they must resync.
+func (s *changeLogStore) DropAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := dropAll(s.inner); err != nil {
+		return err
+	}
+	if err := s.inner.Set(changeKey(s.seq+1), []byte{}); err != nil {
+		return err
+	}
+	s.committed(1)
+	return nil
+}
+
+func (s *changeLogStore) Compact() error { return compactStore(s.inner) }
+
+func (s *changeLogStore) Snapshot() (kvStore, error) { return openSnapshot(s.inner) }
+
+func (s *changeLogStore) Stats() (storeStats, error) { return collectStats(s.inner) }
+
+// A dump includes the log. Restoring one writes around the log, so the
+// restored keys do not show up in ChangesSince.
+func (s *changeLogStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+func (s *changeLogStore) Load(r io.Reader) error { return restoreStore(s.inner, r) }
+
+// scanChanges calls fn with up to max log records after since, in order. It
+// fails with errChangesTrimmed if records after since are gone.
+func (s *changeLogStore) scanChanges(since uint64, max int, fn func(seq uint64, record []byte) error) error {
+	first := true
+	n := 0
+	err := s.inner.IterateRange(changeKey(since+1), nextPrefix(changeLogPrefix), func(k, v []byte) error {
+		seq := binary.BigEndian.Uint64(k[len(changeLogPrefix):])
+		if (first && seq > since+1) || len(v) == 0 {
+			return fmt.Errorf("sequence %d: %w", since, errChangesTrimmed)
+		}
+		first = false
+		if err := fn(seq, v); err != nil {
+			return err
+		}
+		if n++; n >= max {
+			return errStopIteration
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return err
+	}
+	if first && since < s.lastSeq() {
+		return fmt.Errorf("sequence %d: %w", since, errChangesTrimmed)
+	}
+	return nil
+}
+
+// changes appends up to max changes after since to buf, each framed as a u64
+// little-endian sequence number followed by the record.
+func (s *changeLogStore) changes(buf []byte, since uint64, max int) ([]byte, error) {
+	err := s.scanChanges(since, max, func(seq uint64, record []byte) error {
+		buf = binary.LittleEndian.AppendUint64(buf, seq)
+		buf = append(buf, record...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// trim drops the log records up to and including seq, always keeping the
+// newest so numbering carries on after a reopen, and anything a replica has
+// yet to apply or a hold protects.
+func (s *changeLogStore) trim(seq uint64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq >= s.seq {
+		seq = s.seq - min(s.seq, 1)
+	}
+	for _, r := range s.sinks {
+		if applied, _ := r.status(); r.replica && applied < seq {
+			seq = applied
+		}
+	}
+	for held := range s.holds {
+		seq = min(seq, held)
+	}
+	return deleteRange(s.inner, changeLogPrefix, changeKey(seq+1))
+}
+
+// changeLogTxn logs a transaction's writes when it commits.
+type changeLogTxn struct {
+	txn   kvTxn
+	store *changeLogStore
+	ops   []operation
+}
+
+func (t *changeLogTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(key) }
+
+func (t *changeLogTxn) Set(key, value []byte) error {
+	if err := t.txn.Set(key, value); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opSet, key: append([]byte(nil), key...), value: append([]byte(nil), value...)})
+	return nil
+}
+
+func (t *changeLogTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := txnSetWithTTL(t.txn, key, value, ttl); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opSetTTL, key: append([]byte(nil), key...), value: append([]byte(nil), value...), ttl: ttl})
+	return nil
+}
+
+func (t *changeLogTxn) Delete(key []byte) error {
+	if err := t.txn.Delete(key); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opDelete, key: append([]byte(nil), key...)})
+	return nil
+}
+
+func (t *changeLogTxn) Commit() error {
+	s := t.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range s.logged(t.ops)[len(t.ops):] {
+		if err := t.txn.Set(op.key, op.value); err != nil {
+			return err
+		}
+	}
+	if err := t.txn.Commit(); err != nil {
+		return err
+	}
+	s.committed(len(t.ops))
+	return nil
+}
+
+func (t *changeLogTxn) Discard() { t.txn.Discard() }
+
+func changeLogFor(handle C.uintptr_t) (*changeLogStore, error) {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return nil, err
+	}
+	log, ok := layerOf[*changeLogStore](store)
+	if !ok {
+		return nil, errNoChangeLog
+	}
+	return log, nil
+}
+
+func writeSeq(handle C.uintptr_t, ops []operation) C.int64_t {
+	log, err := changeLogFor(handle)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if err := userOps(ops); err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if err := admitWrites(uintptr(handle), ops); err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	seq, err := log.applySeq(ops)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	// applySeq goes around the handle's notifyStore, so the writes are
+	// reported here.
+	notifyWriteCallbacks(uintptr(handle), ops)
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(seq)
+}
+
+// SetSeq is Set on a store opened with change_log, returning the write's
+// sequence number instead of 0, or a negative status code.
+//
+//export SetSeq
+func SetSeq(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	op := operation{
+		op:    opSet,
+		key:   C.GoBytes(unsafe.Pointer(key), keyLen),
+		value: C.GoBytes(unsafe.Pointer(value), valueLen),
+	}
+	return writeSeq(handle, []operation{op})
+}
+
+// DeleteSeq is Delete with a sequence number; see SetSeq.
+//
+//export DeleteSeq
+func DeleteSeq(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	op := operation{op: opDelete, key: C.GoBytes(unsafe.Pointer(key), keyLen)}
+	return writeSeq(handle, []operation{op})
+}
+
+// ApplySeq is Apply with a sequence number: each write in the batch gets its
+// own, and the last one is returned. Preconditions are not supported.
+//
+//export ApplySeq
+func ApplySeq(handle C.uintptr_t, ops *C.char, opsLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	decoded, err := decodeOperations(C.GoBytes(unsafe.Pointer(ops), opsLen))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if hasPreconditions(decoded) {
+		return C.int64_t(setHandleError(uintptr(handle), errPreconditionsUnsupported))
+	}
+	return writeSeq(handle, decoded)
+}
+
+// LastSequence returns the sequence number of the newest logged write, 0 if
+// there is none, or a negative status code.
+//
+//export LastSequence
+func LastSequence(handle C.uintptr_t) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	log, err := changeLogFor(handle)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(log.lastSeq())
+}
+
+// ChangesSince returns up to maxChanges logged writes with a sequence number
+// above seq, oldest first, each framed as u64 sequence, u64 commit time in
+// Unix milliseconds, u8 op, u32 key length, u32 value length, key, value,
+// and for op 2 a u64 time-to-live in seconds. No newer changes returns NULL
+// with a zero status. If changes after seq have been trimmed the call fails,
+// and the host must resync.
+//
+//export ChangesSince
+func ChangesSince(handle C.uintptr_t, seq C.int64_t, maxChanges C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	*resultLen = 0
+	log, err := changeLogFor(handle)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if seq < 0 {
+		setHandleError(uintptr(handle), fmt.Errorf("invalid sequence %d", seq))
+		return nil
+	}
+	if maxChanges <= 0 {
+		maxChanges = 1
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	buffer, err = log.changes(buffer, uint64(seq), int(maxChanges))
+	if err != nil || len(buffer) == 0 {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
+
+// TrimChanges drops logged changes up to and including seq, once every
+// consumer has read them, and returns how many were dropped. The newest
+// change is always kept so numbering survives a reopen.
+//
+//export TrimChanges
+func TrimChanges(handle C.uintptr_t, seq C.int64_t) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	log, err := changeLogFor(handle)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if seq < 0 {
+		return C.int64_t(setHandleError(uintptr(handle), fmt.Errorf("invalid sequence %d", seq)))
+	}
+	n, err := log.trim(uint64(seq))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(n)
+}
@@ -0,0 +1,527 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checkpoints are full backups kept under a store's checkpoint directory as
+// <name>.ckpt, next to a <name>.json manifest. Badger checkpoints use its
+// native backup stream; other backends, SlateDB included, write portable
+// dumps. The SlateDB Go bindings do not expose SlateDB's own manifest
+// checkpoints, so this works the same on every backend. Dumps keep values
+// as the store's codecs encoded them, and the manifest records those codecs
+// (never the encryption key) so opens and restores can decode them again.
+const (
+	checkpointDataExt     = ".ckpt"
+	checkpointManifestExt = ".json"
+)
+
+var errCheckpointReadOnly = errors.New("checkpoint is read-only")
+
+// checkpointInfo is the manifest of one checkpoint, as listed by
+// ListCheckpoints.
+type checkpointInfo struct {
+	Name      string            `json:"name"`
+	Backend   string            `json:"backend"`
+	CreatedAt time.Time         `json:"created_at"`
+	SizeBytes int64             `json:"size_bytes"`
+	Codecs    *checkpointCodecs `json:"codecs,omitempty"`
+}
+
+// checkpointCodecs are the value codecs a checkpoint's source store was
+// opened with.
+type checkpointCodecs struct {
+	Encrypted   bool               `json:"encrypted,omitempty"`
+	Compression *compressionConfig `json:"compression,omitempty"`
+	Checksums   bool               `json:"checksums,omitempty"`
+}
+
+// codecsOf returns the codecs wrapStore layers for opts, or nil for none.
+// Badger encrypts natively and its backups hold plaintext.
+func codecsOf(opts *openOptions, backend string) *checkpointCodecs {
+	c := checkpointCodecs{
+		Encrypted:   opts.Encryption != nil && backend != "badger",
+		Compression: opts.Compression,
+		Checksums:   opts.Checksums,
+	}
+	if c == (checkpointCodecs{}) {
+		return nil
+	}
+	return &c
+}
+
+// options returns the wrapStore options that decode a checkpoint's values,
+// or nil when it has no codecs. enc must carry the source's key when the
+// checkpoint is encrypted.
+func (c *checkpointCodecs) options(enc *encryptionConfig) (*openOptions, error) {
+	if c == nil {
+		return nil, nil
+	}
+	opts := &openOptions{Compression: c.Compression, Checksums: c.Checksums}
+	if c.Encrypted {
+		if enc == nil {
+			return nil, errors.New("checkpoint was taken from an encrypted store; pass its encryption options")
+		}
+		opts.Encryption = enc
+	}
+	return opts, nil
+}
+
+// wrapCheckpoint layers the codecs opts describes over store, which holds a
+// checkpoint's encoded values.
+func wrapCheckpoint(store kvStore, backend string, opts *openOptions) (kvStore, error) {
+	if opts == nil {
+		return store, nil
+	}
+	return wrapStore(store, backend, opts)
+}
+
+// checkpointSource is where a handle's checkpoints go and the codecs its
+// values carry.
+type checkpointSource struct {
+	dir    string
+	codecs *checkpointCodecs
+}
+
+var (
+	checkpointMu   sync.Mutex
+	checkpointDirs = make(map[uintptr]checkpointSource)
+)
+
+func setCheckpointDir(id uintptr, dir string, codecs *checkpointCodecs) {
+	checkpointMu.Lock()
+	defer checkpointMu.Unlock()
+	checkpointDirs[id] = checkpointSource{dir: dir, codecs: codecs}
+}
+
+func forgetCheckpointDir(id uintptr) {
+	checkpointMu.Lock()
+	defer checkpointMu.Unlock()
+	delete(checkpointDirs, id)
+}
+
+func checkpointDirFor(id uintptr) (checkpointSource, error) {
+	checkpointMu.Lock()
+	defer checkpointMu.Unlock()
+	src, ok := checkpointDirs[id]
+	if !ok {
+		return checkpointSource{}, errors.New("store was not opened with a checkpoint_dir")
+	}
+	return src, nil
+}
+
+// checkpointPath validates name and returns the path of its file with ext.
+func checkpointPath(dir, name, ext string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid checkpoint name %q", name)
+	}
+	return filepath.Join(dir, name+ext), nil
+}
+
+func createCheckpoint(store kvStore, backend string, src checkpointSource, name string) (checkpointInfo, error) {
+	dir := src.dir
+	dataPath, err := checkpointPath(dir, name, checkpointDataExt)
+	if err != nil {
+		return checkpointInfo{}, err
+	}
+	if _, err := os.Stat(dataPath); err == nil {
+		return checkpointInfo{}, fmt.Errorf("checkpoint %q already exists", name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return checkpointInfo{}, err
+	}
+	info := checkpointInfo{Name: name, Backend: backend, CreatedAt: time.Now().UTC(), Codecs: src.codecs}
+	err = writeBackupFile(dataPath, func(w io.Writer) error {
+		_, err := backupStore(store, w, 0)
+		return err
+	})
+	if err != nil {
+		return checkpointInfo{}, err
+	}
+	if st, err := os.Stat(dataPath); err == nil {
+		info.SizeBytes = st.Size()
+	}
+	manifest, err := json.Marshal(info)
+	if err != nil {
+		return checkpointInfo{}, err
+	}
+	manifestPath, _ := checkpointPath(dir, name, checkpointManifestExt)
+	err = writeBackupFile(manifestPath, func(w io.Writer) error {
+		_, err := w.Write(manifest)
+		return err
+	})
+	if err != nil {
+		os.Remove(dataPath)
+		return checkpointInfo{}, err
+	}
+	return info, nil
+}
+
+// listCheckpoints returns the checkpoints under dir, oldest first.
+func listCheckpoints(dir string) ([]checkpointInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []checkpointInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := []checkpointInfo{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), checkpointManifestExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := readCheckpointInfo(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func readCheckpointInfo(dir, name string) (checkpointInfo, error) {
+	manifestPath, err := checkpointPath(dir, name, checkpointManifestExt)
+	if err != nil {
+		return checkpointInfo{}, err
+	}
+	raw, err := os.ReadFile(manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpointInfo{}, fmt.Errorf("no checkpoint named %q", name)
+	}
+	if err != nil {
+		return checkpointInfo{}, err
+	}
+	var info checkpointInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return checkpointInfo{}, fmt.Errorf("checkpoint %q: bad manifest: %w", name, err)
+	}
+	return info, nil
+}
+
+func deleteCheckpoint(dir, name string) error {
+	if _, err := readCheckpointInfo(dir, name); err != nil {
+		return err
+	}
+	dataPath, _ := checkpointPath(dir, name, checkpointDataExt)
+	manifestPath, _ := checkpointPath(dir, name, checkpointManifestExt)
+	// The manifest goes first so a half-deleted checkpoint is not listed.
+	if err := os.Remove(manifestPath); err != nil {
+		return err
+	}
+	if err := os.Remove(dataPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// loadCheckpoint streams a checkpoint's encoded values into store.
+func loadCheckpoint(store kvStore, dir, name string) error {
+	dataPath, _ := checkpointPath(dir, name, checkpointDataExt)
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return restoreStore(store, f)
+}
+
+// checkpointStore is a badger copy of a checkpoint in a temporary directory
+// that refuses writes; Close removes the directory. Embedding kvStore hides
+// badger's optional write interfaces.
+type checkpointStore struct {
+	kvStore
+	dir string
+}
+
+func (s checkpointStore) Close() error {
+	err := s.kvStore.Close()
+	if rmErr := os.RemoveAll(s.dir); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+func (s checkpointStore) Set(key, value []byte) error { return errCheckpointReadOnly }
+
+func (s checkpointStore) Delete(key []byte) error { return errCheckpointReadOnly }
+
+func (s checkpointStore) Apply(ops []operation) error { return errCheckpointReadOnly }
+
+// CreateCheckpoint writes a full, named copy of the store to the
+// checkpoint_dir given to OpenWithOptions.
+//
+//export CreateCheckpoint
+func CreateCheckpoint(handle C.uintptr_t, name *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	store, err := getHandle(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	src, err := checkpointDirFor(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	info, _ := lookupHandleInfo(id)
+	_, err = createCheckpoint(store, info.Backend, src, C.GoString(name))
+	return setHandleError(id, err)
+}
+
+// ListCheckpoints returns a JSON array of the store's checkpoints (name,
+// backend, created_at, size_bytes), oldest first. Release it with
+// FreeCString.
+//
+//export ListCheckpoints
+func ListCheckpoints(handle C.uintptr_t) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	id := uintptr(handle)
+	if _, err := getHandle(id); err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	src, err := checkpointDirFor(id)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	list, err := listCheckpoints(src.dir)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	doc, err := json.Marshal(list)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	setHandleError(id, nil)
+	return C.CString(string(doc))
+}
+
+// DeleteCheckpoint removes the checkpoint called name and its manifest.
+//
+//export DeleteCheckpoint
+func DeleteCheckpoint(handle C.uintptr_t, name *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	if _, err := getHandle(id); err != nil {
+		return setHandleError(id, err)
+	}
+	src, err := checkpointDirFor(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	return setHandleError(id, deleteCheckpoint(src.dir, C.GoString(name)))
+}
+
+// checkpointEncryption returns the encryption section of the options
+// document the source store was opened with; NULL or "" means none.
+func checkpointEncryption(jsonOptions *C.char) (*encryptionConfig, error) {
+	if jsonOptions == nil || C.GoString(jsonOptions) == "" {
+		return nil, nil
+	}
+	opts, err := parseOpenOptions(C.GoString(jsonOptions))
+	if err != nil {
+		return nil, err
+	}
+	return opts.Encryption, nil
+}
+
+// openCheckpoint streams a checkpoint into a badger directory under the
+// system temp dir, so memory use does not grow with its size, and layers the
+// source's codecs over it.
+func openCheckpoint(dir, name string, enc *encryptionConfig) (kvStore, error) {
+	info, err := readCheckpointInfo(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := info.Codecs.options(enc)
+	if err != nil {
+		return nil, err
+	}
+	ckpt, err := stageCheckpoint(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return wrapCheckpoint(ckpt, info.Backend, opts)
+}
+
+// stageCheckpoint loads a checkpoint into a badger directory under the system
+// temp dir.
+func stageCheckpoint(dir, name string) (checkpointStore, error) {
+	tmp, err := os.MkdirTemp("", "skyshelve-checkpoint-")
+	if err != nil {
+		return checkpointStore{}, err
+	}
+	copied, err := openBadger(tmp, false)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return checkpointStore{}, err
+	}
+	ckpt := checkpointStore{kvStore: copied, dir: tmp}
+	if err := loadCheckpoint(copied, dir, name); err != nil {
+		ckpt.Close()
+		return checkpointStore{}, err
+	}
+	return ckpt, nil
+}
+
+// OpenCheckpoint copies the checkpoint called name from the checkpoint
+// directory dir into a temporary local store and returns a read-only handle
+// over it. No store needs to be open. jsonOptions may be NULL; for a
+// checkpoint of an encrypted store it must carry the store's encryption
+// section. Release the handle with Close, which deletes the copy.
+//
+//export OpenCheckpoint
+func OpenCheckpoint(dir *C.char, name *C.char, jsonOptions *C.char) (ret C.uintptr_t) {
+	defer recoverExport(0, &ret, 0)
+	ckptDir, ckptName := C.GoString(dir), C.GoString(name)
+	enc, err := checkpointEncryption(jsonOptions)
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	store, err := openCheckpoint(ckptDir, ckptName, enc)
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	id := storeHandle(store)
+	describeHandle(id, handleInfo{Backend: "checkpoint", Path: filepath.Join(ckptDir, ckptName)})
+	setError(nil)
+	return C.uintptr_t(id)
+}
+
+// checkpointAt returns the newest checkpoint under dir taken at or before t.
+func checkpointAt(dir string, t time.Time) (checkpointInfo, error) {
+	list, err := listCheckpoints(dir)
+	if err != nil {
+		return checkpointInfo{}, err
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if !list[i].CreatedAt.After(t) {
+			return list[i], nil
+		}
+	}
+	return checkpointInfo{}, fmt.Errorf("no checkpoint taken at or before %s", t.UTC().Format(time.RFC3339))
+}
+
+// restoreCheckpoint opens the store at dstURI, which must be empty, loads
+// the named checkpoint's encoded values into it and layers the source's
+// codecs over it.
+func restoreCheckpoint(dir, name, dstURI string, enc *encryptionConfig) (kvStore, error) {
+	info, err := readCheckpointInfo(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := info.Codecs.options(enc)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := openStore(dstURI, false)
+	if err != nil {
+		return nil, err
+	}
+	err = dst.IterateRange(nil, nil, func(k, v []byte) error { return errStopIteration })
+	if errors.Is(err, errStopIteration) {
+		err = errors.New("restore destination is not empty")
+	}
+	if err == nil {
+		err = restoreCheckpointInto(dst, dir, info)
+	}
+	if err != nil {
+		dst.Close()
+		return nil, err
+	}
+	return wrapCheckpoint(dst, info.Backend, opts)
+}
+
+// restoreCheckpointInto loads a checkpoint into the empty store dst. Badger
+// checkpoints are native backups only badger can load, so for other
+// backends they are staged in a temporary badger copy and cloned from there.
+func restoreCheckpointInto(dst kvStore, dir string, info checkpointInfo) error {
+	if _, native := backendOf(dst).(*badgerStore); native || info.Backend != "badger" {
+		return loadCheckpoint(dst, dir, info.Name)
+	}
+	staged, err := stageCheckpoint(dir, info.Name)
+	if err != nil {
+		return err
+	}
+	defer staged.Close()
+	// Clone from the badger copy itself, which reports each entry's TTL.
+	return cloneStore(staged.kvStore, dst)
+}
+
+func restoredHandle(dst kvStore, dstURI string) C.uintptr_t {
+	id := storeHandle(dst)
+	describeHandle(id, describeOpen(dstURI, false))
+	setError(nil)
+	return C.uintptr_t(id)
+}
+
+// RestoreToCheckpoint materializes the checkpoint called name from the
+// checkpoint directory dir into a new, empty store at dstURI (any location
+// Open accepts) and returns a handle to it. The copy keeps the checkpoint's
+// encoded values, so reopen it with the source's codec options; jsonOptions
+// is as for OpenCheckpoint.
+//
+//export RestoreToCheckpoint
+func RestoreToCheckpoint(dir *C.char, name *C.char, dstURI *C.char, jsonOptions *C.char) (ret C.uintptr_t) {
+	defer recoverExport(0, &ret, 0)
+	uri := C.GoString(dstURI)
+	enc, err := checkpointEncryption(jsonOptions)
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	dst, err := restoreCheckpoint(C.GoString(dir), C.GoString(name), uri, enc)
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	return restoredHandle(dst, uri)
+}
+
+// RestoreToTimestamp is RestoreToCheckpoint for the newest checkpoint in dir
+// taken at or before unixMillis, the state the store was in at that moment
+// as far as the checkpoints record it.
+//
+//export RestoreToTimestamp
+func RestoreToTimestamp(dir *C.char, unixMillis C.int64_t, dstURI *C.char, jsonOptions *C.char) (ret C.uintptr_t) {
+	defer recoverExport(0, &ret, 0)
+	ckptDir, uri := C.GoString(dir), C.GoString(dstURI)
+	enc, err := checkpointEncryption(jsonOptions)
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	info, err := checkpointAt(ckptDir, time.UnixMilli(int64(unixMillis)))
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	dst, err := restoreCheckpoint(ckptDir, info.Name, uri, enc)
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	return restoredHandle(dst, uri)
+}
@@ -0,0 +1,262 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Checksummed values are stored as checksumMagic, a big-endian CRC32C of
+// the key followed by the value, then the value. Covering the key catches
+// values that end up under the wrong key, not just flipped bits. Values
+// without the envelope pass through unverified.
+var checksumMagic = []byte("\xffskysum")
+
+const (
+	checksumHeaderLen = 7 + 4
+	// maxReportedCorrupt bounds the entries listed in a Verify report.
+	maxReportedCorrupt = 1000
+)
+
+// quarantinePrefix holds entries Verify moved out of the keyspace in repair
+// mode: each raw stored value under quarantinePrefix+key.
+var quarantinePrefix = []byte("\xffquarantine/")
+
+var (
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+	errCorrupt = errors.New("checksum mismatch")
+)
+
+// checksummer is the integrity valueCodec.
+type checksummer struct{}
+
+func valueChecksum(key, value []byte) uint32 {
+	return crc32.Update(crc32.Checksum(key, castagnoli), castagnoli, value)
+}
+
+func (checksummer) encode(key, value []byte) ([]byte, error) {
+	buf := make([]byte, checksumHeaderLen, checksumHeaderLen+len(value))
+	copy(buf, checksumMagic)
+	binary.BigEndian.PutUint32(buf[len(checksumMagic):], valueChecksum(key, value))
+	return append(buf, value...), nil
+}
+
+func (checksummer) decode(key, raw []byte) ([]byte, error) {
+	if !hasChecksum(raw) {
+		return raw, nil
+	}
+	value := raw[checksumHeaderLen:]
+	if binary.BigEndian.Uint32(raw[len(checksumMagic):]) != valueChecksum(key, value) {
+		return nil, fmt.Errorf("value for key %q: %w", key, errCorrupt)
+	}
+	return value, nil
+}
+
+func hasChecksum(raw []byte) bool {
+	return len(raw) >= checksumHeaderLen && bytes.HasPrefix(raw, checksumMagic)
+}
+
+// integrityChecker is implemented by backends that can check their own
+// files, below the level of individual entries.
+type integrityChecker interface {
+	CheckIntegrity() error
+}
+
+// checkIntegrity runs store's backend check, reporting false when the
+// backend has none.
+func checkIntegrity(store kvStore) (bool, error) {
+	ic, ok := store.(integrityChecker)
+	if !ok {
+		return false, nil
+	}
+	return true, ic.CheckIntegrity()
+}
+
+// CheckIntegrity verifies the block checksums of every table on every level.
+func (s *badgerStore) CheckIntegrity() error { return s.db.VerifyChecksum() }
+
+// entryVerifier is implemented by backends that can walk every key even when
+// some values cannot be read, such as values lost from badger's value log.
+type entryVerifier interface {
+	IterateVerify(fn func(k, v []byte, readErr error) error) error
+}
+
+// IterateVerify visits every key with its value, or with the error reading
+// the value, reading values one at a time so errors are tied to their keys.
+func (r *badgerReader) IterateVerify(fn func(k, v []byte, readErr error) error) error {
+	return r.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			value, err := item.ValueCopy(nil)
+			if err := fn(item.KeyCopy(nil), value, err); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// verifyReport is the document returned by Verify. Keys are base64 in JSON.
+type verifyReport struct {
+	Checked int `json:"checked"`
+	// Unverified counts entries stored without a checksum.
+	Unverified   int             `json:"unverified"`
+	CorruptTotal int             `json:"corrupt_total"`
+	Corrupt      []corruptRecord `json:"corrupt"`
+	// BackendChecked is false for backends without their own file check.
+	BackendChecked bool   `json:"backend_checked"`
+	BackendError   string `json:"backend_error,omitempty"`
+	// Quarantined and Dropped count corrupt entries moved aside or removed
+	// in repair mode.
+	Quarantined int `json:"quarantined"`
+	Dropped     int `json:"dropped"`
+}
+
+type corruptRecord struct {
+	Key   []byte `json:"key"`
+	Error string `json:"error"`
+}
+
+// verifyStore reads every stored entry back through store's value codecs,
+// innermost first, recording entries that cannot be read or fail to decode
+// instead of stopping at the first one, then runs the backend's own check.
+// With repair set, each corrupt entry is then moved under quarantinePrefix
+// with its raw stored value, or deleted when the value cannot be read at
+// all. Repairs go straight to the backend, so they skip the change log,
+// audit log and index upkeep; cached copies are invalidated. Entries already in
+// quarantine are not checked.
+func verifyStore(store kvStore, repair bool) (*verifyReport, error) {
+	var codecs []valueCodec
+	var caches []*cacheStore
+	for {
+		switch s := store.(type) {
+		case *cacheStore:
+			caches = append(caches, s)
+		case *codecStore:
+			codecs = append(codecs, s.codec)
+		}
+		l, ok := store.(layer)
+		if !ok {
+			break
+		}
+		store = l.unwrap()
+	}
+
+	report := &verifyReport{Corrupt: []corruptRecord{}}
+	var bad [][]byte
+	check := func(k, raw []byte, readErr error) error {
+		if bytes.HasPrefix(k, quarantinePrefix) {
+			return nil
+		}
+		report.Checked++
+		value := raw
+		checked := false
+		err := readErr
+		for i := len(codecs) - 1; i >= 0 && err == nil; i-- {
+			if _, ok := codecs[i].(checksummer); ok {
+				checked = hasChecksum(value)
+			}
+			value, err = codecs[i].decode(k, value)
+		}
+		if !checked {
+			report.Unverified++
+		}
+		if err != nil {
+			report.CorruptTotal++
+			if len(report.Corrupt) < maxReportedCorrupt {
+				report.Corrupt = append(report.Corrupt, corruptRecord{Key: k, Error: err.Error()})
+			}
+			if repair {
+				bad = append(bad, bytes.Clone(k))
+			}
+		}
+		return nil
+	}
+	var err error
+	if ev, ok := store.(entryVerifier); ok {
+		err = ev.IterateVerify(check)
+	} else {
+		err = store.IterateRange(nil, nil, func(k, v []byte) error { return check(k, v, nil) })
+	}
+	if err != nil {
+		return report, err
+	}
+
+	checked, err := checkIntegrity(store)
+	report.BackendChecked = checked
+	if err != nil {
+		report.BackendError = err.Error()
+	}
+
+	for _, k := range bad {
+		raw, err := store.Get(k)
+		if isNotFound(err) {
+			continue
+		}
+		ops := []operation{{op: opDelete, key: k}}
+		if err == nil {
+			quarantined := append(bytes.Clone(quarantinePrefix), k...)
+			ops = append([]operation{{op: opSet, key: quarantined, value: raw}}, ops...)
+		}
+		if applyErr := store.Apply(ops); applyErr != nil {
+			return report, applyErr
+		}
+		for _, c := range caches {
+			c.invalidate(k)
+		}
+		if err == nil {
+			report.Quarantined++
+		} else {
+			report.Dropped++
+		}
+	}
+	return report, nil
+}
+
+// Verify walks the whole store and returns a JSON report of entries whose
+// value cannot be read, whose checksum does not match or that otherwise fail
+// to decode, for the host to release with FreeCString. At most 1000 corrupt
+// keys are listed; corrupt_total has the full count. Backends that can check
+// their own files do so too (badger verifies every table's block
+// checksums), with any failure in backend_error. When repair is non-zero,
+// corrupt entries are moved under the "\xffquarantine/" prefix with their
+// raw stored values, or dropped when unreadable, and counted in quarantined
+// and dropped.
+//
+//export Verify
+func Verify(handle C.uintptr_t, repair C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	report, err := verifyStore(store, repair != 0)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	doc, err := json.Marshal(report)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.CString(string(doc))
+}
@@ -0,0 +1,300 @@
+//go:build cli
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// cliCommands are the tool's subcommands. Each gets the store opened from
+// -store and the arguments after its name.
+var cliCommands = map[string]func(store kvStore, args []string) error{
+	"get":     cliGet,
+	"set":     cliSet,
+	"del":     cliDel,
+	"scan":    cliScan,
+	"dump":    cliDump,
+	"load":    cliLoad,
+	"backup":  cliBackup,
+	"restore": cliRestore,
+	"stats":   cliStats,
+	"migrate": cliMigrate,
+}
+
+var cliUsage = map[string]string{
+	"get":     "get KEY",
+	"set":     "set [-ttl DURATION] KEY [VALUE]  (VALUE defaults to stdin)",
+	"del":     "del KEY...",
+	"scan":    "scan [-prefix P] [-start K] [-limit N] [-keys]",
+	"dump":    "dump [-format binary|ndjson] FILE  (portable dump; - for stdout)",
+	"load":    "load FILE  (portable dump or native backup; - for stdin)",
+	"backup":  "backup [-since VERSION] FILE",
+	"restore": "restore FILE",
+	"stats":   "stats",
+	"migrate": "migrate DEST",
+}
+
+var cliOrder = []string{"get", "set", "del", "scan", "dump", "load", "backup", "restore", "stats", "migrate"}
+
+// main is the entry point of the command-line tool, built with
+// "go build -tags cli -o skyshelve skyshelve". Stores are opened with the
+// same locations Open accepts, so operators can inspect data directories and
+// slatedb buckets without writing a host program.
+func main() {
+	flags := flag.NewFlagSet("skyshelve", flag.ContinueOnError)
+	path := flags.String("store", os.Getenv("SKYSHELVE_STORE"), "store location, in any form Open accepts (default $SKYSHELVE_STORE)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: skyshelve [-store LOCATION] COMMAND [ARGS]\n\ncommands:\n")
+		for _, name := range cliOrder {
+			fmt.Fprintf(flags.Output(), "  %s\n", cliUsage[name])
+		}
+		fmt.Fprintf(flags.Output(), "\nflags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	run, ok := cliCommands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "skyshelve: unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "skyshelve: -store is required")
+		os.Exit(2)
+	}
+
+	store, err := openStore(*path, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "skyshelve: open %s: %v\n", *path, err)
+		os.Exit(1)
+	}
+	err = run(store, flags.Args()[1:])
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "skyshelve: %s: %v\n", flags.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+// cliArgs parses a subcommand's flags and checks how many positional
+// arguments remain.
+func cliArgs(flags *flag.FlagSet, args []string, min, max int) error {
+	flags.SetOutput(os.Stderr)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if n := flags.NArg(); n < min || (max >= 0 && n > max) {
+		return fmt.Errorf("usage: skyshelve %s", cliUsage[flags.Name()])
+	}
+	return nil
+}
+
+// cliOpenInput returns the file to read, or stdin for "-".
+func cliOpenInput(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+func cliGet(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	if err := cliArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	value, err := store.Get([]byte(flags.Arg(0)))
+	if isNotFound(err) {
+		return fmt.Errorf("key %q not found", flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(value)
+	return err
+}
+
+func cliSet(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("set", flag.ContinueOnError)
+	ttl := flags.Duration("ttl", 0, "expire the key after this long")
+	if err := cliArgs(flags, args, 1, 2); err != nil {
+		return err
+	}
+	var value []byte
+	if flags.NArg() == 2 {
+		value = []byte(flags.Arg(1))
+	} else {
+		var err error
+		if value, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+	return setWithTTL(store, []byte(flags.Arg(0)), value, *ttl)
+}
+
+func cliDel(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("del", flag.ContinueOnError)
+	if err := cliArgs(flags, args, 1, -1); err != nil {
+		return err
+	}
+	ops := make([]operation, flags.NArg())
+	for i, key := range flags.Args() {
+		ops[i] = operation{op: opDelete, key: []byte(key)}
+	}
+	return store.Apply(ops)
+}
+
+// cliScan prints one entry per line as a quoted key and value separated by
+// a tab, so binary keys and values stay on one line.
+func cliScan(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	prefix := flags.String("prefix", "", "only keys with this prefix")
+	start := flags.String("start", "", "start at this key (inclusive)")
+	limit := flags.Int("limit", 0, "stop after this many entries (0 for all)")
+	keysOnly := flags.Bool("keys", false, "print keys only")
+	if err := cliArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+	from, to := prefixRange([]byte(*prefix))
+	if *start != "" {
+		from = []byte(*start)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	n := 0
+	err := store.IterateRange(from, to, func(k, v []byte) error {
+		if *limit > 0 && n == *limit {
+			return errStopIteration
+		}
+		n++
+		w.WriteString(strconv.Quote(string(k)))
+		if !*keysOnly {
+			w.WriteString("\t" + strconv.Quote(string(v)))
+		}
+		return w.WriteByte('\n')
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return err
+	}
+	return w.Flush()
+}
+
+func cliDump(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	format := flags.String("format", dumpFormatBinary, "dump format, binary or ndjson")
+	if err := cliArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	if name := flags.Arg(0); name != "-" {
+		return writeBackupFile(name, func(w io.Writer) error {
+			return dumpStore(store, w, *format)
+		})
+	}
+	return dumpStore(store, os.Stdout, *format)
+}
+
+func cliLoad(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("load", flag.ContinueOnError)
+	if err := cliArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	r, err := cliOpenInput(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return restoreStore(store, r)
+}
+
+// cliBackup writes a backup like Backup, printing the version to pass as
+// -since for the next incremental backup.
+func cliBackup(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	since := flags.Uint64("since", 0, "only entries changed after this version (badger only)")
+	if err := cliArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	var next uint64
+	err := writeBackupFile(flags.Arg(0), func(w io.Writer) error {
+		var err error
+		next, err = backupStore(store, w, *since)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(next)
+	return nil
+}
+
+func cliRestore(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	if err := cliArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return restoreStore(store, f)
+}
+
+func cliStats(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	if err := cliArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+	stats, err := collectStats(store)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
+
+// cliMigrate copies the store into DEST like Migrate, reporting progress on
+// stderr.
+func cliMigrate(store kvStore, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := cliArgs(flags, args, 1, 1); err != nil {
+		return err
+	}
+	dst, err := openStore(flags.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	last := time.Now()
+	p, err := migrateStore(store, dst, func(p migrationProgress) {
+		if time.Since(last) >= time.Second {
+			last = time.Now()
+			fmt.Fprintf(os.Stderr, "copied %d, verified %d\n", p.copied, p.verified)
+		}
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "migrated %d entries\n", p.copied)
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var errCloneNotEmpty = errors.New("clone destination is not empty")
+
+// cloneStore copies every entry of src into dst, which must be empty, with
+// each entry's remaining TTL. src should be a snapshot so writes made while
+// the copy runs are left out consistently.
+func cloneStore(src, dst kvStore) error {
+	err := dst.IterateRange(nil, nil, func(k, v []byte) error {
+		return errCloneNotEmpty
+	})
+	if err != nil {
+		return err
+	}
+
+	var copied int64
+	w := &importWriter{store: dst}
+	err = src.IterateRange(nil, nil, func(k, v []byte) error {
+		ttl, err := keyTTL(src, k)
+		if isNotFound(err) {
+			// Expired between the scan and the TTL read.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		copied++
+		return w.set(bytes.Clone(k), bytes.Clone(v), ttl)
+	})
+	if err == nil {
+		err = w.flush()
+	}
+	if err != nil {
+		return fmt.Errorf("clone failed after %d entries: %w", copied, err)
+	}
+	return dst.Sync()
+}
+
+// Clone writes a complete, independent copy of the store behind handle to a
+// new, empty store at dstURI (any location accepted by Open, so the copy can
+// use another backend). Entries are read from a snapshot taken when Clone
+// starts, so the store stays writable throughout and the copy reflects a
+// single point in time; TTLs are kept. handle may itself be a snapshot
+// handle. Backends without snapshot support return an error.
+//
+//export Clone
+func Clone(handle C.uintptr_t, dstURI *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	store, err := getHandle(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	src := store
+	if !isSnapshot(id) {
+		if src, err = openSnapshot(store); err != nil {
+			return setHandleError(id, err)
+		}
+		defer src.Close()
+	}
+
+	dst, err := openStore(C.GoString(dstURI), false)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	err = cloneStore(src, dst)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return setHandleError(id, err)
+}
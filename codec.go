@@ -0,0 +1,189 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// valueCodec transforms values on their way into a store and back out.
+// Keys are passed for codecs that bind values to them; they are never
+// rewritten, so ordering and range scans are unaffected.
+type valueCodec interface {
+	encode(key, value []byte) ([]byte, error)
+	decode(key, raw []byte) ([]byte, error)
+}
+
+// codecStore applies a valueCodec to every value read from or written to
+// inner, and forwards the optional backend capabilities that do not need to
+// see values.
+type codecStore struct {
+	inner kvStore
+	codec valueCodec
+}
+
+// findCodec returns the first codec of type T layered over store.
+func findCodec[T valueCodec](store kvStore) (T, bool) {
+	for {
+		cs, ok := layerOf[*codecStore](store)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		if c, ok := cs.codec.(T); ok {
+			return c, true
+		}
+		store = cs.inner
+	}
+}
+
+func (s *codecStore) unwrap() kvStore { return s.inner }
+
+func (s *codecStore) Close() error { return s.inner.Close() }
+
+func (s *codecStore) Set(key, value []byte) error {
+	raw, err := s.codec.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return s.inner.Set(key, raw)
+}
+
+func (s *codecStore) Get(key []byte) ([]byte, error) {
+	raw, err := s.inner.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.codec.decode(key, raw)
+}
+
+func (s *codecStore) Has(key []byte) (bool, error) { return hasKey(s.inner, key) }
+
+func (s *codecStore) Delete(key []byte) error { return s.inner.Delete(key) }
+
+// decoding wraps fn so it receives decoded values.
+func (s *codecStore) decoding(fn func(k, v []byte) error) func(k, v []byte) error {
+	return func(k, raw []byte) error {
+		value, err := s.codec.decode(k, raw)
+		if err != nil {
+			return err
+		}
+		return fn(k, value)
+	}
+}
+
+func (s *codecStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, s.decoding(fn))
+}
+
+func (s *codecStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, s.decoding(fn))
+}
+
+func (s *codecStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, s.decoding(fn))
+}
+
+func (s *codecStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *codecStore) DeleteRange(start, end []byte) (int, error) {
+	return deleteRange(s.inner, start, end)
+}
+
+func (s *codecStore) Sync() error { return s.inner.Sync() }
+
+func (s *codecStore) Apply(ops []operation) error {
+	encoded, err := s.encodeOps(ops)
+	if err != nil {
+		return err
+	}
+	return s.inner.Apply(encoded)
+}
+
+func (s *codecStore) encodeOps(ops []operation) ([]operation, error) {
+	encoded := make([]operation, len(ops))
+	for i, op := range ops {
+		encoded[i] = op
+		if op.op == opDelete {
+			continue
+		}
+		raw, err := s.codec.encode(op.key, op.value)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i].value = raw
+	}
+	return encoded, nil
+}
+
+func (s *codecStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	raw, err := s.codec.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return setWithTTL(s.inner, key, raw, ttl)
+}
+
+func (s *codecStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+func (s *codecStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &codecTxn{txn: txn, codec: s.codec}, nil
+}
+
+func (s *codecStore) Snapshot() (kvStore, error) {
+	snap, err := openSnapshot(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &codecStore{inner: snap, codec: s.codec}, nil
+}
+
+func (s *codecStore) Stats() (storeStats, error) { return collectStats(s.inner) }
+
+// Backups and restores move encoded values, so a dump restores only into a
+// store layered with the same codecs.
+func (s *codecStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+func (s *codecStore) Load(r io.Reader) error { return restoreStore(s.inner, r) }
+
+type codecTxn struct {
+	txn   kvTxn
+	codec valueCodec
+}
+
+func (t *codecTxn) Get(key []byte) ([]byte, error) {
+	raw, err := t.txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return t.codec.decode(key, raw)
+}
+
+func (t *codecTxn) Set(key, value []byte) error {
+	raw, err := t.codec.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return t.txn.Set(key, raw)
+}
+
+func (t *codecTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	raw, err := t.codec.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return txnSetWithTTL(t.txn, key, raw, ttl)
+}
+
+func (t *codecTxn) Delete(key []byte) error { return t.txn.Delete(key) }
+
+func (t *codecTxn) Commit() error { return t.txn.Commit() }
+
+func (t *codecTxn) Discard() { t.txn.Discard() }
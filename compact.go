@@ -0,0 +1,123 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const defaultDiscardRatio = 0.5
+
+// compactor is implemented by backends that can reclaim space on demand.
+type compactor interface {
+	Compact() error
+}
+
+func compactStore(store kvStore) error {
+	c, ok := store.(compactor)
+	if !ok {
+		return errors.New("compaction is not supported by this backend")
+	}
+	return c.Compact()
+}
+
+// gcSettings reads the background value-log GC knobs. A zero interval leaves
+// GC to explicit Compact calls.
+func (c *badgerConfig) gcSettings() (time.Duration, float64, error) {
+	var interval time.Duration
+	if c.GCInterval != "" {
+		var err error
+		if interval, err = time.ParseDuration(c.GCInterval); err != nil {
+			return 0, 0, fmt.Errorf("invalid gc_interval: %w", err)
+		}
+	}
+	ratio := c.GCDiscardRatio
+	if ratio == 0 {
+		ratio = defaultDiscardRatio
+	}
+	if ratio <= 0 || ratio >= 1 {
+		return 0, 0, fmt.Errorf("gc_discard_ratio must be between 0 and 1, got %g", ratio)
+	}
+	return interval, ratio, nil
+}
+
+// Compact rewrites value-log files until none has at least the store's
+// discard ratio of stale data left.
+func (s *badgerStore) Compact() error {
+	for {
+		err := s.db.RunValueLogGC(s.discardRatio)
+		switch {
+		case errors.Is(err, badger.ErrNoRewrite):
+			return nil
+		case errors.Is(err, badger.ErrRejected):
+			// Another GC run, such as the background one, is in progress.
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+func (s *badgerStore) startValueLogGC(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.gcDone = make(chan struct{})
+	go func() {
+		defer close(s.gcDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := s.Compact(); err != nil {
+					logf(logWarn, "skyshelve", "value log GC failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Compact for SlateDB purges expired TTL entries and flushes the memtable.
+// SlateDB compacts SSTs and collects obsolete files in its own background
+// tasks, which the Go bindings do not expose.
+func (s *slateStore) Compact() error {
+	if err := s.sweepExpired(); err != nil {
+		return err
+	}
+	return s.db.Flush()
+}
+
+// Compact rebuilds the SQLite file, returning free pages to the filesystem.
+// In WAL mode the rebuilt pages land in the log, so it is checkpointed
+// before the main file shrinks.
+func (s *sqliteStore) Compact() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return err
+	}
+	return s.Sync()
+}
+
+func (s *codecStore) Compact() error { return compactStore(s.inner) }
+
+// Compact reclaims disk space held by overwritten and deleted values: it runs
+// badger's value-log GC with the discard ratio set at open (0.5 by default),
+// purges expired entries on SlateDB, and vacuums SQLite files.
+//
+//export Compact
+func Compact(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), compactStore(store))
+}
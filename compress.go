@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressed values are stored as compressionMagic, one byte naming the
+// algorithm, then the compressed payload. Values below the size threshold,
+// or that do not shrink, are stored as-is, so stores holding a mix of
+// compressed and plain values, or values compressed with a different
+// algorithm, read back unchanged.
+var compressionMagic = []byte("\xffskyzip")
+
+const (
+	compressionHeaderLen  = 7 + 1
+	defaultCompressionMin = 256
+)
+
+// Algorithm bytes in the compression header.
+const (
+	compressSnappy byte = 1
+	compressZstd   byte = 2
+)
+
+// compressionConfig is the "compression" section of the open options.
+type compressionConfig struct {
+	// Algorithm is "zstd" or "snappy".
+	Algorithm string `json:"algorithm"`
+	// MinSize is the smallest value, in bytes, worth compressing.
+	MinSize int `json:"min_size,omitempty"`
+}
+
+// compressor is the compression valueCodec. zstd encoders and decoders are
+// safe for concurrent EncodeAll and DecodeAll calls.
+type compressor struct {
+	algorithm byte
+	minSize   int
+	zenc      *zstd.Encoder
+	zdec      *zstd.Decoder
+}
+
+func newCompressor(cfg *compressionConfig) (*compressor, error) {
+	c := &compressor{minSize: cfg.MinSize}
+	if c.minSize <= 0 {
+		c.minSize = defaultCompressionMin
+	}
+	switch strings.ToLower(cfg.Algorithm) {
+	case "zstd":
+		c.algorithm = compressZstd
+	case "snappy":
+		c.algorithm = compressSnappy
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %q", cfg.Algorithm)
+	}
+
+	var err error
+	if c.zenc, err = zstd.NewWriter(nil); err != nil {
+		return nil, err
+	}
+	if c.zdec, err = zstd.NewReader(nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newCompressedStore(inner kvStore, cfg *compressionConfig) (kvStore, error) {
+	c, err := newCompressor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &codecStore{inner: inner, codec: c}, nil
+}
+
+func (c *compressor) encode(_, value []byte) ([]byte, error) {
+	if len(value) < c.minSize {
+		return value, nil
+	}
+	buf := make([]byte, compressionHeaderLen, compressionHeaderLen+len(value))
+	copy(buf, compressionMagic)
+	buf[len(compressionMagic)] = c.algorithm
+	switch c.algorithm {
+	case compressZstd:
+		buf = c.zenc.EncodeAll(value, buf)
+	case compressSnappy:
+		buf = append(buf, snappy.Encode(nil, value)...)
+	}
+	if len(buf) >= len(value) {
+		return value, nil
+	}
+	return buf, nil
+}
+
+func (c *compressor) decode(key, raw []byte) ([]byte, error) {
+	if len(raw) < compressionHeaderLen || !bytes.HasPrefix(raw, compressionMagic) {
+		return raw, nil
+	}
+	payload := raw[compressionHeaderLen:]
+	var (
+		value []byte
+		err   error
+	)
+	switch algorithm := raw[len(compressionMagic)]; algorithm {
+	case compressZstd:
+		value, err = c.zdec.DecodeAll(payload, nil)
+	case compressSnappy:
+		value, err = snappy.Decode(nil, payload)
+	default:
+		return nil, fmt.Errorf("value for key %q uses unknown compression algorithm %d", key, algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decompressing value for key %q: %w", key, err)
+	}
+	return value, nil
+}
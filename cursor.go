@@ -0,0 +1,305 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Read-ahead limits for cursors the host is draining: at most this many
+// entries, holding at most this many key and value bytes, wait in memory.
+const (
+	cursorPrefetchEntries = 4096
+	cursorPrefetchBytes   = 8 << 20
+)
+
+// cursor streams the entries of a prefix scan to the host in bounded chunks.
+// A producer goroutine drives kvStore.Iterate and hands entries over. It
+// starts one entry ahead; once the host has taken two full chunks in a row,
+// it reads ahead by two chunks' worth so ScanNext is served from memory
+// while the backend fetches the next blocks.
+type cursor struct {
+	storeID  uintptr
+	entries  chan cursorEntry
+	done     chan struct{}
+	finished chan struct{}
+	once     sync.Once
+
+	// window is how many entries the producer may queue; queued counts the
+	// key and value bytes waiting. wake tells a producer at its limit that
+	// the host took entries.
+	window atomic.Int64
+	queued atomic.Int64
+	wake   chan struct{}
+	// streak counts consecutive full chunks.
+	streak atomic.Int64
+	// err is an iteration error held back by next so the entries read
+	// before it are returned first.
+	err error
+}
+
+type cursorEntry struct {
+	key   []byte
+	value []byte
+	err   error
+}
+
+var (
+	cursorMu     sync.Mutex
+	cursors              = make(map[uintptr]*cursor)
+	nextCursorID uintptr = 1
+
+	errCursorClosed = errors.New("cursor closed")
+)
+
+// openCursor starts a cursor over the entries produced by iterate, which is
+// typically a bound kvStore.Iterate call.
+func openCursor(storeID uintptr, iterate func(fn func(k, v []byte) error) error) *cursor {
+	c := &cursor{
+		storeID:  storeID,
+		entries:  make(chan cursorEntry, cursorPrefetchEntries),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+	}
+	c.window.Store(1)
+	go c.run(iterate)
+	return c
+}
+
+func (c *cursor) run(iterate func(fn func(k, v []byte) error) error) {
+	defer close(c.finished)
+	defer close(c.entries)
+
+	err := iterate(func(k, v []byte) error {
+		for len(c.entries) > 0 && (int64(len(c.entries)) >= c.window.Load() || c.queued.Load() >= cursorPrefetchBytes) {
+			select {
+			case <-c.wake:
+			case <-c.done:
+				return errCursorClosed
+			}
+		}
+		c.queued.Add(int64(len(k) + len(v)))
+		select {
+		case c.entries <- cursorEntry{key: k, value: v}:
+			return nil
+		case <-c.done:
+			return errCursorClosed
+		}
+	})
+	if err != nil && !errors.Is(err, errCursorClosed) {
+		select {
+		case c.entries <- cursorEntry{err: err}:
+		case <-c.done:
+		}
+	}
+}
+
+// next appends up to max entries to buf, stopping early once the underlying
+// iteration is exhausted. An iteration error that follows some entries is
+// reported by the next call, once those entries are delivered.
+func (c *cursor) next(buf []byte, max int) ([]byte, error) {
+	if err := c.err; err != nil {
+		c.err = nil
+		return buf, err
+	}
+	start := len(buf)
+	for i := 0; i < max; i++ {
+		select {
+		case entry, ok := <-c.entries:
+			if !ok {
+				c.streak.Store(0)
+				return buf, nil
+			}
+			c.taken(entry)
+			if entry.err != nil {
+				if len(buf) > start {
+					c.err = entry.err
+					return buf, nil
+				}
+				return buf, entry.err
+			}
+			buf = appendEntry(buf, entry.key, entry.value)
+		case <-c.done:
+			return buf, errCursorClosed
+		}
+	}
+	if c.streak.Add(1) >= 2 {
+		window := int64(2 * max)
+		if window > cursorPrefetchEntries {
+			window = cursorPrefetchEntries
+		}
+		c.window.Store(window)
+	}
+	return buf, nil
+}
+
+// taken releases the read-ahead budget held by entry and wakes the producer.
+func (c *cursor) taken(entry cursorEntry) {
+	c.queued.Add(-int64(len(entry.key) + len(entry.value)))
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the producer and waits for it to release the backend iterator.
+func (c *cursor) close() {
+	c.once.Do(func() { close(c.done) })
+	<-c.finished
+}
+
+func storeCursor(c *cursor) uintptr {
+	cursorMu.Lock()
+	defer cursorMu.Unlock()
+	id := nextCursorID
+	nextCursorID++
+	cursors[id] = c
+	return id
+}
+
+func getCursor(id uintptr) (*cursor, error) {
+	cursorMu.Lock()
+	defer cursorMu.Unlock()
+	c, ok := cursors[id]
+	if !ok {
+		return nil, unknownHandleError("cursor")
+	}
+	return c, nil
+}
+
+func deleteCursor(id uintptr) *cursor {
+	cursorMu.Lock()
+	defer cursorMu.Unlock()
+	c := cursors[id]
+	delete(cursors, id)
+	return c
+}
+
+// closeCursorsFor closes every cursor opened against the given store handle so
+// the backend can shut down without live iterators.
+func closeCursorsFor(storeID uintptr) {
+	cursorMu.Lock()
+	var open []*cursor
+	for id, c := range cursors {
+		if c.storeID == storeID {
+			open = append(open, c)
+			delete(cursors, id)
+		}
+	}
+	cursorMu.Unlock()
+
+	for _, c := range open {
+		c.close()
+	}
+}
+
+//export ScanOpen
+func ScanOpen(handle C.uintptr_t, prefix *C.char, prefixLen C.int) (ret C.uintptr_t) {
+	defer recoverExport(uintptr(handle), &ret, 0)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+
+	start, end, ok := userPrefixRange(pref)
+	c := openCursor(uintptr(handle), func(fn func(k, v []byte) error) error {
+		if !ok {
+			return nil
+		}
+		return store.IterateRange(start, end, fn)
+	})
+	setHandleError(uintptr(handle), nil)
+	return C.uintptr_t(storeCursor(c))
+}
+
+// ScanOpenReverse is ScanOpen with entries delivered in descending key order.
+//
+//export ScanOpenReverse
+func ScanOpenReverse(handle C.uintptr_t, prefix *C.char, prefixLen C.int) (ret C.uintptr_t) {
+	defer recoverExport(uintptr(handle), &ret, 0)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+
+	start, end, ok := userPrefixRange(pref)
+	c := openCursor(uintptr(handle), func(fn func(k, v []byte) error) error {
+		if !ok {
+			return nil
+		}
+		return iterateReverse(store, start, end, fn)
+	})
+	setHandleError(uintptr(handle), nil)
+	return C.uintptr_t(storeCursor(c))
+}
+
+// ScanNext returns up to maxEntries entries using the same framing as Scan.
+// An exhausted cursor yields a nil buffer with resultLen set to zero and no
+// error recorded. When the scan fails part-way, the entries read before the
+// failure are returned first and the error is recorded by the next call.
+//
+//export ScanNext
+func ScanNext(cursorHandle C.uintptr_t, maxEntries C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(0, &ret, nil)
+	*resultLen = 0
+	c, err := getCursor(uintptr(cursorHandle))
+	if err != nil {
+		setError(err)
+		return nil
+	}
+
+	max := int(maxEntries)
+	if max <= 0 {
+		max = 1
+	}
+
+	buffer, err := c.next(nil, max)
+	if err != nil {
+		setHandleError(c.storeID, err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(c.storeID, nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(c.storeID, err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(c.storeID, nil)
+	return mem
+}
+
+//export ScanClose
+func ScanClose(cursorHandle C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	c := deleteCursor(uintptr(cursorHandle))
+	if c == nil {
+		return setError(unknownHandleError("cursor"))
+	}
+	c.close()
+	return setHandleError(c.storeID, nil)
+}
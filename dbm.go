@@ -0,0 +1,366 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The Python wrapper tags every value with its type; see _encode_value in
+// src/skyshelve/__init__.py. Imported shelf values are tagged as pickles so
+// SkyShelve returns the original objects, and other dbm values as raw bytes.
+const (
+	pythonValueRaw     = 0x00
+	pythonValueStr     = 0x01
+	pythonValuePickled = 0x02
+)
+
+// pythonTagLen is 1 when value starts with the tag the Python wrapper puts
+// on bytes and str values, and 0 otherwise. JSON text never starts with a
+// control byte, so the JSON helpers skip the tag to read documents the
+// wrapper wrote.
+func pythonTagLen(value []byte) int {
+	if len(value) > 0 && (value[0] == pythonValueRaw || value[0] == pythonValueStr) {
+		return 1
+	}
+	return 0
+}
+
+// GDBM header magics, which also tell the width of file offsets. Files
+// written on big-endian hosts carry them byte-swapped and are rejected.
+const (
+	gdbmOMagic         = 0x13579ace
+	gdbmMagic32        = 0x13579acd
+	gdbmMagic64        = 0x13579acf
+	gdbmNumsyncMagic32 = 0x13579ad0
+	gdbmNumsyncMagic64 = 0x13579ad1
+	// gdbmBucketAvail is the size of the free list kept in every bucket.
+	gdbmBucketAvail = 6
+)
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// dbmSource walks every key and value of a dbm file.
+type dbmSource func(fn func(key, value []byte) error) error
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// openDBM works out which dbm module wrote the database at path, the name
+// given to dbm.open or shelve.open, much like Python's dbm.whichdb.
+func openDBM(path string) (dbmSource, error) {
+	switch {
+	case fileExists(path + ".pag"):
+		// ndbm through gdbm's compatibility layer keeps a GDBM file in .pag.
+		path += ".pag"
+	case fileExists(path+".dat") && fileExists(path+".dir"):
+		return dumbDBMEntries(path), nil
+	case !fileExists(path) && fileExists(path+".db"):
+		path += ".db"
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(sqliteMagic))
+	_, err = io.ReadFull(f, head)
+	f.Close()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	if bytes.Equal(head, sqliteMagic) {
+		return sqliteDBMEntries(path), nil
+	}
+	if len(head) >= 4 {
+		switch binary.LittleEndian.Uint32(head) {
+		case gdbmOMagic, gdbmMagic64, gdbmNumsyncMagic64:
+			return gdbmEntries(path, 8), nil
+		case gdbmMagic32, gdbmNumsyncMagic32:
+			return gdbmEntries(path, 4), nil
+		}
+		switch binary.BigEndian.Uint32(head) {
+		case gdbmOMagic, gdbmMagic32, gdbmMagic64, gdbmNumsyncMagic32, gdbmNumsyncMagic64:
+			return nil, errors.New("GDBM files from big-endian hosts are not supported")
+		}
+	}
+	return nil, fmt.Errorf("%s is not a GDBM, dumb dbm or SQLite dbm file (Berkeley DB files are not supported)", path)
+}
+
+// gdbmEntries reads a GDBM file bucket by bucket through its hash
+// directory. offSize is the width of file offsets, 8 on 64-bit hosts; the
+// structures follow the C layout of the writer's little-endian host.
+func gdbmEntries(path string, offSize int) dbmSource {
+	return func(fn func(key, value []byte) error) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		readAt := func(off, n int64) ([]byte, error) {
+			if off < 0 || n < 0 || off+n > stat.Size() {
+				return nil, errors.New("corrupt GDBM file: pointer past the end of the file")
+			}
+			buf := make([]byte, n)
+			_, err := f.ReadAt(buf, off)
+			return buf, err
+		}
+		offset := func(b []byte) int64 {
+			if offSize == 8 {
+				return int64(binary.LittleEndian.Uint64(b))
+			}
+			return int64(binary.LittleEndian.Uint32(b))
+		}
+		i32 := func(b []byte) int64 {
+			return int64(int32(binary.LittleEndian.Uint32(b)))
+		}
+
+		header, err := readAt(0, 32+int64(offSize))
+		if err != nil {
+			return err
+		}
+		// magic, block_size, dir (an offset), dir_size, dir_bits,
+		// bucket_size, bucket_elems.
+		dirAt := offset(header[8:])
+		p := 8 + offSize
+		dirSize, bucketSize, bucketElems := i32(header[p:]), i32(header[p+8:]), i32(header[p+12:])
+
+		// A bucket is av_count, its free list of {av_size, av_adr} pairs,
+		// bucket_bits and count, then bucket_elems elements of hash_value,
+		// key_start[4], data_pointer, key_size and data_size. Offsets are
+		// aligned to their own width.
+		availElem := 2 * offSize
+		elemsAt := int64(offSize + gdbmBucketAvail*availElem + 8)
+		elemSize := int64(8 + offSize + 8)
+		if dirSize <= 0 || bucketElems <= 0 || elemsAt+bucketElems*elemSize > bucketSize {
+			return errors.New("corrupt GDBM header")
+		}
+
+		dir, err := readAt(dirAt, dirSize)
+		if err != nil {
+			return err
+		}
+		seen := make(map[int64]bool)
+		for i := 0; i+offSize <= len(dir); i += offSize {
+			bucketAt := offset(dir[i:])
+			if seen[bucketAt] {
+				// Directory entries share buckets that have not split.
+				continue
+			}
+			seen[bucketAt] = true
+			bucket, err := readAt(bucketAt, bucketSize)
+			if err != nil {
+				return err
+			}
+			for e := elemsAt; e < elemsAt+bucketElems*elemSize; e += elemSize {
+				elem := bucket[e : e+elemSize]
+				if i32(elem) == -1 {
+					continue
+				}
+				dataAt := offset(elem[8:])
+				keySize, dataSize := i32(elem[8+offSize:]), i32(elem[12+offSize:])
+				buf, err := readAt(dataAt, keySize+dataSize)
+				if err != nil {
+					return err
+				}
+				if err := fn(buf[:keySize], buf[keySize:]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// dumbDBMEntries reads Python's dbm.dumb, whose .dir file lists each key's
+// repr with the position and size of its value in the .dat file.
+func dumbDBMEntries(path string) dbmSource {
+	return func(fn func(key, value []byte) error) error {
+		dir, err := os.Open(path + ".dir")
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		dat, err := os.Open(path + ".dat")
+		if err != nil {
+			return err
+		}
+		defer dat.Close()
+
+		lines := bufio.NewScanner(dir)
+		lines.Buffer(nil, 1<<20)
+		for line := 1; lines.Scan(); line++ {
+			text := lines.Text()
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			key, rest, err := pythonUnquote(text)
+			if err != nil {
+				return fmt.Errorf("%s.dir line %d: %w", path, line, err)
+			}
+			var pos, size int64
+			if _, err := fmt.Sscanf(rest, ", (%d, %d)", &pos, &size); err != nil {
+				return fmt.Errorf("%s.dir line %d: %w", path, line, err)
+			}
+			value := make([]byte, size)
+			if _, err := dat.ReadAt(value, pos); err != nil {
+				return fmt.Errorf("%s.dat: value of %q: %w", path, key, err)
+			}
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+		return lines.Err()
+	}
+}
+
+// pythonUnquote decodes the Python string literal at the start of s, as
+// repr writes it, into Latin-1 bytes, and returns the rest of s.
+func pythonUnquote(s string) ([]byte, string, error) {
+	if s == "" || (s[0] != '\'' && s[0] != '"') {
+		return nil, "", errors.New("expected a quoted key")
+	}
+	quote := s[0]
+	var out []byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == quote {
+			return out, s[i+1:], nil
+		}
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		if i++; i == len(s) {
+			break
+		}
+		switch s[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, "", errors.New("truncated \\x escape")
+			}
+			b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, "", err
+			}
+			out = append(out, byte(b))
+			i += 2
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return nil, "", errors.New("unterminated key")
+}
+
+// sqliteDBMEntries reads the Dict table of Python 3.13's dbm.sqlite3.
+func sqliteDBMEntries(path string) dbmSource {
+	return func(fn func(key, value []byte) error) error {
+		db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		rows, err := db.Query("SELECT key, value FROM Dict")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key, value []byte
+			if err := rows.Scan(&key, &value); err != nil {
+				return err
+			}
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}
+}
+
+// isPickle reports whether b looks like a pickle of protocol 2 or later,
+// which Python 3's shelve always writes.
+func isPickle(b []byte) bool {
+	return len(b) >= 3 && b[0] == 0x80 && b[1] >= 2 && b[1] <= 5 && b[len(b)-1] == '.'
+}
+
+// importDBM copies the dbm database at path into store in the Python
+// wrapper's value encoding. When every value is a pickle the database is
+// taken for a shelf and its values are tagged as pickles; otherwise every
+// value is tagged as raw bytes.
+func importDBM(store kvStore, path string) error {
+	source, err := openDBM(path)
+	if err != nil {
+		return err
+	}
+	shelf, found := true, false
+	err = source(func(_, value []byte) error {
+		found = true
+		if !isPickle(value) {
+			shelf = false
+			return errStopIteration
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return err
+	}
+	tag := byte(pythonValueRaw)
+	if shelf && found {
+		tag = pythonValuePickled
+	}
+
+	w := &importWriter{store: store}
+	err = source(func(key, value []byte) error {
+		if len(key) == 0 {
+			return errors.New("empty keys cannot be imported")
+		}
+		return w.set(bytes.Clone(key), append([]byte{tag}, value...), 0)
+	})
+	if err != nil {
+		return err
+	}
+	return w.flush()
+}
+
+// ImportDBM copies the dbm database at path into the store behind handle,
+// in batches. path is the name passed to Python's dbm.open or shelve.open:
+// GDBM files (dbm.gnu, and dbm.ndbm built on gdbm's compatibility layer),
+// dbm.dumb's .dir and .dat pair and dbm.sqlite3 databases are read; Berkeley
+// DB files are not. Values are stored the way SkyShelve stores them, so a
+// shelf opened with SkyShelve afterwards returns the same objects, and other
+// dbm values come back as bytes.
+//
+//export ImportDBM
+func ImportDBM(handle C.uintptr_t, path *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), importDBM(store, C.GoString(path)))
+}
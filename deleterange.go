@@ -0,0 +1,274 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"time"
+	"unsafe"
+
+	"github.com/PowerDNS/lmdb-go/lmdb"
+	"github.com/dgraph-io/badger/v4"
+	bolt "go.etcd.io/bbolt"
+)
+
+// deleteBatchSize bounds how many keys a bulk delete removes per write.
+const deleteBatchSize = 1000
+
+// rangeDeleter is implemented by backends with a cheaper way to remove every
+// key in [start, end) than reading values back through IterateRange.
+type rangeDeleter interface {
+	DeleteRange(start, end []byte) (int, error)
+}
+
+// deleteRange removes every key in [start, end) and returns how many were
+// deleted. Deletes are applied in batches, so a failure part-way leaves the
+// earlier batches removed.
+func deleteRange(store kvStore, start, end []byte) (int, error) {
+	if rd, ok := store.(rangeDeleter); ok {
+		return rd.DeleteRange(start, end)
+	}
+	return deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		err := store.IterateRange(from, end, func(k, _ []byte) error {
+			if len(keys) >= deleteBatchSize {
+				return errStopIteration
+			}
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		return keys, nil
+	}, func(keys [][]byte) error {
+		ops := make([]operation, len(keys))
+		for i, k := range keys {
+			ops[i] = operation{op: opDelete, key: k}
+		}
+		return store.Apply(ops)
+	})
+}
+
+// deleteInBatches repeatedly lists up to deleteBatchSize keys from the
+// cursor position and removes them, resuming just after the last key.
+func deleteInBatches(start []byte, list func(from []byte) ([][]byte, error), remove func(keys [][]byte) error) (int, error) {
+	deleted := 0
+	for {
+		keys, err := list(start)
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) == 0 {
+			return deleted, nil
+		}
+		if err := remove(keys); err != nil {
+			return deleted, err
+		}
+		deleted += len(keys)
+		if len(keys) < deleteBatchSize {
+			return deleted, nil
+		}
+		start = append(keys[len(keys)-1], 0)
+	}
+}
+
+// DeleteRange walks keys only, without fetching values. DropPrefix is not
+// used: it blocks all writes while it runs and cannot report a count.
+func (s *badgerStore) DeleteRange(start, end []byte) (int, error) {
+	return deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		err := s.db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false
+			it := txn.NewIterator(opts)
+			defer it.Close()
+
+			for it.Seek(from); it.Valid() && len(keys) < deleteBatchSize; it.Next() {
+				key := it.Item().KeyCopy(nil)
+				if end != nil && bytes.Compare(key, end) >= 0 {
+					break
+				}
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		return keys, err
+	}, func(keys [][]byte) error {
+		wb := s.db.NewWriteBatch()
+		defer wb.Cancel()
+		for _, k := range keys {
+			if err := wb.Delete(k); err != nil {
+				return err
+			}
+		}
+		return wb.Flush()
+	})
+}
+
+// DeleteRange also clears expired entries the sweeper has not reached yet,
+// but only counts live ones.
+func (s *slateStore) DeleteRange(start, end []byte) (int, error) {
+	live := 0
+	_, err := deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		now := time.Now()
+		err := s.scan(from, end, func(k, raw []byte) error {
+			if len(keys) >= deleteBatchSize {
+				return errStopIteration
+			}
+			if _, ok := unwrapExpiry(raw, now); ok {
+				live++
+			}
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		return keys, nil
+	}, func(keys [][]byte) error {
+		ops := make([]operation, len(keys))
+		for i, k := range keys {
+			ops[i] = operation{op: opDelete, key: k}
+		}
+		return s.Apply(ops)
+	})
+	return live, err
+}
+
+// DeletePrefix removes every key starting with prefix and returns the number
+// of keys deleted, or a negative status code on error. An empty prefix is
+// rejected; use DeleteRange with empty bounds to clear a store on purpose.
+//
+//export DeletePrefix
+func DeletePrefix(handle C.uintptr_t, prefix *C.char, prefixLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if prefixLen <= 0 {
+		return C.int64_t(setHandleError(uintptr(handle), errors.New("empty prefix")))
+	}
+	start, end, ok := userPrefixRange(C.GoBytes(unsafe.Pointer(prefix), prefixLen))
+	if !ok {
+		setHandleError(uintptr(handle), nil)
+		return 0
+	}
+
+	n, err := deleteRange(store, start, end)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(n)
+}
+
+// dropper is implemented by backends that can empty a store faster than
+// deleting its keys one range batch at a time.
+type dropper interface {
+	DropAll() error
+}
+
+func dropAll(store kvStore) error {
+	if d, ok := store.(dropper); ok {
+		return d.DropAll()
+	}
+	_, err := deleteRange(store, nil, nil)
+	return err
+}
+
+// DropAll blocks writes while it discards every table and value-log file.
+func (s *badgerStore) DropAll() error { return s.db.DropAll() }
+
+func (s *boltStore) DropAll() error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(boltBucket)
+		return err
+	})
+}
+
+func (s *sqliteStore) DropAll() error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	_, err := s.db.Exec(`DELETE FROM kv`)
+	return err
+}
+
+func (s *lmdbStore) DropAll() error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.env.Update(func(txn *lmdb.Txn) error { return txn.Drop(s.dbi, false) })
+}
+
+func (s *memStore) DropAll() error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tree.Clear(false)
+	return nil
+}
+
+func (s *codecStore) DropAll() error { return dropAll(s.inner) }
+
+// DeleteRange removes every key in [start, end) and returns the number of
+// keys deleted, or a negative status code on error. Empty bounds are open,
+// but the range stops short of the reserved 0xff keyspace, so the library's
+// own records survive; DropAll clears those too.
+//
+//export DeleteRange
+func DeleteRange(handle C.uintptr_t, start *C.char, startLen C.int, end *C.char, endLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	var from, to []byte
+	if startLen > 0 {
+		from = C.GoBytes(unsafe.Pointer(start), startLen)
+	}
+	if endLen > 0 {
+		to = C.GoBytes(unsafe.Pointer(end), endLen)
+	}
+
+	from, to, ok := userRange(from, to)
+	if !ok {
+		setHandleError(uintptr(handle), nil)
+		return 0
+	}
+	n, err := deleteRange(store, from, to)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(n)
+}
+
+// DropAll deletes every key in the store without closing it. Sequences cached
+// on the handle are released first, so they restart from 0 afterwards.
+//
+//export DropAll
+func DropAll(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if isSnapshot(uintptr(handle)) {
+		return setHandleError(uintptr(handle), errReadOnly)
+	}
+	releaseSequencesFor(uintptr(handle))
+	return setHandleError(uintptr(handle), dropAll(store))
+}
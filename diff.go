@@ -0,0 +1,180 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+	"unsafe"
+)
+
+// Kinds of difference in a Diff result, from the first store to the second.
+const (
+	diffAdded   = '+'
+	diffRemoved = '-'
+	diffChanged = '~'
+)
+
+// diffBatchSize is how many entries each side of a diff reads at a time.
+const diffBatchSize = 1024
+
+// diffSide reads one store's entries in key order, a batch at a time, so a
+// diff can step through two stores together.
+type diffSide struct {
+	store  kvStore
+	end    []byte
+	from   []byte
+	keys   [][]byte
+	values [][]byte
+	done   bool
+}
+
+func newDiffSide(store kvStore, start, end []byte) *diffSide {
+	return &diffSide{store: store, from: start, end: end}
+}
+
+// peek returns the next entry without consuming it, or ok false once the
+// range is exhausted.
+func (s *diffSide) peek() (key, value []byte, ok bool, err error) {
+	if len(s.keys) == 0 && !s.done {
+		if err := s.fill(); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	if len(s.keys) == 0 {
+		return nil, nil, false, nil
+	}
+	return s.keys[0], s.values[0], true, nil
+}
+
+func (s *diffSide) advance() {
+	s.keys, s.values = s.keys[1:], s.values[1:]
+}
+
+func (s *diffSide) fill() error {
+	s.keys, s.values = s.keys[:0], s.values[:0]
+	err := s.store.IterateRange(s.from, s.end, func(k, v []byte) error {
+		if len(s.keys) == diffBatchSize {
+			return errStopIteration
+		}
+		s.keys = append(s.keys, bytes.Clone(k))
+		s.values = append(s.values, bytes.Clone(v))
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return err
+	}
+	if len(s.keys) < diffBatchSize {
+		s.done = true
+		return nil
+	}
+	// The smallest key greater than the last one read is last+0x00.
+	s.from = append(bytes.Clone(s.keys[len(s.keys)-1]), 0)
+	return nil
+}
+
+// appendDiff frames one difference: the kind byte, then the key, old value
+// and new value lengths as little-endian u32s, then the three byte strings.
+// Added keys have an empty old value and removed keys an empty new one.
+func appendDiff(buf []byte, kind byte, key, oldValue, newValue []byte) []byte {
+	var tmp [4]byte
+	buf = append(buf, kind)
+	for _, b := range [][]byte{key, oldValue, newValue} {
+		binary.LittleEndian.PutUint32(tmp[:], uint32(len(b)))
+		buf = append(buf, tmp[:]...)
+	}
+	buf = append(buf, key...)
+	buf = append(buf, oldValue...)
+	return append(buf, newValue...)
+}
+
+// diffStores walks the keys of a and b in [start, end) together and appends
+// every key added in b, removed from a or whose value changed to buf.
+func diffStores(a, b kvStore, start, end []byte, buf []byte) ([]byte, error) {
+	left, right := newDiffSide(a, start, end), newDiffSide(b, start, end)
+	for {
+		ka, va, okA, err := left.peek()
+		if err != nil {
+			return buf, err
+		}
+		kb, vb, okB, err := right.peek()
+		if err != nil {
+			return buf, err
+		}
+		switch {
+		case !okA && !okB:
+			return buf, nil
+		case !okB || (okA && bytes.Compare(ka, kb) < 0):
+			buf = appendDiff(buf, diffRemoved, ka, va, nil)
+			left.advance()
+		case !okA || bytes.Compare(ka, kb) > 0:
+			buf = appendDiff(buf, diffAdded, kb, nil, vb)
+			right.advance()
+		default:
+			if !bytes.Equal(va, vb) {
+				buf = appendDiff(buf, diffChanged, ka, va, vb)
+			}
+			left.advance()
+			right.advance()
+		}
+	}
+}
+
+// Diff compares the entries under prefix in the stores behind handleA and
+// handleB, which may use different backends, and returns every difference
+// in key order: '+' for keys only in B, '-' for keys only in A and '~' for
+// keys whose values differ. Each record is the kind byte followed by the
+// key, old value and new value lengths as little-endian u32s and the three
+// byte strings; the missing side of an added or removed key is empty. NULL
+// with a zero resultLen means the stores agree. Both stores are read in
+// bounded batches, so writes during the diff may or may not be seen. Errors
+// are reported on handleA.
+//
+//export Diff
+func Diff(handleA, handleB C.uintptr_t, prefix *C.char, prefixLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handleA), &ret, nil)
+	defer observe(uintptr(handleA), "diff", time.Now())
+	*resultLen = 0
+	a, err := getHandle(uintptr(handleA))
+	if err != nil {
+		setHandleError(uintptr(handleA), err)
+		return nil
+	}
+	b, err := getHandle(uintptr(handleB))
+	if err != nil {
+		setHandleError(uintptr(handleA), err)
+		return nil
+	}
+
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	if start, end, ok := userPrefixRange(pref); ok {
+		buffer, err = diffStores(a, b, start, end, buffer)
+	}
+	if err != nil {
+		setHandleError(uintptr(handleA), err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handleA), nil)
+		return nil
+	}
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handleA), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handleA), nil)
+	return mem
+}
@@ -0,0 +1,182 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Dumps come in two formats that any backend can write and load:
+//
+//   - "binary" is the framed format portable backups already use (see
+//     dumpMagic).
+//   - "ndjson" is one JSON object per line. The first line is the header
+//     {"skyshelve_dump": 1}; every other line is an entry
+//     {"key": base64, "value": base64, "expires_at": unix nanoseconds}, with
+//     expires_at left out for entries that never expire.
+//
+// Both formats are stable: later versions keep loading dumps written by
+// earlier ones.
+const (
+	dumpFormatBinary  = "binary"
+	dumpFormatNDJSON  = "ndjson"
+	ndjsonDumpVersion = 1
+)
+
+// ndjsonDumpMagic starts the header line of every NDJSON dump.
+var ndjsonDumpMagic = []byte(`{"skyshelve_dump":`)
+
+type ndjsonDumpHeader struct {
+	Version int `json:"skyshelve_dump"`
+}
+
+type ndjsonDumpEntry struct {
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// dumpEntries walks every entry of store with its expiry time, reading each
+// key's TTL so expiring entries keep their expiry when loaded elsewhere.
+func dumpEntries(store kvStore) func(fn func(k, v []byte, expiresAt int64) error) error {
+	return func(fn func(k, v []byte, expiresAt int64) error) error {
+		return store.IterateRange(nil, nil, func(k, v []byte) error {
+			ttl, err := keyTTL(store, k)
+			if isNotFound(err) {
+				// Expired between the scan and the TTL read.
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var expiresAt int64
+			if ttl > 0 {
+				expiresAt = time.Now().Add(ttl).UnixNano()
+			}
+			return fn(k, v, expiresAt)
+		})
+	}
+}
+
+// dumpStore writes every entry of store to w in format, "binary" when empty.
+func dumpStore(store kvStore, w io.Writer, format string) error {
+	switch format {
+	case "", dumpFormatBinary:
+		return writeDump(w, dumpEntries(store))
+	case dumpFormatNDJSON:
+		return writeNDJSONDump(w, dumpEntries(store))
+	}
+	return fmt.Errorf("unknown dump format %q (want %q or %q)", format, dumpFormatBinary, dumpFormatNDJSON)
+}
+
+func writeNDJSONDump(w io.Writer, iterate func(fn func(k, v []byte, expiresAt int64) error) error) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(ndjsonDumpHeader{Version: ndjsonDumpVersion}); err != nil {
+		return err
+	}
+	err := iterate(func(k, v []byte, expiresAt int64) error {
+		return enc.Encode(ndjsonDumpEntry{Key: k, Value: v, ExpiresAt: expiresAt})
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readNDJSONDump applies an NDJSON dump in batches, skipping entries that
+// expired since the dump was taken like readDump.
+func readNDJSONDump(store kvStore, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	var header ndjsonDumpHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("invalid dump header: %w", err)
+	}
+	if header.Version < 1 || header.Version > ndjsonDumpVersion {
+		return fmt.Errorf("unsupported dump version %d", header.Version)
+	}
+	var ops []operation
+	for line := 2; ; line++ {
+		var entry ndjsonDumpEntry
+		if err := dec.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("invalid dump entry %d: %w", line, err)
+		}
+		op := operation{op: opSet, key: entry.Key, value: entry.Value}
+		if entry.ExpiresAt != 0 {
+			ttl := time.Until(time.Unix(0, entry.ExpiresAt))
+			if ttl <= 0 {
+				continue
+			}
+			op.op, op.ttl = opSetTTL, ttl
+		}
+		if op.value == nil {
+			op.value = []byte{}
+		}
+		ops = append(ops, op)
+		if len(ops) == restoreBatchSize {
+			if err := store.Apply(ops); err != nil {
+				return err
+			}
+			ops = ops[:0]
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return store.Apply(ops)
+}
+
+// Dump writes every entry of the store behind handle to path in format:
+// "ndjson" for one base64 JSON object per line, or "binary" (also the
+// default for NULL or "") for the framed format of portable backups. Either
+// can be loaded into any backend by Load, including by later library
+// versions, and both keep TTLs.
+//
+//export Dump
+func Dump(handle C.uintptr_t, path *C.char, format *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	var f string
+	if format != nil {
+		f = C.GoString(format)
+	}
+	err = writeBackupFile(C.GoString(path), func(w io.Writer) error {
+		return dumpStore(store, w, f)
+	})
+	return setHandleError(uintptr(handle), err)
+}
+
+// Load applies a dump written by Dump, in either format, to the store behind
+// handle. Keys already in the store and not in the dump are left in place.
+// Native Badger backups are accepted too, like RestoreInto.
+//
+//export Load
+func Load(handle C.uintptr_t, path *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	f, err := os.Open(C.GoString(path))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	defer f.Close()
+	return setHandleError(uintptr(handle), restoreStore(store, f))
+}
@@ -0,0 +1,179 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	slatedb "slatedb.io/slatedb-go"
+)
+
+// Durability levels accepted by the *WithDurability exports.
+const (
+	// durabilityDefault uses whatever the store was opened with.
+	durabilityDefault = 0
+	// durabilityMemtable acknowledges once the write is in memory.
+	durabilityMemtable = 1
+	// durabilityPersisted acknowledges once the write is fsynced, or on
+	// SlateDB, uploaded to object storage.
+	durabilityPersisted = 2
+)
+
+// durableWriter is implemented by backends that can pick a durability level
+// per write and track which writes have been persisted.
+type durableWriter interface {
+	ApplyDurable(ops []operation, level int) (uint64, error)
+	AwaitDurable(seq uint64) error
+}
+
+// applyDurable commits ops at the requested level and returns a write
+// sequence number for AwaitDurable, or 0 on backends that do not number
+// their writes. Those fall back to a Sync after the write for the persisted
+// level.
+func applyDurable(store kvStore, ops []operation, level int) (uint64, error) {
+	if level < durabilityDefault || level > durabilityPersisted {
+		return 0, fmt.Errorf("unknown durability level %d", level)
+	}
+	if w, ok := store.(durableWriter); ok {
+		return w.ApplyDurable(ops, level)
+	}
+	if err := store.Apply(ops); err != nil {
+		return 0, err
+	}
+	if level == durabilityPersisted {
+		return 0, store.Sync()
+	}
+	return 0, nil
+}
+
+// awaitDurable blocks until the write numbered seq, and every write before
+// it, is persisted.
+func awaitDurable(store kvStore, seq uint64) error {
+	if w, ok := store.(durableWriter); ok {
+		return w.AwaitDurable(seq)
+	}
+	return store.Sync()
+}
+
+func (s *slateStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	switch level {
+	case durabilityMemtable:
+		return s.applyWith(ops, &slatedb.WriteOptions{AwaitDurable: false})
+	case durabilityPersisted:
+		return s.applyWith(ops, &slatedb.WriteOptions{AwaitDurable: true})
+	default:
+		return s.applyWith(ops, s.writeOpts)
+	}
+}
+
+// AwaitDurable flushes unless a flush that started after seq was written
+// has already finished. Concurrent callers queue on durableMu, so one flush
+// usually covers them all.
+func (s *slateStore) AwaitDurable(seq uint64) error {
+	s.durableMu.Lock()
+	defer s.durableMu.Unlock()
+	if seq <= s.durableSeq {
+		return nil
+	}
+	target := s.writeSeq.Load()
+	if err := s.db.Flush(); err != nil {
+		return err
+	}
+	s.durableSeq = target
+	return nil
+}
+
+func (s *codecStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	encoded, err := s.encodeOps(ops)
+	if err != nil {
+		return 0, err
+	}
+	return applyDurable(s.inner, encoded, level)
+}
+
+func (s *codecStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+func writeDurable(handle C.uintptr_t, name string, ops []operation, durability C.int) C.int64_t {
+	defer observe(uintptr(handle), name, time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if err := userOps(ops); err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	seq, err := applyDurable(store, ops, int(durability))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(seq)
+}
+
+// SetWithDurability is Set with a per-write durability level: 0 for the
+// store's default, 1 to return once the write is in memory, or 2 to return
+// once it is fsynced (persisted to object storage on SlateDB). It returns a
+// write sequence number to pass to AwaitDurable (0 on backends that do not
+// number writes), or a negative status code.
+//
+//export SetWithDurability
+func SetWithDurability(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int, durability C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	op := operation{
+		op:    opSet,
+		key:   C.GoBytes(unsafe.Pointer(key), keyLen),
+		value: C.GoBytes(unsafe.Pointer(value), valueLen),
+	}
+	return writeDurable(handle, "set", []operation{op}, durability)
+}
+
+// DeleteWithDurability is Delete with a durability level; see
+// SetWithDurability.
+//
+//export DeleteWithDurability
+func DeleteWithDurability(handle C.uintptr_t, key *C.char, keyLen C.int, durability C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	op := operation{op: opDelete, key: C.GoBytes(unsafe.Pointer(key), keyLen)}
+	return writeDurable(handle, "delete", []operation{op}, durability)
+}
+
+// ApplyWithDurability is Apply with a durability level; see
+// SetWithDurability.
+//
+//export ApplyWithDurability
+func ApplyWithDurability(handle C.uintptr_t, ops *C.char, opsLen C.int, durability C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	decoded, err := decodeOperations(C.GoBytes(unsafe.Pointer(ops), opsLen))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	if hasPreconditions(decoded) {
+		return C.int64_t(setHandleError(uintptr(handle), errPreconditionsUnsupported))
+	}
+	return writeDurable(handle, "apply", decoded, durability)
+}
+
+// AwaitDurable blocks until the write numbered seq, and every earlier write
+// on the handle, is persisted. On SlateDB this waits for the data to reach
+// object storage; other backends sync.
+//
+//export AwaitDurable
+func AwaitDurable(handle C.uintptr_t, seq C.int64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if seq < 0 {
+		return setHandleError(uintptr(handle), fmt.Errorf("invalid write sequence %d", seq))
+	}
+	return setHandleError(uintptr(handle), awaitDurable(store, uint64(seq)))
+}
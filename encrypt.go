@@ -0,0 +1,213 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Encrypted values are stored as encryptionMagic, the big-endian u32 ID of
+// the key that sealed them, a random nonce, then AES-GCM ciphertext. The key
+// is bound in as additional data, so ciphertext cannot be moved between keys.
+// Values without the envelope are returned as-is, which lets an existing
+// store be encrypted as its values are rewritten.
+var encryptionMagic = []byte("\xffskyenc")
+
+const (
+	encryptionNonceLen  = 12
+	encryptionHeaderLen = 7 + 4 + encryptionNonceLen
+	// Badger requires an index cache once encryption is on.
+	defaultEncryptedIndexCache = 64 << 20
+)
+
+var errNoActiveKey = errors.New("no active encryption key; call SetEncryptionKey or RotateEncryptionKey")
+
+// encryptionConfig is the "encryption" section of the open options. Key is
+// hex-encoded AES key material (16, 24 or 32 bytes). Badger stores encrypt
+// natively and rotate their data keys every RotationInterval; other backends
+// get a keyring codec whose keys can also be supplied after opening through
+// SetEncryptionKey.
+type encryptionConfig struct {
+	Key              string `json:"key,omitempty"`
+	KeyID            uint32 `json:"key_id,omitempty"`
+	RotationInterval string `json:"rotation_interval,omitempty"`
+}
+
+func (c *encryptionConfig) keyBytes() ([]byte, error) {
+	key, err := hex.DecodeString(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return key, nil
+}
+
+func (c *encryptionConfig) applyBadger(opts badger.Options) (badger.Options, error) {
+	if c.Key == "" {
+		return opts, errors.New("the badger backend needs an encryption key at open")
+	}
+	key, err := c.keyBytes()
+	if err != nil {
+		return opts, err
+	}
+	opts = opts.WithEncryptionKey(key)
+	if c.RotationInterval != "" {
+		interval, err := time.ParseDuration(c.RotationInterval)
+		if err != nil {
+			return opts, fmt.Errorf("invalid rotation_interval: %w", err)
+		}
+		opts = opts.WithEncryptionKeyRotationDuration(interval)
+	}
+	if opts.IndexCacheSize == 0 {
+		opts = opts.WithIndexCacheSize(defaultEncryptedIndexCache)
+	}
+	return opts, nil
+}
+
+// keyring is the encryption valueCodec. It holds every key values can be
+// opened with, and the one new writes are sealed with.
+type keyring struct {
+	mu        sync.RWMutex
+	keys      map[uint32]cipher.AEAD
+	active    uint32
+	hasActive bool
+}
+
+func newKeyring() *keyring {
+	return &keyring{keys: make(map[uint32]cipher.AEAD)}
+}
+
+// add installs key under id, activating it if activate is set or no key is
+// active yet.
+func (r *keyring) add(id uint32, key []byte, activate bool) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[id] = aead
+	if activate || !r.hasActive {
+		r.active, r.hasActive = id, true
+	}
+	return nil
+}
+
+// encode seals value under the active key.
+func (r *keyring) encode(key, value []byte) ([]byte, error) {
+	r.mu.RLock()
+	aead, id, ok := r.keys[r.active], r.active, r.hasActive
+	r.mu.RUnlock()
+	if !ok {
+		return nil, errNoActiveKey
+	}
+
+	buf := make([]byte, encryptionHeaderLen, encryptionHeaderLen+len(value)+aead.Overhead())
+	copy(buf, encryptionMagic)
+	binary.BigEndian.PutUint32(buf[len(encryptionMagic):], id)
+	nonce := buf[len(encryptionMagic)+4 : encryptionHeaderLen]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(buf, nonce, value, key), nil
+}
+
+// decode opens a sealed value, passing unsealed values through.
+func (r *keyring) decode(key, raw []byte) ([]byte, error) {
+	if len(raw) < encryptionHeaderLen || !bytes.HasPrefix(raw, encryptionMagic) {
+		return raw, nil
+	}
+	id := binary.BigEndian.Uint32(raw[len(encryptionMagic):])
+	r.mu.RLock()
+	aead, ok := r.keys[id]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("value for key %q is sealed with unknown encryption key %d", key, id)
+	}
+	nonce := raw[len(encryptionMagic)+4 : encryptionHeaderLen]
+	value, err := aead.Open(nil, nonce, raw[encryptionHeaderLen:], key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting value for key %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// newEncryptedStore layers a keyring over inner, seeded with the configured
+// key if there is one.
+func newEncryptedStore(inner kvStore, cfg *encryptionConfig) (kvStore, error) {
+	ring := newKeyring()
+	if cfg.Key != "" {
+		key, err := cfg.keyBytes()
+		if err != nil {
+			return nil, err
+		}
+		if err := ring.add(cfg.KeyID, key, true); err != nil {
+			return nil, err
+		}
+	}
+	return &codecStore{inner: inner, codec: ring}, nil
+}
+
+func storeKeyring(id uintptr) (*keyring, error) {
+	store, err := getHandle(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := backendOf(store).(*badgerStore); ok {
+		return nil, errors.New("badger encrypts natively and rotates its data keys itself; set rotation_interval at open")
+	}
+	ring, ok := findCodec[*keyring](store)
+	if !ok {
+		return nil, errors.New("store was not opened with encryption")
+	}
+	return ring, nil
+}
+
+func addEncryptionKey(handle C.uintptr_t, keyID C.uint32_t, key *C.char, keyLen C.int, activate bool) C.int {
+	ring, err := storeKeyring(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	material := C.GoBytes(unsafe.Pointer(key), keyLen)
+	return setHandleError(uintptr(handle), ring.add(uint32(keyID), material, activate))
+}
+
+// SetEncryptionKey makes the AES key (16, 24 or 32 bytes) available under
+// keyID for reading values sealed with it. It also becomes the key for new
+// writes if the store has none yet.
+//
+//export SetEncryptionKey
+func SetEncryptionKey(handle C.uintptr_t, keyID C.uint32_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	return addEncryptionKey(handle, keyID, key, keyLen, false)
+}
+
+// RotateEncryptionKey installs the AES key under keyID and seals every later
+// write with it. Values sealed with older keys stay readable as long as
+// those keys remain set, and move to the new key as they are rewritten.
+//
+//export RotateEncryptionKey
+func RotateEncryptionKey(handle C.uintptr_t, keyID C.uint32_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	return addEncryptionKey(handle, keyID, key, keyLen, true)
+}
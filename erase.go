@@ -0,0 +1,270 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+	"unsafe"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// prefixPurger is implemented by backends that keep older versions of
+// entries, or deleted ones, on disk after a delete.
+type prefixPurger interface {
+	// PurgePrefix removes every version of every key under prefix.
+	PurgePrefix(prefix []byte) error
+	// RetainedVersions counts the versions still held under prefix,
+	// deletion markers included.
+	RetainedVersions(prefix []byte) (int, error)
+}
+
+// PurgePrefix drops the prefix from the memtables and every LSM level,
+// blocking writes while it runs, then rewrites the value-log files left
+// with enough stale data; in-memory stores have no value log. DropPrefix
+// skips prefixes without a live key, so a placeholder is written under the
+// prefix first, and dropped with the rest.
+func (s *badgerStore) PurgePrefix(prefix []byte) error {
+	if err := s.Set(prefix, nil); err != nil {
+		return err
+	}
+	if err := s.db.DropPrefix(prefix); err != nil {
+		return err
+	}
+	if s.db.Opts().InMemory {
+		return nil
+	}
+	return s.Compact()
+}
+
+func (s *badgerStore) RetainedVersions(prefix []byte) (int, error) {
+	n := 0
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.AllVersions = true
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// eraseReport is the document returned by Erase. Fields are signed in this
+// order; see Erase.
+type eraseReport struct {
+	Prefix   []byte `json:"prefix"`
+	ErasedAt string `json:"erased_at"`
+	Deleted  int    `json:"deleted"`
+	// Remaining counts keys still readable under the prefix afterwards,
+	// trashed and quarantined copies included.
+	Remaining int `json:"remaining"`
+	// VersionsChecked is false for backends that cannot list old versions;
+	// RetainedVersions is then 0.
+	VersionsChecked  bool `json:"versions_checked"`
+	RetainedVersions int  `json:"retained_versions"`
+	Compacted        bool `json:"compacted"`
+	// ChangeLogRecords counts logged writes to erased keys, which still hold
+	// their values until TrimChanges drops them.
+	ChangeLogRecords int `json:"change_log_records"`
+	// ChangeLogKeys and AuditRecords count change log records, deletes
+	// included, and audit records that name an erased key. They keep the key
+	// but not the value, and are listed in VerifiedExcludes: audit records
+	// cannot be removed without breaking the hash chain.
+	ChangeLogKeys    int      `json:"change_log_keys"`
+	AuditRecords     int      `json:"audit_records"`
+	Verified         bool     `json:"verified"`
+	VerifiedExcludes []string `json:"verified_excludes"`
+	Signature        string   `json:"signature,omitempty"`
+}
+
+// verifiedExcludes names the report fields that count erased keys still
+// held somewhere, which verified does not cover.
+var verifiedExcludes = []string{"change_log_keys", "audit_records"}
+
+// eraseStore deletes every key under prefix through store, so indexes and
+// the change and audit logs see the deletes, along with blobs under prefix
+// and any trashed or quarantined copies, then purges what the backend keeps of them on disk and
+// checks that nothing is left.
+func eraseStore(store kvStore, prefix []byte) (*eraseReport, error) {
+	if len(prefix) == 0 {
+		return nil, errors.New("empty prefix")
+	}
+	if reservedKey(prefix) {
+		return nil, errors.New("prefix is in the reserved 0xff keyspace")
+	}
+	report := &eraseReport{Prefix: prefix, VerifiedExcludes: verifiedExcludes}
+	start, end := prefixRange(prefix)
+	n, err := deleteRange(store, start, end)
+	report.Deleted = n
+	if err != nil {
+		return nil, err
+	}
+	// In soft-delete mode the deletes moved the values to the trash.
+	prefixes := [][]byte{prefix}
+	if trash, ok := trashOf(store); ok {
+		trashed := trashKey(prefix)
+		prefixes = append(prefixes, trashed)
+		if _, err := deleteRange(trash.inner, trashed, nextPrefix(trashed)); err != nil {
+			return nil, err
+		}
+	}
+	// Blobs are stored under their own keyspace, and deleted like BlobDelete.
+	runs, err := blobRuns(store, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		prefixes = append(prefixes, run)
+		if _, err := deleteRange(store, run, nextPrefix(run)); err != nil {
+			return nil, err
+		}
+	}
+	// Verify's quarantine and the memcached server's client flags keep
+	// per-key records in the backend, under the key itself.
+	backend := backendOf(store)
+	for _, keyspace := range [][]byte{quarantinePrefix, memcacheFlagsPrefix} {
+		copied := append(bytes.Clone(keyspace), prefix...)
+		prefixes = append(prefixes, copied)
+		if _, err := deleteRange(backend, copied, nextPrefix(copied)); err != nil {
+			return nil, err
+		}
+	}
+
+	if p, ok := backend.(prefixPurger); ok {
+		for _, pref := range prefixes {
+			if err := p.PurgePrefix(pref); err != nil {
+				return nil, err
+			}
+			retained, err := p.RetainedVersions(pref)
+			if err != nil {
+				return nil, err
+			}
+			report.RetainedVersions += retained
+		}
+		report.Compacted = true
+		report.VersionsChecked = true
+	} else if _, ok := backend.(compactor); ok {
+		if err := compactStore(backend); err != nil {
+			return nil, err
+		}
+		report.Compacted = true
+	}
+
+	for _, pref := range prefixes {
+		from, to := prefixRange(pref)
+		remaining, err := countKeys(store, from, to)
+		if err != nil {
+			return nil, err
+		}
+		report.Remaining += remaining
+	}
+	if log, ok := layerOf[*changeLogStore](store); ok {
+		err := log.inner.IterateRange(changeLogPrefix, nextPrefix(changeLogPrefix), func(_, record []byte) error {
+			if _, op, err := parseChange(record); err == nil && bytes.HasPrefix(op.key, prefix) {
+				report.ChangeLogKeys++
+				if op.op != opDelete {
+					report.ChangeLogRecords++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if audit, ok := layerOf[*auditStore](store); ok {
+		err := audit.inner.IterateRange(auditPrefix, nextPrefix(auditPrefix), func(_, record []byte) error {
+			if key, ok := auditRecordKey(record); ok && bytes.HasPrefix(key, prefix) {
+				report.AuditRecords++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	report.Verified = report.Remaining == 0 && report.RetainedVersions == 0 && report.ChangeLogRecords == 0
+	report.ErasedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	return report, nil
+}
+
+// sign sets the report's signature to the hex HMAC-SHA256 under key of the
+// compact JSON of every other field.
+func (r *eraseReport) sign(key []byte) error {
+	r.Signature = ""
+	doc, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(doc)
+	r.Signature = hex.EncodeToString(mac.Sum(nil))
+	return nil
+}
+
+// Erase deletes every key under prefix for good and returns a JSON report
+// proving it, for the host to release with FreeCString. The deletes go
+// through the store like DeletePrefix, so indexes and logs stay consistent;
+// then badger drops every retained version of the prefix from its LSM tree
+// (blocking writes while it does) and garbage-collects its value log, and
+// other backends compact where they can. Blobs under prefix, and trashed and
+// quarantined copies of the keys, go too. The report counts the keys deleted and any still readable
+// (remaining), old versions still held (retained_versions, badger only), and
+// change log records that still carry erased values (change_log_records);
+// verified is true when all three are zero. Change log and audit records
+// that keep only an erased key are counted apart (change_log_keys,
+// audit_records) and left out of verified, as verified_excludes says. With a
+// non-empty signingKey, signature is the hex HMAC-SHA256 of the report's
+// compact JSON without the signature field. An empty prefix, or one in the
+// reserved 0xff keyspace, is rejected.
+//
+//export Erase
+func Erase(handle C.uintptr_t, prefix *C.char, prefixLen C.int, signingKey *C.char, signingKeyLen C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if isSnapshot(uintptr(handle)) {
+		setHandleError(uintptr(handle), errReadOnly)
+		return nil
+	}
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	report, err := eraseStore(store, pref)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if signingKeyLen > 0 {
+		if err := report.sign(C.GoBytes(unsafe.Pointer(signingKey), signingKeyLen)); err != nil {
+			setHandleError(uintptr(handle), err)
+			return nil
+		}
+	}
+	doc, err := json.Marshal(report)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.CString(string(doc))
+}
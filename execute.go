@@ -0,0 +1,255 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+	"unsafe"
+)
+
+// Execute command codes. The write commands share Apply's operation codes
+// and framing, so an Apply buffer is also a valid Execute buffer.
+const (
+	cmdGet  byte = 3
+	cmdHas  byte = 4
+	cmdScan byte = 5
+)
+
+type command struct {
+	code byte
+	// op holds the key, and for writes the whole operation.
+	op operation
+	// end and limit bound a scan; op.key is its start.
+	end   []byte
+	limit uint32
+}
+
+// frameReader walks a little-endian request buffer.
+type frameReader struct {
+	data []byte
+	off  int
+}
+
+func (r *frameReader) u8(what string) (byte, error) {
+	if r.off+1 > len(r.data) {
+		return 0, errors.New("malformed command " + what)
+	}
+	b := r.data[r.off]
+	r.off++
+	return b, nil
+}
+
+func (r *frameReader) u32(what string) (uint32, error) {
+	if r.off+4 > len(r.data) {
+		return 0, errors.New("malformed command " + what)
+	}
+	v := binary.LittleEndian.Uint32(r.data[r.off:])
+	r.off += 4
+	return v, nil
+}
+
+func (r *frameReader) u64(what string) (uint64, error) {
+	if r.off+8 > len(r.data) {
+		return 0, errors.New("malformed command " + what)
+	}
+	v := binary.LittleEndian.Uint64(r.data[r.off:])
+	r.off += 8
+	return v, nil
+}
+
+// bytes reads a u32 length-prefixed field, copied out of the buffer.
+func (r *frameReader) bytes(what string) ([]byte, error) {
+	n, err := r.u32(what + " length")
+	if err != nil {
+		return nil, err
+	}
+	if r.off+int(n) > len(r.data) {
+		return nil, errors.New("malformed command " + what)
+	}
+	b := append([]byte(nil), r.data[r.off:r.off+int(n)]...)
+	r.off += int(n)
+	return b, nil
+}
+
+// decodeCommands parses a whole Execute buffer up front, so a malformed
+// buffer runs nothing.
+func decodeCommands(data []byte) ([]command, error) {
+	r := &frameReader{data: data}
+	var cmds []command
+	for r.off < len(data) {
+		code, _ := r.u8("code")
+		key, err := r.bytes("key")
+		if err != nil {
+			return nil, err
+		}
+		cmd := command{code: code, op: operation{op: code, key: key}}
+		switch code {
+		case opSet, opSetTTL:
+			if cmd.op.value, err = r.bytes("value"); err != nil {
+				return nil, err
+			}
+			if code == opSetTTL {
+				secs, err := r.u64("ttl")
+				if err != nil {
+					return nil, err
+				}
+				if cmd.op.ttl, err = ttlFromSeconds(secs); err != nil {
+					return nil, err
+				}
+				if cmd.op.ttl <= 0 {
+					cmd.op.op = opSet
+				}
+			}
+		case opDelete, cmdGet, cmdHas:
+		case cmdScan:
+			if cmd.end, err = r.bytes("scan end"); err != nil {
+				return nil, err
+			}
+			if cmd.limit, err = r.u32("scan limit"); err != nil {
+				return nil, err
+			}
+			if len(cmd.op.key) == 0 {
+				cmd.op.key = nil
+			}
+			if len(cmd.end) == 0 {
+				cmd.end = nil
+			}
+		default:
+			return nil, errors.New("unknown command code")
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+func appendU32(buf []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(buf, v)
+}
+
+// runCommand executes one command and appends its framed result.
+func runCommand(store kvStore, cmd command, buf []byte) []byte {
+	var (
+		payload []byte
+		err     error
+	)
+	switch {
+	case cmd.code != cmdScan && reservedKey(cmd.op.key):
+		err = errReservedKey
+	case cmd.code == cmdGet:
+		var value []byte
+		if value, err = store.Get(cmd.op.key); err == nil {
+			payload = appendU32(payload, uint32(len(value)))
+			payload = append(payload, value...)
+		}
+	case cmd.code == cmdHas:
+		var found bool
+		if found, err = hasKey(store, cmd.op.key); err == nil {
+			payload = []byte{0}
+			if found {
+				payload[0] = 1
+			}
+		}
+	case cmd.code == cmdScan:
+		payload, err = scanCommand(store, cmd)
+	default:
+		err = store.Apply([]operation{cmd.op})
+	}
+
+	buf = appendU32(buf, uint32(int32(errorCode(err))))
+	if err != nil {
+		buf = appendU32(buf, uint32(len(err.Error())))
+		return append(buf, err.Error()...)
+	}
+	return append(buf, payload...)
+}
+
+// scanCommand frames up to limit entries of [start, end) as a u32 count, the
+// entries in Scan's framing, then a u8 flag set when entries remain.
+func scanCommand(store kvStore, cmd command) ([]byte, error) {
+	var (
+		entries []byte
+		count   uint32
+		more    byte
+	)
+	start, end, ok := userRange(cmd.op.key, cmd.end)
+	if !ok {
+		return append(appendU32(nil, 0), 0), nil
+	}
+	err := store.IterateRange(start, end, func(k, v []byte) error {
+		if cmd.limit > 0 && count == cmd.limit {
+			more = 1
+			return errStopIteration
+		}
+		entries = appendEntry(entries, k, v)
+		count++
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return nil, err
+	}
+	payload := appendU32(nil, count)
+	payload = append(payload, entries...)
+	return append(payload, more), nil
+}
+
+// Execute runs a pipeline of commands in one call and returns one framed
+// result per command, in order. Each command is
+// u8 code | u32 key length | key followed by:
+//
+//	0 SET      u32 value length | value
+//	1 DELETE   nothing
+//	2 SET_TTL  u32 value length | value | u64 ttl seconds
+//	3 GET      nothing
+//	4 HAS      nothing
+//	5 SCAN     u32 end length | end | u32 limit (0 for no limit); the key
+//	           is the start, and empty bounds are open
+//
+// Each result starts with an i32 status. Failed commands follow it with a
+// u32 message length and message; successful ones with a GET's u32 value
+// length and value, a HAS's u8 found flag, or a SCAN's u32 count, entries
+// framed as in Scan, and a u8 flag set when the limit cut the scan short.
+// Commands run independently and in order, so a failure, including a GET
+// miss (status -2), does not stop the rest. A malformed buffer runs nothing.
+//
+//export Execute
+func Execute(handle C.uintptr_t, commands *C.char, commandsLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "execute", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	cmds, err := decodeCommands(C.GoBytes(unsafe.Pointer(commands), commandsLen))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	for _, cmd := range cmds {
+		buffer = runCommand(store, cmd, buffer)
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
@@ -0,0 +1,312 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unsafe"
+)
+
+// A scan filter is one or more clauses joined with "and":
+//
+//	key glob "user:*"
+//	value contains "needle"
+//	$.age >= 21
+//	$.name == "bob"
+//
+// Strings are double-quoted with Go escapes. A JSON clause compares the
+// member at a path (see parseJSONPath) with a JSON literal using ==, !=, <,
+// <=, > or >=; numbers compare numerically and strings bytewise. Values that
+// are not JSON, or lack the member, fail the clause, and mismatched types
+// are unequal.
+type scanFilter struct {
+	clauses []filterClause
+}
+
+type filterClause interface {
+	match(key, value []byte, doc func() (any, bool)) bool
+}
+
+type keyGlob struct{ pattern string }
+
+func (c keyGlob) match(key, _ []byte, _ func() (any, bool)) bool {
+	ok, _ := path.Match(c.pattern, string(key))
+	return ok
+}
+
+type valueContains struct{ needle []byte }
+
+func (c valueContains) match(_, value []byte, _ func() (any, bool)) bool {
+	return bytes.Contains(value, c.needle)
+}
+
+type jsonCompare struct {
+	path    []string
+	op      string
+	operand any
+}
+
+func (c jsonCompare) match(_, _ []byte, doc func() (any, bool)) bool {
+	root, ok := doc()
+	if !ok {
+		return false
+	}
+	node, ok := lookupJSONPath(root, c.path)
+	if !ok {
+		return false
+	}
+	cmp, comparable := compareJSON(node, c.operand)
+	switch c.op {
+	case "==":
+		return comparable && cmp == 0
+	case "!=":
+		return !comparable || cmp != 0
+	case "<":
+		return comparable && cmp < 0
+	case "<=":
+		return comparable && cmp <= 0
+	case ">":
+		return comparable && cmp > 0
+	default:
+		return comparable && cmp >= 0
+	}
+}
+
+// compareJSON orders two JSON scalars of the same type, reporting false when
+// they cannot be compared. Booleans and nulls only compare equal or not.
+func compareJSON(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		if errA != nil || errB != nil {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	case bool:
+		b, ok := b.(bool)
+		if !ok || a != b {
+			return 1, ok
+		}
+		return 0, true
+	case nil:
+		if b != nil {
+			return 0, false
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// filterTokens splits a filter into words and double-quoted strings, which
+// keep their quotes.
+func filterTokens(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		switch {
+		case unicode.IsSpace(rune(expr[i])):
+			i++
+		case expr[i] == '"':
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(expr) {
+				return nil, errors.New("unterminated string in filter")
+			}
+			tokens = append(tokens, expr[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(expr) && !unicode.IsSpace(rune(expr[j])) && expr[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func unquoteFilter(tok string) (string, error) {
+	if !strings.HasPrefix(tok, `"`) {
+		return "", fmt.Errorf("expected a quoted string in filter, got %q", tok)
+	}
+	return strconv.Unquote(tok)
+}
+
+// compileFilter parses a filter expression. An empty one matches everything.
+func compileFilter(expr string) (*scanFilter, error) {
+	tokens, err := filterTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+	f := &scanFilter{}
+	for len(tokens) > 0 {
+		if len(f.clauses) > 0 {
+			if !strings.EqualFold(tokens[0], "and") {
+				return nil, fmt.Errorf("expected \"and\" in filter, got %q", tokens[0])
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 3 {
+			return nil, fmt.Errorf("incomplete filter clause %q", strings.Join(tokens, " "))
+		}
+		clause, err := compileClause(tokens[0], tokens[1], tokens[2])
+		if err != nil {
+			return nil, err
+		}
+		f.clauses = append(f.clauses, clause)
+		tokens = tokens[3:]
+	}
+	return f, nil
+}
+
+func compileClause(subject, op, operand string) (filterClause, error) {
+	switch {
+	case subject == "key" && op == "glob":
+		pattern, err := unquoteFilter(operand)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad glob %q: %w", pattern, err)
+		}
+		return keyGlob{pattern}, nil
+	case subject == "value" && op == "contains":
+		needle, err := unquoteFilter(operand)
+		if err != nil {
+			return nil, err
+		}
+		return valueContains{[]byte(needle)}, nil
+	case strings.HasPrefix(subject, "$"):
+		segs, err := parseJSONPath(subject)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("unknown comparison %q in filter", op)
+		}
+		lit, err := decodeJSON([]byte(operand))
+		if err != nil {
+			return nil, fmt.Errorf("bad literal %s in filter: %w", operand, err)
+		}
+		return jsonCompare{path: segs, op: op, operand: lit}, nil
+	}
+	return nil, fmt.Errorf("unknown filter clause %q", subject+" "+op)
+}
+
+// match reports whether an entry passes every clause. The value is parsed
+// as JSON at most once, and only if a JSON clause needs it; a Python wrapper
+// tag is skipped first.
+func (f *scanFilter) match(key, value []byte) bool {
+	var (
+		parsed, isJSON bool
+		root           any
+	)
+	doc := func() (any, bool) {
+		if !parsed {
+			parsed = true
+			var err error
+			root, err = decodeJSON(value[pythonTagLen(value):])
+			isJSON = err == nil
+		}
+		return root, isJSON
+	}
+	for _, c := range f.clauses {
+		if !c.match(key, value, doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanFilter is Scan that only returns the entries matching filter, such as
+//
+//	key glob "user:*" and $.age >= 21
+//
+// evaluated inside the library so unwanted entries never cross the cgo
+// boundary. Clauses are "key glob", "value contains" and comparisons of a
+// JSON path with a JSON literal, joined with "and". Release the result with
+// FreeBuffer.
+//
+//export ScanFilter
+func ScanFilter(handle C.uintptr_t, prefix *C.char, prefixLen C.int, filter *C.char, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "scan_filter", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	f, err := compileFilter(C.GoString(filter))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	if start, end, ok := userPrefixRange(pref); ok {
+		err = store.IterateRange(start, end, func(k, v []byte) error {
+			if f.match(k, v) {
+				buffer = appendEntry(buffer, k, v)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
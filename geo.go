@@ -0,0 +1,327 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"unsafe"
+)
+
+// A located key has two records under geoPrefix: 'k' + key holds its
+// latitude and longitude as little-endian f64s, and 'h' + geohash + key holds
+// the same. The geohash interleaves 26 bits of longitude and latitude into
+// the top 52 bits of a big-endian u64, so every geohash cell is one key
+// range and a radius search scans the few cells around its bounding box.
+var geoPrefix = []byte("\xffgeo/")
+
+const (
+	geoBits = 26
+	// earthRadius is the mean radius of the Earth in metres.
+	earthRadius = 6371008.8
+)
+
+func geoBase(kind byte) []byte {
+	return append(append([]byte(nil), geoPrefix...), kind)
+}
+
+func geoCoord(v, lo, hi float64) uint32 {
+	c := uint32((v - lo) / (hi - lo) * (1 << geoBits))
+	if c >= 1<<geoBits {
+		c = 1<<geoBits - 1
+	}
+	return c
+}
+
+// interleave merges the low bits of lat and lon, longitude first.
+func interleave(lat, lon uint32, bits int) uint64 {
+	var v uint64
+	for i := bits - 1; i >= 0; i-- {
+		v = v<<1 | uint64(lon>>i&1)
+		v = v<<1 | uint64(lat>>i&1)
+	}
+	return v
+}
+
+func geohash(lat, lon float64) uint64 {
+	return interleave(geoCoord(lat, -90, 90), geoCoord(lon, -180, 180), geoBits) << (64 - 2*geoBits)
+}
+
+func geoHashKey(hash uint64, key []byte) []byte {
+	return append(binary.BigEndian.AppendUint64(geoBase('h'), hash), key...)
+}
+
+func encodeLatLon(lat, lon float64) []byte {
+	buf := binary.LittleEndian.AppendUint64(nil, math.Float64bits(lat))
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(lon))
+}
+
+func decodeLatLon(raw []byte) (float64, float64, error) {
+	if len(raw) != 16 {
+		return 0, 0, errors.New("malformed geo record")
+	}
+	lat := math.Float64frombits(binary.LittleEndian.Uint64(raw))
+	return lat, math.Float64frombits(binary.LittleEndian.Uint64(raw[8:])), nil
+}
+
+func checkLatLon(lat, lon float64) error {
+	if !(lat >= -90 && lat <= 90) || !(lon >= -180 && lon <= 180) {
+		return fmt.Errorf("coordinates out of range: lat %v, lon %v", lat, lon)
+	}
+	return nil
+}
+
+// haversine returns the great-circle distance in metres between two points.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	p1, p2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dp, dl := p2-p1, (lon2-lon1)*math.Pi/180
+	a := math.Sin(dp/2)*math.Sin(dp/2) + math.Cos(p1)*math.Cos(p2)*math.Sin(dl/2)*math.Sin(dl/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// geoPut places key at lat, lon, moving it if it already had a location.
+func geoPut(store kvStore, key []byte, lat, lon float64) error {
+	if err := checkLatLon(lat, lon); err != nil {
+		return err
+	}
+	loc := encodeLatLon(lat, lon)
+	return retryConflicts(func() error {
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+		if err := dropGeoEntry(txn, key); err != nil {
+			return err
+		}
+		if err := txn.Set(append(geoBase('k'), key...), loc); err != nil {
+			return err
+		}
+		if err := txn.Set(geoHashKey(geohash(lat, lon), key), loc); err != nil {
+			return err
+		}
+		return txn.Commit()
+	})
+}
+
+// dropGeoEntry removes key's geohash record, if it has one.
+func dropGeoEntry(txn kvTxn, key []byte) error {
+	old, err := txn.Get(append(geoBase('k'), key...))
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lat, lon, err := decodeLatLon(old)
+	if err != nil {
+		return err
+	}
+	return txn.Delete(geoHashKey(geohash(lat, lon), key))
+}
+
+func geoDelete(store kvStore, key []byte) error {
+	return retryConflicts(func() error {
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+		if err := dropGeoEntry(txn, key); err != nil {
+			return err
+		}
+		if err := txn.Delete(append(geoBase('k'), key...)); err != nil {
+			return err
+		}
+		return txn.Commit()
+	})
+}
+
+// geoCells returns the key ranges of the geohash cells covering the circle
+// of radius metres around lat, lon.
+func geoCells(lat, lon, radius float64) [][2][]byte {
+	dLat := radius / earthRadius * 180 / math.Pi
+	minLat, maxLat := lat-dLat, lat+dLat
+	minLon, maxLon := -180.0, 180.0
+	if minLat > -90 && maxLat < 90 {
+		s := math.Sin(radius/earthRadius) / math.Cos(lat*math.Pi/180)
+		if s < 1 {
+			dLon := math.Asin(s) * 180 / math.Pi
+			minLon, maxLon = lon-dLon, lon+dLon
+		}
+	}
+	minLat, maxLat = math.Max(minLat, -90), math.Min(maxLat, 90)
+
+	// The finest cells still as large as the box cover it with at most two
+	// cells along each axis.
+	bits := 0
+	for bits < geoBits && 180/float64(uint64(2)<<bits) >= maxLat-minLat && 360/float64(uint64(2)<<bits) >= maxLon-minLon {
+		bits++
+	}
+	cell := func(v, lo, hi float64) uint32 { return geoCoord(v, lo, hi) >> (geoBits - bits) }
+
+	var lonCells []uint32
+	seen := make(map[uint32]bool)
+	addLon := func(from, to uint32) {
+		for c := from; c <= to; c++ {
+			if !seen[c] {
+				seen[c] = true
+				lonCells = append(lonCells, c)
+			}
+		}
+	}
+	last := uint32(1)<<bits - 1
+	switch {
+	case maxLon-minLon >= 360:
+		addLon(0, last)
+	case minLon < -180:
+		addLon(0, cell(maxLon, -180, 180))
+		addLon(cell(minLon+360, -180, 180), last)
+	case maxLon > 180:
+		addLon(0, cell(maxLon-360, -180, 180))
+		addLon(cell(minLon, -180, 180), last)
+	default:
+		addLon(cell(minLon, -180, 180), cell(maxLon, -180, 180))
+	}
+
+	base := geoBase('h')
+	shift := 64 - 2*bits
+	var ranges [][2][]byte
+	for la := cell(minLat, -90, 90); la <= cell(maxLat, -90, 90); la++ {
+		for _, lo := range lonCells {
+			p := interleave(la, lo, bits)
+			start := binary.BigEndian.AppendUint64(append([]byte(nil), base...), p<<shift)
+			end := nextPrefix(base)
+			if bits > 0 && p+1 < uint64(1)<<(2*bits) {
+				end = binary.BigEndian.AppendUint64(append([]byte(nil), base...), (p+1)<<shift)
+			}
+			ranges = append(ranges, [2][]byte{start, end})
+		}
+	}
+	return ranges
+}
+
+// geoHit is a key found by a radius search and its distance in metres.
+type geoHit struct {
+	key      []byte
+	distance float64
+}
+
+// geoSearch returns the keys within radius metres of lat, lon, nearest
+// first and ties in key order, stopping after limit when limit is positive.
+func geoSearch(store kvStore, lat, lon, radius float64, limit int) ([]geoHit, error) {
+	if err := checkLatLon(lat, lon); err != nil {
+		return nil, err
+	}
+	if !(radius >= 0) || math.IsInf(radius, 0) {
+		return nil, errors.New("radius must be a finite, non-negative number of metres")
+	}
+	base := geoBase('h')
+	var hits []geoHit
+	for _, r := range geoCells(lat, lon, radius) {
+		err := store.IterateRange(r[0], r[1], func(k, v []byte) error {
+			pLat, pLon, err := decodeLatLon(v)
+			if err != nil {
+				return err
+			}
+			if d := haversine(lat, lon, pLat, pLon); d <= radius {
+				hits = append(hits, geoHit{key: append([]byte(nil), k[len(base)+8:]...), distance: d})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].distance != hits[j].distance {
+			return hits[i].distance < hits[j].distance
+		}
+		return bytes.Compare(hits[i].key, hits[j].key) < 0
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// GeoPut records that key is at lat, lon (degrees), replacing its previous
+// location. The location is kept apart from key's value, under the reserved
+// 0xff prefix.
+//
+//export GeoPut
+func GeoPut(handle C.uintptr_t, key *C.char, keyLen C.int, lat C.double, lon C.double) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "geo_put", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	return setHandleError(uintptr(handle), geoPut(store, gotKey, float64(lat), float64(lon)))
+}
+
+// GeoDelete removes key's location. Removing a missing location is not an
+// error.
+//
+//export GeoDelete
+func GeoDelete(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	return setHandleError(uintptr(handle), geoDelete(store, gotKey))
+}
+
+// GeoSearch returns the keys located within radius metres of lat, lon,
+// nearest first, using Scan's framing with the distance in metres as a
+// little-endian f64 value. A non-positive limit returns every match. Release
+// the result with FreeBuffer.
+//
+//export GeoSearch
+func GeoSearch(handle C.uintptr_t, lat C.double, lon C.double, radius C.double, limit C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "geo_search", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	hits, err := geoSearch(store, float64(lat), float64(lon), float64(radius), int(limit))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(hits) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	var dist [8]byte
+	for _, h := range hits {
+		binary.LittleEndian.PutUint64(dist[:], math.Float64bits(h.distance))
+		buffer = appendEntry(buffer, h.key, dist[:])
+	}
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
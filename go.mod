@@ -2,19 +2,25 @@ module skyshelve
 
 go 1.25.3
 
-require github.com/dgraph-io/badger/v4 v4.1.0
+require (
+	github.com/PowerDNS/lmdb-go v1.9.2
+	github.com/dgraph-io/badger/v4 v4.1.0
+	github.com/dgraph-io/ristretto v0.1.1
+	github.com/golang/snappy v0.0.3
+	github.com/google/btree v1.1.3
+	github.com/klauspost/compress v1.12.3
+	github.com/mattn/go-sqlite3 v1.14.22
+	go.etcd.io/bbolt v1.3.10
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
-	github.com/dgraph-io/ristretto v0.1.1 // indirect
 	github.com/dustin/go-humanize v1.0.0 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b // indirect
 	github.com/golang/groupcache v0.0.0-20190702054246-869f871628b6 // indirect
 	github.com/golang/protobuf v1.3.1 // indirect
-	github.com/golang/snappy v0.0.3 // indirect
 	github.com/google/flatbuffers v1.12.1 // indirect
-	github.com/klauspost/compress v1.12.3 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	go.opencensus.io v0.22.5 // indirect
 	golang.org/x/net v0.43.0 // indirect
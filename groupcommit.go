@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultGroupCommitBatch = 256
+
+// groupCommitConfig is the "group_commit" section of the open options.
+type groupCommitConfig struct {
+	// MaxBatch caps the operations committed together.
+	MaxBatch int `json:"max_batch,omitempty"`
+	// MaxDelay is how long, as a Go duration string, a batch waits for more
+	// writes to arrive. By default a batch takes only the writes that queued
+	// while the previous one was committing.
+	MaxDelay string `json:"max_delay,omitempty"`
+}
+
+func (c *groupCommitConfig) settings() (int, time.Duration, error) {
+	batch := c.MaxBatch
+	if batch == 0 {
+		batch = defaultGroupCommitBatch
+	}
+	if batch < 1 {
+		return 0, 0, fmt.Errorf("group_commit max_batch must be positive, got %d", batch)
+	}
+	var delay time.Duration
+	if c.MaxDelay != "" {
+		var err error
+		if delay, err = time.ParseDuration(c.MaxDelay); err != nil {
+			return 0, 0, fmt.Errorf("invalid max_delay: %w", err)
+		}
+	}
+	return batch, delay, nil
+}
+
+// startGroupCommit routes a new handle's writes through a coalescing queue.
+func startGroupCommit(id uintptr, store kvStore, maxBatch int, maxDelay time.Duration) {
+	q := newWriteQueue()
+	q.grouped, q.maxBatch, q.maxDelay = true, maxBatch, maxDelay
+
+	asyncMu.Lock()
+	writeQueues[id] = q
+	asyncMu.Unlock()
+	go q.run(store)
+}
+
+// groupCommitQueue returns the handle's queue if it has group commit on.
+func groupCommitQueue(id uintptr) *writeQueue {
+	asyncMu.Lock()
+	defer asyncMu.Unlock()
+	if q := writeQueues[id]; q != nil && q.grouped {
+		return q
+	}
+	return nil
+}
+
+// write queues a synchronous write and waits for its batch to commit.
+func (q *writeQueue) write(ops []operation) error {
+	f := &future{done: make(chan struct{})}
+	if err := q.submit(&asyncWrite{ops: ops, fut: f}); err != nil {
+		return err
+	}
+	<-f.done
+	return f.err
+}
+
+// collect gathers writes to commit alongside first, until the batch holds
+// maxBatch operations, the queue runs dry or maxDelay passes.
+func (q *writeQueue) collect(first *asyncWrite) []*asyncWrite {
+	batch := []*asyncWrite{first}
+	size := len(first.ops)
+	var deadline <-chan time.Time
+	if q.maxDelay > 0 && size < q.maxBatch {
+		timer := time.NewTimer(q.maxDelay)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for size < q.maxBatch {
+		var (
+			req *asyncWrite
+			ok  bool
+		)
+		if deadline == nil {
+			select {
+			case req, ok = <-q.requests:
+			default:
+				return batch
+			}
+		} else {
+			select {
+			case req, ok = <-q.requests:
+			case <-deadline:
+				return batch
+			}
+		}
+		if !ok {
+			return batch
+		}
+		batch = append(batch, req)
+		size += len(req.ops)
+	}
+	return batch
+}
+
+// commit applies a batch in one Apply. If that fails, each write is retried
+// on its own so one bad write does not fail the others.
+func (q *writeQueue) commit(store kvStore, batch []*asyncWrite) {
+	if len(batch) > 1 {
+		var ops []operation
+		for _, req := range batch {
+			ops = append(ops, req.ops...)
+		}
+		if err := safeApply(store, ops); err == nil {
+			for _, req := range batch {
+				req.complete(nil)
+			}
+			return
+		}
+	}
+	for _, req := range batch {
+		req.complete(safeApply(store, req.ops))
+	}
+}
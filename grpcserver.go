@@ -0,0 +1,567 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The gRPC server implements the skyshelve.v1.KV service in skyshelve.proto
+// directly on net/http's unencrypted HTTP/2, with the few protobuf messages
+// it needs encoded by hand, so it adds no dependencies to the library.
+
+const grpcServicePrefix = "/skyshelve.v1.KV/"
+
+// gRPC status codes.
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcNotFound          = 5
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+var (
+	grpcMu      sync.Mutex
+	grpcServers = make(map[uintptr]*listenerServer)
+)
+
+// grpcError is a failed call's status.
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+func grpcErrorf(code int, format string, args ...any) error {
+	return &grpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// grpcStatusOf maps an error onto a gRPC status.
+func grpcStatusOf(err error) (int, string) {
+	var ge *grpcError
+	switch {
+	case err == nil:
+		return grpcOK, ""
+	case errors.As(err, &ge):
+		return ge.code, ge.msg
+	case isNotFound(err):
+		return grpcNotFound, err.Error()
+	}
+	return grpcInternal, err.Error()
+}
+
+// grpcEscape percent-encodes a status message as the gRPC spec requires.
+func grpcEscape(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// pbField is one decoded protobuf field.
+type pbField struct {
+	num   int
+	wire  int
+	value uint64
+	bytes []byte
+}
+
+// pbDecode splits a protobuf message into its fields.
+func pbDecode(msg []byte) ([]pbField, error) {
+	var fields []pbField
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errors.New("malformed protobuf tag")
+		}
+		msg = msg[n:]
+		f := pbField{num: int(tag >> 3), wire: int(tag & 7)}
+		switch f.wire {
+		case 0:
+			if f.value, n = binary.Uvarint(msg); n <= 0 {
+				return nil, errors.New("malformed protobuf varint")
+			}
+			msg = msg[n:]
+		case 1, 5:
+			size := 8
+			if f.wire == 5 {
+				size = 4
+			}
+			if len(msg) < size {
+				return nil, errors.New("truncated protobuf field")
+			}
+			msg = msg[size:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return nil, errors.New("truncated protobuf field")
+			}
+			f.bytes = msg[n : n+int(size)]
+			msg = msg[n+int(size):]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", f.wire)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func pbAppendBytes(buf []byte, num int, b []byte) []byte {
+	if len(b) == 0 {
+		return buf
+	}
+	buf = binary.AppendUvarint(buf, uint64(num)<<3|2)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func pbAppendVarint(buf []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = binary.AppendUvarint(buf, uint64(num)<<3)
+	return binary.AppendUvarint(buf, v)
+}
+
+// grpcStream reads request messages from and writes response messages to
+// one call.
+type grpcStream struct {
+	w http.ResponseWriter
+	r *http.Request
+}
+
+func (s *grpcStream) recv() ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(s.r.Body, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > httpMaxBody {
+		return nil, grpcErrorf(grpcResourceExhausted, "message of %d bytes is too large", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(s.r.Body, msg); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "truncated message: %v", err)
+	}
+	return msg, nil
+}
+
+// recvOne reads the single request message of a unary or server-streaming
+// call.
+func (s *grpcStream) recvOne() ([]pbField, error) {
+	msg, err := s.recv()
+	if err == io.EOF {
+		return nil, grpcErrorf(grpcInvalidArgument, "missing request message")
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields, err := pbDecode(msg)
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	return fields, nil
+}
+
+func (s *grpcStream) send(msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	if _, err := s.w.Write(append(frame, msg...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(s.w).Flush()
+}
+
+// grpcMethod runs one call, sending its responses on s.
+type grpcMethod func(id uintptr, store kvStore, s *grpcStream) error
+
+var grpcMethods = map[string]grpcMethod{
+	"Get":    grpcGet,
+	"Put":    grpcPut,
+	"Delete": grpcDelete,
+	"Apply":  grpcApply,
+	"Scan":   grpcScan,
+	"Watch":  grpcWatch,
+}
+
+func grpcGet(_ uintptr, store kvStore, s *grpcStream) error {
+	fields, err := s.recvOne()
+	if err != nil {
+		return err
+	}
+	var key []byte
+	for _, f := range fields {
+		if f.num == 1 {
+			key = f.bytes
+		}
+	}
+	if reservedKey(key) {
+		return grpcErrorf(grpcNotFound, "key not found")
+	}
+	value, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	return s.send(pbAppendBytes(nil, 1, value))
+}
+
+func grpcPut(id uintptr, store kvStore, s *grpcStream) error {
+	fields, err := s.recvOne()
+	if err != nil {
+		return err
+	}
+	var (
+		key, value []byte
+		ttl        time.Duration
+	)
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			key = f.bytes
+		case 2:
+			value = f.bytes
+		case 3:
+			ms := int64(f.value)
+			if ms > int64(maxTTL/time.Millisecond) {
+				return grpcErrorf(grpcInvalidArgument, "%v", errTTLTooLong)
+			}
+			ttl = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if reservedKey(key) {
+		return grpcErrorf(grpcInvalidArgument, "%v", errReservedKey)
+	}
+	if err := setWithTTL(store, key, value, ttl); err != nil {
+		return err
+	}
+	return s.send(nil)
+}
+
+func grpcDelete(id uintptr, store kvStore, s *grpcStream) error {
+	fields, err := s.recvOne()
+	if err != nil {
+		return err
+	}
+	var key []byte
+	for _, f := range fields {
+		if f.num == 1 {
+			key = f.bytes
+		}
+	}
+	if reservedKey(key) {
+		return grpcErrorf(grpcInvalidArgument, "%v", errReservedKey)
+	}
+	if err := store.Delete(key); err != nil {
+		return err
+	}
+	return s.send(nil)
+}
+
+func grpcApply(id uintptr, store kvStore, s *grpcStream) error {
+	fields, err := s.recvOne()
+	if err != nil {
+		return err
+	}
+	var ops []operation
+	for _, f := range fields {
+		if f.num != 1 {
+			continue
+		}
+		opFields, err := pbDecode(f.bytes)
+		if err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+		var op operation
+		for _, of := range opFields {
+			switch of.num {
+			case 1:
+				if of.value > uint64(opDelete) {
+					return grpcErrorf(grpcInvalidArgument, "unknown op type %d", of.value)
+				}
+				op.op = byte(of.value)
+			case 2:
+				op.key = of.bytes
+			case 3:
+				op.value = of.bytes
+			}
+		}
+		if reservedKey(op.key) {
+			return grpcErrorf(grpcInvalidArgument, "%v", errReservedKey)
+		}
+		ops = append(ops, op)
+	}
+	if err := store.Apply(ops); err != nil {
+		return err
+	}
+	return s.send(nil)
+}
+
+func grpcScan(_ uintptr, store kvStore, s *grpcStream) error {
+	fields, err := s.recvOne()
+	if err != nil {
+		return err
+	}
+	var (
+		prefix, from []byte
+		limit        int
+	)
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			prefix = f.bytes
+		case 2:
+			from = f.bytes
+		case 3:
+			limit = int(int32(f.value))
+		}
+	}
+	// from only moves the start within the prefix, never before it.
+	start, end := prefixRange(prefix)
+	if bytes.Compare(from, start) > 0 {
+		start = from
+	}
+	start, end, ok := userRange(start, end)
+	if !ok {
+		return nil
+	}
+	n := 0
+	err = store.IterateRange(start, end, func(k, v []byte) error {
+		if limit > 0 && n == limit {
+			return errStopIteration
+		}
+		n++
+		return s.send(pbAppendBytes(pbAppendBytes(nil, 1, k), 2, v))
+	})
+	if errors.Is(err, errStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// grpcWatch opens a watch for each prefix the client sends and streams the
+// events of all of them until the call ends.
+func grpcWatch(id uintptr, store kvStore, s *grpcStream) error {
+	wt, ok := watcherOf(store)
+	if !ok {
+		return grpcErrorf(grpcUnimplemented, "%v", errWatchUnsupported)
+	}
+	ctx, cancel := context.WithCancel(s.r.Context())
+	defer cancel()
+	events := make(chan watchEvent)
+	failed := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+		cancel()
+	}
+
+	// The reader is not waited for: it is blocked on the request body until
+	// the handler returns. Each watch goroutine ends with ctx.
+	go func() {
+		for {
+			msg, err := s.recv()
+			if err == io.EOF || ctx.Err() != nil {
+				// A half-closed request stream keeps the watches running.
+				return
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+			var prefix []byte
+			fields, err := pbDecode(msg)
+			if err != nil {
+				fail(grpcErrorf(grpcInvalidArgument, "%v", err))
+				return
+			}
+			for _, f := range fields {
+				if f.num == 1 {
+					prefix = append([]byte(nil), f.bytes...)
+				}
+			}
+			w := newWatch(id, prefix)
+			if err := wt.Watch(w); err != nil {
+				fail(err)
+				return
+			}
+			go func() {
+				defer w.close()
+				for {
+					select {
+					case ev := <-w.events:
+						if w.overflowed.Load() {
+							fail(grpcErrorf(grpcResourceExhausted, "%v", errWatchOverflow))
+							return
+						}
+						select {
+						case events <- ev:
+						case <-ctx.Done():
+							return
+						}
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			msg := pbAppendVarint(nil, 1, uint64(ev.op))
+			msg = pbAppendBytes(pbAppendBytes(msg, 2, ev.key), 3, ev.value)
+			if err := s.send(msg); err != nil {
+				cancel()
+				return err
+			}
+		case err := <-failed:
+			return err
+		case <-ctx.Done():
+			select {
+			case err := <-failed:
+				return err
+			default:
+				return nil
+			}
+		}
+	}
+}
+
+// newGRPCHandler serves the KV service for the store handle id, requiring
+// "authorization: Bearer token" metadata when token is not empty.
+func newGRPCHandler(id uintptr, token string) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Accept-Encoding", "identity")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		code, msg := grpcOK, ""
+		defer func() {
+			w.Header().Set("Grpc-Status", strconv.Itoa(code))
+			if msg != "" {
+				w.Header().Set("Grpc-Message", grpcEscape(msg))
+			}
+		}()
+		w.WriteHeader(http.StatusOK)
+		http.NewResponseController(w).Flush()
+		stream := &grpcStream{w: w, r: r}
+		// reject fails the call without running it. The request message is
+		// read first, as ending the stream while a unary client is still
+		// sending resets it instead of delivering the status.
+		reject := func(c int, m string) {
+			stream.recv()
+			code, msg = c, m
+		}
+
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			reject(grpcUnauthenticated, "missing or invalid bearer token")
+			return
+		}
+		method, ok := grpcMethods[strings.TrimPrefix(r.URL.Path, grpcServicePrefix)]
+		if !ok || !strings.HasPrefix(r.URL.Path, grpcServicePrefix) {
+			reject(grpcUnimplemented, fmt.Sprintf("unknown method %s", r.URL.Path))
+			return
+		}
+		store, err := getHandle(id)
+		if err != nil {
+			reject(grpcUnavailable, err.Error())
+			return
+		}
+		code, msg = grpcStatusOf(method(id, store, stream))
+	})
+}
+
+// stopGRPCServerFor shuts down the gRPC server serving handle id, if any.
+func stopGRPCServerFor(id uintptr) error {
+	grpcMu.Lock()
+	srv, ok := grpcServers[id]
+	delete(grpcServers, id)
+	grpcMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return srv.Close()
+}
+
+// StartGRPCServer serves the skyshelve.v1.KV gRPC service (see
+// skyshelve.proto) for the store behind handle on addr, over plaintext
+// HTTP/2, until StopGRPCServer or Close. Calls share the handle with the C
+// API, so its write callbacks, indexes and change log see their writes. When
+// authToken is not empty every call needs "authorization: Bearer
+// <authToken>" metadata.
+//
+//export StartGRPCServer
+func StartGRPCServer(handle C.uintptr_t, addr *C.char, authToken *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	if _, err := getHandle(id); err != nil {
+		return setHandleError(id, err)
+	}
+	var token string
+	if authToken != nil {
+		token = C.GoString(authToken)
+	}
+	grpcMu.Lock()
+	defer grpcMu.Unlock()
+	if _, ok := grpcServers[id]; ok {
+		return setHandleError(id, errors.New("a gRPC server is already running for this handle"))
+	}
+	ln, err := net.Listen("tcp", C.GoString(addr))
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{Handler: newGRPCHandler(id, token), Protocols: &protocols, ReadHeaderTimeout: 10 * time.Second}
+	grpcServers[id] = serveInBackground(srv, ln)
+	return setHandleError(id, nil)
+}
+
+//export StopGRPCServer
+func StopGRPCServer(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	grpcMu.Lock()
+	_, ok := grpcServers[id]
+	grpcMu.Unlock()
+	if !ok {
+		return setHandleError(id, errors.New("no gRPC server is running for this handle"))
+	}
+	return setHandleError(id, stopGRPCServerFor(id))
+}
@@ -0,0 +1,145 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// handleInfo describes an open store handle for ListHandles.
+type handleInfo struct {
+	ID       uintptr `json:"id"`
+	Backend  string  `json:"backend"`
+	Path     string  `json:"path,omitempty"`
+	InMemory bool    `json:"in_memory,omitempty"`
+	// SnapshotOf is the store a snapshot handle was taken from, and
+	// BucketOf the one a bucket handle was opened from.
+	SnapshotOf uintptr   `json:"snapshot_of,omitempty"`
+	Bucket     string    `json:"bucket,omitempty"`
+	BucketOf   uintptr   `json:"bucket_of,omitempty"`
+	OpenedAt   time.Time `json:"opened_at"`
+}
+
+var (
+	handleInfoMu sync.Mutex
+	handleInfos  = make(map[uintptr]handleInfo)
+)
+
+func describeHandle(id uintptr, info handleInfo) {
+	info.ID = id
+	info.OpenedAt = time.Now().UTC()
+	handleInfoMu.Lock()
+	defer handleInfoMu.Unlock()
+	handleInfos[id] = info
+}
+
+func forgetHandleInfo(id uintptr) {
+	handleInfoMu.Lock()
+	defer handleInfoMu.Unlock()
+	delete(handleInfos, id)
+}
+
+func lookupHandleInfo(id uintptr) (handleInfo, bool) {
+	handleInfoMu.Lock()
+	defer handleInfoMu.Unlock()
+	info, ok := handleInfos[id]
+	return info, ok
+}
+
+// describeOpen names the backend and location an Open path refers to.
+func describeOpen(raw string, inMemory bool) handleInfo {
+	raw = strings.TrimSpace(raw)
+	if _, ok := lookupBackend(raw); ok {
+		scheme, rest, _ := strings.Cut(raw, ":")
+		return handleInfo{Backend: strings.ToLower(scheme), Path: displayPath(strings.TrimPrefix(rest, "//"))}
+	}
+	if inMemory {
+		return handleInfo{Backend: "badger", InMemory: true}
+	}
+	if raw == "" {
+		raw = defaultDataDir("badger")
+	}
+	return handleInfo{Backend: "badger", Path: raw}
+}
+
+// displayPath strips what could carry credentials from a location: JSON
+// configs are reduced to their path, and URLs lose user info and queries.
+func displayPath(p string) string {
+	if strings.HasPrefix(p, "{") {
+		var cfg struct {
+			Path string `json:"path"`
+		}
+		_ = json.Unmarshal([]byte(p), &cfg)
+		return cfg.Path
+	}
+	p, _, _ = strings.Cut(p, "?")
+	if at := strings.IndexByte(p, '@'); at >= 0 && !strings.Contains(p[:at], "/") {
+		p = p[at+1:]
+	}
+	return p
+}
+
+// describeOptions names the backend and location of an OpenWithOptions store.
+func describeOptions(opts *openOptions) handleInfo {
+	info := handleInfo{Backend: strings.ToLower(opts.Backend), Path: opts.Path, InMemory: opts.InMemory}
+	if info.Backend == "" {
+		info.Backend = "badger"
+	}
+	switch {
+	case info.Path != "":
+	case opts.SlateDB != nil:
+		info.Path = opts.SlateDB.Path
+	case opts.LMDB != nil:
+		info.Path = opts.LMDB.Path
+	}
+	info.Path = displayPath(info.Path)
+	return info
+}
+
+// ListHandles returns a JSON array describing every open store, snapshot and
+// bucket handle (id, backend, path, in_memory, snapshot_of, bucket,
+// bucket_of, opened_at), ordered by id, for the host to release with
+// FreeCString. Long-running hosts can use it to find handles they leaked.
+//
+//export ListHandles
+func ListHandles() (ret *C.char) {
+	defer recoverExport(0, &ret, nil)
+	stores := loadHandles()
+	list := make([]handleInfo, 0, len(stores))
+	for id := range stores {
+		info, ok := lookupHandleInfo(id)
+		if !ok {
+			info = handleInfo{ID: id, Backend: "unknown"}
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	doc, err := json.Marshal(list)
+	if err != nil {
+		setError(err)
+		return nil
+	}
+	setError(nil)
+	return C.CString(string(doc))
+}
+
+// IsOpen returns 1 if handle is an open store or snapshot handle and 0
+// otherwise. It does not touch the recorded error state.
+//
+//export IsOpen
+func IsOpen(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, 0)
+	if _, err := getHandle(uintptr(handle)); err != nil {
+		return 0
+	}
+	return 1
+}
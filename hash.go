@@ -0,0 +1,128 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"time"
+	"unsafe"
+)
+
+// A hash keeps each field as its own key: hashPrefix, the hash's u32
+// length-prefixed name, then the field, holding the field's value. Fields
+// are read and written individually, never by rewriting the whole hash.
+var hashPrefix = []byte("\xffhash/")
+
+func hashBase(name []byte) []byte {
+	return appendLenPrefixed(append([]byte(nil), hashPrefix...), name)
+}
+
+func hashFieldKey(name, field []byte) []byte {
+	return append(hashBase(name), field...)
+}
+
+// hashExport decodes the hash name and field arguments shared by the field
+// exports.
+func hashExport(handle C.uintptr_t, key *C.char, keyLen C.int, field *C.char, fieldLen C.int) (kvStore, []byte, error) {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return nil, nil, err
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	gotField := C.GoBytes(unsafe.Pointer(field), fieldLen)
+	return store, hashFieldKey(gotKey, gotField), nil
+}
+
+// HSet stores value in field of the hash named by key.
+//
+//export HSet
+func HSet(handle C.uintptr_t, key *C.char, keyLen C.int, field *C.char, fieldLen C.int, value *C.char, valueLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "hset", time.Now())
+	store, fieldKey, err := hashExport(handle, key, keyLen, field, fieldLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotValue := C.GoBytes(unsafe.Pointer(value), valueLen)
+	return setHandleError(uintptr(handle), store.Set(fieldKey, gotValue))
+}
+
+// HGet returns the value of field in the hash named by key, or NULL with the
+// not-found status. Release it with FreeBuffer.
+//
+//export HGet
+func HGet(handle C.uintptr_t, key *C.char, keyLen C.int, field *C.char, fieldLen C.int, valueLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "hget", time.Now())
+	store, fieldKey, err := hashExport(handle, key, keyLen, field, fieldLen)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	data, err := store.Get(fieldKey)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	buf, err := returnValue(data, valueLen)
+	setHandleError(uintptr(handle), err)
+	return buf
+}
+
+// HDel removes field from the hash named by key. Removing a missing field is
+// not an error.
+//
+//export HDel
+func HDel(handle C.uintptr_t, key *C.char, keyLen C.int, field *C.char, fieldLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "hdel", time.Now())
+	store, fieldKey, err := hashExport(handle, key, keyLen, field, fieldLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), store.Delete(fieldKey))
+}
+
+// HGetAll returns every field of the hash named by key, in field order,
+// using Scan's framing with fields as keys. A missing hash is empty. Release
+// the result with FreeBuffer.
+//
+//export HGetAll
+func HGetAll(handle C.uintptr_t, key *C.char, keyLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "hgetall", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	base := hashBase(C.GoBytes(unsafe.Pointer(key), keyLen))
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	err = store.Iterate(base, func(k, v []byte) error {
+		buffer = appendEntry(buffer, k[len(base):], v)
+		return nil
+	})
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
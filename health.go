@@ -0,0 +1,63 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"time"
+
+	slatedb "slatedb.io/slatedb-go"
+)
+
+// pingKey is read by Ping. It never holds a value, so the read exercises the
+// full lookup path down to the backend and comes back a miss.
+var pingKey = []byte("\xffskyshelve/ping")
+
+// pinger is implemented by backends that can answer reads from memory
+// without touching their durable storage, and so need a different probe.
+type pinger interface {
+	ping() error
+}
+
+func pingStore(store kvStore) error {
+	if p, ok := backendOf(store).(pinger); ok {
+		return p.ping()
+	}
+	_, err := store.Get(pingKey)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Ping checks that handle can still serve reads by looking up a reserved key
+// and returns the round trip in microseconds, or a negative status code, for
+// readiness probes. SlateDB may answer that lookup from its memtable or
+// block cache, so there Ping writes a durable tombstone for the key instead,
+// which only returns once the object store has accepted it.
+//
+//export Ping
+func Ping(handle C.uintptr_t) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "ping", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	start := time.Now()
+	if err := pingStore(store); err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	elapsed := time.Since(start)
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(elapsed.Microseconds())
+}
+
+// ping deletes pingKey and waits for the tombstone to be uploaded. The key
+// never exists, so skipping watchers and snapshots changes nothing they see.
+func (s *slateStore) ping() error {
+	return s.db.DeleteWithOptions(pingKey, &slatedb.WriteOptions{AwaitDurable: true})
+}
@@ -0,0 +1,266 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// httpMaxBody bounds request bodies, so a stray upload cannot exhaust
+	// the host's memory.
+	httpMaxBody = 64 << 20
+	// httpScanLimit is the page size of /scan when no limit is given.
+	httpScanLimit = 1000
+)
+
+var (
+	httpMu      sync.Mutex
+	httpServers = make(map[uintptr]*listenerServer)
+)
+
+// httpEntry is one key-value pair in /scan responses and /batch requests.
+// encoding/json carries the bytes as base64.
+type httpEntry struct {
+	Op    string `json:"op,omitempty"`
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+type httpScanPage struct {
+	Entries []httpEntry `json:"entries"`
+	// Next is the query-escaped start key of the following page.
+	Next string `json:"next,omitempty"`
+}
+
+// httpStatus maps a store error onto a response status.
+func httpStatus(err error) int {
+	if isNotFound(err) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// newHTTPHandler serves the key-value routes for the store handle id,
+// requiring "Authorization: Bearer token" when token is not empty.
+func newHTTPHandler(id uintptr, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /keys/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		store, err := getHandle(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		key := []byte(r.PathValue("key"))
+		if reservedKey(key) {
+			http.NotFound(w, r)
+			return
+		}
+		value, err := store.Get(key)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(value)
+	})
+	mux.HandleFunc("PUT /keys/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		store, err := getHandle(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		key := []byte(r.PathValue("key"))
+		if reservedKey(key) {
+			http.Error(w, errReservedKey.Error(), http.StatusBadRequest)
+			return
+		}
+		var ttl time.Duration
+		if raw := r.URL.Query().Get("ttl"); raw != "" {
+			if ttl, err = time.ParseDuration(raw); err != nil {
+				http.Error(w, fmt.Sprintf("invalid ttl: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := setWithTTL(store, key, value, ttl); err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /keys/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		store, err := getHandle(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		key := []byte(r.PathValue("key"))
+		if reservedKey(key) {
+			http.Error(w, errReservedKey.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := store.Delete(key); err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /scan", func(w http.ResponseWriter, r *http.Request) {
+		store, err := getHandle(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		q := r.URL.Query()
+		limit := httpScanLimit
+		if raw := q.Get("limit"); raw != "" {
+			if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+		prefix := []byte(q.Get("prefix"))
+		start, end := prefixRange(prefix)
+		if from := []byte(q.Get("start")); bytes.Compare(from, start) > 0 {
+			start = from
+		}
+		page := httpScanPage{Entries: []httpEntry{}}
+		if start, end, ok := userRange(start, end); ok {
+			err = store.IterateRange(start, end, func(k, v []byte) error {
+				if len(page.Entries) == limit {
+					page.Next = url.QueryEscape(string(k))
+					return errStopIteration
+				}
+				page.Entries = append(page.Entries, httpEntry{Key: append([]byte(nil), k...), Value: append([]byte(nil), v...)})
+				return nil
+			})
+		}
+		if err != nil && !errors.Is(err, errStopIteration) {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	})
+	mux.HandleFunc("POST /batch", func(w http.ResponseWriter, r *http.Request) {
+		store, err := getHandle(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		var entries []httpEntry
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, httpMaxBody)).Decode(&entries); err != nil {
+			http.Error(w, fmt.Sprintf("invalid batch: %v", err), http.StatusBadRequest)
+			return
+		}
+		ops := make([]operation, len(entries))
+		for i, e := range entries {
+			if reservedKey(e.Key) {
+				http.Error(w, fmt.Sprintf("invalid batch: %v", errReservedKey), http.StatusBadRequest)
+				return
+			}
+			switch e.Op {
+			case "set":
+				ops[i] = operation{op: opSet, key: e.Key, value: e.Value}
+			case "delete":
+				ops[i] = operation{op: opDelete, key: e.Key}
+			default:
+				http.Error(w, fmt.Sprintf("invalid batch: unknown op %q", e.Op), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := store.Apply(ops); err != nil {
+			http.Error(w, err.Error(), httpStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if token == "" {
+		return mux
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// stopHTTPServerFor shuts down the HTTP server serving handle id, if any.
+func stopHTTPServerFor(id uintptr) error {
+	httpMu.Lock()
+	srv, ok := httpServers[id]
+	delete(httpServers, id)
+	httpMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return srv.Close()
+}
+
+// StartHTTPServer serves the store behind handle over HTTP on addr until
+// StopHTTPServer or Close: GET, PUT (with an optional ?ttl=30s) and
+// DELETE on /keys/{key}, GET /scan?prefix=&start=&limit= returning a page of
+// base64 entries, and POST /batch applying a JSON array of
+// {"op": "set"|"delete", "key", "value"} atomically. When authToken is not
+// empty every request needs "Authorization: Bearer <authToken>".
+//
+//export StartHTTPServer
+func StartHTTPServer(handle C.uintptr_t, addr *C.char, authToken *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	if _, err := getHandle(id); err != nil {
+		return setHandleError(id, err)
+	}
+	var token string
+	if authToken != nil {
+		token = C.GoString(authToken)
+	}
+	httpMu.Lock()
+	defer httpMu.Unlock()
+	if _, ok := httpServers[id]; ok {
+		return setHandleError(id, errors.New("an HTTP server is already running for this handle"))
+	}
+	ln, err := net.Listen("tcp", C.GoString(addr))
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	httpServers[id] = serveInBackground(&http.Server{Handler: newHTTPHandler(id, token), ReadHeaderTimeout: 10 * time.Second}, ln)
+	return setHandleError(id, nil)
+}
+
+//export StopHTTPServer
+func StopHTTPServer(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	httpMu.Lock()
+	_, ok := httpServers[id]
+	httpMu.Unlock()
+	if !ok {
+		return setHandleError(id, errors.New("no HTTP server is running for this handle"))
+	}
+	return setHandleError(id, stopHTTPServerFor(id))
+}
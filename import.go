@@ -0,0 +1,35 @@
+package main
+
+import "time"
+
+// importWriter applies the entries of a foreign database as they are read,
+// restoreBatchSize at a time, so imports never hold a whole source in
+// memory.
+type importWriter struct {
+	store kvStore
+	ops   []operation
+}
+
+// set queues key for writing, with a TTL when ttl is positive.
+func (w *importWriter) set(key, value []byte, ttl time.Duration) error {
+	op := operation{op: opSet, key: key, value: value}
+	if ttl > 0 {
+		op.op, op.ttl = opSetTTL, ttl
+	}
+	w.ops = append(w.ops, op)
+	if len(w.ops) < restoreBatchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *importWriter) flush() error {
+	if len(w.ops) == 0 {
+		return nil
+	}
+	if err := w.store.Apply(w.ops); err != nil {
+		return err
+	}
+	w.ops = w.ops[:0]
+	return nil
+}
@@ -0,0 +1,859 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+typedef const char *(*skyshelve_index_cb)(void *user_data, const char *key, int key_len, const char *value, int value_len, int *out_len);
+
+static inline const char *skyshelve_call_index_cb(skyshelve_index_cb cb, void *user_data, const char *key, int key_len, const char *value, int value_len, int *out_len) {
+	return cb(user_data, key, key_len, value, value_len, out_len);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Index definitions live under indexDefPrefix as JSON, one per name. An index
+// entry is indexEntryPrefix, the index name and the indexed value, each as a
+// big-endian u32 length and its bytes, then the primary key, with an empty
+// value (a text index stores the term's count there instead), so the keys
+// holding a value are one prefix scan away.
+var (
+	indexDefPrefix   = []byte("\xffidx/def/")
+	indexEntryPrefix = []byte("\xffidx/ent/")
+)
+
+// indexBatchSize bounds how many primary keys a backfill reads per write.
+const indexBatchSize = 1000
+
+var errNoIndexes = errors.New("the store was not opened with indexes")
+
+// reservedKey reports whether key is in the 0xff keyspace the library keeps
+// its own records in. Those keys are never indexed.
+func reservedKey(key []byte) bool {
+	return len(key) > 0 && key[0] == 0xff
+}
+
+// reservedStart is the first key of the reserved keyspace.
+var reservedStart = []byte{0xff}
+
+func appendLenPrefixed(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+	return append(buf, b...)
+}
+
+func indexEntryBase(name string) []byte {
+	return appendLenPrefixed(append([]byte(nil), indexEntryPrefix...), []byte(name))
+}
+
+func indexValuePrefix(name string, value []byte) []byte {
+	return appendLenPrefixed(indexEntryBase(name), value)
+}
+
+func indexDefKey(name string) []byte {
+	return append(append([]byte(nil), indexDefPrefix...), name...)
+}
+
+// indexDef is the stored form of an index, as listed by ListIndexes.
+// Callback indexes are never stored.
+type indexDef struct {
+	Name     string       `json:"name"`
+	JSONPath string       `json:"json_path,omitempty"`
+	Callback bool         `json:"callback,omitempty"`
+	Text     *textOptions `json:"text,omitempty"`
+}
+
+// indexCallback is a host function registered with CreateIndexCallback.
+type indexCallback struct {
+	fn       C.skyshelve_index_cb
+	userData unsafe.Pointer
+}
+
+// secondaryIndex derives index values from a primary value, either by
+// following a JSON path or by asking a host callback.
+type secondaryIndex struct {
+	def      indexDef
+	path     []string
+	callback *indexCallback
+}
+
+// parseJSONPath splits a path such as "$.user.tags[0]" into its segments.
+// The leading "$" is optional; an empty path names the whole document.
+func parseJSONPath(raw string) ([]string, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(raw), "$")
+	p = strings.TrimPrefix(p, ".")
+	if p == "" {
+		return nil, nil
+	}
+	var segs []string
+	for _, part := range strings.Split(p, ".") {
+		field, rest, bracket := strings.Cut(part, "[")
+		if bracket && rest == "" {
+			return nil, fmt.Errorf("invalid json path %q", raw)
+		}
+		if field != "" {
+			segs = append(segs, field)
+		}
+		for rest != "" {
+			idx, tail, ok := strings.Cut(rest, "]")
+			if _, err := strconv.Atoi(idx); !ok || err != nil || (tail != "" && tail[0] != '[') {
+				return nil, fmt.Errorf("invalid json path %q", raw)
+			}
+			segs = append(segs, idx)
+			rest = strings.TrimPrefix(tail, "[")
+		}
+		if field == "" && !strings.Contains(part, "[") {
+			return nil, fmt.Errorf("invalid json path %q", raw)
+		}
+	}
+	return segs, nil
+}
+
+func followJSONPath(doc any, path []string) any {
+	for _, seg := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			doc = node[seg]
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			doc = node[i]
+		default:
+			return nil
+		}
+	}
+	return doc
+}
+
+// jsonScalar renders a JSON string as its text and numbers and booleans as
+// they are written, reporting false for anything else.
+func jsonScalar(v any) ([]byte, bool) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), true
+	case json.Number:
+		return []byte(v.String()), true
+	case bool:
+		return []byte(strconv.FormatBool(v)), true
+	}
+	return nil, false
+}
+
+// values returns the distinct index values for a primary entry. A JSON path
+// that ends on an array indexes each scalar element; values that are not
+// JSON, or lack the path, are not indexed. A leading Python wrapper tag is
+// skipped; see pythonTagLen.
+func (ix *secondaryIndex) values(key, value []byte) [][]byte {
+	if ix.callback != nil {
+		var outLen C.int
+		out := C.skyshelve_call_index_cb(ix.callback.fn, ix.callback.userData, bytesPtr(key), C.int(len(key)), bytesPtr(value), C.int(len(value)), &outLen)
+		if out == nil {
+			return nil
+		}
+		return [][]byte{C.GoBytes(unsafe.Pointer(out), outLen)}
+	}
+	dec := json.NewDecoder(bytes.NewReader(value[pythonTagLen(value):]))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil
+	}
+	node := followJSONPath(doc, ix.path)
+	if v, ok := jsonScalar(node); ok {
+		return [][]byte{v}
+	}
+	list, ok := node.([]any)
+	if !ok {
+		return nil
+	}
+	var out [][]byte
+	seen := make(map[string]bool, len(list))
+	for _, elem := range list {
+		if v, ok := jsonScalar(elem); ok && !seen[string(v)] {
+			seen[string(v)] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// indexEntry is one index value for a primary key, with the payload its
+// entry stores.
+type indexEntry struct {
+	value   []byte
+	payload []byte
+}
+
+// entries returns the index entries for a primary entry. Only text indexes
+// store a payload.
+func (ix *secondaryIndex) entries(key, value []byte) []indexEntry {
+	if ix.def.Text != nil {
+		return ix.textEntries(key, value)
+	}
+	vals := ix.values(key, value)
+	out := make([]indexEntry, len(vals))
+	for i, v := range vals {
+		out[i] = indexEntry{value: v}
+	}
+	return out
+}
+
+// priorValue is what a key held before a write, for finding stale entries.
+type priorValue struct {
+	value []byte
+	found bool
+}
+
+// indexStore keeps secondary index entries in inner, committing them in the
+// same batch as the primary write that produced them.
+type indexStore struct {
+	inner kvStore
+	// mu serialises writes, so the previous value read to find stale entries
+	// is still the committed one when the batch goes in.
+	mu      sync.Mutex
+	indexes map[string]*secondaryIndex
+}
+
+// newIndexStore layers index upkeep over store, resuming the JSON path
+// indexes already defined in it.
+func newIndexStore(store kvStore) (*indexStore, error) {
+	s := &indexStore{inner: store, indexes: make(map[string]*secondaryIndex)}
+	if err := s.loadDefs(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadDefs adds the stored index definitions to s.indexes. The caller holds
+// s.mu or owns s exclusively.
+func (s *indexStore) loadDefs() error {
+	return s.inner.Iterate(indexDefPrefix, func(_, v []byte) error {
+		var def indexDef
+		if err := json.Unmarshal(v, &def); err != nil {
+			return fmt.Errorf("bad index definition: %w", err)
+		}
+		path, err := parseJSONPath(def.JSONPath)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.indexes[def.Name]; !ok {
+			s.indexes[def.Name] = &secondaryIndex{def: def, path: path}
+		}
+		return nil
+	})
+}
+
+// saveDefs rewrites the definitions of the JSON path indexes, after a bulk
+// delete may have removed them. The caller holds s.mu.
+func (s *indexStore) saveDefs() error {
+	var ops []operation
+	for name, ix := range s.indexes {
+		if ix.callback != nil {
+			continue
+		}
+		raw, err := json.Marshal(ix.def)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, operation{op: opSet, key: indexDefKey(name), value: raw})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return s.inner.Apply(ops)
+}
+
+// entryOps returns the writes that move key's index entries from those of
+// prior to those of next. New entries are always rewritten so they take on
+// the TTL of the primary write.
+func (s *indexStore) entryOps(key []byte, prior, next priorValue, ttl time.Duration) []operation {
+	var ops []operation
+	for name, ix := range s.indexes {
+		var stale, fresh []indexEntry
+		if prior.found {
+			stale = ix.entries(key, prior.value)
+		}
+		if next.found {
+			fresh = ix.entries(key, next.value)
+		}
+		for _, e := range stale {
+			if !containsEntry(fresh, e.value) {
+				ops = append(ops, operation{op: opDelete, key: append(indexValuePrefix(name, e.value), key...)})
+			}
+		}
+		for _, e := range fresh {
+			op := operation{op: opSet, key: append(indexValuePrefix(name, e.value), key...), value: e.payload}
+			if ttl > 0 {
+				op.op, op.ttl = opSetTTL, ttl
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+func containsEntry(list []indexEntry, value []byte) bool {
+	for _, e := range list {
+		if bytes.Equal(e.value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// committed reads the value key holds now. The caller holds s.mu.
+func (s *indexStore) committed(key []byte) (priorValue, error) {
+	v, err := s.inner.Get(key)
+	if isNotFound(err) {
+		return priorValue{}, nil
+	}
+	if err != nil {
+		return priorValue{}, err
+	}
+	return priorValue{value: v, found: true}, nil
+}
+
+// withEntries appends the index upkeep for ops to a copy of them. Keys
+// written more than once in ops are followed through the batch. The caller
+// holds s.mu.
+func (s *indexStore) withEntries(ops []operation) ([]operation, error) {
+	if len(s.indexes) == 0 {
+		return ops, nil
+	}
+	batch := append(make([]operation, 0, 2*len(ops)), ops...)
+	current := make(map[string]priorValue)
+	for _, op := range ops {
+		if (op.op != opSet && op.op != opSetTTL && op.op != opDelete) || reservedKey(op.key) {
+			continue
+		}
+		prior, ok := current[string(op.key)]
+		if !ok {
+			var err error
+			if prior, err = s.committed(op.key); err != nil {
+				return nil, err
+			}
+		}
+		next := priorValue{value: op.value, found: op.op != opDelete}
+		current[string(op.key)] = next
+		batch = append(batch, s.entryOps(op.key, prior, next, op.ttl)...)
+	}
+	return batch, nil
+}
+
+func (s *indexStore) apply(ops []operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, err := s.withEntries(ops)
+	if err != nil {
+		return err
+	}
+	return s.inner.Apply(batch)
+}
+
+func (s *indexStore) Set(key, value []byte) error {
+	return s.apply([]operation{{op: opSet, key: key, value: value}})
+}
+
+func (s *indexStore) Delete(key []byte) error {
+	return s.apply([]operation{{op: opDelete, key: key}})
+}
+
+func (s *indexStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return s.Set(key, value)
+	}
+	if _, ok := s.inner.(ttlSetter); !ok {
+		return errors.New("TTLs are not supported by this backend")
+	}
+	return s.apply([]operation{{op: opSetTTL, key: key, value: value, ttl: ttl}})
+}
+
+func (s *indexStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+func (s *indexStore) Apply(ops []operation) error { return s.apply(ops) }
+
+func (s *indexStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, err := s.withEntries(ops)
+	if err != nil {
+		return 0, err
+	}
+	return applyDurable(s.inner, batch, level)
+}
+
+func (s *indexStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+// SetWithMeta cannot carry the meta byte in an Apply batch, so the index
+// entries follow the value in a second write.
+func (s *indexStore) SetWithMeta(key, value []byte, meta byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, err := s.withEntries([]operation{{op: opSet, key: key, value: value}})
+	if err != nil {
+		return err
+	}
+	if err := setWithMeta(s.inner, key, value, meta); err != nil {
+		return err
+	}
+	if len(batch) == 1 {
+		return nil
+	}
+	return s.inner.Apply(batch[1:])
+}
+
+func (s *indexStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	return getWithMeta(s.inner, key)
+}
+
+// DeleteRange drops the entries of each deleted key in the batch that
+// deletes it.
+func (s *indexStore) DeleteRange(start, end []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.indexes) == 0 {
+		return deleteRange(s.inner, start, end)
+	}
+	n, err := deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		err := s.inner.IterateRange(from, end, func(k, _ []byte) error {
+			if len(keys) >= deleteBatchSize {
+				return errStopIteration
+			}
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		return keys, nil
+	}, func(keys [][]byte) error {
+		ops := make([]operation, len(keys))
+		for i, k := range keys {
+			ops[i] = operation{op: opDelete, key: k}
+		}
+		batch, err := s.withEntries(ops)
+		if err != nil {
+			return err
+		}
+		return s.inner.Apply(batch)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, s.saveDefs()
+}
+
+func (s *indexStore) DropAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := dropAll(s.inner); err != nil {
+		return err
+	}
+	return s.saveDefs()
+}
+
+// Load rebuilds every index afterwards, picking up any definitions the
+// backup carried.
+func (s *indexStore) Load(r io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := restoreStore(s.inner, r); err != nil {
+		return err
+	}
+	if err := s.loadDefs(); err != nil {
+		return err
+	}
+	for _, ix := range s.indexes {
+		if err := s.rebuild(ix); err != nil {
+			return err
+		}
+	}
+	return s.saveDefs()
+}
+
+// rebuild clears ix's entries and indexes every existing primary key, a
+// batch at a time. The caller holds s.mu.
+func (s *indexStore) rebuild(ix *secondaryIndex) error {
+	base := indexEntryBase(ix.def.Name)
+	if _, err := deleteRange(s.inner, base, nextPrefix(base)); err != nil {
+		return err
+	}
+	var from []byte
+	for {
+		var (
+			ops  []operation
+			last []byte
+			n    int
+		)
+		// Reserved keys sort after every other key, so the scan stops at them.
+		err := s.inner.IterateRange(from, []byte{0xff}, func(k, v []byte) error {
+			if n == indexBatchSize {
+				return errStopIteration
+			}
+			n++
+			last = append(last[:0], k...)
+			for _, e := range ix.entries(k, v) {
+				ops = append(ops, operation{op: opSet, key: append(indexValuePrefix(ix.def.Name, e.value), k...), value: e.payload})
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return err
+		}
+		if len(ops) > 0 {
+			if err := s.inner.Apply(ops); err != nil {
+				return err
+			}
+		}
+		if n < indexBatchSize {
+			return nil
+		}
+		from = append(last, 0)
+	}
+}
+
+// createIndex builds a new index over the existing data and maintains it
+// from then on. Writes wait while it builds.
+func (s *indexStore) createIndex(ix *secondaryIndex) error {
+	name := ix.def.Name
+	if name == "" {
+		return errors.New("index name must not be empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.indexes[name]; ok {
+		return fmt.Errorf("index %q already exists", name)
+	}
+	if err := s.rebuild(ix); err != nil {
+		return err
+	}
+	s.indexes[name] = ix
+	if ix.callback != nil {
+		return nil
+	}
+	raw, err := json.Marshal(ix.def)
+	if err != nil {
+		return err
+	}
+	return s.inner.Set(indexDefKey(name), raw)
+}
+
+func (s *indexStore) dropIndex(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.indexes[name]; !ok {
+		return fmt.Errorf("no index named %q", name)
+	}
+	delete(s.indexes, name)
+	if err := s.inner.Delete(indexDefKey(name)); err != nil && !isNotFound(err) {
+		return err
+	}
+	base := indexEntryBase(name)
+	_, err := deleteRange(s.inner, base, nextPrefix(base))
+	return err
+}
+
+func (s *indexStore) listIndexes() []indexDef {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defs := make([]indexDef, 0, len(s.indexes))
+	for _, ix := range s.indexes {
+		defs = append(defs, ix.def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// queryIndex calls fn with each primary key whose entry in the named index
+// holds value, in key order.
+func (s *indexStore) queryIndex(name string, value []byte, fn func(key []byte) error) error {
+	s.mu.Lock()
+	_, ok := s.indexes[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no index named %q", name)
+	}
+	prefix := indexValuePrefix(name, value)
+	return s.inner.Iterate(prefix, func(k, _ []byte) error {
+		return fn(k[len(prefix):])
+	})
+}
+
+func (s *indexStore) unwrap() kvStore { return s.inner }
+
+func (s *indexStore) Close() error { return s.inner.Close() }
+
+func (s *indexStore) Get(key []byte) ([]byte, error) { return s.inner.Get(key) }
+
+func (s *indexStore) Has(key []byte) (bool, error) { return hasKey(s.inner, key) }
+
+func (s *indexStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, fn)
+}
+
+func (s *indexStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, fn)
+}
+
+func (s *indexStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, fn)
+}
+
+func (s *indexStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *indexStore) Sync() error { return s.inner.Sync() }
+
+func (s *indexStore) Compact() error { return compactStore(s.inner) }
+
+func (s *indexStore) Snapshot() (kvStore, error) { return openSnapshot(s.inner) }
+
+func (s *indexStore) Stats() (storeStats, error) { return collectStats(s.inner) }
+
+func (s *indexStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+func (s *indexStore) CurrentVersion() (uint64, error) {
+	return versionsBelow{s.inner}.CurrentVersion()
+}
+
+func (s *indexStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	return versionsBelow{s.inner}.GetAt(key, version)
+}
+
+func (s *indexStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return versionsBelow{s.inner}.IterateAt(prefix, version, fn)
+}
+
+func (s *indexStore) Versions(key []byte) ([]keyVersion, error) {
+	return versionsBelow{s.inner}.Versions(key)
+}
+
+func (s *indexStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &indexTxn{txn: txn, store: s, written: make(map[string]time.Duration)}, nil
+}
+
+// indexTxn adds the index upkeep for the keys it wrote at commit time,
+// comparing what each holds in the transaction with its committed value.
+// written holds the TTL of each key's last write, which its index entries
+// take on.
+type indexTxn struct {
+	txn     kvTxn
+	store   *indexStore
+	written map[string]time.Duration
+}
+
+func (t *indexTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(key) }
+
+func (t *indexTxn) Set(key, value []byte) error {
+	t.written[string(key)] = 0
+	return t.txn.Set(key, value)
+}
+
+func (t *indexTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	t.written[string(key)] = ttl
+	return txnSetWithTTL(t.txn, key, value, ttl)
+}
+
+func (t *indexTxn) Delete(key []byte) error {
+	t.written[string(key)] = 0
+	return t.txn.Delete(key)
+}
+
+func (t *indexTxn) Commit() error {
+	s := t.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.indexes) == 0 {
+		return t.txn.Commit()
+	}
+	for k, ttl := range t.written {
+		key := []byte(k)
+		if reservedKey(key) {
+			continue
+		}
+		prior, err := s.committed(key)
+		if err != nil {
+			t.txn.Discard()
+			return err
+		}
+		v, err := t.txn.Get(key)
+		if err != nil && !isNotFound(err) {
+			t.txn.Discard()
+			return err
+		}
+		for _, op := range s.entryOps(key, prior, priorValue{value: v, found: err == nil}, ttl) {
+			if op.op == opDelete {
+				err = t.txn.Delete(op.key)
+			} else {
+				err = t.txn.Set(op.key, op.value)
+			}
+			if err != nil {
+				t.txn.Discard()
+				return err
+			}
+		}
+	}
+	return t.txn.Commit()
+}
+
+func (t *indexTxn) Discard() { t.txn.Discard() }
+
+func indexesFor(id uintptr) (*indexStore, error) {
+	store, err := getHandle(id)
+	if err != nil {
+		return nil, err
+	}
+	ix, ok := layerOf[*indexStore](store)
+	if !ok {
+		return nil, errNoIndexes
+	}
+	return ix, nil
+}
+
+// CreateIndex indexes the value at jsonPath (e.g. "$.user.email" or
+// "tags[0]") of every JSON value in the store, and keeps the index current
+// on every later write, in the same batch as the write. Strings index as
+// their text and numbers and booleans as written; a path ending on an array
+// indexes each element. The definition is stored, so the index survives
+// reopening. The store must be opened with "indexes": true.
+//
+//export CreateIndex
+func CreateIndex(handle C.uintptr_t, name *C.char, jsonPath *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	store, err := indexesFor(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	def := indexDef{Name: C.GoString(name), JSONPath: C.GoString(jsonPath)}
+	path, err := parseJSONPath(def.JSONPath)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	return setHandleError(id, store.createIndex(&secondaryIndex{def: def, path: path}))
+}
+
+// CreateIndexCallback indexes each entry under the value returned by
+// fn(userData, key, keyLen, value, valueLen, &outLen), which is copied before
+// the next call; returning NULL leaves the entry out of the index. fn runs
+// on the writing thread while writes to the store wait, and must not call
+// back into it. Callback indexes are not stored: recreate them after every
+// open, or remove their entries with DropIndex.
+//
+//export CreateIndexCallback
+func CreateIndexCallback(handle C.uintptr_t, name *C.char, fn C.skyshelve_index_cb, userData unsafe.Pointer) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	store, err := indexesFor(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	if fn == nil {
+		return setHandleError(id, errors.New("index callback must not be NULL"))
+	}
+	ix := &secondaryIndex{
+		def:      indexDef{Name: C.GoString(name), Callback: true},
+		callback: &indexCallback{fn: fn, userData: userData},
+	}
+	return setHandleError(id, store.createIndex(ix))
+}
+
+// DropIndex removes the named index and its entries.
+//
+//export DropIndex
+func DropIndex(handle C.uintptr_t, name *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	store, err := indexesFor(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	return setHandleError(id, store.dropIndex(C.GoString(name)))
+}
+
+// ListIndexes returns a JSON array of the store's indexes (name, json_path,
+// callback, text), ordered by name. Release it with FreeCString.
+//
+//export ListIndexes
+func ListIndexes(handle C.uintptr_t) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	id := uintptr(handle)
+	store, err := indexesFor(id)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	doc, err := json.Marshal(store.listIndexes())
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	setHandleError(id, nil)
+	return C.CString(string(doc))
+}
+
+// QueryIndex returns the primary keys whose entry in the named index holds
+// value, in key order, as u32 length-prefixed keys ready to pass to GetMany.
+// Release the result with FreeBuffer.
+//
+//export QueryIndex
+func QueryIndex(handle C.uintptr_t, name *C.char, value *C.char, valueLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "query_index", time.Now())
+	*resultLen = 0
+	id := uintptr(handle)
+	store, err := indexesFor(id)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	err = store.queryIndex(C.GoString(name), C.GoBytes(unsafe.Pointer(value), valueLen), func(key []byte) error {
+		buffer = appendU32(buffer, uint32(len(key)))
+		buffer = append(buffer, key...)
+		return nil
+	})
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(id, nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(id, nil)
+	return mem
+}
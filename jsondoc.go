@@ -0,0 +1,267 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// decodeJSON parses one JSON document, keeping numbers as written.
+func decodeJSON(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("value is not JSON: %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("value is not JSON: trailing data")
+	}
+	return doc, nil
+}
+
+// encodeJSON renders doc without HTML escaping. Object members come out
+// sorted by name.
+func encodeJSON(doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// jsonGetPath returns the JSON text at path inside the document at key.
+func jsonGetPath(store kvStore, key []byte, path string) ([]byte, error) {
+	segs, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeJSON(raw[pythonTagLen(raw):])
+	if err != nil {
+		return nil, err
+	}
+	node, ok := lookupJSONPath(doc, segs)
+	if !ok {
+		return nil, fmt.Errorf("json path %q not found", path)
+	}
+	return encodeJSON(node)
+}
+
+// lookupJSONPath is followJSONPath that tells a missing member from null.
+func lookupJSONPath(doc any, path []string) (any, bool) {
+	for _, seg := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			child, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			doc = child
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// setJSONPath returns node with the member at path replaced by value.
+// Missing objects along the path are created, and an array index one past
+// the end appends.
+func setJSONPath(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	seg := path[0]
+	switch n := node.(type) {
+	case nil:
+		return setJSONPath(map[string]any{}, path, value)
+	case map[string]any:
+		child, err := setJSONPath(n[seg], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[seg] = child
+		return n, nil
+	case []any:
+		i, err := strconv.Atoi(seg)
+		if err != nil || i < 0 || i > len(n) {
+			return nil, fmt.Errorf("array index %q out of range", seg)
+		}
+		if i == len(n) {
+			n = append(n, nil)
+		}
+		child, err := setJSONPath(n[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	default:
+		return nil, fmt.Errorf("cannot set %q inside a JSON scalar", seg)
+	}
+}
+
+// jsonSetPath atomically replaces the member at path in the document at key
+// with the JSON text value. A missing key starts from an empty document. A
+// Python wrapper tag on the document is kept; see pythonTagLen.
+func jsonSetPath(store kvStore, key []byte, path string, value []byte) error {
+	segs, err := parseJSONPath(path)
+	if err != nil {
+		return err
+	}
+	if _, err := decodeJSON(value); err != nil {
+		return err
+	}
+	return updateKey(store, key, func(current []byte, found bool) ([]byte, bool, error) {
+		var doc any
+		tag := current[:pythonTagLen(current)]
+		if found {
+			if doc, err = decodeJSON(current[len(tag):]); err != nil {
+				return nil, false, err
+			}
+		}
+		// The member is decoded on every attempt, as a retried attempt
+		// may have linked the last copy into a discarded document.
+		member, _ := decodeJSON(value)
+		if doc, err = setJSONPath(doc, segs, member); err != nil {
+			return nil, false, err
+		}
+		next, err := encodeJSON(doc)
+		return append(bytes.Clone(tag), next...), err == nil, err
+	})
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch to target.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = mergePatch(t[name], value)
+	}
+	return t
+}
+
+// jsonMergePatch atomically applies the merge patch to the document at key,
+// treating a missing key as null.
+func jsonMergePatch(store kvStore, key, patch []byte) error {
+	if _, err := decodeJSON(patch); err != nil {
+		return err
+	}
+	return updateKey(store, key, func(current []byte, found bool) ([]byte, bool, error) {
+		var doc any
+		tag := current[:pythonTagLen(current)]
+		if found {
+			var err error
+			if doc, err = decodeJSON(current[len(tag):]); err != nil {
+				return nil, false, err
+			}
+		}
+		p, _ := decodeJSON(patch)
+		next, err := encodeJSON(mergePatch(doc, p))
+		return append(bytes.Clone(tag), next...), err == nil, err
+	})
+}
+
+// JSONGetPath returns the JSON text at path (e.g. "$.user.email" or
+// "items[2]") inside the JSON document at key, so hosts can read one field
+// without fetching the whole value. A missing member reports not found.
+// Release the result with FreeBuffer.
+//
+//export JSONGetPath
+func JSONGetPath(handle C.uintptr_t, key *C.char, keyLen C.int, path *C.char, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "json_get", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	data, err := jsonGetPath(store, gotKey, C.GoString(path))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	buf, err := returnValue(data, resultLen)
+	setHandleError(uintptr(handle), err)
+	return buf
+}
+
+// JSONSetPath atomically replaces the member at path inside the JSON
+// document at key with the JSON text in value, creating missing objects
+// along the way; an empty path or "$" replaces the whole document. The
+// document is re-encoded with its object members sorted by name.
+//
+//export JSONSetPath
+func JSONSetPath(handle C.uintptr_t, key *C.char, keyLen C.int, path *C.char, value *C.char, valueLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "json_set", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotValue := C.GoBytes(unsafe.Pointer(value), valueLen)
+	return setHandleError(uintptr(handle), jsonSetPath(store, gotKey, C.GoString(path), gotValue))
+}
+
+// JSONMergePatch atomically applies an RFC 7386 merge patch to the JSON
+// document at key: members set to null are removed and the rest are merged
+// in recursively.
+//
+//export JSONMergePatch
+func JSONMergePatch(handle C.uintptr_t, key *C.char, keyLen C.int, patch *C.char, patchLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "json_merge_patch", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotPatch := C.GoBytes(unsafe.Pointer(patch), patchLen)
+	return setHandleError(uintptr(handle), jsonMergePatch(store, gotKey, gotPatch))
+}
@@ -0,0 +1,676 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// A LevelDB directory is read without LevelDB itself: CURRENT names the
+// manifest, whose version edits list the live table files and the oldest
+// write-ahead log still needed. Every entry carries a sequence number, so
+// each user key's newest entry across tables and logs wins, and keys whose
+// newest entry is a deletion are left out. RocksDB directories use the same
+// layout; only their default column family is imported, from block-based
+// tables up to format_version 5.
+const (
+	levelDBTableMagic   = 0xdb4775248b80fb57
+	rocksDBTableMagic   = 0x88e241b785f4cff7
+	levelDBFooterLen    = 48
+	rocksDBFooterLen    = 53
+	levelDBBlockTrailer = 5
+	levelDBLogBlockSize = 32 << 10
+	rocksDBMaxFormat    = 5
+)
+
+// Entry kinds in internal keys and write batches. RocksDB's single
+// deletions count as deletions.
+const (
+	levelDBKindDelete       = 0
+	levelDBKindValue        = 1
+	levelDBKindSingleDelete = 7
+)
+
+// Version edit tags in the manifest, LevelDB's and RocksDB's.
+const (
+	manifestComparator       = 1
+	manifestLogNumber        = 2
+	manifestNextFile         = 3
+	manifestLastSequence     = 4
+	manifestCompactPointer   = 5
+	manifestDeletedFile      = 6
+	manifestNewFile          = 7
+	manifestPrevLogNumber    = 9
+	manifestMinLogToKeep     = 10
+	manifestNewFile2         = 100
+	manifestNewFile3         = 102
+	manifestNewFile4         = 103
+	manifestColumnFamily     = 200
+	manifestColumnFamilyAdd  = 201
+	manifestColumnFamilyDrop = 202
+	manifestMaxColumnFamily  = 203
+	manifestInAtomicGroup    = 300
+	manifestSafeIgnoreMask   = 1 << 13
+	manifestNewFile4Done     = 1
+)
+
+// levelDBDecoder reads varints and length-prefixed strings, keeping the
+// first error.
+type levelDBDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *levelDBDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errors.New("corrupt varint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *levelDBDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.b)) {
+		d.err = errors.New("corrupt length-prefixed string")
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func levelDBMaskedCRC(b ...[]byte) uint32 {
+	var crc uint32
+	for _, part := range b {
+		crc = crc32.Update(crc, castagnoli, part)
+	}
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+// levelDBLogRecords calls fn with each record of a log file, the format of
+// both write-ahead logs and manifests. A record cut short at the end of the
+// file, as a crash leaves it, ends the log.
+func levelDBLogRecords(r io.Reader, fn func(record []byte) error) error {
+	block := make([]byte, levelDBLogBlockSize)
+	var record []byte
+	for {
+		n, err := io.ReadFull(r, block)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		for b := block[:n]; len(b) >= 7; {
+			length, typ := int(binary.LittleEndian.Uint16(b[4:6])), b[6]
+			if typ == 0 && length == 0 {
+				// Zeroed padding or preallocated space.
+				break
+			}
+			if typ > 4 {
+				return fmt.Errorf("unsupported log record type %d (recycled logs cannot be imported)", typ)
+			}
+			if 7+length > len(b) {
+				return nil
+			}
+			data := b[7 : 7+length]
+			if levelDBMaskedCRC(b[6:7], data) != binary.LittleEndian.Uint32(b) {
+				return errors.New("corrupt log record")
+			}
+			b = b[7+length:]
+			switch typ {
+			case 1:
+				if err := fn(data); err != nil {
+					return err
+				}
+			case 2:
+				record = append(record[:0], data...)
+			case 3:
+				record = append(record, data...)
+			case 4:
+				if err := fn(append(record, data...)); err != nil {
+					return err
+				}
+				record = record[:0]
+			}
+		}
+		if n < len(block) {
+			return nil
+		}
+	}
+}
+
+// levelDBState is what the manifest says about the default column family.
+type levelDBState struct {
+	tables    map[uint64]bool
+	logNumber uint64
+	prevLog   uint64
+}
+
+func readLevelDBManifest(dir string) (*levelDBState, error) {
+	current, err := os.ReadFile(filepath.Join(dir, "CURRENT"))
+	if err != nil {
+		return nil, fmt.Errorf("not a LevelDB directory: %w", err)
+	}
+	name := strings.TrimSpace(string(current))
+	if !strings.HasPrefix(name, "MANIFEST-") || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("CURRENT names %q, not a manifest", name)
+	}
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	state := &levelDBState{tables: make(map[uint64]bool)}
+	err = levelDBLogRecords(f, func(record []byte) error {
+		d := &levelDBDecoder{b: record}
+		cf := uint64(0)
+		newFile := func(number uint64) {
+			if cf == 0 {
+				state.tables[number] = true
+			}
+		}
+		for d.err == nil && len(d.b) > 0 {
+			switch tag := d.uvarint(); tag {
+			case manifestComparator, manifestColumnFamilyAdd:
+				d.bytes()
+			case manifestLogNumber:
+				if n := d.uvarint(); cf == 0 {
+					state.logNumber = n
+				}
+			case manifestPrevLogNumber:
+				if n := d.uvarint(); cf == 0 {
+					state.prevLog = n
+				}
+			case manifestNextFile, manifestLastSequence, manifestMinLogToKeep, manifestMaxColumnFamily, manifestInAtomicGroup:
+				d.uvarint()
+			case manifestCompactPointer:
+				d.uvarint()
+				d.bytes()
+			case manifestDeletedFile:
+				d.uvarint()
+				if n := d.uvarint(); cf == 0 {
+					delete(state.tables, n)
+				}
+			case manifestNewFile, manifestNewFile2, manifestNewFile3, manifestNewFile4:
+				d.uvarint()
+				number := d.uvarint()
+				if tag == manifestNewFile3 {
+					d.uvarint()
+				}
+				d.uvarint()
+				d.bytes()
+				d.bytes()
+				if tag != manifestNewFile {
+					d.uvarint()
+					d.uvarint()
+				}
+				for tag == manifestNewFile4 && d.err == nil {
+					if d.uvarint() == manifestNewFile4Done {
+						break
+					}
+					d.bytes()
+				}
+				newFile(number)
+			case manifestColumnFamily:
+				cf = d.uvarint()
+			case manifestColumnFamilyDrop:
+			default:
+				if tag&manifestSafeIgnoreMask == 0 {
+					return fmt.Errorf("unsupported manifest record %d", tag)
+				}
+				d.bytes()
+			}
+		}
+		return d.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return state, nil
+}
+
+// levelDBTable reads the entries of one block-based table file.
+type levelDBTable struct {
+	f        *os.File
+	format   uint32
+	checksum byte
+	zstd     *zstd.Decoder
+}
+
+type levelDBHandle struct {
+	offset, size uint64
+}
+
+func (d *levelDBDecoder) handle() levelDBHandle {
+	return levelDBHandle{offset: d.uvarint(), size: d.uvarint()}
+}
+
+// block reads and decompresses a block, checking its CRC32C checksum when
+// the table uses one.
+func (t *levelDBTable) block(h levelDBHandle) ([]byte, error) {
+	if h.size > 1<<31 {
+		return nil, errors.New("corrupt block handle")
+	}
+	buf := make([]byte, h.size+levelDBBlockTrailer)
+	if _, err := t.f.ReadAt(buf, int64(h.offset)); err != nil {
+		return nil, err
+	}
+	data, typ := buf[:h.size], buf[h.size]
+	if t.checksum == 1 && levelDBMaskedCRC(buf[:h.size+1]) != binary.LittleEndian.Uint32(buf[h.size+1:]) {
+		return nil, errors.New("block checksum mismatch")
+	}
+	if typ != 0 && typ != 1 && t.format >= 2 {
+		// Later RocksDB formats prefix the other compressions with the
+		// uncompressed size.
+		if _, n := binary.Uvarint(data); n > 0 {
+			data = data[n:]
+		}
+	}
+	switch typ {
+	case 0:
+		return data, nil
+	case 1:
+		return snappy.Decode(nil, data)
+	case 2:
+		return io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	case 7:
+		return t.zstd.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unsupported block compression %d", typ)
+}
+
+// levelDBBlockEntries calls fn with each key and value of a block. Keys are
+// only valid during the call.
+func levelDBBlockEntries(b []byte, fn func(key, value []byte) error) error {
+	errCorrupt := errors.New("corrupt block")
+	if len(b) < 4 {
+		return errCorrupt
+	}
+	restarts := int(binary.LittleEndian.Uint32(b[len(b)-4:]))
+	end := len(b) - 4 - 4*restarts
+	if restarts < 0 || end < 0 {
+		return errCorrupt
+	}
+	d := &levelDBDecoder{b: b[:end]}
+	var key []byte
+	for d.err == nil && len(d.b) > 0 {
+		shared, nonShared, valueLen := d.uvarint(), d.uvarint(), d.uvarint()
+		if d.err != nil || shared > uint64(len(key)) || nonShared+valueLen > uint64(len(d.b)) {
+			return errCorrupt
+		}
+		key = append(key[:shared], d.b[:nonShared]...)
+		if err := fn(key, d.b[nonShared:nonShared+valueLen]); err != nil {
+			return err
+		}
+		d.b = d.b[nonShared+valueLen:]
+	}
+	return d.err
+}
+
+// rocksDBDeltaIndexHandles decodes an index block whose values are delta
+// encoded: entries carry no value length, restart points hold a full block
+// handle and the entries after them only the change in size.
+func rocksDBDeltaIndexHandles(b []byte) ([]levelDBHandle, error) {
+	errCorrupt := errors.New("corrupt index block")
+	if len(b) < 4 {
+		return nil, errCorrupt
+	}
+	restarts := int(binary.LittleEndian.Uint32(b[len(b)-4:]))
+	end := len(b) - 4 - 4*restarts
+	if restarts < 0 || end < 0 {
+		return nil, errCorrupt
+	}
+	isRestart := make(map[int]bool, restarts)
+	for i := 0; i < restarts; i++ {
+		isRestart[int(binary.LittleEndian.Uint32(b[end+4*i:]))] = true
+	}
+	var handles []levelDBHandle
+	d := &levelDBDecoder{b: b[:end]}
+	for d.err == nil && len(d.b) > 0 {
+		offset := end - len(d.b)
+		d.uvarint()
+		nonShared := d.uvarint()
+		if d.err != nil || nonShared > uint64(len(d.b)) {
+			return nil, errCorrupt
+		}
+		d.b = d.b[nonShared:]
+		if isRestart[offset] || len(handles) == 0 {
+			handles = append(handles, d.handle())
+			continue
+		}
+		delta, n := binary.Varint(d.b)
+		if n <= 0 {
+			return nil, errCorrupt
+		}
+		d.b = d.b[n:]
+		prev := handles[len(handles)-1]
+		handles = append(handles, levelDBHandle{
+			offset: prev.offset + prev.size + levelDBBlockTrailer,
+			size:   uint64(int64(prev.size) + delta),
+		})
+	}
+	return handles, d.err
+}
+
+// indexHandles returns the handles in an index block.
+func (t *levelDBTable) indexHandles(b []byte, deltaEncoded bool) ([]levelDBHandle, error) {
+	if deltaEncoded {
+		return rocksDBDeltaIndexHandles(b)
+	}
+	var handles []levelDBHandle
+	err := levelDBBlockEntries(b, func(_, value []byte) error {
+		d := &levelDBDecoder{b: value}
+		handles = append(handles, d.handle())
+		return d.err
+	})
+	return handles, err
+}
+
+// entries calls fn with the user key, sequence-and-kind tag and value of
+// every entry in the table.
+func (t *levelDBTable) entries(fn func(key []byte, tag uint64, value []byte) error) error {
+	stat, err := t.f.Stat()
+	if err != nil {
+		return err
+	}
+	size := stat.Size()
+	if size < levelDBFooterLen {
+		return errors.New("file too short for a table")
+	}
+	footer := make([]byte, min(size, rocksDBFooterLen))
+	if _, err := t.f.ReadAt(footer, size-int64(len(footer))); err != nil {
+		return err
+	}
+	d := &levelDBDecoder{}
+	switch binary.LittleEndian.Uint64(footer[len(footer)-8:]) {
+	case levelDBTableMagic:
+		t.checksum = 1
+		d.b = footer[len(footer)-levelDBFooterLen:]
+	case rocksDBTableMagic:
+		if len(footer) < rocksDBFooterLen {
+			return errors.New("file too short for a table")
+		}
+		t.checksum = footer[0]
+		t.format = binary.LittleEndian.Uint32(footer[rocksDBFooterLen-12:])
+		if t.format > rocksDBMaxFormat {
+			return fmt.Errorf("unsupported RocksDB table format_version %d", t.format)
+		}
+		d.b = footer[1:]
+	default:
+		return errors.New("not a LevelDB or RocksDB table")
+	}
+	metaHandle, indexHandle := d.handle(), d.handle()
+	if d.err != nil {
+		return d.err
+	}
+
+	// RocksDB describes its index in the properties block.
+	var deltaEncoded, partitioned bool
+	meta, err := t.block(metaHandle)
+	if err != nil {
+		return fmt.Errorf("metaindex block: %w", err)
+	}
+	err = levelDBBlockEntries(meta, func(name, value []byte) error {
+		switch string(name) {
+		case "rocksdb.range_del":
+			return errors.New("range deletions cannot be imported")
+		case "rocksdb.properties":
+		default:
+			return nil
+		}
+		hd := &levelDBDecoder{b: value}
+		props, err := t.block(hd.handle())
+		if err != nil {
+			return fmt.Errorf("properties block: %w", err)
+		}
+		return levelDBBlockEntries(props, func(name, value []byte) error {
+			switch string(name) {
+			case "rocksdb.index.value.is.delta.encoded":
+				v, _ := binary.Uvarint(value)
+				deltaEncoded = v != 0
+			case "rocksdb.block.based.table.index.type":
+				partitioned = len(value) == 4 && binary.LittleEndian.Uint32(value) == 2
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	index, err := t.block(indexHandle)
+	if err != nil {
+		return fmt.Errorf("index block: %w", err)
+	}
+	var handles []levelDBHandle
+	if partitioned {
+		// The top-level index of a partitioned index is never delta
+		// encoded; its partitions are.
+		parts, err := t.indexHandles(index, false)
+		if err != nil {
+			return err
+		}
+		for _, h := range parts {
+			part, err := t.block(h)
+			if err != nil {
+				return fmt.Errorf("index partition: %w", err)
+			}
+			partHandles, err := t.indexHandles(part, deltaEncoded)
+			if err != nil {
+				return err
+			}
+			handles = append(handles, partHandles...)
+		}
+	} else if handles, err = t.indexHandles(index, deltaEncoded); err != nil {
+		return err
+	}
+
+	for _, h := range handles {
+		data, err := t.block(h)
+		if err != nil {
+			return fmt.Errorf("data block: %w", err)
+		}
+		err = levelDBBlockEntries(data, func(ikey, value []byte) error {
+			if len(ikey) < 8 {
+				return errors.New("corrupt internal key")
+			}
+			n := len(ikey) - 8
+			return fn(ikey[:n], binary.LittleEndian.Uint64(ikey[n:]), value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// levelDBBatchEntries calls fn with each default column family entry of a
+// write batch, as a user key, sequence-and-kind tag and value.
+func levelDBBatchEntries(batch []byte, fn func(key []byte, tag uint64, value []byte) error) error {
+	if len(batch) < 12 {
+		return errors.New("corrupt write batch")
+	}
+	seq := binary.LittleEndian.Uint64(batch)
+	d := &levelDBDecoder{b: batch[12:]}
+	for d.err == nil && len(d.b) > 0 {
+		typ := d.b[0]
+		d.b = d.b[1:]
+		cf := uint64(0)
+		switch typ {
+		case 3:
+			// Log data is not part of the database.
+			d.bytes()
+			continue
+		case 0xd:
+			continue
+		case 4, 5, 8:
+			// The column family variants of deletion, value and single
+			// deletion.
+			cf = d.uvarint()
+			typ = [...]byte{4: levelDBKindDelete, 5: levelDBKindValue, 8: levelDBKindSingleDelete}[typ]
+		case levelDBKindDelete, levelDBKindValue, levelDBKindSingleDelete:
+		default:
+			return fmt.Errorf("unsupported write batch record %d", typ)
+		}
+		key := d.bytes()
+		var value []byte
+		kind := uint64(levelDBKindDelete)
+		if typ == levelDBKindValue {
+			value = d.bytes()
+			kind = levelDBKindValue
+		}
+		if d.err != nil {
+			break
+		}
+		if cf == 0 {
+			if err := fn(key, seq<<8|kind, value); err != nil {
+				return err
+			}
+		}
+		seq++
+	}
+	return d.err
+}
+
+// importLevelDB copies the live entries of the LevelDB or RocksDB directory
+// dir into store. It reads the sources twice: first to find each key's
+// newest sequence number, which keeps every key in memory, then to write the
+// values that won.
+func importLevelDB(store kvStore, dir string) error {
+	state, err := readLevelDBManifest(dir)
+	if err != nil {
+		return err
+	}
+	var tables, logs []string
+	for number := range state.tables {
+		name := filepath.Join(dir, fmt.Sprintf("%06d.ldb", number))
+		if _, err := os.Stat(name); err != nil {
+			name = filepath.Join(dir, fmt.Sprintf("%06d.sst", number))
+		}
+		tables = append(tables, name)
+	}
+	walFiles, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return err
+	}
+	for _, name := range walFiles {
+		var number uint64
+		if _, err := fmt.Sscanf(filepath.Base(name), "%d.log", &number); err != nil {
+			continue
+		}
+		if number >= state.logNumber || (state.prevLog != 0 && number == state.prevLog) {
+			logs = append(logs, name)
+		}
+	}
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+	visit := func(fn func(key []byte, tag uint64, value []byte) error) error {
+		for _, name := range tables {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			t := &levelDBTable{f: f, zstd: dec}
+			err = t.entries(fn)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(name), err)
+			}
+		}
+		for _, name := range logs {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			err = levelDBLogRecords(f, func(batch []byte) error {
+				return levelDBBatchEntries(batch, fn)
+			})
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(name), err)
+			}
+		}
+		return nil
+	}
+
+	newest := make(map[string]uint64)
+	err = visit(func(key []byte, tag uint64, _ []byte) error {
+		switch kind := tag & 0xff; kind {
+		case levelDBKindDelete, levelDBKindSingleDelete, levelDBKindValue:
+		case 2:
+			return errors.New("merge operands cannot be imported")
+		default:
+			return fmt.Errorf("unsupported entry kind %d", kind)
+		}
+		if cur, ok := newest[string(key)]; !ok || tag>>8 > cur>>8 {
+			newest[string(key)] = tag
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w := &importWriter{store: store}
+	err = visit(func(key []byte, tag uint64, value []byte) error {
+		if tag&0xff != levelDBKindValue || newest[string(key)] != tag {
+			return nil
+		}
+		// A key flushed from a log that is still around appears twice.
+		delete(newest, string(key))
+		return w.set(bytes.Clone(key), bytes.Clone(value), 0)
+	})
+	if err != nil {
+		return err
+	}
+	return w.flush()
+}
+
+// ImportLevelDB copies every live key of the LevelDB database in dir into
+// the store behind handle, in batches, without needing LevelDB itself. The
+// database must not be open elsewhere. RocksDB directories are accepted too:
+// their default column family is imported from block-based tables up to
+// format_version 5 compressed with snappy, zlib or zstd; merge operands,
+// range deletions and blob files fail the import. Keys written before a
+// failure stay in the store.
+//
+//export ImportLevelDB
+func ImportLevelDB(handle C.uintptr_t, dir *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), importLevelDB(store, C.GoString(dir)))
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/PowerDNS/lmdb-go/lmdb"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// defaultLmdbMapSize caps how large the store may grow; LMDB reserves the
+// address space up front but only uses disk for pages actually written.
+const defaultLmdbMapSize = 1 << 30
+
+type lmdbConfig struct {
+	Path string `json:"path"`
+	// MapSize is the maximum database size in bytes.
+	MapSize int64 `json:"map_size,omitempty"`
+}
+
+// lmdbStore keeps entries in the unnamed root database of an LMDB
+// environment. Other processes may open the same directory concurrently;
+// LMDB serialises their writers and never blocks readers.
+//
+// LMDB rejects empty keys and, by default, keys longer than 511 bytes.
+type lmdbStore struct {
+	env *lmdb.Env
+	dbi lmdb.DBI
+	// commitMu is held shared by every write and exclusively by emulated
+	// transaction commits.
+	commitMu sync.RWMutex
+}
+
+func init() { registerBackend("lmdb", openLmdb) }
+
+// openLmdb opens an "lmdb:" path. Like "slatedb:", the part after the scheme
+// is either a directory or a JSON lmdbConfig.
+func openLmdb(raw string) (kvStore, error) {
+	configPart := strings.TrimSpace(raw[len("lmdb:"):])
+	configPart = strings.TrimPrefix(configPart, "//")
+
+	var cfg lmdbConfig
+	if strings.HasPrefix(configPart, "{") {
+		if err := json.Unmarshal([]byte(configPart), &cfg); err != nil {
+			return nil, err
+		}
+	} else {
+		cfg.Path = configPart
+	}
+	return openLmdbConfig(&cfg)
+}
+
+func openLmdbConfig(cfg *lmdbConfig) (kvStore, error) {
+	if cfg.Path == "" {
+		cfg.Path = defaultDataDir("lmdb")
+	}
+	if cfg.MapSize == 0 {
+		cfg.MapSize = defaultLmdbMapSize
+	}
+	if err := os.MkdirAll(cfg.Path, 0o755); err != nil {
+		return nil, err
+	}
+
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err := env.SetMapSize(cfg.MapSize); err != nil {
+		env.Close()
+		return nil, err
+	}
+	// NoTLS ties read transactions to the transaction rather than the OS
+	// thread, which goroutines do not stay on.
+	if err := env.Open(cfg.Path, lmdb.NoTLS, 0o644); err != nil {
+		env.Close()
+		return nil, err
+	}
+
+	store := &lmdbStore{env: env}
+	err = env.Update(func(txn *lmdb.Txn) (err error) {
+		store.dbi, err = txn.OpenRoot(0)
+		return err
+	})
+	if err != nil {
+		env.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *lmdbStore) Close() error { return s.env.Close() }
+
+func (s *lmdbStore) Set(key, value []byte) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.env.Update(func(txn *lmdb.Txn) error {
+		return txn.Put(s.dbi, key, value, 0)
+	})
+}
+
+// Get relies on lmdb-go copying values out of the memory map, which it does
+// unless a transaction opts into RawRead.
+func (s *lmdbStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.env.View(func(txn *lmdb.Txn) (err error) {
+		value, err = txn.Get(s.dbi, key)
+		return err
+	})
+	if lmdb.IsNotFound(err) {
+		return nil, badger.ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (s *lmdbStore) Has(key []byte) (bool, error) {
+	_, err := s.Get(key)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *lmdbStore) Delete(key []byte) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	err := s.env.Update(func(txn *lmdb.Txn) error {
+		return txn.Del(s.dbi, key, nil)
+	})
+	if lmdb.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// scan walks [start, end) in key order within one read transaction.
+func (s *lmdbStore) scan(start, end []byte, raw bool, fn func(k, v []byte) error) error {
+	return s.env.View(func(txn *lmdb.Txn) error {
+		txn.RawRead = raw
+		cur, err := txn.OpenCursor(s.dbi)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+
+		var k, v []byte
+		if start == nil {
+			k, v, err = cur.Get(nil, nil, lmdb.First)
+		} else {
+			k, v, err = cur.Get(start, nil, lmdb.SetRange)
+		}
+		for ; err == nil; k, v, err = cur.Get(nil, nil, lmdb.Next) {
+			if end != nil && bytes.Compare(k, end) >= 0 {
+				return nil
+			}
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		if lmdb.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *lmdbStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	start, end := prefixRange(prefix)
+	return s.scan(start, end, false, fn)
+}
+
+func (s *lmdbStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.scan(start, end, false, fn)
+}
+
+func (s *lmdbStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return s.env.View(func(txn *lmdb.Txn) error {
+		cur, err := txn.OpenCursor(s.dbi)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+
+		var k, v []byte
+		if end == nil {
+			k, v, err = cur.Get(nil, nil, lmdb.Last)
+		} else if k, v, err = cur.Get(end, nil, lmdb.SetRange); lmdb.IsNotFound(err) {
+			k, v, err = cur.Get(nil, nil, lmdb.Last)
+		} else if err == nil {
+			// SetRange lands on the first key >= end, which is excluded.
+			k, v, err = cur.Get(nil, nil, lmdb.Prev)
+		}
+		for ; err == nil; k, v, err = cur.Get(nil, nil, lmdb.Prev) {
+			if start != nil && bytes.Compare(k, start) < 0 {
+				return nil
+			}
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		if lmdb.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Count reads keys and values in place rather than copying them out.
+func (s *lmdbStore) Count(start, end []byte) (int, error) {
+	n := 0
+	err := s.scan(start, end, true, func(_, _ []byte) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func (s *lmdbStore) Sync() error { return s.env.Sync(true) }
+
+// Apply commits the batch as a single LMDB write transaction.
+func (s *lmdbStore) Apply(ops []operation) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.apply(ops)
+}
+
+// apply is Apply without commitMu, for commits that already hold it.
+func (s *lmdbStore) apply(ops []operation) error {
+	return s.env.Update(func(txn *lmdb.Txn) error {
+		for _, op := range ops {
+			switch op.op {
+			case opSet:
+				if err := txn.Put(s.dbi, op.key, op.value, 0); err != nil {
+					return err
+				}
+			case opDelete:
+				if err := txn.Del(s.dbi, op.key, nil); err != nil && !lmdb.IsNotFound(err) {
+					return err
+				}
+			case opSetTTL:
+				return errors.New("TTLs are not supported by the lmdb backend")
+			default:
+				return errors.New("unknown operation code")
+			}
+		}
+		return nil
+	})
+}
+
+func (s *lmdbStore) Begin() (kvTxn, error) {
+	return newEmulatedTxn(s, &s.commitMu, s.apply), nil
+}
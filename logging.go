@@ -0,0 +1,187 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+typedef void (*skyshelve_log_cb)(void *user_data, int level, const char *component, const char *message);
+
+static inline void skyshelve_call_log_cb(skyshelve_log_cb cb, void *user_data, int level, const char *component, const char *message) {
+	cb(user_data, level, component, message);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Log levels shared by SetLogCallback and SetLogFile.
+const (
+	logDebug = 0
+	logInfo  = 1
+	logWarn  = 2
+	logError = 3
+)
+
+const (
+	maxLogFileSize = 64 << 20
+	logFileBackups = 3
+)
+
+var logLevelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// Log sinks are process-wide. With neither configured, log lines are
+// dropped, which matches badger's silenced logger on disk-backed stores.
+var (
+	logMu       sync.Mutex
+	logCallback C.skyshelve_log_cb
+	logUserData unsafe.Pointer
+	logCbLevel  int
+	logFile     *rotatingFile
+	logFileLvl  int
+)
+
+func logf(level int, component, format string, args ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if logCallback == nil && logFile == nil {
+		return
+	}
+	message := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+
+	if logCallback != nil && level >= logCbLevel {
+		cComponent := C.CString(component)
+		cMessage := C.CString(message)
+		C.skyshelve_call_log_cb(logCallback, logUserData, C.int(level), cComponent, cMessage)
+		C.free(unsafe.Pointer(cComponent))
+		C.free(unsafe.Pointer(cMessage))
+	}
+	if logFile != nil && level >= logFileLvl {
+		line := fmt.Sprintf("%s %-5s %s: %s\n", time.Now().Format(time.RFC3339Nano), logLevelNames[level], component, message)
+		// A failing log file has nowhere to report to.
+		_ = logFile.write([]byte(line))
+	}
+}
+
+// badgerLogger routes badger's logging into the skyshelve log sinks.
+type badgerLogger struct{}
+
+func (badgerLogger) Errorf(format string, args ...any) { logf(logError, "badger", format, args...) }
+
+func (badgerLogger) Warningf(format string, args ...any) { logf(logWarn, "badger", format, args...) }
+
+func (badgerLogger) Infof(format string, args ...any) { logf(logInfo, "badger", format, args...) }
+
+func (badgerLogger) Debugf(format string, args ...any) { logf(logDebug, "badger", format, args...) }
+
+// rotatingFile appends to path, moving it to path.1 (and older copies up to
+// path.N) once it grows past maxLogFileSize.
+type rotatingFile struct {
+	path string
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string) (*rotatingFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, f: f, size: info.Size()}, nil
+}
+
+func (r *rotatingFile) write(p []byte) error {
+	if r.size+int64(len(p)) > maxLogFileSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	for i := logFileBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	r.f, r.size = f, 0
+	return nil
+}
+
+func (r *rotatingFile) close() error { return r.f.Close() }
+
+func validLogLevel(level C.int) error {
+	if level < logDebug || level > logError {
+		return fmt.Errorf("invalid log level %d", int(level))
+	}
+	return nil
+}
+
+// SetLogCallback delivers log lines at or above level (0 debug, 1 info,
+// 2 warn, 3 error) to fn(userData, level, component, message). The strings
+// are only valid during the call. Calls are serialised, and fn must not call
+// back into skyshelve. A NULL fn removes the callback.
+//
+// Badger stores pick up the log sinks when they are opened. SlateDB logs
+// from its native library and is not routed here.
+//
+//export SetLogCallback
+func SetLogCallback(fn C.skyshelve_log_cb, userData unsafe.Pointer, level C.int) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	if err := validLogLevel(level); err != nil {
+		return setError(err)
+	}
+	logMu.Lock()
+	logCallback, logUserData, logCbLevel = fn, userData, int(level)
+	logMu.Unlock()
+	return setError(nil)
+}
+
+// SetLogFile appends log lines at or above level to path, rotating it at
+// 64 MiB and keeping three older files. An empty path closes the log file.
+//
+//export SetLogFile
+func SetLogFile(path *C.char, level C.int) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	if err := validLogLevel(level); err != nil {
+		return setError(err)
+	}
+	var next *rotatingFile
+	if p := C.GoString(path); p != "" {
+		var err error
+		if next, err = openRotatingFile(p); err != nil {
+			return setError(err)
+		}
+	}
+
+	logMu.Lock()
+	prev := logFile
+	logFile, logFileLvl = next, int(level)
+	logMu.Unlock()
+	if prev != nil {
+		return setError(prev.close())
+	}
+	return setError(nil)
+}
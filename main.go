@@ -0,0 +1,7 @@
+//go:build !cli
+
+package main
+
+// The shared library needs an empty main; building with -tags cli swaps in
+// the command-line tool from cli.go instead.
+func main() {}
@@ -0,0 +1,352 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memcacheFlagsPrefix holds the client flags of items stored with non-zero
+// flags, as a big-endian u32 under the item's key, so values themselves are
+// stored unchanged and stay readable through Get.
+var memcacheFlagsPrefix = []byte("\xffmc/flags/")
+
+const (
+	memcacheMaxKey = 250
+	// memcacheRelativeLimit is the largest exptime memcached treats as
+	// seconds from now; larger ones are Unix timestamps.
+	memcacheRelativeLimit = 30 * 24 * 60 * 60
+)
+
+var (
+	memcacheMu      sync.Mutex
+	memcacheServers = make(map[uintptr]*tcpServer)
+
+	errMemcacheNotFound   = errors.New("NOT_FOUND")
+	errMemcacheNonNumeric = errors.New("CLIENT_ERROR cannot increment or decrement non-numeric value")
+	errMemcacheReserved   = errors.New("CLIENT_ERROR " + errReservedKey.Error())
+)
+
+func memcacheFlagsKey(key []byte) []byte {
+	return append(append([]byte(nil), memcacheFlagsPrefix...), key...)
+}
+
+// memcacheTTL maps a memcached exptime onto a time-to-live, reporting
+// whether the item has already expired.
+func memcacheTTL(exptime int64, now time.Time) (time.Duration, bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= memcacheRelativeLimit:
+		return time.Duration(exptime) * time.Second, false
+	}
+	ttl := time.Unix(exptime, 0).Sub(now)
+	return ttl, ttl <= 0
+}
+
+// memcacheServer answers memcached text protocol commands for one store
+// handle.
+type memcacheServer struct {
+	id uintptr
+}
+
+func (s *memcacheServer) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := readRESPLine(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				w.WriteString("CLIENT_ERROR " + respLine(err.Error()) + "\r\n")
+				w.Flush()
+			}
+			return
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" {
+			w.Flush()
+			return
+		}
+		reply, err := s.dispatch(r, fields)
+		if err != nil {
+			reply = memcacheError(err)
+		}
+		if reply != "" {
+			w.WriteString(reply)
+		}
+		if r.Buffered() == 0 {
+			if w.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// memcacheError renders err as a protocol reply. Replies that are already
+// protocol words pass through; store failures become SERVER_ERROR.
+func memcacheError(err error) string {
+	msg := respLine(err.Error())
+	for _, word := range []string{"ERROR", "CLIENT_ERROR", "SERVER_ERROR", "NOT_FOUND"} {
+		if msg == word || strings.HasPrefix(msg, word+" ") {
+			return msg + "\r\n"
+		}
+	}
+	return "SERVER_ERROR " + msg + "\r\n"
+}
+
+func checkMemcacheKey(key string) error {
+	if len(key) > memcacheMaxKey {
+		return errors.New("CLIENT_ERROR key too long")
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] == 0x7f {
+			return errors.New("CLIENT_ERROR invalid key")
+		}
+	}
+	return nil
+}
+
+// dispatch runs one command and returns its reply, which is empty for
+// noreply commands.
+func (s *memcacheServer) dispatch(r *bufio.Reader, fields []string) (string, error) {
+	store, err := getHandle(s.id)
+	if err != nil {
+		return "", err
+	}
+	cmd, args := fields[0], fields[1:]
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	quiet := func(reply string) string {
+		if noreply {
+			return ""
+		}
+		return reply
+	}
+	switch cmd {
+	case "version":
+		return "VERSION " + libraryVersion + "\r\n", nil
+	case "get":
+		if len(args) == 0 {
+			return "", errors.New("ERROR")
+		}
+		var b strings.Builder
+		for _, key := range args {
+			if reservedKey([]byte(key)) {
+				continue
+			}
+			value, flags, err := memcacheGet(store, []byte(key))
+			if isNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			b.WriteString("VALUE " + key + " " + strconv.FormatUint(uint64(flags), 10) + " " + strconv.Itoa(len(value)) + "\r\n")
+			b.Write(value)
+			b.WriteString("\r\n")
+		}
+		b.WriteString("END\r\n")
+		return b.String(), nil
+	case "set":
+		if len(args) != 4 && len(args) != 5 {
+			return "", errors.New("ERROR")
+		}
+		flags, err1 := strconv.ParseUint(args[1], 10, 32)
+		exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+		size, err3 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil || err3 != nil || size < 0 || size > httpMaxBody {
+			return "", errors.New("CLIENT_ERROR bad command line format")
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		if string(data[size:]) != "\r\n" {
+			return "", errors.New("CLIENT_ERROR bad data chunk")
+		}
+		if err := checkMemcacheKey(args[0]); err != nil {
+			return "", err
+		}
+		if reservedKey([]byte(args[0])) {
+			return "", errMemcacheReserved
+		}
+		if err := s.set(store, []byte(args[0]), data[:size], uint32(flags), exptime); err != nil {
+			return "", err
+		}
+		return quiet("STORED\r\n"), nil
+	case "delete":
+		if len(args) < 1 || len(args) > 3 {
+			return "", errors.New("ERROR")
+		}
+		key := []byte(args[0])
+		if reservedKey(key) {
+			return "", errMemcacheReserved
+		}
+		found, err := hasKey(store, key)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return quiet("NOT_FOUND\r\n"), nil
+		}
+		ops := []operation{{op: opDelete, key: key}, {op: opDelete, key: memcacheFlagsKey(key)}}
+		if err := store.Apply(ops); err != nil {
+			return "", err
+		}
+		return quiet("DELETED\r\n"), nil
+	case "incr", "decr":
+		if len(args) != 2 && len(args) != 3 {
+			return "", errors.New("ERROR")
+		}
+		delta, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return "", errors.New("CLIENT_ERROR invalid numeric delta argument")
+		}
+		if reservedKey([]byte(args[0])) {
+			return "", errMemcacheReserved
+		}
+		n, err := memcacheIncr(store, []byte(args[0]), delta, cmd == "incr")
+		if err != nil {
+			if errors.Is(err, errMemcacheNotFound) {
+				return quiet("NOT_FOUND\r\n"), nil
+			}
+			return "", err
+		}
+		return quiet(strconv.FormatUint(n, 10) + "\r\n"), nil
+	}
+	return "", errors.New("ERROR")
+}
+
+// memcacheGet returns key's value and client flags.
+func memcacheGet(store kvStore, key []byte) ([]byte, uint32, error) {
+	value, err := store.Get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	raw, err := store.Get(memcacheFlagsKey(key))
+	if isNotFound(err) || (err == nil && len(raw) != 4) {
+		return value, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, binary.BigEndian.Uint32(raw), nil
+}
+
+// set stores value and its flags in one batch, both expiring together.
+func (s *memcacheServer) set(store kvStore, key, value []byte, flags uint32, exptime int64) error {
+	ttl, expired := memcacheTTL(exptime, time.Now())
+	if expired {
+		// An item stored already expired is never seen again.
+		return store.Apply([]operation{{op: opDelete, key: key}, {op: opDelete, key: memcacheFlagsKey(key)}})
+	}
+	op := opSet
+	if ttl > 0 {
+		op = opSetTTL
+	}
+	ops := []operation{{op: op, key: key, value: value, ttl: ttl}}
+	if flags != 0 {
+		ops = append(ops, operation{op: op, key: memcacheFlagsKey(key), value: binary.BigEndian.AppendUint32(nil, flags), ttl: ttl})
+	} else {
+		ops = append(ops, operation{op: opDelete, key: memcacheFlagsKey(key)})
+	}
+	if err := store.Apply(ops); err != nil {
+		return err
+	}
+	return nil
+}
+
+// memcacheIncr adds delta to, or subtracts it from, the decimal counter at
+// key with memcached's rules: increments wrap at 64 bits and decrements stop
+// at zero.
+func memcacheIncr(store kvStore, key []byte, delta uint64, incr bool) (uint64, error) {
+	var result uint64
+	err := updateKey(store, key, func(current []byte, found bool) ([]byte, bool, error) {
+		if !found {
+			return nil, false, errMemcacheNotFound
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(string(current)), 10, 64)
+		if err != nil {
+			return nil, false, errMemcacheNonNumeric
+		}
+		switch {
+		case incr:
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+		result = n
+		return strconv.AppendUint(nil, n, 10), true, nil
+	})
+	return result, err
+}
+
+func stopMemcacheServerFor(id uintptr) error {
+	memcacheMu.Lock()
+	srv, ok := memcacheServers[id]
+	delete(memcacheServers, id)
+	memcacheMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return srv.close()
+}
+
+// StartMemcacheServer serves the store behind handle to memcached clients on
+// addr, until StopMemcacheServer or Close. It speaks the text protocol's
+// get, set, delete, incr, decr, version and quit; set's exptime maps onto
+// the store's TTLs, and client flags are kept beside the value. There is no
+// authentication, so bind it to a trusted interface.
+//
+//export StartMemcacheServer
+func StartMemcacheServer(handle C.uintptr_t, addr *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	if _, err := getHandle(id); err != nil {
+		return setHandleError(id, err)
+	}
+	memcacheMu.Lock()
+	defer memcacheMu.Unlock()
+	if _, ok := memcacheServers[id]; ok {
+		return setHandleError(id, errors.New("a memcached server is already running for this handle"))
+	}
+	ln, err := net.Listen("tcp", C.GoString(addr))
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	srv := newTCPServer(ln, (&memcacheServer{id: id}).handle)
+	memcacheServers[id] = srv
+	go srv.serve()
+	return setHandleError(id, nil)
+}
+
+//export StopMemcacheServer
+func StopMemcacheServer(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	memcacheMu.Lock()
+	_, ok := memcacheServers[id]
+	memcacheMu.Unlock()
+	if !ok {
+		return setHandleError(id, errors.New("no memcached server is running for this handle"))
+	}
+	return setHandleError(id, stopMemcacheServerFor(id))
+}
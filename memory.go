@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/google/btree"
+)
+
+const memTreeDegree = 32
+
+type memEntry struct {
+	key, value []byte
+}
+
+func memEntryLess(a, b memEntry) bool { return bytes.Compare(a.key, b.key) < 0 }
+
+// memReader serves reads from a B-tree. Trees handed to a memReader for
+// iteration are clones, which btree makes copy-on-write, so callbacks run
+// without holding the store lock and may write back to the store.
+type memReader struct {
+	tree *btree.BTreeG[memEntry]
+}
+
+func (r memReader) Get(key []byte) ([]byte, error) {
+	item, ok := r.tree.Get(memEntry{key: key})
+	if !ok {
+		return nil, badger.ErrKeyNotFound
+	}
+	return append([]byte{}, item.value...), nil
+}
+
+func (r memReader) Has(key []byte) (bool, error) {
+	return r.tree.Has(memEntry{key: key}), nil
+}
+
+func (r memReader) ascend(start, end []byte, fn func(item memEntry) error) error {
+	var err error
+	visit := func(item memEntry) bool {
+		if end != nil && bytes.Compare(item.key, end) >= 0 {
+			return false
+		}
+		err = fn(item)
+		return err == nil
+	}
+	if start == nil {
+		r.tree.Ascend(visit)
+	} else {
+		r.tree.AscendGreaterOrEqual(memEntry{key: start}, visit)
+	}
+	return err
+}
+
+func (r memReader) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	start, end := prefixRange(prefix)
+	return r.IterateRange(start, end, fn)
+}
+
+func (r memReader) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return r.ascend(start, end, func(item memEntry) error {
+		return fn(append([]byte(nil), item.key...), append([]byte(nil), item.value...))
+	})
+}
+
+func (r memReader) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	var err error
+	visit := func(item memEntry) bool {
+		if end != nil && bytes.Compare(item.key, end) >= 0 {
+			return true
+		}
+		if start != nil && bytes.Compare(item.key, start) < 0 {
+			return false
+		}
+		err = fn(append([]byte(nil), item.key...), append([]byte(nil), item.value...))
+		return err == nil
+	}
+	if end == nil {
+		r.tree.Descend(visit)
+	} else {
+		r.tree.DescendLessOrEqual(memEntry{key: end}, visit)
+	}
+	return err
+}
+
+func (r memReader) Count(start, end []byte) (int, error) {
+	n := 0
+	err := r.ascend(start, end, func(memEntry) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// memStore is a process-local store over an ordered B-tree. It starts no
+// goroutines and keeps nothing once closed, which suits tests and ephemeral
+// caches.
+type memStore struct {
+	mu   sync.RWMutex
+	tree *btree.BTreeG[memEntry]
+	// commitMu is held shared by every write and exclusively by emulated
+	// transaction commits.
+	commitMu sync.RWMutex
+}
+
+func init() {
+	registerBackend("memory", func(string) (kvStore, error) { return openMemory() })
+}
+
+func openMemory() (kvStore, error) {
+	return &memStore{tree: btree.NewG(memTreeDegree, memEntryLess)}, nil
+}
+
+// clone returns a reader over a copy-on-write clone of the tree. Cloning
+// mutates the source tree's bookkeeping, so it takes the write lock.
+func (s *memStore) clone() memReader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memReader{tree: s.tree.Clone()}
+}
+
+func (s *memStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tree.Clear(false)
+	return nil
+}
+
+func (s *memStore) Set(key, value []byte) error {
+	return s.Apply([]operation{{op: opSet, key: key, value: value}})
+}
+
+func (s *memStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return memReader{tree: s.tree}.Get(key)
+}
+
+func (s *memStore) Has(key []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return memReader{tree: s.tree}.Has(key)
+}
+
+func (s *memStore) Delete(key []byte) error {
+	return s.Apply([]operation{{op: opDelete, key: key}})
+}
+
+func (s *memStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.clone().Iterate(prefix, fn)
+}
+
+func (s *memStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.clone().IterateRange(start, end, fn)
+}
+
+func (s *memStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return s.clone().IterateReverse(start, end, fn)
+}
+
+func (s *memStore) Count(start, end []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return memReader{tree: s.tree}.Count(start, end)
+}
+
+func (s *memStore) Sync() error { return nil }
+
+// Apply validates the whole batch before touching the tree, so a rejected
+// batch leaves no partial writes behind. Keys and values are copied, as
+// callers may reuse their buffers.
+func (s *memStore) Apply(ops []operation) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.apply(ops)
+}
+
+// apply is Apply without commitMu, for commits that already hold it.
+func (s *memStore) apply(ops []operation) error {
+	for _, op := range ops {
+		switch op.op {
+		case opSet, opDelete:
+		case opSetTTL:
+			return errors.New("TTLs are not supported by the memory backend")
+		default:
+			return errors.New("unknown operation code")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range ops {
+		if op.op == opDelete {
+			s.tree.Delete(memEntry{key: op.key})
+			continue
+		}
+		s.tree.ReplaceOrInsert(memEntry{
+			key:   append([]byte{}, op.key...),
+			value: append([]byte{}, op.value...),
+		})
+	}
+	return nil
+}
+
+func (s *memStore) Begin() (kvTxn, error) {
+	return newEmulatedTxn(s, &s.commitMu, s.apply), nil
+}
+
+// memSnapshot is a frozen clone of the tree; taking one is O(1).
+type memSnapshot struct {
+	memReader
+}
+
+func (s *memStore) Snapshot() (kvStore, error) {
+	return &memSnapshot{memReader: s.clone()}, nil
+}
+
+func (s *memSnapshot) Close() error { return nil }
+
+func (s *memSnapshot) Set(key, value []byte) error { return errReadOnly }
+
+func (s *memSnapshot) Delete(key []byte) error { return errReadOnly }
+
+func (s *memSnapshot) Apply(ops []operation) error { return errReadOnly }
+
+func (s *memSnapshot) Begin() (kvTxn, error) { return nil, errReadOnly }
+
+func (s *memSnapshot) Sync() error { return nil }
@@ -0,0 +1,250 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// mergeFunc combines the current value of a key (nil when it is missing)
+// with a merge operand.
+type mergeFunc func(current []byte, found bool, operand []byte) ([]byte, error)
+
+// mergeOperators are the built-in merge functions, by registration name.
+var mergeOperators = map[string]mergeFunc{
+	"append":     mergeAppend,
+	"int-add":    mergeIntAdd,
+	"set-union":  mergeSetUnion,
+	"json-merge": mergeJSON,
+}
+
+func mergeAppend(current []byte, _ bool, operand []byte) ([]byte, error) {
+	return append(append(make([]byte, 0, len(current)+len(operand)), current...), operand...), nil
+}
+
+// mergeIntAdd adds decimal integers, stored as ASCII text as IncrBy does.
+func mergeIntAdd(current []byte, found bool, operand []byte) ([]byte, error) {
+	delta, err := strconv.ParseInt(string(operand), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("operand is not an integer: %w", err)
+	}
+	var n int64
+	if found {
+		if n, err = strconv.ParseInt(string(current), 10, 64); err != nil {
+			return nil, fmt.Errorf("value is not an integer: %w", err)
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return nil, errors.New("increment would overflow")
+	}
+	return strconv.AppendInt(nil, n+delta, 10), nil
+}
+
+// mergeSetUnion treats values and operands as sets of u32 length-prefixed
+// members, the framing GetMany takes, and stores the sorted union.
+func mergeSetUnion(current []byte, _ bool, operand []byte) ([]byte, error) {
+	have, err := decodeKeys(current)
+	if err != nil {
+		return nil, fmt.Errorf("value is not a set: %w", err)
+	}
+	add, err := decodeKeys(operand)
+	if err != nil {
+		return nil, fmt.Errorf("operand is not a set: %w", err)
+	}
+	members := append(have, add...)
+	sort.Slice(members, func(i, j int) bool { return bytes.Compare(members[i], members[j]) < 0 })
+	var out []byte
+	for i, m := range members {
+		if i > 0 && bytes.Equal(m, members[i-1]) {
+			continue
+		}
+		out = appendU32(out, uint32(len(m)))
+		out = append(out, m...)
+	}
+	return out, nil
+}
+
+// mergeJSON applies the operand to the value as an RFC 7386 merge patch,
+// keeping a Python wrapper tag in front of the value.
+func mergeJSON(current []byte, found bool, operand []byte) ([]byte, error) {
+	patch, err := decodeJSON(operand)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	tag := current[:pythonTagLen(current)]
+	if found {
+		if doc, err = decodeJSON(current[len(tag):]); err != nil {
+			return nil, err
+		}
+	}
+	next, err := encodeJSON(mergePatch(doc, patch))
+	if err != nil {
+		return nil, err
+	}
+	return append(bytes.Clone(tag), next...), nil
+}
+
+type mergeRule struct {
+	prefix []byte
+	name   string
+	fn     mergeFunc
+}
+
+// mergeState holds a handle's merge operators. Merges into one key are
+// serialised by its stripe lock rather than run as transactions, so hot
+// accumulator keys never retry.
+type mergeState struct {
+	mu      sync.RWMutex
+	rules   []mergeRule
+	seed    maphash.Seed
+	stripes [64]sync.Mutex
+}
+
+var (
+	mergeMu     sync.Mutex
+	mergeStates = make(map[uintptr]*mergeState)
+)
+
+func mergeStateFor(id uintptr, create bool) *mergeState {
+	mergeMu.Lock()
+	defer mergeMu.Unlock()
+	st, ok := mergeStates[id]
+	if !ok && create {
+		st = &mergeState{seed: maphash.MakeSeed()}
+		mergeStates[id] = st
+	}
+	return st
+}
+
+func forgetMergeOperators(id uintptr) {
+	mergeMu.Lock()
+	defer mergeMu.Unlock()
+	delete(mergeStates, id)
+}
+
+// setRule registers the named operator for keys under prefix, replacing the
+// one already there; an empty name removes it.
+func (st *mergeState) setRule(prefix []byte, name string) error {
+	var fn mergeFunc
+	if name != "" {
+		var ok bool
+		if fn, ok = mergeOperators[name]; !ok {
+			return fmt.Errorf("unknown merge operator %q", name)
+		}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	rules := st.rules[:0:0]
+	for _, r := range st.rules {
+		if !bytes.Equal(r.prefix, prefix) {
+			rules = append(rules, r)
+		}
+	}
+	if fn != nil {
+		rules = append(rules, mergeRule{prefix: prefix, name: name, fn: fn})
+	}
+	st.rules = rules
+	return nil
+}
+
+// operatorFor returns the operator registered under the longest prefix of
+// key.
+func (st *mergeState) operatorFor(key []byte) (mergeFunc, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	var best *mergeRule
+	for i := range st.rules {
+		r := &st.rules[i]
+		if bytes.HasPrefix(key, r.prefix) && (best == nil || len(r.prefix) > len(best.prefix)) {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best.fn, true
+}
+
+// merge applies key's operator to its current value and operand. Merges are
+// atomic with each other; a plain write racing a merge on the same key may
+// be overwritten by it.
+func (st *mergeState) merge(store kvStore, key, operand []byte) error {
+	fn, ok := st.operatorFor(key)
+	if !ok {
+		return fmt.Errorf("no merge operator registered for key %q", key)
+	}
+	stripe := &st.stripes[maphash.Bytes(st.seed, key)%uint64(len(st.stripes))]
+	stripe.Lock()
+	defer stripe.Unlock()
+	current, err := store.Get(key)
+	found := err == nil
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	next, err := fn(current, found, operand)
+	if err != nil {
+		return err
+	}
+	return store.Set(key, next)
+}
+
+// SetMergeOperator registers a built-in merge function for the keys under
+// prefix (every key when prefixLen is 0) on handle: "append", "int-add"
+// (decimal text, like IncrBy), "set-union" (u32 length-prefixed members) or
+// "json-merge" (RFC 7386 merge patches). Keys use the operator with the
+// longest matching prefix. An empty name removes the operator for prefix.
+// Registrations last until the handle is closed.
+//
+//export SetMergeOperator
+func SetMergeOperator(handle C.uintptr_t, prefix *C.char, prefixLen C.int, name *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	if _, err := getHandle(id); err != nil {
+		return setHandleError(id, err)
+	}
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	return setHandleError(id, mergeStateFor(id, true).setRule(pref, C.GoString(name)))
+}
+
+// Merge combines operand into the value at key with the merge operator
+// registered for it, atomically with other merges into the key. Merges take
+// a per-key lock instead of a transaction, so contended accumulator keys
+// never fail or retry with conflicts.
+//
+//export Merge
+func Merge(handle C.uintptr_t, key *C.char, keyLen C.int, operand *C.char, operandLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "merge", time.Now())
+	id := uintptr(handle)
+	store, err := getHandle(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	st := mergeStateFor(id, false)
+	if st == nil {
+		return setHandleError(id, errors.New("no merge operators are registered on this handle"))
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	gotOperand := C.GoBytes(unsafe.Pointer(operand), operandLen)
+	return setHandleError(id, st.merge(store, gotKey, gotOperand))
+}
@@ -0,0 +1,156 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Only backends that keep the byte beside the entry accept meta; framing it
+// into the value would show up in every plain read.
+var errMetaUnsupported = errors.New("metadata bytes are not supported by this backend")
+
+// metaStore is implemented by backends that keep a metadata byte next to each
+// value.
+type metaStore interface {
+	SetWithMeta(key, value []byte, meta byte) error
+	GetWithMeta(key []byte) ([]byte, byte, error)
+}
+
+func setWithMeta(store kvStore, key, value []byte, meta byte) error {
+	if ms, ok := store.(metaStore); ok {
+		return ms.SetWithMeta(key, value, meta)
+	}
+	return errMetaUnsupported
+}
+
+// getWithMeta returns the value for key and its meta byte, which is zero for
+// values written without one and on backends that cannot store it.
+func getWithMeta(store kvStore, key []byte) ([]byte, byte, error) {
+	if ms, ok := store.(metaStore); ok {
+		return ms.GetWithMeta(key)
+	}
+	value, err := store.Get(key)
+	return value, 0, err
+}
+
+func (s *badgerStore) SetWithMeta(key, value []byte, meta byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(key, value).WithMeta(meta))
+	})
+}
+
+func (r *badgerReader) GetWithMeta(key []byte) ([]byte, byte, error) {
+	var (
+		result []byte
+		meta   byte
+	)
+	err := r.view(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		meta = item.UserMeta()
+		result, err = item.ValueCopy(nil)
+		return err
+	})
+	return result, meta, err
+}
+
+// Codecs leave the meta byte alone, so badger keeps it natively underneath
+// them.
+func (s *codecStore) SetWithMeta(key, value []byte, meta byte) error {
+	raw, err := s.codec.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return setWithMeta(s.inner, key, raw, meta)
+}
+
+func (s *codecStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	raw, meta, err := getWithMeta(s.inner, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, err := s.codec.decode(key, raw)
+	return value, meta, err
+}
+
+// The value cache does not hold meta bytes; reads with meta go to inner.
+func (s *cacheStore) SetWithMeta(key, value []byte, meta byte) error {
+	err := setWithMeta(s.inner, key, value, meta)
+	s.invalidate(key)
+	return err
+}
+
+func (s *cacheStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	return getWithMeta(s.inner, key)
+}
+
+// SetWithMeta stores value with a user metadata byte, such as a tag naming
+// the value's encoding. Only backends that keep the byte beside the entry,
+// Badger today, accept it; the rest fail without writing.
+//
+//export SetWithMeta
+func SetWithMeta(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int, meta C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "set_with_meta", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if meta < 0 || meta > 255 {
+		return setHandleError(uintptr(handle), fmt.Errorf("meta %d does not fit in a byte", int(meta)))
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotValue := C.GoBytes(unsafe.Pointer(value), valueLen)
+	if err := setWithMeta(store, gotKey, gotValue, byte(meta)); err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), nil)
+}
+
+// GetWithMeta is Get that also stores the value's metadata byte in meta;
+// values written without one report zero. Release the value with
+// FreeBuffer.
+//
+//export GetWithMeta
+func GetWithMeta(handle C.uintptr_t, key *C.char, keyLen C.int, valueLen *C.int, meta *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "get", time.Now())
+	*meta = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	data, m, err := getWithMeta(store, gotKey)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	buf, err := returnValue(data, valueLen)
+	if err == nil {
+		*meta = C.int(m)
+	}
+	setHandleError(uintptr(handle), err)
+	return buf
+}
@@ -0,0 +1,262 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the operation latency
+// histogram.
+var latencyBuckets = []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type opMetrics struct {
+	count   uint64
+	errors  map[string]uint64
+	buckets []uint64
+	sum     float64
+}
+
+type metricKey struct {
+	handle uintptr
+	op     string
+}
+
+var (
+	metricsEnabled atomic.Bool
+	metricsMu      sync.Mutex
+	opStats        = make(map[metricKey]*opMetrics)
+	metricsServer  *listenerServer
+)
+
+// listenerServer is an http.Server running in the background on ln.
+// http.Server.Close only closes listeners Serve has started tracking, so a
+// server stopped right after it started would keep its port; Close here
+// closes ln as well.
+type listenerServer struct {
+	*http.Server
+	ln net.Listener
+}
+
+func serveInBackground(srv *http.Server, ln net.Listener) *listenerServer {
+	go srv.Serve(ln)
+	return &listenerServer{Server: srv, ln: ln}
+}
+
+func (s *listenerServer) Close() error {
+	err := s.Server.Close()
+	s.ln.Close()
+	return err
+}
+
+// observe records one call of op on a store handle, classifying the outcome
+// by the handle's recorded error state. Call it deferred with the start time
+// evaluated up front:
+//
+//	defer observe(uintptr(handle), "get", time.Now())
+//
+// Outcomes of concurrent calls on the same handle can be misattributed, as
+// they share that state.
+func observe(id uintptr, op string, start time.Time) {
+	if !metricsEnabled.Load() {
+		return
+	}
+	if _, err := getHandle(id); err != nil {
+		// Calls on unknown or closed handles would create series nothing
+		// ever removes.
+		return
+	}
+	elapsed := time.Since(start).Seconds()
+	errorMu.Lock()
+	code := handleErrors[id].code
+	errorMu.Unlock()
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	key := metricKey{handle: id, op: op}
+	m := opStats[key]
+	if m == nil {
+		m = &opMetrics{errors: make(map[string]uint64), buckets: make([]uint64, len(latencyBuckets))}
+		opStats[key] = m
+	}
+	m.count++
+	m.sum += elapsed
+	for i, bound := range latencyBuckets {
+		if elapsed <= bound {
+			m.buckets[i]++
+		}
+	}
+	if code != codeOK {
+		m.errors[codeName(code)]++
+	}
+}
+
+func codeName(code C.int) string {
+	switch code {
+	case codeNotFound:
+		return "not_found"
+	case codeConflict:
+		return "conflict"
+	case codeInvalidHandle:
+		return "invalid_handle"
+	case codeClosed:
+		return "closed"
+	case codeCorrupt:
+		return "corrupt"
+	case codePanic:
+		return "panic"
+	case codeQuota:
+		return "quota_exceeded"
+	case codeThrottled:
+		return "throttled"
+	case codeTooLarge:
+		return "too_large"
+	default:
+		return "error"
+	}
+}
+
+func forgetMetrics(id uintptr) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	for key := range opStats {
+		if key.handle == id {
+			delete(opStats, key)
+		}
+	}
+}
+
+// writeMetrics renders every series in the Prometheus text exposition format.
+func writeMetrics(w io.Writer) {
+	metricsMu.Lock()
+	keys := make([]metricKey, 0, len(opStats))
+	for key := range opStats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].handle != keys[j].handle {
+			return keys[i].handle < keys[j].handle
+		}
+		return keys[i].op < keys[j].op
+	})
+
+	fmt.Fprintln(w, "# HELP skyshelve_operations_total Exported calls per store handle and operation.")
+	fmt.Fprintln(w, "# TYPE skyshelve_operations_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "skyshelve_operations_total{handle=\"%d\",op=\"%s\"} %d\n", key.handle, key.op, opStats[key].count)
+	}
+	fmt.Fprintln(w, "# HELP skyshelve_operation_errors_total Failed calls per store handle, operation and error code.")
+	fmt.Fprintln(w, "# TYPE skyshelve_operation_errors_total counter")
+	for _, key := range keys {
+		m := opStats[key]
+		codes := make([]string, 0, len(m.errors))
+		for code := range m.errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "skyshelve_operation_errors_total{handle=\"%d\",op=\"%s\",code=\"%s\"} %d\n", key.handle, key.op, code, m.errors[code])
+		}
+	}
+	fmt.Fprintln(w, "# HELP skyshelve_operation_duration_seconds Latency of exported calls.")
+	fmt.Fprintln(w, "# TYPE skyshelve_operation_duration_seconds histogram")
+	for _, key := range keys {
+		m := opStats[key]
+		labels := fmt.Sprintf("handle=\"%d\",op=\"%s\"", key.handle, key.op)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "skyshelve_operation_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, bound, m.buckets[i])
+		}
+		fmt.Fprintf(w, "skyshelve_operation_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, m.count)
+		fmt.Fprintf(w, "skyshelve_operation_duration_seconds_sum{%s} %g\n", labels, m.sum)
+		fmt.Fprintf(w, "skyshelve_operation_duration_seconds_count{%s} %d\n", labels, m.count)
+	}
+	metricsMu.Unlock()
+
+	writeBackendMetrics(w)
+}
+
+// writeBackendMetrics exports the size figures from Stats for every open
+// store handle.
+func writeBackendMetrics(w io.Writer) {
+	stores := loadHandles()
+	ids := make([]uintptr, 0, len(stores))
+	for id := range stores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	fmt.Fprintln(w, "# HELP skyshelve_store_size_bytes Backend-reported store size by component.")
+	fmt.Fprintln(w, "# TYPE skyshelve_store_size_bytes gauge")
+	for _, id := range ids {
+		stats, err := collectStats(stores[id])
+		if err != nil {
+			continue
+		}
+		if stats.LSMSize != nil {
+			fmt.Fprintf(w, "skyshelve_store_size_bytes{handle=\"%d\",backend=\"%s\",component=\"lsm\"} %d\n", id, stats.Backend, *stats.LSMSize)
+		}
+		if stats.VlogSize != nil {
+			fmt.Fprintf(w, "skyshelve_store_size_bytes{handle=\"%d\",backend=\"%s\",component=\"vlog\"} %d\n", id, stats.Backend, *stats.VlogSize)
+		}
+	}
+}
+
+// StartMetricsServer serves Prometheus metrics on http://addr/metrics until
+// StopMetricsServer is called. Operation metrics are only collected while the
+// server runs.
+//
+//export StartMetricsServer
+func StartMetricsServer(addr *C.char) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if metricsServer != nil {
+		return setError(errors.New("metrics server is already running"))
+	}
+	ln, err := net.Listen("tcp", C.GoString(addr))
+	if err != nil {
+		return setError(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	metricsServer = serveInBackground(&http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}, ln)
+	metricsEnabled.Store(true)
+	return setError(nil)
+}
+
+//export StopMetricsServer
+func StopMetricsServer() (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	return setError(stopMetricsServer())
+}
+
+var errMetricsNotRunning = errors.New("metrics server is not running")
+
+func stopMetricsServer() error {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if metricsServer == nil {
+		return errMetricsNotRunning
+	}
+	metricsEnabled.Store(false)
+	err := metricsServer.Close()
+	metricsServer = nil
+	opStats = make(map[metricKey]*opMetrics)
+	return err
+}
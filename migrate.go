@@ -0,0 +1,157 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+const migrateBatchSize = 1000
+
+// migrationProgress is updated as a migration runs so other host threads can
+// poll it with MigrateProgress.
+type migrationProgress struct {
+	copied   int64
+	verified int64
+}
+
+var (
+	migrationMu sync.Mutex
+	migrations  = make(map[uintptr]*migrationProgress)
+)
+
+func setMigrationProgress(id uintptr, p migrationProgress) {
+	migrationMu.Lock()
+	defer migrationMu.Unlock()
+	migrations[id] = &p
+}
+
+func forgetMigration(id uintptr) {
+	migrationMu.Lock()
+	defer migrationMu.Unlock()
+	delete(migrations, id)
+}
+
+// migrateStore copies every entry of src into dst in batches, then re-reads
+// src and checks each entry against dst. Writes to src while the migration
+// runs are not copied reliably and make the verify pass fail. TTLs are not
+// carried over.
+func migrateStore(src, dst kvStore, progress func(migrationProgress)) (migrationProgress, error) {
+	var p migrationProgress
+	ops := make([]operation, 0, migrateBatchSize)
+	flush := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		if err := dst.Apply(ops); err != nil {
+			return err
+		}
+		p.copied += int64(len(ops))
+		ops = ops[:0]
+		progress(p)
+		return nil
+	}
+	err := src.IterateRange(nil, nil, func(k, v []byte) error {
+		ops = append(ops, operation{op: opSet, key: k, value: v})
+		if len(ops) < migrateBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return p, fmt.Errorf("migration copy failed after %d entries: %w", p.copied, err)
+	}
+	if err := dst.Sync(); err != nil {
+		return p, err
+	}
+
+	var keys, values [][]byte
+	verify := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		results, err := getMany(dst, keys)
+		if err != nil {
+			return err
+		}
+		for i, res := range results {
+			if !res.found || !bytes.Equal(res.value, values[i]) {
+				return fmt.Errorf("migration verify failed at key %q", keys[i])
+			}
+		}
+		p.verified += int64(len(keys))
+		keys, values = keys[:0], values[:0]
+		progress(p)
+		return nil
+	}
+	err = src.IterateRange(nil, nil, func(k, v []byte) error {
+		keys = append(keys, k)
+		values = append(values, v)
+		if len(keys) < migrateBatchSize {
+			return nil
+		}
+		return verify()
+	})
+	if err == nil {
+		err = verify()
+	}
+	return p, err
+}
+
+// Migrate copies every entry of the store behind srcHandle into the store at
+// dstURI (any location accepted by Open), then verifies the copy. The source
+// stays open and readable throughout, but should not be written to until the
+// migration finishes. The number of entries copied is stored in copied, even
+// on failure.
+//
+//export Migrate
+func Migrate(srcHandle C.uintptr_t, dstURI *C.char, copied *C.int64_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	*copied = 0
+	id := uintptr(srcHandle)
+	src, err := getHandle(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	dst, err := openStore(C.GoString(dstURI), false)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+
+	setMigrationProgress(id, migrationProgress{})
+	p, err := migrateStore(src, dst, func(p migrationProgress) {
+		setMigrationProgress(id, p)
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	*copied = C.int64_t(p.copied)
+	return setHandleError(id, err)
+}
+
+// MigrateProgress reports how many entries the latest Migrate on srcHandle
+// has copied and verified so far. It can be called from another thread while
+// Migrate runs.
+//
+//export MigrateProgress
+func MigrateProgress(srcHandle C.uintptr_t, copied *C.int64_t, verified *C.int64_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	migrationMu.Lock()
+	p, ok := migrations[uintptr(srcHandle)]
+	migrationMu.Unlock()
+	if !ok {
+		return setError(fmt.Errorf("no migration has run on handle %d", uintptr(srcHandle)))
+	}
+	*copied = C.int64_t(p.copied)
+	*verified = C.int64_t(p.verified)
+	return setError(nil)
+}
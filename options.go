@@ -0,0 +1,419 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/options"
+	slatedb "slatedb.io/slatedb-go"
+)
+
+// openOptions is the JSON document accepted by OpenWithOptions. Unknown
+// fields are rejected so misspelt tuning knobs fail loudly.
+type openOptions struct {
+	// Backend selects the store: "badger" (default), "slatedb", "bolt",
+	// "sqlite", "lmdb", "tiered" or "memory".
+	Backend  string           `json:"backend,omitempty"`
+	Path     string           `json:"path,omitempty"`
+	InMemory bool             `json:"in_memory,omitempty"`
+	Badger   *badgerConfig    `json:"badger,omitempty"`
+	SlateDB  *slateOpenConfig `json:"slatedb,omitempty"`
+	LMDB     *lmdbConfig      `json:"lmdb,omitempty"`
+	Tiered   *tieredConfig    `json:"tiered,omitempty"`
+	// Encryption, Compression and Checksums apply to every backend. Values
+	// are checksummed, then compressed, then encrypted.
+	Encryption  *encryptionConfig  `json:"encryption,omitempty"`
+	Compression *compressionConfig `json:"compression,omitempty"`
+	Checksums   bool               `json:"checksums,omitempty"`
+	// RateLimit caps writes made through the handle.
+	RateLimit *rateLimitConfig `json:"rate_limit,omitempty"`
+	// Cache keeps recently read values, and keys found missing, in memory in
+	// front of the codecs.
+	Cache *cacheConfig `json:"cache,omitempty"`
+	// Indexes maintains the secondary indexes made with CreateIndex.
+	Indexes bool `json:"indexes,omitempty"`
+	// SoftDelete moves deleted entries to a trash for Undelete.
+	SoftDelete *softDeleteConfig `json:"soft_delete,omitempty"`
+	// Audit records every write in a hash-chained log for AuditScan.
+	Audit bool `json:"audit,omitempty"`
+	// MaxKeySize and MaxValueSize reject writes with a longer key or value,
+	// in bytes.
+	MaxKeySize   int `json:"max_key_size,omitempty"`
+	MaxValueSize int `json:"max_value_size,omitempty"`
+	// GroupCommit coalesces concurrent writes into shared batches.
+	GroupCommit *groupCommitConfig `json:"group_commit,omitempty"`
+	// ChangeLog numbers every write and records it for ChangesSince. CDC
+	// turns it on and ships the log to a webhook or file.
+	ChangeLog bool       `json:"change_log,omitempty"`
+	CDC       *cdcConfig `json:"cdc,omitempty"`
+	// CheckpointDir is where CreateCheckpoint keeps named checkpoints.
+	CheckpointDir string `json:"checkpoint_dir,omitempty"`
+}
+
+// badgerConfig holds the badger tuning knobs exposed to hosts. Zero values
+// keep badger's defaults.
+type badgerConfig struct {
+	ValueLogFileSize int64 `json:"value_log_file_size,omitempty"`
+	// Compression is one of "none", "snappy" or "zstd".
+	Compression    string `json:"compression,omitempty"`
+	SyncWrites     *bool  `json:"sync_writes,omitempty"`
+	BlockCacheSize int64  `json:"block_cache_size,omitempty"`
+	IndexCacheSize int64  `json:"index_cache_size,omitempty"`
+	// GCInterval runs value-log GC in the background, as a Go duration
+	// string. GCDiscardRatio is the stale fraction a value-log file needs
+	// before GC rewrites it, for both background runs and Compact.
+	GCInterval     string  `json:"gc_interval,omitempty"`
+	GCDiscardRatio float64 `json:"gc_discard_ratio,omitempty"`
+	// NumVersionsToKeep is how many versions of each key compaction keeps
+	// for GetAt and ScanAt.
+	NumVersionsToKeep int `json:"num_versions_to_keep,omitempty"`
+}
+
+func (c *badgerConfig) apply(opts badger.Options) (badger.Options, error) {
+	if c.ValueLogFileSize > 0 {
+		opts = opts.WithValueLogFileSize(c.ValueLogFileSize)
+	}
+	switch strings.ToLower(c.Compression) {
+	case "":
+	case "none":
+		opts = opts.WithCompression(options.None)
+	case "snappy":
+		opts = opts.WithCompression(options.Snappy)
+	case "zstd":
+		opts = opts.WithCompression(options.ZSTD)
+	default:
+		return opts, fmt.Errorf("unknown badger compression %q", c.Compression)
+	}
+	if c.SyncWrites != nil {
+		opts = opts.WithSyncWrites(*c.SyncWrites)
+	}
+	if c.BlockCacheSize > 0 {
+		opts = opts.WithBlockCacheSize(c.BlockCacheSize)
+	}
+	if c.IndexCacheSize > 0 {
+		opts = opts.WithIndexCacheSize(c.IndexCacheSize)
+	}
+	if c.NumVersionsToKeep < 0 {
+		return opts, fmt.Errorf("num_versions_to_keep must not be negative")
+	}
+	if c.NumVersionsToKeep > 0 {
+		opts = opts.WithNumVersionsToKeep(c.NumVersionsToKeep)
+	}
+	return opts, nil
+}
+
+// awsCredentials are exported to the standard AWS environment variables,
+// which is where the SlateDB object-store client reads them from. They are
+// process-wide, so stores opened later without credentials reuse them.
+type awsCredentials struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty"`
+}
+
+func (c *awsCredentials) export() {
+	if c == nil {
+		return
+	}
+	os.Setenv("AWS_ACCESS_KEY_ID", c.AccessKeyID)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", c.SecretAccessKey)
+	if c.SessionToken != "" {
+		os.Setenv("AWS_SESSION_TOKEN", c.SessionToken)
+	}
+}
+
+// slateOptions builds the SlateDB tuning options, or nil when every knob is
+// left at its default.
+func (c *slateOpenConfig) slateOptions() (*slatedb.SlateDBOptions, error) {
+	if c.FlushInterval == "" && c.CacheDir == "" {
+		return nil, nil
+	}
+	opts := &slatedb.SlateDBOptions{CacheFolder: c.CacheDir}
+	if c.FlushInterval != "" {
+		interval, err := time.ParseDuration(c.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flush_interval: %w", err)
+		}
+		opts.FlushInterval = interval
+	}
+	return opts, nil
+}
+
+func parseOpenOptions(raw string) (*openOptions, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	var opts openOptions
+	if err := dec.Decode(&opts); err != nil {
+		return nil, fmt.Errorf("invalid open options: %w", err)
+	}
+	return &opts, nil
+}
+
+// checkSections rejects option sections that belong to a backend other than
+// the one being opened.
+func (o *openOptions) checkSections(backend string) error {
+	sections := []struct {
+		name string
+		set  bool
+	}{
+		{"badger", o.Badger != nil},
+		{"slatedb", o.SlateDB != nil},
+		{"lmdb", o.LMDB != nil},
+		{"tiered", o.Tiered != nil},
+	}
+	for _, sec := range sections {
+		if sec.set && sec.name != backend {
+			return fmt.Errorf("%s options given for the %s backend", sec.name, backend)
+		}
+	}
+	if o.InMemory && backend != "badger" && backend != "memory" {
+		return fmt.Errorf("the %s backend does not support in_memory", backend)
+	}
+	return nil
+}
+
+// mergePath folds the top-level path into a backend section's own path.
+func mergePath(section *string, path string) error {
+	if path == "" {
+		return nil
+	}
+	if *section != "" && *section != path {
+		return fmt.Errorf("conflicting paths %q and %q", path, *section)
+	}
+	*section = path
+	return nil
+}
+
+func openWithOptions(opts *openOptions) (kvStore, error) {
+	backend := strings.ToLower(opts.Backend)
+	if backend == "" {
+		backend = "badger"
+	}
+	if err := opts.checkSections(backend); err != nil {
+		return nil, err
+	}
+	store, err := openBackend(backend, opts)
+	if err != nil {
+		return nil, err
+	}
+	return wrapStore(store, backend, opts)
+}
+
+// wrapStore layers the value codecs requested by opts over store. Badger
+// encrypts natively. Compression goes above encryption, as ciphertext does
+// not compress, and checksums go above both so they cover the value the host
+// wrote. The value cache goes above the codecs so hits skip decoding, index
+// upkeep above the cache, the trash above that so trashing a value removes
+// its index entries, and the audit log above the trash so it records deletes
+// as the host made them. Size limits are checked above every layer that adds
+// to a write. The change log goes above them, so its records pass through the
+// codecs too. The rate limiter goes outermost, so it counts the host's writes
+// and not the records the layers below add to them.
+func wrapStore(store kvStore, backend string, opts *openOptions) (_ kvStore, err error) {
+	// On failure close the stack built so far, which stops the goroutines
+	// its layers started and closes the backend too.
+	defer func() {
+		if err != nil {
+			store.Close()
+		}
+	}()
+	var next kvStore
+	if opts.Encryption != nil && backend != "badger" {
+		if next, err = newEncryptedStore(store, opts.Encryption); err != nil {
+			return nil, err
+		}
+		store = next
+	}
+	if opts.Compression != nil {
+		if next, err = newCompressedStore(store, opts.Compression); err != nil {
+			return nil, err
+		}
+		store = next
+	}
+	if opts.Checksums {
+		store = &codecStore{inner: store, codec: checksummer{}}
+	}
+	if opts.Cache != nil {
+		if next, err = newCacheStore(store, opts.Cache); err != nil {
+			return nil, err
+		}
+		store = next
+	}
+	if opts.Indexes {
+		if next, err = newIndexStore(store); err != nil {
+			return nil, err
+		}
+		store = next
+	}
+	if opts.SoftDelete != nil {
+		if next, err = newTrashStore(store, opts.SoftDelete); err != nil {
+			return nil, err
+		}
+		store = next
+	}
+	if opts.Audit {
+		if next, err = newAuditStore(store); err != nil {
+			return nil, err
+		}
+		store = next
+	}
+	if opts.MaxKeySize != 0 || opts.MaxValueSize != 0 {
+		if next, err = newSizeLimitStore(store, opts.MaxKeySize, opts.MaxValueSize); err != nil {
+			return nil, err
+		}
+		store = next
+	}
+	if opts.ChangeLog || opts.CDC != nil {
+		log, err := newChangeLogStore(store)
+		if err != nil {
+			return nil, err
+		}
+		store = log
+		if opts.CDC != nil {
+			if err := log.startCDC(opts.CDC); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opts.RateLimit != nil {
+		limiter, err := newRateLimiter(opts.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		store = &rateLimitStore{inner: store, limiter: limiter}
+	}
+	return store, nil
+}
+
+// layer is a store that wrapStore stacks over another one without changing
+// its keys.
+type layer interface {
+	unwrap() kvStore
+}
+
+// layerOf finds the first store of type T in the stack starting at store.
+func layerOf[T kvStore](store kvStore) (T, bool) {
+	for {
+		if found, ok := store.(T); ok {
+			return found, true
+		}
+		l, ok := store.(layer)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		store = l.unwrap()
+	}
+}
+
+// backendOf strips the layers stacked over a backend by wrapStore.
+func backendOf(store kvStore) kvStore {
+	for {
+		l, ok := store.(layer)
+		if !ok {
+			return store
+		}
+		store = l.unwrap()
+	}
+}
+
+func openBackend(backend string, opts *openOptions) (kvStore, error) {
+	path := strings.TrimSpace(opts.Path)
+	switch backend {
+	case "badger":
+		return openBadgerConfig(path, opts.InMemory, opts.Badger, opts.Encryption)
+	case "slatedb":
+		cfg := opts.SlateDB
+		if cfg == nil {
+			cfg = &slateOpenConfig{}
+		}
+		if err := mergePath(&cfg.Path, opts.Path); err != nil {
+			return nil, err
+		}
+		return openSlateConfig(cfg)
+	case "bolt":
+		return openBoltFile(path)
+	case "sqlite":
+		return openSqliteFile(path)
+	case "lmdb":
+		cfg := opts.LMDB
+		if cfg == nil {
+			cfg = &lmdbConfig{}
+		}
+		if err := mergePath(&cfg.Path, opts.Path); err != nil {
+			return nil, err
+		}
+		return openLmdbConfig(cfg)
+	case "tiered":
+		if opts.Tiered == nil {
+			return nil, fmt.Errorf("the tiered backend needs a tiered section")
+		}
+		if err := mergePath(&opts.Tiered.Hot, opts.Path); err != nil {
+			return nil, err
+		}
+		return openTieredConfig(opts.Tiered)
+	case "memory":
+		if path != "" {
+			return nil, fmt.Errorf("the memory backend does not take a path")
+		}
+		return openMemory()
+	default:
+		if open, ok := lookupBackend(backend + ":"); ok {
+			return open(backend + ":" + path)
+		}
+		return nil, fmt.Errorf("unknown backend %q", opts.Backend)
+	}
+}
+
+// OpenWithOptions opens a store described by a JSON options document, e.g.
+//
+//	{"backend": "badger", "path": "data", "badger": {"compression": "zstd"}}
+//
+//export OpenWithOptions
+func OpenWithOptions(jsonOptions *C.char) (ret C.uintptr_t) {
+	defer recoverExport(0, &ret, 0)
+	opts, err := parseOpenOptions(C.GoString(jsonOptions))
+	if err != nil {
+		setError(err)
+		return 0
+	}
+	var (
+		maxBatch int
+		maxDelay time.Duration
+	)
+	if opts.GroupCommit != nil {
+		if maxBatch, maxDelay, err = opts.GroupCommit.settings(); err != nil {
+			setError(err)
+			return 0
+		}
+	}
+	store, err := openWithOptions(opts)
+	if err != nil {
+		setError(err)
+		return 0
+	}
+
+	id := storeHandle(store)
+	info := describeOptions(opts)
+	describeHandle(id, info)
+	if opts.GroupCommit != nil {
+		handleStore, _ := getHandle(id)
+		startGroupCommit(id, handleStore, maxBatch, maxDelay)
+	}
+	if opts.CheckpointDir != "" {
+		setCheckpointDir(id, opts.CheckpointDir, codecsOf(opts, info.Backend))
+	}
+	setError(nil)
+	return C.uintptr_t(id)
+}
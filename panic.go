@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// errPanic marks a panic caught at the cgo boundary.
+var errPanic = errors.New("panic")
+
+func panicError(r any) error {
+	return fmt.Errorf("%w: %v\n%s", errPanic, r, debug.Stack())
+}
+
+func recordPanic(id uintptr, r any) {
+	err := panicError(r)
+	logf(logError, "skyshelve", "%v", err)
+	if id == 0 {
+		setError(err)
+		return
+	}
+	setHandleError(id, err)
+}
+
+// recoverExport is deferred first thing in every export taking a store
+// handle (id 0 for the rest), so a panic in a backend or a decoder cannot
+// unwind across cgo and kill the host. The export returns fail instead, and
+// LastError carries the panic value and stack.
+func recoverExport[T any](id uintptr, result *T, fail T) {
+	if r := recover(); r != nil {
+		recordPanic(id, r)
+		*result = fail
+	}
+}
+
+// recoverVoid is recoverExport for exports without a result.
+func recoverVoid(id uintptr) {
+	if r := recover(); r != nil {
+		recordPanic(id, r)
+	}
+}
+
+// safeApply runs store.Apply on a background goroutine, where a panic would
+// otherwise take the host down with nobody to report it to.
+func safeApply(store kvStore, ops []operation) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	return store.Apply(ops)
+}
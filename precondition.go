@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Precondition codes extend the Apply encoding. They share its framing: a
+// code, a u32 key length and the key, plus a u32 value length and the value
+// for opRequireEqual. They can appear anywhere in a batch and are all checked
+// before any write in it is applied.
+const (
+	opRequireExists byte = 6
+	opRequireAbsent byte = 7
+	opRequireEqual  byte = 8
+)
+
+var errPreconditionsUnsupported = errors.New("preconditions are only supported by Apply")
+
+func isPrecondition(op byte) bool {
+	return op == opRequireExists || op == opRequireAbsent || op == opRequireEqual
+}
+
+// preconditionError reports the first precondition of a batch that did not
+// hold. It matches errConflict.
+type preconditionError struct {
+	index int
+	key   []byte
+	want  string
+}
+
+func (e *preconditionError) Error() string {
+	return fmt.Sprintf("precondition %d failed: key %q %s", e.index, e.key, e.want)
+}
+
+func (e *preconditionError) Is(target error) bool { return target == errConflict }
+
+func hasPreconditions(ops []operation) bool {
+	for _, op := range ops {
+		if isPrecondition(op.op) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrecondition returns nil when op holds against the value read in txn.
+func checkPrecondition(txn kvTxn, index int, op operation) error {
+	current, err := txn.Get(op.key)
+	found := true
+	if isNotFound(err) {
+		found = false
+	} else if err != nil {
+		return err
+	}
+	switch {
+	case op.op == opRequireExists && !found:
+		return &preconditionError{index: index, key: op.key, want: "must exist"}
+	case op.op == opRequireAbsent && found:
+		return &preconditionError{index: index, key: op.key, want: "must not exist"}
+	case op.op == opRequireEqual && (!found || !bytes.Equal(current, op.value)):
+		return &preconditionError{index: index, key: op.key, want: "must equal the expected value"}
+	}
+	return nil
+}
+
+// applyConditional applies the writes in ops in one transaction if every
+// precondition in ops holds, retrying when the transaction itself loses a
+// race. A failed precondition is not retried.
+func applyConditional(store kvStore, ops []operation) error {
+	var failed error
+	err := retryConflicts(func() error {
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+
+		failed = nil
+		for i, op := range ops {
+			if !isPrecondition(op.op) {
+				continue
+			}
+			if err := checkPrecondition(txn, i, op); err != nil {
+				var pe *preconditionError
+				if errors.As(err, &pe) {
+					failed = err
+					return nil
+				}
+				return err
+			}
+		}
+		for _, op := range ops {
+			switch op.op {
+			case opSet:
+				err = txn.Set(op.key, op.value)
+			case opDelete:
+				err = txn.Delete(op.key)
+			case opSetTTL:
+				err = errors.New("TTL writes cannot be combined with preconditions")
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return txn.Commit()
+	})
+	if err != nil {
+		return err
+	}
+	return failed
+}
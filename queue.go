@@ -0,0 +1,234 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/maphash"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// A queue keeps its items under queuePrefix and its u32 length-prefixed
+// name. 'r' + visible-at + id holds an item's value, ordered by the Unix
+// millisecond time it may next be popped (zero for items never popped) and
+// then by id; 'l' + id holds the item's current visible-at, so an
+// acknowledgement finds the item from its id alone. Ids come from the
+// queue's sequence, so pushes are ordered without a shared counter key.
+var queuePrefix = []byte("\xffq/")
+
+// queueSequenceBandwidth is how many ids a queue's sequence leases at once.
+const queueSequenceBandwidth = 1000
+
+var (
+	queueSeed  = maphash.MakeSeed()
+	queueLocks [64]sync.Mutex
+)
+
+func queueBase(name []byte, kind byte) []byte {
+	return append(appendLenPrefixed(append([]byte(nil), queuePrefix...), name), kind)
+}
+
+func queueItemKey(name []byte, visibleAt int64, id uint64) []byte {
+	key := binary.BigEndian.AppendUint64(queueBase(name, 'r'), uint64(visibleAt))
+	return binary.BigEndian.AppendUint64(key, id)
+}
+
+func queueLeaseKey(name []byte, id uint64) []byte {
+	return binary.BigEndian.AppendUint64(queueBase(name, 'l'), id)
+}
+
+// queuePush appends value to the named queue and returns its id.
+func queuePush(handle uintptr, store kvStore, name, value []byte) (uint64, error) {
+	seq, err := getSequence(handle, store, "queue/"+string(name), queueSequenceBandwidth)
+	if err != nil {
+		return 0, err
+	}
+	id, err := seq.Next()
+	if err != nil {
+		return 0, err
+	}
+	return id, store.Apply([]operation{
+		{op: opSet, key: queueItemKey(name, 0, id), value: value},
+		{op: opSet, key: queueLeaseKey(name, id), value: binary.BigEndian.AppendUint64(nil, 0)},
+	})
+}
+
+// queuePop takes the oldest visible item from the named queue. With a
+// positive timeout the item stays queued but hidden until the timeout
+// passes, and is popped again unless acknowledged first; otherwise it is
+// removed. An empty queue returns badger.ErrKeyNotFound.
+func queuePop(store kvStore, name []byte, timeout time.Duration) (value []byte, id uint64, err error) {
+	// Pops in this process take turns, so they do not all race for the
+	// same head item; the transaction guards against other processes.
+	lock := &queueLocks[maphash.Bytes(queueSeed, name)%uint64(len(queueLocks))]
+	lock.Lock()
+	defer lock.Unlock()
+
+	base := queueBase(name, 'r')
+	for {
+		now := time.Now()
+		var head []byte
+		end := binary.BigEndian.AppendUint64(append([]byte(nil), base...), uint64(now.UnixMilli()+1))
+		err := store.IterateRange(base, end, func(k, _ []byte) error {
+			head = append([]byte(nil), k...)
+			return errStopIteration
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, 0, err
+		}
+		if head == nil {
+			return nil, 0, badger.ErrKeyNotFound
+		}
+		id = binary.BigEndian.Uint64(head[len(base)+8:])
+		value, err = takeQueueItem(store, name, head, id, now, timeout)
+		if isNotFound(err) || errors.Is(err, errConflict) {
+			// Another process took the item first.
+			continue
+		}
+		return value, id, err
+	}
+}
+
+func takeQueueItem(store kvStore, name, head []byte, id uint64, now time.Time, timeout time.Duration) ([]byte, error) {
+	txn, err := beginTxn(store)
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Discard()
+
+	value, err := txn.Get(head)
+	if err != nil {
+		return nil, err
+	}
+	if err := txn.Delete(head); err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		visibleAt := now.Add(timeout).UnixMilli()
+		if err := txn.Set(queueItemKey(name, visibleAt, id), value); err != nil {
+			return nil, err
+		}
+		err = txn.Set(queueLeaseKey(name, id), binary.BigEndian.AppendUint64(nil, uint64(visibleAt)))
+	} else {
+		err = txn.Delete(queueLeaseKey(name, id))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, txn.Commit()
+}
+
+// queueAck removes a popped item for good, reporting whether it was still
+// queued.
+func queueAck(store kvStore, name []byte, id uint64) (bool, error) {
+	var acked bool
+	err := retryConflicts(func() error {
+		acked = false
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+
+		lease, err := txn.Get(queueLeaseKey(name, id))
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(lease) != 8 {
+			return errors.New("malformed queue lease")
+		}
+		visibleAt := int64(binary.BigEndian.Uint64(lease))
+		if err := txn.Delete(queueItemKey(name, visibleAt, id)); err != nil {
+			return err
+		}
+		if err := txn.Delete(queueLeaseKey(name, id)); err != nil {
+			return err
+		}
+		acked = true
+		return txn.Commit()
+	})
+	return acked, err
+}
+
+// QueuePush appends value to the durable queue called queue and stores the
+// item's id in id.
+//
+//export QueuePush
+func QueuePush(handle C.uintptr_t, queue *C.char, value *C.char, valueLen C.int, id *C.uint64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "queue_push", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotValue := C.GoBytes(unsafe.Pointer(value), valueLen)
+
+	n, err := queuePush(uintptr(handle), store, []byte(C.GoString(queue)), gotValue)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	*id = C.uint64_t(n)
+	return setHandleError(uintptr(handle), nil)
+}
+
+// QueuePop takes the oldest visible item from queue and stores its id in id.
+// With a positive visibilityTimeoutMs the item is delivered at least once:
+// it is hidden for that long and then popped again unless QueueAck removes
+// it first. Otherwise the item is removed as it is returned. An empty queue
+// returns NULL with the not-found status. Release the value with FreeBuffer.
+//
+//export QueuePop
+func QueuePop(handle C.uintptr_t, queue *C.char, visibilityTimeoutMs C.int64_t, valueLen *C.int, id *C.uint64_t) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "queue_pop", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	timeout := time.Duration(visibilityTimeoutMs) * time.Millisecond
+	value, n, err := queuePop(store, []byte(C.GoString(queue)), timeout)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*id = C.uint64_t(n)
+	buf, err := returnValue(value, valueLen)
+	setHandleError(uintptr(handle), err)
+	return buf
+}
+
+// QueueAck removes the item with id from queue once its consumer is done
+// with it. Returns 1 when the item was removed, 0 when it was already gone
+// and a negative status code on error.
+//
+//export QueueAck
+func QueueAck(handle C.uintptr_t, queue *C.char, id C.uint64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	acked, err := queueAck(store, []byte(C.GoString(queue)), uint64(id))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	setHandleError(uintptr(handle), nil)
+	if acked {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,301 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// quotaError reports which bucket limit a write would have broken. It
+// matches errQuotaExceeded.
+type quotaError struct {
+	bucket string
+	limit  string
+	max    int64
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("bucket %q quota exceeded: %s limit is %d", e.bucket, e.limit, e.max)
+}
+
+func (e *quotaError) Is(target error) bool { return target == errQuotaExceeded }
+
+// bucketMeta is stored as the value of a bucket's marker record. Zero limits
+// are unlimited.
+type bucketMeta struct {
+	MaxKeys  int64 `json:"max_keys,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+}
+
+// bucketUsage tracks a bucket's key count and size (keys plus values, as the
+// host sees them) while it has a quota. It is shared by every handle on the
+// same bucket. Writes that bypass the counters (transactions, range
+// deletes, TTL expiry) mark it stale, and the next quota check rescans.
+type bucketUsage struct {
+	mu     sync.Mutex
+	name   string
+	limits bucketMeta
+	loaded bool
+	keys   int64
+	bytes  int64
+}
+
+type usageKey struct {
+	root   kvStore
+	prefix string
+}
+
+var (
+	usageMu sync.Mutex
+	usages  = make(map[usageKey]*bucketUsage)
+)
+
+// physical returns the store under every bucket layer and the full key
+// prefix s writes under, which identify the bucket across handles.
+func (s *bucketStore) physical() (kvStore, string) {
+	prefix := string(s.prefix)
+	store := s.inner
+	for {
+		if n, ok := store.(*notifyStore); ok {
+			store = n.inner
+			continue
+		}
+		b, ok := store.(*bucketStore)
+		if !ok {
+			return store, prefix
+		}
+		prefix = string(b.prefix) + prefix
+		store = b.inner
+	}
+}
+
+func bucketUsageFor(s *bucketStore, name string) *bucketUsage {
+	root, prefix := s.physical()
+	key := usageKey{root: root, prefix: prefix}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	u, ok := usages[key]
+	if !ok {
+		u = &bucketUsage{name: name}
+		usages[key] = u
+	}
+	return u
+}
+
+// forgetBucketUsage drops the usage of every bucket on a closing store.
+func forgetBucketUsage(root kvStore) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	for key := range usages {
+		if key.root == root {
+			delete(usages, key)
+		}
+	}
+}
+
+func (u *bucketUsage) setLimits(meta bucketMeta) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.limits = meta
+	u.loaded = false
+}
+
+func (u *bucketUsage) limited() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.limits.MaxKeys > 0 || u.limits.MaxBytes > 0
+}
+
+func (u *bucketUsage) invalidate() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.loaded = false
+}
+
+// load recounts the bucket. The caller holds u.mu.
+func (u *bucketUsage) load(s *bucketStore) error {
+	var keys, size int64
+	err := s.IterateRange(nil, nil, func(k, v []byte) error {
+		keys++
+		size += int64(len(k) + len(v))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	u.keys, u.bytes, u.loaded = keys, size, true
+	return nil
+}
+
+// apply checks ops against the quota and commits them. Writes that do not
+// grow the bucket always go through, so a bucket over a lowered quota can
+// still be cleaned up.
+func (u *bucketUsage) apply(s *bucketStore, ops []operation) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.loaded {
+		if err := u.load(s); err != nil {
+			return err
+		}
+	}
+
+	// sizes holds each touched key's size after the ops so far, -1 once
+	// deleted.
+	sizes := make(map[string]int64)
+	var dKeys, dBytes int64
+	for _, op := range ops {
+		old, seen := sizes[string(op.key)]
+		if !seen {
+			value, err := s.Get(op.key)
+			switch {
+			case isNotFound(err):
+				old = -1
+			case err != nil:
+				return err
+			default:
+				old = int64(len(op.key) + len(value))
+			}
+		}
+		next := int64(-1)
+		if op.op != opDelete {
+			next = int64(len(op.key) + len(op.value))
+		}
+		if old >= 0 {
+			dKeys--
+			dBytes -= old
+		}
+		if next >= 0 {
+			dKeys++
+			dBytes += next
+		}
+		sizes[string(op.key)] = next
+	}
+
+	if max := u.limits.MaxKeys; max > 0 && dKeys > 0 && u.keys+dKeys > max {
+		return &quotaError{bucket: u.name, limit: "key", max: max}
+	}
+	if max := u.limits.MaxBytes; max > 0 && dBytes > 0 && u.bytes+dBytes > max {
+		return &quotaError{bucket: u.name, limit: "byte", max: max}
+	}
+	if err := s.applyPrefixed(ops); err != nil {
+		return err
+	}
+	u.keys += dKeys
+	u.bytes += dBytes
+	return nil
+}
+
+// bucketStats is the document returned by BucketStats.
+type bucketStats struct {
+	Name     string `json:"name"`
+	Keys     int64  `json:"keys"`
+	Bytes    int64  `json:"bytes"`
+	MaxKeys  int64  `json:"max_keys"`
+	MaxBytes int64  `json:"max_bytes"`
+}
+
+// stats recounts the bucket, refreshing the quota counters as it goes.
+func (u *bucketUsage) stats(s *bucketStore) (bucketStats, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.load(s); err != nil {
+		return bucketStats{}, err
+	}
+	return bucketStats{
+		Name:     u.name,
+		Keys:     u.keys,
+		Bytes:    u.bytes,
+		MaxKeys:  u.limits.MaxKeys,
+		MaxBytes: u.limits.MaxBytes,
+	}, nil
+}
+
+// existingBucket opens a bucket only if it has already been created.
+func existingBucket(store kvStore, name string) (*bucketStore, error) {
+	found, err := hasKey(store, bucketMarker(name))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("bucket %q: %w", name, badger.ErrKeyNotFound)
+	}
+	return openBucket(store, name)
+}
+
+func setBucketQuota(store kvStore, name string, meta bucketMeta) error {
+	if meta.MaxKeys < 0 || meta.MaxBytes < 0 {
+		return errors.New("bucket quotas must not be negative")
+	}
+	bucket, err := openBucket(store, name)
+	if err != nil {
+		return err
+	}
+	doc, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := store.Set(bucketMarker(name), doc); err != nil {
+		return err
+	}
+	bucket.usage.setLimits(meta)
+	return nil
+}
+
+// SetBucketQuota limits the named bucket of handle, creating it if needed,
+// to maxKeys keys and maxBytes bytes of keys plus values (0 for no limit).
+// The limits are stored with the bucket. Writes through bucket handles that
+// would exceed them fail with status -8; writes that shrink the bucket are
+// always allowed.
+//
+//export SetBucketQuota
+func SetBucketQuota(handle C.uintptr_t, name *C.char, maxKeys C.int64_t, maxBytes C.int64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	meta := bucketMeta{MaxKeys: int64(maxKeys), MaxBytes: int64(maxBytes)}
+	return setHandleError(uintptr(handle), setBucketQuota(store, C.GoString(name), meta))
+}
+
+// BucketStats counts the named bucket of handle and returns a JSON document
+// with its keys, bytes and quota limits, for the host to release with
+// FreeCString. The count walks the whole bucket.
+//
+//export BucketStats
+func BucketStats(handle C.uintptr_t, name *C.char) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	bucket, err := existingBucket(store, C.GoString(name))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	stats, err := bucket.usage.stats(bucket)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	doc, err := json.Marshal(stats)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.CString(string(doc))
+}
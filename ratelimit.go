@@ -0,0 +1,434 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errThrottled   = errors.New("write throttled")
+	errNoRateLimit = errors.New("the store was not opened with rate_limit")
+)
+
+// throttleError reports how long a rejected write would have had to wait.
+// It matches errThrottled.
+type throttleError struct {
+	wait time.Duration
+}
+
+func (e *throttleError) Error() string {
+	return fmt.Sprintf("write throttled: rate limit exceeded, retry in %v", e.wait.Round(time.Millisecond))
+}
+
+func (e *throttleError) Is(target error) bool { return target == errThrottled }
+
+// rateLimitConfig caps the writes made through a handle. Zero rates are
+// unlimited.
+type rateLimitConfig struct {
+	OpsPerSec   float64 `json:"ops_per_sec,omitempty"`
+	BytesPerSec float64 `json:"bytes_per_sec,omitempty"`
+	// BurstSeconds is how many seconds' worth of writes may go through at
+	// once after a quiet spell; 1 by default.
+	BurstSeconds float64 `json:"burst_seconds,omitempty"`
+	// Block makes writes over the limit wait for capacity instead of failing
+	// with status -9. MaxWait bounds the wait, as a Go duration string;
+	// writes that would wait longer fail instead.
+	Block   bool   `json:"block,omitempty"`
+	MaxWait string `json:"max_wait,omitempty"`
+}
+
+// tokenBucket refills at rate tokens a second up to burst. tokens goes
+// negative while blocked writers wait for the debt to refill.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+}
+
+func (b *tokenBucket) refill(elapsed time.Duration) {
+	if b.rate > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+	}
+}
+
+// wait is how long taking n tokens must wait. A request larger than the
+// burst goes through once the bucket is full.
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.rate <= 0 || b.tokens >= n || b.tokens >= b.burst {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take(n float64) {
+	if b.rate > 0 {
+		b.tokens -= n
+	}
+}
+
+// pressure is the share of the burst in use: 0 when idle, 1 at the limit,
+// above 1 while writers wait.
+func (b *tokenBucket) pressure() float64 {
+	if b.rate <= 0 {
+		return 0
+	}
+	return max(0, 1-b.tokens/b.burst)
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	ops     tokenBucket
+	bytes   tokenBucket
+	block   bool
+	maxWait time.Duration
+	last    time.Time
+
+	throttled int64
+	waited    time.Duration
+}
+
+func newRateLimiter(cfg *rateLimitConfig) (*rateLimiter, error) {
+	l := &rateLimiter{last: time.Now()}
+	if err := l.configure(cfg); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// configure replaces the limits, starting both buckets full.
+func (l *rateLimiter) configure(cfg *rateLimitConfig) error {
+	if cfg.OpsPerSec < 0 || cfg.BytesPerSec < 0 || cfg.BurstSeconds < 0 {
+		return errors.New("rate limits must not be negative")
+	}
+	var maxWait time.Duration
+	if cfg.MaxWait != "" {
+		var err error
+		if maxWait, err = time.ParseDuration(cfg.MaxWait); err != nil {
+			return fmt.Errorf("invalid rate_limit max_wait: %w", err)
+		}
+	}
+	burst := cfg.BurstSeconds
+	if burst == 0 {
+		burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ops = tokenBucket{rate: cfg.OpsPerSec, burst: cfg.OpsPerSec * burst, tokens: cfg.OpsPerSec * burst}
+	l.bytes = tokenBucket{rate: cfg.BytesPerSec, burst: cfg.BytesPerSec * burst, tokens: cfg.BytesPerSec * burst}
+	l.block, l.maxWait = cfg.Block, maxWait
+	return nil
+}
+
+// admit takes capacity for ops. Over the limit it fails with a
+// throttleError, or in blocking mode reserves the capacity and sleeps until
+// it has refilled. Blob chunks and manifests are skipped: the blob exports
+// charge each call once, however many chunks it touches.
+func (l *rateLimiter) admit(ops []operation) error {
+	var n, size float64
+	for _, op := range ops {
+		if bytes.HasPrefix(op.key, blobPrefix) {
+			continue
+		}
+		switch op.op {
+		case opSet, opDelete, opSetTTL:
+			n++
+			size += float64(len(op.key) + len(op.value))
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.ops.refill(now.Sub(l.last))
+	l.bytes.refill(now.Sub(l.last))
+	l.last = now
+	wait := max(l.ops.wait(n), l.bytes.wait(size))
+	if wait > 0 && (!l.block || (l.maxWait > 0 && wait > l.maxWait)) {
+		l.throttled++
+		l.mu.Unlock()
+		return &throttleError{wait: wait}
+	}
+	l.ops.take(n)
+	l.bytes.take(size)
+	l.waited += wait
+	l.mu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+// rateLimitStats is the rate_limit section of Stats.
+type rateLimitStats struct {
+	OpsPerSec   float64 `json:"ops_per_sec"`
+	BytesPerSec float64 `json:"bytes_per_sec"`
+	// Pressure is the larger share of either burst in use: 0 when idle, 1
+	// at the limit, above 1 while blocked writers wait.
+	Pressure float64 `json:"pressure"`
+	// Throttled counts writes rejected; WaitedMs is the total time blocked
+	// writes waited.
+	Throttled int64 `json:"throttled"`
+	WaitedMs  int64 `json:"waited_ms"`
+}
+
+func (l *rateLimiter) stats() *rateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.ops.refill(now.Sub(l.last))
+	l.bytes.refill(now.Sub(l.last))
+	l.last = now
+	return &rateLimitStats{
+		OpsPerSec:   l.ops.rate,
+		BytesPerSec: l.bytes.rate,
+		Pressure:    max(l.ops.pressure(), l.bytes.pressure()),
+		Throttled:   l.throttled,
+		WaitedMs:    l.waited.Milliseconds(),
+	}
+}
+
+// rateLimitStore admits every write to inner through a rateLimiter. It sits
+// above every other layer, so limits count the host's writes as it made
+// them, not the index entries, log records and trash moves they lead to.
+type rateLimitStore struct {
+	inner   kvStore
+	limiter *rateLimiter
+}
+
+func (s *rateLimitStore) unwrap() kvStore { return s.inner }
+
+func (s *rateLimitStore) Close() error { return s.inner.Close() }
+
+func (s *rateLimitStore) Set(key, value []byte) error {
+	if err := s.limiter.admit([]operation{{op: opSet, key: key, value: value}}); err != nil {
+		return err
+	}
+	return s.inner.Set(key, value)
+}
+
+func (s *rateLimitStore) Get(key []byte) ([]byte, error) { return s.inner.Get(key) }
+
+func (s *rateLimitStore) Has(key []byte) (bool, error) { return hasKey(s.inner, key) }
+
+func (s *rateLimitStore) Delete(key []byte) error {
+	if err := s.limiter.admit([]operation{{op: opDelete, key: key}}); err != nil {
+		return err
+	}
+	return s.inner.Delete(key)
+}
+
+func (s *rateLimitStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, fn)
+}
+
+func (s *rateLimitStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, fn)
+}
+
+func (s *rateLimitStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, fn)
+}
+
+func (s *rateLimitStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *rateLimitStore) Sync() error { return s.inner.Sync() }
+
+func (s *rateLimitStore) Apply(ops []operation) error {
+	if err := s.limiter.admit(ops); err != nil {
+		return err
+	}
+	return s.inner.Apply(ops)
+}
+
+func (s *rateLimitStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := s.limiter.admit([]operation{{op: opSetTTL, key: key, value: value}}); err != nil {
+		return err
+	}
+	return setWithTTL(s.inner, key, value, ttl)
+}
+
+func (s *rateLimitStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+// DeleteRange is admitted once, as a single write however many keys it
+// removes, so the limit never leaves a range half deleted.
+func (s *rateLimitStore) DeleteRange(start, end []byte) (int, error) {
+	if err := s.limiter.admit([]operation{{op: opDelete, key: start}}); err != nil {
+		return 0, err
+	}
+	return deleteRange(s.inner, start, end)
+}
+
+func (s *rateLimitStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	if err := s.limiter.admit(ops); err != nil {
+		return 0, err
+	}
+	return applyDurable(s.inner, ops, level)
+}
+
+func (s *rateLimitStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+func (s *rateLimitStore) SetWithMeta(key, value []byte, meta byte) error {
+	if err := s.limiter.admit([]operation{{op: opSet, key: key, value: value}}); err != nil {
+		return err
+	}
+	return setWithMeta(s.inner, key, value, meta)
+}
+
+func (s *rateLimitStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	return getWithMeta(s.inner, key)
+}
+
+func (s *rateLimitStore) CurrentVersion() (uint64, error) {
+	return versionsBelow{s.inner}.CurrentVersion()
+}
+
+func (s *rateLimitStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	return versionsBelow{s.inner}.GetAt(key, version)
+}
+
+func (s *rateLimitStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return versionsBelow{s.inner}.IterateAt(prefix, version, fn)
+}
+
+func (s *rateLimitStore) Versions(key []byte) ([]keyVersion, error) {
+	return versionsBelow{s.inner}.Versions(key)
+}
+
+func (s *rateLimitStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitTxn{txn: txn, limiter: s.limiter}, nil
+}
+
+// Maintenance is not limited: DropAll, Compact and restores run at full
+// speed.
+func (s *rateLimitStore) DropAll() error { return dropAll(s.inner) }
+
+func (s *rateLimitStore) Compact() error { return compactStore(s.inner) }
+
+func (s *rateLimitStore) Snapshot() (kvStore, error) { return openSnapshot(s.inner) }
+
+func (s *rateLimitStore) Stats() (storeStats, error) {
+	stats, err := collectStats(s.inner)
+	if err != nil {
+		return stats, err
+	}
+	stats.RateLimit = s.limiter.stats()
+	return stats, nil
+}
+
+func (s *rateLimitStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+func (s *rateLimitStore) Load(r io.Reader) error { return restoreStore(s.inner, r) }
+
+// rateLimitTxn admits a transaction's writes together when it commits.
+type rateLimitTxn struct {
+	txn     kvTxn
+	limiter *rateLimiter
+	ops     []operation
+}
+
+func (t *rateLimitTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(key) }
+
+func (t *rateLimitTxn) Set(key, value []byte) error {
+	if err := t.txn.Set(key, value); err != nil {
+		return err
+	}
+	// Only sizes are needed, so the buffers are not copied.
+	t.ops = append(t.ops, operation{op: opSet, key: key, value: value})
+	return nil
+}
+
+func (t *rateLimitTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := txnSetWithTTL(t.txn, key, value, ttl); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opSetTTL, key: key, value: value, ttl: ttl})
+	return nil
+}
+
+func (t *rateLimitTxn) Delete(key []byte) error {
+	if err := t.txn.Delete(key); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, operation{op: opDelete, key: key})
+	return nil
+}
+
+func (t *rateLimitTxn) Commit() error {
+	if err := t.limiter.admit(t.ops); err != nil {
+		t.txn.Discard()
+		return err
+	}
+	return t.txn.Commit()
+}
+
+func (t *rateLimitTxn) Discard() { t.txn.Discard() }
+
+// rateLimiterOf finds the limiter layered into store by OpenWithOptions.
+func rateLimiterOf(store kvStore) (*rateLimiter, bool) {
+	limited, ok := layerOf[*rateLimitStore](store)
+	if !ok {
+		return nil, false
+	}
+	return limited.limiter, true
+}
+
+// admitWrites charges ops to the rate limit of the handle id, if it has one,
+// for exports that write through a layer below the limiter.
+func admitWrites(id uintptr, ops []operation) error {
+	store, err := getHandle(id)
+	if err != nil {
+		return err
+	}
+	limiter, ok := rateLimiterOf(store)
+	if !ok {
+		return nil
+	}
+	return limiter.admit(ops)
+}
+
+// SetRateLimit replaces the write limits of a store opened with a
+// rate_limit section, taking a JSON document in the same form: ops_per_sec,
+// bytes_per_sec, burst_seconds, block and max_wait. Zero rates lift a
+// limit.
+//
+//export SetRateLimit
+func SetRateLimit(handle C.uintptr_t, config *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	limiter, ok := rateLimiterOf(store)
+	if !ok {
+		return setHandleError(uintptr(handle), errNoRateLimit)
+	}
+	dec := json.NewDecoder(strings.NewReader(C.GoString(config)))
+	dec.DisallowUnknownFields()
+	var cfg rateLimitConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return setHandleError(uintptr(handle), fmt.Errorf("invalid rate limit: %w", err))
+	}
+	return setHandleError(uintptr(handle), limiter.configure(&cfg))
+}
@@ -0,0 +1,730 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Redis RDB files up to rdbMaxVersion (Redis 7.4) can be imported. Each
+// Redis type maps onto the store's own structure of the same shape: strings
+// become plain keys and keep their expiry, hashes, sets and sorted sets
+// become HSet, SAdd and ZAdd structures, and lists become queues in order.
+// Streams and module types cannot be imported.
+const (
+	rdbMaxVersion = 12
+	// rdbMaxString bounds one string, matching Redis's default
+	// proto-max-bulk-len, so a corrupt length cannot exhaust memory.
+	rdbMaxString = 512 << 20
+)
+
+// RDB opcodes and value types.
+const (
+	rdbTypeString          = 0
+	rdbTypeList            = 1
+	rdbTypeSet             = 2
+	rdbTypeZset            = 3
+	rdbTypeHash            = 4
+	rdbTypeZset2           = 5
+	rdbTypeHashZipmap      = 9
+	rdbTypeListZiplist     = 10
+	rdbTypeSetIntset       = 11
+	rdbTypeZsetZiplist     = 12
+	rdbTypeHashZiplist     = 13
+	rdbTypeListQuicklist   = 14
+	rdbTypeHashListpack    = 16
+	rdbTypeZsetListpack    = 17
+	rdbTypeListQuicklist2  = 18
+	rdbTypeSetListpack     = 20
+	rdbOpFunction2         = 0xf5
+	rdbOpModuleAux         = 0xf7
+	rdbOpIdle              = 0xf8
+	rdbOpFreq              = 0xf9
+	rdbOpAux               = 0xfa
+	rdbOpResizeDB          = 0xfb
+	rdbOpExpireTimeMs      = 0xfc
+	rdbOpExpireTime        = 0xfd
+	rdbOpSelectDB          = 0xfe
+	rdbOpEOF               = 0xff
+	rdbQuicklistNodePlain  = 1
+	rdbQuicklistNodePacked = 2
+)
+
+type rdbReader struct {
+	r *bufio.Reader
+}
+
+func (d *rdbReader) byte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+func (d *rdbReader) bytes(n uint64) ([]byte, error) {
+	if n > rdbMaxString {
+		return nil, fmt.Errorf("string of %d bytes is too long", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// length reads a length, reporting encoded for the special string encodings
+// whose format is then in n.
+func (d *rdbReader) length() (n uint64, encoded bool, err error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := d.byte()
+		return uint64(b&0x3f)<<8 | uint64(next), false, err
+	case 3:
+		return uint64(b & 0x3f), true, nil
+	}
+	switch b {
+	case 0x80:
+		buf, err := d.bytes(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf)), false, nil
+	case 0x81:
+		buf, err := d.bytes(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(buf), false, nil
+	}
+	return 0, false, fmt.Errorf("invalid length encoding 0x%02x", b)
+}
+
+// count reads a plain length, such as the number of elements in a value.
+func (d *rdbReader) count() (uint64, error) {
+	n, encoded, err := d.length()
+	if err == nil && encoded {
+		err = errors.New("unexpected encoded length")
+	}
+	return n, err
+}
+
+// string reads a string in any of its encodings: raw, a small integer or LZF
+// compressed.
+func (d *rdbReader) string() ([]byte, error) {
+	n, encoded, err := d.length()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		return d.bytes(n)
+	}
+	switch n {
+	case 0, 1, 2:
+		buf, err := d.bytes(1 << n)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, leInt(buf), 10), nil
+	case 3:
+		clen, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		if ulen > rdbMaxString {
+			return nil, fmt.Errorf("string of %d bytes is too long", ulen)
+		}
+		compressed, err := d.bytes(clen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(ulen))
+	}
+	return nil, fmt.Errorf("invalid string encoding %d", n)
+}
+
+// score reads a sorted set score stored as text, as in RDB_TYPE_ZSET.
+func (d *rdbReader) score() (float64, error) {
+	n, err := d.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf, err := d.bytes(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(buf), 64)
+}
+
+// leInt decodes a little-endian two's complement integer of 1 to 8 bytes.
+func leInt(b []byte) int64 {
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	shift := 64 - 8*len(b)
+	return int64(u<<shift) >> shift
+}
+
+// lzfDecompress expands data compressed with liblzf, as Redis stores long
+// strings.
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, errors.New("corrupt LZF literal")
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		n := ctrl >> 5
+		if n == 7 {
+			if i == len(in) {
+				return nil, errors.New("corrupt LZF back reference")
+			}
+			n += int(in[i])
+			i++
+		}
+		if i == len(in) {
+			return nil, errors.New("corrupt LZF back reference")
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+n+2 > size {
+			return nil, errors.New("corrupt LZF back reference")
+		}
+		// The reference may overlap the bytes it produces.
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("LZF data expanded to %d bytes, want %d", len(out), size)
+	}
+	return out, nil
+}
+
+// ziplistEntries decodes the entries of a ziplist, formatting integers as
+// decimal text like Redis does.
+func ziplistEntries(zl []byte) ([][]byte, error) {
+	errCorrupt := errors.New("corrupt ziplist")
+	if len(zl) < 11 {
+		return nil, errCorrupt
+	}
+	var entries [][]byte
+	p := 10
+	for p < len(zl) && zl[p] != 0xff {
+		if zl[p] == 0xfe {
+			p += 5
+		} else {
+			p++
+		}
+		if p >= len(zl) {
+			return nil, errCorrupt
+		}
+		enc := zl[p]
+		var n, intLen int
+		switch {
+		case enc>>6 == 0:
+			n, p = int(enc&0x3f), p+1
+		case enc>>6 == 1:
+			if p+2 > len(zl) {
+				return nil, errCorrupt
+			}
+			n, p = int(enc&0x3f)<<8|int(zl[p+1]), p+2
+		case enc == 0x80:
+			if p+5 > len(zl) {
+				return nil, errCorrupt
+			}
+			n, p = int(binary.BigEndian.Uint32(zl[p+1:])), p+5
+		case enc == 0xc0:
+			intLen = 2
+		case enc == 0xd0:
+			intLen = 4
+		case enc == 0xe0:
+			intLen = 8
+		case enc == 0xf0:
+			intLen = 3
+		case enc == 0xfe:
+			intLen = 1
+		case enc >= 0xf1 && enc <= 0xfd:
+			entries = append(entries, strconv.AppendInt(nil, int64(enc&0x0f)-1, 10))
+			p++
+			continue
+		default:
+			return nil, errCorrupt
+		}
+		if intLen > 0 {
+			if p+1+intLen > len(zl) {
+				return nil, errCorrupt
+			}
+			entries = append(entries, strconv.AppendInt(nil, leInt(zl[p+1:p+1+intLen]), 10))
+			p += 1 + intLen
+			continue
+		}
+		if n < 0 || p+n > len(zl) {
+			return nil, errCorrupt
+		}
+		entries = append(entries, zl[p:p+n])
+		p += n
+	}
+	return entries, nil
+}
+
+// listpackEntries decodes the entries of a listpack, formatting integers as
+// decimal text like Redis does.
+func listpackEntries(lp []byte) ([][]byte, error) {
+	errCorrupt := errors.New("corrupt listpack")
+	if len(lp) < 7 {
+		return nil, errCorrupt
+	}
+	var entries [][]byte
+	p := 6
+	for p < len(lp) && lp[p] != 0xff {
+		enc := lp[p]
+		var size, intLen int
+		switch {
+		case enc&0x80 == 0:
+			entries = append(entries, strconv.AppendInt(nil, int64(enc), 10))
+			size = 1
+		case enc&0xc0 == 0x80:
+			size = 1 + int(enc&0x3f)
+			if p+size > len(lp) {
+				return nil, errCorrupt
+			}
+			entries = append(entries, lp[p+1:p+size])
+		case enc&0xe0 == 0xc0:
+			if p+2 > len(lp) {
+				return nil, errCorrupt
+			}
+			v := int64(enc&0x1f)<<8 | int64(lp[p+1])
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+			entries = append(entries, strconv.AppendInt(nil, v, 10))
+			size = 2
+		case enc&0xf0 == 0xe0:
+			if p+2 > len(lp) {
+				return nil, errCorrupt
+			}
+			size = 2 + (int(enc&0x0f)<<8 | int(lp[p+1]))
+			if p+size > len(lp) {
+				return nil, errCorrupt
+			}
+			entries = append(entries, lp[p+2:p+size])
+		case enc == 0xf0:
+			if p+5 > len(lp) {
+				return nil, errCorrupt
+			}
+			size = 5 + int(binary.LittleEndian.Uint32(lp[p+1:]))
+			if size < 5 || p+size > len(lp) {
+				return nil, errCorrupt
+			}
+			entries = append(entries, lp[p+5:p+size])
+		case enc == 0xf1:
+			intLen = 2
+		case enc == 0xf2:
+			intLen = 3
+		case enc == 0xf3:
+			intLen = 4
+		case enc == 0xf4:
+			intLen = 8
+		default:
+			return nil, errCorrupt
+		}
+		if intLen > 0 {
+			size = 1 + intLen
+			if p+size > len(lp) {
+				return nil, errCorrupt
+			}
+			entries = append(entries, strconv.AppendInt(nil, leInt(lp[p+1:p+size]), 10))
+		}
+		p += size + listpackBacklenSize(size)
+	}
+	return entries, nil
+}
+
+// listpackBacklenSize is how many bytes a listpack entry of size bytes uses
+// to store its length again for backward iteration.
+func listpackBacklenSize(size int) int {
+	switch {
+	case size <= 127:
+		return 1
+	case size < 16383:
+		return 2
+	case size < 2097151:
+		return 3
+	case size < 268435455:
+		return 4
+	}
+	return 5
+}
+
+func intsetEntries(is []byte) ([][]byte, error) {
+	if len(is) < 8 {
+		return nil, errors.New("corrupt intset")
+	}
+	width := int(binary.LittleEndian.Uint32(is))
+	n := int(binary.LittleEndian.Uint32(is[4:]))
+	if (width != 2 && width != 4 && width != 8) || n < 0 || len(is) != 8+n*width {
+		return nil, errors.New("corrupt intset")
+	}
+	entries := make([][]byte, n)
+	for i := range entries {
+		entries[i] = strconv.AppendInt(nil, leInt(is[8+i*width:8+(i+1)*width]), 10)
+	}
+	return entries, nil
+}
+
+// zipmapEntries decodes the field and value pairs of a zipmap, the hash
+// encoding of RDB files older than Redis 2.6.
+func zipmapEntries(zm []byte) ([][]byte, error) {
+	errCorrupt := errors.New("corrupt zipmap")
+	readLen := func(p int) (int, int, error) {
+		if p >= len(zm) {
+			return 0, 0, errCorrupt
+		}
+		if zm[p] < 254 {
+			return int(zm[p]), p + 1, nil
+		}
+		if zm[p] == 254 && p+5 <= len(zm) {
+			return int(binary.LittleEndian.Uint32(zm[p+1:])), p + 5, nil
+		}
+		return 0, 0, errCorrupt
+	}
+	var entries [][]byte
+	p := 1
+	for p < len(zm) && zm[p] != 0xff {
+		n, next, err := readLen(p)
+		if err != nil || next+n > len(zm) {
+			return nil, errCorrupt
+		}
+		entries = append(entries, zm[next:next+n])
+		if n, next, err = readLen(next + n); err != nil || next+1+n > len(zm) {
+			return nil, errCorrupt
+		}
+		free := int(zm[next])
+		entries = append(entries, zm[next+1:next+1+n])
+		p = next + 1 + n + free
+	}
+	return entries, nil
+}
+
+// rdbValue is one decoded Redis value. Hashes hold alternating fields and
+// values in items; sorted sets hold members in items and their scores in
+// scores.
+type rdbValue struct {
+	kind   byte
+	items  [][]byte
+	scores []float64
+}
+
+// readValue decodes a value of RDB type typ into its logical kind:
+// rdbTypeString, rdbTypeList, rdbTypeSet, rdbTypeZset or rdbTypeHash.
+func (d *rdbReader) readValue(typ byte) (rdbValue, error) {
+	switch typ {
+	case rdbTypeString:
+		s, err := d.string()
+		return rdbValue{kind: rdbTypeString, items: [][]byte{s}}, err
+	case rdbTypeList, rdbTypeSet, rdbTypeHash:
+		n, err := d.count()
+		if err != nil {
+			return rdbValue{}, err
+		}
+		if typ == rdbTypeHash {
+			n *= 2
+		}
+		v := rdbValue{kind: typ}
+		for i := uint64(0); i < n; i++ {
+			s, err := d.string()
+			if err != nil {
+				return rdbValue{}, err
+			}
+			v.items = append(v.items, s)
+		}
+		return v, nil
+	case rdbTypeZset, rdbTypeZset2:
+		n, err := d.count()
+		if err != nil {
+			return rdbValue{}, err
+		}
+		v := rdbValue{kind: rdbTypeZset}
+		for i := uint64(0); i < n; i++ {
+			member, err := d.string()
+			if err != nil {
+				return rdbValue{}, err
+			}
+			var score float64
+			if typ == rdbTypeZset2 {
+				buf, err := d.bytes(8)
+				if err != nil {
+					return rdbValue{}, err
+				}
+				score = math.Float64frombits(binary.LittleEndian.Uint64(buf))
+			} else if score, err = d.score(); err != nil {
+				return rdbValue{}, err
+			}
+			v.items = append(v.items, member)
+			v.scores = append(v.scores, score)
+		}
+		return v, nil
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		n, err := d.count()
+		if err != nil {
+			return rdbValue{}, err
+		}
+		v := rdbValue{kind: rdbTypeList}
+		for i := uint64(0); i < n; i++ {
+			container := uint64(rdbQuicklistNodePacked)
+			if typ == rdbTypeListQuicklist2 {
+				if container, err = d.count(); err != nil {
+					return rdbValue{}, err
+				}
+			}
+			node, err := d.string()
+			if err != nil {
+				return rdbValue{}, err
+			}
+			var items [][]byte
+			switch {
+			case container == rdbQuicklistNodePlain:
+				items = [][]byte{node}
+			case typ == rdbTypeListQuicklist:
+				items, err = ziplistEntries(node)
+			default:
+				items, err = listpackEntries(node)
+			}
+			if err != nil {
+				return rdbValue{}, err
+			}
+			v.items = append(v.items, items...)
+		}
+		return v, nil
+	}
+
+	blob, err := d.string()
+	if err != nil {
+		return rdbValue{}, err
+	}
+	var v rdbValue
+	switch typ {
+	case rdbTypeHashZipmap:
+		v.kind = rdbTypeHash
+		v.items, err = zipmapEntries(blob)
+	case rdbTypeListZiplist:
+		v.kind = rdbTypeList
+		v.items, err = ziplistEntries(blob)
+	case rdbTypeSetIntset:
+		v.kind = rdbTypeSet
+		v.items, err = intsetEntries(blob)
+	case rdbTypeSetListpack:
+		v.kind = rdbTypeSet
+		v.items, err = listpackEntries(blob)
+	case rdbTypeHashZiplist:
+		v.kind = rdbTypeHash
+		v.items, err = ziplistEntries(blob)
+	case rdbTypeHashListpack:
+		v.kind = rdbTypeHash
+		v.items, err = listpackEntries(blob)
+	case rdbTypeZsetZiplist, rdbTypeZsetListpack:
+		v.kind = rdbTypeZset
+		var pairs [][]byte
+		if typ == rdbTypeZsetZiplist {
+			pairs, err = ziplistEntries(blob)
+		} else {
+			pairs, err = listpackEntries(blob)
+		}
+		if err == nil && len(pairs)%2 != 0 {
+			err = errors.New("sorted set has a member without a score")
+		}
+		for i := 0; err == nil && i < len(pairs); i += 2 {
+			var score float64
+			score, err = strconv.ParseFloat(string(pairs[i+1]), 64)
+			v.items = append(v.items, pairs[i])
+			v.scores = append(v.scores, score)
+		}
+	default:
+		return rdbValue{}, fmt.Errorf("unsupported value type %d", typ)
+	}
+	if err == nil && v.kind == rdbTypeHash && len(v.items)%2 != 0 {
+		err = errors.New("hash has a field without a value")
+	}
+	return v, err
+}
+
+// importRDB streams every key of the RDB file in r into store. Keys from all
+// Redis databases land in the one keyspace, and keys that have expired are
+// skipped. The trailing checksum is not verified.
+func importRDB(id uintptr, store kvStore, r io.Reader) error {
+	d := &rdbReader{r: bufio.NewReaderSize(r, 1<<16)}
+	header, err := d.bytes(9)
+	if err != nil {
+		return fmt.Errorf("not an RDB file: %w", err)
+	}
+	if !bytes.HasPrefix(header, []byte("REDIS")) {
+		return errors.New("not an RDB file")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version < 1 || version > rdbMaxVersion {
+		return fmt.Errorf("unsupported RDB version %q", header[5:])
+	}
+
+	w := &importWriter{store: store}
+	var expireAt int64
+	for {
+		typ, err := d.byte()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case rdbOpEOF:
+			return w.flush()
+		case rdbOpSelectDB, rdbOpIdle:
+			_, err = d.count()
+		case rdbOpResizeDB:
+			if _, err = d.count(); err == nil {
+				_, err = d.count()
+			}
+		case rdbOpAux:
+			if _, err = d.string(); err == nil {
+				_, err = d.string()
+			}
+		case rdbOpFreq:
+			_, err = d.byte()
+		case rdbOpFunction2:
+			_, err = d.string()
+		case rdbOpExpireTime, rdbOpExpireTimeMs:
+			var buf []byte
+			if typ == rdbOpExpireTime {
+				if buf, err = d.bytes(4); err == nil {
+					expireAt = int64(binary.LittleEndian.Uint32(buf)) * 1000
+				}
+			} else if buf, err = d.bytes(8); err == nil {
+				expireAt = int64(binary.LittleEndian.Uint64(buf))
+			}
+		case rdbOpModuleAux:
+			return errors.New("RDB files with module data cannot be imported")
+		default:
+			key, err := d.string()
+			if err != nil {
+				return err
+			}
+			value, err := d.readValue(typ)
+			if err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+			var ttl time.Duration
+			if expireAt != 0 {
+				ttl = time.Until(time.UnixMilli(expireAt))
+				expireAt = 0
+				if ttl <= 0 {
+					continue
+				}
+			}
+			if err := importRDBValue(id, store, w, key, value, ttl); err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// importRDBValue writes one decoded value. Only strings keep their expiry,
+// as the other structures have no TTLs of their own.
+func importRDBValue(id uintptr, store kvStore, w *importWriter, key []byte, v rdbValue, ttl time.Duration) error {
+	if ttl > 0 && v.kind != rdbTypeString {
+		logf(logWarn, "import", "dropping the expiry of non-string key %q", key)
+	}
+	switch v.kind {
+	case rdbTypeString:
+		return w.set(key, v.items[0], ttl)
+	case rdbTypeHash:
+		for i := 0; i < len(v.items); i += 2 {
+			if err := w.set(hashFieldKey(key, v.items[i]), v.items[i+1], 0); err != nil {
+				return err
+			}
+		}
+	case rdbTypeSet:
+		for _, member := range v.items {
+			if err := w.set(append(setBase(key), member...), []byte{}, 0); err != nil {
+				return err
+			}
+		}
+	case rdbTypeZset:
+		for i, member := range v.items {
+			if _, err := zAdd(store, key, member, v.scores[i]); err != nil {
+				return err
+			}
+		}
+	case rdbTypeList:
+		for _, item := range v.items {
+			if _, err := queuePush(id, store, key, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ImportRDB loads the Redis RDB snapshot at path into the store behind
+// handle, in batches. Strings become plain keys and keep their expiry;
+// hashes, sets and sorted sets become the store's hashes, sets and sorted
+// sets, and lists become queues. Keys from every Redis database are merged.
+// Streams and module types fail the import; keys written before the failure
+// stay in the store.
+//
+//export ImportRDB
+func ImportRDB(handle C.uintptr_t, path *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	f, err := os.Open(C.GoString(path))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	defer f.Close()
+	return setHandleError(uintptr(handle), importRDB(uintptr(handle), store, f))
+}
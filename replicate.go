@@ -0,0 +1,308 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const replicationBatch = 1000
+
+var errReplicationStopped = errors.New("replication stopped")
+
+// sourcePrivatePrefixes hold the source's own bookkeeping, which the initial
+// copy leaves out, in key order. The rest of the reserved keyspace holds
+// hashes, sets, blobs and the other data structures, and is copied.
+var sourcePrivatePrefixes = [][]byte{auditPrefix, cdcCursorPrefix, changeLogPrefix, indexEntryPrefix, trashPrefix}
+
+// copyRanges returns the ranges the initial copy walks: the whole keyspace
+// except sourcePrivatePrefixes.
+func copyRanges() [][2][]byte {
+	var ranges [][2][]byte
+	var from []byte
+	for _, prefix := range sourcePrivatePrefixes {
+		ranges = append(ranges, [2][]byte{from, prefix})
+		from = nextPrefix(prefix)
+	}
+	return append(ranges, [2][]byte{from, nil})
+}
+
+// replicaSink applies delivered changes to the replica store. Replays are
+// harmless: every change is a plain set or delete, so applying one twice
+// leaves the same state.
+type replicaSink struct {
+	dst kvStore
+}
+
+func (r *replicaSink) name() string { return "replica" }
+
+func (r *replicaSink) deliver(events []cdcEvent) error {
+	_, ttls := r.dst.(ttlSetter)
+	ops := make([]operation, len(events))
+	for i, ev := range events {
+		ops[i] = operation{op: opSet, key: ev.Key, value: ev.Value}
+		switch {
+		case ev.Op == "delete":
+			ops[i] = operation{op: opDelete, key: ev.Key}
+		case ev.TTL > 0 && ttls:
+			ops[i].op, ops[i].ttl = opSetTTL, time.Duration(ev.TTL)*time.Second
+		}
+	}
+	return r.dst.Apply(ops)
+}
+
+func (r *replicaSink) close() error { return r.dst.Close() }
+
+// replication keeps a second store in sync with a change-logged one: it
+// copies every entry, then replays the log from the sequence number taken
+// before the copy began, so writes racing the copy are applied again. The
+// source's own bookkeeping, such as its change log, is not copied.
+type replication struct {
+	log     *changeLogStore
+	dst     kvStore
+	dest    string
+	started time.Time
+	cancel  chan struct{}
+	copied  chan struct{}
+
+	mu      sync.Mutex
+	state   string
+	entries int64
+	err     error
+	runner  *cdcRunner
+}
+
+// copy makes the initial copy and starts the stream from from, which the
+// caller has held in r.log so trimming cannot drop what the stream needs.
+func (r *replication) copy(from uint64) {
+	defer close(r.copied)
+	defer r.log.release(from)
+	_, ttls := r.dst.(ttlSetter)
+	ops := make([]operation, 0, replicationBatch)
+	flush := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		if err := r.dst.Apply(ops); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.entries += int64(len(ops))
+		r.mu.Unlock()
+		ops = ops[:0]
+		return nil
+	}
+	each := func(k, v []byte) error {
+		select {
+		case <-r.cancel:
+			return errReplicationStopped
+		default:
+		}
+		op := operation{op: opSet, key: k, value: v}
+		if ttls {
+			ttl, err := keyTTL(r.log.inner, k)
+			switch {
+			case isNotFound(err):
+				// Expired since it was read.
+				return nil
+			case err != nil:
+				return err
+			case ttl > 0:
+				op.op, op.ttl = opSetTTL, ttl
+			}
+		}
+		ops = append(ops, op)
+		if len(ops) < replicationBatch {
+			return nil
+		}
+		return flush()
+	}
+	var err error
+	for _, rng := range copyRanges() {
+		if err = r.log.inner.IterateRange(rng[0], rng[1], each); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = flush()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.state, r.err = "failed", fmt.Errorf("initial copy: %w", err)
+		return
+	}
+	runner := newCDCRunner(r.log, &replicaSink{dst: r.dst}, cdcSettings{
+		batch:    replicationBatch,
+		interval: defaultCDCInterval,
+		retries:  defaultCDCRetries,
+	})
+	runner.replica = true
+	runner.cursor = from
+	r.state, r.runner = "streaming", runner
+	r.log.addSink(runner)
+}
+
+// stop ends the copy or the stream and closes the replica.
+func (r *replication) stop() error {
+	close(r.cancel)
+	<-r.copied
+	r.mu.Lock()
+	runner := r.runner
+	r.mu.Unlock()
+	if runner != nil {
+		return r.log.stopSink(runner)
+	}
+	return r.dst.Close()
+}
+
+// replicationStatus is the document returned by ReplicationStatus.
+type replicationStatus struct {
+	Destination string    `json:"destination"`
+	State       string    `json:"state"`
+	StartedAt   time.Time `json:"started_at"`
+	Copied      int64     `json:"copied"`
+	AppliedSeq  uint64    `json:"applied_seq"`
+	SourceSeq   uint64    `json:"source_seq"`
+	Lag         uint64    `json:"lag"`
+	LagMillis   int64     `json:"lag_ms"`
+	Error       string    `json:"error,omitempty"`
+}
+
+func (r *replication) status() replicationStatus {
+	r.mu.Lock()
+	st := replicationStatus{
+		Destination: r.dest,
+		State:       r.state,
+		StartedAt:   r.started,
+		Copied:      r.entries,
+		SourceSeq:   r.log.lastSeq(),
+	}
+	err, runner := r.err, r.runner
+	r.mu.Unlock()
+
+	if runner != nil {
+		st.AppliedSeq, err = runner.status()
+		if st.SourceSeq > st.AppliedSeq {
+			st.Lag = st.SourceSeq - st.AppliedSeq
+			// The lag in time is the age of the oldest change not applied yet.
+			if record, getErr := r.log.inner.Get(changeKey(st.AppliedSeq + 1)); getErr == nil {
+				if at, _, parseErr := parseChange(record); parseErr == nil {
+					st.LagMillis = time.Since(at).Milliseconds()
+				}
+			}
+		}
+	}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	return st
+}
+
+var (
+	replicationMu sync.Mutex
+	replications  = make(map[uintptr]*replication)
+)
+
+// stopReplicationFor stops the replication fed by a closing handle.
+func stopReplicationFor(id uintptr) error {
+	replicationMu.Lock()
+	r := replications[id]
+	delete(replications, id)
+	replicationMu.Unlock()
+	if r == nil {
+		return nil
+	}
+	return r.stop()
+}
+
+// StartReplication copies the store behind srcHandle, which must have been
+// opened with change_log, into the store at dstURI (any location accepted by
+// Open), then keeps applying its change log there. It returns once the
+// replica is open; the copy and the stream run in the background, and
+// ReplicationStatus reports their progress. Each handle feeds at most one
+// replica. TrimChanges keeps changes the replica has not applied yet.
+//
+//export StartReplication
+func StartReplication(srcHandle C.uintptr_t, dstURI *C.char) (ret C.int) {
+	defer recoverExport(uintptr(srcHandle), &ret, codePanic)
+	id := uintptr(srcHandle)
+	log, err := changeLogFor(srcHandle)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	if replications[id] != nil {
+		return setHandleError(id, errors.New("handle is already replicating"))
+	}
+	uri := C.GoString(dstURI)
+	dst, err := openStore(uri, false)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+
+	r := &replication{
+		log:     log,
+		dst:     dst,
+		dest:    displayPath(uri),
+		started: time.Now().UTC(),
+		cancel:  make(chan struct{}),
+		copied:  make(chan struct{}),
+		state:   "copying",
+	}
+	replications[id] = r
+	go r.copy(log.hold())
+	return setHandleError(id, nil)
+}
+
+// ReplicationStatus returns a JSON document describing the replication fed
+// by srcHandle: its state ("copying", "streaming" or "failed"), entries
+// copied, the last sequence number applied and the source's newest, the lag
+// between them in changes and in milliseconds, and the last error. Release it
+// with FreeCString.
+//
+//export ReplicationStatus
+func ReplicationStatus(srcHandle C.uintptr_t) (ret *C.char) {
+	defer recoverExport(uintptr(srcHandle), &ret, nil)
+	id := uintptr(srcHandle)
+	replicationMu.Lock()
+	r := replications[id]
+	replicationMu.Unlock()
+	if r == nil {
+		setHandleError(id, fmt.Errorf("handle %d is not replicating", id))
+		return nil
+	}
+	doc, err := json.Marshal(r.status())
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	setHandleError(id, nil)
+	return C.CString(string(doc))
+}
+
+// StopReplication stops the replication fed by srcHandle, after one last
+// attempt to apply outstanding changes, and closes the replica.
+//
+//export StopReplication
+func StopReplication(srcHandle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(srcHandle), &ret, codePanic)
+	id := uintptr(srcHandle)
+	replicationMu.Lock()
+	r := replications[id]
+	replicationMu.Unlock()
+	if r == nil {
+		return setHandleError(id, fmt.Errorf("handle %d is not replicating", id))
+	}
+	return setHandleError(id, stopReplicationFor(id))
+}
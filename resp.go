@@ -0,0 +1,456 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// respMaxArgs bounds the arguments of one command.
+	respMaxArgs = 1 << 20
+	// respScanCount is how many keys SCAN visits per call without COUNT.
+	respScanCount = 10
+)
+
+var errRESPQuit = errors.New("client quit")
+
+// respServer answers Redis protocol commands for one store handle.
+type respServer struct {
+	id uintptr
+}
+
+var (
+	respMu      sync.Mutex
+	respServers = make(map[uintptr]*tcpServer)
+)
+
+func (s *respServer) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				w.WriteString("-ERR Protocol error: " + respLine(err.Error()) + "\r\n")
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		err = s.dispatch(w, args)
+		if errors.Is(err, errRESPQuit) {
+			w.WriteString("+OK\r\n")
+			w.Flush()
+			return
+		}
+		if err != nil {
+			w.WriteString("-ERR " + respLine(err.Error()) + "\r\n")
+		}
+		// Pipelined commands are answered together.
+		if r.Buffered() == 0 {
+			if w.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// respLine keeps an error message on one line.
+func respLine(msg string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+}
+
+// readRESPCommand reads one command, either as an array of bulk strings or
+// as an inline line of space-separated words.
+func readRESPCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		var args [][]byte
+		for _, f := range strings.Fields(string(line)) {
+			args = append(args, []byte(f))
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > respMaxArgs {
+		return nil, errors.New("invalid multibulk length")
+	}
+	args := make([][]byte, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		line, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("expected '$', got %q", line)
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > httpMaxBody {
+			return nil, errors.New("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, buf[:size])
+	}
+	return args, nil
+}
+
+func readRESPLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, errors.New("line too long")
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+func writeBulk(w *bufio.Writer, b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func writeInt(w *bufio.Writer, n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func errArgs(cmd string) error {
+	return fmt.Errorf("wrong number of arguments for '%s' command", strings.ToLower(cmd))
+}
+
+// dispatch runs one command and writes its reply, or returns the error to
+// reply with.
+func (s *respServer) dispatch(w *bufio.Writer, args [][]byte) error {
+	store, err := getHandle(s.id)
+	if err != nil {
+		return err
+	}
+	cmd := strings.ToUpper(string(args[0]))
+	args = args[1:]
+	switch cmd {
+	case "PING":
+		if len(args) > 1 {
+			return errArgs(cmd)
+		}
+		if len(args) == 1 {
+			writeBulk(w, args[0])
+		} else {
+			w.WriteString("+PONG\r\n")
+		}
+	case "ECHO":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		writeBulk(w, args[0])
+	case "QUIT":
+		return errRESPQuit
+	case "SELECT":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		if string(args[0]) != "0" {
+			return errors.New("DB index is out of range")
+		}
+		w.WriteString("+OK\r\n")
+	case "COMMAND":
+		w.WriteString("*0\r\n")
+	case "GET":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		// Reserved keys read as missing, as over HTTP.
+		if reservedKey(args[0]) {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+		value, err := store.Get(args[0])
+		if isNotFound(err) {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		writeBulk(w, value)
+	case "SET":
+		return s.set(w, store, args)
+	case "DEL":
+		if len(args) == 0 {
+			return errArgs(cmd)
+		}
+		var ops []operation
+		for _, key := range args {
+			if reservedKey(key) {
+				return errReservedKey
+			}
+			found, err := hasKey(store, key)
+			if err != nil {
+				return err
+			}
+			if found {
+				ops = append(ops, operation{op: opDelete, key: key})
+			}
+		}
+		if len(ops) > 0 {
+			if err := store.Apply(ops); err != nil {
+				return err
+			}
+		}
+		writeInt(w, int64(len(ops)))
+	case "EXISTS":
+		if len(args) == 0 {
+			return errArgs(cmd)
+		}
+		var n int64
+		for _, key := range args {
+			if reservedKey(key) {
+				continue
+			}
+			found, err := hasKey(store, key)
+			if err != nil {
+				return err
+			}
+			if found {
+				n++
+			}
+		}
+		writeInt(w, n)
+	case "INCR":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		if reservedKey(args[0]) {
+			return errReservedKey
+		}
+		n, err := incrBy(store, args[0], 1)
+		if err != nil {
+			return err
+		}
+		writeInt(w, n)
+	case "TTL":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		if reservedKey(args[0]) {
+			writeInt(w, -2)
+			return nil
+		}
+		ttl, err := keyTTL(store, args[0])
+		switch {
+		case isNotFound(err):
+			writeInt(w, -2)
+		case err != nil:
+			return err
+		case ttl == 0:
+			writeInt(w, -1)
+		default:
+			writeInt(w, int64((ttl+time.Second/2)/time.Second))
+		}
+	case "SCAN":
+		return scanRESP(w, store, args)
+	default:
+		return fmt.Errorf("unknown command '%s'", respLine(string(cmd)))
+	}
+	return nil
+}
+
+// set handles SET key value [EX seconds | PX milliseconds] [NX].
+func (s *respServer) set(w *bufio.Writer, store kvStore, args [][]byte) error {
+	if len(args) < 2 {
+		return errArgs("SET")
+	}
+	key, value := args[0], args[1]
+	if reservedKey(key) {
+		return errReservedKey
+	}
+	var (
+		ttl time.Duration
+		nx  bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "EX", "PX":
+			if i+1 == len(args) || ttl != 0 {
+				return errors.New("syntax error")
+			}
+			i++
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil || n <= 0 || n > int64(maxTTL/unit) {
+				return errors.New("invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			return errors.New("syntax error")
+		}
+	}
+	if nx {
+		if ttl != 0 {
+			return errors.New("SET with both NX and an expiry is not supported")
+		}
+		set, err := compareAndSwap(store, key, nil, value)
+		if err != nil {
+			return err
+		}
+		if !set {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+	} else if err := setWithTTL(store, key, value, ttl); err != nil {
+		return err
+	}
+	w.WriteString("+OK\r\n")
+	return nil
+}
+
+// scanRESP handles SCAN cursor [MATCH pattern] [COUNT count]. The cursor is
+// the number of keys visited so far, so each call skips that many keys
+// again. Keys in the reserved 0xff prefix are never listed.
+func scanRESP(w *bufio.Writer, store kvStore, args [][]byte) error {
+	if len(args) == 0 {
+		return errArgs("SCAN")
+	}
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return errors.New("invalid cursor")
+	}
+	count := respScanCount
+	var pattern string
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return errors.New("syntax error")
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.New("invalid MATCH pattern")
+			}
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count <= 0 {
+				return errors.New("value is not an integer or out of range")
+			}
+		default:
+			return errors.New("syntax error")
+		}
+	}
+
+	var (
+		keys    [][]byte
+		visited uint64
+		more    bool
+	)
+	err = store.IterateRange(nil, []byte{0xff}, func(k, _ []byte) error {
+		if visited < cursor {
+			visited++
+			return nil
+		}
+		if visited == cursor+uint64(count) {
+			more = true
+			return errStopIteration
+		}
+		visited++
+		if ok, _ := path.Match(pattern, string(k)); pattern == "" || ok {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return err
+	}
+	next := uint64(0)
+	if more {
+		next = visited
+	}
+	w.WriteString("*2\r\n")
+	writeBulk(w, []byte(strconv.FormatUint(next, 10)))
+	w.WriteString("*" + strconv.Itoa(len(keys)) + "\r\n")
+	for _, k := range keys {
+		writeBulk(w, k)
+	}
+	return nil
+}
+
+func stopRESPServerFor(id uintptr) error {
+	respMu.Lock()
+	srv, ok := respServers[id]
+	delete(respServers, id)
+	respMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return srv.close()
+}
+
+// StartRESPServer serves the store behind handle to Redis clients on addr,
+// until StopRESPServer or Close. It speaks RESP2 and supports PING, ECHO,
+// SELECT 0, QUIT, GET, SET (with EX, PX or NX), DEL, EXISTS, INCR, TTL and
+// SCAN (with MATCH and COUNT); other commands fail with an error reply.
+// There is no authentication, so bind it to a trusted interface.
+//
+//export StartRESPServer
+func StartRESPServer(handle C.uintptr_t, addr *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	if _, err := getHandle(id); err != nil {
+		return setHandleError(id, err)
+	}
+	respMu.Lock()
+	defer respMu.Unlock()
+	if _, ok := respServers[id]; ok {
+		return setHandleError(id, errors.New("a RESP server is already running for this handle"))
+	}
+	ln, err := net.Listen("tcp", C.GoString(addr))
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	srv := newTCPServer(ln, (&respServer{id: id}).handle)
+	respServers[id] = srv
+	go srv.serve()
+	return setHandleError(id, nil)
+}
+
+//export StopRESPServer
+func StopRESPServer(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	respMu.Lock()
+	_, ok := respServers[id]
+	respMu.Unlock()
+	if !ok {
+		return setHandleError(id, errors.New("no RESP server is running for this handle"))
+	}
+	return setHandleError(id, stopRESPServerFor(id))
+}
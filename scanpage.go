@@ -0,0 +1,123 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"time"
+	"unsafe"
+)
+
+// entryHeaderLen is the framing overhead appendEntry adds to each entry.
+const entryHeaderLen = 8
+
+// page is one bounded slice of a scan. resume is the last key emitted when
+// more entries remain, and nil once the scan is exhausted.
+type page struct {
+	buffer []byte
+	resume []byte
+}
+
+// scanPage collects up to limit entries with keys in [start, end) that sort
+// strictly after the after key, stopping early before the buffer would grow
+// past maxBytes. Non-positive limits are unbounded. The first entry is always
+// returned, even when it alone exceeds maxBytes, so paging makes progress.
+func scanPage(store kvStore, start, end, after []byte, limit, maxBytes int) (page, error) {
+	if after != nil {
+		// The smallest key greater than after is after+0x00.
+		resumeFrom := append(append([]byte(nil), after...), 0)
+		if start == nil || bytes.Compare(resumeFrom, start) > 0 {
+			start = resumeFrom
+		}
+	}
+
+	var p page
+	var last []byte
+	count := 0
+	err := store.IterateRange(start, end, func(k, v []byte) error {
+		full := limit > 0 && count >= limit
+		if maxBytes > 0 && count > 0 && len(p.buffer)+entryHeaderLen+len(k)+len(v) > maxBytes {
+			full = true
+		}
+		if full {
+			p.resume = last
+			return errStopIteration
+		}
+		p.buffer = appendEntry(p.buffer, k, v)
+		last = k
+		count++
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return page{}, err
+	}
+	return p, nil
+}
+
+// ScanPage returns up to limit entries under prefix, using Scan's framing,
+// starting after the key given in after (empty to start at the beginning).
+// maxBytes caps the size of the returned buffer so an unexpectedly large
+// prefix cannot exhaust memory; zero or negative disables either bound.
+// When the page was truncated by either bound, the last key returned is
+// stored in resumeKey for the next call's after argument; resumeKey is NULL
+// once the scan is done. Both buffers are released with FreeBuffer.
+//
+//export ScanPage
+func ScanPage(handle C.uintptr_t, prefix *C.char, prefixLen C.int, after *C.char, afterLen C.int, limit C.int, maxBytes C.int, resultLen *C.int, resumeKey **C.char, resumeKeyLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "scan_page", time.Now())
+	*resultLen = 0
+	*resumeKey = nil
+	*resumeKeyLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	var pref, from []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	if afterLen > 0 {
+		from = C.GoBytes(unsafe.Pointer(after), afterLen)
+	}
+	start, end, ok := userPrefixRange(pref)
+	if !ok {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	p, err := scanPage(store, start, end, from, int(limit), int(maxBytes))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(p.buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(p.buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if p.resume != nil {
+		key, err := returnValue(p.resume, resumeKeyLen)
+		if err != nil {
+			arenaFree(unsafe.Pointer(mem))
+			setHandleError(uintptr(handle), err)
+			return nil
+		}
+		*resumeKey = key
+	}
+	*resultLen = C.int(len(p.buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
@@ -72,7 +72,7 @@ def build(args: argparse.Namespace) -> None:
         if slate_entry not in entries:
             env[ld_var] = os.pathsep.join([slate_entry, *entries]) if entries else slate_entry
 
-    cmd = [args.go, "build", "-buildmode=c-shared", "-o", str(output), "./skyshelve.go"]
+    cmd = [args.go, "build", "-buildmode=c-shared", "-o", str(output), "."]
     result = subprocess.run(cmd, cwd=REPO_ROOT, env=env, capture_output=True, text=True)
     if result.returncode != 0:
         sys.stderr.write("Go build failed:\n")
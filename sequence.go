@@ -0,0 +1,151 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// sequencePrefix namespaces the keys that persist sequence leases. They sit
+// in the reserved 0xff keyspace, so scans and counts of user keys skip them.
+const sequencePrefix = "\xffskyshelve/seq/"
+
+// sequence hands out monotonically increasing IDs, leasing them from the
+// store in blocks of bandwidth so most calls never touch disk. IDs leased but
+// not handed out before Release are skipped, never reused.
+type sequence interface {
+	Next() (uint64, error)
+	Release() error
+}
+
+// sequencer is implemented by backends with a native sequence type.
+type sequencer interface {
+	Sequence(key []byte, bandwidth uint64) (sequence, error)
+}
+
+func openSequence(store kvStore, key []byte, bandwidth uint64) (sequence, error) {
+	if bandwidth == 0 {
+		return nil, errors.New("sequence bandwidth must be positive")
+	}
+	if sq, ok := store.(sequencer); ok {
+		return sq.Sequence(key, bandwidth)
+	}
+	return &leasedSequence{store: store, key: key, bandwidth: bandwidth}, nil
+}
+
+func (s *badgerStore) Sequence(key []byte, bandwidth uint64) (sequence, error) {
+	return s.db.GetSequence(key, bandwidth)
+}
+
+// leasedSequence mirrors badger.Sequence on top of updateKey: the stored
+// value is the big-endian start of the next unleased block.
+type leasedSequence struct {
+	mu        sync.Mutex
+	store     kvStore
+	key       []byte
+	bandwidth uint64
+	next      uint64
+	leased    uint64
+}
+
+func (q *leasedSequence) Next() (uint64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.next >= q.leased {
+		if err := q.lease(); err != nil {
+			return 0, err
+		}
+	}
+	id := q.next
+	q.next++
+	return id, nil
+}
+
+func (q *leasedSequence) lease() error {
+	var start uint64
+	err := updateKey(q.store, q.key, func(current []byte, found bool) ([]byte, bool, error) {
+		start = 0
+		if found {
+			if len(current) != 8 {
+				return nil, false, fmt.Errorf("sequence key %q holds a malformed lease", q.key)
+			}
+			start = binary.BigEndian.Uint64(current)
+		}
+		return binary.BigEndian.AppendUint64(nil, start+q.bandwidth), true, nil
+	})
+	if err != nil {
+		return err
+	}
+	q.next, q.leased = start, start+q.bandwidth
+	return nil
+}
+
+// Release returns nothing to the store: unused IDs in the current lease are
+// skipped, which keeps the sequence monotonic across processes.
+func (q *leasedSequence) Release() error { return nil }
+
+var (
+	sequenceMu sync.Mutex
+	sequences  = make(map[uintptr]map[string]sequence)
+)
+
+func getSequence(id uintptr, store kvStore, name string, bandwidth uint64) (sequence, error) {
+	sequenceMu.Lock()
+	defer sequenceMu.Unlock()
+	if seq, ok := sequences[id][name]; ok {
+		return seq, nil
+	}
+	seq, err := openSequence(store, []byte(sequencePrefix+name), bandwidth)
+	if err != nil {
+		return nil, err
+	}
+	if sequences[id] == nil {
+		sequences[id] = make(map[string]sequence)
+	}
+	sequences[id][name] = seq
+	return seq, nil
+}
+
+// releaseSequencesFor releases the sequences cached for a store handle. It
+// must run before the store closes, as badger writes its lease back.
+func releaseSequencesFor(id uintptr) {
+	sequenceMu.Lock()
+	open := sequences[id]
+	delete(sequences, id)
+	sequenceMu.Unlock()
+
+	for _, seq := range open {
+		_ = seq.Release()
+	}
+}
+
+// NextSequence stores the next ID of the sequence called name in result. IDs
+// start at 0 and are leased from the store bandwidth at a time; the
+// bandwidth passed on the first call for a name is kept until the handle is
+// closed. IDs are unique and increasing but may skip ranges after restarts.
+//
+//export NextSequence
+func NextSequence(handle C.uintptr_t, name *C.char, bandwidth C.uint64_t, result *C.uint64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	seq, err := getSequence(uintptr(handle), store, C.GoString(name), uint64(bandwidth))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	id, err := seq.Next()
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	*result = C.uint64_t(id)
+	return setHandleError(uintptr(handle), nil)
+}
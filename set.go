@@ -0,0 +1,179 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"time"
+	"unsafe"
+)
+
+// A set keeps each member as an empty-valued key: setPrefix, the set's u32
+// length-prefixed name, then the member.
+var setPrefix = []byte("\xffset/")
+
+func setBase(name []byte) []byte {
+	return appendLenPrefixed(append([]byte(nil), setPrefix...), name)
+}
+
+// setMember adds or removes member in one transaction, reporting whether
+// the set changed.
+func setMember(store kvStore, name, member []byte, add bool) (bool, error) {
+	key := append(setBase(name), member...)
+	var changed bool
+	err := retryConflicts(func() error {
+		changed = false
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+
+		_, err = txn.Get(key)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		if present := err == nil; present == add {
+			return nil
+		}
+		if add {
+			err = txn.Set(key, nil)
+		} else {
+			err = txn.Delete(key)
+		}
+		if err != nil {
+			return err
+		}
+		changed = true
+		return txn.Commit()
+	})
+	return changed, err
+}
+
+func setMemberExport(handle C.uintptr_t, key *C.char, keyLen C.int, member *C.char, memberLen C.int, add bool) C.int {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	gotMember := C.GoBytes(unsafe.Pointer(member), memberLen)
+
+	changed, err := setMember(store, gotKey, gotMember, add)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	setHandleError(uintptr(handle), nil)
+	if changed {
+		return 1
+	}
+	return 0
+}
+
+// SAdd adds member to the set named by key. Returns 1 when it was added, 0
+// when it was already a member and a negative status code on error.
+//
+//export SAdd
+func SAdd(handle C.uintptr_t, key *C.char, keyLen C.int, member *C.char, memberLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "sadd", time.Now())
+	return setMemberExport(handle, key, keyLen, member, memberLen, true)
+}
+
+// SRem removes member from the set named by key. Returns 1 when it was
+// removed, 0 when it was not a member and a negative status code on error.
+//
+//export SRem
+func SRem(handle C.uintptr_t, key *C.char, keyLen C.int, member *C.char, memberLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "srem", time.Now())
+	return setMemberExport(handle, key, keyLen, member, memberLen, false)
+}
+
+// SIsMember returns 1 when member is in the set named by key, 0 when it is
+// not and a negative status code on error.
+//
+//export SIsMember
+func SIsMember(handle C.uintptr_t, key *C.char, keyLen C.int, member *C.char, memberLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "sismember", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	gotMember := C.GoBytes(unsafe.Pointer(member), memberLen)
+
+	found, err := hasKey(store, append(setBase(gotKey), gotMember...))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	setHandleError(uintptr(handle), nil)
+	if found {
+		return 1
+	}
+	return 0
+}
+
+// SMembers returns the members of the set named by key in byte order, as
+// u32 length-prefixed members. A missing set is empty. Release the result
+// with FreeBuffer.
+//
+//export SMembers
+func SMembers(handle C.uintptr_t, key *C.char, keyLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "smembers", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	base := setBase(C.GoBytes(unsafe.Pointer(key), keyLen))
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	err = store.Iterate(base, func(k, _ []byte) error {
+		buffer = appendU32(buffer, uint32(len(k)-len(base)))
+		buffer = append(buffer, k[len(base):]...)
+		return nil
+	})
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
+
+// SCard returns the number of members in the set named by key, counted
+// inside the library, or a negative status code.
+//
+//export SCard
+func SCard(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	base := setBase(C.GoBytes(unsafe.Pointer(key), keyLen))
+	n, err := countKeys(store, base, nextPrefix(base))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(n)
+}
@@ -0,0 +1,68 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// closeAll syncs and closes every open store handle, taking each store's
+// buckets and snapshots down with it. It keeps going past failures and
+// reports them all.
+func closeAll() error {
+	stores := loadHandles()
+	ids := make([]uintptr, 0, len(stores))
+	for id := range stores {
+		if !isSnapshot(id) && !isBucket(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var errs []error
+	for _, id := range ids {
+		if err := stores[id].Sync(); err != nil {
+			errs = append(errs, fmt.Errorf("handle %d: sync: %w", id, err))
+		}
+		closeBucketsFor(id)
+		closeSnapshotsFor(id)
+		if err := closeHandle(id); err != nil {
+			errs = append(errs, fmt.Errorf("handle %d: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func closeLogFile() error {
+	logMu.Lock()
+	f := logFile
+	logFile = nil
+	logMu.Unlock()
+	if f == nil {
+		return nil
+	}
+	return f.close()
+}
+
+// CloseAll flushes and closes every open store handle, which also stops
+// their background goroutines (value-log GC, TTL sweeps, async writers),
+// then stops the metrics server and closes the log file. It is meant for
+// the host's atexit or shutdown path, so a handle the host forgot to close
+// does not leave badger replaying its WAL on the next start. Handles stay
+// invalid afterwards; new ones can still be opened.
+//
+//export CloseAll
+func CloseAll() (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	err := closeAll()
+	if stopErr := stopMetricsServer(); !errors.Is(stopErr, errMetricsNotRunning) {
+		err = errors.Join(err, stopErr)
+	}
+	return setError(errors.Join(err, closeLogFile()))
+}
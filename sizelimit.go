@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var errTooLarge = errors.New("key or value too large")
+
+// sizeError reports a key or value over the limit set at open. It matches
+// errTooLarge.
+type sizeError struct {
+	what  string
+	size  int
+	limit int
+}
+
+func (e *sizeError) Error() string {
+	return fmt.Sprintf("%s of %d bytes exceeds the %d byte limit", e.what, e.size, e.limit)
+}
+
+func (e *sizeError) Is(target error) bool { return target == errTooLarge }
+
+// sizeLimitStore rejects writes whose keys or values are over its limits
+// before they reach inner. Zero limits are off. It sits just inside the
+// change log, whose records hold whole writes and are let through, as are
+// blob chunks and manifests, which are sized by the blob code itself.
+type sizeLimitStore struct {
+	inner    kvStore
+	maxKey   int
+	maxValue int
+}
+
+func newSizeLimitStore(inner kvStore, maxKey, maxValue int) (*sizeLimitStore, error) {
+	if maxKey < 0 || maxValue < 0 {
+		return nil, errors.New("max_key_size and max_value_size must not be negative")
+	}
+	return &sizeLimitStore{inner: inner, maxKey: maxKey, maxValue: maxValue}, nil
+}
+
+func (s *sizeLimitStore) check(key, value []byte) error {
+	if s.maxKey > 0 && len(key) > s.maxKey {
+		return &sizeError{what: "key", size: len(key), limit: s.maxKey}
+	}
+	if s.maxValue > 0 && len(value) > s.maxValue {
+		return &sizeError{what: "value", size: len(value), limit: s.maxValue}
+	}
+	return nil
+}
+
+func (s *sizeLimitStore) checkOps(ops []operation) error {
+	for _, op := range ops {
+		if bytes.HasPrefix(op.key, changeLogPrefix) || bytes.HasPrefix(op.key, blobPrefix) {
+			continue
+		}
+		switch op.op {
+		case opSet, opSetTTL:
+			if err := s.check(op.key, op.value); err != nil {
+				return err
+			}
+		case opDelete:
+			if err := s.check(op.key, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *sizeLimitStore) unwrap() kvStore { return s.inner }
+
+func (s *sizeLimitStore) Close() error { return s.inner.Close() }
+
+func (s *sizeLimitStore) Set(key, value []byte) error {
+	if err := s.checkOps([]operation{{op: opSet, key: key, value: value}}); err != nil {
+		return err
+	}
+	return s.inner.Set(key, value)
+}
+
+func (s *sizeLimitStore) Get(key []byte) ([]byte, error) { return s.inner.Get(key) }
+
+func (s *sizeLimitStore) Has(key []byte) (bool, error) { return hasKey(s.inner, key) }
+
+func (s *sizeLimitStore) Delete(key []byte) error {
+	if err := s.checkOps([]operation{{op: opDelete, key: key}}); err != nil {
+		return err
+	}
+	return s.inner.Delete(key)
+}
+
+func (s *sizeLimitStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, fn)
+}
+
+func (s *sizeLimitStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, fn)
+}
+
+func (s *sizeLimitStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, fn)
+}
+
+func (s *sizeLimitStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *sizeLimitStore) Sync() error { return s.inner.Sync() }
+
+func (s *sizeLimitStore) Apply(ops []operation) error {
+	if err := s.checkOps(ops); err != nil {
+		return err
+	}
+	return s.inner.Apply(ops)
+}
+
+func (s *sizeLimitStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := s.checkOps([]operation{{op: opSetTTL, key: key, value: value}}); err != nil {
+		return err
+	}
+	return setWithTTL(s.inner, key, value, ttl)
+}
+
+func (s *sizeLimitStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+func (s *sizeLimitStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	if err := s.checkOps(ops); err != nil {
+		return 0, err
+	}
+	return applyDurable(s.inner, ops, level)
+}
+
+func (s *sizeLimitStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+// DeleteRange needs no checks, so it keeps the backend's fast path.
+func (s *sizeLimitStore) DeleteRange(start, end []byte) (int, error) {
+	return deleteRange(s.inner, start, end)
+}
+
+func (s *sizeLimitStore) SetWithMeta(key, value []byte, meta byte) error {
+	if err := s.check(key, value); err != nil {
+		return err
+	}
+	return setWithMeta(s.inner, key, value, meta)
+}
+
+func (s *sizeLimitStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	return getWithMeta(s.inner, key)
+}
+
+func (s *sizeLimitStore) CurrentVersion() (uint64, error) {
+	return versionsBelow{s.inner}.CurrentVersion()
+}
+
+func (s *sizeLimitStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	return versionsBelow{s.inner}.GetAt(key, version)
+}
+
+func (s *sizeLimitStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return versionsBelow{s.inner}.IterateAt(prefix, version, fn)
+}
+
+func (s *sizeLimitStore) Versions(key []byte) ([]keyVersion, error) {
+	return versionsBelow{s.inner}.Versions(key)
+}
+
+func (s *sizeLimitStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &sizeLimitTxn{txn: txn, store: s}, nil
+}
+
+func (s *sizeLimitStore) DropAll() error { return dropAll(s.inner) }
+
+func (s *sizeLimitStore) Compact() error { return compactStore(s.inner) }
+
+func (s *sizeLimitStore) Snapshot() (kvStore, error) { return openSnapshot(s.inner) }
+
+func (s *sizeLimitStore) Stats() (storeStats, error) { return collectStats(s.inner) }
+
+func (s *sizeLimitStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+// Load is not checked: a native backup holds entries a store already
+// accepted. Dumps applied with the Load export are written through Apply.
+func (s *sizeLimitStore) Load(r io.Reader) error { return restoreStore(s.inner, r) }
+
+// sizeLimitTxn checks each write as it is made, so an oversized one fails
+// without dooming the transaction.
+type sizeLimitTxn struct {
+	txn   kvTxn
+	store *sizeLimitStore
+}
+
+func (t *sizeLimitTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(key) }
+
+func (t *sizeLimitTxn) Set(key, value []byte) error {
+	if err := t.store.checkOps([]operation{{op: opSet, key: key, value: value}}); err != nil {
+		return err
+	}
+	return t.txn.Set(key, value)
+}
+
+func (t *sizeLimitTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := t.store.checkOps([]operation{{op: opSetTTL, key: key, value: value}}); err != nil {
+		return err
+	}
+	return txnSetWithTTL(t.txn, key, value, ttl)
+}
+
+func (t *sizeLimitTxn) Delete(key []byte) error {
+	if err := t.store.checkOps([]operation{{op: opDelete, key: key}}); err != nil {
+		return err
+	}
+	return t.txn.Delete(key)
+}
+
+func (t *sizeLimitTxn) Commit() error { return t.txn.Commit() }
+
+func (t *sizeLimitTxn) Discard() { t.txn.Discard() }
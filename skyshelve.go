@@ -14,10 +14,13 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/dgraph-io/badger/v4"
@@ -30,50 +33,248 @@ type kvStore interface {
 	Get(key []byte) ([]byte, error)
 	Delete(key []byte) error
 	Iterate(prefix []byte, fn func(k, v []byte) error) error
+	IterateRange(start, end []byte, fn func(k, v []byte) error) error
 	Sync() error
 	Apply(ops []operation) error
 }
 
+// Operation codes used by the Apply encoding.
+const (
+	opSet    byte = 0
+	opDelete byte = 1
+	// opSetTTL is opSet followed by a u64 time-to-live in seconds.
+	opSetTTL byte = 2
+)
+
 type operation struct {
 	op    byte
 	key   []byte
 	value []byte
+	ttl   time.Duration
+}
+
+// errStopIteration is returned from an iteration callback to end the scan
+// early without reporting a failure.
+var errStopIteration = errors.New("stop iteration")
+
+var errInvalidHandle = errors.New("invalid handle")
+
+// keyChecker is implemented by backends that can test for a key without
+// reading its value.
+type keyChecker interface {
+	Has(key []byte) (bool, error)
+}
+
+func hasKey(store kvStore, key []byte) (bool, error) {
+	if kc, ok := store.(keyChecker); ok {
+		return kc.Has(key)
+	}
+	_, err := store.Get(key)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// reverseIterator is implemented by backends that can walk a key range in
+// descending order natively.
+type reverseIterator interface {
+	IterateReverse(start, end []byte, fn func(k, v []byte) error) error
+}
+
+// iterateReverse visits keys in [start, end) in descending order. Backends
+// without native support are scanned forwards into memory and replayed.
+func iterateReverse(store kvStore, start, end []byte, fn func(k, v []byte) error) error {
+	if ri, ok := store.(reverseIterator); ok {
+		return ri.IterateReverse(start, end, fn)
+	}
+
+	type entry struct{ key, value []byte }
+	var entries []entry
+	err := store.IterateRange(start, end, func(k, v []byte) error {
+		entries = append(entries, entry{k, v})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := fn(entries[i].key, entries[i].value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyCounter is implemented by backends that can count keys without reading
+// values.
+type keyCounter interface {
+	Count(start, end []byte) (int, error)
+}
+
+// countKeys counts the keys in [start, end).
+func countKeys(store kvStore, start, end []byte) (int, error) {
+	if kc, ok := store.(keyCounter); ok {
+		return kc.Count(start, end)
+	}
+	n := 0
+	err := store.IterateRange(start, end, func(_, _ []byte) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// isNotFound reports whether err signals a missing key. Backends word this
+// differently, so anything mentioning "not found" qualifies, matching how the
+// Python wrapper classifies errors.
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, badger.ErrKeyNotFound) || strings.Contains(strings.ToLower(err.Error()), "not found")
+}
+
+// Status codes returned by exports (and by ErrorCode for exports that return
+// pointers). They are part of the C ABI; never renumber them.
+const (
+	codeOK            = 0
+	codeError         = -1
+	codeNotFound      = -2
+	codeConflict      = -3
+	codeInvalidHandle = -4
+	codeClosed        = -5
+	codeCorrupt       = -6
+	codePanic         = -7
+	codeQuota         = -8
+	codeThrottled     = -9
+	codeTooLarge      = -10
+	codeReservedKey   = -11
+)
+
+// unknownHandleError reports a lookup of a cursor, transaction or other
+// auxiliary handle that does not exist. It matches errInvalidHandle.
+type unknownHandleError string
+
+func (e unknownHandleError) Error() string { return "invalid " + string(e) + " handle" }
+
+func (e unknownHandleError) Is(target error) bool { return target == errInvalidHandle }
+
+func errorCode(err error) C.int {
+	switch {
+	case err == nil:
+		return codeOK
+	case isNotFound(err):
+		return codeNotFound
+	case errors.Is(err, errConflict), errors.Is(err, badger.ErrConflict):
+		return codeConflict
+	case errors.Is(err, errInvalidHandle):
+		return codeInvalidHandle
+	case errors.Is(err, badger.ErrDBClosed), errors.Is(err, errCursorClosed), errors.Is(err, errWatchClosed):
+		return codeClosed
+	case errors.Is(err, errCorrupt):
+		return codeCorrupt
+	case errors.Is(err, errPanic):
+		return codePanic
+	case errors.Is(err, errQuotaExceeded):
+		return codeQuota
+	case errors.Is(err, errThrottled):
+		return codeThrottled
+	case errors.Is(err, errTooLarge):
+		return codeTooLarge
+	case errors.Is(err, errReservedKey):
+		return codeReservedKey
+	default:
+		return codeError
+	}
 }
 
+type errorState struct {
+	code    C.int
+	message string
+}
+
+// The handle table is copy-on-write: lookups load an immutable map without
+// taking a lock, and only Open and Close, under handleMu, publish a new one.
 var (
-	handleMu  sync.RWMutex
-	handles           = make(map[uintptr]kvStore)
-	nextID    uintptr = 1
-	errorMu   sync.Mutex
-	lastError string
+	handleMu     sync.Mutex
+	handles      atomic.Pointer[map[uintptr]kvStore]
+	nextID       uintptr = 1
+	errorMu      sync.Mutex
+	lastError    string
+	lastCode     C.int
+	handleErrors = make(map[uintptr]errorState)
 )
 
 func setError(err error) C.int {
 	errorMu.Lock()
 	defer errorMu.Unlock()
+	lastCode = errorCode(err)
 	if err != nil {
 		lastError = err.Error()
-		return -1
+		return lastCode
 	}
 	lastError = ""
-	return 0
+	return codeOK
+}
+
+// setHandleError records err against a store handle as well as globally, so
+// hosts driving different handles from different threads can read their own
+// failure through LastErrorForHandle.
+func setHandleError(id uintptr, err error) C.int {
+	if errors.Is(err, errInvalidHandle) {
+		return setError(err)
+	}
+	errorMu.Lock()
+	if err != nil {
+		handleErrors[id] = errorState{code: errorCode(err), message: err.Error()}
+	} else {
+		delete(handleErrors, id)
+	}
+	errorMu.Unlock()
+	return setError(err)
+}
+
+func clearHandleError(id uintptr) {
+	errorMu.Lock()
+	defer errorMu.Unlock()
+	delete(handleErrors, id)
+}
+
+func loadHandles() map[uintptr]kvStore {
+	if m := handles.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+// updateHandles publishes a copy of the handle table with fn applied. The
+// caller holds handleMu.
+func updateHandles(fn func(map[uintptr]kvStore)) {
+	current := loadHandles()
+	next := make(map[uintptr]kvStore, len(current)+1)
+	for id, store := range current {
+		next[id] = store
+	}
+	fn(next)
+	handles.Store(&next)
 }
 
+// storeHandle registers store under a new handle, behind a notifyStore that
+// reports its writes to the handle's write callbacks.
 func storeHandle(store kvStore) uintptr {
 	handleMu.Lock()
 	defer handleMu.Unlock()
 	id := nextID
 	nextID++
-	handles[id] = store
+	updateHandles(func(m map[uintptr]kvStore) { m[id] = &notifyStore{inner: store, id: id} })
 	return id
 }
 
 func getHandle(id uintptr) (kvStore, error) {
-	handleMu.RLock()
-	defer handleMu.RUnlock()
-	store, ok := handles[id]
+	store, ok := loadHandles()[id]
 	if !ok {
-		return nil, errors.New("invalid handle")
+		return nil, errInvalidHandle
 	}
 	return store, nil
 }
@@ -81,26 +282,51 @@ func getHandle(id uintptr) (kvStore, error) {
 func deleteHandle(id uintptr) {
 	handleMu.Lock()
 	defer handleMu.Unlock()
-	delete(handles, id)
+	updateHandles(func(m map[uintptr]kvStore) { delete(m, id) })
 }
 
 //export Open
-func Open(path *C.char, inMemory C.int) C.uintptr_t {
-	store, err := openStore(C.GoString(path), inMemory != 0)
+func Open(path *C.char, inMemory C.int) (ret C.uintptr_t) {
+	defer recoverExport(0, &ret, 0)
+	raw := C.GoString(path)
+	store, err := openStore(raw, inMemory != 0)
 	if err != nil {
 		setError(err)
 		return 0
 	}
 
+	id := storeHandle(store)
+	describeHandle(id, describeOpen(raw, inMemory != 0))
 	setError(nil)
-	return C.uintptr_t(storeHandle(store))
+	return C.uintptr_t(id)
+}
+
+// badgerReader holds the read paths shared by live stores and snapshots.
+// view runs fn inside a read transaction.
+type badgerReader struct {
+	view func(fn func(txn *badger.Txn) error) error
 }
 
 type badgerStore struct {
-	db *badger.DB
+	badgerReader
+	db           *badger.DB
+	discardRatio float64
+	// stop ends the background value-log GC; gcDone closes once it exits.
+	stop   chan struct{}
+	gcDone chan struct{}
 }
 
-func (s *badgerStore) Close() error { return s.db.Close() }
+func newBadgerStore(db *badger.DB) *badgerStore {
+	return &badgerStore{badgerReader: badgerReader{view: db.View}, db: db, discardRatio: defaultDiscardRatio}
+}
+
+func (s *badgerStore) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.gcDone
+	}
+	return s.db.Close()
+}
 
 func (s *badgerStore) Set(key, value []byte) error {
 	return s.db.Update(func(txn *badger.Txn) error {
@@ -108,9 +334,9 @@ func (s *badgerStore) Set(key, value []byte) error {
 	})
 }
 
-func (s *badgerStore) Get(key []byte) ([]byte, error) {
+func (r *badgerReader) Get(key []byte) ([]byte, error) {
 	var result []byte
-	err := s.db.View(func(txn *badger.Txn) error {
+	err := r.view(func(txn *badger.Txn) error {
 		item, err := txn.Get(key)
 		if err != nil {
 			return err
@@ -123,14 +349,69 @@ func (s *badgerStore) Get(key []byte) ([]byte, error) {
 	return result, err
 }
 
+// GetMany reads every key inside a single read transaction.
+func (r *badgerReader) GetMany(keys [][]byte) ([]lookup, error) {
+	results := make([]lookup, len(keys))
+	err := r.view(func(txn *badger.Txn) error {
+		for i, key := range keys {
+			item, err := txn.Get(key)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			results[i] = lookup{value: value, found: true}
+		}
+		return nil
+	})
+	return results, err
+}
+
+// Has looks the key up without touching the value log.
+func (r *badgerReader) Has(key []byte) (bool, error) {
+	err := r.view(func(txn *badger.Txn) error {
+		_, err := txn.Get(key)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Count walks keys only, so values in the value log are never read.
+func (r *badgerReader) Count(start, end []byte) (int, error) {
+	n := 0
+	err := r.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(start); it.Valid(); it.Next() {
+			if end != nil && bytes.Compare(it.Item().Key(), end) >= 0 {
+				break
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
 func (s *badgerStore) Delete(key []byte) error {
 	return s.db.Update(func(txn *badger.Txn) error {
 		return txn.Delete(key)
 	})
 }
 
-func (s *badgerStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
-	return s.db.View(func(txn *badger.Txn) error {
+func (r *badgerReader) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return r.view(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
 		opts.PrefetchValues = true
 		it := txn.NewIterator(opts)
@@ -161,23 +442,88 @@ func (s *badgerStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
 	})
 }
 
+// IterateRange visits keys in [start, end). A nil start begins at the first
+// key and a nil end runs to the last.
+func (r *badgerReader) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return r.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(start); it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			if end != nil && bytes.Compare(key, end) >= 0 {
+				return nil
+			}
+			err := item.Value(func(val []byte) error {
+				return fn(key, append([]byte(nil), val...))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// IterateReverse visits keys in [start, end) from the highest key down.
+func (r *badgerReader) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return r.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// In reverse mode Seek lands on the largest key <= the target.
+		if end == nil {
+			it.Rewind()
+		} else {
+			it.Seek(end)
+		}
+		for ; it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			if end != nil && bytes.Compare(key, end) >= 0 {
+				continue
+			}
+			if start != nil && bytes.Compare(key, start) < 0 {
+				return nil
+			}
+			err := item.Value(func(val []byte) error {
+				return fn(key, append([]byte(nil), val...))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (s *badgerStore) Sync() error { return s.db.Sync() }
 
 func (s *badgerStore) Apply(ops []operation) error {
 	return s.db.Update(func(txn *badger.Txn) error {
 		for _, op := range ops {
 			switch op.op {
-			case 0:
+			case opSet:
 				if err := txn.Set(op.key, op.value); err != nil {
 					return err
 				}
-			case 1:
+			case opDelete:
 				if err := txn.Delete(op.key); err != nil {
 					if errors.Is(err, badger.ErrKeyNotFound) {
 						continue
 					}
 					return err
 				}
+			case opSetTTL:
+				if err := txn.SetEntry(badger.NewEntry(op.key, op.value).WithTTL(op.ttl)); err != nil {
+					return err
+				}
 			default:
 				return errors.New("unknown operation code")
 			}
@@ -187,30 +533,81 @@ func (s *badgerStore) Apply(ops []operation) error {
 }
 
 type slateStore struct {
-	db *slatedb.DB
+	db        *slatedb.DB
 	writeOpts *slatedb.WriteOptions
+	// commitMu is held shared by every write and exclusively by emulated
+	// transaction commits and Snapshot.
+	commitMu sync.RWMutex
+	// sweepInterval is how often the expired-entry sweeper runs once the
+	// first TTL write starts it through sweepOnce. stop ends it; sweepDone
+	// closes once it exits.
+	sweepInterval time.Duration
+	sweepOnce     sync.Once
+	stop          chan struct{}
+	sweepDone     chan struct{}
+	watchers      slateWatchers
+	// snapshots are the open read views; writes save the values they
+	// replace into each of them first. Guarded by snapMu.
+	snapMu    sync.Mutex
+	snapshots map[*slateSnapshot]struct{}
+	// writeSeq numbers batch writes; durableSeq is the highest one known to
+	// be persisted, guarded by durableMu.
+	writeSeq   atomic.Uint64
+	durableMu  sync.Mutex
+	durableSeq uint64
 }
 
-func (s *slateStore) Close() error { return s.db.Close() }
+func (s *slateStore) Close() error {
+	// Using up sweepOnce keeps a racing TTL write from starting the sweeper.
+	s.sweepOnce.Do(func() {})
+	if s.stop != nil {
+		close(s.stop)
+		<-s.sweepDone
+	}
+	return s.db.Close()
+}
 
 func (s *slateStore) Set(key, value []byte) error {
-	return s.db.PutWithOptions(key, value, nil, s.writeOpts)
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	if err := s.preserve(key); err != nil {
+		return err
+	}
+	if err := s.db.PutWithOptions(key, plainValue(value), nil, s.writeOpts); err != nil {
+		return err
+	}
+	s.watchers.notify([]operation{{op: opSet, key: key, value: value}})
+	return nil
 }
 
 func (s *slateStore) Get(key []byte) ([]byte, error) {
-	value, err := s.db.Get(key)
+	raw, err := s.db.Get(key)
 	if err != nil {
 		return nil, err
 	}
+	value, live := unwrapExpiry(raw, time.Now())
+	if !live {
+		return nil, badger.ErrKeyNotFound
+	}
 	return value, nil
 }
 
 func (s *slateStore) Delete(key []byte) error {
-	return s.db.DeleteWithOptions(key, s.writeOpts)
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	if err := s.preserve(key); err != nil {
+		return err
+	}
+	if err := s.db.DeleteWithOptions(key, s.writeOpts); err != nil {
+		return err
+	}
+	s.watchers.notify([]operation{{op: opDelete, key: key}})
+	return nil
 }
 
-func (s *slateStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
-	start, end := prefixRange(prefix)
+// scan walks the raw stored entries in [start, end), including expiry
+// envelopes. The slices passed to fn are only valid during the call.
+func (s *slateStore) scan(start, end []byte, fn func(k, raw []byte) error) error {
 	iter, err := s.db.Scan(start, end)
 	if err != nil {
 		return err
@@ -225,57 +622,156 @@ func (s *slateStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
 		if err != nil {
 			return err
 		}
-		if len(prefix) > 0 && !bytes.HasPrefix(kv.Key, prefix) {
-			continue
-		}
-		if err := fn(append([]byte(nil), kv.Key...), append([]byte(nil), kv.Value...)); err != nil {
+		if err := fn(kv.Key, kv.Value); err != nil {
 			return err
 		}
 	}
 }
 
+func (s *slateStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	start, end := prefixRange(prefix)
+	now := time.Now()
+	return s.scan(start, end, func(k, raw []byte) error {
+		if len(prefix) > 0 && !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		value, live := unwrapExpiry(raw, now)
+		if !live {
+			return nil
+		}
+		return fn(append([]byte(nil), k...), append([]byte(nil), value...))
+	})
+}
+
+func (s *slateStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	now := time.Now()
+	return s.scan(start, end, func(k, raw []byte) error {
+		value, live := unwrapExpiry(raw, now)
+		if !live {
+			return nil
+		}
+		return fn(append([]byte(nil), k...), append([]byte(nil), value...))
+	})
+}
+
+// Count skips expired entries the sweeper has not removed yet. Values are
+// not copied out of the iterator.
+func (s *slateStore) Count(start, end []byte) (int, error) {
+	n := 0
+	now := time.Now()
+	err := s.scan(start, end, func(_, raw []byte) error {
+		if _, live := unwrapExpiry(raw, now); live {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
 func (s *slateStore) Sync() error { return s.db.Flush() }
 
 func (s *slateStore) Apply(ops []operation) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	_, err := s.applyWith(ops, nil)
+	return err
+}
+
+// applyWith commits ops as one batch, using opts instead of the plain write
+// path when set, and returns the batch's write sequence number. Callers
+// hold commitMu.
+func (s *slateStore) applyWith(ops []operation, opts *slatedb.WriteOptions) (uint64, error) {
 	batch, err := slatedb.NewWriteBatch()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer batch.Close()
 
+	expiring := false
 	for _, op := range ops {
+		if err := s.preserve(op.key); err != nil {
+			return 0, err
+		}
 		switch op.op {
-		case 0:
-			if err := batch.Put(op.key, op.value); err != nil {
-				return err
+		case opSet:
+			if err := batch.Put(op.key, plainValue(op.value)); err != nil {
+				return 0, err
 			}
-		case 1:
+		case opDelete:
 			if err := batch.Delete(op.key); err != nil {
-				return err
+				return 0, err
 			}
+		case opSetTTL:
+			if err := batch.Put(op.key, wrapExpiry(op.value, op.ttl)); err != nil {
+				return 0, err
+			}
+			expiring = true
 		default:
-			return errors.New("unknown operation code")
+			return 0, errors.New("unknown operation code")
 		}
 	}
 
-	return s.db.Write(batch)
+	if opts == nil {
+		err = s.db.Write(batch)
+	} else {
+		err = s.db.WriteWithOptions(batch, opts)
+	}
+	if err != nil {
+		return 0, err
+	}
+	seq := s.writeSeq.Add(1)
+	if expiring {
+		s.startSweeper()
+	}
+	s.watchers.notify(ops)
+	return seq, nil
 }
 
 type slateOpenConfig struct {
 	Path  string               `json:"path"`
 	Store *slatedb.StoreConfig `json:"store,omitempty"`
 	Async bool                 `json:"async,omitempty"`
+	// SweepInterval controls how often expired TTL entries are purged, as a
+	// Go duration string. The sweeper starts with the handle's first TTL
+	// write; a negative value disables it.
+	SweepInterval string `json:"ttl_sweep_interval,omitempty"`
+	// FlushInterval is a Go duration string forwarded to SlateDB.
+	FlushInterval string          `json:"flush_interval,omitempty"`
+	CacheDir      string          `json:"cache_dir,omitempty"`
+	Credentials   *awsCredentials `json:"credentials,omitempty"`
+}
+
+func init() {
+	registerBackend("badger", openBadgerURI)
+	registerBackend("slatedb", openSlate)
+	registerBackend("slatedb+s3", openSlateURL)
+	registerBackend("slatedb+file", openSlateURL)
 }
 
 func openStore(path string, inMemory bool) (kvStore, error) {
 	trimmed := strings.TrimSpace(path)
-	if strings.HasPrefix(strings.ToLower(trimmed), "slatedb:") {
-		return openSlate(trimmed)
+	if open, ok := lookupBackend(trimmed); ok {
+		return open(trimmed)
+	}
+	// Unregistered slatedb+ schemes such as slatedb+gs get parseSlateURL's
+	// error rather than being taken for a badger directory name.
+	if strings.HasPrefix(strings.ToLower(trimmed), "slatedb+") {
+		return openSlateURL(trimmed)
 	}
 	return openBadger(trimmed, inMemory)
 }
 
+// openBadgerURI opens an explicit "badger:" path as a badger directory.
+func openBadgerURI(raw string) (kvStore, error) {
+	path := strings.TrimSpace(raw[len("badger:"):])
+	return openBadger(strings.TrimPrefix(path, "//"), false)
+}
+
 func openBadger(path string, inMemory bool) (kvStore, error) {
+	return openBadgerConfig(path, inMemory, nil, nil)
+}
+
+func openBadgerConfig(path string, inMemory bool, cfg *badgerConfig, enc *encryptionConfig) (kvStore, error) {
 	if !inMemory && path == "" {
 		path = defaultDataDir("badger")
 	}
@@ -288,14 +784,40 @@ func openBadger(path string, inMemory bool) (kvStore, error) {
 			return nil, err
 		}
 		opts = badger.DefaultOptions(path)
-		opts.Logger = nil
+	}
+	opts = opts.WithLogger(badgerLogger{})
+	if cfg != nil {
+		var err error
+		if opts, err = cfg.apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	if enc != nil {
+		var err error
+		if opts, err = enc.applyBadger(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var interval time.Duration
+	ratio := defaultDiscardRatio
+	if cfg != nil {
+		var err error
+		if interval, ratio, err = cfg.gcSettings(); err != nil {
+			return nil, err
+		}
 	}
 
 	db, err := badger.Open(opts)
 	if err != nil {
 		return nil, err
 	}
-	return &badgerStore{db: db}, nil
+	store := newBadgerStore(db)
+	store.discardRatio = ratio
+	if interval > 0 && !inMemory {
+		store.startValueLogGC(interval)
+	}
+	return store, nil
 }
 
 func openSlate(raw string) (kvStore, error) {
@@ -315,31 +837,52 @@ func openSlate(raw string) (kvStore, error) {
 	default:
 		cfg.Path = configPart
 	}
+	return openSlateConfig(&cfg)
+}
 
+func openSlateConfig(cfg *slateOpenConfig) (kvStore, error) {
 	if cfg.Path == "" {
 		cfg.Path = defaultDataDir("slatedb")
 	}
 
-	if err := os.MkdirAll(cfg.Path, 0o755); err != nil {
-		return nil, err
-	}
-
 	storeCfg := cfg.Store
 	if storeCfg == nil {
 		storeCfg = &slatedb.StoreConfig{Provider: slatedb.ProviderLocal}
 	} else if storeCfg.Provider == "" {
 		storeCfg.Provider = slatedb.ProviderLocal
 	}
-	db, err := slatedb.Open(cfg.Path, storeCfg, nil)
+
+	// Object-store providers treat the path as a key prefix, not a directory.
+	if storeCfg.Provider == slatedb.ProviderLocal {
+		if err := os.MkdirAll(cfg.Path, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	dbOpts, err := cfg.slateOptions()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Credentials.export()
+
+	db, err := slatedb.Open(cfg.Path, storeCfg, dbOpts)
 	if err != nil {
 		return nil, err
 	}
-	return &slateStore{
+	store := &slateStore{
 		db: db,
 		writeOpts: &slatedb.WriteOptions{
 			AwaitDurable: cfg.Async,
-			},
-		}, nil
+		},
+		sweepInterval: defaultSweepInterval,
+	}
+	if cfg.SweepInterval != "" {
+		if store.sweepInterval, err = time.ParseDuration(cfg.SweepInterval); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return store, nil
 }
 
 func defaultDataDir(name string) string {
@@ -350,94 +893,281 @@ func defaultDataDir(name string) string {
 }
 
 //export Close
-func Close(handle C.uintptr_t) C.int {
-	db, err := getHandle(uintptr(handle))
+func Close(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	if _, err := getHandle(uintptr(handle)); err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	closeBucketsFor(uintptr(handle))
+	closeSnapshotsFor(uintptr(handle))
+	if err := closeHandle(uintptr(handle)); err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setError(nil)
+}
+
+// closeHandle tears down everything attached to a store handle, then the
+// store itself.
+func closeHandle(id uintptr) error {
+	db, err := getHandle(id)
 	if err != nil {
-		return setError(err)
+		return err
+	}
+	closeCursorsFor(id)
+	closeBlobsFor(id)
+	discardTxnsFor(id)
+	flushAsyncFor(id)
+	if err := stopReplicationFor(id); err != nil {
+		logf(logWarn, "replication", "handle %d: %v", id, err)
+	}
+	if err := stopHTTPServerFor(id); err != nil {
+		logf(logWarn, "http", "handle %d: %v", id, err)
+	}
+	if err := stopGRPCServerFor(id); err != nil {
+		logf(logWarn, "grpc", "handle %d: %v", id, err)
+	}
+	if err := stopRESPServerFor(id); err != nil {
+		logf(logWarn, "resp", "handle %d: %v", id, err)
+	}
+	if err := stopMemcacheServerFor(id); err != nil {
+		logf(logWarn, "memcache", "handle %d: %v", id, err)
 	}
+	releaseSequencesFor(id)
 	if err := db.Close(); err != nil {
-		return setError(err)
+		return err
 	}
-	deleteHandle(uintptr(handle))
-	return setError(nil)
+	deleteHandle(id)
+	closeWatchesFor(id)
+	forgetSnapshot(id)
+	forgetBucket(id)
+	forgetBucketUsage(db)
+	forgetMigration(id)
+	forgetCheckpointDir(id)
+	forgetMergeOperators(id)
+	forgetVectors(id)
+	forgetWriteCallbacks(id)
+	forgetMetrics(id)
+	forgetHandleInfo(id)
+	clearHandleError(id)
+	return nil
 }
 
 //export Set
-func Set(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int) C.int {
+func Set(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "set", time.Now())
 	store, err := getHandle(uintptr(handle))
 	if err != nil {
-		return setError(err)
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
 	}
-	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
 	gotValue := C.GoBytes(unsafe.Pointer(value), valueLen)
-	err = store.Set(gotKey, gotValue)
-	return setError(err)
+	if q := groupCommitQueue(uintptr(handle)); q != nil {
+		return setHandleError(uintptr(handle), q.write([]operation{{op: opSet, key: gotKey, value: gotValue}}))
+	}
+	if err := store.Set(gotKey, gotValue); err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), nil)
 }
 
 //export Get
-func Get(handle C.uintptr_t, key *C.char, keyLen C.int, valueLen *C.int) *C.char {
+func Get(handle C.uintptr_t, key *C.char, keyLen C.int, valueLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "get", time.Now())
 	store, err := getHandle(uintptr(handle))
 	if err != nil {
-		setError(err)
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
 		return nil
 	}
-	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
 
 	data, err := store.Get(gotKey)
 	if err != nil {
-		setError(err)
+		setHandleError(uintptr(handle), err)
 		return nil
 	}
+	buf, err := returnValue(data, valueLen)
+	setHandleError(uintptr(handle), err)
+	return buf
+}
 
-	size := len(data)
-	if size == 0 {
-		buf := C.malloc(1)
-		if buf == nil {
-			setError(errors.New("malloc failed"))
-			return nil
-		}
-		*valueLen = 0
-		setError(nil)
-		return (*C.char)(buf)
+// GetInto copies the value for key into buf, which the caller owns, and
+// stores its length in valueLen. It returns 0 on success, a negative status
+// code on error, or, when the value does not fit in bufCap bytes, the size
+// needed, leaving buf untouched so the host can grow it and retry.
+//
+//export GetInto
+func GetInto(handle C.uintptr_t, key *C.char, keyLen C.int, buf *C.char, bufCap C.int, valueLen *C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "get", time.Now())
+	*valueLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
 	}
 
-	buf := C.malloc(C.size_t(size))
+	data, err := store.Get(gotKey)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if len(data) > math.MaxInt32 {
+		return setHandleError(uintptr(handle), errors.New("value too large for GetInto"))
+	}
+	*valueLen = C.int(len(data))
+	setHandleError(uintptr(handle), nil)
+	if len(data) > int(bufCap) {
+		return C.int(len(data))
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(buf)), len(data)), data)
+	return codeOK
+}
+
+// returnValue hands data to the host as a FreeBuffer-owned allocation. Empty
+// values still get a non-nil pointer so hosts can tell them apart from misses.
+func returnValue(data []byte, valueLen *C.int) (*C.char, error) {
+	size := len(data)
+	buf := arenaAlloc(max(size, 1))
 	if buf == nil {
-		setError(errors.New("malloc failed"))
-		return nil
+		return nil, errors.New("malloc failed")
 	}
 
 	copy(((*[1 << 30]byte)(unsafe.Pointer(buf)))[:size:size], data)
 	*valueLen = C.int(size)
-	setError(nil)
-	return (*C.char)(buf)
+	return (*C.char)(buf), nil
 }
 
 //export Delete
-func Delete(handle C.uintptr_t, key *C.char, keyLen C.int) C.int {
+func Delete(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "delete", time.Now())
 	store, err := getHandle(uintptr(handle))
 	if err != nil {
-		return setError(err)
+		return setHandleError(uintptr(handle), err)
 	}
-	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
-	err = store.Delete(gotKey)
-	return setError(err)
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if q := groupCommitQueue(uintptr(handle)); q != nil {
+		return setHandleError(uintptr(handle), q.write([]operation{{op: opDelete, key: gotKey}}))
+	}
+	if err := store.Delete(gotKey); err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), nil)
+}
+
+// Has returns 1 when the key exists, 0 when it does not and -1 on error,
+// without copying the value across the cgo boundary.
+//
+//export Has
+func Has(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "has", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	found, err := hasKey(store, gotKey)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	setHandleError(uintptr(handle), nil)
+	if found {
+		return 1
+	}
+	return 0
+}
+
+// Count returns the number of keys under prefix (every key when the prefix
+// is empty), or a negative status code on error. Keys in the reserved 0xff
+// keyspace are never counted.
+//
+//export Count
+func Count(handle C.uintptr_t, prefix *C.char, prefixLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	start, end := prefixRange(pref)
+	return countRange(uintptr(handle), start, end)
+}
+
+// CountRange returns the number of keys in [start, end), or a negative status
+// code on error. Empty bounds are open.
+//
+//export CountRange
+func CountRange(handle C.uintptr_t, start *C.char, startLen C.int, end *C.char, endLen C.int) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	var from, to []byte
+	if startLen > 0 {
+		from = C.GoBytes(unsafe.Pointer(start), startLen)
+	}
+	if endLen > 0 {
+		to = C.GoBytes(unsafe.Pointer(end), endLen)
+	}
+	return countRange(uintptr(handle), from, to)
+}
+
+func countRange(id uintptr, start, end []byte) C.int64_t {
+	defer observe(id, "count", time.Now())
+	store, err := getHandle(id)
+	if err != nil {
+		return C.int64_t(setHandleError(id, err))
+	}
+	start, end, ok := userRange(start, end)
+	if !ok {
+		setHandleError(id, nil)
+		return 0
+	}
+	n, err := countKeys(store, start, end)
+	if err != nil {
+		return C.int64_t(setHandleError(id, err))
+	}
+	setHandleError(id, nil)
+	return C.int64_t(n)
 }
 
 //export Sync
-func Sync(handle C.uintptr_t) C.int {
+func Sync(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "sync", time.Now())
 	store, err := getHandle(uintptr(handle))
 	if err != nil {
-		return setError(err)
+		return setHandleError(uintptr(handle), err)
 	}
-	return setError(store.Sync())
+	return setHandleError(uintptr(handle), store.Sync())
 }
 
+// Scan returns every entry under prefix, framed as u32 key length, u32
+// value length, key and value. Keys in the reserved 0xff keyspace, where the
+// library keeps its own records, are left out of this and every other
+// public scan.
+//
 //export Scan
-func Scan(handle C.uintptr_t, prefix *C.char, prefixLen C.int, resultLen *C.int) *C.char {
+func Scan(handle C.uintptr_t, prefix *C.char, prefixLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "scan", time.Now())
 	store, err := getHandle(uintptr(handle))
 	if err != nil {
-		setError(err)
+		setHandleError(uintptr(handle), err)
 		return nil
 	}
 
@@ -446,32 +1176,146 @@ func Scan(handle C.uintptr_t, prefix *C.char, prefixLen C.int, resultLen *C.int)
 		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
 	}
 
-	var buffer []byte
-	err = store.Iterate(pref, func(k, v []byte) error {
-		buffer = appendEntry(buffer, k, v)
-		return nil
-	})
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	if start, end, ok := userPrefixRange(pref); ok {
+		err = store.IterateRange(start, end, func(k, v []byte) error {
+			buffer = appendEntry(buffer, k, v)
+			return nil
+		})
+	}
 	if err != nil {
-		setError(err)
+		setHandleError(uintptr(handle), err)
 		return nil
 	}
 
 	if len(buffer) == 0 {
 		*resultLen = 0
-		setError(nil)
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
 		return nil
 	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
 
-	mem := C.malloc(C.size_t(len(buffer)))
+// copyToC copies buf into C-allocated memory that the host releases with
+// FreeBuffer.
+func copyToC(buf []byte) (*C.char, error) {
+	mem := arenaAlloc(len(buf))
 	if mem == nil {
-		setError(errors.New("malloc failed"))
+		return nil, errors.New("malloc failed")
+	}
+	copy(((*[1 << 30]byte)(unsafe.Pointer(mem)))[:len(buf):len(buf)], buf)
+	return (*C.char)(mem), nil
+}
+
+// RangeScan returns the entries with keys in [start, end) using the same
+// framing as Scan. An empty start or end leaves that side of the range open
+// and a non-positive limit returns every matching entry.
+//
+//export RangeScan
+func RangeScan(handle C.uintptr_t, start *C.char, startLen C.int, end *C.char, endLen C.int, limit C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "range_scan", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	var from, to []byte
+	if startLen > 0 {
+		from = C.GoBytes(unsafe.Pointer(start), startLen)
+	}
+	if endLen > 0 {
+		to = C.GoBytes(unsafe.Pointer(end), endLen)
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	count := 0
+	if from, to, ok := userRange(from, to); ok {
+		err = store.IterateRange(from, to, func(k, v []byte) error {
+			if limit > 0 && count >= int(limit) {
+				return errStopIteration
+			}
+			buffer = appendEntry(buffer, k, v)
+			count++
+			return nil
+		})
+	}
+	if err != nil && !errors.Is(err, errStopIteration) {
+		setHandleError(uintptr(handle), err)
 		return nil
 	}
 
-	copy(((*[1 << 30]byte)(unsafe.Pointer(mem)))[:len(buffer):len(buffer)], buffer)
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
 	*resultLen = C.int(len(buffer))
-	setError(nil)
-	return (*C.char)(mem)
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
+
+// ReverseScan is Scan with entries returned in descending key order.
+//
+//export ReverseScan
+func ReverseScan(handle C.uintptr_t, prefix *C.char, prefixLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "reverse_scan", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	if start, end, ok := userPrefixRange(pref); ok {
+		err = iterateReverse(store, start, end, func(k, v []byte) error {
+			buffer = appendEntry(buffer, k, v)
+			return nil
+		})
+	}
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
 }
 
 func appendEntry(buf []byte, key, value []byte) []byte {
@@ -504,7 +1348,7 @@ func decodeOperations(data []byte) ([]operation, error) {
 		offset += int(keyLen)
 
 		switch op {
-		case 0:
+		case opSet, opSetTTL, opRequireEqual:
 			if offset+4 > len(data) {
 				return nil, errors.New("malformed operation value length")
 			}
@@ -515,16 +1359,103 @@ func decodeOperations(data []byte) ([]operation, error) {
 			}
 			value := append([]byte(nil), data[offset:offset+int(valLen)]...)
 			offset += int(valLen)
-			ops = append(ops, operation{op: op, key: key, value: value})
-		case 1:
+			if op != opSetTTL {
+				ops = append(ops, operation{op: op, key: key, value: value})
+				continue
+			}
+			if offset+8 > len(data) {
+				return nil, errors.New("malformed operation ttl")
+			}
+			ttl, err := ttlFromSeconds(binary.LittleEndian.Uint64(data[offset : offset+8]))
+			if err != nil {
+				return nil, err
+			}
+			offset += 8
+			if ttl <= 0 {
+				ops = append(ops, operation{op: opSet, key: key, value: value})
+				continue
+			}
+			ops = append(ops, operation{op: op, key: key, value: value, ttl: ttl})
+		case opDelete, opRequireExists, opRequireAbsent:
 			ops = append(ops, operation{op: op, key: key})
 		default:
 			return nil, errors.New("unknown operation code")
 		}
 	}
+	if err := userOps(ops); err != nil {
+		return nil, err
+	}
 	return ops, nil
 }
 
+// decodeKeys parses a buffer of u32 length-prefixed keys, the key framing
+// used by Apply.
+func decodeKeys(data []byte) ([][]byte, error) {
+	var keys [][]byte
+	offset := 0
+	for offset < len(data) {
+		if offset+4 > len(data) {
+			return nil, errors.New("malformed key length")
+		}
+		keyLen := binary.LittleEndian.Uint32(data[offset : offset+4])
+		offset += 4
+		if offset+int(keyLen) > len(data) {
+			return nil, errors.New("malformed key")
+		}
+		keys = append(keys, append([]byte(nil), data[offset:offset+int(keyLen)]...))
+		offset += int(keyLen)
+	}
+	return keys, nil
+}
+
+// lookup is the outcome of reading a single key in a batch.
+type lookup struct {
+	value []byte
+	found bool
+}
+
+// multiGetter is implemented by backends that can read many keys in one
+// consistent pass.
+type multiGetter interface {
+	GetMany(keys [][]byte) ([]lookup, error)
+}
+
+func getMany(store kvStore, keys [][]byte) ([]lookup, error) {
+	if mg, ok := store.(multiGetter); ok {
+		return mg.GetMany(keys)
+	}
+	results := make([]lookup, len(keys))
+	for i, key := range keys {
+		value, err := store.Get(key)
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results[i] = lookup{value: value, found: true}
+	}
+	return results, nil
+}
+
+// appendLookup frames a GetMany result as
+// u32 key length | u8 found | u32 value length | key | value.
+func appendLookup(buf []byte, key []byte, res lookup) []byte {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(key)))
+	buf = append(buf, tmp[:]...)
+	if res.found {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(res.value)))
+	buf = append(buf, tmp[:]...)
+	buf = append(buf, key...)
+	buf = append(buf, res.value...)
+	return buf
+}
+
 func prefixRange(prefix []byte) ([]byte, []byte) {
 	if len(prefix) == 0 {
 		return nil, nil
@@ -534,6 +1465,49 @@ func prefixRange(prefix []byte) ([]byte, []byte) {
 	return start, end
 }
 
+// userRange clips [start, end) to the keys below the reserved 0xff keyspace,
+// which public scans, counts and range deletes never reach. It reports false
+// when nothing is left.
+func userRange(start, end []byte) ([]byte, []byte, bool) {
+	if reservedKey(start) {
+		return nil, nil, false
+	}
+	if end == nil || bytes.Compare(end, reservedStart) > 0 {
+		end = reservedStart
+	}
+	return start, end, true
+}
+
+// userPrefixRange is prefixRange clipped by userRange.
+func userPrefixRange(prefix []byte) ([]byte, []byte, bool) {
+	start, end := prefixRange(prefix)
+	return userRange(start, end)
+}
+
+// errReservedKey rejects keys from the host in the reserved 0xff keyspace.
+var errReservedKey = errors.New("keys starting with 0xff are reserved for the library's own records")
+
+// userKey copies a key passed in by the host. Exports never read or write
+// the library's records on the host's behalf, so reserved keys fail with
+// errReservedKey.
+func userKey(key *C.char, keyLen C.int) ([]byte, error) {
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	if reservedKey(gotKey) {
+		return nil, errReservedKey
+	}
+	return gotKey, nil
+}
+
+// userOps is userKey for a batch of operations from the host.
+func userOps(ops []operation) error {
+	for _, op := range ops {
+		if reservedKey(op.key) {
+			return errReservedKey
+		}
+	}
+	return nil
+}
+
 func nextPrefix(prefix []byte) []byte {
 	end := append([]byte(nil), prefix...)
 	for i := len(end) - 1; i >= 0; i-- {
@@ -545,24 +1519,88 @@ func nextPrefix(prefix []byte) []byte {
 	return nil
 }
 
+// GetMany looks up every key in a buffer of u32 length-prefixed keys and
+// returns one framed record per key, in request order, with a found flag so
+// misses do not abort the batch.
+//
+//export GetMany
+func GetMany(handle C.uintptr_t, keys *C.char, keysLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "get_many", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	decoded, err := decodeKeys(C.GoBytes(unsafe.Pointer(keys), keysLen))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	for _, key := range decoded {
+		if reservedKey(key) {
+			setHandleError(uintptr(handle), errReservedKey)
+			return nil
+		}
+	}
+
+	results, err := getMany(store, decoded)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	for i, key := range decoded {
+		buffer = appendLookup(buffer, key, results[i])
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
+
 //export Apply
-func Apply(handle C.uintptr_t, ops *C.char, opsLen C.int) C.int {
+func Apply(handle C.uintptr_t, ops *C.char, opsLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "apply", time.Now())
 	store, err := getHandle(uintptr(handle))
 	if err != nil {
-		return setError(err)
+		return setHandleError(uintptr(handle), err)
 	}
 
 	data := C.GoBytes(unsafe.Pointer(ops), opsLen)
 	decoded, err := decodeOperations(data)
 	if err != nil {
-		return setError(err)
+		return setHandleError(uintptr(handle), err)
 	}
 
-	return setError(store.Apply(decoded))
+	if hasPreconditions(decoded) {
+		err = applyConditional(store, decoded)
+	} else {
+		err = store.Apply(decoded)
+	}
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), nil)
 }
 
 //export LastError
-func LastError() *C.char {
+func LastError() (ret *C.char) {
+	defer recoverExport(0, &ret, nil)
 	errorMu.Lock()
 	defer errorMu.Unlock()
 	if lastError == "" {
@@ -571,8 +1609,44 @@ func LastError() *C.char {
 	return C.CString(lastError)
 }
 
+// LastErrorForHandle returns the most recent error recorded against a store
+// handle (including its cursors and transactions), or nil if the last call
+// on it succeeded.
+//
+//export LastErrorForHandle
+func LastErrorForHandle(handle C.uintptr_t) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	errorMu.Lock()
+	defer errorMu.Unlock()
+	state, ok := handleErrors[uintptr(handle)]
+	if !ok {
+		return nil
+	}
+	return C.CString(state.message)
+}
+
+// ErrorCode returns the status code of the most recent call, for exports
+// that return a pointer or handle rather than a status.
+//
+//export ErrorCode
+func ErrorCode() (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	errorMu.Lock()
+	defer errorMu.Unlock()
+	return lastCode
+}
+
+//export ErrorCodeForHandle
+func ErrorCodeForHandle(handle C.uintptr_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	errorMu.Lock()
+	defer errorMu.Unlock()
+	return handleErrors[uintptr(handle)].code
+}
+
 //export FreeCString
 func FreeCString(str *C.char) {
+	defer recoverVoid(0)
 	if str != nil {
 		C.free(unsafe.Pointer(str))
 	}
@@ -580,9 +1654,8 @@ func FreeCString(str *C.char) {
 
 //export FreeBuffer
 func FreeBuffer(buf *C.char) {
+	defer recoverVoid(0)
 	if buf != nil {
-		C.free(unsafe.Pointer(buf))
+		arenaFree(unsafe.Pointer(buf))
 	}
 }
-
-func main() {}
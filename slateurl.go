@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	slatedb "slatedb.io/slatedb-go"
+)
+
+func openSlateURL(raw string) (kvStore, error) {
+	cfg, err := parseSlateURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	return openSlateConfig(cfg)
+}
+
+// parseSlateURL translates URL-style SlateDB locations into an open config:
+//
+//	slatedb+s3://bucket/prefix?region=us-east-1&endpoint=https://...
+//	slatedb+file:///var/lib/slate
+//
+// Query parameters map onto the same fields as the JSON form. Unknown
+// parameters are rejected so typos do not silently fall back to defaults.
+func parseSlateURL(raw string) (*slateOpenConfig, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := strings.TrimPrefix(strings.ToLower(u.Scheme), "slatedb+")
+	cfg := &slateOpenConfig{}
+	switch scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("slatedb+s3 URL %q is missing a bucket", raw)
+		}
+		cfg.Path = strings.TrimPrefix(u.Path, "/")
+		cfg.Store = &slatedb.StoreConfig{
+			Provider: slatedb.ProviderAWS,
+			AWS:      &slatedb.AWSConfig{Bucket: u.Host},
+		}
+	case "file":
+		cfg.Path = u.Host + u.Path
+		cfg.Store = &slatedb.StoreConfig{Provider: slatedb.ProviderLocal}
+	case "gs", "gcs", "az", "azure":
+		return nil, fmt.Errorf("slatedb provider %q is not available in the SlateDB Go bindings (supported: s3, file)", scheme)
+	default:
+		return nil, fmt.Errorf("unsupported slatedb URL scheme %q", u.Scheme)
+	}
+
+	for name, values := range u.Query() {
+		value := values[len(values)-1]
+		switch name {
+		case "region", "endpoint", "request_timeout":
+			if cfg.Store.AWS == nil {
+				return nil, fmt.Errorf("query parameter %q only applies to slatedb+s3 URLs", name)
+			}
+			switch name {
+			case "region":
+				cfg.Store.AWS.Region = value
+			case "endpoint":
+				cfg.Store.AWS.Endpoint = value
+			case "request_timeout":
+				timeout, err := time.ParseDuration(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid request_timeout: %w", err)
+				}
+				cfg.Store.AWS.RequestTimeout = timeout
+			}
+		case "async":
+			async, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid async flag: %w", err)
+			}
+			cfg.Async = async
+		case "ttl_sweep_interval":
+			cfg.SweepInterval = value
+		default:
+			return nil, fmt.Errorf("unknown slatedb URL parameter %q", name)
+		}
+	}
+	return cfg, nil
+}
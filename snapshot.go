@@ -0,0 +1,335 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// snapshotter is implemented by backends that can pin a consistent read view.
+type snapshotter interface {
+	Snapshot() (kvStore, error)
+}
+
+var errReadOnly = errors.New("snapshot is read-only")
+
+func openSnapshot(store kvStore) (kvStore, error) {
+	ss, ok := store.(snapshotter)
+	if !ok {
+		return nil, errors.New("snapshots are not supported by this backend")
+	}
+	return ss.Snapshot()
+}
+
+// badgerSnapshot serves reads from a read-only transaction held open for its
+// whole lifetime, so it never observes writes made after it was taken.
+type badgerSnapshot struct {
+	badgerReader
+	txn *badger.Txn
+}
+
+func (s *badgerStore) Snapshot() (kvStore, error) {
+	snap := &badgerSnapshot{txn: s.db.NewTransaction(false)}
+	snap.view = func(fn func(txn *badger.Txn) error) error { return fn(snap.txn) }
+	return snap, nil
+}
+
+func (s *badgerSnapshot) Close() error {
+	s.txn.Discard()
+	return nil
+}
+
+func (s *badgerSnapshot) Set(key, value []byte) error { return errReadOnly }
+
+func (s *badgerSnapshot) Delete(key []byte) error { return errReadOnly }
+
+func (s *badgerSnapshot) Apply(ops []operation) error { return errReadOnly }
+
+// Begin fails, so the read-modify-write exports report the snapshot as
+// read-only.
+func (s *badgerSnapshot) Begin() (kvTxn, error) { return nil, errReadOnly }
+
+func (s *badgerSnapshot) Sync() error { return nil }
+
+// slateSnapshot is a copy-on-write view of a SlateDB store, whose Go
+// bindings expose no snapshots of their own. Every write saves the raw value
+// it replaces, or its absence, into each open snapshot before it lands, so
+// keys written since the snapshot was taken read their saved value and the
+// rest read through to the live store. Memory use grows with the keys
+// written while the snapshot is open.
+type slateSnapshot struct {
+	store *slateStore
+	mu    sync.Mutex
+	saved map[string]savedValue
+}
+
+type savedValue struct {
+	raw   []byte
+	found bool
+}
+
+// Snapshot waits out in-flight writes, so none lands in the live store
+// without its old value saved.
+func (s *slateStore) Snapshot() (kvStore, error) {
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+	snap := &slateSnapshot{store: s, saved: make(map[string]savedValue)}
+	s.snapMu.Lock()
+	if s.snapshots == nil {
+		s.snapshots = make(map[*slateSnapshot]struct{})
+	}
+	s.snapshots[snap] = struct{}{}
+	s.snapMu.Unlock()
+	return snap, nil
+}
+
+// preserve saves key's current raw value into every open snapshot that has
+// not saved it yet. Writers call it, holding commitMu, before writing key.
+func (s *slateStore) preserve(key []byte) error {
+	s.snapMu.Lock()
+	snaps := make([]*slateSnapshot, 0, len(s.snapshots))
+	for snap := range s.snapshots {
+		snaps = append(snaps, snap)
+	}
+	s.snapMu.Unlock()
+	if len(snaps) == 0 {
+		return nil
+	}
+	raw, err := s.db.Get(key)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	value := savedValue{raw: raw, found: err == nil}
+	for _, snap := range snaps {
+		snap.mu.Lock()
+		if _, ok := snap.saved[string(key)]; !ok {
+			snap.saved[string(key)] = value
+		}
+		snap.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *slateSnapshot) lookup(key []byte) (savedValue, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.saved[string(key)]
+	return v, ok
+}
+
+// Get reads the live value before checking the saved ones: a write that
+// lands in between saved the value it replaced first.
+func (s *slateSnapshot) Get(key []byte) ([]byte, error) {
+	raw, err := s.store.db.Get(key)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	found := err == nil
+	if saved, ok := s.lookup(key); ok {
+		raw, found = saved.raw, saved.found
+	}
+	if !found {
+		return nil, badger.ErrKeyNotFound
+	}
+	value, live := unwrapExpiry(raw, time.Now())
+	if !live {
+		return nil, badger.ErrKeyNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// scan merges the live entries in [start, end) with the saved ones, in key
+// order. Saved keys present when the scan starts are merged in; any saved
+// later are picked up as the live scan reaches them.
+func (s *slateSnapshot) scan(start, end []byte, fn func(k, raw []byte) error) error {
+	iter, err := s.store.db.Scan(start, end)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	type entry struct {
+		key string
+		savedValue
+	}
+	var pending []entry
+	s.mu.Lock()
+	for k, v := range s.saved {
+		if (start == nil || k >= string(start)) && (end == nil || k < string(end)) {
+			pending = append(pending, entry{k, v})
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].key < pending[j].key })
+	emit := func(e entry) error {
+		if !e.found {
+			return nil
+		}
+		return fn([]byte(e.key), e.raw)
+	}
+
+	for {
+		kv, err := iter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for len(pending) > 0 && pending[0].key < string(kv.Key) {
+			if err := emit(pending[0]); err != nil {
+				return err
+			}
+			pending = pending[1:]
+		}
+		if len(pending) > 0 && pending[0].key == string(kv.Key) {
+			if err := emit(pending[0]); err != nil {
+				return err
+			}
+			pending = pending[1:]
+			continue
+		}
+		if saved, ok := s.lookup(kv.Key); ok {
+			if err := emit(entry{string(kv.Key), saved}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(kv.Key, kv.Value); err != nil {
+			return err
+		}
+	}
+	for _, e := range pending {
+		if err := emit(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *slateSnapshot) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	start, end := prefixRange(prefix)
+	return s.IterateRange(start, end, func(k, v []byte) error {
+		if len(prefix) > 0 && !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		return fn(k, v)
+	})
+}
+
+func (s *slateSnapshot) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	now := time.Now()
+	return s.scan(start, end, func(k, raw []byte) error {
+		value, live := unwrapExpiry(raw, now)
+		if !live {
+			return nil
+		}
+		return fn(append([]byte(nil), k...), append([]byte(nil), value...))
+	})
+}
+
+func (s *slateSnapshot) Close() error {
+	s.store.snapMu.Lock()
+	delete(s.store.snapshots, s)
+	s.store.snapMu.Unlock()
+	return nil
+}
+
+func (s *slateSnapshot) Set(key, value []byte) error { return errReadOnly }
+
+func (s *slateSnapshot) Delete(key []byte) error { return errReadOnly }
+
+func (s *slateSnapshot) Apply(ops []operation) error { return errReadOnly }
+
+func (s *slateSnapshot) Begin() (kvTxn, error) { return nil, errReadOnly }
+
+func (s *slateSnapshot) Sync() error { return nil }
+
+// Snapshots live in the store handle table so every read export works on
+// them; snapshotParents maps each snapshot handle to the store it was taken
+// from so closing the store releases its snapshots first.
+var (
+	snapshotMu      sync.Mutex
+	snapshotParents = make(map[uintptr]uintptr)
+)
+
+func isSnapshot(id uintptr) bool {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	_, ok := snapshotParents[id]
+	return ok
+}
+
+func forgetSnapshot(id uintptr) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	delete(snapshotParents, id)
+}
+
+// closeSnapshotsFor releases every snapshot still open on a store handle.
+func closeSnapshotsFor(parent uintptr) {
+	snapshotMu.Lock()
+	var open []uintptr
+	for id, p := range snapshotParents {
+		if p == parent {
+			open = append(open, id)
+		}
+	}
+	snapshotMu.Unlock()
+
+	for _, id := range open {
+		_ = closeHandle(id)
+	}
+}
+
+// OpenSnapshot returns a read-only store handle pinned to the current state of
+// handle. Reads through it never observe later writes; writes fail. Release
+// it with CloseSnapshot (closing the parent store also releases it).
+//
+//export OpenSnapshot
+func OpenSnapshot(handle C.uintptr_t) (ret C.uintptr_t) {
+	defer recoverExport(uintptr(handle), &ret, 0)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	snap, err := openSnapshot(store)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+
+	id := storeHandle(snap)
+	snapshotMu.Lock()
+	snapshotParents[id] = uintptr(handle)
+	snapshotMu.Unlock()
+	info, _ := lookupHandleInfo(uintptr(handle))
+	info.SnapshotOf = uintptr(handle)
+	describeHandle(id, info)
+	setHandleError(uintptr(handle), nil)
+	return C.uintptr_t(id)
+}
+
+//export CloseSnapshot
+func CloseSnapshot(snapshot C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	if !isSnapshot(uintptr(snapshot)) {
+		return setError(unknownHandleError("snapshot"))
+	}
+	if err := closeHandle(uintptr(snapshot)); err != nil {
+		return setHandleError(uintptr(snapshot), err)
+	}
+	return setError(nil)
+}
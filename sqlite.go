@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The kv table compares keys with memcmp, so SQL ordering matches the byte
+// ordering every other backend uses.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS kv (key BLOB PRIMARY KEY, value BLOB NOT NULL) WITHOUT ROWID`
+
+// sqliteStore keeps entries in a single SQLite file that ordinary SQLite
+// tooling can open. The database runs in WAL mode so scans do not block
+// writers.
+type sqliteStore struct {
+	db *sql.DB
+	// commitMu is held shared by every write and exclusively by emulated
+	// transaction commits.
+	commitMu sync.RWMutex
+}
+
+func init() { registerBackend("sqlite", openSqlite) }
+
+// openSqlite opens a "sqlite:" path. The part after the scheme (and an
+// optional "//") names the database file, defaulting to ./data/sqlite.db.
+func openSqlite(raw string) (kvStore, error) {
+	path := strings.TrimSpace(raw[len("sqlite:"):])
+	return openSqliteFile(strings.TrimPrefix(path, "//"))
+}
+
+func openSqliteFile(path string) (kvStore, error) {
+	if path == "" {
+		path = defaultDataDir("sqlite") + ".db"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_synchronous=FULL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// sqliteBlob keeps empty values from binding as NULL.
+func sqliteBlob(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+func (s *sqliteStore) Close() error { return s.db.Close() }
+
+func (s *sqliteStore) Set(key, value []byte) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)`, sqliteBlob(key), sqliteBlob(value))
+	return err
+}
+
+func (s *sqliteStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRow(`SELECT value FROM kv WHERE key = ?`, sqliteBlob(key)).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, badger.ErrKeyNotFound
+	}
+	return sqliteBlob(value), err
+}
+
+func (s *sqliteStore) Has(key []byte) (bool, error) {
+	var one int
+	err := s.db.QueryRow(`SELECT 1 FROM kv WHERE key = ?`, sqliteBlob(key)).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *sqliteStore) Delete(key []byte) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	_, err := s.db.Exec(`DELETE FROM kv WHERE key = ?`, sqliteBlob(key))
+	return err
+}
+
+// rangeClause renders the WHERE clause for [start, end); nil bounds are open.
+func rangeClause(start, end []byte) (string, []any) {
+	var conds []string
+	var args []any
+	if start != nil {
+		conds = append(conds, "key >= ?")
+		args = append(args, start)
+	}
+	if end != nil {
+		conds = append(conds, "key < ?")
+		args = append(args, end)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (s *sqliteStore) scan(start, end []byte, order string, fn func(k, v []byte) error) error {
+	where, args := rangeClause(start, end)
+	rows, err := s.db.Query(`SELECT key, value FROM kv`+where+` ORDER BY key `+order, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k, v []byte
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		if err := fn(k, sqliteBlob(v)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	start, end := prefixRange(prefix)
+	return s.scan(start, end, "ASC", fn)
+}
+
+func (s *sqliteStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.scan(start, end, "ASC", fn)
+}
+
+func (s *sqliteStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return s.scan(start, end, "DESC", fn)
+}
+
+func (s *sqliteStore) Count(start, end []byte) (int, error) {
+	where, args := rangeClause(start, end)
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM kv`+where, args...).Scan(&n)
+	return n, err
+}
+
+// Sync checkpoints the write-ahead log into the main database file, so the
+// .db file alone holds every committed write.
+func (s *sqliteStore) Sync() error {
+	_, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// Apply commits the batch as a single SQLite transaction.
+func (s *sqliteStore) Apply(ops []operation) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	return s.apply(ops)
+}
+
+// apply is Apply without commitMu, for commits that already hold it.
+func (s *sqliteStore) apply(ops []operation) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	put, err := tx.Prepare(`INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer put.Close()
+	del, err := tx.Prepare(`DELETE FROM kv WHERE key = ?`)
+	if err != nil {
+		return err
+	}
+	defer del.Close()
+
+	for _, op := range ops {
+		switch op.op {
+		case opSet:
+			_, err = put.Exec(sqliteBlob(op.key), sqliteBlob(op.value))
+		case opDelete:
+			_, err = del.Exec(sqliteBlob(op.key))
+		case opSetTTL:
+			err = errors.New("TTLs are not supported by the sqlite backend")
+		default:
+			err = errors.New("unknown operation code")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Begin() (kvTxn, error) {
+	return newEmulatedTxn(s, &s.commitMu, s.apply), nil
+}
@@ -1,16 +1,20 @@
 import atexit
+import base64
 import ctypes
 import importlib
+import itertools
 import dataclasses
+import enum
 import json
 import os
 import pickle
 import struct
 import tempfile
 import threading
+import urllib.parse
 from contextlib import contextmanager, nullcontext
 from pathlib import Path
-from typing import Any, Callable, ClassVar, Dict, Iterable, List, Optional, Sequence, Tuple, Union, cast
+from typing import Any, Callable, ClassVar, Dict, Iterable, Iterator, List, NoReturn, Optional, Sequence, Tuple, Union, cast
 
 try:  # POSIX-only import guarded for portability.
     import fcntl  # type: ignore[attr-defined]
@@ -28,6 +32,33 @@ _MISSING = object()
 _VALUE_RAW = 0x00
 _VALUE_STR = 0x01
 _VALUE_PICKLED = 0x02
+_OP_NAMES = {0: "set", 1: "delete", 2: "set"}
+_VERSION_STATES = {0: "set", 1: "deleted", 2: "expired"}
+_PRECONDITION_CODES = {"require_exists": 6, "require_absent": 7, "require_equal": 8}
+_LOG_LEVELS = {"debug": 0, "info": 1, "warn": 2, "error": 3}
+_LOG_CALLBACK = ctypes.CFUNCTYPE(None, ctypes.c_void_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_char_p)
+_WRITE_CALLBACK = ctypes.CFUNCTYPE(
+    None, ctypes.c_void_p, ctypes.POINTER(ctypes.c_char), ctypes.c_int, ctypes.c_int, ctypes.POINTER(ctypes.c_char), ctypes.c_int
+)
+_DONE_CALLBACK = ctypes.CFUNCTYPE(None, ctypes.c_void_p, ctypes.c_int, ctypes.c_char_p)
+_INDEX_CALLBACK = ctypes.CFUNCTYPE(
+    ctypes.c_void_p,
+    ctypes.c_void_p,
+    ctypes.POINTER(ctypes.c_char),
+    ctypes.c_int,
+    ctypes.POINTER(ctypes.c_char),
+    ctypes.c_int,
+    ctypes.POINTER(ctypes.c_int),
+)
+_UPDATE_CALLBACK = ctypes.CFUNCTYPE(
+    ctypes.c_int,
+    ctypes.c_void_p,
+    ctypes.POINTER(ctypes.c_char),
+    ctypes.c_int,
+    ctypes.c_int,
+    ctypes.POINTER(ctypes.c_void_p),
+    ctypes.POINTER(ctypes.c_int),
+)
 
 try:  # Optional dependency
     from pydantic import BaseModel as _PydanticBaseModel  # type: ignore
@@ -82,24 +113,70 @@ class _FileLock:
 __all__ = [
     "SkyShelve",
     "SkyshelveError",
+    "ErrorCode",
+    "Durability",
+    "Transaction",
+    "Snapshot",
+    "Bucket",
+    "Watch",
+    "BlobWriter",
+    "BlobReader",
+    "Future",
     "PersistentObject",
     "persistent_model",
     "BadgerDict",
     "BadgerError",
     "slatedb_uri",
     "slatedb_uri_from_env",
+    "slatedb_url",
 ]
 
 
+class ErrorCode(enum.IntEnum):
+    """Status codes returned by the shared library; SkyshelveError.code holds one of these."""
+
+    OK = 0
+    ERROR = -1
+    NOT_FOUND = -2
+    CONFLICT = -3
+    INVALID_HANDLE = -4
+    CLOSED = -5
+    CORRUPT = -6
+    PANIC = -7
+    QUOTA = -8
+    THROTTLED = -9
+    TOO_LARGE = -10
+    RESERVED_KEY = -11
+
+
+class Durability(enum.IntEnum):
+    """Per-write durability levels for SkyShelve.set_with_durability and friends."""
+
+    DEFAULT = 0
+    MEMTABLE = 1
+    PERSISTED = 2
+
+
 class SkyshelveError(Exception):
     """Raised when the underlying storage interaction fails."""
 
+    def __init__(self, message: str, code: int = ErrorCode.ERROR) -> None:
+        super().__init__(message)
+        try:
+            self.code: int = ErrorCode(code)
+        except ValueError:
+            self.code = code
+
 
 class SkyShelve:
     """Minimal dictionary-style wrapper backed by pluggable Go-backed stores."""
 
     _init_lock = threading.Lock()
     _lib: Optional[ctypes.CDLL] = None
+    _log_callback: Optional[Any] = None
+    # Sentinels an update() function returns to leave the key alone or delete it.
+    KEEP = object()
+    DELETE = object()
 
     def __init__(
         self,
@@ -109,10 +186,16 @@ class SkyShelve:
         lib_path: Optional[str] = None,
         auto_pickle: bool = True,
         default_factory: Optional[Callable[[], Any]] = None,
+        options: Optional[Dict[str, Any]] = None,
     ) -> None:
         self._ensure_library(lib_path)
-        self._handle = self._open(path, in_memory)
+        if options is None:
+            self._handle = self._open(path, in_memory)
+        else:
+            self._handle = self._open_with_options(path, in_memory, options)
         self._auto_pickle = auto_pickle
+        # ctypes callbacks must outlive their registration with the library.
+        self._callbacks: Dict[Any, Any] = {}
         # Match collections.defaultdict by exposing the factory as a public attribute.
         self.default_factory = default_factory
 
@@ -134,36 +217,707 @@ class SkyShelve:
         lib.Open.argtypes = [ctypes.c_char_p, ctypes.c_int]
         lib.Open.restype = ctypes.c_size_t
 
+        lib.OpenWithOptions.argtypes = [ctypes.c_char_p]
+        lib.OpenWithOptions.restype = ctypes.c_size_t
+
         lib.Close.argtypes = [ctypes.c_size_t]
         lib.Close.restype = ctypes.c_int
 
         lib.Set.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
         lib.Set.restype = ctypes.c_int
 
+        lib.SetWithTTL.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_int64,
+        ]
+        lib.SetWithTTL.restype = ctypes.c_int
+
         lib.Get.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
         lib.Get.restype = ctypes.c_void_p
 
+        lib.GetInto.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_void_p,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.GetInto.restype = ctypes.c_int
+
+        lib.Has.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.Has.restype = ctypes.c_int
+
+        lib.GetMany.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.GetMany.restype = ctypes.c_void_p
+
+        lib.CompareAndSwap.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+        ]
+        lib.CompareAndSwap.restype = ctypes.c_int
+
+        lib.IncrBy.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_int64, ctypes.POINTER(ctypes.c_int64)]
+        lib.IncrBy.restype = ctypes.c_int
+
+        lib.SetNX.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.SetNX.restype = ctypes.c_int
+
+        lib.GetSet.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.GetSet.restype = ctypes.c_void_p
+
+        lib.SetWithMeta.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_int,
+        ]
+        lib.SetWithMeta.restype = ctypes.c_int
+
+        lib.GetWithMeta.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.GetWithMeta.restype = ctypes.c_void_p
+
+        lib.GetDel.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.GetDel.restype = ctypes.c_void_p
+
+        lib.Append.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.Append.restype = ctypes.c_int64
+
+        lib.CopyKey.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.CopyKey.restype = ctypes.c_int
+
+        lib.RenameKey.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.RenameKey.restype = ctypes.c_int
+
         lib.Delete.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
         lib.Delete.restype = ctypes.c_int
 
+        lib.DeletePrefix.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.DeletePrefix.restype = ctypes.c_int64
+
+        lib.DeleteRange.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.DeleteRange.restype = ctypes.c_int64
+
+        lib.DropAll.argtypes = [ctypes.c_size_t]
+        lib.DropAll.restype = ctypes.c_int
+
+        lib.Count.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.Count.restype = ctypes.c_int64
+
+        lib.CountRange.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.CountRange.restype = ctypes.c_int64
+
         lib.Sync.argtypes = [ctypes.c_size_t]
         lib.Sync.restype = ctypes.c_int
 
+        lib.Execute.argtypes = [ctypes.c_size_t, ctypes.c_void_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.Execute.restype = ctypes.c_void_p
+
         lib.Scan.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
         lib.Scan.restype = ctypes.c_void_p
 
         lib.Apply.argtypes = [ctypes.c_size_t, ctypes.c_void_p, ctypes.c_int]
         lib.Apply.restype = ctypes.c_int
 
+        lib.SetWithDurability.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_int,
+        ]
+        lib.SetWithDurability.restype = ctypes.c_int64
+
+        lib.DeleteWithDurability.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_int]
+        lib.DeleteWithDurability.restype = ctypes.c_int64
+
+        lib.ApplyWithDurability.argtypes = [ctypes.c_size_t, ctypes.c_void_p, ctypes.c_int, ctypes.c_int]
+        lib.ApplyWithDurability.restype = ctypes.c_int64
+
+        lib.AwaitDurable.argtypes = [ctypes.c_size_t, ctypes.c_int64]
+        lib.AwaitDurable.restype = ctypes.c_int
+
+        lib.SetAsync.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            _DONE_CALLBACK,
+            ctypes.c_void_p,
+        ]
+        lib.SetAsync.restype = ctypes.c_int64
+
+        lib.DeleteAsync.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, _DONE_CALLBACK, ctypes.c_void_p]
+        lib.DeleteAsync.restype = ctypes.c_int64
+
+        lib.ApplyAsync.argtypes = [ctypes.c_size_t, ctypes.c_void_p, ctypes.c_int, _DONE_CALLBACK, ctypes.c_void_p]
+        lib.ApplyAsync.restype = ctypes.c_int64
+
+        lib.FutureWait.argtypes = [ctypes.c_int64, ctypes.c_int]
+        lib.FutureWait.restype = ctypes.c_int
+
+        lib.FutureClose.argtypes = [ctypes.c_int64]
+        lib.FutureClose.restype = ctypes.c_int
+
         lib.LastError.argtypes = []
         lib.LastError.restype = ctypes.c_void_p
 
+        lib.ErrorCode.argtypes = []
+        lib.ErrorCode.restype = ctypes.c_int
+
+        lib.LastErrorForHandle.argtypes = [ctypes.c_size_t]
+        lib.LastErrorForHandle.restype = ctypes.c_void_p
+
         lib.FreeCString.argtypes = [ctypes.c_void_p]
         lib.FreeCString.restype = None
 
         lib.FreeBuffer.argtypes = [ctypes.c_void_p]
         lib.FreeBuffer.restype = None
 
+        lib.RangeScan.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.RangeScan.restype = ctypes.c_void_p
+
+        lib.ReverseScan.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.ReverseScan.restype = ctypes.c_void_p
+
+        lib.ScanPage.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_int,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+            ctypes.POINTER(ctypes.c_void_p),
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.ScanPage.restype = ctypes.c_void_p
+
+        lib.ScanOpen.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.ScanOpen.restype = ctypes.c_size_t
+
+        lib.ScanOpenReverse.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.ScanOpenReverse.restype = ctypes.c_size_t
+
+        lib.ScanNext.argtypes = [ctypes.c_size_t, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.ScanNext.restype = ctypes.c_void_p
+
+        lib.ScanClose.argtypes = [ctypes.c_size_t]
+        lib.ScanClose.restype = ctypes.c_int
+
+        lib.OpenBucket.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.OpenBucket.restype = ctypes.c_size_t
+
+        lib.DeleteBucket.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.DeleteBucket.restype = ctypes.c_int
+
+        lib.ListBuckets.argtypes = [ctypes.c_size_t]
+        lib.ListBuckets.restype = ctypes.c_void_p
+
+        lib.SetBucketQuota.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int64, ctypes.c_int64]
+        lib.SetBucketQuota.restype = ctypes.c_int
+
+        lib.BucketStats.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.BucketStats.restype = ctypes.c_void_p
+
+        lib.OpenSnapshot.argtypes = [ctypes.c_size_t]
+        lib.OpenSnapshot.restype = ctypes.c_size_t
+
+        lib.CloseSnapshot.argtypes = [ctypes.c_size_t]
+        lib.CloseSnapshot.restype = ctypes.c_int
+
+        lib.Dump.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_char_p]
+        lib.Dump.restype = ctypes.c_int
+        lib.Load.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.Load.restype = ctypes.c_int
+        lib.ImportRDB.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.ImportRDB.restype = ctypes.c_int
+        lib.ImportLevelDB.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.ImportLevelDB.restype = ctypes.c_int
+        lib.ImportDBM.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.ImportDBM.restype = ctypes.c_int
+        lib.Backup.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.Backup.restype = ctypes.c_int
+
+        lib.BackupSince.argtypes = [ctypes.c_size_t, ctypes.c_uint64, ctypes.c_char_p, ctypes.POINTER(ctypes.c_uint64)]
+        lib.BackupSince.restype = ctypes.c_int
+
+        lib.RestoreWithOptions.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+        lib.RestoreWithOptions.restype = ctypes.c_int
+
+        lib.Restore.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+        lib.Restore.restype = ctypes.c_int
+
+        lib.RestoreInto.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.RestoreInto.restype = ctypes.c_int
+
+        lib.Migrate.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.POINTER(ctypes.c_int64)]
+        lib.Migrate.restype = ctypes.c_int
+
+        lib.MigrateProgress.argtypes = [ctypes.c_size_t, ctypes.POINTER(ctypes.c_int64), ctypes.POINTER(ctypes.c_int64)]
+        lib.MigrateProgress.restype = ctypes.c_int
+
+        lib.StartReplication.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.StartReplication.restype = ctypes.c_int
+
+        lib.ReplicationStatus.argtypes = [ctypes.c_size_t]
+        lib.ReplicationStatus.restype = ctypes.c_void_p
+
+        lib.StopReplication.argtypes = [ctypes.c_size_t]
+        lib.StopReplication.restype = ctypes.c_int
+
+        lib.CurrentVersion.argtypes = [ctypes.c_size_t]
+        lib.CurrentVersion.restype = ctypes.c_int64
+
+        lib.GetAt.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_int64,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.GetAt.restype = ctypes.c_void_p
+
+        lib.ScanAt.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_int64,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.ScanAt.restype = ctypes.c_void_p
+
+        lib.GetAllVersions.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.GetAllVersions.restype = ctypes.c_void_p
+
+        lib.CreateCheckpoint.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.CreateCheckpoint.restype = ctypes.c_int
+
+        lib.ListCheckpoints.argtypes = [ctypes.c_size_t]
+        lib.ListCheckpoints.restype = ctypes.c_void_p
+
+        lib.DeleteCheckpoint.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.DeleteCheckpoint.restype = ctypes.c_int
+
+        lib.OpenCheckpoint.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+        lib.OpenCheckpoint.restype = ctypes.c_size_t
+
+        lib.RestoreToCheckpoint.argtypes = [ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p, ctypes.c_char_p]
+        lib.RestoreToCheckpoint.restype = ctypes.c_size_t
+
+        lib.RestoreToTimestamp.argtypes = [ctypes.c_char_p, ctypes.c_int64, ctypes.c_char_p, ctypes.c_char_p]
+        lib.RestoreToTimestamp.restype = ctypes.c_size_t
+
+        lib.CreateIndex.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_char_p]
+        lib.CreateIndex.restype = ctypes.c_int
+
+        lib.CreateIndexCallback.argtypes = [ctypes.c_size_t, ctypes.c_char_p, _INDEX_CALLBACK, ctypes.c_void_p]
+        lib.CreateIndexCallback.restype = ctypes.c_int
+
+        lib.DropIndex.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.DropIndex.restype = ctypes.c_int
+
+        lib.ListIndexes.argtypes = [ctypes.c_size_t]
+        lib.ListIndexes.restype = ctypes.c_void_p
+
+        lib.QueryIndex.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.QueryIndex.restype = ctypes.c_void_p
+
+        lib.JSONGetPath.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.JSONGetPath.restype = ctypes.c_void_p
+
+        lib.JSONSetPath.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_char_p,
+            ctypes.c_int,
+        ]
+        lib.JSONSetPath.restype = ctypes.c_int
+
+        lib.JSONMergePatch.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.JSONMergePatch.restype = ctypes.c_int
+
+        lib.ScanFilter.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.ScanFilter.restype = ctypes.c_void_p
+
+        lib.Aggregate.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_char_p]
+        lib.Aggregate.restype = ctypes.c_void_p
+        lib.AggregateRange.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_char_p,
+        ]
+        lib.AggregateRange.restype = ctypes.c_void_p
+
+        lib.Update.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, _UPDATE_CALLBACK, ctypes.c_void_p]
+        lib.Update.restype = ctypes.c_int
+
+        lib.SetMergeOperator.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p]
+        lib.SetMergeOperator.restype = ctypes.c_int
+        lib.Merge.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.Merge.restype = ctypes.c_int
+
+        lib.ZAdd.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int, ctypes.c_double]
+        lib.ZAdd.restype = ctypes.c_int
+        lib.ZRem.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.ZRem.restype = ctypes.c_int
+        lib.ZRangeByScore.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_double,
+            ctypes.c_double,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.ZRangeByScore.restype = ctypes.c_void_p
+
+        lib.QueuePush.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_uint64),
+        ]
+        lib.QueuePush.restype = ctypes.c_int
+        lib.QueuePop.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int64,
+            ctypes.POINTER(ctypes.c_int),
+            ctypes.POINTER(ctypes.c_uint64),
+        ]
+        lib.QueuePop.restype = ctypes.c_void_p
+        lib.QueueAck.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_uint64]
+        lib.QueueAck.restype = ctypes.c_int
+
+        lib.HSet.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+        ]
+        lib.HSet.restype = ctypes.c_int
+        lib.HGet.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.HGet.restype = ctypes.c_void_p
+        lib.HDel.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.HDel.restype = ctypes.c_int
+        lib.HGetAll.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.HGetAll.restype = ctypes.c_void_p
+
+        lib.SAdd.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.SAdd.restype = ctypes.c_int
+        lib.SRem.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.SRem.restype = ctypes.c_int
+        lib.SIsMember.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.SIsMember.restype = ctypes.c_int
+        lib.SMembers.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.SMembers.restype = ctypes.c_void_p
+        lib.SCard.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.SCard.restype = ctypes.c_int64
+
+        lib.EnableTextIndex.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p]
+        lib.EnableTextIndex.restype = ctypes.c_int
+        lib.SearchText.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.SearchText.restype = ctypes.c_void_p
+
+        lib.VectorPut.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_float),
+            ctypes.c_int,
+        ]
+        lib.VectorPut.restype = ctypes.c_int
+        lib.VectorDelete.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.VectorDelete.restype = ctypes.c_int
+        lib.VectorSearch.argtypes = [
+            ctypes.c_size_t,
+            ctypes.POINTER(ctypes.c_float),
+            ctypes.c_int,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.VectorSearch.restype = ctypes.c_void_p
+
+        lib.TSAppend.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int64, ctypes.c_double]
+        lib.TSAppend.restype = ctypes.c_int
+        lib.TSRange.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int64,
+            ctypes.c_int64,
+            ctypes.c_int64,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.TSRange.restype = ctypes.c_void_p
+
+        lib.GeoPut.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_double, ctypes.c_double]
+        lib.GeoPut.restype = ctypes.c_int
+        lib.GeoDelete.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.GeoDelete.restype = ctypes.c_int
+        lib.GeoSearch.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_double,
+            ctypes.c_double,
+            ctypes.c_double,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.GeoSearch.restype = ctypes.c_void_p
+
+        lib.Diff.argtypes = [
+            ctypes.c_size_t,
+            ctypes.c_size_t,
+            ctypes.c_char_p,
+            ctypes.c_int,
+            ctypes.POINTER(ctypes.c_int),
+        ]
+        lib.Diff.restype = ctypes.c_void_p
+
+        lib.Clone.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.Clone.restype = ctypes.c_int
+
+        lib.SetActor.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.SetActor.restype = ctypes.c_int
+
+        lib.AuditScan.argtypes = [ctypes.c_size_t, ctypes.c_int64, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.AuditScan.restype = ctypes.c_void_p
+
+        lib.Erase.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.Erase.restype = ctypes.c_void_p
+
+        lib.Undelete.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.Undelete.restype = ctypes.c_int
+
+        lib.TrashScan.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.TrashScan.restype = ctypes.c_void_p
+
+        lib.SetRateLimit.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.SetRateLimit.restype = ctypes.c_int
+
+        lib.BlobCreate.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.BlobCreate.restype = ctypes.c_size_t
+
+        lib.BlobWrite.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.BlobWrite.restype = ctypes.c_int
+
+        lib.BlobCommit.argtypes = [ctypes.c_size_t]
+        lib.BlobCommit.restype = ctypes.c_int
+
+        lib.BlobAbort.argtypes = [ctypes.c_size_t]
+        lib.BlobAbort.restype = ctypes.c_int
+
+        lib.BlobPut.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int64]
+        lib.BlobPut.restype = ctypes.c_int
+
+        lib.BlobOpen.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int64)]
+        lib.BlobOpen.restype = ctypes.c_size_t
+
+        lib.BlobRead.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.BlobRead.restype = ctypes.c_int
+
+        lib.BlobClose.argtypes = [ctypes.c_size_t]
+        lib.BlobClose.restype = ctypes.c_int
+
+        lib.BlobGet.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.BlobGet.restype = ctypes.c_void_p
+
+        lib.BlobDelete.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.BlobDelete.restype = ctypes.c_int
+
+        lib.WatchOpen.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.WatchOpen.restype = ctypes.c_size_t
+
+        lib.WatchNext.argtypes = [ctypes.c_size_t, ctypes.c_int, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.WatchNext.restype = ctypes.c_void_p
+
+        lib.WatchClose.argtypes = [ctypes.c_size_t]
+        lib.WatchClose.restype = ctypes.c_int
+
+        lib.RegisterWriteCallback.argtypes = [ctypes.c_size_t, _WRITE_CALLBACK, ctypes.c_void_p]
+        lib.RegisterWriteCallback.restype = ctypes.c_int64
+
+        lib.UnregisterWriteCallback.argtypes = [ctypes.c_size_t, ctypes.c_int64]
+        lib.UnregisterWriteCallback.restype = ctypes.c_int
+
+        lib.NextSequence.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_uint64, ctypes.POINTER(ctypes.c_uint64)]
+        lib.NextSequence.restype = ctypes.c_int
+
+        lib.Compact.argtypes = [ctypes.c_size_t]
+        lib.Compact.restype = ctypes.c_int
+
+        lib.Verify.argtypes = [ctypes.c_size_t, ctypes.c_int]
+        lib.Verify.restype = ctypes.c_void_p
+
+        lib.Stats.argtypes = [ctypes.c_size_t]
+        lib.Stats.restype = ctypes.c_void_p
+
+        lib.StartMetricsServer.argtypes = [ctypes.c_char_p]
+        lib.StartMetricsServer.restype = ctypes.c_int
+
+        lib.StopMetricsServer.argtypes = []
+        lib.StopMetricsServer.restype = ctypes.c_int
+
+        lib.Ping.argtypes = [ctypes.c_size_t]
+        lib.Ping.restype = ctypes.c_int64
+
+        lib.SetSeq.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.SetSeq.restype = ctypes.c_int64
+
+        lib.DeleteSeq.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.DeleteSeq.restype = ctypes.c_int64
+
+        lib.ApplySeq.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.ApplySeq.restype = ctypes.c_int64
+
+        lib.LastSequence.argtypes = [ctypes.c_size_t]
+        lib.LastSequence.restype = ctypes.c_int64
+
+        lib.ChangesSince.argtypes = [ctypes.c_size_t, ctypes.c_int64, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.ChangesSince.restype = ctypes.c_void_p
+
+        lib.TrimChanges.argtypes = [ctypes.c_size_t, ctypes.c_int64]
+        lib.TrimChanges.restype = ctypes.c_int64
+
+        lib.ListHandles.argtypes = []
+        lib.ListHandles.restype = ctypes.c_void_p
+
+        lib.IsOpen.argtypes = [ctypes.c_size_t]
+        lib.IsOpen.restype = ctypes.c_int
+
+        lib.CloseAll.argtypes = []
+        lib.CloseAll.restype = ctypes.c_int
+
+        lib.FreeArena.argtypes = []
+        lib.FreeArena.restype = None
+
+        lib.SetLogCallback.argtypes = [_LOG_CALLBACK, ctypes.c_void_p, ctypes.c_int]
+        lib.SetLogCallback.restype = ctypes.c_int
+
+        lib.SetLogFile.argtypes = [ctypes.c_char_p, ctypes.c_int]
+        lib.SetLogFile.restype = ctypes.c_int
+
+        lib.ListBackends.argtypes = []
+        lib.ListBackends.restype = ctypes.c_void_p
+
+        lib.Version.argtypes = []
+        lib.Version.restype = ctypes.c_void_p
+
+        lib.Capabilities.argtypes = []
+        lib.Capabilities.restype = ctypes.c_void_p
+
+        lib.SetEncryptionKey.argtypes = [ctypes.c_size_t, ctypes.c_uint32, ctypes.c_char_p, ctypes.c_int]
+        lib.SetEncryptionKey.restype = ctypes.c_int
+
+        lib.RotateEncryptionKey.argtypes = [ctypes.c_size_t, ctypes.c_uint32, ctypes.c_char_p, ctypes.c_int]
+        lib.RotateEncryptionKey.restype = ctypes.c_int
+
+        lib.BeginTxn.argtypes = [ctypes.c_size_t]
+        lib.BeginTxn.restype = ctypes.c_size_t
+
+        lib.TxnSet.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p, ctypes.c_int]
+        lib.TxnSet.restype = ctypes.c_int
+
+        lib.TxnGet.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int, ctypes.POINTER(ctypes.c_int)]
+        lib.TxnGet.restype = ctypes.c_void_p
+
+        lib.TxnDelete.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_int]
+        lib.TxnDelete.restype = ctypes.c_int
+
+        lib.TxnCommit.argtypes = [ctypes.c_size_t]
+        lib.TxnCommit.restype = ctypes.c_int
+
+        lib.TxnRollback.argtypes = [ctypes.c_size_t]
+        lib.TxnRollback.restype = ctypes.c_int
+
+        lib.StartHTTPServer.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_char_p]
+        lib.StartHTTPServer.restype = ctypes.c_int
+        lib.StopHTTPServer.argtypes = [ctypes.c_size_t]
+        lib.StopHTTPServer.restype = ctypes.c_int
+        lib.StartRESPServer.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.StartRESPServer.restype = ctypes.c_int
+        lib.StopRESPServer.argtypes = [ctypes.c_size_t]
+        lib.StopRESPServer.restype = ctypes.c_int
+        lib.StartMemcacheServer.argtypes = [ctypes.c_size_t, ctypes.c_char_p]
+        lib.StartMemcacheServer.restype = ctypes.c_int
+        lib.StopMemcacheServer.argtypes = [ctypes.c_size_t]
+        lib.StopMemcacheServer.restype = ctypes.c_int
+        lib.StartGRPCServer.argtypes = [ctypes.c_size_t, ctypes.c_char_p, ctypes.c_char_p]
+        lib.StartGRPCServer.restype = ctypes.c_int
+
+        lib.StopGRPCServer.argtypes = [ctypes.c_size_t]
+        lib.StopGRPCServer.restype = ctypes.c_int
+
     @staticmethod
     def _default_library_path() -> str:
         base_dir = os.path.dirname(__file__)
@@ -185,12 +939,32 @@ class SkyShelve:
             cls._lib.FreeCString(err_ptr)
         return msg or None
 
+    def last_error(self) -> Optional[str]:
+        """Return the error from the most recent failed call on this store, or None after a success."""
+        err_ptr = self._call("LastErrorForHandle", ctypes.c_size_t(self._handle))
+        if not err_ptr:
+            return None
+        try:
+            return ctypes.string_at(err_ptr).decode("utf-8", "replace")
+        finally:
+            self._lib.FreeCString(err_ptr)
+
+    @classmethod
+    def _last_code(cls) -> int:
+        assert cls._lib is not None
+        return cls._lib.ErrorCode()
+
     @classmethod
     def _check_status(cls, status: int) -> None:
         if status == 0:
             return
         msg = cls._last_error() or "unknown skyshelve error"
-        raise SkyshelveError(msg)
+        raise SkyshelveError(msg, status)
+
+    @classmethod
+    def _raise_last(cls, fallback: str) -> NoReturn:
+        msg = cls._last_error() or fallback
+        raise SkyshelveError(msg, cls._last_code() or ErrorCode.ERROR)
 
     @classmethod
     def _open(cls, path: Optional[str], in_memory: bool) -> int:
@@ -203,8 +977,21 @@ class SkyShelve:
             encoded_path = path.encode("utf-8")
         handle = cls._lib.Open(encoded_path, int(bool(in_memory)))
         if handle == 0:
-            msg = cls._last_error() or "failed to open skyshelve store"
-            raise SkyshelveError(msg)
+            cls._raise_last("failed to open skyshelve store")
+        return int(handle)
+
+    @classmethod
+    def _open_with_options(cls, path: Optional[str], in_memory: bool, options: Dict[str, Any]) -> int:
+        """Open through OpenWithOptions; path and in_memory fill the matching fields when unset."""
+        assert cls._lib is not None
+        document = dict(options)
+        if path is not None:
+            document.setdefault("path", path)
+        if in_memory:
+            document.setdefault("in_memory", True)
+        handle = cls._lib.OpenWithOptions(json.dumps(document).encode("utf-8"))
+        if handle == 0:
+            cls._raise_last("failed to open skyshelve store")
         return int(handle)
 
     def __getitem__(self, key: Any) -> Any:
@@ -221,8 +1008,7 @@ class SkyShelve:
             raise KeyError(key)
 
     def __contains__(self, key: Any) -> bool:
-        result = self.get(key, default=_MISSING)
-        return result is not _MISSING
+        return self.has(key)
 
     def _missing(self, key: Any) -> Any:
         factory = getattr(self, "default_factory", None)
@@ -240,7 +1026,7 @@ class SkyShelve:
 
     def _call(self, func_name: str, *args) -> int:
         if self._handle == 0:
-            raise SkyshelveError("skyshelve store is closed")
+            raise SkyshelveError("skyshelve store is closed", ErrorCode.CLOSED)
         assert self._lib is not None
         func = getattr(self._lib, func_name)
         return func(*args)
@@ -281,17 +1067,21 @@ class SkyShelve:
             return pickle.loads(payload)
         return data
 
-    def set(self, key: Any, value: Any) -> None:
+    def set(self, key: Any, value: Any, *, ttl: Optional[int] = None) -> None:
+        """Store value under key; with ttl, the entry expires after that many seconds."""
         key_bytes = self._encode_key(key)
         value_bytes = self._encode_value(value)
-        status = self._call(
-            "Set",
+        args = [
             ctypes.c_size_t(self._handle),
             ctypes.c_char_p(key_bytes),
             ctypes.c_int(len(key_bytes)),
             ctypes.c_char_p(value_bytes),
             ctypes.c_int(len(value_bytes)),
-        )
+        ]
+        if ttl is None:
+            status = self._call("Set", *args)
+        else:
+            status = self._call("SetWithTTL", *args, ctypes.c_int64(int(ttl)))
         self._check_status(status)
 
     def get(self, key: Any, default: Any = None, *, raise_missing: bool = False) -> Any:
@@ -306,13 +1096,9 @@ class SkyShelve:
         )
 
         if not ptr and value_len.value == 0:
-            msg = self._last_error()
-            if msg:
-                if "not found" in msg.lower():
-                    if raise_missing:
-                        raise KeyError(key)
-                    return default
-                raise SkyshelveError(msg)
+            code = self._last_code()
+            if code not in (ErrorCode.OK, ErrorCode.NOT_FOUND):
+                self._raise_last("Get failed")
             if raise_missing:
                 raise KeyError(key)
             return default
@@ -323,139 +1109,2788 @@ class SkyShelve:
             self._lib.FreeBuffer(ptr)
         return self._decode_value(raw)
 
-    def delete(self, key: Any) -> bool:
+    def get_raw(self, key: Any, default: Any = None) -> Any:
+        """Return the stored bytes at key without decoding them, for values the library formats itself."""
         key_bytes = self._encode_key(key)
-        status = self._call(
-            "Delete",
+        value_len = ctypes.c_int()
+        ptr = self._call(
+            "Get",
             ctypes.c_size_t(self._handle),
             ctypes.c_char_p(key_bytes),
             ctypes.c_int(len(key_bytes)),
+            ctypes.byref(value_len),
         )
-        if status == 0:
-            return True
-        msg = self._last_error()
-        if msg and "not found" in msg.lower():
-            return False
-        self._check_status(status)
-        return True
-
-    def sync(self) -> None:
-        status = self._call("Sync", ctypes.c_size_t(self._handle))
-        self._check_status(status)
+        if not ptr and value_len.value == 0:
+            if self._last_code() not in (ErrorCode.OK, ErrorCode.NOT_FOUND):
+                self._raise_last("Get failed")
+            return default
+        try:
+            return ctypes.string_at(ptr, value_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
 
-    def scan(self, prefix: Any = None) -> List[Tuple[bytes, Any]]:
-        if prefix is None:
-            prefix_bytes = b""
-        else:
-            prefix_bytes = self._encode_key(prefix)
+    def get_many(self, keys: Iterable[Any], default: Any = None) -> List[Any]:
+        """Fetch several keys in one call; missing keys map to default, in request order."""
+        buffer = bytearray()
+        count = 0
+        for key in keys:
+            key_bytes = self._encode_key(key)
+            buffer += struct.pack("<I", len(key_bytes))
+            buffer += key_bytes
+            count += 1
+        if count == 0:
+            return []
 
         result_len = ctypes.c_int()
         ptr = self._call(
-            "Scan",
+            "GetMany",
             ctypes.c_size_t(self._handle),
-            ctypes.c_char_p(prefix_bytes),
-            ctypes.c_int(len(prefix_bytes)),
+            ctypes.c_char_p(bytes(buffer)),
+            ctypes.c_int(len(buffer)),
             ctypes.byref(result_len),
         )
-
-        entries: List[Tuple[bytes, Any]] = []
+        if not ptr:
+            self._raise_last("GetMany failed")
         try:
-            length = result_len.value
-            if not ptr or length == 0:
-                return entries
-
-            raw = ctypes.string_at(ptr, length)
-            offset = 0
-            while offset < length:
-                key_len, value_len = struct.unpack_from("<II", raw, offset)
-                offset += 8
-                key = raw[offset : offset + key_len]
-                offset += key_len
-                value_raw = raw[offset : offset + value_len]
-                offset += value_len
-                entries.append((bytes(key), self._decode_value(value_raw)))
-            return entries
+            raw = ctypes.string_at(ptr, result_len.value)
         finally:
-            if ptr:
-                self._lib.FreeBuffer(ptr)
+            self._lib.FreeBuffer(ptr)
 
-    def _apply(self, operations: Sequence[Tuple[str, bytes, Optional[Any]]]) -> None:
-        if not operations:
-            return
+        values: List[Any] = []
+        offset = 0
+        while offset < len(raw):
+            key_len, found, value_len = struct.unpack_from("<IBI", raw, offset)
+            offset += 9 + key_len
+            value_raw = raw[offset : offset + value_len]
+            offset += value_len
+            values.append(self._decode_value(value_raw) if found else default)
+        return values
+
+    def compare_and_swap(self, key: Any, expected: Any, new: Any) -> bool:
+        """Atomically replace key's value with new if it currently equals expected.
+
+        Values are compared by their encoded bytes. An expected of None requires the
+        key to be absent. Returns False when the comparison fails.
+        """
+        key_bytes = self._encode_key(key)
+        expected_bytes = None if expected is None else self._encode_value(expected)
+        new_bytes = self._encode_value(new)
+        status = self._call(
+            "CompareAndSwap",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(expected_bytes),
+            ctypes.c_int(len(expected_bytes or b"")),
+            ctypes.c_char_p(new_bytes),
+            ctypes.c_int(len(new_bytes)),
+        )
+        if status < 0:
+            self._check_status(status)
+        return status == 1
 
-        buffer = bytearray()
-        for op, key, value in operations:
-            if not isinstance(key, (bytes, bytearray, memoryview)):
-                raise TypeError("operation key must be bytes-like")
-            key_bytes = bytes(key)
-            if op == "set":
-                encoded = self._encode_value(value)
-                buffer.append(0)
-                buffer += struct.pack("<I", len(key_bytes))
-                buffer += key_bytes
-                buffer += struct.pack("<I", len(encoded))
-                buffer += encoded
-            elif op == "delete":
-                buffer.append(1)
-                buffer += struct.pack("<I", len(key_bytes))
-                buffer += key_bytes
-            else:
-                raise ValueError(f"unknown operation '{op}'")
+    def incr(self, key: Any, delta: int = 1) -> int:
+        """Atomically add delta to the counter at key (missing keys count as 0) and return it.
 
-        arr = (ctypes.c_char * len(buffer)).from_buffer_copy(buffer)
-        status = self._call("Apply", ctypes.c_size_t(self._handle), arr, ctypes.c_int(len(buffer)))
+        Counters are stored as ASCII digits, so get() returns them as bytes.
+        """
+        key_bytes = self._encode_key(key)
+        result = ctypes.c_int64()
+        status = self._call(
+            "IncrBy",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_int64(delta),
+            ctypes.byref(result),
+        )
         self._check_status(status)
+        return result.value
 
-    def close(self) -> None:
-        if self._handle == 0:
-            return
-        status = self._call("Close", ctypes.c_size_t(self._handle))
-        self._handle = 0
-        if status != 0:
-            self._check_status(status)
+    def update(self, key: Any, fn: Callable[[Any], Any], default: Any = None) -> bool:
+        """Atomically replace the value at key with fn(current), where current is default if key is missing.
 
-    def __del__(self) -> None:
-        try:
-            self.close()
-        except Exception:
-            pass
+        fn may return SkyShelve.KEEP to leave the key alone or SkyShelve.DELETE to remove it.
+        fn is called again with the newer value when another writer commits first, so it must not
+        have side effects. An exception from fn aborts the update and is re-raised. Returns whether
+        the key was written or deleted.
+        """
+        key_bytes = self._encode_key(key)
+        buffers: List[Any] = [None]
+        failure: List[BaseException] = []
+
+        def trampoline(_user_data, current, current_len, found, next_ptr, next_len):
+            try:
+                value = fn(self._decode_value(ctypes.string_at(current, current_len)) if found else default)
+                if value is SkyShelve.KEEP:
+                    return 1
+                if value is SkyShelve.DELETE:
+                    return 2
+                encoded = self._encode_value(value)
+            except BaseException as exc:  # re-raised once Update returns
+                failure.append(exc)
+                return 3
+            # next only has to stay valid until the callback runs again.
+            buffers[0] = ctypes.create_string_buffer(encoded, len(encoded))
+            next_ptr[0] = ctypes.addressof(buffers[0])
+            next_len[0] = len(encoded)
+            return 0
 
+        status = self._call(
+            "Update",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            _UPDATE_CALLBACK(trampoline),
+            None,
+        )
+        if failure:
+            raise failure[0]
+        if status < 0:
+            self._check_status(status)
+        return status == 1
 
-BadgerDict = SkyShelve
-BadgerError = SkyshelveError
+    def set_merge_operator(self, name: Optional[str], prefix: Any = None) -> None:
+        """Use the built-in merge operator name for keys under prefix (every key when omitted).
 
+        name is "append", "int-add", "set-union" or "json-merge", or None to remove the
+        operator for prefix. Keys use the operator with the longest matching prefix, and
+        registrations last until the store is closed.
+        """
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        status = self._call(
+            "SetMergeOperator",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            (name or "").encode("utf-8"),
+        )
+        self._check_status(status)
 
-def slatedb_uri(
-    path: str,
-    *,
-    cache_dir: Optional[str] = None,
-    store: Optional[Dict[str, Any]] = None,
-    options: Optional[Dict[str, Any]] = None,
-) -> str:
-    """Utility to format a SlateDB configuration string for :class:`SkyShelve`.
+    def merge(self, key: Any, operand: Any) -> None:
+        """Combine operand into the value at key with its merge operator, atomically with other merges.
 
-    Args:
-        path: Path used by SlateDB for on-disk storage or remote prefixes (e.g. S3).
-        cache_dir: Optional local cache directory for object-store backed deployments.
-        store: Optional store configuration dictionary mirroring
-            :class:`slatedb.StoreConfig`. Use ``{"provider": "aws", "aws": {...}}``
-            for AWS.
-        options: Optional dictionary mirroring ``slatedb.SlateDBOptions`` to fine-tune
-            flushing and caching behaviour.
+        Operands are sent in the library's formats: an int as decimal text for "int-add", a
+        set, frozenset, list or tuple of members for "set-union", a dict for "json-merge" and
+        bytes or str for "append". Read "int-add" and "set-union" results with get_raw();
+        appends keep the tag of a value stored with set().
+        """
+        key_bytes = self._encode_key(key)
+        if isinstance(operand, bool):
+            raise TypeError("merge operands must not be bool")
+        if isinstance(operand, int):
+            data = str(operand).encode("ascii")
+        elif isinstance(operand, dict):
+            data = json.dumps(operand).encode("utf-8")
+        elif isinstance(operand, (set, frozenset, list, tuple)):
+            members = [self._encode_key(member) for member in operand]
+            data = b"".join(struct.pack("<I", len(member)) + member for member in members)
+        elif isinstance(operand, str):
+            data = operand.encode("utf-8")
+        else:
+            data = bytes(operand)
+        status = self._call(
+            "Merge",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(data),
+            ctypes.c_int(len(data)),
+        )
+        self._check_status(status)
 
-    Returns:
-        A ``slatedb:`` URI string suitable for ``SkyShelve`` or
-        ``PersistentObject`` configuration.
-    """
+    def zadd(self, key: Any, member: Any, score: float) -> bool:
+        """Add member to the sorted set at key with score, or move it; returns whether it is new."""
+        key_bytes = self._encode_key(key)
+        member_bytes = self._encode_key(member)
+        status = self._call(
+            "ZAdd",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(member_bytes),
+            ctypes.c_int(len(member_bytes)),
+            ctypes.c_double(score),
+        )
+        if status < 0:
+            self._check_status(status)
+        return status == 1
 
-    payload: Dict[str, Any] = {"path": path}
-    if cache_dir:
-        payload["cache_dir"] = cache_dir
-    if store:
-        payload["store"] = store
-    if options:
-        payload["options"] = options
-    return f"slatedb:{json.dumps(payload)}"
+    def zrem(self, key: Any, member: Any) -> bool:
+        """Remove member from the sorted set at key; returns whether it was a member."""
+        key_bytes = self._encode_key(key)
+        member_bytes = self._encode_key(member)
+        status = self._call(
+            "ZRem",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(member_bytes),
+            ctypes.c_int(len(member_bytes)),
+        )
+        if status < 0:
+            self._check_status(status)
+        return status == 1
+
+    def zrange_by_score(
+        self, key: Any, min_score: float = float("-inf"), max_score: float = float("inf"), *, limit: int = 0
+    ) -> List[Tuple[bytes, float]]:
+        """Return (member, score) pairs scored in [min_score, max_score], lowest first, ties by member."""
+        key_bytes = self._encode_key(key)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "ZRangeByScore",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_double(min_score),
+            ctypes.c_double(max_score),
+            ctypes.c_int(limit),
+            ctypes.byref(result_len),
+        )
+        entries = self._entries_result(ptr, result_len.value, decode=False)
+        return [(member, struct.unpack("<d", score)[0]) for member, score in entries]
+
+    def queue_push(self, queue: str, value: Any) -> int:
+        """Append value to the durable queue named queue and return the item's id."""
+        value_bytes = self._encode_value(value)
+        item_id = ctypes.c_uint64()
+        status = self._call(
+            "QueuePush",
+            ctypes.c_size_t(self._handle),
+            queue.encode("utf-8"),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+            ctypes.byref(item_id),
+        )
+        self._check_status(status)
+        return item_id.value
+
+    def queue_pop(self, queue: str, visibility_timeout: float = 0) -> Optional[Tuple[int, Any]]:
+        """Take the oldest visible item from queue as (id, value), or None when it is empty.
+
+        With a positive visibility_timeout, in seconds, the item is hidden for that long and
+        then popped again unless queue_ack() removes it first; otherwise it is removed now.
+        """
+        value_len = ctypes.c_int()
+        item_id = ctypes.c_uint64()
+        ptr = self._call(
+            "QueuePop",
+            ctypes.c_size_t(self._handle),
+            queue.encode("utf-8"),
+            ctypes.c_int64(int(visibility_timeout * 1000)),
+            ctypes.byref(value_len),
+            ctypes.byref(item_id),
+        )
+        if not ptr:
+            if self._last_code() != ErrorCode.NOT_FOUND:
+                self._raise_last("QueuePop failed")
+            return None
+        try:
+            raw = ctypes.string_at(ptr, value_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+        return item_id.value, self._decode_value(raw)
+
+    def queue_ack(self, queue: str, item_id: int) -> bool:
+        """Remove a popped item for good; returns False when it was already gone."""
+        status = self._call("QueueAck", ctypes.c_size_t(self._handle), queue.encode("utf-8"), ctypes.c_uint64(item_id))
+        if status < 0:
+            self._check_status(status)
+        return status == 1
+
+    def hset(self, key: Any, field: Any, value: Any) -> None:
+        """Store value in field of the hash at key, without rewriting the other fields."""
+        key_bytes = self._encode_key(key)
+        field_bytes = self._encode_key(field)
+        value_bytes = self._encode_value(value)
+        status = self._call(
+            "HSet",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(field_bytes),
+            ctypes.c_int(len(field_bytes)),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+        )
+        self._check_status(status)
+
+    def hget(self, key: Any, field: Any, default: Any = None) -> Any:
+        """Return field of the hash at key, or default when it is missing."""
+        key_bytes = self._encode_key(key)
+        field_bytes = self._encode_key(field)
+        value_len = ctypes.c_int()
+        ptr = self._call(
+            "HGet",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(field_bytes),
+            ctypes.c_int(len(field_bytes)),
+            ctypes.byref(value_len),
+        )
+        return self._value_result(ptr, value_len.value, default)
+
+    def hdel(self, key: Any, field: Any) -> None:
+        """Remove field from the hash at key; removing a missing field is not an error."""
+        key_bytes = self._encode_key(key)
+        field_bytes = self._encode_key(field)
+        status = self._call(
+            "HDel",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(field_bytes),
+            ctypes.c_int(len(field_bytes)),
+        )
+        self._check_status(status)
+
+    def hgetall(self, key: Any) -> Dict[bytes, Any]:
+        """Return every field of the hash at key, in field order; a missing hash is empty."""
+        key_bytes = self._encode_key(key)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "HGetAll",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.byref(result_len),
+        )
+        return dict(self._entries_result(ptr, result_len.value))
+
+    def _member_call(self, func_name: str, key: Any, member: Any) -> bool:
+        key_bytes = self._encode_key(key)
+        member_bytes = self._encode_key(member)
+        status = self._call(
+            func_name,
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(member_bytes),
+            ctypes.c_int(len(member_bytes)),
+        )
+        if status < 0:
+            self._check_status(status)
+        return status == 1
+
+    def sadd(self, key: Any, member: Any) -> bool:
+        """Add member to the set at key; returns whether it was new."""
+        return self._member_call("SAdd", key, member)
+
+    def srem(self, key: Any, member: Any) -> bool:
+        """Remove member from the set at key; returns whether it was a member."""
+        return self._member_call("SRem", key, member)
+
+    def sismember(self, key: Any, member: Any) -> bool:
+        return self._member_call("SIsMember", key, member)
+
+    def smembers(self, key: Any) -> List[bytes]:
+        """Return the members of the set at key in byte order; a missing set is empty."""
+        key_bytes = self._encode_key(key)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "SMembers",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.byref(result_len),
+        )
+        return self._keys_result(ptr, result_len.value, "SMembers failed")
+
+    def scard(self, key: Any) -> int:
+        """Count the members of the set at key."""
+        key_bytes = self._encode_key(key)
+        return self._seq_call("SCard", ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes)))
+
+    def set_nx(self, key: Any, value: Any) -> bool:
+        """Store value only if key does not exist yet; returns whether it was written."""
+        key_bytes = self._encode_key(key)
+        value_bytes = self._encode_value(value)
+        status = self._call(
+            "SetNX",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+        )
+        if status < 0:
+            self._check_status(status)
+        return status == 1
+
+    def get_set(self, key: Any, value: Any, default: Any = None) -> Any:
+        """Atomically store value and return the previous value, or default if there was none."""
+        key_bytes = self._encode_key(key)
+        value_bytes = self._encode_value(value)
+        old_len = ctypes.c_int()
+        ptr = self._call(
+            "GetSet",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+            ctypes.byref(old_len),
+        )
+        return self._value_result(ptr, old_len.value, default)
+
+    def set_with_meta(self, key: Any, value: Any, meta: int) -> None:
+        """Store value with a user metadata byte (0-255) kept beside it; Badger stores only."""
+        key_bytes = self._encode_key(key)
+        value_bytes = self._encode_value(value)
+        status = self._call(
+            "SetWithMeta",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+            ctypes.c_int(meta),
+        )
+        self._check_status(status)
+
+    def get_with_meta(self, key: Any, default: Any = None) -> Tuple[Any, int]:
+        """Return (value, meta) for key, or (default, 0) if it is missing.
+
+        Values written without a metadata byte report 0.
+        """
+        key_bytes = self._encode_key(key)
+        value_len = ctypes.c_int()
+        meta = ctypes.c_int()
+        ptr = self._call(
+            "GetWithMeta",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.byref(value_len),
+            ctypes.byref(meta),
+        )
+        return self._value_result(ptr, value_len.value, default), meta.value
+
+    def get_del(self, key: Any, default: Any = None) -> Any:
+        """Atomically remove key and return its value, or default if it was missing.
+
+        Competing consumers never receive the same value twice.
+        """
+        key_bytes = self._encode_key(key)
+        value_len = ctypes.c_int()
+        ptr = self._call(
+            "GetDel",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.byref(value_len),
+        )
+        return self._value_result(ptr, value_len.value, default)
+
+    def append(self, key: Any, data: Union[bytes, str]) -> int:
+        """Atomically append data to the bytes or str value at key and return its new length in bytes.
+
+        Appending to a pickled value corrupts it.
+        """
+        if isinstance(data, str):
+            empty, payload = "", data.encode("utf-8")
+        else:
+            empty, payload = b"", bytes(data)
+        # Create a missing key as an empty value of data's type first, so get() decodes the result.
+        self.set_nx(key, empty)
+        key_bytes = self._encode_key(key)
+        length = self._call(
+            "Append",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(payload),
+            ctypes.c_int(len(payload)),
+        )
+        if length < 0:
+            self._check_status(length)
+        return length - 1
+
+    def copy_key(self, src: Any, dst: Any) -> None:
+        """Atomically copy src's value to dst, replacing dst; raises NOT_FOUND when src is missing."""
+        self._move_key("CopyKey", src, dst)
+
+    def rename_key(self, src: Any, dst: Any) -> None:
+        """Atomically move src's value to dst, replacing dst; raises NOT_FOUND when src is missing."""
+        self._move_key("RenameKey", src, dst)
+
+    def _move_key(self, func_name: str, src: Any, dst: Any) -> None:
+        src_bytes = self._encode_key(src)
+        dst_bytes = self._encode_key(dst)
+        status = self._call(
+            func_name,
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(src_bytes),
+            ctypes.c_int(len(src_bytes)),
+            ctypes.c_char_p(dst_bytes),
+            ctypes.c_int(len(dst_bytes)),
+        )
+        self._check_status(status)
+
+    def _value_result(self, ptr: Optional[int], length: int, default: Any) -> Any:
+        """Decode a FreeBuffer-owned value, mapping a NULL miss to default."""
+        if not ptr:
+            if self._last_code() not in (ErrorCode.OK, ErrorCode.NOT_FOUND):
+                self._raise_last("call failed")
+            return default
+        try:
+            raw = ctypes.string_at(ptr, length)
+        finally:
+            self._lib.FreeBuffer(ptr)
+        return self._decode_value(raw)
+
+    def get_into(self, key: Any, buffer: Union[bytearray, memoryview]) -> Optional[int]:
+        """Copy key's stored value into buffer, a writable bytes-like object, and return its length.
+
+        Returns None when key is missing. When the value is longer than buffer, nothing is copied
+        and the returned length is the size to retry with. The bytes are the value as stored,
+        starting with the one-byte type tag set() writes (0 bytes, 1 str, 2 pickle).
+        """
+        key_bytes = self._encode_key(key)
+        capacity = len(buffer)
+        target = (ctypes.c_char * capacity).from_buffer(buffer) if capacity else None
+        value_len = ctypes.c_int()
+        status = self._call(
+            "GetInto",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            target,
+            ctypes.c_int(capacity),
+            ctypes.byref(value_len),
+        )
+        if status == ErrorCode.NOT_FOUND:
+            return None
+        if status < 0:
+            self._check_status(status)
+        return value_len.value
+
+    def has(self, key: Any) -> bool:
+        """Report whether key exists without copying its value out of the store."""
+        key_bytes = self._encode_key(key)
+        status = self._call("Has", ctypes.c_size_t(self._handle), ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes)))
+        if status < 0:
+            self._check_status(status)
+        return status == 1
+
+    def delete(self, key: Any) -> bool:
+        key_bytes = self._encode_key(key)
+        status = self._call(
+            "Delete",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+        )
+        if status == 0:
+            return True
+        if status == ErrorCode.NOT_FOUND:
+            return False
+        self._check_status(status)
+        return True
+
+    def delete_prefix(self, prefix: Any) -> int:
+        """Delete every key starting with prefix and return how many were removed."""
+        prefix_bytes = self._encode_key(prefix)
+        count = self._call(
+            "DeletePrefix",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+        )
+        if count < 0:
+            self._check_status(count)
+        return count
+
+    def delete_range(self, start: Any = None, end: Any = None) -> int:
+        """Delete every key in [start, end) and return how many were removed; bounds may be omitted."""
+        start_bytes = b"" if start is None else self._encode_key(start)
+        end_bytes = b"" if end is None else self._encode_key(end)
+        count = self._call(
+            "DeleteRange",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(start_bytes),
+            ctypes.c_int(len(start_bytes)),
+            ctypes.c_char_p(end_bytes),
+            ctypes.c_int(len(end_bytes)),
+        )
+        if count < 0:
+            self._check_status(count)
+        return count
+
+    def drop_all(self) -> None:
+        """Delete every key without closing the store; named sequences restart from 0."""
+        self._check_status(self._call("DropAll", ctypes.c_size_t(self._handle)))
+
+    def erase(self, prefix: Any, *, signing_key: Optional[bytes] = None) -> Dict[str, Any]:
+        """Delete every key under prefix for good and return a report proving it.
+
+        Beyond delete_prefix, badger drops every retained version of the keys and other backends
+        compact. The report's verified is true when no key, old version or logged value under
+        prefix remains; with signing_key, signature is the hex HMAC-SHA256 of the report's compact
+        JSON without it. The report's prefix is returned as bytes.
+        """
+        prefix_bytes = self._encode_key(prefix)
+        key = signing_key or b""
+        report = self._json_result(
+            self._call(
+                "Erase",
+                ctypes.c_size_t(self._handle),
+                ctypes.c_char_p(prefix_bytes),
+                ctypes.c_int(len(prefix_bytes)),
+                ctypes.c_char_p(key),
+                ctypes.c_int(len(key)),
+            ),
+            "Erase failed",
+        )
+        report["prefix"] = base64.b64decode(report["prefix"])
+        return report
+
+    def undelete(self, key: Any) -> None:
+        """Restore a key deleted in soft-delete mode to its value at deletion, without its TTL.
+
+        The store must be opened with options={"soft_delete": {...}}. Raises SkyshelveError if
+        the key is not in the trash or has been written again since.
+        """
+        key_bytes = self._encode_key(key)
+        status = self._call(
+            "Undelete",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+        )
+        self._check_status(status)
+
+    def trash_scan(self, prefix: Any = None) -> List[Tuple[float, bytes, Any]]:
+        """Return the trashed entries under prefix as (deleted_at, key, value), in key order.
+
+        deleted_at is in seconds since the epoch.
+        """
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "TrashScan",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            ctypes.byref(result_len),
+        )
+        if not ptr:
+            if self._last_code() != ErrorCode.OK:
+                self._raise_last("TrashScan failed")
+            return []
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+
+        entries: List[Tuple[float, bytes, Any]] = []
+        offset = 0
+        while offset < len(raw):
+            at_ms, key_len, value_len = struct.unpack_from("<QII", raw, offset)
+            offset += 16
+            key = bytes(raw[offset : offset + key_len])
+            offset += key_len
+            value = self._decode_value(raw[offset : offset + value_len])
+            offset += value_len
+            entries.append((at_ms / 1000, key, value))
+        return entries
+
+    def count(self, prefix: Any = None) -> int:
+        """Count keys under prefix (every key when omitted) without reading their values."""
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        count = self._call(
+            "Count",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+        )
+        if count < 0:
+            self._check_status(count)
+        return count
+
+    def count_range(self, start: Any = None, end: Any = None) -> int:
+        """Count keys in [start, end); either bound may be omitted."""
+        start_bytes = b"" if start is None else self._encode_key(start)
+        end_bytes = b"" if end is None else self._encode_key(end)
+        count = self._call(
+            "CountRange",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(start_bytes),
+            ctypes.c_int(len(start_bytes)),
+            ctypes.c_char_p(end_bytes),
+            ctypes.c_int(len(end_bytes)),
+        )
+        if count < 0:
+            self._check_status(count)
+        return count
+
+    def sync(self) -> None:
+        status = self._call("Sync", ctypes.c_size_t(self._handle))
+        self._check_status(status)
+
+    def scan(self, prefix: Any = None) -> List[Tuple[bytes, Any]]:
+        if prefix is None:
+            prefix_bytes = b""
+        else:
+            prefix_bytes = self._encode_key(prefix)
+
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "Scan",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            ctypes.byref(result_len),
+        )
+
+        try:
+            if not ptr or result_len.value == 0:
+                return []
+            return self._decode_entries(ctypes.string_at(ptr, result_len.value))
+        finally:
+            if ptr:
+                self._lib.FreeBuffer(ptr)
+
+    def diff(self, other: "SkyShelve", prefix: Any = None) -> List[Tuple[str, bytes, Any, Any]]:
+        """Compare the keys under prefix with other's, which may use a different backend.
+
+        Returns (kind, key, old, new) tuples in key order: "+" for keys only in other, "-" for
+        keys only in this store and "~" for keys whose values differ. old is this store's value
+        and new is other's; the missing side of an added or removed key is None.
+        """
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "Diff",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_size_t(other._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            ctypes.byref(result_len),
+        )
+        if not ptr:
+            if self._last_code() != ErrorCode.OK:
+                self._raise_last("diff failed")
+            return []
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+        changes: List[Tuple[str, bytes, Any, Any]] = []
+        offset = 0
+        while offset < len(raw):
+            kind = chr(raw[offset])
+            key_len, old_len, new_len = struct.unpack_from("<III", raw, offset + 1)
+            offset += 13
+            key = bytes(raw[offset : offset + key_len])
+            offset += key_len
+            old_raw = raw[offset : offset + old_len]
+            offset += old_len
+            new_raw = raw[offset : offset + new_len]
+            offset += new_len
+            old = None if kind == "+" else self._decode_value(old_raw)
+            new = None if kind == "-" else self._decode_value(new_raw)
+            changes.append((kind, key, old, new))
+        return changes
+
+    def scan_filter(self, expression: str, prefix: Any = None) -> List[Tuple[bytes, Any]]:
+        """Scan prefix, returning only the entries matching expression, evaluated in the library.
+
+        expression joins clauses with "and": key glob "user:*", value contains "needle", or a
+        JSON path compared with a JSON literal, such as $.age >= 21 or $.name == "bob". Values
+        that are not JSON, or lack the member, fail JSON clauses.
+        """
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "ScanFilter",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            expression.encode("utf-8"),
+            ctypes.byref(result_len),
+        )
+        return self._entries_result(ptr, result_len.value)
+
+    def reverse_scan(self, prefix: Any = None) -> List[Tuple[bytes, Any]]:
+        """Like scan, but entries come back in descending key order."""
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "ReverseScan",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            ctypes.byref(result_len),
+        )
+        return self._entries_result(ptr, result_len.value)
+
+    def range_scan(self, start: Any = None, end: Any = None, *, limit: int = 0) -> List[Tuple[bytes, Any]]:
+        """Return entries with keys in [start, end); either bound may be omitted."""
+        start_bytes = b"" if start is None else self._encode_key(start)
+        end_bytes = b"" if end is None else self._encode_key(end)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "RangeScan",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(start_bytes),
+            ctypes.c_int(len(start_bytes)),
+            ctypes.c_char_p(end_bytes),
+            ctypes.c_int(len(end_bytes)),
+            ctypes.c_int(limit),
+            ctypes.byref(result_len),
+        )
+        return self._entries_result(ptr, result_len.value)
+
+    def aggregate(self, spec: str, prefix: Any = None, *, filter: Optional[str] = None) -> Dict[str, Any]:
+        """Fold the values under prefix into count, sum, min, max, avg and skipped.
+
+        spec says how to read each value: "i32", "u32", "i64", "u64", "f32" or "f64" for
+        little-endian numbers, "text" for decimal strings such as incr() counters, or a JSON
+        path such as "$.price". filter is a scan_filter() expression. Values spec cannot read
+        are counted in skipped; min, max and avg are None when nothing was read.
+        """
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        ptr = self._call(
+            "Aggregate",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            spec.encode("utf-8"),
+            None if filter is None else filter.encode("utf-8"),
+        )
+        return self._json_result(ptr, "Aggregate failed")
+
+    def aggregate_range(
+        self, spec: str, start: Any = None, end: Any = None, *, filter: Optional[str] = None
+    ) -> Dict[str, Any]:
+        """Like aggregate(), over the keys in [start, end); either bound may be omitted."""
+        start_bytes = b"" if start is None else self._encode_key(start)
+        end_bytes = b"" if end is None else self._encode_key(end)
+        ptr = self._call(
+            "AggregateRange",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(start_bytes),
+            ctypes.c_int(len(start_bytes)),
+            ctypes.c_char_p(end_bytes),
+            ctypes.c_int(len(end_bytes)),
+            spec.encode("utf-8"),
+            None if filter is None else filter.encode("utf-8"),
+        )
+        return self._json_result(ptr, "AggregateRange failed")
+
+    def scan_page(
+        self,
+        prefix: Any = None,
+        *,
+        after: Optional[bytes] = None,
+        limit: int = 0,
+        max_bytes: int = 0,
+    ) -> Tuple[List[Tuple[bytes, Any]], Optional[bytes]]:
+        """Return one bounded page of a prefix scan and the key to pass as after for the next page.
+
+        The resume key is None once the scan is exhausted.
+        """
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        after_bytes = b"" if after is None else bytes(after)
+        result_len = ctypes.c_int()
+        resume_ptr = ctypes.c_void_p()
+        resume_len = ctypes.c_int()
+        ptr = self._call(
+            "ScanPage",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            ctypes.c_char_p(after_bytes),
+            ctypes.c_int(len(after_bytes)),
+            ctypes.c_int(limit),
+            ctypes.c_int(max_bytes),
+            ctypes.byref(result_len),
+            ctypes.byref(resume_ptr),
+            ctypes.byref(resume_len),
+        )
+        resume: Optional[bytes] = None
+        if resume_ptr.value:
+            try:
+                resume = ctypes.string_at(resume_ptr.value, resume_len.value)
+            finally:
+                self._lib.FreeBuffer(resume_ptr.value)
+        return self._entries_result(ptr, result_len.value), resume
+
+    def iter_scan(self, prefix: Any = None, *, reverse: bool = False, batch_size: int = 256) -> Iterator[Tuple[bytes, Any]]:
+        """Stream entries under prefix through a library-side cursor, batch_size at a time."""
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        cursor = self._call(
+            "ScanOpenReverse" if reverse else "ScanOpen",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+        )
+        if cursor == 0:
+            self._raise_last("failed to open scan cursor")
+        try:
+            while True:
+                result_len = ctypes.c_int()
+                ptr = self._lib.ScanNext(ctypes.c_size_t(cursor), ctypes.c_int(batch_size), ctypes.byref(result_len))
+                if not ptr:
+                    if self._last_code() != ErrorCode.OK:
+                        self._raise_last("ScanNext failed")
+                    return
+                try:
+                    raw = ctypes.string_at(ptr, result_len.value)
+                finally:
+                    self._lib.FreeBuffer(ptr)
+                yield from self._decode_entries(raw)
+        finally:
+            self._lib.ScanClose(ctypes.c_size_t(cursor))
+
+    def _entries_result(self, ptr: Optional[int], length: int, *, decode: bool = True) -> List[Tuple[bytes, Any]]:
+        if not ptr:
+            if self._last_code() != ErrorCode.OK:
+                self._raise_last("scan failed")
+            return []
+        try:
+            raw = ctypes.string_at(ptr, length)
+        finally:
+            self._lib.FreeBuffer(ptr)
+        return self._decode_entries(raw, decode=decode)
+
+    def _keys_result(self, ptr: Optional[int], length: int, fallback: str) -> List[bytes]:
+        """Split a FreeBuffer-owned list of u32 length-prefixed keys; NULL is empty unless it failed."""
+        if not ptr:
+            if self._last_code() != ErrorCode.OK:
+                self._raise_last(fallback)
+            return []
+        try:
+            raw = ctypes.string_at(ptr, length)
+        finally:
+            self._lib.FreeBuffer(ptr)
+        keys: List[bytes] = []
+        offset = 0
+        while offset < len(raw):
+            (key_len,) = struct.unpack_from("<I", raw, offset)
+            offset += 4
+            keys.append(bytes(raw[offset : offset + key_len]))
+            offset += key_len
+        return keys
+
+    def _decode_entries(self, raw: bytes, *, decode: bool = True) -> List[Tuple[bytes, Any]]:
+        entries: List[Tuple[bytes, Any]] = []
+        offset = 0
+        while offset < len(raw):
+            key_len, value_len = struct.unpack_from("<II", raw, offset)
+            offset += 8
+            key = raw[offset : offset + key_len]
+            offset += key_len
+            value_raw = raw[offset : offset + value_len]
+            offset += value_len
+            entries.append((bytes(key), self._decode_value(value_raw) if decode else bytes(value_raw)))
+        return entries
+
+    def _apply(self, operations: Sequence[Tuple[str, bytes, Optional[Any]]]) -> None:
+        if not operations:
+            return
+
+        buffer = self._encode_operations(operations)
+        arr = (ctypes.c_char * len(buffer)).from_buffer_copy(buffer)
+        status = self._call("Apply", ctypes.c_size_t(self._handle), arr, ctypes.c_int(len(buffer)))
+        self._check_status(status)
+
+    def _encode_operations(self, operations: Sequence[Tuple[str, bytes, Optional[Any]]]) -> bytes:
+        buffer = bytearray()
+        for op, key, value in operations:
+            if not isinstance(key, (bytes, bytearray, memoryview)):
+                raise TypeError("operation key must be bytes-like")
+            key_bytes = bytes(key)
+            if op == "set":
+                encoded = self._encode_value(value)
+                buffer.append(0)
+                buffer += struct.pack("<I", len(key_bytes))
+                buffer += key_bytes
+                buffer += struct.pack("<I", len(encoded))
+                buffer += encoded
+            elif op == "delete":
+                buffer.append(1)
+                buffer += struct.pack("<I", len(key_bytes))
+                buffer += key_bytes
+            elif op in _PRECONDITION_CODES:
+                buffer.append(_PRECONDITION_CODES[op])
+                buffer += struct.pack("<I", len(key_bytes))
+                buffer += key_bytes
+                if op == "require_equal":
+                    encoded = self._encode_value(value)
+                    buffer += struct.pack("<I", len(encoded))
+                    buffer += encoded
+            else:
+                raise ValueError(f"unknown operation '{op}'")
+        return bytes(buffer)
+
+    def apply(self, operations: Sequence[Tuple[str, bytes, Optional[Any]]]) -> None:
+        """Commit ("set", key, value) and ("delete", key, None) operations atomically.
+
+        The batch may also hold preconditions, checked before anything is written:
+        ("require_exists", key, None), ("require_absent", key, None) and
+        ("require_equal", key, value). If one fails nothing is written and SkyshelveError is
+        raised with ErrorCode.CONFLICT, naming the failing operation's index.
+        """
+        self._apply(operations)
+
+    def execute(self, commands: Sequence[Tuple[Any, ...]]) -> List[Any]:
+        """Run a pipeline of commands in one library call and return one result per command.
+
+        Commands are ("get", key), ("has", key), ("set", key, value), ("set", key, value, ttl),
+        ("delete", key) and ("scan", start, end, limit), where None bounds are open and a limit of
+        0 means no limit. Results are the value (None when missing), a bool, None for writes, or
+        (entries, more) for scans. Commands run independently, so a failed one leaves a
+        SkyshelveError in its slot instead of raising.
+        """
+        buffer = bytearray()
+        kinds = []
+        for command in commands:
+            name, key = command[0], command[1]
+            key_bytes = b"" if name == "scan" and key is None else self._encode_key(key)
+            if name == "set" and len(command) == 4 and command[3]:
+                code = 2
+            else:
+                code = {"set": 0, "delete": 1, "get": 3, "has": 4, "scan": 5}.get(name)
+            if code is None:
+                raise ValueError(f"unknown command '{name}'")
+            buffer.append(code)
+            buffer += struct.pack("<I", len(key_bytes)) + key_bytes
+            if name == "set":
+                value = self._encode_value(command[2])
+                buffer += struct.pack("<I", len(value)) + value
+                if code == 2:
+                    buffer += struct.pack("<Q", int(command[3]))
+            elif name == "scan":
+                _, _, end, limit = command
+                end_bytes = b"" if end is None else self._encode_key(end)
+                buffer += struct.pack("<I", len(end_bytes)) + end_bytes + struct.pack("<I", limit)
+            kinds.append(name)
+        if not buffer:
+            return []
+
+        arr = (ctypes.c_char * len(buffer)).from_buffer_copy(buffer)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "Execute", ctypes.c_size_t(self._handle), arr, ctypes.c_int(len(buffer)), ctypes.byref(result_len)
+        )
+        if not ptr:
+            self._raise_last("Execute failed")
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+
+        results: List[Any] = []
+        offset = 0
+        for name in kinds:
+            (status,) = struct.unpack_from("<i", raw, offset)
+            offset += 4
+            if status != 0:
+                (msg_len,) = struct.unpack_from("<I", raw, offset)
+                offset += 4
+                message = raw[offset : offset + msg_len].decode("utf-8", "replace")
+                offset += msg_len
+                missing = status == ErrorCode.NOT_FOUND and name == "get"
+                results.append(None if missing else SkyshelveError(message, status))
+            elif name == "get":
+                (value_len,) = struct.unpack_from("<I", raw, offset)
+                offset += 4
+                results.append(self._decode_value(raw[offset : offset + value_len]))
+                offset += value_len
+            elif name == "has":
+                results.append(raw[offset] == 1)
+                offset += 1
+            elif name == "scan":
+                (count,) = struct.unpack_from("<I", raw, offset)
+                offset += 4
+                start = offset
+                for _ in range(count):
+                    key_len, value_len = struct.unpack_from("<II", raw, offset)
+                    offset += 8 + key_len + value_len
+                results.append((self._decode_entries(raw[start:offset]), raw[offset] == 1))
+                offset += 1
+            else:
+                results.append(None)
+        return results
+
+    def set_with_durability(self, key: Any, value: Any, durability: int) -> int:
+        """Set key, returning once the write reaches the given Durability level.
+
+        Returns a write sequence number for await_durable, or 0 on backends that do not
+        number their writes.
+        """
+        key_bytes = self._encode_key(key)
+        value_bytes = self._encode_value(value)
+        return self._write_durable(
+            "SetWithDurability",
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+            ctypes.c_int(durability),
+        )
+
+    def delete_with_durability(self, key: Any, durability: int) -> int:
+        """Delete key at the given Durability level; see set_with_durability."""
+        key_bytes = self._encode_key(key)
+        return self._write_durable(
+            "DeleteWithDurability", ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes)), ctypes.c_int(durability)
+        )
+
+    def apply_with_durability(self, operations: Sequence[Tuple[str, bytes, Optional[Any]]], durability: int) -> int:
+        """Commit a batch atomically at the given Durability level; see set_with_durability."""
+        buffer = self._encode_operations(operations)
+        arr = (ctypes.c_char * len(buffer)).from_buffer_copy(buffer)
+        return self._write_durable("ApplyWithDurability", arr, ctypes.c_int(len(buffer)), ctypes.c_int(durability))
+
+    def _write_durable(self, func_name: str, *args) -> int:
+        seq = self._call(func_name, ctypes.c_size_t(self._handle), *args)
+        if seq < 0:
+            self._check_status(seq)
+        return seq
+
+    def await_durable(self, seq: int) -> None:
+        """Block until write seq, and every earlier write on this store, is persisted."""
+        self._check_status(self._call("AwaitDurable", ctypes.c_size_t(self._handle), ctypes.c_int64(seq)))
+
+    def set_async(
+        self, key: Any, value: Any, *, callback: Optional[Callable[[Optional[SkyshelveError]], None]] = None
+    ) -> Optional["Future"]:
+        """Queue a set without waiting for it to commit.
+
+        Async writes through one store apply in submission order and all finish before close()
+        returns. Without a callback this returns a Future; with one it returns None and calls
+        callback(error) from a background thread once the write commits (error is None) or fails.
+        """
+        key_bytes = self._encode_key(key)
+        value_bytes = self._encode_value(value)
+        return self._submit_async(
+            "SetAsync",
+            callback,
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+        )
+
+    def delete_async(
+        self, key: Any, *, callback: Optional[Callable[[Optional[SkyshelveError]], None]] = None
+    ) -> Optional["Future"]:
+        """Queue a delete; see set_async."""
+        key_bytes = self._encode_key(key)
+        return self._submit_async("DeleteAsync", callback, ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes)))
+
+    def apply_async(
+        self,
+        operations: Sequence[Tuple[str, bytes, Optional[Any]]],
+        *,
+        callback: Optional[Callable[[Optional[SkyshelveError]], None]] = None,
+    ) -> Optional["Future"]:
+        """Queue a batch of ("set", key, value) / ("delete", key, None) operations, committed atomically."""
+        buffer = self._encode_operations(operations)
+        arr = (ctypes.c_char * len(buffer)).from_buffer_copy(buffer)
+        return self._submit_async("ApplyAsync", callback, arr, ctypes.c_int(len(buffer)))
+
+    def _submit_async(
+        self, func_name: str, callback: Optional[Callable[[Optional[SkyshelveError]], None]], *args
+    ) -> Optional["Future"]:
+        if callback is None:
+            future_id = self._call(func_name, ctypes.c_size_t(self._handle), *args, _DONE_CALLBACK(), None)
+            if future_id < 0:
+                self._check_status(future_id)
+            return Future(self._lib, future_id)
+
+        with _ASYNC_LOCK:
+            token = next(_ASYNC_TOKENS)
+            _ASYNC_CALLBACKS[token] = callback
+        status = self._call(func_name, ctypes.c_size_t(self._handle), *args, _async_done, ctypes.c_void_p(token))
+        if status < 0:
+            with _ASYNC_LOCK:
+                _ASYNC_CALLBACKS.pop(token, None)
+            self._check_status(status)
+        return None
+
+    def backup(self, dest_path: Union[str, Path]) -> None:
+        """Write a full backup of the store to dest_path."""
+        status = self._call("Backup", ctypes.c_size_t(self._handle), os.fspath(dest_path).encode("utf-8"))
+        self._check_status(status)
+
+    def restore_into(self, backup_path: Union[str, Path]) -> None:
+        """Load a backup into this open store; keys missing from the backup are kept."""
+        status = self._call("RestoreInto", ctypes.c_size_t(self._handle), os.fspath(backup_path).encode("utf-8"))
+        self._check_status(status)
+
+    def dump(self, path: Union[str, Path], format: str = "binary") -> None:
+        """Write every entry to path as a portable dump, "binary" or "ndjson", keeping TTLs.
+
+        Any backend, and later library versions, can read the dump back with load().
+        """
+        status = self._call(
+            "Dump", ctypes.c_size_t(self._handle), os.fspath(path).encode("utf-8"), format.encode("utf-8")
+        )
+        self._check_status(status)
+
+    def load(self, path: Union[str, Path]) -> None:
+        """Apply a dump written by dump(), in either format; keys not in the dump are kept."""
+        status = self._call("Load", ctypes.c_size_t(self._handle), os.fspath(path).encode("utf-8"))
+        self._check_status(status)
+
+    def import_rdb(self, path: Union[str, Path]) -> None:
+        """Load a Redis RDB snapshot, in batches, with the values as Redis stored them.
+
+        Strings become plain keys and keep their expiry; hashes, sets and sorted sets become
+        hset(), sadd() and zadd() structures, and lists become queues. Keys written before a
+        failure stay in the store.
+        """
+        status = self._call("ImportRDB", ctypes.c_size_t(self._handle), os.fspath(path).encode("utf-8"))
+        self._check_status(status)
+
+    def import_leveldb(self, directory: Union[str, Path]) -> None:
+        """Copy the live entries of a closed LevelDB or RocksDB directory into this store."""
+        status = self._call("ImportLevelDB", ctypes.c_size_t(self._handle), os.fspath(directory).encode("utf-8"))
+        self._check_status(status)
+
+    def import_dbm(self, path: Union[str, Path]) -> None:
+        """Copy the dbm database at path, the name given to dbm.open or shelve.open.
+
+        GDBM, dbm.dumb and dbm.sqlite3 files are read. A shelf's values come back as the
+        original objects; other dbm values come back as bytes.
+        """
+        status = self._call("ImportDBM", ctypes.c_size_t(self._handle), os.fspath(path).encode("utf-8"))
+        self._check_status(status)
+
+    def backup_since(self, since: int, dest_path: Union[str, Path]) -> int:
+        """Write the entries changed after version since (0 for everything) to dest_path.
+
+        Returns the version to pass as since for the next delta. Badger stores only.
+        """
+        next_version = ctypes.c_uint64()
+        status = self._call(
+            "BackupSince",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_uint64(since),
+            os.fspath(dest_path).encode("utf-8"),
+            ctypes.byref(next_version),
+        )
+        self._check_status(status)
+        # An empty delta reports 0; keep the chain where it was.
+        return next_version.value or since
+
+    @classmethod
+    def restore(
+        cls,
+        path: Optional[str],
+        backup_path: Union[str, Path],
+        *,
+        lib_path: Optional[str] = None,
+        options: Optional[Dict[str, Any]] = None,
+    ) -> None:
+        """Open the store at path, load the backup at backup_path into it and close it again.
+
+        Backups of stores opened with codecs (encryption, compression, checksums) need the
+        source's options.
+        """
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        encoded_backup = os.fspath(backup_path).encode("utf-8")
+        if options is None:
+            if not path:
+                raise ValueError("A filesystem path is required unless options are given")
+            status = cls._lib.Restore(path.encode("utf-8"), encoded_backup)
+        else:
+            document = dict(options)
+            if path is not None:
+                document.setdefault("path", path)
+            status = cls._lib.RestoreWithOptions(json.dumps(document).encode("utf-8"), encoded_backup)
+        cls._check_status(status)
+
+    def migrate(self, dst_uri: str) -> int:
+        """Copy every entry into the store at dst_uri, verify the copy and return the entry count.
+
+        TTLs are not carried over; avoid writing to this store while it runs.
+        """
+        copied = ctypes.c_int64()
+        status = self._call("Migrate", ctypes.c_size_t(self._handle), dst_uri.encode("utf-8"), ctypes.byref(copied))
+        self._check_status(status)
+        return copied.value
+
+    def clone(self, dst_uri: str) -> None:
+        """Copy this store, TTLs included, into a new empty store at dst_uri (any backend).
+
+        Entries come from a snapshot taken when the clone starts, so writes may continue while
+        it runs. Called on a Snapshot, the copy reflects that snapshot.
+        """
+        status = self._call("Clone", ctypes.c_size_t(self._handle), dst_uri.encode("utf-8"))
+        self._check_status(status)
+
+    def migrate_progress(self) -> Tuple[int, int]:
+        """Return (copied, verified) for the latest migrate() on this store; safe to poll from another thread."""
+        copied = ctypes.c_int64()
+        verified = ctypes.c_int64()
+        status = self._call(
+            "MigrateProgress",
+            ctypes.c_size_t(self._handle),
+            ctypes.byref(copied),
+            ctypes.byref(verified),
+        )
+        self._check_status(status)
+        return copied.value, verified.value
+
+    def start_replication(self, dst_uri: str) -> None:
+        """Copy this store into the store at dst_uri, then keep it in sync from the change log.
+
+        The store must have been opened with change_log. The copy and the stream run in the
+        background; replication_status reports their progress.
+        """
+        status = self._call("StartReplication", ctypes.c_size_t(self._handle), dst_uri.encode("utf-8"))
+        self._check_status(status)
+
+    def replication_status(self) -> Dict[str, Any]:
+        """Describe the running replication: state, copied, applied_seq, source_seq, lag and lag_ms."""
+        return self._json_result(
+            self._call("ReplicationStatus", ctypes.c_size_t(self._handle)), "ReplicationStatus failed"
+        )
+
+    def stop_replication(self) -> None:
+        """Apply outstanding changes one last time, then stop replicating and close the replica."""
+        self._check_status(self._call("StopReplication", ctypes.c_size_t(self._handle)))
+
+    def current_version(self) -> int:
+        """Return the store's latest committed version, for a later get_at or scan_at.
+
+        Versions increase with every commit but are not wall-clock times. Badger stores only.
+        """
+        version = self._call("CurrentVersion", ctypes.c_size_t(self._handle))
+        if version < 0:
+            self._check_status(version)
+        return version
+
+    def get_at(self, key: Any, version: int, default: Any = None) -> Any:
+        """Return the value key held at version, or default if it was missing then.
+
+        Badger keeps only num_versions_to_keep versions of each key once compaction has run,
+        so older reads may find the key missing.
+        """
+        key_bytes = self._encode_key(key)
+        value_len = ctypes.c_int()
+        ptr = self._call(
+            "GetAt",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_int64(version),
+            ctypes.byref(value_len),
+        )
+        return self._value_result(ptr, value_len.value, default)
+
+    def scan_at(self, prefix: Any, version: int) -> List[Tuple[bytes, Any]]:
+        """Return the entries under prefix as they were at version; see get_at."""
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "ScanAt",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            ctypes.c_int64(version),
+            ctypes.byref(result_len),
+        )
+        return self._entries_result(ptr, result_len.value)
+
+    def get_all_versions(self, key: Any) -> List[Tuple[int, Any, str]]:
+        """Return every version of key the backend still holds, newest first.
+
+        Each version is (version, value, state), where state is "set", "deleted" or "expired"
+        and only "set" versions carry a value.
+        """
+        key_bytes = self._encode_key(key)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "GetAllVersions",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.byref(result_len),
+        )
+        if not ptr:
+            if self._last_code() != ErrorCode.OK:
+                self._raise_last("GetAllVersions failed")
+            return []
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+
+        versions: List[Tuple[int, Any, str]] = []
+        offset = 0
+        while offset < len(raw):
+            version, flags, value_len = struct.unpack_from("<QBI", raw, offset)
+            offset += 13
+            value_raw = raw[offset : offset + value_len]
+            offset += value_len
+            state = _VERSION_STATES.get(flags, str(flags))
+            versions.append((version, self._decode_value(value_raw) if state == "set" else None, state))
+        return versions
+
+    def create_checkpoint(self, name: str) -> None:
+        """Write a full, named copy of the store to the checkpoint_dir it was opened with."""
+        self._check_status(self._call("CreateCheckpoint", ctypes.c_size_t(self._handle), name.encode("utf-8")))
+
+    def list_checkpoints(self) -> List[Dict[str, Any]]:
+        """List the store's checkpoints (name, backend, created_at, size_bytes), oldest first."""
+        return self._json_result(
+            self._call("ListCheckpoints", ctypes.c_size_t(self._handle)), "ListCheckpoints failed"
+        )
+
+    def delete_checkpoint(self, name: str) -> None:
+        """Remove the checkpoint called name."""
+        self._check_status(self._call("DeleteCheckpoint", ctypes.c_size_t(self._handle), name.encode("utf-8")))
+
+    @classmethod
+    def open_checkpoint(
+        cls,
+        directory: Union[str, Path],
+        name: str,
+        *,
+        options: Optional[Dict[str, Any]] = None,
+        lib_path: Optional[str] = None,
+        auto_pickle: bool = True,
+    ) -> "SkyShelve":
+        """Open a read-only copy of the checkpoint called name in directory; no store needs to be open.
+
+        A checkpoint of an encrypted store needs the store's options, for their encryption section.
+        Closing the returned store deletes the copy.
+        """
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        handle = cls._lib.OpenCheckpoint(
+            os.fspath(directory).encode("utf-8"), name.encode("utf-8"), cls._options_document(options)
+        )
+        if handle == 0:
+            cls._raise_last("failed to open checkpoint")
+        return cls._from_handle(int(handle), auto_pickle)
+
+    @classmethod
+    def restore_to_checkpoint(
+        cls,
+        directory: Union[str, Path],
+        name: str,
+        dst_uri: str,
+        *,
+        options: Optional[Dict[str, Any]] = None,
+        lib_path: Optional[str] = None,
+        auto_pickle: bool = True,
+    ) -> "SkyShelve":
+        """Materialize the checkpoint called name into a new, empty store at dst_uri and return it.
+
+        The copy keeps the checkpoint's encoded values, so reopen it with the source's codec
+        options; options is as for open_checkpoint.
+        """
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        handle = cls._lib.RestoreToCheckpoint(
+            os.fspath(directory).encode("utf-8"),
+            name.encode("utf-8"),
+            dst_uri.encode("utf-8"),
+            cls._options_document(options),
+        )
+        if handle == 0:
+            cls._raise_last("failed to restore checkpoint")
+        return cls._from_handle(int(handle), auto_pickle)
+
+    @classmethod
+    def restore_to_timestamp(
+        cls,
+        directory: Union[str, Path],
+        timestamp: float,
+        dst_uri: str,
+        *,
+        options: Optional[Dict[str, Any]] = None,
+        lib_path: Optional[str] = None,
+        auto_pickle: bool = True,
+    ) -> "SkyShelve":
+        """Restore the newest checkpoint taken at or before timestamp, in seconds since the epoch.
+
+        See restore_to_checkpoint.
+        """
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        handle = cls._lib.RestoreToTimestamp(
+            os.fspath(directory).encode("utf-8"),
+            ctypes.c_int64(int(timestamp * 1000)),
+            dst_uri.encode("utf-8"),
+            cls._options_document(options),
+        )
+        if handle == 0:
+            cls._raise_last("failed to restore checkpoint")
+        return cls._from_handle(int(handle), auto_pickle)
+
+    @staticmethod
+    def _options_document(options: Optional[Dict[str, Any]]) -> Optional[bytes]:
+        return None if options is None else json.dumps(options).encode("utf-8")
+
+    @classmethod
+    def _from_handle(cls, handle: int, auto_pickle: bool) -> "SkyShelve":
+        """Wrap a store handle returned by a library call other than an open."""
+        store = cls.__new__(cls)
+        store._handle = handle
+        store._auto_pickle = auto_pickle
+        store._callbacks = {}
+        store.default_factory = None
+        return store
+
+    def snapshot(self) -> "Snapshot":
+        """Pin a read-only view of the store's current state; close it to release the view."""
+        handle = self._call("OpenSnapshot", ctypes.c_size_t(self._handle))
+        if handle == 0:
+            self._raise_last("failed to open snapshot")
+        return Snapshot(self, int(handle))
+
+    def bucket(self, name: str) -> "Bucket":
+        """Open the named bucket: a separate keyspace on this store, created on first use.
+
+        The bucket supports every store method and only sees its own keys. Closing it leaves
+        this store open; closing this store closes its buckets.
+        """
+        handle = self._call("OpenBucket", ctypes.c_size_t(self._handle), name.encode("utf-8"))
+        if handle == 0:
+            self._raise_last("failed to open bucket")
+        return Bucket(self, int(handle))
+
+    def delete_bucket(self, name: str) -> None:
+        """Remove the named bucket and every key in it; open Bucket objects see it empty."""
+        self._check_status(self._call("DeleteBucket", ctypes.c_size_t(self._handle), name.encode("utf-8")))
+
+    def list_buckets(self) -> List[str]:
+        return self._json_result(self._call("ListBuckets", ctypes.c_size_t(self._handle)), "ListBuckets failed")
+
+    def set_bucket_quota(self, name: str, *, max_keys: int = 0, max_bytes: int = 0) -> None:
+        """Limit the named bucket to max_keys keys and max_bytes bytes of keys plus values (0 for no limit).
+
+        Writes through the bucket that would exceed a limit raise SkyshelveError with
+        ErrorCode.QUOTA; writes that shrink the bucket always succeed.
+        """
+        status = self._call(
+            "SetBucketQuota",
+            ctypes.c_size_t(self._handle),
+            name.encode("utf-8"),
+            ctypes.c_int64(max_keys),
+            ctypes.c_int64(max_bytes),
+        )
+        self._check_status(status)
+
+    def bucket_stats(self, name: str) -> Dict[str, Any]:
+        """Count the named bucket: {"name", "keys", "bytes", "max_keys", "max_bytes"}."""
+        return self._json_result(
+            self._call("BucketStats", ctypes.c_size_t(self._handle), name.encode("utf-8")), "BucketStats failed"
+        )
+
+    def set_seq(self, key: Any, value: Any) -> int:
+        """Set key on a store opened with change_log, returning the write's sequence number."""
+        key_bytes = self._encode_key(key)
+        value_bytes = self._encode_value(value)
+        return self._seq_call(
+            "SetSeq",
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+        )
+
+    def delete_seq(self, key: Any) -> int:
+        """Delete key, returning the write's sequence number; see set_seq."""
+        key_bytes = self._encode_key(key)
+        return self._seq_call("DeleteSeq", ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes)))
+
+    def apply_seq(self, operations: Sequence[Tuple[str, bytes, Optional[Any]]]) -> int:
+        """Commit a batch atomically and return the sequence number of its last write.
+
+        Every write in the batch is logged with its own sequence number. Preconditions are not
+        supported here.
+        """
+        buffer = self._encode_operations(operations)
+        arr = (ctypes.c_char * len(buffer)).from_buffer_copy(buffer)
+        return self._seq_call("ApplySeq", arr, ctypes.c_int(len(buffer)))
+
+    def _seq_call(self, func_name: str, *args) -> int:
+        seq = self._call(func_name, ctypes.c_size_t(self._handle), *args)
+        if seq < 0:
+            self._check_status(seq)
+        return seq
+
+    def last_sequence(self) -> int:
+        """Return the sequence number of the newest logged write, or 0 if there is none."""
+        return self._seq_call("LastSequence")
+
+    def changes_since(self, seq: int, max_changes: int = 256) -> List[Tuple[int, float, str, bytes, Any, Optional[int]]]:
+        """Return up to max_changes logged writes newer than seq, oldest first.
+
+        Each change is (seq, timestamp, op, key, value, ttl), where timestamp is the commit time
+        in seconds since the epoch, op is "set" or "delete", value is None for deletes and ttl is
+        the time-to-live in seconds for TTL writes. If changes after seq have been trimmed, or a
+        drop_all came after it, SkyshelveError is raised and the reader must resync.
+        """
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "ChangesSince",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_int64(seq),
+            ctypes.c_int(max_changes),
+            ctypes.byref(result_len),
+        )
+        if not ptr:
+            if self._last_code() != ErrorCode.OK:
+                self._raise_last("ChangesSince failed")
+            return []
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+
+        changes: List[Tuple[int, float, str, bytes, Any, Optional[int]]] = []
+        offset = 0
+        while offset < len(raw):
+            change_seq, at_ms, op, key_len, value_len = struct.unpack_from("<QQBII", raw, offset)
+            offset += 25
+            key = raw[offset : offset + key_len]
+            offset += key_len
+            value_raw = raw[offset : offset + value_len]
+            offset += value_len
+            ttl = None
+            if op == 2:
+                (ttl,) = struct.unpack_from("<Q", raw, offset)
+                offset += 8
+            name = _OP_NAMES.get(op, str(op))
+            value = self._decode_value(value_raw) if name == "set" else None
+            changes.append((change_seq, at_ms / 1000, name, bytes(key), value, ttl))
+        return changes
+
+    def trim_changes(self, seq: int) -> int:
+        """Drop logged changes up to and including seq and return how many were dropped.
+
+        The newest change is always kept, so sequence numbering survives a reopen.
+        """
+        return self._seq_call("TrimChanges", ctypes.c_int64(seq))
+
+    def set_actor(self, actor: Optional[str]) -> None:
+        """Tag the audit records of later writes through this handle with actor; None clears it.
+
+        The store must be opened with options={"audit": True}.
+        """
+        status = self._call(
+            "SetActor",
+            ctypes.c_size_t(self._handle),
+            None if actor is None else actor.encode("utf-8"),
+        )
+        self._check_status(status)
+
+    def audit_scan(
+        self, seq: int = 0, max_records: int = 256
+    ) -> List[Tuple[int, float, str, bytes, int, bytes, Optional[str]]]:
+        """Return up to max_records audit records newer than seq, oldest first.
+
+        Each record is (seq, timestamp, op, key, size, digest, actor): op is "set", "delete" or
+        "drop_all", size is the written value's length and digest the SHA-256 of the write.
+        The hash chain is checked as the records are read; SkyshelveError is raised if a record
+        was altered or removed.
+        """
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "AuditScan",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_int64(seq),
+            ctypes.c_int(max_records),
+            ctypes.byref(result_len),
+        )
+        if not ptr:
+            if self._last_code() != ErrorCode.OK:
+                self._raise_last("AuditScan failed")
+            return []
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+
+        records: List[Tuple[int, float, str, bytes, int, bytes, Optional[str]]] = []
+        offset = 0
+        while offset < len(raw):
+            record_seq, at_ms, op, key_len = struct.unpack_from("<QQBI", raw, offset)
+            offset += 21
+            key = bytes(raw[offset : offset + key_len])
+            offset += key_len
+            (size,) = struct.unpack_from("<I", raw, offset)
+            digest = bytes(raw[offset + 4 : offset + 36])
+            (actor_len,) = struct.unpack_from("<I", raw, offset + 36)
+            offset += 40
+            actor = raw[offset : offset + actor_len].decode("utf-8")
+            offset += actor_len + 32
+            name = "drop_all" if op == 0xFF else _OP_NAMES.get(op, str(op))
+            records.append((record_seq, at_ms / 1000, name, key, size, digest, actor or None))
+        return records
+
+    def json_get(self, key: Any, path: str = "$", default: Any = None) -> Any:
+        """Return the member at path (e.g. "$.user.email" or "items[2]") of the JSON document at key.
+
+        Only the member crosses into Python. Returns default if the key or the member is missing.
+        """
+        key_bytes = self._encode_key(key)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "JSONGetPath",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            path.encode("utf-8"),
+            ctypes.byref(result_len),
+        )
+        if not ptr:
+            if self._last_code() != ErrorCode.NOT_FOUND:
+                self._raise_last("JSONGetPath failed")
+            return default
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+        return json.loads(raw)
+
+    def json_set(self, key: Any, path: str, value: Any) -> None:
+        """Atomically replace the member at path of the JSON document at key with value.
+
+        Missing objects along the path are created; a path of "$" replaces the whole document.
+        A missing key starts from an empty document.
+        """
+        key_bytes = self._encode_key(key)
+        encoded = json.dumps(value).encode("utf-8")
+        status = self._call(
+            "JSONSetPath",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            path.encode("utf-8"),
+            ctypes.c_char_p(encoded),
+            ctypes.c_int(len(encoded)),
+        )
+        self._check_status(status)
+
+    def json_merge_patch(self, key: Any, patch: Any) -> None:
+        """Atomically apply an RFC 7386 merge patch to the JSON document at key.
+
+        Members set to None are removed and the rest are merged in recursively.
+        """
+        key_bytes = self._encode_key(key)
+        encoded = json.dumps(patch).encode("utf-8")
+        status = self._call(
+            "JSONMergePatch",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(encoded),
+            ctypes.c_int(len(encoded)),
+        )
+        self._check_status(status)
+
+    def create_index(self, name: str, json_path: str) -> None:
+        """Index the value at json_path (e.g. "$.user.email") of every JSON value in the store.
+
+        The index is kept current in the same batch as every later write and survives reopening.
+        Strings index as their text, numbers and booleans as written, and a path ending on an
+        array indexes each element. The store must be opened with {"indexes": True}.
+        """
+        status = self._call(
+            "CreateIndex", ctypes.c_size_t(self._handle), name.encode("utf-8"), json_path.encode("utf-8")
+        )
+        self._check_status(status)
+
+    def create_index_callback(self, name: str, fn: Callable[[bytes, Any], Optional[Union[bytes, str]]]) -> None:
+        """Index each entry under fn(key, value); returning None leaves the entry out.
+
+        fn runs on the writing thread while writes to the store wait, and must not use this
+        store. Callback indexes are not stored, so recreate them after every open.
+        """
+        result: List[Any] = [None]
+
+        def trampoline(_user_data, key, key_len, value, value_len, out_len):
+            indexed = fn(ctypes.string_at(key, key_len), self._decode_value(ctypes.string_at(value, value_len)))
+            if indexed is None:
+                return None
+            if isinstance(indexed, str):
+                indexed = indexed.encode("utf-8")
+            # The library copies the result before the next call, so one buffer is enough.
+            result[0] = ctypes.create_string_buffer(bytes(indexed), len(indexed))
+            out_len[0] = len(indexed)
+            return ctypes.addressof(result[0])
+
+        callback = _INDEX_CALLBACK(trampoline)
+        status = self._call("CreateIndexCallback", ctypes.c_size_t(self._handle), name.encode("utf-8"), callback, None)
+        self._check_status(status)
+        self._callbacks[("index", name)] = callback
+
+    def drop_index(self, name: str) -> None:
+        """Remove the named index and its entries."""
+        self._check_status(self._call("DropIndex", ctypes.c_size_t(self._handle), name.encode("utf-8")))
+        self._callbacks.pop(("index", name), None)
+
+    def list_indexes(self) -> List[Dict[str, Any]]:
+        """List the store's indexes (name, json_path, callback, text), ordered by name."""
+        return self._json_result(self._call("ListIndexes", ctypes.c_size_t(self._handle)), "ListIndexes failed")
+
+    def query_index(self, name: str, value: Union[bytes, str, int, float, bool]) -> List[bytes]:
+        """Return the keys whose entry in the named index holds value, in key order."""
+        if isinstance(value, (bytes, bytearray, memoryview)):
+            value_bytes = bytes(value)
+        elif isinstance(value, bool):
+            value_bytes = b"true" if value else b"false"
+        else:
+            value_bytes = str(value).encode("utf-8")
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "QueryIndex",
+            ctypes.c_size_t(self._handle),
+            name.encode("utf-8"),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+            ctypes.byref(result_len),
+        )
+        return self._keys_result(ptr, result_len.value, "QueryIndex failed")
+
+    def enable_text_index(
+        self, prefix: Any = None, *, json_path: Optional[str] = None, min_token_length: Optional[int] = None
+    ) -> None:
+        """Keep a full-text index of the values under prefix (every key when omitted).
+
+        json_path indexes the text at that path of JSON values instead of the whole value, and
+        words shorter than min_token_length (default 2) are dropped. The index is listed as
+        "text:" plus the prefix. The store must be opened with options={"indexes": True}.
+        """
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        options: Dict[str, Any] = {}
+        if json_path is not None:
+            options["json_path"] = json_path
+        if min_token_length is not None:
+            options["min_token_length"] = min_token_length
+        status = self._call(
+            "EnableTextIndex",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+            self._options_document(options or None),
+        )
+        self._check_status(status)
+
+    def search_text(self, query: str, *, limit: int = 0) -> List[Tuple[bytes, float]]:
+        """Return (key, score) for keys whose text holds any word of query, best match first."""
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "SearchText",
+            ctypes.c_size_t(self._handle),
+            query.encode("utf-8"),
+            ctypes.c_int(limit),
+            ctypes.byref(result_len),
+        )
+        entries = self._entries_result(ptr, result_len.value, decode=False)
+        return [(key, struct.unpack("<d", score)[0]) for key, score in entries]
+
+    def vector_put(self, key: Any, embedding: Sequence[float]) -> None:
+        """Store embedding for key, apart from its value; every embedding must have the same dimension."""
+        key_bytes = self._encode_key(key)
+        values = (ctypes.c_float * len(embedding))(*embedding)
+        status = self._call(
+            "VectorPut",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            values,
+            ctypes.c_int(len(embedding)),
+        )
+        self._check_status(status)
+
+    def vector_delete(self, key: Any) -> None:
+        key_bytes = self._encode_key(key)
+        status = self._call(
+            "VectorDelete", ctypes.c_size_t(self._handle), ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes))
+        )
+        self._check_status(status)
+
+    def vector_search(self, query: Sequence[float], k: int = 10) -> List[Tuple[bytes, float]]:
+        """Return the k keys whose embeddings are most similar to query as (key, cosine similarity)."""
+        values = (ctypes.c_float * len(query))(*query)
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "VectorSearch",
+            ctypes.c_size_t(self._handle),
+            values,
+            ctypes.c_int(len(query)),
+            ctypes.c_int(k),
+            ctypes.byref(result_len),
+        )
+        entries = self._entries_result(ptr, result_len.value, decode=False)
+        return [(key, struct.unpack("<d", score)[0]) for key, score in entries]
+
+    def ts_append(self, series: str, timestamp_ms: int, value: float) -> None:
+        """Record value at timestamp_ms (Unix milliseconds) in series, replacing any point at that time."""
+        status = self._call(
+            "TSAppend",
+            ctypes.c_size_t(self._handle),
+            series.encode("utf-8"),
+            ctypes.c_int64(timestamp_ms),
+            ctypes.c_double(value),
+        )
+        self._check_status(status)
+
+    def ts_range(
+        self, series: str, start_ms: int, end_ms: int, *, downsample_ms: int = 0
+    ) -> List[Tuple[int, int, float, float, float]]:
+        """Aggregate the points of series in [start_ms, end_ms) into windows of downsample_ms.
+
+        Returns (window_start_ms, count, sum, min, max) for each non-empty window, with
+        windows aligned to the Unix epoch; without downsample_ms every point is its own window.
+        """
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "TSRange",
+            ctypes.c_size_t(self._handle),
+            series.encode("utf-8"),
+            ctypes.c_int64(start_ms),
+            ctypes.c_int64(end_ms),
+            ctypes.c_int64(downsample_ms),
+            ctypes.byref(result_len),
+        )
+        if not ptr:
+            if self._last_code() != ErrorCode.OK:
+                self._raise_last("TSRange failed")
+            return []
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+        return list(struct.iter_unpack("<qQddd", raw))
+
+    def geo_put(self, key: Any, lat: float, lon: float) -> None:
+        """Record that key is at lat, lon in degrees, apart from its value, replacing its old location."""
+        key_bytes = self._encode_key(key)
+        status = self._call(
+            "GeoPut",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_double(lat),
+            ctypes.c_double(lon),
+        )
+        self._check_status(status)
+
+    def geo_delete(self, key: Any) -> None:
+        key_bytes = self._encode_key(key)
+        status = self._call(
+            "GeoDelete", ctypes.c_size_t(self._handle), ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes))
+        )
+        self._check_status(status)
+
+    def geo_search(self, lat: float, lon: float, radius: float, *, limit: int = 0) -> List[Tuple[bytes, float]]:
+        """Return (key, distance in metres) for keys within radius metres of lat, lon, nearest first."""
+        result_len = ctypes.c_int()
+        ptr = self._call(
+            "GeoSearch",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_double(lat),
+            ctypes.c_double(lon),
+            ctypes.c_double(radius),
+            ctypes.c_int(limit),
+            ctypes.byref(result_len),
+        )
+        entries = self._entries_result(ptr, result_len.value, decode=False)
+        return [(key, struct.unpack("<d", distance)[0]) for key, distance in entries]
+
+    def watch(self, prefix: Any = None) -> "Watch":
+        """Start receiving change events for keys under prefix (every key when omitted)."""
+        prefix_bytes = b"" if prefix is None else self._encode_key(prefix)
+        handle = self._call(
+            "WatchOpen",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(prefix_bytes),
+            ctypes.c_int(len(prefix_bytes)),
+        )
+        if handle == 0:
+            self._raise_last("failed to open watch")
+        return Watch(self, int(handle))
+
+    def blob_put(self, key: Any, data: Union[bytes, bytearray, memoryview]) -> None:
+        """Store data under key in chunks, so it may exceed what one value can hold.
+
+        Blobs live in their own keyspace: key does not clash with a plain value of the same name.
+        """
+        key_bytes = self._encode_key(key)
+        data_bytes = bytes(data)
+        status = self._call(
+            "BlobPut",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(data_bytes),
+            ctypes.c_int64(len(data_bytes)),
+        )
+        self._check_status(status)
+
+    def blob_get(self, key: Any, default: Any = None) -> Any:
+        """Return the whole blob under key as bytes, or default if there is none."""
+        key_bytes = self._encode_key(key)
+        value_len = ctypes.c_int()
+        ptr = self._call(
+            "BlobGet",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.byref(value_len),
+        )
+        if not ptr:
+            code = self._last_code()
+            if code == ErrorCode.NOT_FOUND:
+                return default
+            if code != ErrorCode.OK:
+                self._raise_last("BlobGet failed")
+            return b""
+        try:
+            return ctypes.string_at(ptr, value_len.value)
+        finally:
+            self._lib.FreeBuffer(ptr)
+
+    def blob_delete(self, key: Any) -> None:
+        """Remove the blob under key with all its chunks; a missing blob is not an error."""
+        key_bytes = self._encode_key(key)
+        status = self._call(
+            "BlobDelete",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+        )
+        self._check_status(status)
+
+    def blob_create(self, key: Any) -> "BlobWriter":
+        """Start streaming a blob into key; it replaces any earlier blob only once committed."""
+        key_bytes = self._encode_key(key)
+        handle = self._call(
+            "BlobCreate",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+        )
+        if handle == 0:
+            self._raise_last("failed to create blob")
+        return BlobWriter(self, int(handle))
+
+    def blob_open(self, key: Any) -> "BlobReader":
+        """Open the blob under key for streaming reads; a missing blob raises ErrorCode.NOT_FOUND."""
+        key_bytes = self._encode_key(key)
+        size = ctypes.c_int64()
+        handle = self._call(
+            "BlobOpen",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.byref(size),
+        )
+        if handle == 0:
+            self._raise_last("failed to open blob")
+        return BlobReader(self, int(handle), size.value)
+
+    def register_write_callback(self, fn: Callable[[str, bytes, Any], None]) -> int:
+        """Call fn(op, key, value) after every successful write; returns an id for unregistering.
+
+        op is "set" or "delete" (value is None for deletes). fn runs on the writing thread
+        and must not use this store.
+        """
+
+        def trampoline(_user_data, key, key_len, op, value, value_len):
+            name = _OP_NAMES.get(op, str(op))
+            decoded = self._decode_value(ctypes.string_at(value, value_len)) if name == "set" else None
+            fn(name, ctypes.string_at(key, key_len), decoded)
+
+        callback = _WRITE_CALLBACK(trampoline)
+        callback_id = self._call("RegisterWriteCallback", ctypes.c_size_t(self._handle), callback, None)
+        if callback_id < 0:
+            self._check_status(callback_id)
+        self._callbacks[callback_id] = callback
+        return callback_id
+
+    def unregister_write_callback(self, callback_id: int) -> None:
+        status = self._call("UnregisterWriteCallback", ctypes.c_size_t(self._handle), ctypes.c_int64(callback_id))
+        self._check_status(status)
+        self._callbacks.pop(callback_id, None)
+
+    def next_sequence(self, name: str, *, bandwidth: int = 100) -> int:
+        """Return the next ID of the named sequence, starting at 0.
+
+        IDs are leased from the store bandwidth at a time, so they are unique and increasing
+        but may skip ranges after the store is reopened.
+        """
+        result = ctypes.c_uint64()
+        status = self._call(
+            "NextSequence",
+            ctypes.c_size_t(self._handle),
+            name.encode("utf-8"),
+            ctypes.c_uint64(bandwidth),
+            ctypes.byref(result),
+        )
+        self._check_status(status)
+        return result.value
+
+    def stats(self) -> Dict[str, Any]:
+        """Describe the store: backend name plus whatever sizes and cache counters it can measure."""
+        return self._json_result(self._call("Stats", ctypes.c_size_t(self._handle)), "Stats failed")
+
+    def set_rate_limit(
+        self,
+        *,
+        ops_per_sec: float = 0,
+        bytes_per_sec: float = 0,
+        burst_seconds: float = 0,
+        block: bool = False,
+        max_wait: Optional[float] = None,
+    ) -> None:
+        """Replace the write limits of a store opened with a rate_limit section (0 for no limit).
+
+        Writes over the limit raise SkyshelveError with ErrorCode.THROTTLED, or with block set
+        wait for capacity, up to max_wait seconds when given. burst_seconds is how many seconds'
+        worth of writes may go through at once, 1 by default. stats()["rate_limit"] reports the
+        pressure on the limits.
+        """
+        config: Dict[str, Any] = {
+            "ops_per_sec": ops_per_sec,
+            "bytes_per_sec": bytes_per_sec,
+            "burst_seconds": burst_seconds,
+            "block": block,
+        }
+        if max_wait is not None:
+            config["max_wait"] = f"{int(max_wait * 1000)}ms"
+        status = self._call("SetRateLimit", ctypes.c_size_t(self._handle), json.dumps(config).encode("utf-8"))
+        self._check_status(status)
+
+    def compact(self) -> None:
+        """Reclaim disk space held by overwritten and deleted values (badger value-log GC, SQLite VACUUM)."""
+        self._check_status(self._call("Compact", ctypes.c_size_t(self._handle)))
+
+    def verify(self, repair: bool = False) -> Dict[str, Any]:
+        """Read back every entry and report the ones that fail their checksum or cannot be decoded.
+
+        Corrupt keys are listed as bytes. With repair set, corrupt entries are moved under the
+        b"\\xffquarantine/" prefix, or dropped when unreadable.
+        """
+        report = self._json_result(
+            self._call("Verify", ctypes.c_size_t(self._handle), ctypes.c_int(1 if repair else 0)),
+            "Verify failed",
+        )
+        for record in report["corrupt"]:
+            record["key"] = base64.b64decode(record["key"])
+        return report
+
+    @classmethod
+    def _json_result(cls, ptr: Optional[int], fallback: str) -> Any:
+        """Decode a FreeCString-owned JSON document, raising the last error for NULL."""
+        if not ptr:
+            cls._raise_last(fallback)
+        try:
+            return json.loads(ctypes.string_at(ptr).decode("utf-8"))
+        finally:
+            cls._lib.FreeCString(ptr)
+
+    def set_encryption_key(self, key_id: int, key: bytes) -> None:
+        """Make an AES key (16, 24 or 32 bytes) available for reading values sealed under key_id.
+
+        It also seals new writes if the store has no key yet. Not available on badger stores,
+        which encrypt natively.
+        """
+        status = self._call(
+            "SetEncryptionKey",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_uint32(key_id),
+            ctypes.c_char_p(bytes(key)),
+            ctypes.c_int(len(key)),
+        )
+        self._check_status(status)
+
+    def rotate_encryption_key(self, key_id: int, key: bytes) -> None:
+        """Seal every later write with key; values under older keys stay readable while those keys are set."""
+        status = self._call(
+            "RotateEncryptionKey",
+            ctypes.c_size_t(self._handle),
+            ctypes.c_uint32(key_id),
+            ctypes.c_char_p(bytes(key)),
+            ctypes.c_int(len(key)),
+        )
+        self._check_status(status)
+
+    def transaction(self) -> "Transaction":
+        """Begin a read-write transaction; use it as a context manager to commit on success."""
+        txn = self._call("BeginTxn", ctypes.c_size_t(self._handle))
+        if txn == 0:
+            self._raise_last("failed to begin transaction")
+        return Transaction(self, int(txn))
+
+    @classmethod
+    def list_backends(cls, *, lib_path: Optional[str] = None) -> List[str]:
+        """Return the path schemes (e.g. "bolt" for "bolt:/data/x.bolt") this library can open."""
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        return cls._json_result(cls._lib.ListBackends(), "ListBackends failed")
+
+    @classmethod
+    def list_handles(cls, *, lib_path: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Describe every open store, snapshot and bucket handle in the process, ordered by id."""
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        return cls._json_result(cls._lib.ListHandles(), "ListHandles failed")
+
+    @property
+    def handle(self) -> int:
+        """The library handle ID, as listed by list_handles; 0 once closed."""
+        return self._handle
+
+    def ping(self) -> float:
+        """Check the store can still serve reads and return the round trip in seconds, for readiness probes."""
+        micros = self._call("Ping", ctypes.c_size_t(self._handle))
+        if micros < 0:
+            self._check_status(micros)
+        return micros / 1_000_000
+
+    def is_open(self) -> bool:
+        """Report whether the library still has this handle open (close_all closes it too)."""
+        return self._handle != 0 and self._lib.IsOpen(ctypes.c_size_t(self._handle)) == 1
+
+    @classmethod
+    def close_all(cls, *, lib_path: Optional[str] = None) -> None:
+        """Flush and close every open store, stop the metrics server and close the log file.
+
+        Meant for shutdown paths, so stores nobody closed do not replay their WAL on the next
+        start. Existing SkyShelve objects become unusable; closing them afterwards is a no-op.
+        """
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        cls._check_status(cls._lib.CloseAll())
+
+    @classmethod
+    def version(cls, *, lib_path: Optional[str] = None) -> Dict[str, Any]:
+        """Return the library version, Go toolchain, badger and SlateDB module versions and build info."""
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        return cls._json_result(cls._lib.Version(), "Version failed")
+
+    @classmethod
+    def capabilities(cls, *, lib_path: Optional[str] = None) -> Dict[str, Any]:
+        """Return {"features": [...], "backends": {scheme: [optional features]}} for gating features."""
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        return cls._json_result(cls._lib.Capabilities(), "Capabilities failed")
+
+    @classmethod
+    def free_arena(cls, *, lib_path: Optional[str] = None) -> None:
+        """Release the idle result buffers the library keeps for reuse, e.g. after a burst of large scans."""
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        cls._lib.FreeArena()
+
+    @classmethod
+    def set_log_callback(
+        cls,
+        fn: Optional[Callable[[int, str, str], None]],
+        *,
+        level: Union[int, str] = "info",
+        lib_path: Optional[str] = None,
+    ) -> None:
+        """Deliver library log lines at or above level to fn(level, component, message).
+
+        Levels are 0 debug, 1 info, 2 warn and 3 error. fn must not call back into skyshelve.
+        Pass None to remove the callback. Badger stores pick this up when they are opened.
+        """
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        if fn is None:
+            callback = _LOG_CALLBACK()
+        else:
+
+            def trampoline(_user_data, lvl, component, message):
+                fn(lvl, component.decode("utf-8", "replace"), message.decode("utf-8", "replace"))
+
+            callback = _LOG_CALLBACK(trampoline)
+        cls._check_status(cls._lib.SetLogCallback(callback, None, _LOG_LEVELS.get(level, level)))
+        cls._log_callback = callback if fn is not None else None
+
+    @classmethod
+    def set_log_file(
+        cls,
+        path: Optional[Union[str, Path]],
+        *,
+        level: Union[int, str] = "info",
+        lib_path: Optional[str] = None,
+    ) -> None:
+        """Append library log lines at or above level to path (rotated at 64 MiB); None closes it."""
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        encoded = b"" if path is None else os.fspath(path).encode("utf-8")
+        cls._check_status(cls._lib.SetLogFile(encoded, _LOG_LEVELS.get(level, level)))
+
+    @classmethod
+    def start_metrics_server(cls, addr: str, *, lib_path: Optional[str] = None) -> None:
+        """Serve Prometheus metrics for every open store on http://addr/metrics.
+
+        Operation metrics are only collected while the server runs.
+        """
+        cls._ensure_library(lib_path)
+        assert cls._lib is not None
+        cls._check_status(cls._lib.StartMetricsServer(addr.encode("utf-8")))
+
+    @classmethod
+    def stop_metrics_server(cls) -> None:
+        assert cls._lib is not None
+        cls._check_status(cls._lib.StopMetricsServer())
+
+    def start_http_server(self, addr: str, *, auth_token: Optional[str] = None) -> None:
+        """Serve this store over HTTP on addr: /keys/{key}, /scan and /batch.
+
+        The server reads and writes stored bytes as they are, so values written through this
+        wrapper carry its one-byte type tag. With auth_token every request needs
+        "Authorization: Bearer <auth_token>".
+        """
+        token = auth_token.encode("utf-8") if auth_token else None
+        status = self._call("StartHTTPServer", ctypes.c_size_t(self._handle), addr.encode("utf-8"), token)
+        self._check_status(status)
+
+    def stop_http_server(self) -> None:
+        status = self._call("StopHTTPServer", ctypes.c_size_t(self._handle))
+        self._check_status(status)
+
+    def start_resp_server(self, addr: str) -> None:
+        """Serve this store to Redis clients on addr (GET, SET, DEL, EXISTS, INCR, TTL, SCAN and a few more).
+
+        Values are served as stored, with this wrapper's type tag. There is no authentication,
+        so bind it to a trusted interface.
+        """
+        status = self._call("StartRESPServer", ctypes.c_size_t(self._handle), addr.encode("utf-8"))
+        self._check_status(status)
+
+    def stop_resp_server(self) -> None:
+        status = self._call("StopRESPServer", ctypes.c_size_t(self._handle))
+        self._check_status(status)
+
+    def start_memcache_server(self, addr: str) -> None:
+        """Serve this store to memcached text-protocol clients on addr (get, set, delete, incr, decr).
+
+        Values are served as stored, with this wrapper's type tag. There is no authentication,
+        so bind it to a trusted interface.
+        """
+        status = self._call("StartMemcacheServer", ctypes.c_size_t(self._handle), addr.encode("utf-8"))
+        self._check_status(status)
+
+    def stop_memcache_server(self) -> None:
+        status = self._call("StopMemcacheServer", ctypes.c_size_t(self._handle))
+        self._check_status(status)
+
+    def start_grpc_server(self, addr: str, *, auth_token: Optional[str] = None) -> None:
+        """Serve the skyshelve.v1.KV gRPC service (skyshelve.proto) on addr over h2c."""
+        token = auth_token.encode("utf-8") if auth_token else None
+        status = self._call("StartGRPCServer", ctypes.c_size_t(self._handle), addr.encode("utf-8"), token)
+        self._check_status(status)
+
+    def stop_grpc_server(self) -> None:
+        status = self._call("StopGRPCServer", ctypes.c_size_t(self._handle))
+        self._check_status(status)
+
+    def close(self) -> None:
+        if self._handle == 0:
+            return
+        status = self._call("Close", ctypes.c_size_t(self._handle))
+        self._handle = 0
+        # An invalid handle means close_all already closed the store.
+        if status not in (0, ErrorCode.INVALID_HANDLE):
+            self._check_status(status)
+
+    def __del__(self) -> None:
+        try:
+            self.close()
+        except Exception:
+            pass
+
+
+class Transaction:
+    """Read-write transaction over a SkyShelve store, committed or rolled back as a unit."""
+
+    def __init__(self, store: SkyShelve, handle: int) -> None:
+        self._store = store
+        self._handle = handle
+
+    def _lib_call(self, func_name: str, *args) -> int:
+        if self._handle == 0:
+            raise SkyshelveError("transaction is already finished", ErrorCode.INVALID_HANDLE)
+        return getattr(self._store._lib, func_name)(ctypes.c_size_t(self._handle), *args)
+
+    def set(self, key: Any, value: Any) -> None:
+        key_bytes = self._store._encode_key(key)
+        value_bytes = self._store._encode_value(value)
+        status = self._lib_call(
+            "TxnSet",
+            ctypes.c_char_p(key_bytes),
+            ctypes.c_int(len(key_bytes)),
+            ctypes.c_char_p(value_bytes),
+            ctypes.c_int(len(value_bytes)),
+        )
+        self._store._check_status(status)
+
+    def get(self, key: Any, default: Any = None) -> Any:
+        key_bytes = self._store._encode_key(key)
+        value_len = ctypes.c_int()
+        ptr = self._lib_call("TxnGet", ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes)), ctypes.byref(value_len))
+        if not ptr:
+            if self._store._last_code() not in (ErrorCode.OK, ErrorCode.NOT_FOUND):
+                self._store._raise_last("TxnGet failed")
+            return default
+        try:
+            raw = ctypes.string_at(ptr, value_len.value)
+        finally:
+            self._store._lib.FreeBuffer(ptr)
+        return self._store._decode_value(raw)
+
+    def delete(self, key: Any) -> None:
+        key_bytes = self._store._encode_key(key)
+        status = self._lib_call("TxnDelete", ctypes.c_char_p(key_bytes), ctypes.c_int(len(key_bytes)))
+        self._store._check_status(status)
+
+    def commit(self) -> None:
+        """Commit the transaction. The handle is released even when the commit conflicts."""
+        status = self._lib_call("TxnCommit")
+        self._handle = 0
+        self._store._check_status(status)
+
+    def rollback(self) -> None:
+        if self._handle == 0:
+            return
+        status = self._lib_call("TxnRollback")
+        self._handle = 0
+        self._store._check_status(status)
+
+    def __enter__(self) -> "Transaction":
+        return self
+
+    def __exit__(self, exc_type, exc, tb) -> None:
+        if exc_type is None and self._handle != 0:
+            self.commit()
+        else:
+            self.rollback()
+
+
+class Snapshot(SkyShelve):
+    """Read-only view of a store pinned when it was taken; writes through it fail."""
+
+    def __init__(self, store: SkyShelve, handle: int) -> None:
+        self._handle = handle
+        self._auto_pickle = store._auto_pickle
+        self._callbacks = {}
+        self.default_factory = None
+
+    def close(self) -> None:
+        if self._handle == 0:
+            return
+        status = self._call("CloseSnapshot", ctypes.c_size_t(self._handle))
+        self._handle = 0
+        self._check_status(status)
+
+
+class Bucket(SkyShelve):
+    """Named keyspace within a store, returned by SkyShelve.bucket."""
+
+    def __init__(self, store: SkyShelve, handle: int) -> None:
+        self._handle = handle
+        self._auto_pickle = store._auto_pickle
+        self._callbacks = {}
+        self.default_factory = None
+
+
+# Completion callbacks of async writes, keyed by the token passed as user_data. A single
+# module-level ctypes thunk dispatches them, so no thunk is freed while it runs.
+_ASYNC_LOCK = threading.Lock()
+_ASYNC_TOKENS = itertools.count(1)
+_ASYNC_CALLBACKS: Dict[int, Callable[[Optional[SkyshelveError]], None]] = {}
+
+
+@_DONE_CALLBACK
+def _async_done(user_data, status, message):
+    with _ASYNC_LOCK:
+        callback = _ASYNC_CALLBACKS.pop(user_data, None)
+    if callback is None:
+        return
+    error = None
+    if status != 0:
+        error = SkyshelveError((message or b"").decode("utf-8", "replace"), status)
+    callback(error)
+
+
+class Future:
+    """Pending async write returned by SkyShelve.set_async and friends."""
+
+    def __init__(self, lib: Any, future_id: int) -> None:
+        self._lib = lib
+        self._id = future_id
+
+    def wait(self, timeout: Optional[float] = None) -> bool:
+        """Wait up to timeout seconds (forever when None); True once the write committed.
+
+        Returns False if it is still pending and raises SkyshelveError if it failed.
+        """
+        if self._id == 0:
+            raise SkyshelveError("future is closed", ErrorCode.INVALID_HANDLE)
+        timeout_ms = -1 if timeout is None else int(timeout * 1000)
+        status = self._lib.FutureWait(ctypes.c_int64(self._id), ctypes.c_int(timeout_ms))
+        if status == 1:
+            return False
+        SkyShelve._check_status(status)
+        return True
+
+    def close(self) -> None:
+        """Release the future; the write itself is unaffected."""
+        if self._id == 0:
+            return
+        future_id, self._id = self._id, 0
+        SkyShelve._check_status(self._lib.FutureClose(ctypes.c_int64(future_id)))
+
+    def __enter__(self) -> "Future":
+        return self
+
+    def __exit__(self, exc_type, exc, tb) -> None:
+        self.close()
+
+
+class Watch:
+    """Stream of change events for a key prefix, as ("set" | "delete", key, value) tuples."""
+
+    def __init__(self, store: SkyShelve, handle: int) -> None:
+        self._store = store
+        self._handle = handle
+
+    def next(self, max_events: int = 64, timeout: float = 1.0) -> List[Tuple[str, bytes, Any]]:
+        """Wait up to timeout seconds for events; an empty list means none arrived.
+
+        Raises SkyshelveError once if events were dropped because the watch fell behind.
+        """
+        if self._handle == 0:
+            raise SkyshelveError("watch is closed", ErrorCode.CLOSED)
+        lib = self._store._lib
+        result_len = ctypes.c_int()
+        ptr = lib.WatchNext(
+            ctypes.c_size_t(self._handle),
+            ctypes.c_int(max_events),
+            ctypes.c_int(int(timeout * 1000)),
+            ctypes.byref(result_len),
+        )
+        if not ptr:
+            if self._store._last_code() != ErrorCode.OK:
+                self._store._raise_last("WatchNext failed")
+            return []
+        try:
+            raw = ctypes.string_at(ptr, result_len.value)
+        finally:
+            lib.FreeBuffer(ptr)
+
+        events: List[Tuple[str, bytes, Any]] = []
+        offset = 0
+        while offset < len(raw):
+            op, key_len, value_len = struct.unpack_from("<BII", raw, offset)
+            offset += 9
+            key = raw[offset : offset + key_len]
+            offset += key_len
+            value_raw = raw[offset : offset + value_len]
+            offset += value_len
+            name = _OP_NAMES.get(op, str(op))
+            value = self._store._decode_value(value_raw) if name == "set" else None
+            events.append((name, bytes(key), value))
+        return events
+
+    def close(self) -> None:
+        if self._handle == 0:
+            return
+        status = self._store._lib.WatchClose(ctypes.c_size_t(self._handle))
+        self._handle = 0
+        self._store._check_status(status)
+
+    def __enter__(self) -> "Watch":
+        return self
+
+    def __exit__(self, exc_type, exc, tb) -> None:
+        self.close()
+
+
+class BlobWriter:
+    """Streams a blob into a store; commit() publishes it and abort() drops it."""
+
+    def __init__(self, store: SkyShelve, handle: int) -> None:
+        self._store = store
+        self._handle = handle
+
+    def _lib_call(self, func_name: str, *args) -> int:
+        if self._handle == 0:
+            raise SkyshelveError("blob writer is already finished", ErrorCode.INVALID_HANDLE)
+        return getattr(self._store._lib, func_name)(ctypes.c_size_t(self._handle), *args)
+
+    def write(self, data: Union[bytes, bytearray, memoryview]) -> None:
+        data_bytes = bytes(data)
+        status = self._lib_call("BlobWrite", ctypes.c_char_p(data_bytes), ctypes.c_int(len(data_bytes)))
+        self._store._check_status(status)
+
+    def commit(self) -> None:
+        """Publish the blob. The handle is released even when the commit fails."""
+        status = self._lib_call("BlobCommit")
+        self._handle = 0
+        self._store._check_status(status)
+
+    def abort(self) -> None:
+        if self._handle == 0:
+            return
+        status = self._lib_call("BlobAbort")
+        self._handle = 0
+        self._store._check_status(status)
+
+    def __enter__(self) -> "BlobWriter":
+        return self
+
+    def __exit__(self, exc_type, exc, tb) -> None:
+        if exc_type is None and self._handle != 0:
+            self.commit()
+        else:
+            self.abort()
+
+
+class BlobReader:
+    """Streams a blob out of a store in order; size is its length in bytes."""
+
+    # BlobRead takes a C int capacity.
+    _MAX_READ = 1 << 30
+
+    def __init__(self, store: SkyShelve, handle: int, size: int) -> None:
+        self._store = store
+        self._handle = handle
+        self._offset = 0
+        self.size = size
+
+    def read(self, size: int = -1) -> bytes:
+        """Return up to size bytes (the rest of the blob when negative); b"" at the end.
+
+        Raises SkyshelveError with ErrorCode.CONFLICT if the blob was replaced or deleted
+        while being read.
+        """
+        if self._handle == 0:
+            raise SkyshelveError("blob reader is closed", ErrorCode.CLOSED)
+        remaining = self.size - self._offset
+        wanted = remaining if size < 0 else min(size, remaining)
+        parts: List[bytes] = []
+        while wanted > 0:
+            buf = ctypes.create_string_buffer(min(wanted, self._MAX_READ))
+            n = self._store._lib.BlobRead(ctypes.c_size_t(self._handle), buf, ctypes.c_int(len(buf)))
+            if n < 0:
+                self._store._check_status(n)
+            if n == 0:
+                break
+            parts.append(buf.raw[:n])
+            self._offset += n
+            wanted -= n
+        return b"".join(parts)
+
+    def close(self) -> None:
+        if self._handle == 0:
+            return
+        status = self._store._lib.BlobClose(ctypes.c_size_t(self._handle))
+        self._handle = 0
+        # An invalid handle means the store was closed first, which released the reader.
+        if status not in (0, ErrorCode.INVALID_HANDLE):
+            self._store._check_status(status)
+
+    def __enter__(self) -> "BlobReader":
+        return self
+
+    def __exit__(self, exc_type, exc, tb) -> None:
+        self.close()
+
+
+BadgerDict = SkyShelve
+BadgerError = SkyshelveError
+
+
+def slatedb_uri(
+    path: str,
+    *,
+    cache_dir: Optional[str] = None,
+    store: Optional[Dict[str, Any]] = None,
+    options: Optional[Dict[str, Any]] = None,
+) -> str:
+    """Utility to format a SlateDB configuration string for :class:`SkyShelve`.
+
+    Args:
+        path: Path used by SlateDB for on-disk storage or remote prefixes (e.g. S3).
+        cache_dir: Optional local cache directory for object-store backed deployments.
+        store: Optional store configuration dictionary mirroring
+            :class:`slatedb.StoreConfig`. Use ``{"provider": "aws", "aws": {...}}``
+            for AWS.
+        options: Optional dictionary mirroring ``slatedb.SlateDBOptions`` to fine-tune
+            flushing and caching behaviour.
+
+    Returns:
+        A ``slatedb:`` URI string suitable for ``SkyShelve`` or
+        ``PersistentObject`` configuration.
+    """
+
+    payload: Dict[str, Any] = {"path": path}
+    if cache_dir:
+        payload["cache_dir"] = cache_dir
+    if store:
+        payload["store"] = store
+    if options:
+        payload["options"] = options
+    return f"slatedb:{json.dumps(payload)}"
+
+
+def slatedb_url(
+    location: str,
+    *,
+    provider: str = "s3",
+    region: Optional[str] = None,
+    endpoint: Optional[str] = None,
+    request_timeout: Optional[str] = None,
+    async_writes: Optional[bool] = None,
+) -> str:
+    """Format a URL-style SlateDB location such as ``slatedb+s3://bucket/prefix?region=...``.
+
+    Args:
+        location: ``bucket/prefix`` for S3, or a filesystem path for ``provider="file"``.
+        provider: ``"s3"`` or ``"file"``.
+        region: S3 region (S3 only).
+        endpoint: S3-compatible endpoint override (S3 only).
+        request_timeout: Go duration string such as ``"30s"`` (S3 only).
+        async_writes: Acknowledge writes before they are durable in the object store.
+
+    Returns:
+        A URL accepted as the ``path`` argument of :class:`SkyShelve`.
+    """
+
+    params: Dict[str, str] = {}
+    if region:
+        params["region"] = region
+    if endpoint:
+        params["endpoint"] = endpoint
+    if request_timeout:
+        params["request_timeout"] = request_timeout
+    if async_writes is not None:
+        params["async"] = "true" if async_writes else "false"
+
+    if provider == "s3":
+        url = f"slatedb+s3://{location.lstrip('/')}"
+    elif provider == "file":
+        if params.keys() - {"async"}:
+            raise ValueError("region, endpoint and request_timeout only apply to the s3 provider")
+        url = f"slatedb+file://{os.path.abspath(location)}"
+    else:
+        raise ValueError(f"Unsupported provider '{provider}' (expected 's3' or 'file')")
+    if params:
+        url += "?" + urllib.parse.urlencode(params)
+    return url
 
 
 def slatedb_uri_from_env(
@@ -0,0 +1,161 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+
+	"github.com/dgraph-io/ristretto"
+	bolt "go.etcd.io/bbolt"
+)
+
+// storeStats is the document returned by Stats. Backends fill in the
+// sections they can measure and leave the rest out.
+type storeStats struct {
+	Backend string `json:"backend"`
+	// ApproxKeys counts keys in on-disk tables, including overwritten and
+	// deleted versions not yet compacted away; memtables are not included.
+	ApproxKeys *uint64      `json:"approx_keys,omitempty"`
+	LSMSize    *int64       `json:"lsm_size_bytes,omitempty"`
+	VlogSize   *int64       `json:"vlog_size_bytes,omitempty"`
+	Levels     []levelStats `json:"levels,omitempty"`
+	BlockCache *cacheStats  `json:"block_cache,omitempty"`
+	IndexCache *cacheStats  `json:"index_cache,omitempty"`
+	// ValueCache and MissingCache report the cache section of the open
+	// options.
+	ValueCache   *cacheStats `json:"value_cache,omitempty"`
+	MissingCache *cacheStats `json:"missing_cache,omitempty"`
+	// RateLimit reports the rate_limit section of the open options.
+	RateLimit *rateLimitStats `json:"rate_limit,omitempty"`
+}
+
+type levelStats struct {
+	Level     int   `json:"level"`
+	Tables    int   `json:"tables"`
+	Size      int64 `json:"size_bytes"`
+	StaleSize int64 `json:"stale_bytes"`
+}
+
+type cacheStats struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// statsReporter is implemented by backends that can describe themselves.
+type statsReporter interface {
+	Stats() (storeStats, error)
+}
+
+func collectStats(store kvStore) (storeStats, error) {
+	if sr, ok := store.(statsReporter); ok {
+		return sr.Stats()
+	}
+	return storeStats{Backend: "unknown"}, nil
+}
+
+// Stats reports badger's own accounting. Sizes are refreshed by badger
+// periodically rather than on every write.
+func (s *badgerStore) Stats() (storeStats, error) {
+	stats := storeStats{Backend: "badger"}
+	lsm, vlog := s.db.Size()
+	stats.LSMSize, stats.VlogSize = &lsm, &vlog
+
+	var keys uint64
+	for _, t := range s.db.Tables() {
+		keys += uint64(t.KeyCount)
+	}
+	stats.ApproxKeys = &keys
+
+	for _, l := range s.db.Levels() {
+		stats.Levels = append(stats.Levels, levelStats{
+			Level:     l.Level,
+			Tables:    l.NumTables,
+			Size:      l.Size,
+			StaleSize: l.StaleDatSize,
+		})
+	}
+	stats.BlockCache = newCacheStats(s.db.BlockCacheMetrics())
+	stats.IndexCache = newCacheStats(s.db.IndexCacheMetrics())
+	return stats, nil
+}
+
+func newCacheStats(m *ristretto.Metrics) *cacheStats {
+	if m == nil {
+		return nil
+	}
+	return &cacheStats{Hits: m.Hits(), Misses: m.Misses(), HitRatio: m.Ratio()}
+}
+
+// Stats for SlateDB only identifies the backend: the Go bindings do not
+// expose memtable, SST or object-store counters.
+func (s *slateStore) Stats() (storeStats, error) {
+	return storeStats{Backend: "slatedb"}, nil
+}
+
+// Stats for bbolt counts the keys in the store's bucket.
+func (s *boltStore) Stats() (storeStats, error) {
+	stats := storeStats{Backend: "bolt"}
+	err := s.view(func(b *bolt.Bucket) error {
+		keys := uint64(b.Stats().KeyN)
+		stats.ApproxKeys = &keys
+		return nil
+	})
+	return stats, err
+}
+
+// Stats for SQLite counts the rows of the kv table.
+func (s *sqliteStore) Stats() (storeStats, error) {
+	n, err := s.Count(nil, nil)
+	if err != nil {
+		return storeStats{}, err
+	}
+	keys := uint64(n)
+	return storeStats{Backend: "sqlite", ApproxKeys: &keys}, nil
+}
+
+func (s *lmdbStore) Stats() (storeStats, error) {
+	stat, err := s.env.Stat()
+	if err != nil {
+		return storeStats{}, err
+	}
+	keys := stat.Entries
+	return storeStats{Backend: "lmdb", ApproxKeys: &keys}, nil
+}
+
+func (s *memStore) Stats() (storeStats, error) {
+	s.mu.RLock()
+	keys := uint64(s.tree.Len())
+	s.mu.RUnlock()
+	return storeStats{Backend: "memory", ApproxKeys: &keys}, nil
+}
+
+// Stats returns a JSON document describing the store behind handle, for the
+// host to release with FreeCString. Fields a backend cannot measure are
+// omitted.
+//
+//export Stats
+func Stats(handle C.uintptr_t) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	stats, err := collectStats(store)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	doc, err := json.Marshal(stats)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.CString(string(doc))
+}
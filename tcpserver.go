@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// tcpServer runs a protocol handler for each connection accepted on a
+// listener, and can drop them all at once when its handle closes.
+type tcpServer struct {
+	ln     net.Listener
+	handle func(net.Conn)
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+}
+
+func newTCPServer(ln net.Listener, handle func(net.Conn)) *tcpServer {
+	return &tcpServer{ln: ln, handle: handle, conns: make(map[net.Conn]struct{})}
+}
+
+func (s *tcpServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.conns == nil {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// close stops accepting, drops every connection and waits for their
+// handlers to return.
+func (s *tcpServer) close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
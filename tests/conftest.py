@@ -2,8 +2,10 @@ import ctypes
 import os
 import platform
 import shutil
+import socket
 import subprocess
 import sys
+import time
 from pathlib import Path
 
 import pytest
@@ -17,6 +19,23 @@ if str(SRC_ROOT) not in sys.path:
 _SLATEDB_HANDLE = None
 
 
+def free_addr() -> str:
+    """Return a loopback host:port that was free a moment ago, for test servers."""
+    with socket.socket() as sock:
+        sock.bind(("127.0.0.1", 0))
+        return f"127.0.0.1:{sock.getsockname()[1]}"
+
+
+def wait_for(predicate, timeout=10.0):
+    """Poll predicate until it holds or timeout seconds pass; return its last result."""
+    deadline = time.monotonic() + timeout
+    while time.monotonic() < deadline:
+        if predicate():
+            return True
+        time.sleep(0.05)
+    return predicate()
+
+
 def _shared_library_name() -> str:
     system = platform.system()
     if system == "Windows":
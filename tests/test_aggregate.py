@@ -0,0 +1,87 @@
+import json
+import struct
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+@pytest.fixture
+def orders(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("order:1", json.dumps({"price": 10, "status": "paid"}))
+    store.set("order:2", json.dumps({"price": 2.5, "status": "open"}))
+    store.set("order:3", json.dumps({"price": 7.5, "status": "paid"}).encode())
+    store.set("order:4", json.dumps({"status": "paid"}))
+    store.set("other", json.dumps({"price": 1000}))
+    return store
+
+
+def test_json_path_aggregate(orders):
+    result = orders.aggregate("$.price", "order:")
+
+    assert result == {"count": 3, "sum": 20.0, "min": 2.5, "max": 10.0, "avg": 20.0 / 3, "skipped": 1}
+
+
+def test_filter_limits_the_values_folded(orders):
+    result = orders.aggregate("$.price", "order:", filter='$.status == "paid"')
+
+    assert result["count"] == 2
+    assert result["sum"] == 17.5
+    assert result["skipped"] == 1
+
+
+def test_empty_result_has_null_statistics(orders):
+    result = orders.aggregate("$.price", "missing:")
+
+    assert result == {"count": 0, "sum": 0, "min": None, "max": None, "avg": None, "skipped": 0}
+
+
+def test_text_counters(skyshelve_factory):
+    store = skyshelve_factory()
+    store.incr("hits:a", 4)
+    store.incr("hits:b", 6)
+    store.set("hits:c", "5")
+    store.set("hits:d", "many")
+
+    result = store.aggregate("text", "hits:")
+
+    assert (result["count"], result["sum"], result["skipped"]) == (3, 15.0, 1)
+
+
+@pytest.mark.parametrize(
+    "spec, fmt",
+    [("i32", "<i"), ("u32", "<I"), ("i64", "<q"), ("u64", "<Q"), ("f32", "<f"), ("f64", "<d")],
+)
+def test_fixed_width_values(skyshelve_factory, spec, fmt):
+    store = skyshelve_factory()
+    for i, n in enumerate([3, 1, 8]):
+        store.set(f"n:{i}", struct.pack(fmt, n))
+    store.set("n:bad", b"\x01\x02")
+
+    result = store.aggregate(spec, "n:")
+
+    assert (result["count"], result["sum"], result["min"], result["max"]) == (3, 12, 1, 8)
+    assert result["skipped"] == 1
+
+
+def test_aggregate_range(orders):
+    assert orders.aggregate_range("$.price", "order:2", "order:4")["sum"] == 10.0
+    assert orders.aggregate_range("$.price", start="order:3")["sum"] == 1007.5
+    assert orders.aggregate_range("$.price", end="order:2")["count"] == 1
+    assert orders.aggregate_range("$.price", "order:3", "order:1")["count"] == 0
+
+
+@pytest.mark.parametrize(
+    "spec, filter, message",
+    [
+        ("i16", None, "unknown aggregate value type"),
+        ("$.items[", None, "invalid json path"),
+        ("$.price", "$.status =", "incomplete filter clause"),
+    ],
+)
+def test_invalid_specs_and_filters_are_rejected(orders, spec, filter, message):
+    with pytest.raises(SkyshelveError, match=message):
+        orders.aggregate(spec, "order:", filter=filter)
+    with pytest.raises(SkyshelveError, match=message):
+        orders.aggregate_range(spec, filter=filter)
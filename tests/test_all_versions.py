@@ -0,0 +1,67 @@
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_versions_are_listed_newest_first(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("k", "first")
+    first = store.current_version()
+    store.set("k", {"second": 2})
+    second = store.current_version()
+    store.delete("k")
+    deleted = store.current_version()
+
+    assert store.get_all_versions("k") == [
+        (deleted, None, "deleted"),
+        (second, {"second": 2}, "set"),
+        (first, "first", "set"),
+    ]
+
+
+def test_versions_match_get_at(skyshelve_factory):
+    store = skyshelve_factory()
+    for i in range(3):
+        store.set("k", i)
+
+    for version, value, _ in store.get_all_versions("k"):
+        assert store.get_at("k", version) == value
+
+
+def test_versions_of_other_keys_are_not_listed(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("k", 1)
+    store.set("k2", 2)
+    store.set("j", 3)
+
+    assert [value for _, value, _ in store.get_all_versions("k")] == [1]
+
+
+def test_missing_key_has_no_versions(skyshelve_factory):
+    store = skyshelve_factory()
+
+    assert store.get_all_versions("missing") == []
+
+
+def test_expired_versions_are_marked(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("k", "kept")
+    store.set("k", "short-lived", ttl=1)
+    time.sleep(1.5)
+
+    newest, older = store.get_all_versions("k")
+    assert newest[1:] == (None, "expired")
+    assert older[1:] == ("kept", "set")
+
+
+@pytest.mark.parametrize("backend", ["memory", "sqlite"])
+def test_backends_without_versions_reject_history(tmp_path, shared_library, backend):
+    path = None if backend == "memory" else str(tmp_path / "db")
+    store = SkyShelve(path, lib_path=str(shared_library), options={"backend": backend})
+    try:
+        with pytest.raises(SkyshelveError, match="versioned reads are not supported"):
+            store.get_all_versions("k")
+    finally:
+        store.close()
@@ -0,0 +1,73 @@
+import threading
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_append_bytes_creates_and_extends(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.append("log", b"\x00first;") == 7
+    assert store.append("log", b"second;") == 14
+
+    assert store.get("log") == b"\x00first;second;"
+
+
+def test_append_str(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("greeting", "hello")
+
+    assert store.append("greeting", ", wörld") == len("hello, wörld".encode("utf-8"))
+
+    assert store.get("greeting") == "hello, wörld"
+
+
+def test_concurrent_appends_are_not_lost(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    def writer(n):
+        for _ in range(50):
+            store.append("acc", bytes([n]))
+
+    threads = [threading.Thread(target=writer, args=(n,)) for n in range(4)]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+
+    value = store.get("acc")
+    assert len(value) == 200
+    assert sorted(set(value)) == [0, 1, 2, 3]
+
+
+def test_append_keeps_ttl(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", b"a", ttl=1)
+
+    store.append("k", b"b")
+
+    assert store.get("k") == b"ab"
+    time.sleep(2.2)
+    assert store.get("k") is None
+
+
+def test_append_on_sqlite(tmp_path, shared_library):
+    store = SkyShelve(f"sqlite:{tmp_path / 'a.db'}", lib_path=str(shared_library))
+    try:
+        store.append("k", b"x")
+        store.append("k", b"y")
+        assert store.get("k") == b"xy"
+    finally:
+        store.close()
+
+
+def test_append_on_snapshot_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", b"a")
+
+    with store.snapshot() as snap:
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.append("k", b"b")
+    assert store.get("k") == b"a"
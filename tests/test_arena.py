@@ -0,0 +1,27 @@
+from skyshelve import SkyShelve
+
+
+def test_large_reads_survive_free_arena(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(64):
+        store.set(f"k{i:02d}", bytes([i]) * 8192)
+
+    for _ in range(3):
+        entries = store.scan()
+        assert len(entries) == 64
+        assert all(store.get(f"k{i:02d}") == bytes([i]) * 8192 for i in range(0, 64, 7))
+
+    SkyShelve.free_arena()
+
+    assert store.scan("k63") == [(b"k63", bytes([63]) * 8192)]
+    assert store.get("k00") == b"\x00" * 8192
+
+
+def test_free_arena_is_idempotent(skyshelve_factory, shared_library):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", b"v" * 100_000)
+
+    SkyShelve.free_arena(lib_path=str(shared_library))
+    SkyShelve.free_arena()
+
+    assert store.get("k") == b"v" * 100_000
@@ -0,0 +1,120 @@
+import threading
+
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def test_set_async_future(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with store.set_async("k", {"v": 1}) as future:
+        assert future.wait(timeout=5) is True
+        assert future.wait() is True
+
+    assert store.get("k") == {"v": 1}
+
+
+def test_async_writes_apply_in_order(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    futures = [store.set_async("counter", i) for i in range(100)]
+    futures.append(store.delete_async("gone"))
+
+    assert all(f.wait(timeout=5) for f in futures)
+    for f in futures:
+        f.close()
+    assert store.get("counter") == 99
+
+
+def test_apply_async_commits_batch(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("old", 1)
+
+    future = store.apply_async([("set", b"a", 1), ("set", b"b", 2), ("delete", b"old", None)])
+    assert future.wait(timeout=5)
+    future.close()
+
+    assert store.get("a") == 1
+    assert store.get("b") == 2
+    assert "old" not in store
+
+
+def test_completion_callback(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    done = threading.Event()
+    results = []
+
+    def on_done(error):
+        results.append(error)
+        done.set()
+
+    assert store.set_async("k", "v", callback=on_done) is None
+    assert done.wait(5)
+    assert results == [None]
+    assert store.get("k") == "v"
+
+
+def test_callback_receives_write_error(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"max_value_size": 8})
+    try:
+        done = threading.Event()
+        results = []
+
+        def on_done(error):
+            results.append(error)
+            done.set()
+
+        store.set_async("k", b"x" * 64, callback=on_done)
+        assert done.wait(5)
+        assert isinstance(results[0], SkyshelveError)
+        assert results[0].code == ErrorCode.TOO_LARGE
+
+        future = store.set_async("k", b"x" * 64)
+        with pytest.raises(SkyshelveError) as excinfo:
+            future.wait(timeout=5)
+        assert excinfo.value.code == ErrorCode.TOO_LARGE
+        future.close()
+    finally:
+        store.close()
+
+
+def test_close_flushes_pending_writes(tmp_path, shared_library):
+    path = str(tmp_path / "db")
+    store = SkyShelve(path, lib_path=str(shared_library))
+    futures = [store.set_async(f"k{i}", i) for i in range(200)]
+    store.close()
+    for f in futures:
+        f.close()
+
+    reopened = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        assert reopened.count() == 200
+    finally:
+        reopened.close()
+
+
+def test_closed_future_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    future = store.set_async("k", "v")
+    future.close()
+    future.close()
+
+    with pytest.raises(SkyshelveError, match="future is closed"):
+        future.wait()
+
+
+def test_async_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.set_async("k", "v")
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.delete_async("k", callback=lambda error: None)
+
+
+def test_apply_async_rejects_unknown_operation(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(ValueError, match="unknown operation"):
+        store.apply_async([("merge", b"k", 1)])
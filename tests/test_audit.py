@@ -0,0 +1,177 @@
+import sqlite3
+import struct
+import time
+
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def _open(tmp_path, shared_library, audit=True):
+    options = {"backend": "sqlite", "audit": audit}
+    return SkyShelve(str(tmp_path / "audit.db"), lib_path=str(shared_library), options=options)
+
+
+@pytest.fixture
+def audited(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    yield store
+    store.close()
+
+
+def test_every_write_is_recorded(audited):
+    before = time.time()
+    audited.set("a", b"12345")
+    audited.set("b", "x")
+    audited.delete("a")
+    audited.apply([("set", b"c", b"1"), ("delete", b"b", None)])
+
+    records = audited.audit_scan()
+    assert [(seq, op, key) for seq, _, op, key, _, _, _ in records] == [
+        (1, "set", b"a"),
+        (2, "set", b"b"),
+        (3, "delete", b"a"),
+        (4, "set", b"c"),
+        (5, "delete", b"b"),
+    ]
+    seq, at, op, key, size, digest, actor = records[0]
+    assert before - 1 <= at <= time.time() + 1
+    assert size == len(b"\x0012345")
+    assert len(digest) == 32
+    assert actor is None
+    assert records[2][4] == 0
+    assert audited.get("c") == b"1"
+
+
+def test_transaction_writes_are_recorded(audited):
+    with audited.transaction() as txn:
+        txn.set("x", 1)
+        txn.delete("y")
+
+    assert [(op, key) for _, _, op, key, _, _, _ in audited.audit_scan()] == [("set", b"x"), ("delete", b"y")]
+
+
+def test_actor_tags_later_writes(audited):
+    audited.set("anonymous", 1)
+    audited.set_actor("alice@example.com")
+    audited.set("by-alice", 2)
+    audited.set_actor("deploy-bot")
+    audited.delete("anonymous")
+    audited.set_actor(None)
+    audited.set("anonymous-again", 3)
+
+    assert [(key, actor) for _, _, _, key, _, _, actor in audited.audit_scan()] == [
+        (b"anonymous", None),
+        (b"by-alice", "alice@example.com"),
+        (b"anonymous", "deploy-bot"),
+        (b"anonymous-again", None),
+    ]
+
+
+def test_scan_pages_through_the_log(audited):
+    for i in range(10):
+        audited.set(f"k{i}", i)
+
+    first = audited.audit_scan(0, 4)
+    assert [r[0] for r in first] == [1, 2, 3, 4]
+    rest = audited.audit_scan(first[-1][0], 100)
+    assert [r[0] for r in rest] == [5, 6, 7, 8, 9, 10]
+    assert audited.audit_scan(10) == []
+
+
+def test_identical_writes_share_a_digest(audited):
+    audited.set("k", "v")
+    audited.set("k", "v")
+    audited.set("k", "w")
+
+    digests = [r[5] for r in audited.audit_scan()]
+    assert digests[0] == digests[1]
+    assert digests[0] != digests[2]
+
+
+def test_log_survives_reopen(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    store.set("a", 1)
+    store.close()
+
+    store = _open(tmp_path, shared_library)
+    try:
+        store.set("b", 2)
+        assert [(r[0], r[3]) for r in store.audit_scan()] == [(1, b"a"), (2, b"b")]
+    finally:
+        store.close()
+
+
+def test_drop_all_leaves_a_record(audited):
+    audited.set("a", 1)
+    audited.set_actor("admin")
+    audited.drop_all()
+    audited.set("b", 2)
+
+    records = audited.audit_scan()
+    assert [(op, key, actor) for _, _, op, key, _, _, actor in records] == [
+        ("drop_all", b"", "admin"),
+        ("set", b"b", "admin"),
+    ]
+
+
+def test_tampering_breaks_the_chain(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    store.set("a", 1)
+    store.set("b", 2)
+    store.set("c", 3)
+    store.close()
+
+    audit_key = b"\xffaudit/" + struct.pack(">Q", 2)
+    with sqlite3.connect(str(tmp_path / "audit.db")) as conn:
+        (record,) = conn.execute("SELECT value FROM kv WHERE key = ?", (audit_key,)).fetchone()
+        record = bytes(record)
+        conn.execute("UPDATE kv SET value = ? WHERE key = ?", (record[:8] + b"\x01" + record[9:], audit_key))
+
+    store = _open(tmp_path, shared_library)
+    try:
+        with pytest.raises(SkyshelveError, match="audit record 2: audit log hash chain is broken"):
+            store.audit_scan()
+        assert [r[0] for r in store.audit_scan(2)] == [3]
+    finally:
+        store.close()
+
+
+def test_removed_record_breaks_the_chain(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    for key in ("a", "b", "c"):
+        store.set(key, 1)
+    store.close()
+
+    with sqlite3.connect(str(tmp_path / "audit.db")) as conn:
+        conn.execute("DELETE FROM kv WHERE key = ?", (b"\xffaudit/" + struct.pack(">Q", 2),))
+
+    store = _open(tmp_path, shared_library)
+    try:
+        with pytest.raises(SkyshelveError, match="hash chain is broken"):
+            store.audit_scan()
+    finally:
+        store.close()
+
+
+def test_store_without_audit_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+
+    with pytest.raises(SkyshelveError, match="not opened with audit"):
+        store.audit_scan()
+    with pytest.raises(SkyshelveError, match="not opened with audit"):
+        store.set_actor("alice")
+
+
+def test_negative_sequence_raises(audited):
+    with pytest.raises(SkyshelveError, match="invalid sequence -1"):
+        audited.audit_scan(-1)
+
+
+def test_scan_from_missing_record_raises(audited):
+    audited.set("a", 1)
+
+    with pytest.raises(SkyshelveError, match="audit record 5") as excinfo:
+        audited.audit_scan(5)
+    assert excinfo.value.code == ErrorCode.NOT_FOUND
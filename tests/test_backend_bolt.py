@@ -0,0 +1,52 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def bolt_path(tmp_path):
+    return f"bolt:{tmp_path / 'store.bolt'}"
+
+
+def test_bolt_round_trip_and_persistence(bolt_path, shared_library):
+    store = SkyShelve(bolt_path, lib_path=str(shared_library))
+    try:
+        store.set("b", {"n": 2})
+        store.set("a", "one")
+        store.set("c", b"three")
+        store.delete("c")
+        assert store.scan() == [(b"a", "one"), (b"b", {"n": 2})]
+    finally:
+        store.close()
+
+    reopened = SkyShelve(bolt_path, lib_path=str(shared_library))
+    try:
+        assert reopened.get("a") == "one"
+        assert "c" not in reopened
+    finally:
+        reopened.close()
+
+
+def test_bolt_batches_and_transactions(bolt_path, shared_library):
+    store = SkyShelve(bolt_path, lib_path=str(shared_library))
+    try:
+        store._apply([("set", b"x", 1), ("set", b"y", 2), ("delete", b"x", None)])
+        with store.transaction() as txn:
+            txn.set("z", 3)
+        assert store.scan() == [(b"y", 2), (b"z", 3)]
+        assert store.reverse_scan() == [(b"z", 3), (b"y", 2)]
+    finally:
+        store.close()
+
+
+def test_bolt_single_file(tmp_path, shared_library):
+    store = SkyShelve(f"bolt:{tmp_path / 'one.bolt'}", lib_path=str(shared_library))
+    store.set("k", "v")
+    store.close()
+
+    assert (tmp_path / "one.bolt").is_file()
+
+
+def test_bolt_rejects_directory_path(tmp_path, shared_library):
+    with pytest.raises(SkyshelveError):
+        SkyShelve(f"bolt:{tmp_path}", lib_path=str(shared_library))
@@ -0,0 +1,73 @@
+import json
+import subprocess
+import sys
+from pathlib import Path
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+SRC_ROOT = Path(__file__).resolve().parents[1] / "src"
+
+
+def test_lmdb_round_trip_and_persistence(tmp_path, shared_library):
+    path = f"lmdb:{tmp_path / 'env'}"
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        store.set("a", "one")
+        store.set("b", {"n": 2})
+        with store.transaction() as txn:
+            txn.delete("a")
+            txn.set("c", b"three")
+    finally:
+        store.close()
+
+    reopened = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        assert reopened.scan() == [(b"b", {"n": 2}), (b"c", b"three")]
+    finally:
+        reopened.close()
+
+
+def test_lmdb_other_process_reads_while_open(tmp_path, shared_library):
+    path = f"lmdb:{tmp_path / 'env'}"
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        store.set("shared", "visible")
+        script = (
+            "import sys; sys.path.insert(0, sys.argv[1]);"
+            "from skyshelve import SkyShelve;"
+            "s = SkyShelve(sys.argv[2], lib_path=sys.argv[3]);"
+            "print(s.get('shared')); s.close()"
+        )
+        result = subprocess.run(
+            [sys.executable, "-c", script, str(SRC_ROOT), path, str(shared_library)],
+            capture_output=True,
+            text=True,
+            timeout=60,
+        )
+    finally:
+        store.close()
+
+    assert result.returncode == 0, result.stderr
+    assert result.stdout.strip() == "visible"
+
+
+def test_lmdb_json_config(tmp_path, shared_library):
+    config = json.dumps({"path": str(tmp_path / "env"), "map_size": 1 << 20})
+    store = SkyShelve(f"lmdb:{config}", lib_path=str(shared_library))
+    try:
+        with pytest.raises(SkyshelveError):
+            for i in range(64):
+                store.set(f"k{i}", b"x" * 65536)
+    finally:
+        store.close()
+
+
+def test_lmdb_rejects_oversized_keys(tmp_path, shared_library):
+    store = SkyShelve(f"lmdb:{tmp_path / 'env'}", lib_path=str(shared_library))
+    try:
+        with pytest.raises(SkyshelveError):
+            store.set("k" * 600, 1)
+    finally:
+        store.close()
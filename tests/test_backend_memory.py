@@ -0,0 +1,53 @@
+import os
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def memory_store(shared_library):
+    store = SkyShelve("memory:", lib_path=str(shared_library))
+    yield store
+    store.close()
+
+
+def test_memory_backend_orders_keys(memory_store):
+    for key in (b"b", b"a\xff", b"a", b"c"):
+        memory_store.set(key, key)
+
+    assert [k for k, _ in memory_store.scan()] == [b"a", b"a\xff", b"b", b"c"]
+    assert memory_store.range_scan("a\xff", "c") == [(b"a\xff", b"a\xff"), (b"b", b"b")]
+    assert memory_store.count() == 4
+
+
+def test_memory_backend_transactions(memory_store):
+    memory_store.set("k", 1)
+    with memory_store.transaction() as txn:
+        txn.set("k", txn.get("k") + 1)
+        txn.delete("gone")
+
+    assert memory_store.get("k") == 2
+
+
+def test_memory_backend_is_private_to_each_handle(shared_library, tmp_path):
+    cwd = os.getcwd()
+    os.chdir(tmp_path)
+    try:
+        first = SkyShelve("memory:", lib_path=str(shared_library))
+        second = SkyShelve("memory:", lib_path=str(shared_library))
+        try:
+            first.set("k", "first")
+            assert second.get("k") is None
+        finally:
+            first.close()
+            second.close()
+        assert os.listdir(tmp_path) == []
+    finally:
+        os.chdir(cwd)
+
+
+def test_memory_backend_rejects_ttl(memory_store):
+    with pytest.raises(SkyshelveError):
+        memory_store.set("k", 1, ttl=5)
+    assert "k" not in memory_store
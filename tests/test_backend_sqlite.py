@@ -0,0 +1,68 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def sqlite_path(tmp_path):
+    return f"sqlite:{tmp_path / 'store.db'}"
+
+
+def test_sqlite_round_trip_and_persistence(sqlite_path, shared_library):
+    store = SkyShelve(sqlite_path, lib_path=str(shared_library))
+    try:
+        store.set("b", {"n": 2})
+        store.set("a", "one")
+        store.set("c", b"three")
+        store.delete("c")
+        assert store.scan() == [(b"a", "one"), (b"b", {"n": 2})]
+    finally:
+        store.close()
+
+    reopened = SkyShelve(sqlite_path, lib_path=str(shared_library))
+    try:
+        assert reopened.get("a") == "one"
+        assert "c" not in reopened
+    finally:
+        reopened.close()
+
+
+def test_sqlite_batches_and_transactions(sqlite_path, shared_library):
+    store = SkyShelve(sqlite_path, lib_path=str(shared_library))
+    try:
+        store._apply([("set", b"x", 1), ("set", b"y", 2), ("delete", b"x", None)])
+        with store.transaction() as txn:
+            txn.set("z", 3)
+        assert store.scan() == [(b"y", 2), (b"z", 3)]
+        assert store.reverse_scan() == [(b"z", 3), (b"y", 2)]
+    finally:
+        store.close()
+
+
+def test_sqlite_single_file(tmp_path, shared_library):
+    store = SkyShelve(f"sqlite:{tmp_path / 'one.db'}", lib_path=str(shared_library))
+    store.set("k", "v")
+    store.close()
+
+    assert (tmp_path / "one.db").is_file()
+
+
+def test_sqlite_file_is_plain_sqlite(tmp_path, shared_library):
+    import sqlite3
+
+    path = tmp_path / "inspect.db"
+    store = SkyShelve(f"sqlite:{path}", lib_path=str(shared_library))
+    try:
+        store.set("k", b"v")
+        store.sync()
+        with sqlite3.connect(str(path)) as conn:
+            rows = conn.execute("SELECT key, value FROM kv").fetchall()
+    finally:
+        store.close()
+
+    assert rows == [(b"k", b"\x00v")]
+
+
+def test_sqlite_rejects_directory_path(tmp_path, shared_library):
+    with pytest.raises(SkyshelveError):
+        SkyShelve(f"sqlite:{tmp_path}", lib_path=str(shared_library))
@@ -0,0 +1,46 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_list_backends(shared_library):
+    backends = SkyShelve.list_backends(lib_path=str(shared_library))
+
+    assert backends == sorted(backends)
+    for scheme in ("badger", "bolt", "lmdb", "memory", "slatedb", "sqlite"):
+        assert scheme in backends
+
+
+def test_every_local_backend_opens(tmp_path, shared_library):
+    paths = {
+        "badger": f"badger:{tmp_path / 'badger'}",
+        "bolt": f"bolt:{tmp_path / 'x.bolt'}",
+        "sqlite": f"sqlite:{tmp_path / 'x.db'}",
+        "lmdb": f"lmdb:{tmp_path / 'lmdb'}",
+        "memory": "memory:",
+    }
+    for scheme, path in paths.items():
+        store = SkyShelve(path, lib_path=str(shared_library))
+        try:
+            store.set("scheme", scheme)
+            assert store.get("scheme") == scheme
+        finally:
+            store.close()
+
+
+def test_plain_paths_open_badger(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "plain"), lib_path=str(shared_library))
+    try:
+        assert store.stats()["backend"] == "badger"
+    finally:
+        store.close()
+
+
+def test_scheme_lookup_is_case_insensitive(shared_library):
+    store = SkyShelve("MEMORY:", lib_path=str(shared_library))
+    store.close()
+
+
+def test_options_reject_unknown_backend(shared_library):
+    with pytest.raises(SkyshelveError):
+        SkyShelve(None, lib_path=str(shared_library), options={"backend": "cassandra"})
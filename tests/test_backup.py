@@ -0,0 +1,73 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_backup_and_restore_round_trip(tmp_path, shared_library):
+    source = SkyShelve(str(tmp_path / "src"), lib_path=str(shared_library))
+    try:
+        for i in range(20):
+            source.set(f"k{i:02d}", {"n": i})
+        source.backup(tmp_path / "full.bak")
+    finally:
+        source.close()
+
+    SkyShelve.restore(str(tmp_path / "dst"), tmp_path / "full.bak", lib_path=str(shared_library))
+
+    restored = SkyShelve(str(tmp_path / "dst"), lib_path=str(shared_library))
+    try:
+        assert restored.scan() == [(f"k{i:02d}".encode(), {"n": i}) for i in range(20)]
+    finally:
+        restored.close()
+
+
+def test_restore_into_keeps_existing_keys(tmp_path, skyshelve_factory):
+    source = skyshelve_factory(in_memory=True)
+    source.set("a", 1)
+    source.backup(tmp_path / "a.bak")
+
+    target = skyshelve_factory()
+    target.set("b", 2)
+    target.restore_into(tmp_path / "a.bak")
+
+    assert target.scan() == [(b"a", 1), (b"b", 2)]
+
+
+def test_backup_keeps_ttl(tmp_path, skyshelve_factory):
+    import time
+
+    source = skyshelve_factory(in_memory=True)
+    source.set("short", "lived", ttl=1)
+    source.backup(tmp_path / "ttl.bak")
+
+    target = skyshelve_factory()
+    target.restore_into(tmp_path / "ttl.bak")
+    time.sleep(2.2)
+    assert target.get("short") is None
+
+
+def test_backup_from_memory_backend(tmp_path, shared_library):
+    source = SkyShelve(None, lib_path=str(shared_library), options={"backend": "memory"})
+    try:
+        source.set("k", "v")
+        source.backup(tmp_path / "mem.dump")
+    finally:
+        source.close()
+
+    target = SkyShelve(None, in_memory=True, lib_path=str(shared_library))
+    try:
+        target.restore_into(tmp_path / "mem.dump")
+        assert target.get("k") == "v"
+    finally:
+        target.close()
+
+
+def test_backup_errors(tmp_path, skyshelve_factory, shared_library):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(SkyshelveError):
+        store.restore_into(tmp_path / "missing.bak")
+    with pytest.raises(SkyshelveError):
+        store.backup(tmp_path / "no-such-dir" / "x.bak")
+    with pytest.raises(SkyshelveError):
+        SkyShelve.restore(str(tmp_path / "dst"), tmp_path / "missing.bak", lib_path=str(shared_library))
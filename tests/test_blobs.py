@@ -0,0 +1,176 @@
+import os
+
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+# Blobs are stored in 256 KiB chunks; this spans several and ends mid-chunk.
+LARGE = os.urandom(3 * 256 * 1024 + 12345)
+
+
+def test_put_and_get_round_trip(skyshelve_factory):
+    store = skyshelve_factory()
+    store.blob_put("video", LARGE)
+    store.blob_put("small", b"tiny")
+
+    assert store.blob_get("video") == LARGE
+    assert store.blob_get("small") == b"tiny"
+
+
+def test_empty_blob(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.blob_put("empty", b"")
+
+    assert store.blob_get("empty") == b""
+    with store.blob_open("empty") as reader:
+        assert reader.size == 0
+        assert reader.read() == b""
+
+
+def test_blobs_have_their_own_keyspace(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("name", "plain value")
+    store.blob_put("name", b"blob value")
+
+    assert store.get("name") == "plain value"
+    assert store.blob_get("name") == b"blob value"
+    assert store.scan() == [(b"name", "plain value")]
+    store.delete("name")
+    assert store.blob_get("name") == b"blob value"
+
+
+def test_missing_blob(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.blob_get("missing") is None
+    assert store.blob_get("missing", b"fallback") == b"fallback"
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.blob_open("missing")
+    assert excinfo.value.code == ErrorCode.NOT_FOUND
+
+
+def test_put_replaces_and_delete_removes(skyshelve_factory):
+    store = skyshelve_factory()
+    store.blob_put("k", LARGE)
+    store.blob_put("k", b"replacement")
+    assert store.blob_get("k") == b"replacement"
+
+    store.blob_delete("k")
+    assert store.blob_get("k") is None
+    store.blob_delete("k")
+
+
+def test_streaming_write(skyshelve_factory):
+    store = skyshelve_factory()
+    with store.blob_create("stream") as writer:
+        for start in range(0, len(LARGE), 100_000):
+            writer.write(memoryview(LARGE)[start : start + 100_000])
+        assert store.blob_get("stream") is None
+
+    assert store.blob_get("stream") == LARGE
+
+
+def test_abort_keeps_the_earlier_blob(skyshelve_factory):
+    store = skyshelve_factory()
+    store.blob_put("k", b"original")
+
+    writer = store.blob_create("k")
+    writer.write(LARGE)
+    writer.abort()
+    assert store.blob_get("k") == b"original"
+
+    with pytest.raises(RuntimeError):
+        with store.blob_create("k") as writer:
+            writer.write(b"half written")
+            raise RuntimeError("host failure")
+    assert store.blob_get("k") == b"original"
+
+
+def test_finished_writer_cannot_be_reused(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    writer = store.blob_create("k")
+    writer.write(b"data")
+    writer.commit()
+
+    with pytest.raises(SkyshelveError, match="already finished") as excinfo:
+        writer.write(b"more")
+    assert excinfo.value.code == ErrorCode.INVALID_HANDLE
+    writer.abort()
+
+
+def test_later_writer_wins_whichever_commits_first(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    first = store.blob_create("k")
+    second = store.blob_create("k")
+    first.write(b"first")
+    second.write(b"second")
+    second.commit()
+
+    with pytest.raises(SkyshelveError, match="written later was committed first") as excinfo:
+        first.commit()
+    assert excinfo.value.code == ErrorCode.CONFLICT
+    assert store.blob_get("k") == b"second"
+
+
+def test_streaming_read(skyshelve_factory):
+    store = skyshelve_factory()
+    store.blob_put("k", LARGE)
+
+    with store.blob_open("k") as reader:
+        assert reader.size == len(LARGE)
+        head = reader.read(1000)
+        middle = reader.read(300_000)
+        rest = reader.read()
+        assert reader.read(10) == b""
+    assert head + middle + rest == LARGE
+    assert len(middle) == 300_000
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        reader.read()
+
+
+def test_reader_fails_when_blob_is_replaced(skyshelve_factory):
+    store = skyshelve_factory()
+    store.blob_put("k", LARGE)
+
+    with store.blob_open("k") as reader:
+        assert reader.read(10) == LARGE[:10]
+        store.blob_put("k", b"new")
+        with pytest.raises(SkyshelveError, match="overwritten or deleted while being read") as excinfo:
+            reader.read()
+        assert excinfo.value.code == ErrorCode.CONFLICT
+
+
+def test_blob_writes_through_snapshot_are_rejected(skyshelve_factory):
+    store = skyshelve_factory()
+    store.blob_put("k", b"data")
+    snap = store.snapshot()
+    try:
+        assert snap.blob_get("k") == b"data"
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.blob_put("k", b"other")
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.blob_create("k")
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.blob_delete("k")
+    finally:
+        snap.close()
+
+
+def test_closing_the_store_aborts_open_writers(tmp_path, shared_library):
+    path = str(tmp_path / "blobs")
+    store = SkyShelve(path, lib_path=str(shared_library))
+    store.blob_put("done", b"kept")
+    store.blob_put("reading", b"data")
+    writer = store.blob_create("pending")
+    writer.write(LARGE)
+    reader = store.blob_open("reading")
+    store.close()
+    reader.close()
+
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        assert store.blob_get("done") == b"kept"
+        assert store.blob_get("pending") is None
+    finally:
+        store.close()
@@ -0,0 +1,84 @@
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def test_max_keys_quota(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set_bucket_quota("tenant", max_keys=2)
+
+    with store.bucket("tenant") as bucket:
+        bucket.set("a", 1)
+        bucket.set("b", 2)
+        bucket.set("a", "overwrite is fine")
+        with pytest.raises(SkyshelveError, match='bucket "tenant" quota exceeded: key limit is 2') as excinfo:
+            bucket.set("c", 3)
+        assert excinfo.value.code == ErrorCode.QUOTA
+        assert "c" not in bucket
+
+        bucket.delete("a")
+        bucket.set("c", 3)
+
+
+def test_max_bytes_quota(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set_bucket_quota("tenant", max_bytes=100)
+
+    with store.bucket("tenant") as bucket:
+        bucket.set("k", b"x" * 50)
+        with pytest.raises(SkyshelveError) as excinfo:
+            bucket.set("k2", b"x" * 60)
+        assert excinfo.value.code == ErrorCode.QUOTA
+        bucket.set("k", b"x" * 10)
+
+
+def test_batch_over_quota_is_rejected_atomically(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set_bucket_quota("tenant", max_keys=2)
+
+    with store.bucket("tenant") as bucket:
+        with pytest.raises(SkyshelveError) as excinfo:
+            bucket._apply([("set", b"a", 1), ("set", b"b", 2), ("set", b"c", 3)])
+        assert excinfo.value.code == ErrorCode.QUOTA
+        assert bucket.count() == 0
+
+
+def test_lowered_quota_still_allows_cleanup(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    with store.bucket("tenant") as bucket:
+        for i in range(5):
+            bucket.set(f"k{i}", i)
+
+        store.set_bucket_quota("tenant", max_keys=2)
+
+        with pytest.raises(SkyshelveError):
+            bucket.set("new", 1)
+        bucket.delete("k0")
+        bucket.set("k1", "overwriting adds no key")
+
+
+def test_bucket_stats_and_persisted_quota(tmp_path, shared_library):
+    path = str(tmp_path / "db")
+    store = SkyShelve(path, lib_path=str(shared_library))
+    store.set_bucket_quota("tenant", max_keys=10, max_bytes=1000)
+    with store.bucket("tenant") as bucket:
+        bucket.set("ab", b"xyz")
+    store.close()
+
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        stats = store.bucket_stats("tenant")
+        assert stats == {"name": "tenant", "keys": 1, "bytes": stats["bytes"], "max_keys": 10, "max_bytes": 1000}
+        assert stats["bytes"] >= len("ab") + len(b"xyz")
+    finally:
+        store.close()
+
+
+def test_quota_errors(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(SkyshelveError, match="must not be negative"):
+        store.set_bucket_quota("tenant", max_keys=-1)
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.bucket_stats("missing")
+    assert excinfo.value.code == ErrorCode.NOT_FOUND
@@ -0,0 +1,85 @@
+import pytest
+
+from skyshelve import Bucket, ErrorCode, SkyShelve, SkyshelveError
+
+
+def test_buckets_are_separate_keyspaces(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", "root")
+
+    with store.bucket("users") as users, store.bucket("orders") as orders:
+        assert isinstance(users, Bucket)
+        users.set("k", "user")
+        users.set("k2", {"n": 2})
+        orders.set("k", "order")
+
+        assert store.get("k") == "root"
+        assert users.get("k") == "user"
+        assert orders.get("k") == "order"
+        assert users.scan() == [(b"k", "user"), (b"k2", {"n": 2})]
+        assert users.count() == 2
+        assert "k2" not in orders
+
+    assert store.list_buckets() == ["orders", "users"]
+    assert store.get("k") == "root"
+
+
+def test_bucket_data_persists_and_reopens(tmp_path, shared_library):
+    path = str(tmp_path / "db")
+    store = SkyShelve(path, lib_path=str(shared_library))
+    bucket = store.bucket("b")
+    bucket.set("k", "v")
+    store.close()
+    bucket.close()
+
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        assert store.list_buckets() == ["b"]
+        with store.bucket("b") as bucket:
+            assert bucket.get("k") == "v"
+    finally:
+        store.close()
+
+
+def test_nested_buckets(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with store.bucket("outer") as outer, outer.bucket("inner") as inner:
+        inner.set("k", 1)
+        assert outer.list_buckets() == ["inner"]
+        assert outer.get("k") is None
+        assert inner.get("k") == 1
+
+
+def test_delete_bucket(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    bucket = store.bucket("tmp")
+    bucket.set("k", "v")
+
+    store.delete_bucket("tmp")
+
+    assert store.list_buckets() == []
+    assert bucket.get("k") is None
+    assert store.count() == 0
+
+
+def test_closing_parent_closes_buckets(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    bucket = store.bucket("b")
+
+    store.close()
+
+    assert not bucket.is_open()
+    with pytest.raises(SkyshelveError) as excinfo:
+        bucket.get("k")
+    assert excinfo.value.code == ErrorCode.INVALID_HANDLE
+    bucket.close()
+
+
+def test_empty_bucket_name_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(SkyshelveError, match="bucket name must not be empty"):
+        store.bucket("")
+    with pytest.raises(SkyshelveError, match="bucket name must not be empty"):
+        store.delete_bucket("")
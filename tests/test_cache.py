@@ -0,0 +1,129 @@
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _cached_store(tmp_path, shared_library, **cache):
+    cache.setdefault("max_bytes", 1 << 20)
+    return SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"cache": cache})
+
+
+def _wait_for_hit(store, key, section="value_cache", timeout=5.0):
+    # Ristretto admits entries asynchronously, so the first reads may miss.
+    deadline = time.monotonic() + timeout
+    while time.monotonic() < deadline:
+        store.get(key)
+        if store.stats()[section]["hits"] > 0:
+            return True
+        time.sleep(0.01)
+    return False
+
+
+@pytest.fixture
+def cached(tmp_path, shared_library):
+    store = _cached_store(tmp_path, shared_library)
+    try:
+        yield store
+    finally:
+        store.close()
+
+
+def test_repeated_reads_hit_the_cache(cached):
+    cached.set("k", {"v": 1})
+
+    assert _wait_for_hit(cached, "k")
+    stats = cached.stats()["value_cache"]
+    assert stats["misses"] >= 1
+    assert 0 < stats["hit_ratio"] <= 1
+    assert cached.get("k") == {"v": 1}
+
+
+@pytest.mark.parametrize(
+    "write",
+    [
+        lambda store: store.set("k", "new"),
+        lambda store: store.apply([("set", b"k", "new")]),
+        lambda store: store.compare_and_swap("k", "old", "new"),
+        lambda store: store.get_set("k", "new"),
+    ],
+)
+def test_writes_invalidate_cached_values(cached, write):
+    cached.set("k", "old")
+    assert _wait_for_hit(cached, "k")
+
+    write(cached)
+
+    assert cached.get("k") == "new"
+
+
+@pytest.mark.parametrize(
+    "remove",
+    [
+        lambda store: store.delete("k"),
+        lambda store: store.delete_range("a", "z"),
+        lambda store: store.delete_prefix("k"),
+        lambda store: store.drop_all(),
+    ],
+)
+def test_removals_invalidate_cached_values(cached, remove):
+    cached.set("k", "v")
+    assert _wait_for_hit(cached, "k")
+
+    remove(cached)
+
+    assert cached.get("k") is None
+    assert "k" not in cached
+
+
+def test_transaction_commit_invalidates_cached_values(cached):
+    cached.set("k", "old")
+    assert _wait_for_hit(cached, "k")
+
+    with cached.transaction() as txn:
+        txn.set("k", "new")
+
+    assert cached.get("k") == "new"
+
+
+def test_max_age_bounds_staleness(tmp_path, shared_library):
+    store = _cached_store(tmp_path, shared_library, max_age="50ms")
+    try:
+        store.set("k", "v")
+        assert _wait_for_hit(store, "k")
+        time.sleep(0.2)
+        hits = store.stats()["value_cache"]["hits"]
+        store.get("k")
+        assert store.stats()["value_cache"]["hits"] == hits
+    finally:
+        store.close()
+
+
+def test_cached_values_expire_with_their_ttl(cached):
+    # Badger rounds expiry down to the second, so leave time for the hit.
+    cached.set("k", "v", ttl=3)
+    assert _wait_for_hit(cached, "k")
+
+    time.sleep(3.1)
+
+    assert cached.get("k") is None
+    assert "k" not in cached
+
+
+def test_uncached_stores_report_no_cache(skyshelve_factory):
+    store = skyshelve_factory()
+    assert "value_cache" not in store.stats()
+
+
+@pytest.mark.parametrize(
+    "cache, message",
+    [
+        ({"max_bytes": 0}, "needs max_bytes or max_missing"),
+        ({"max_bytes": -1}, "must not be negative"),
+        ({"max_age": "soon"}, "invalid cache max_age"),
+    ],
+)
+def test_invalid_cache_options_are_rejected(tmp_path, shared_library, cache, message):
+    with pytest.raises(SkyshelveError, match=message):
+        _cached_store(tmp_path, shared_library, **cache)
@@ -0,0 +1,139 @@
+import base64
+import json
+import threading
+from http.server import BaseHTTPRequestHandler, HTTPServer
+
+import pytest
+
+from conftest import wait_for
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _read_events(path):
+    if not path.exists():
+        return []
+    return [json.loads(line) for line in path.read_text().splitlines()]
+
+
+def test_file_sink_receives_every_write(tmp_path, shared_library):
+    sink = tmp_path / "changes.ndjson"
+    store = SkyShelve(
+        str(tmp_path / "db"),
+        lib_path=str(shared_library),
+        options={"cdc": {"file": str(sink), "interval": "50ms"}},
+    )
+    try:
+        store.set("a", b"one")
+        store.delete("a")
+        store.set("b", b"two", ttl=30)
+        assert wait_for(lambda: len(_read_events(sink)) == 3)
+    finally:
+        store.close()
+
+    events = _read_events(sink)
+    assert [event["op"] for event in events] == ["set", "delete", "set"]
+    assert [base64.b64decode(event["key"]) for event in events] == [b"a", b"a", b"b"]
+    assert events[1].get("value") is None
+    assert events[2]["ttl"] == 30
+    assert [event["seq"] for event in events] == sorted(event["seq"] for event in events)
+
+
+def test_file_sink_resumes_without_duplicates(tmp_path, shared_library):
+    sink = tmp_path / "changes.ndjson"
+    path = str(tmp_path / "db")
+    options = {"cdc": {"file": str(sink), "interval": "50ms"}}
+
+    store = SkyShelve(path, lib_path=str(shared_library), options=options)
+    store.set("a", 1)
+    store.close()
+    assert len(_read_events(sink)) == 1
+
+    store = SkyShelve(path, lib_path=str(shared_library), options=options)
+    try:
+        store.set("b", 2)
+        assert wait_for(lambda: len(_read_events(sink)) == 2)
+    finally:
+        store.close()
+    assert [base64.b64decode(event["key"]) for event in _read_events(sink)] == [b"a", b"b"]
+
+
+class _Collector(BaseHTTPRequestHandler):
+    def do_POST(self):
+        body = self.rfile.read(int(self.headers["Content-Length"]))
+        self.server.requests.append((dict(self.headers), body))
+        self.send_response(self.server.status)
+        self.end_headers()
+
+    def log_message(self, *args):
+        pass
+
+
+@pytest.fixture
+def webhook():
+    server = HTTPServer(("127.0.0.1", 0), _Collector)
+    server.requests = []
+    server.status = 200
+    thread = threading.Thread(target=server.serve_forever, daemon=True)
+    thread.start()
+    try:
+        yield server
+    finally:
+        server.shutdown()
+        server.server_close()
+
+
+def test_webhook_receives_ndjson_batches(tmp_path, shared_library, webhook):
+    url = f"http://127.0.0.1:{webhook.server_port}/changes"
+    store = SkyShelve(
+        str(tmp_path / "db"),
+        lib_path=str(shared_library),
+        options={"cdc": {"webhook": url, "headers": {"Authorization": "Bearer t"}, "interval": "50ms"}},
+    )
+    try:
+        store.set("k", b"v")
+        assert wait_for(lambda: webhook.requests)
+    finally:
+        store.close()
+
+    headers, body = webhook.requests[0]
+    assert headers["Content-Type"] == "application/x-ndjson"
+    assert headers["Authorization"] == "Bearer t"
+    event = json.loads(body.splitlines()[0])
+    assert event["op"] == "set"
+    assert base64.b64decode(event["key"]) == b"k"
+
+
+def test_webhook_failures_are_retried(tmp_path, shared_library, webhook):
+    webhook.status = 500
+    url = f"http://127.0.0.1:{webhook.server_port}/"
+    store = SkyShelve(
+        str(tmp_path / "db"),
+        lib_path=str(shared_library),
+        options={"cdc": {"webhook": url, "interval": "50ms", "max_retries": 2}},
+    )
+    try:
+        store.set("k", 1)
+        assert wait_for(lambda: len(webhook.requests) >= 2)
+        webhook.status = 200
+        count = len(webhook.requests)
+        assert wait_for(lambda: len(webhook.requests) > count)
+    finally:
+        store.close()
+
+
+@pytest.mark.parametrize(
+    "cdc, message",
+    [
+        ({}, "needs a webhook, file, kafka or nats sink"),
+        ({"webhook": "ftp://example.com"}, "invalid cdc webhook"),
+        ({"file": "x", "batch_size": -1}, "batch_size must be positive"),
+        ({"file": "x", "max_retries": -1}, "max_retries must not be negative"),
+        ({"file": "x", "interval": "soon"}, "invalid cdc interval"),
+        ({"file": "x", "interval": "-1s"}, "interval must be positive"),
+    ],
+)
+def test_invalid_cdc_options_are_rejected(tmp_path, shared_library, cdc, message):
+    if "file" in cdc:
+        cdc = dict(cdc, file=str(tmp_path / cdc["file"]))
+    with pytest.raises(SkyshelveError, match=message):
+        SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"cdc": cdc})
@@ -0,0 +1,144 @@
+import base64
+import json
+import socket
+import threading
+from http.server import BaseHTTPRequestHandler, HTTPServer
+
+import pytest
+
+from conftest import wait_for
+from skyshelve import SkyShelve, SkyshelveError
+
+
+class _RestProxy(BaseHTTPRequestHandler):
+    def do_POST(self):
+        body = json.loads(self.rfile.read(int(self.headers["Content-Length"])))
+        self.server.requests.append((self.path, dict(self.headers), body))
+        offsets = [{"partition": 0, "offset": i} for i in range(len(body["records"]))]
+        reply = json.dumps({"offsets": offsets}).encode()
+        self.send_response(200)
+        self.send_header("Content-Type", "application/vnd.kafka.v2+json")
+        self.send_header("Content-Length", str(len(reply)))
+        self.end_headers()
+        self.wfile.write(reply)
+
+    def log_message(self, *args):
+        pass
+
+
+@pytest.fixture
+def rest_proxy():
+    server = HTTPServer(("127.0.0.1", 0), _RestProxy)
+    server.requests = []
+    thread = threading.Thread(target=server.serve_forever, daemon=True)
+    thread.start()
+    try:
+        yield server
+    finally:
+        server.shutdown()
+        server.server_close()
+
+
+def test_kafka_publishes_one_record_per_change(tmp_path, shared_library, rest_proxy):
+    kafka = {"rest_proxy": f"http://127.0.0.1:{rest_proxy.server_port}", "topic": "changes"}
+    store = SkyShelve(
+        str(tmp_path / "db"),
+        lib_path=str(shared_library),
+        options={"cdc": {"kafka": kafka, "interval": "50ms"}},
+    )
+    try:
+        store.set("a", b"one")
+        store.delete("a")
+        assert wait_for(lambda: sum(len(body["records"]) for _, _, body in rest_proxy.requests) == 2)
+    finally:
+        store.close()
+
+    path, headers, _ = rest_proxy.requests[0]
+    assert path == "/topics/changes"
+    assert headers["Content-Type"] == "application/vnd.kafka.binary.v2+json"
+    records = [record for _, _, body in rest_proxy.requests for record in body["records"]]
+    assert [base64.b64decode(record["key"]) for record in records] == [b"a", b"a"]
+    events = [json.loads(base64.b64decode(record["value"])) for record in records]
+    assert [event["op"] for event in events] == ["set", "delete"]
+    assert events[0]["seq"] < events[1]["seq"]
+
+
+class _FakeNATS:
+    """Speaks just enough of the NATS client protocol to collect PUBs."""
+
+    def __init__(self):
+        self.sock = socket.socket()
+        self.sock.bind(("127.0.0.1", 0))
+        self.sock.listen()
+        self.port = self.sock.getsockname()[1]
+        self.connects = []
+        self.messages = []
+        self.thread = threading.Thread(target=self._serve, daemon=True)
+        self.thread.start()
+
+    def _serve(self):
+        while True:
+            try:
+                conn, _ = self.sock.accept()
+            except OSError:
+                return
+            threading.Thread(target=self._handle, args=(conn,), daemon=True).start()
+
+    def _handle(self, conn):
+        with conn:
+            conn.sendall(b'INFO {"server_id":"fake"}\r\n')
+            stream = conn.makefile("rb")
+            for line in stream:
+                if line.startswith(b"CONNECT "):
+                    self.connects.append(json.loads(line[len(b"CONNECT ") :]))
+                elif line.startswith(b"PUB "):
+                    _, subject, size = line.split()
+                    payload = stream.read(int(size) + 2)[:-2]
+                    self.messages.append((subject.decode(), json.loads(payload)))
+                elif line.strip() == b"PING":
+                    conn.sendall(b"PONG\r\n")
+
+    def close(self):
+        self.sock.close()
+
+
+@pytest.fixture
+def nats_server():
+    server = _FakeNATS()
+    try:
+        yield server
+    finally:
+        server.close()
+
+
+def test_nats_publishes_one_message_per_change(tmp_path, shared_library, nats_server):
+    nats = {"url": f"nats://127.0.0.1:{nats_server.port}", "subject": "skyshelve.changes", "token": "secret"}
+    store = SkyShelve(
+        str(tmp_path / "db"),
+        lib_path=str(shared_library),
+        options={"cdc": {"nats": nats, "interval": "50ms"}},
+    )
+    try:
+        store.set("k", b"v")
+        store.set("k", b"w")
+        assert wait_for(lambda: len(nats_server.messages) == 2)
+    finally:
+        store.close()
+
+    assert nats_server.connects[0]["auth_token"] == "secret"
+    assert {subject for subject, _ in nats_server.messages} == {"skyshelve.changes"}
+    assert [base64.b64decode(event["value"]) for _, event in nats_server.messages] == [b"\x00v", b"\x00w"]
+
+
+@pytest.mark.parametrize(
+    "cdc, message",
+    [
+        ({"kafka": {"rest_proxy": "localhost:8082", "topic": "t"}}, "invalid kafka rest_proxy"),
+        ({"kafka": {"rest_proxy": "http://localhost:8082", "topic": ""}}, "kafka topic must not be empty"),
+        ({"nats": {"url": "http://localhost", "subject": "s"}}, "invalid nats url"),
+        ({"nats": {"url": "nats://localhost", "subject": "bad subject"}}, "invalid nats subject"),
+    ],
+)
+def test_invalid_broker_options_are_rejected(tmp_path, shared_library, cdc, message):
+    with pytest.raises(SkyshelveError, match=message):
+        SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"cdc": cdc})
@@ -0,0 +1,120 @@
+import time
+
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def logged_store(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"change_log": True})
+    try:
+        yield store
+    finally:
+        store.close()
+
+
+def test_changes_replay_in_commit_order(logged_store):
+    assert logged_store.last_sequence() == 0
+    before = time.time()
+
+    first = logged_store.set_seq("a", {"v": 1})
+    second = logged_store.delete_seq("a")
+    last = logged_store.apply_seq([("set", b"b", "two"), ("set", b"c", b"three")])
+
+    assert first < second < last
+    assert logged_store.last_sequence() == last
+    changes = logged_store.changes_since(0)
+    assert [change[0] for change in changes] == sorted(change[0] for change in changes)
+    assert [(op, key, value) for _, _, op, key, value, _ in changes] == [
+        ("set", b"a", {"v": 1}),
+        ("delete", b"a", None),
+        ("set", b"b", "two"),
+        ("set", b"c", b"three"),
+    ]
+    assert changes[-1][0] == last
+    assert all(change[1] >= before - 1 for change in changes)
+    assert logged_store.changes_since(last) == []
+
+
+def test_changes_since_pages_with_max_changes(logged_store):
+    for i in range(5):
+        logged_store.set_seq(f"k{i}", i)
+
+    page = logged_store.changes_since(0, max_changes=2)
+    assert [key for _, _, _, key, _, _ in page] == [b"k0", b"k1"]
+    rest = logged_store.changes_since(page[-1][0])
+    assert [key for _, _, _, key, _, _ in rest] == [b"k2", b"k3", b"k4"]
+
+
+def test_ttl_writes_carry_their_ttl(logged_store):
+    logged_store.set("k", "v", ttl=60)
+
+    (change,) = logged_store.changes_since(0)
+    assert change[2:] == ("set", b"k", "v", 60)
+
+
+def test_trim_changes_forces_a_resync(logged_store):
+    seqs = [logged_store.set_seq(f"k{i}", i) for i in range(3)]
+
+    assert logged_store.trim_changes(seqs[1]) == 2
+    assert [change[0] for change in logged_store.changes_since(seqs[1])] == [seqs[2]]
+    with pytest.raises(SkyshelveError, match="trimmed"):
+        logged_store.changes_since(0)
+
+
+def test_trim_keeps_the_newest_change(logged_store):
+    last = logged_store.set_seq("k", 1)
+
+    assert logged_store.trim_changes(last) == 0
+    assert logged_store.last_sequence() == last
+
+
+def test_drop_all_forces_a_resync(logged_store):
+    seq = logged_store.set_seq("k", 1)
+    logged_store.drop_all()
+
+    with pytest.raises(SkyshelveError, match="trimmed"):
+        logged_store.changes_since(seq)
+
+
+def test_sequence_numbers_survive_reopen(tmp_path, shared_library):
+    path = str(tmp_path / "db")
+    store = SkyShelve(path, lib_path=str(shared_library), options={"change_log": True})
+    last = store.set_seq("k", 1)
+    store.close()
+
+    store = SkyShelve(path, lib_path=str(shared_library), options={"change_log": True})
+    try:
+        assert store.last_sequence() == last
+        assert store.set_seq("k", 2) > last
+    finally:
+        store.close()
+
+
+def test_invalid_sequence_is_rejected(logged_store):
+    with pytest.raises(SkyshelveError, match="invalid sequence") as excinfo:
+        logged_store.changes_since(-1)
+    assert excinfo.value.code == ErrorCode.ERROR
+
+
+def test_apply_seq_rejects_preconditions(logged_store):
+    with pytest.raises(SkyshelveError):
+        logged_store.apply_seq([("require_absent", b"k", None), ("set", b"k", 1)])
+    assert "k" not in logged_store
+
+
+@pytest.mark.parametrize(
+    "call",
+    [
+        lambda store: store.set_seq("k", 1),
+        lambda store: store.delete_seq("k"),
+        lambda store: store.last_sequence(),
+        lambda store: store.changes_since(0),
+        lambda store: store.trim_changes(0),
+    ],
+)
+def test_requires_change_log(skyshelve_factory, call):
+    store = skyshelve_factory()
+    with pytest.raises(SkyshelveError, match="change_log"):
+        call(store)
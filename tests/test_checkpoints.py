@@ -0,0 +1,98 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+ENCRYPTION = {"encryption": {"key": "00" * 32, "key_id": 1}}
+
+
+@pytest.fixture
+def checkpoint_dir(tmp_path):
+    return tmp_path / "checkpoints"
+
+
+def _open(tmp_path, shared_library, checkpoint_dir, **options):
+    options.setdefault("checkpoint_dir", str(checkpoint_dir))
+    return SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options=options)
+
+
+@pytest.mark.parametrize("backend", ["badger", "sqlite", "bolt"])
+def test_checkpoint_round_trip(tmp_path, shared_library, checkpoint_dir, backend):
+    store = _open(tmp_path, shared_library, checkpoint_dir, backend=backend)
+    try:
+        store.set("k", {"v": 1})
+        store.create_checkpoint("before")
+        store.set("k", "changed")
+        store.set("new", 2)
+
+        (info,) = store.list_checkpoints()
+        assert info["name"] == "before"
+        assert info["backend"] == backend
+        assert info["size_bytes"] > 0
+    finally:
+        store.close()
+
+    ckpt = SkyShelve.open_checkpoint(checkpoint_dir, "before", lib_path=str(shared_library))
+    try:
+        assert ckpt.get("k") == {"v": 1}
+        assert "new" not in ckpt
+        with pytest.raises(SkyshelveError, match="checkpoint is read-only"):
+            ckpt.set("k", "write")
+    finally:
+        ckpt.close()
+
+
+def test_checkpoints_are_listed_oldest_first(tmp_path, shared_library, checkpoint_dir):
+    store = _open(tmp_path, shared_library, checkpoint_dir)
+    try:
+        for name in ("first", "second", "third"):
+            store.create_checkpoint(name)
+        assert [info["name"] for info in store.list_checkpoints()] == ["first", "second", "third"]
+
+        store.delete_checkpoint("second")
+        assert [info["name"] for info in store.list_checkpoints()] == ["first", "third"]
+        with pytest.raises(SkyshelveError, match="no checkpoint named"):
+            store.delete_checkpoint("second")
+    finally:
+        store.close()
+
+
+def test_checkpoint_names_are_unique_and_validated(tmp_path, shared_library, checkpoint_dir):
+    store = _open(tmp_path, shared_library, checkpoint_dir)
+    try:
+        store.create_checkpoint("daily")
+        with pytest.raises(SkyshelveError, match="already exists"):
+            store.create_checkpoint("daily")
+        with pytest.raises(SkyshelveError, match="invalid checkpoint name"):
+            store.create_checkpoint("../escape")
+    finally:
+        store.close()
+
+
+def test_encrypted_checkpoints_need_the_key(tmp_path, shared_library, checkpoint_dir):
+    store = _open(tmp_path, shared_library, checkpoint_dir, backend="sqlite", **ENCRYPTION)
+    try:
+        store.set("secret", "value")
+        store.create_checkpoint("enc")
+    finally:
+        store.close()
+
+    with pytest.raises(SkyshelveError, match="pass its encryption options"):
+        SkyShelve.open_checkpoint(checkpoint_dir, "enc", lib_path=str(shared_library))
+    ckpt = SkyShelve.open_checkpoint(checkpoint_dir, "enc", options=ENCRYPTION, lib_path=str(shared_library))
+    try:
+        assert ckpt.get("secret") == "value"
+    finally:
+        ckpt.close()
+
+
+def test_checkpoints_need_a_checkpoint_dir(skyshelve_factory):
+    store = skyshelve_factory()
+
+    for call in (lambda: store.create_checkpoint("x"), store.list_checkpoints, lambda: store.delete_checkpoint("x")):
+        with pytest.raises(SkyshelveError, match="checkpoint_dir"):
+            call()
+
+
+def test_opening_a_missing_checkpoint_fails(checkpoint_dir, shared_library):
+    with pytest.raises(SkyshelveError, match="no checkpoint named"):
+        SkyShelve.open_checkpoint(checkpoint_dir, "missing", lib_path=str(shared_library))
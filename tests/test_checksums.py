@@ -0,0 +1,146 @@
+import sqlite3
+
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def _open(tmp_path, shared_library, checksums=True):
+    options = {"backend": "sqlite", "checksums": checksums}
+    return SkyShelve(str(tmp_path / "sum.db"), lib_path=str(shared_library), options=options)
+
+
+def _flip_last_byte(tmp_path, key):
+    with sqlite3.connect(str(tmp_path / "sum.db")) as conn:
+        (raw,) = conn.execute("SELECT value FROM kv WHERE key = ?", (key,)).fetchone()
+        raw = bytes(raw)
+        conn.execute("UPDATE kv SET value = ? WHERE key = ?", (raw[:-1] + bytes([raw[-1] ^ 0xFF]), key))
+
+
+def test_clean_store_verifies(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    try:
+        for i in range(5):
+            store.set(f"k{i}", i)
+        report = store.verify()
+        assert report["checked"] == 5
+        assert report["unverified"] == 0
+        assert report["corrupt_total"] == 0
+        assert report["corrupt"] == []
+    finally:
+        store.close()
+
+
+def test_corruption_is_detected_on_get_and_verify(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    store.set("good", b"fine")
+    store.set("bad", b"will be damaged")
+    store.close()
+    _flip_last_byte(tmp_path, b"bad")
+
+    store = _open(tmp_path, shared_library)
+    try:
+        assert store.get("good") == b"fine"
+        with pytest.raises(SkyshelveError, match="checksum mismatch") as excinfo:
+            store.get("bad")
+        assert excinfo.value.code == ErrorCode.CORRUPT
+
+        report = store.verify()
+        assert report["checked"] == 2
+        assert report["corrupt_total"] == 1
+        assert report["corrupt"][0]["key"] == b"bad"
+        assert "checksum mismatch" in report["corrupt"][0]["error"]
+    finally:
+        store.close()
+
+
+def test_values_written_without_checksums_are_unverified(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library, checksums=False)
+    store.set("legacy", b"old")
+    store.close()
+
+    store = _open(tmp_path, shared_library)
+    try:
+        store.set("new", b"checked")
+        report = store.verify()
+        assert report["checked"] == 2
+        assert report["unverified"] == 1
+        assert report["corrupt_total"] == 0
+        assert store.get("legacy") == b"old"
+    finally:
+        store.close()
+
+
+def test_repair_quarantines_corrupt_entries(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    store.set("good", b"fine")
+    store.set("bad", b"will be damaged")
+    store.close()
+    _flip_last_byte(tmp_path, b"bad")
+    with sqlite3.connect(str(tmp_path / "sum.db")) as conn:
+        (damaged,) = conn.execute("SELECT value FROM kv WHERE key = ?", (b"bad",)).fetchone()
+
+    store = _open(tmp_path, shared_library)
+    try:
+        report = store.verify()
+        assert report["corrupt_total"] == 1
+        assert report["quarantined"] == 0
+        with pytest.raises(SkyshelveError, match="checksum mismatch"):
+            store.get("bad")
+
+        report = store.verify(repair=True)
+        assert report["corrupt_total"] == 1
+        assert report["quarantined"] == 1
+        assert report["dropped"] == 0
+        assert store.get("bad") is None
+        assert store.get("good") == b"fine"
+
+        report = store.verify()
+        assert report["checked"] == 1
+        assert report["corrupt_total"] == 0
+    finally:
+        store.close()
+
+    with sqlite3.connect(str(tmp_path / "sum.db")) as conn:
+        rows = conn.execute("SELECT key, value FROM kv ORDER BY key").fetchall()
+    assert [bytes(k) for k, _ in rows] == [b"good", b"\xffquarantine/bad"]
+    assert bytes(rows[1][1]) == bytes(damaged)
+
+
+def test_repair_of_clean_store_changes_nothing(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    try:
+        store.set("a", 1)
+        store.set("b", 2)
+        report = store.verify(repair=True)
+        assert (report["corrupt_total"], report["quarantined"], report["dropped"]) == (0, 0, 0)
+        assert store.scan() == [(b"a", 1), (b"b", 2)]
+    finally:
+        store.close()
+
+
+def test_verify_reports_backends_without_file_check(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    try:
+        store.set("k", "v")
+        assert store.verify()["backend_checked"] is False
+    finally:
+        store.close()
+
+
+def test_verify_runs_badger_table_check(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("k", "v")
+    store.sync()
+
+    report = store.verify()
+    assert report["backend_checked"] is True
+    assert "backend_error" not in report
+
+
+def test_verify_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.verify()
@@ -0,0 +1,139 @@
+import json
+import os
+import shutil
+import subprocess
+from pathlib import Path
+
+import pytest
+
+from skyshelve import SkyShelve
+
+PROJECT_ROOT = Path(__file__).resolve().parents[1]
+
+
+@pytest.fixture(scope="session")
+def cli(tmp_path_factory):
+    """Build the cli-tagged binary once and return a runner for it."""
+    if shutil.which("go") is None:
+        pytest.skip("Go toolchain is not available in PATH; skipping CLI tests.")
+    binary = tmp_path_factory.mktemp("cli") / "skyshelve"
+    env = os.environ.copy()
+    env["GOCACHE"] = str(tmp_path_factory.mktemp("gocache"))
+    result = subprocess.run(
+        ["go", "build", "-tags", "cli", "-o", str(binary), "."],
+        cwd=PROJECT_ROOT,
+        env=env,
+        capture_output=True,
+        text=True,
+    )
+    if result.returncode != 0:
+        pytest.skip(f"Unable to build the skyshelve CLI.\n{result.stderr.strip()}")
+
+    def run(*args, store=None, stdin=b"", env=None):
+        argv = [str(binary)] + (["-store", str(store)] if store is not None else []) + [str(a) for a in args]
+        run_env = {k: v for k, v in os.environ.items() if k != "SKYSHELVE_STORE"}
+        run_env.update(env or {})
+        return subprocess.run(argv, input=stdin, capture_output=True, env=run_env, timeout=120)
+
+    return run
+
+
+@pytest.fixture
+def db_path(tmp_path, shared_library):
+    path = tmp_path / "db"
+    with SkyShelve(str(path), lib_path=str(shared_library)) as store:
+        store.set("user:1", "ada")
+        store.set("user:2", b"bob")
+        store.set("other", "x")
+    return path
+
+
+def _open(path, shared_library):
+    return SkyShelve(str(path), lib_path=str(shared_library))
+
+
+def test_get_set_del(cli, db_path, shared_library):
+    assert cli("get", "user:1", store=db_path).stdout == b"\x01ada"
+    assert cli("set", "cli", "\x01typed", store=db_path).returncode == 0
+    assert cli("set", "piped", store=db_path, stdin=b"\x00from stdin").returncode == 0
+    assert cli("del", "user:2", "missing", store=db_path).returncode == 0
+
+    with _open(db_path, shared_library) as store:
+        assert store.get("cli") == "typed"
+        assert store.get("piped") == b"from stdin"
+        assert "user:2" not in store
+
+
+def test_scan(cli, db_path):
+    out = cli("scan", "-prefix", "user:", store=db_path).stdout.decode()
+    assert out.splitlines() == ['"user:1"\t"\\x01ada"', '"user:2"\t"\\x00bob"']
+
+    out = cli("scan", "-keys", "-limit", "2", store=db_path).stdout.decode()
+    assert out.splitlines() == ['"other"', '"user:1"']
+
+
+def test_stats(cli, db_path):
+    result = cli("stats", store=db_path)
+
+    assert result.returncode == 0
+    assert isinstance(json.loads(result.stdout), dict)
+
+
+def test_dump_and_load_into_another_backend(cli, db_path, tmp_path, shared_library):
+    dump = tmp_path / "dump.ndjson"
+    assert cli("dump", "-format", "ndjson", dump, store=db_path).returncode == 0
+    target = f"sqlite:{tmp_path / 'copy.sqlite'}"
+    assert cli("load", dump, store=target).returncode == 0
+
+    with SkyShelve(target, lib_path=str(shared_library)) as store:
+        assert store.scan() == [(b"other", "x"), (b"user:1", "ada"), (b"user:2", b"bob")]
+
+
+def test_backup_and_restore(cli, db_path, tmp_path, shared_library):
+    backup = tmp_path / "full.bak"
+    result = cli("backup", backup, store=db_path)
+    assert result.returncode == 0
+    assert int(result.stdout) > 0
+
+    restored = tmp_path / "restored"
+    assert cli("restore", backup, store=restored).returncode == 0
+    with _open(restored, shared_library) as store:
+        assert store.get("user:1") == "ada"
+
+
+def test_migrate(cli, db_path, tmp_path, shared_library):
+    dest = f"bolt:{tmp_path / 'migrated.bolt'}"
+    result = cli("migrate", dest, store=db_path)
+
+    assert result.returncode == 0
+    assert b"migrated 3 entries" in result.stderr
+    with SkyShelve(dest, lib_path=str(shared_library)) as store:
+        assert len(store.scan()) == 3
+
+
+def test_store_from_the_environment(cli, db_path):
+    assert cli("get", "other", env={"SKYSHELVE_STORE": str(db_path)}).stdout == b"\x01x"
+
+
+@pytest.mark.parametrize(
+    "args, code, message",
+    [
+        (("get", "missing"), 1, b'get: key "missing" not found'),
+        (("frobnicate",), 2, b'unknown command "frobnicate"'),
+        (("get",), 1, b"usage: skyshelve get KEY"),
+        (("scan", "-limit", "many"), 1, b"invalid value"),
+        (("load", "/nonexistent/dump"), 1, b"no such file"),
+    ],
+)
+def test_errors(cli, db_path, args, code, message):
+    result = cli(*args, store=db_path)
+
+    assert result.returncode == code
+    assert message in result.stderr
+
+
+def test_store_is_required(cli):
+    result = cli("stats")
+
+    assert result.returncode == 2
+    assert b"-store is required" in result.stderr
@@ -0,0 +1,111 @@
+import base64
+import json
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _open(uri, shared_library):
+    return SkyShelve(uri, lib_path=str(shared_library))
+
+
+def test_clone_copies_every_entry(tmp_path, skyshelve_factory, shared_library):
+    source = skyshelve_factory(in_memory=True)
+    for i in range(300):
+        source.set(f"k{i:03d}", {"n": i})
+    source.set("raw", b"\x00\xff")
+
+    dst = tmp_path / "copy"
+    source.clone(str(dst))
+
+    target = _open(str(dst), shared_library)
+    try:
+        assert target.scan() == source.scan()
+        target.set("k000", "changed")
+        assert source.get("k000") == {"n": 0}
+    finally:
+        target.close()
+
+
+def test_clone_keeps_ttls(tmp_path, skyshelve_factory, shared_library):
+    source = skyshelve_factory()
+    source.set("plain", "value")
+    source.set("expiring", "soon", ttl=60)
+
+    dst = tmp_path / "copy"
+    source.clone(str(dst))
+
+    target = _open(str(dst), shared_library)
+    try:
+        dump = tmp_path / "copy.ndjson"
+        target.dump(dump, "ndjson")
+        lines = [json.loads(line) for line in dump.read_text().splitlines()]
+        entries = {base64.b64decode(e["key"]): e for e in lines[1:]}
+        assert set(entries) == {b"plain", b"expiring"}
+        assert entries[b"expiring"]["expires_at"] > time.time_ns()
+        assert "expires_at" not in entries[b"plain"]
+    finally:
+        target.close()
+
+
+def test_clone_to_other_backend(tmp_path, skyshelve_factory, shared_library):
+    source = skyshelve_factory()
+    source.set("a", "one")
+    source.set("b", [2])
+
+    uri = f"bolt:{tmp_path / 'copy.bolt'}"
+    source.clone(uri)
+
+    target = _open(uri, shared_library)
+    try:
+        assert target.scan() == [(b"a", "one"), (b"b", [2])]
+    finally:
+        target.close()
+
+
+def test_clone_of_snapshot_leaves_out_later_writes(tmp_path, skyshelve_factory, shared_library):
+    source = skyshelve_factory()
+    source.set("before", 1)
+    snap = source.snapshot()
+    try:
+        source.set("after", 2)
+        source.delete("before")
+        snap.clone(str(tmp_path / "copy"))
+    finally:
+        snap.close()
+
+    target = _open(str(tmp_path / "copy"), shared_library)
+    try:
+        assert target.scan() == [(b"before", 1)]
+    finally:
+        target.close()
+
+
+def test_clone_into_non_empty_store_raises(tmp_path, skyshelve_factory, shared_library):
+    source = skyshelve_factory(in_memory=True)
+    source.set("a", 1)
+    dst = tmp_path / "existing"
+    existing = _open(str(dst), shared_library)
+    existing.set("b", 2)
+    existing.close()
+
+    with pytest.raises(SkyshelveError, match="clone destination is not empty"):
+        source.clone(str(dst))
+
+    existing = _open(str(dst), shared_library)
+    try:
+        assert existing.scan() == [(b"b", 2)]
+    finally:
+        existing.close()
+
+
+def test_clone_from_backend_without_snapshots_raises(tmp_path, shared_library):
+    source = _open(f"bolt:{tmp_path / 'src.bolt'}", shared_library)
+    try:
+        source.set("a", 1)
+        with pytest.raises(SkyshelveError, match="snapshots are not supported"):
+            source.clone(str(tmp_path / "copy"))
+    finally:
+        source.close()
@@ -0,0 +1,51 @@
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def test_close_all_flushes_and_closes_every_store(tmp_path, shared_library):
+    paths = [str(tmp_path / f"db{i}") for i in range(3)]
+    stores = [SkyShelve(path, lib_path=str(shared_library)) for path in paths]
+    for i, store in enumerate(stores):
+        store.set("k", i)
+    snapshot = stores[0].snapshot()
+
+    SkyShelve.close_all()
+
+    for store in stores:
+        with pytest.raises(SkyshelveError) as excinfo:
+            store.get("k")
+        assert excinfo.value.code == ErrorCode.INVALID_HANDLE
+        store.close()
+    with pytest.raises(SkyshelveError):
+        snapshot.get("k")
+
+    for i, path in enumerate(paths):
+        reopened = SkyShelve(path, lib_path=str(shared_library))
+        try:
+            assert reopened.get("k") == i
+        finally:
+            reopened.close()
+
+
+def test_close_all_with_nothing_open(shared_library):
+    SkyShelve.close_all(lib_path=str(shared_library))
+    SkyShelve.close_all()
+
+
+def test_close_all_stops_metrics_server(shared_library):
+    SkyShelve._ensure_library(str(shared_library))
+    SkyShelve.start_metrics_server("127.0.0.1:0")
+
+    SkyShelve.close_all()
+
+    with pytest.raises(SkyshelveError, match="not running"):
+        SkyShelve.stop_metrics_server()
+
+
+def test_stores_open_after_close_all(skyshelve_factory, shared_library):
+    SkyShelve.close_all(lib_path=str(shared_library))
+
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", "v")
+    assert store.get("k") == "v"
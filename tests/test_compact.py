@@ -0,0 +1,70 @@
+import os
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_compact_badger_store(skyshelve_factory):
+    store = skyshelve_factory()
+    for round_ in range(3):
+        for i in range(200):
+            store.set(f"k{i}", os.urandom(2048) + bytes([round_]))
+    for i in range(100):
+        del store[f"k{i}"]
+    store.sync()
+
+    store.compact()
+
+    assert "k0" not in store
+    assert store.get("k150")[-1] == 2
+
+
+def test_compact_sqlite_returns_free_pages(tmp_path, shared_library):
+    path = tmp_path / "vacuum.db"
+    store = SkyShelve(f"sqlite:{path}", lib_path=str(shared_library))
+    try:
+        for i in range(500):
+            store.set(f"k{i}", b"x" * 4096)
+        for i in range(500):
+            del store[f"k{i}"]
+        store.sync()
+        before = path.stat().st_size
+
+        store.compact()
+
+        assert path.stat().st_size < before
+    finally:
+        store.close()
+
+
+def test_background_gc_options(tmp_path, shared_library):
+    options = {"badger": {"gc_interval": "50ms", "gc_discard_ratio": 0.3}}
+    store = SkyShelve(str(tmp_path / "gc"), lib_path=str(shared_library), options=options)
+    try:
+        store.set("k", "v")
+        store.compact()
+        assert store.get("k") == "v"
+    finally:
+        store.close()
+
+
+@pytest.mark.parametrize(
+    "badger_options, message",
+    [
+        ({"gc_discard_ratio": 1.5}, "gc_discard_ratio must be between 0 and 1"),
+        ({"gc_interval": "soon"}, "invalid gc_interval"),
+    ],
+)
+def test_invalid_gc_options_are_rejected(tmp_path, shared_library, badger_options, message):
+    with pytest.raises(SkyshelveError, match=message):
+        SkyShelve(str(tmp_path / "gc"), lib_path=str(shared_library), options={"badger": badger_options})
+
+
+def test_compact_unsupported_backend(shared_library):
+    store = SkyShelve("memory:", lib_path=str(shared_library))
+    try:
+        with pytest.raises(SkyshelveError, match="compaction is not supported"):
+            store.compact()
+    finally:
+        store.close()
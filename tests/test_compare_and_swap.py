@@ -0,0 +1,59 @@
+import threading
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_compare_and_swap_replaces_matching_value(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("state", "pending")
+
+    assert store.compare_and_swap("state", "pending", "done")
+    assert store.get("state") == "done"
+
+
+def test_compare_and_swap_rejects_stale_value(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("state", "done")
+
+    assert not store.compare_and_swap("state", "pending", "failed")
+    assert store.get("state") == "done"
+
+
+def test_compare_and_swap_none_requires_absent_key(skyshelve_factory):
+    store = skyshelve_factory()
+
+    assert store.compare_and_swap("lock", None, b"owner-1")
+    assert not store.compare_and_swap("lock", None, b"owner-2")
+    assert store.get("lock") == b"owner-1"
+    assert not store.compare_and_swap("missing", b"anything", b"x")
+    assert "missing" not in store
+
+
+def test_compare_and_swap_is_atomic_across_threads(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("counter", 0)
+
+    def worker():
+        for _ in range(50):
+            while True:
+                current = store.get("counter")
+                if store.compare_and_swap("counter", current, current + 1):
+                    break
+
+    threads = [threading.Thread(target=worker) for _ in range(4)]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+
+    assert store.get("counter") == 200
+
+
+def test_compare_and_swap_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.compare_and_swap("k", None, 1)
@@ -0,0 +1,83 @@
+import sqlite3
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _open(tmp_path, shared_library, compression=None):
+    options = {"backend": "sqlite"}
+    if compression is not None:
+        options["compression"] = compression
+    return SkyShelve(str(tmp_path / "zip.db"), lib_path=str(shared_library), options=options)
+
+
+def _raw(tmp_path, key):
+    with sqlite3.connect(str(tmp_path / "zip.db")) as conn:
+        (value,) = conn.execute("SELECT value FROM kv WHERE key = ?", (key,)).fetchone()
+    return bytes(value)
+
+
+@pytest.mark.parametrize("algorithm", ["zstd", "snappy"])
+def test_large_values_are_compressed(tmp_path, shared_library, algorithm):
+    payload = b"abcdefgh" * 1024
+    store = _open(tmp_path, shared_library, {"algorithm": algorithm})
+    try:
+        store.set("big", payload)
+        assert store.get("big") == payload
+        store.sync()
+        raw = _raw(tmp_path, b"big")
+        assert raw.startswith(b"\xffskyzip")
+        assert len(raw) < len(payload)
+    finally:
+        store.close()
+
+
+def test_small_values_stay_plain(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library, {"algorithm": "zstd", "min_size": 64})
+    try:
+        store.set("small", b"x" * 10)
+        store.sync()
+        assert not _raw(tmp_path, b"small").startswith(b"\xffskyzip")
+        assert store.get("small") == b"x" * 10
+    finally:
+        store.close()
+
+
+def test_mixed_algorithms_and_plain_values_read_back(tmp_path, shared_library):
+    plain = b"p" * 4096
+    store = _open(tmp_path, shared_library)
+    store.set("plain", plain)
+    store.close()
+
+    store = _open(tmp_path, shared_library, {"algorithm": "snappy"})
+    store.set("snappy", b"s" * 4096)
+    store.close()
+
+    store = _open(tmp_path, shared_library, {"algorithm": "zstd"})
+    try:
+        store.set("zstd", b"z" * 4096)
+        assert store.get("plain") == plain
+        assert store.get("snappy") == b"s" * 4096
+        assert store.get("zstd") == b"z" * 4096
+    finally:
+        store.close()
+
+
+def test_compression_with_encryption(tmp_path, shared_library):
+    options = {
+        "backend": "memory",
+        "compression": {"algorithm": "zstd"},
+        "encryption": {"key": bytes(range(16)).hex()},
+    }
+    store = SkyShelve(None, lib_path=str(shared_library), options=options)
+    try:
+        store.set("k", ["value"] * 500)
+        assert store.get("k") == ["value"] * 500
+    finally:
+        store.close()
+
+
+def test_unknown_algorithm_is_rejected(tmp_path, shared_library):
+    with pytest.raises(SkyshelveError, match="unknown compression algorithm"):
+        _open(tmp_path, shared_library, {"algorithm": "lz4"})
@@ -0,0 +1,67 @@
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def test_copy_key(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("src", {"v": 1})
+    store.set("dst", "old")
+
+    store.copy_key("src", "dst")
+
+    assert store.get("src") == {"v": 1}
+    assert store.get("dst") == {"v": 1}
+
+
+def test_rename_key(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("src", b"payload")
+
+    store.rename_key("src", "dst")
+
+    assert "src" not in store
+    assert store.get("dst") == b"payload"
+
+
+def test_rename_onto_itself_keeps_value(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", "v")
+
+    store.rename_key("k", "k")
+
+    assert store.get("k") == "v"
+
+
+@pytest.mark.parametrize("scheme", ["sqlite", "bolt"])
+def test_rename_on_other_backends(tmp_path, shared_library, scheme):
+    store = SkyShelve(f"{scheme}:{tmp_path / 'r.db'}", lib_path=str(shared_library))
+    try:
+        store.set("a", 1)
+        store.rename_key("a", "b")
+        store.copy_key("b", "c")
+        assert store.scan() == [(b"b", 1), (b"c", 1)]
+    finally:
+        store.close()
+
+
+@pytest.mark.parametrize("method", ["copy_key", "rename_key"])
+def test_missing_source_is_not_found(skyshelve_factory, method):
+    store = skyshelve_factory(in_memory=True)
+    store.set("dst", "untouched")
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        getattr(store, method)("missing", "dst")
+
+    assert excinfo.value.code == ErrorCode.NOT_FOUND
+    assert store.get("dst") == "untouched"
+
+
+def test_copy_on_snapshot_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("src", 1)
+
+    with store.snapshot() as snap:
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.copy_key("src", "dst")
+    assert "dst" not in store
@@ -0,0 +1,49 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_count_prefix_and_total(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(7):
+        store.set(f"user:{i}", i)
+    for i in range(3):
+        store.set(f"order:{i}", i)
+
+    assert store.count("user:") == 7
+    assert store.count("order:") == 3
+    assert store.count() == 10
+    assert store.count("none:") == 0
+
+
+def test_count_range(skyshelve_factory):
+    store = skyshelve_factory()
+    for key in "abcdef":
+        store.set(key, key)
+
+    assert store.count_range("b", "e") == 3
+    assert store.count_range(end="c") == 2
+    assert store.count_range("e") == 2
+    assert store.count_range() == 6
+
+
+def test_count_tracks_deletes_and_expiry(skyshelve_factory):
+    import time
+
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+    store.set("b", 2, ttl=1)
+    store.delete("a")
+    time.sleep(2.2)
+
+    assert store.count() == 0
+
+
+def test_count_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.count()
+    with pytest.raises(SkyshelveError):
+        store.count_range("a", "b")
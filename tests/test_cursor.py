@@ -0,0 +1,117 @@
+import sqlite3
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_iter_scan_streams_prefix_in_order(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(10):
+        store.set(f"user:{i:02d}", i)
+    store.set("other", "skip")
+
+    entries = list(store.iter_scan("user:", batch_size=3))
+
+    assert [key for key, _ in entries] == [f"user:{i:02d}".encode() for i in range(10)]
+    assert [value for _, value in entries] == list(range(10))
+
+
+def test_iter_scan_reverse(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for key in ("a", "b", "c"):
+        store.set(key, key.upper())
+
+    assert list(store.iter_scan(reverse=True)) == [(b"c", "C"), (b"b", "B"), (b"a", "A")]
+
+
+def test_iter_scan_matches_scan(skyshelve_factory):
+    store = skyshelve_factory()
+    for i in range(50):
+        store.set(f"k{i:03d}", b"v" * i)
+
+    assert list(store.iter_scan(batch_size=7)) == store.scan()
+
+
+def test_iter_scan_empty_prefix_yields_nothing(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+
+    assert list(store.iter_scan("missing")) == []
+
+
+def test_iter_scan_can_stop_early(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(100):
+        store.set(f"k{i:03d}", i)
+
+    stream = store.iter_scan(batch_size=10)
+    assert next(stream) == (b"k000", 0)
+    stream.close()
+
+    store.set("k000", "still writable")
+    assert store.get("k000") == "still writable"
+
+
+def test_iter_scan_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        list(store.iter_scan())
+
+
+@pytest.mark.parametrize("batch_size", [1, 64, 5000])
+def test_sequential_scan_past_the_prefetch_window(skyshelve_factory, batch_size):
+    store = skyshelve_factory()
+    store.apply([("set", f"k{i:05d}".encode(), i) for i in range(10000)])
+
+    entries = list(store.iter_scan("k", batch_size=batch_size))
+
+    assert [value for _, value in entries] == list(range(10000))
+
+
+def test_sequential_scan_of_values_past_the_prefetch_byte_budget(skyshelve_factory):
+    store = skyshelve_factory()
+    for i in range(12):
+        store.set(f"big{i:02d}", bytes([i]) * (1 << 20))
+
+    entries = list(store.iter_scan("big", batch_size=2))
+
+    assert [key for key, _ in entries] == [f"big{i:02d}".encode() for i in range(12)]
+    assert all(value == bytes([i]) * (1 << 20) for i, (_, value) in enumerate(entries))
+
+
+def test_prefetching_cursor_can_stop_early(skyshelve_factory):
+    store = skyshelve_factory()
+    store.apply([("set", f"k{i:05d}".encode(), i) for i in range(5000)])
+
+    stream = store.iter_scan("k", batch_size=100)
+    taken = [next(stream) for _ in range(250)]
+    stream.close()
+
+    assert taken[-1] == (b"k00249", 249)
+    store.drop_all()
+    assert store.count() == 0
+
+
+def test_entries_before_an_iteration_error_are_delivered(tmp_path, shared_library):
+    path = tmp_path / "sum.db"
+    options = {"backend": "sqlite", "checksums": True}
+    store = SkyShelve(str(path), lib_path=str(shared_library), options=options)
+    for key in ("a", "b", "c"):
+        store.set(key, key)
+    store.close()
+    with sqlite3.connect(str(path)) as conn:
+        (raw,) = conn.execute("SELECT value FROM kv WHERE key = ?", (b"b",)).fetchone()
+        conn.execute("UPDATE kv SET value = ? WHERE key = ?", (bytes(raw)[:-1] + b"\x00", b"b"))
+
+    store = SkyShelve(str(path), lib_path=str(shared_library), options=options)
+    try:
+        seen = []
+        with pytest.raises(SkyshelveError, match="checksum mismatch"):
+            for key, _ in store.iter_scan(batch_size=10):
+                seen.append(key)
+        assert seen == [b"a"]
+    finally:
+        store.close()
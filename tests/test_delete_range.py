@@ -0,0 +1,50 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def _fill(store):
+    for i in range(5):
+        store.set(f"user:{i}", i)
+        store.set(f"order:{i}", i)
+
+
+def test_delete_prefix_counts_and_removes(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    _fill(store)
+
+    assert store.delete_prefix("user:") == 5
+    assert store.scan("user:") == []
+    assert len(store.scan("order:")) == 5
+    assert store.delete_prefix("user:") == 0
+
+
+def test_delete_prefix_rejects_empty_prefix(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(ValueError):
+        store.delete_prefix(b"")
+
+
+def test_delete_range_is_half_open(skyshelve_factory):
+    store = skyshelve_factory()
+    _fill(store)
+
+    assert store.delete_range("user:1", "user:3") == 2
+    assert [k for k, _ in store.scan("user:")] == [b"user:0", b"user:3", b"user:4"]
+
+
+def test_delete_range_open_bounds_clear_store(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    _fill(store)
+
+    assert store.delete_range() == 10
+    assert store.scan() == []
+
+
+def test_delete_range_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.delete_range("a", "b")
@@ -0,0 +1,88 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_diff_reports_added_removed_and_changed_keys(skyshelve_factory):
+    source = skyshelve_factory(in_memory=True)
+    target = skyshelve_factory(in_memory=True)
+    source["same"] = "value"
+    source["changed"] = {"version": 1}
+    source["removed"] = b"old"
+    target["same"] = "value"
+    target["changed"] = {"version": 2}
+    target["added"] = [1, 2]
+
+    assert source.diff(target) == [
+        ("+", b"added", None, [1, 2]),
+        ("~", b"changed", {"version": 1}, {"version": 2}),
+        ("-", b"removed", b"old", None),
+    ]
+    assert target.diff(source) == [
+        ("-", b"added", [1, 2], None),
+        ("~", b"changed", {"version": 2}, {"version": 1}),
+        ("+", b"removed", None, b"old"),
+    ]
+
+
+def test_diff_of_identical_stores_is_empty(skyshelve_factory):
+    memory = skyshelve_factory(in_memory=True)
+    disk = skyshelve_factory(in_memory=False)
+    for i in range(10):
+        memory[f"key-{i}"] = i
+        disk[f"key-{i}"] = i
+
+    assert memory.diff(disk) == []
+    assert memory.diff(memory) == []
+
+
+def test_diff_compares_values_by_encoding(skyshelve_factory):
+    source = skyshelve_factory(in_memory=True)
+    target = skyshelve_factory(in_memory=True)
+    source["key"] = "text"
+    target["key"] = b"text"
+
+    assert source.diff(target) == [("~", b"key", "text", b"text")]
+
+
+def test_diff_limited_to_prefix(skyshelve_factory):
+    source = skyshelve_factory(in_memory=True)
+    target = skyshelve_factory(in_memory=True)
+    source["user:1"] = "alice"
+    source["order:1"] = "book"
+    target["user:1"] = "alicia"
+    target["order:2"] = "pen"
+
+    assert source.diff(target, prefix="user:") == [("~", b"user:1", "alice", "alicia")]
+    assert source.diff(target, prefix="order:") == [
+        ("-", b"order:1", "book", None),
+        ("+", b"order:2", None, "pen"),
+    ]
+    assert source.diff(target, prefix="missing:") == []
+
+
+def test_diff_spans_batches(skyshelve_factory):
+    source = skyshelve_factory(in_memory=True)
+    target = skyshelve_factory(in_memory=False)
+    for i in range(3000):
+        source[f"k{i:05d}"] = i
+        if i % 1000 != 0:
+            target[f"k{i:05d}"] = i
+    target["k01500"] = -1
+
+    assert source.diff(target) == [
+        ("-", b"k00000", 0, None),
+        ("-", b"k01000", 1000, None),
+        ("~", b"k01500", 1500, -1),
+        ("-", b"k02000", 2000, None),
+    ]
+
+
+def test_diff_with_closed_store_raises(skyshelve_factory):
+    source = skyshelve_factory(in_memory=True)
+    target = skyshelve_factory(in_memory=True)
+    source["key"] = "value"
+    target.close()
+
+    with pytest.raises(SkyshelveError, match="invalid handle"):
+        source.diff(target)
@@ -0,0 +1,56 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.mark.parametrize("in_memory", [True, False])
+def test_drop_all_empties_badger_store(skyshelve_factory, in_memory):
+    store = skyshelve_factory(in_memory=in_memory)
+    for i in range(20):
+        store.set(f"k{i}", i)
+
+    store.drop_all()
+
+    assert store.count() == 0
+    assert "k0" not in store
+    store.set("after", "still open")
+    assert store.get("after") == "still open"
+
+
+@pytest.mark.parametrize("scheme", ["sqlite", "bolt"])
+def test_drop_all_other_backends(tmp_path, shared_library, scheme):
+    store = SkyShelve(f"{scheme}:{tmp_path / 'drop.db'}", lib_path=str(shared_library))
+    try:
+        store.set("a", 1)
+        store.set("b", 2)
+        store.drop_all()
+        assert store.count() == 0
+    finally:
+        store.close()
+
+
+def test_drop_all_restarts_sequences(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    assert [store.next_sequence("ids") for _ in range(3)] == [0, 1, 2]
+
+    store.drop_all()
+
+    assert store.next_sequence("ids") == 0
+
+
+def test_drop_all_rejected_on_snapshot(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", "v")
+
+    with store.snapshot() as snap:
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.drop_all()
+    assert store.get("k") == "v"
+
+
+def test_drop_all_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.drop_all()
@@ -0,0 +1,100 @@
+import base64
+import json
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def source(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("text", "hello")
+    store.set("bytes", b"\x00\xff")
+    store.set("obj", {"n": 1})
+    store.set("ttl", "expiring", ttl=60)
+    return store
+
+
+@pytest.mark.parametrize("fmt", ["binary", "ndjson"])
+def test_round_trip_into_a_new_store(source, tmp_path, shared_library, fmt):
+    path = tmp_path / f"dump.{fmt}"
+    source.dump(path, fmt)
+
+    target = SkyShelve(str(tmp_path / "target"), lib_path=str(shared_library))
+    try:
+        target.set("kept", "still here")
+        target.load(path)
+        assert target.get("text") == "hello"
+        assert target.get("bytes") == b"\x00\xff"
+        assert target.get("obj") == {"n": 1}
+        assert target.get("kept") == "still here"
+        redump = tmp_path / "redump.ndjson"
+        target.dump(redump, "ndjson")
+        expiring = [json.loads(line) for line in redump.read_text().splitlines() if '"expires_at"' in line]
+        assert [base64.b64decode(e["key"]) for e in expiring] == [b"ttl"]
+    finally:
+        target.close()
+
+
+def test_ndjson_format_is_documented_json(source, tmp_path):
+    path = tmp_path / "dump.ndjson"
+    source.dump(path, "ndjson")
+
+    lines = [json.loads(line) for line in path.read_text().splitlines()]
+    assert lines[0] == {"skyshelve_dump": 1}
+    entries = {base64.b64decode(e["key"]): e for e in lines[1:]}
+    assert base64.b64decode(entries[b"text"]["value"]) == b"\x01hello"
+    assert "expires_at" not in entries[b"text"]
+    assert entries[b"ttl"]["expires_at"] > time.time_ns()
+
+
+def test_load_reads_hand_written_ndjson(skyshelve_factory, tmp_path):
+    store = skyshelve_factory(in_memory=True)
+    path = tmp_path / "hand.ndjson"
+    entry = {"key": base64.b64encode(b"k").decode(), "value": base64.b64encode(b"\x01v").decode()}
+    expired = dict(entry, key=base64.b64encode(b"old").decode(), expires_at=1)
+    path.write_text("\n".join(json.dumps(x) for x in ({"skyshelve_dump": 1}, entry, expired)) + "\n")
+
+    store.load(path)
+
+    assert store.scan() == [(b"k", "v")]
+
+
+def test_default_format_is_binary(source, tmp_path):
+    path = tmp_path / "dump.bin"
+    source.dump(path)
+
+    assert not path.read_bytes().startswith(b"{")
+
+
+def test_invalid_dumps_are_rejected(skyshelve_factory, tmp_path):
+    store = skyshelve_factory()
+    with pytest.raises(SkyshelveError, match="unknown dump format"):
+        store.dump(tmp_path / "x", "csv")
+
+    bad_version = tmp_path / "v2.ndjson"
+    bad_version.write_text('{"skyshelve_dump": 2}\n')
+    with pytest.raises(SkyshelveError, match="unsupported dump version 2"):
+        store.load(bad_version)
+
+    bad_entry = tmp_path / "entry.ndjson"
+    bad_entry.write_text('{"skyshelve_dump": 1}\n{"key": 5}\n')
+    with pytest.raises(SkyshelveError, match="invalid dump entry"):
+        store.load(bad_entry)
+
+    with pytest.raises(SkyshelveError):
+        store.load(tmp_path / "missing")
+
+
+def test_dump_moves_between_backends(skyshelve_factory, tmp_path, shared_library):
+    source = skyshelve_factory(in_memory=True)
+    source.set("a", "1")
+    source.set("b", [2])
+    path = tmp_path / "dump.ndjson"
+    source.dump(path, "ndjson")
+
+    with SkyShelve(f"sqlite:{tmp_path / 'db.sqlite'}", lib_path=str(shared_library)) as target:
+        target.load(path)
+        assert target.scan() == [(b"a", "1"), (b"b", [2])]
@@ -0,0 +1,63 @@
+import pytest
+
+from skyshelve import Durability, SkyShelve, SkyshelveError
+
+
+@pytest.mark.parametrize("durability", list(Durability))
+def test_writes_at_each_durability_level(skyshelve_factory, durability):
+    store = skyshelve_factory()
+
+    seq = store.set_with_durability("k", {"v": 1}, durability)
+    assert seq >= 0
+    store.await_durable(seq)
+    assert store.get("k") == {"v": 1}
+
+    store.delete_with_durability("k", durability)
+    assert "k" not in store
+
+
+def test_apply_with_durability(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("old", 1)
+
+    seq = store.apply_with_durability([("set", b"a", 1), ("delete", b"old", None)], Durability.PERSISTED)
+
+    store.await_durable(seq)
+    assert store.get("a") == 1
+    assert "old" not in store
+
+
+def test_persisted_write_survives_reopen(tmp_path, shared_library):
+    path = f"sqlite:{tmp_path / 'durable.db'}"
+    store = SkyShelve(path, lib_path=str(shared_library))
+    store.set_with_durability("k", "v", Durability.PERSISTED)
+    store.close()
+
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        assert store.get("k") == "v"
+    finally:
+        store.close()
+
+
+def test_unknown_durability_level(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(SkyshelveError, match="unknown durability level 7"):
+        store.set_with_durability("k", "v", 7)
+    assert "k" not in store
+
+
+def test_await_durable_rejects_negative_sequence(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(SkyshelveError, match="invalid write sequence"):
+        store.await_durable(-1)
+
+
+def test_durable_writes_on_closed_store_raise(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.set_with_durability("k", "v", Durability.DEFAULT)
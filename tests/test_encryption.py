@@ -0,0 +1,101 @@
+import sqlite3
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+KEY_1 = bytes(range(32))
+KEY_2 = bytes(range(32, 64))
+
+
+def _sqlite(tmp_path, shared_library, **options):
+    return SkyShelve(
+        str(tmp_path / "enc.db"), lib_path=str(shared_library), options={"backend": "sqlite", **options}
+    )
+
+
+def _raw_values(tmp_path):
+    with sqlite3.connect(str(tmp_path / "enc.db")) as conn:
+        return [value for (value,) in conn.execute("SELECT value FROM kv")]
+
+
+def test_encrypted_values_round_trip(tmp_path, shared_library):
+    store = _sqlite(tmp_path, shared_library, encryption={"key": KEY_1.hex(), "key_id": 1})
+    try:
+        store.set("secret", "plaintext-marker")
+        assert store.get("secret") == "plaintext-marker"
+        store.sync()
+        assert all(b"plaintext-marker" not in raw for raw in _raw_values(tmp_path))
+    finally:
+        store.close()
+
+
+def test_key_supplied_after_open(tmp_path, shared_library):
+    store = _sqlite(tmp_path, shared_library, encryption={"key": KEY_1.hex(), "key_id": 1})
+    store.set("k", {"v": 1})
+    store.close()
+
+    store = _sqlite(tmp_path, shared_library, encryption={})
+    try:
+        with pytest.raises(SkyshelveError):
+            store.get("k")
+        store.set_encryption_key(1, KEY_1)
+        assert store.get("k") == {"v": 1}
+    finally:
+        store.close()
+
+
+def test_rotation_keeps_old_values_readable(tmp_path, shared_library):
+    store = _sqlite(tmp_path, shared_library, encryption={"key": KEY_1.hex(), "key_id": 1})
+    try:
+        store.set("old", "sealed with 1")
+        store.rotate_encryption_key(2, KEY_2)
+        store.set("new", "sealed with 2")
+    finally:
+        store.close()
+
+    store = _sqlite(tmp_path, shared_library, encryption={"key": KEY_2.hex(), "key_id": 2})
+    try:
+        assert store.get("new") == "sealed with 2"
+        with pytest.raises(SkyshelveError):
+            store.get("old")
+        store.set_encryption_key(1, KEY_1)
+        assert store.get("old") == "sealed with 1"
+    finally:
+        store.close()
+
+
+def test_encryption_key_errors(tmp_path, shared_library, skyshelve_factory):
+    plain = _sqlite(tmp_path, shared_library)
+    try:
+        with pytest.raises(SkyshelveError, match="not opened with encryption"):
+            plain.set_encryption_key(1, KEY_1)
+    finally:
+        plain.close()
+
+    badger = skyshelve_factory(in_memory=True)
+    with pytest.raises(SkyshelveError, match="badger encrypts natively"):
+        badger.rotate_encryption_key(1, KEY_1)
+
+    store = SkyShelve(None, lib_path=str(shared_library), options={"backend": "memory", "encryption": {}})
+    try:
+        with pytest.raises(SkyshelveError):
+            store.set_encryption_key(1, b"short")
+    finally:
+        store.close()
+
+
+def test_badger_native_encryption(tmp_path, shared_library):
+    options = {"encryption": {"key": KEY_1.hex()}}
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options=options)
+    store.set("k", "v")
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library))
+
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options=options)
+    try:
+        assert store.get("k") == "v"
+    finally:
+        store.close()
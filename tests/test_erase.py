@@ -0,0 +1,184 @@
+import base64
+import hashlib
+import hmac
+import json
+import sqlite3
+from pathlib import Path
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _expected_signature(report, key):
+    unsigned = {name: value for name, value in report.items() if name != "signature"}
+    unsigned["prefix"] = base64.b64encode(report["prefix"]).decode()
+    doc = json.dumps(unsigned, separators=(",", ":")).encode()
+    return hmac.new(key, doc, hashlib.sha256).hexdigest()
+
+
+def test_erase_removes_only_the_prefix(skyshelve_factory):
+    store = skyshelve_factory()
+    for i in range(20):
+        store.set(f"user:42:{i}", {"email": "alice@example.com"})
+    store.set("user:43:0", "kept")
+    store.set("order:1", "kept")
+
+    report = store.erase("user:42:")
+
+    assert report["prefix"] == b"user:42:"
+    assert report["deleted"] == 20
+    assert report["remaining"] == 0
+    assert report["versions_checked"] is True
+    assert report["retained_versions"] == 0
+    assert report["compacted"] is True
+    assert report["verified"] is True
+    assert report["verified_excludes"] == ["change_log_keys", "audit_records"]
+    assert "signature" not in report
+    assert store.scan("user:42:") == []
+    assert store.scan() == [(b"order:1", "kept"), (b"user:43:0", "kept")]
+
+
+def test_erase_removes_blobs_under_the_prefix(skyshelve_factory):
+    store = skyshelve_factory()
+    store.blob_put("user:42:avatar", b"a" * 300_000)
+    store.blob_put("user:42:cv", b"c")
+    store.blob_put("user:4", b"kept")
+    store.blob_put("user:43:avatar", b"kept")
+
+    report = store.erase("user:42:")
+
+    assert report["remaining"] == 0
+    assert report["verified"] is True
+    assert store.blob_get("user:42:avatar") is None
+    assert store.blob_get("user:42:cv") is None
+    assert store.blob_get("user:4") == b"kept"
+    assert store.blob_get("user:43:avatar") == b"kept"
+
+
+def test_erased_values_leave_the_badger_files(tmp_path, shared_library):
+    secret = b"erase-me-0123456789abcdef" * 8
+    path = tmp_path / "store"
+    store = SkyShelve(str(path), lib_path=str(shared_library))
+    try:
+        for version in range(3):
+            store.set("pii:1", secret + bytes([version]))
+        store.set("other", b"ordinary")
+        store.sync()
+        assert store.erase("pii:")["verified"] is True
+    finally:
+        store.close()
+
+    for file in Path(path).rglob("*"):
+        if file.is_file():
+            assert secret not in file.read_bytes(), file.name
+
+
+def test_erase_reports_change_log_records(tmp_path, shared_library):
+    store = SkyShelve(
+        str(tmp_path / "logged.db"),
+        lib_path=str(shared_library),
+        options={"backend": "sqlite", "change_log": True},
+    )
+    try:
+        store.set("pii:1", "alice")
+        store.set("pii:2", "bob")
+
+        report = store.erase("pii:")
+        assert report["deleted"] == 2
+        assert report["remaining"] == 0
+        assert report["versions_checked"] is False
+        assert report["change_log_records"] == 2
+        assert report["change_log_keys"] == 4
+        assert report["verified"] is False
+
+        store.trim_changes(store.last_sequence() - 1)
+        report = store.erase("pii:")
+        assert report["deleted"] == 0
+        assert report["change_log_records"] == 0
+        assert report["verified"] is True
+    finally:
+        store.close()
+
+
+def test_erase_counts_audit_records_outside_verified(tmp_path, shared_library):
+    store = SkyShelve(
+        str(tmp_path / "audited.db"),
+        lib_path=str(shared_library),
+        options={"backend": "sqlite", "audit": True},
+    )
+    try:
+        store.set("pii:1", "alice")
+        report = store.erase("pii:")
+        assert report["audit_records"] == 2
+        assert report["verified"] is True
+        assert [r[2] for r in store.audit_scan()] == ["set", "delete"]
+    finally:
+        store.close()
+
+
+def test_erase_removes_quarantined_copies(tmp_path, shared_library):
+    path = tmp_path / "sum.db"
+    options = {"backend": "sqlite", "checksums": True}
+    store = SkyShelve(str(path), lib_path=str(shared_library), options=options)
+    store.set("pii:1", "alice")
+    store.set("other", "kept")
+    store.close()
+    with sqlite3.connect(str(path)) as conn:
+        (raw,) = conn.execute("SELECT value FROM kv WHERE key = ?", (b"pii:1",)).fetchone()
+        conn.execute("UPDATE kv SET value = ? WHERE key = ?", (bytes(raw)[:-1] + b"\x00", b"pii:1"))
+
+    store = SkyShelve(str(path), lib_path=str(shared_library), options=options)
+    try:
+        assert store.verify(repair=True)["quarantined"] == 1
+        report = store.erase("pii:")
+        assert report["deleted"] == 0
+        assert report["remaining"] == 0
+        assert report["verified"] is True
+    finally:
+        store.close()
+
+    with sqlite3.connect(str(path)) as conn:
+        keys = [bytes(k) for (k,) in conn.execute("SELECT key FROM kv")]
+    assert keys == [b"other"]
+
+
+def test_signed_report(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("pii:1", "alice")
+    key = b"compliance-signing-key"
+
+    report = store.erase("pii:", signing_key=key)
+
+    assert report["signature"] == _expected_signature(report, key)
+    assert report["signature"] != _expected_signature(report, b"another key")
+    forged = dict(report, deleted=0)
+    assert report["signature"] != _expected_signature(forged, key)
+
+
+def test_erase_of_empty_prefix_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+
+    with pytest.raises(ValueError, match="empty keys"):
+        store.erase(b"")
+    assert store.get("a") == 1
+
+
+def test_erase_of_reserved_prefix_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(SkyshelveError, match="reserved 0xff keyspace"):
+        store.erase(b"\xffaudit/")
+
+
+def test_erase_through_snapshot_is_rejected(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("pii:1", "alice")
+    snap = store.snapshot()
+    try:
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.erase("pii:")
+    finally:
+        snap.close()
+    assert store.get("pii:1") == "alice"
@@ -0,0 +1,69 @@
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def test_conflict_error_carries_code(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", 0)
+    first = store.transaction()
+    second = store.transaction()
+    first.set("k", first.get("k") + 1)
+    second.set("k", second.get("k") + 1)
+    first.commit()
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        second.commit()
+    assert excinfo.value.code == ErrorCode.CONFLICT
+
+
+def test_missing_key_is_not_an_error(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.get("missing") is None
+    with pytest.raises(KeyError):
+        store.get("missing", raise_missing=True)
+
+
+def test_closed_store_error_code(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.set("k", 1)
+    assert excinfo.value.code == ErrorCode.CLOSED
+
+
+def test_open_failure_has_error_code(tmp_path, shared_library):
+    target = tmp_path / "file"
+    target.write_text("not a directory")
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        SkyShelve(str(target), lib_path=str(shared_library))
+    assert excinfo.value.code < 0
+
+
+def test_error_code_values_match_library():
+    assert [code.value for code in ErrorCode] == list(range(0, -12, -1))
+
+
+@pytest.mark.parametrize(
+    "call",
+    [
+        lambda store: store.get(b"\xffchg/x"),
+        lambda store: store.set(b"\xffchg/x", "v"),
+        lambda store: store.delete(b"\xffaudit/x"),
+        lambda store: b"\xffidx/x" in store,
+        lambda store: store.get_many([b"a", b"\xffbkt!x"]),
+        lambda store: store.apply([("set", b"a", "v"), ("delete", b"\xfftrash/a", None)]),
+        lambda store: store.rename_key("a", b"\xffidx/x"),
+    ],
+)
+def test_reserved_keys_are_refused(skyshelve_factory, call):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", "v")
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        call(store)
+    assert excinfo.value.code == ErrorCode.RESERVED_KEY
+    assert store.scan() == [(b"a", "v")]
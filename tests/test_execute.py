@@ -0,0 +1,76 @@
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def test_execute_mixed_pipeline(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("existing", {"v": 1})
+
+    results = store.execute(
+        [
+            ("set", "a", 1),
+            ("set", "b", "two"),
+            ("get", "existing"),
+            ("get", "missing"),
+            ("has", "a"),
+            ("has", "missing"),
+            ("delete", "existing"),
+            ("has", "existing"),
+        ]
+    )
+
+    assert results == [None, None, {"v": 1}, None, True, False, None, False]
+    assert store.get("b") == "two"
+
+
+def test_execute_scan_with_limit(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(5):
+        store.set(f"k{i}", i)
+    store.set("z", "outside")
+
+    (page, whole) = store.execute([("scan", "k", "l", 3), ("scan", None, None, 0)])
+
+    assert page == ([(b"k0", 0), (b"k1", 1), (b"k2", 2)], True)
+    assert whole[0][-1] == (b"z", "outside")
+    assert whole[1] is False
+
+
+def test_execute_failures_do_not_stop_pipeline(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"max_value_size": 8})
+    try:
+        results = store.execute([("set", "big", b"x" * 64), ("set", "small", b"ok"), ("get", "small")])
+
+        assert isinstance(results[0], SkyshelveError)
+        assert results[0].code == ErrorCode.TOO_LARGE
+        assert results[1:] == [None, b"ok"]
+    finally:
+        store.close()
+
+
+def test_execute_set_with_ttl(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.execute([("set", "k", "v", 60), ("get", "k")]) == [None, "v"]
+
+
+def test_execute_empty_pipeline(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.execute([]) == []
+
+
+def test_execute_rejects_unknown_command(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(ValueError, match="unknown command"):
+        store.execute([("incr", "k")])
+
+
+def test_execute_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.execute([("get", "k")])
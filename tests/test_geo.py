@@ -0,0 +1,69 @@
+import math
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+PLACES = {
+    "louvre": (48.8606, 2.3376),
+    "notre-dame": (48.8530, 2.3499),
+    "versailles": (48.8049, 2.1204),
+    "london": (51.5072, -0.1276),
+}
+
+
+@pytest.fixture
+def places(skyshelve_factory):
+    store = skyshelve_factory()
+    for name, (lat, lon) in PLACES.items():
+        store.geo_put(name, lat, lon)
+    return store
+
+
+def test_radius_search_returns_nearest_first(places):
+    hits = places.geo_search(48.8584, 2.2945, 20_000)
+
+    assert [key for key, _ in hits] == [b"louvre", b"notre-dame", b"versailles"]
+    assert hits[0][1] == pytest.approx(3_170, rel=0.02)
+    assert all(a[1] <= b[1] for a, b in zip(hits, hits[1:]))
+
+
+def test_limit_and_small_radius(places):
+    assert [key for key, _ in places.geo_search(48.8584, 2.2945, 20_000, limit=1)] == [b"louvre"]
+    assert places.geo_search(48.8584, 2.2945, 100) == []
+    assert places.geo_search(51.5072, -0.1276, 0) == [(b"london", 0.0)]
+
+
+def test_put_moves_and_delete_removes(places):
+    places.geo_put("london", 48.8600, 2.3370)
+    places.geo_delete("versailles")
+    places.geo_delete("versailles")
+
+    assert [key for key, _ in places.geo_search(48.8584, 2.2945, 50_000)] == [b"london", b"louvre", b"notre-dame"]
+
+
+def test_searches_across_the_antimeridian(skyshelve_factory):
+    store = skyshelve_factory()
+    store.geo_put("east", 0, 179.999)
+    store.geo_put("west", 0, -179.999)
+
+    assert sorted(key for key, _ in store.geo_search(0, 180, 1_000)) == [b"east", b"west"]
+
+
+def test_locations_live_apart_from_values(places):
+    places.set("louvre", "museum")
+
+    assert places.scan() == [(b"louvre", "museum")]
+    assert places.geo_search(48.8606, 2.3376, 1)[0][0] == b"louvre"
+
+
+@pytest.mark.parametrize("lat, lon", [(91, 0), (-91, 0), (0, 181), (math.nan, 0)])
+def test_out_of_range_coordinates_are_rejected(skyshelve_factory, lat, lon):
+    with pytest.raises(SkyshelveError, match="coordinates out of range"):
+        skyshelve_factory().geo_put("bad", lat, lon)
+
+
+@pytest.mark.parametrize("radius", [-1, math.inf, math.nan])
+def test_invalid_radius_is_rejected(places, radius):
+    with pytest.raises(SkyshelveError, match="radius must be a finite, non-negative"):
+        places.geo_search(0, 0, radius)
@@ -0,0 +1,61 @@
+import threading
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_get_del_returns_and_removes(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", {"job": 1})
+
+    assert store.get_del("k") == {"job": 1}
+    assert "k" not in store
+    assert store.get_del("k") is None
+    assert store.get_del("k", default="empty") == "empty"
+
+
+def test_get_del_hands_each_value_to_one_consumer(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(200):
+        store.set(f"job:{i:03d}", i)
+    taken = []
+    lock = threading.Lock()
+
+    def consumer():
+        for i in range(200):
+            value = store.get_del(f"job:{i:03d}")
+            if value is not None:
+                with lock:
+                    taken.append(value)
+
+    threads = [threading.Thread(target=consumer) for _ in range(4)]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+
+    assert sorted(taken) == list(range(200))
+    assert store.count() == 0
+
+
+@pytest.mark.parametrize("scheme", ["memory", "sqlite"])
+def test_get_del_other_backends(tmp_path, shared_library, scheme):
+    path = "memory:" if scheme == "memory" else f"sqlite:{tmp_path / 'g.db'}"
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        store.set("k", b"v")
+        assert store.get_del("k") == b"v"
+        assert store.get_del("k") is None
+    finally:
+        store.close()
+
+
+def test_get_del_on_snapshot_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", "v")
+
+    with store.snapshot() as snap:
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.get_del("k")
+    assert store.get("k") == "v"
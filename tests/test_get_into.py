@@ -0,0 +1,63 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_get_into_copies_stored_value(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", b"payload")
+    buffer = bytearray(64)
+
+    length = store.get_into("k", buffer)
+
+    assert length == 1 + len(b"payload")
+    assert buffer[:length] == b"\x00payload"
+
+
+def test_get_into_reports_needed_size(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", "x" * 100)
+    buffer = bytearray(b"untouched")
+
+    needed = store.get_into("k", buffer)
+
+    assert needed == 101
+    assert buffer == bytearray(b"untouched")
+    buffer = bytearray(needed)
+    assert store.get_into("k", buffer) == needed
+    assert buffer[1:] == b"x" * 100
+
+
+def test_get_into_memoryview_slice(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", b"abc")
+    backing = bytearray(16)
+
+    length = store.get_into("k", memoryview(backing)[8:])
+
+    assert backing[8 : 8 + length] == b"\x00abc"
+    assert backing[:8] == bytearray(8)
+
+
+def test_get_into_missing_and_empty_buffer(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", b"v")
+
+    assert store.get_into("missing", bytearray(8)) is None
+    assert store.get_into("k", bytearray()) == 2
+
+
+def test_get_into_rejects_readonly_buffer(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", b"v")
+
+    with pytest.raises(TypeError):
+        store.get_into("k", b"readonly")
+
+
+def test_get_into_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.get_into("k", bytearray(8))
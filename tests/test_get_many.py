@@ -0,0 +1,40 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_get_many_preserves_order_and_misses(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+    store.set("b", "two")
+    store.set("c", b"three")
+
+    assert store.get_many(["c", "missing", "a", "b"]) == [b"three", None, 1, "two"]
+
+
+def test_get_many_custom_default_and_duplicates(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("a", [1])
+
+    assert store.get_many(["x", "a", "a"], default=0) == [0, [1], [1]]
+
+
+def test_get_many_empty_value_is_found(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("empty", b"")
+
+    assert store.get_many(["empty"], default=None) == [b""]
+
+
+def test_get_many_no_keys(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.get_many([]) == []
+
+
+def test_get_many_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.get_many(["a"])
@@ -0,0 +1,84 @@
+import threading
+
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def _open(tmp_path, shared_library, **options):
+    return SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options=options)
+
+
+def test_concurrent_writers_are_coalesced(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library, group_commit={"max_batch": 64, "max_delay": "2ms"})
+    try:
+
+        def writer(n):
+            for i in range(50):
+                store.set(f"t{n}:{i:03d}", i)
+            store.delete(f"t{n}:000")
+
+        threads = [threading.Thread(target=writer, args=(n,)) for n in range(8)]
+        for t in threads:
+            t.start()
+        for t in threads:
+            t.join()
+
+        assert store.count() == 8 * 49
+        assert store.get("t3:049") == 49
+        assert "t3:000" not in store
+    finally:
+        store.close()
+
+
+def test_failed_write_does_not_fail_its_batch(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library, group_commit={"max_delay": "20ms"}, max_value_size=16)
+    try:
+        errors = []
+
+        def write(key, value):
+            try:
+                store.set(key, value)
+            except SkyshelveError as exc:
+                errors.append(exc)
+
+        threads = [threading.Thread(target=write, args=(f"ok{i}", b"small")) for i in range(4)]
+        threads.append(threading.Thread(target=write, args=("big", b"x" * 64)))
+        for t in threads:
+            t.start()
+        for t in threads:
+            t.join()
+
+        assert [e.code for e in errors] == [ErrorCode.TOO_LARGE]
+        assert all(store.get(f"ok{i}") == b"small" for i in range(4))
+        assert "big" not in store
+    finally:
+        store.close()
+
+
+def test_group_commit_with_async_writes(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library, group_commit={})
+    futures = [store.set_async(f"k{i}", i) for i in range(100)]
+    store.set("sync", "write")
+    store.close()
+    for future in futures:
+        future.close()
+
+    store = _open(tmp_path, shared_library)
+    try:
+        assert store.count() == 101
+        assert store.get("sync") == "write"
+    finally:
+        store.close()
+
+
+@pytest.mark.parametrize(
+    "config, message",
+    [
+        ({"max_batch": -1}, "max_batch must be positive"),
+        ({"max_delay": "later"}, "invalid max_delay"),
+    ],
+)
+def test_invalid_group_commit_options(tmp_path, shared_library, config, message):
+    with pytest.raises(SkyshelveError, match=message):
+        _open(tmp_path, shared_library, group_commit=config)
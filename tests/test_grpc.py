@@ -0,0 +1,225 @@
+import shutil
+import struct
+import subprocess
+import sys
+import threading
+import time
+from pathlib import Path
+
+import pytest
+
+from conftest import free_addr
+
+PROTO = Path(__file__).resolve().parents[1] / "skyshelve.proto"
+
+
+def _varint(n: int) -> bytes:
+    out = bytearray()
+    while True:
+        byte = n & 0x7F
+        n >>= 7
+        if n:
+            out.append(byte | 0x80)
+        else:
+            out.append(byte)
+            return bytes(out)
+
+
+def _field(num: int, data: bytes) -> bytes:
+    return _varint(num << 3 | 2) + _varint(len(data)) + data
+
+
+def _parse(message: bytes) -> dict:
+    fields, offset = {}, 0
+    while offset < len(message):
+        tag = message[offset]
+        offset += 1
+        length, shift = 0, 0
+        while True:
+            byte = message[offset]
+            offset += 1
+            length |= (byte & 0x7F) << shift
+            shift += 7
+            if byte < 0x80:
+                break
+        if tag & 7 == 0:
+            fields[tag >> 3] = length
+            continue
+        fields[tag >> 3] = message[offset : offset + length]
+        offset += length
+    return fields
+
+
+def _curl_call(tmp_path, addr, method, message, token=None):
+    """Make one gRPC call with curl's HTTP/2 client; returns (status, messages)."""
+    body = tmp_path / "request.bin"
+    body.write_bytes(b"\x00" + struct.pack(">I", len(message)) + message)
+    out = tmp_path / "response.bin"
+    cmd = [
+        "curl", "-s", "--http2-prior-knowledge", "-D", "-", "-o", str(out),
+        "-H", "content-type: application/grpc", "-H", "te: trailers",
+        "--data-binary", f"@{body}", f"http://{addr}/skyshelve.v1.KV/{method}",
+    ]
+    if token is not None:
+        cmd += ["-H", f"authorization: Bearer {token}"]
+    result = subprocess.run(cmd, capture_output=True, check=True, text=True)
+    status = None
+    for line in result.stdout.splitlines():
+        name, _, value = line.partition(":")
+        if name.strip().lower() == "grpc-status":
+            status = int(value.strip())
+    raw = out.read_bytes() if out.exists() else b""
+    messages = []
+    while raw:
+        (length,) = struct.unpack(">I", raw[1:5])
+        messages.append(raw[5 : 5 + length])
+        raw = raw[5 + length :]
+    return status, messages
+
+
+@pytest.fixture
+def curl():
+    path = shutil.which("curl")
+    if path is None:
+        pytest.skip("curl is not available")
+    features = subprocess.run([path, "--version"], capture_output=True, text=True).stdout
+    if "HTTP2" not in features:
+        pytest.skip("curl was built without HTTP/2")
+    return path
+
+
+@pytest.fixture
+def served(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    addr = free_addr()
+    store.start_grpc_server(addr)
+    yield store, addr
+    store.stop_grpc_server()
+
+
+def test_grpc_get_put_over_http2(curl, served, tmp_path):
+    store, addr = served
+    store[b"greeting"] = b"hello"
+
+    status, messages = _curl_call(tmp_path, addr, "Get", _field(1, b"greeting"))
+    assert status == 0
+    assert _parse(messages[0])[1] == b"\x00hello"
+
+    status, messages = _curl_call(tmp_path, addr, "Put", _field(1, b"new") + _field(2, b"\x00from grpc"))
+    assert (status, messages) == (0, [b""])
+    assert store[b"new"] == b"from grpc"
+
+
+def test_grpc_errors_over_http2(curl, served, tmp_path):
+    _, addr = served
+    status, messages = _curl_call(tmp_path, addr, "Get", _field(1, b"missing"))
+    assert status == 5
+    assert messages == []
+
+    status, _ = _curl_call(tmp_path, addr, "Nope", b"")
+    assert status == 12
+
+
+def test_grpc_refuses_reserved_keys(curl, served, tmp_path):
+    store, addr = served
+    store.blob_put("b", b"data")
+    # The blob's manifest key.
+    manifest = b"\xffblob/\x00\x00\x00\x01b"
+
+    assert _curl_call(tmp_path, addr, "Get", _field(1, manifest)) == (5, [])
+    assert _curl_call(tmp_path, addr, "Put", _field(1, manifest) + _field(2, b"x"))[0] == 3
+    assert _curl_call(tmp_path, addr, "Delete", _field(1, manifest))[0] == 3
+    op = _field(2, manifest)
+    assert _curl_call(tmp_path, addr, "Apply", _field(1, op))[0] == 3
+    assert store.blob_get("b") == b"data"
+
+
+def test_grpc_auth_token(curl, skyshelve_factory, tmp_path):
+    store = skyshelve_factory(in_memory=True)
+    addr = free_addr()
+    store.start_grpc_server(addr, auth_token="secret")
+    try:
+        store[b"k"] = b"v"
+        assert _curl_call(tmp_path, addr, "Get", _field(1, b"k"))[0] == 16
+        assert _curl_call(tmp_path, addr, "Get", _field(1, b"k"), token="wrong")[0] == 16
+        assert _curl_call(tmp_path, addr, "Get", _field(1, b"k"), token="secret")[0] == 0
+    finally:
+        store.stop_grpc_server()
+
+
+def test_grpc_scan_stays_inside_prefix(curl, served, tmp_path):
+    store, addr = served
+    for key in (b"a1", b"b1", b"b2", b"b3", b"c1"):
+        store[key] = key
+
+    status, messages = _curl_call(tmp_path, addr, "Scan", _field(1, b"b") + _field(2, b"a"))
+    assert status == 0
+    assert [_parse(m)[1] for m in messages] == [b"b1", b"b2", b"b3"]
+
+    status, messages = _curl_call(tmp_path, addr, "Scan", _field(1, b"b") + _field(2, b"b2") + b"\x18\x01")
+    assert [_parse(m)[1] for m in messages] == [b"b2"]
+
+
+@pytest.fixture
+def kv_stub(served, tmp_path):
+    grpc = pytest.importorskip("grpc")
+    protoc = pytest.importorskip("grpc_tools.protoc")
+    out = tmp_path / "gen"
+    out.mkdir()
+    rc = protoc.main(["protoc", f"-I{PROTO.parent}", f"--python_out={out}", f"--grpc_python_out={out}", str(PROTO)])
+    assert rc == 0
+    sys.path.insert(0, str(out))
+    try:
+        import skyshelve_pb2
+        import skyshelve_pb2_grpc
+    finally:
+        sys.path.remove(str(out))
+    store, addr = served
+    channel = grpc.insecure_channel(addr)
+    yield grpc, skyshelve_pb2, skyshelve_pb2_grpc.KVStub(channel), store
+    channel.close()
+
+
+def test_grpcio_client_interop(kv_stub):
+    grpc, pb, stub, store = kv_stub
+    stub.Put(pb.PutRequest(key=b"a", value=b"\x00one"))
+    assert stub.Get(pb.GetRequest(key=b"a")).value == b"\x00one"
+    assert store[b"a"] == b"one"
+
+    stub.Apply(pb.ApplyRequest(ops=[
+        pb.Op(type=pb.SET, key=b"b", value=b"\x00two"),
+        pb.Op(type=pb.DELETE, key=b"a"),
+    ]))
+    assert b"a" not in store
+    assert [(e.key, e.value) for e in stub.Scan(pb.ScanRequest())] == [(b"b", b"\x00two")]
+
+    with pytest.raises(grpc.RpcError) as excinfo:
+        stub.Get(pb.GetRequest(key=b"a"))
+    assert excinfo.value.code() == grpc.StatusCode.NOT_FOUND
+
+
+def test_grpcio_watch_stream(kv_stub):
+    grpc, pb, stub, store = kv_stub
+    done = threading.Event()
+
+    def requests():
+        yield pb.WatchRequest(prefix=b"w/")
+        done.wait()
+
+    def writer():
+        # The subscription lands asynchronously, so keep writing until seen.
+        while not done.is_set():
+            store[b"other"] = b"y"
+            store[b"w/1"] = b"x"
+            time.sleep(0.05)
+
+    call = stub.Watch(requests())
+    thread = threading.Thread(target=writer)
+    thread.start()
+    try:
+        event = next(call)
+        assert (event.type, event.key, event.value) == (pb.SET, b"w/1", b"\x00x")
+    finally:
+        done.set()
+        thread.join()
+        call.cancel()
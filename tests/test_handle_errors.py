@@ -0,0 +1,35 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_last_error_is_tracked_per_store(shared_library):
+    first = SkyShelve(None, in_memory=True, lib_path=str(shared_library))
+    second = SkyShelve(None, in_memory=True, lib_path=str(shared_library))
+    try:
+        assert first.get("missing") is None
+        second.set("ok", 1)
+
+        assert first.last_error() is not None
+        assert "not found" in first.last_error().lower()
+        assert second.last_error() is None
+    finally:
+        first.close()
+        second.close()
+
+
+def test_last_error_clears_after_success(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.get("missing")
+    assert store.last_error() is not None
+
+    store.set("k", "v")
+    assert store.last_error() is None
+
+
+def test_last_error_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.last_error()
@@ -0,0 +1,58 @@
+import ctypes
+import threading
+
+import pytest
+
+from skyshelve import ErrorCode, SkyshelveError
+
+
+def test_many_handles_used_from_many_threads(skyshelve_factory):
+    stores = [skyshelve_factory(in_memory=True) for _ in range(16)]
+    errors = []
+
+    def worker(n):
+        try:
+            for i in range(100):
+                store = stores[(n + i) % len(stores)]
+                store.set(f"w{n}:{i}", i)
+                assert store.get(f"w{n}:{i}") == i
+        except Exception as exc:  # pragma: no cover - surfaced by the assert below
+            errors.append(exc)
+
+    threads = [threading.Thread(target=worker, args=(n,)) for n in range(16)]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+
+    assert errors == []
+    assert sum(store.count() for store in stores) == 16 * 100
+
+
+def test_closing_handles_concurrently_leaves_others_usable(skyshelve_factory):
+    keep = skyshelve_factory(in_memory=True)
+    doomed = [skyshelve_factory(in_memory=True) for _ in range(8)]
+    keep.set("k", "v")
+
+    threads = [threading.Thread(target=store.close) for store in doomed]
+    for t in threads:
+        t.start()
+    for _ in range(200):
+        assert keep.get("k") == "v"
+    for t in threads:
+        t.join()
+
+    assert keep.get("k") == "v"
+
+
+def test_stale_handle_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    handle = store._handle
+    store.close()
+
+    length = ctypes.c_int()
+    assert not store._lib.Get(handle, b"k", 1, length)
+    assert store._last_code() == ErrorCode.INVALID_HANDLE
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.get("k")
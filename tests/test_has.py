@@ -0,0 +1,38 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_has_reports_presence(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("present", b"")
+
+    assert store.has("present")
+    assert not store.has("absent")
+    assert "present" in store
+    assert "absent" not in store
+
+
+def test_has_after_delete(skyshelve_factory):
+    store = skyshelve_factory()
+    store["k"] = {"large": "x" * 100_000}
+    assert store.has("k")
+
+    del store["k"]
+    assert not store.has("k")
+
+
+def test_has_does_not_trigger_default_factory(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.default_factory = list
+
+    assert "missing" not in store
+    assert not store.has("missing")
+
+
+def test_has_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.has("k")
@@ -0,0 +1,67 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+@pytest.mark.parametrize("in_memory", [False, True])
+def test_fields_round_trip(skyshelve_factory, in_memory):
+    store = skyshelve_factory(in_memory=in_memory)
+    store.hset("user:1", "name", "ada")
+    store.hset("user:1", "avatar", b"\x89PNG")
+    store.hset("user:1", "langs", ["en", "fr"])
+
+    assert store.hget("user:1", "name") == "ada"
+    assert store.hget("user:1", "avatar") == b"\x89PNG"
+    assert store.hgetall("user:1") == {b"avatar": b"\x89PNG", b"langs": ["en", "fr"], b"name": "ada"}
+    assert list(store.hgetall("user:1")) == [b"avatar", b"langs", b"name"]
+
+
+def test_hset_overwrites_one_field(skyshelve_factory):
+    store = skyshelve_factory()
+    store.hset("h", "a", "1")
+    store.hset("h", "b", "2")
+    store.hset("h", "a", "3")
+
+    assert store.hgetall("h") == {b"a": "3", b"b": "2"}
+
+
+def test_missing_fields_and_hashes(skyshelve_factory):
+    store = skyshelve_factory()
+    store.hset("h", "a", "1")
+
+    assert store.hget("h", "zzz") is None
+    assert store.hget("h", "zzz", default="none") == "none"
+    assert store.hget("other", "a") is None
+    assert store.hgetall("other") == {}
+
+
+def test_hdel(skyshelve_factory):
+    store = skyshelve_factory()
+    store.hset("h", "a", "1")
+    store.hset("h", "b", "2")
+
+    store.hdel("h", "a")
+    store.hdel("h", "a")
+
+    assert store.hgetall("h") == {b"b": "2"}
+
+
+def test_hashes_do_not_share_fields_or_show_up_as_keys(skyshelve_factory):
+    store = skyshelve_factory()
+    store.hset("h", "x", "1")
+    store.hset("h2", "x", "2")
+    store.hset("h", "x2", "3")
+
+    assert store.hgetall("h") == {b"x": "1", b"x2": "3"}
+    assert store.hgetall("h2") == {b"x": "2"}
+    assert store.scan() == []
+
+
+def test_hash_on_a_closed_store_fails(skyshelve_factory):
+    store = skyshelve_factory()
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.hset("h", "a", "1")
+    with pytest.raises(SkyshelveError):
+        store.hget("h", "a")
@@ -0,0 +1,119 @@
+import base64
+import json
+import urllib.error
+import urllib.request
+
+import pytest
+
+from conftest import free_addr
+
+
+def _request(addr, method, path, body=None, token=None):
+    request = urllib.request.Request(f"http://{addr}{path}", data=body, method=method)
+    if token:
+        request.add_header("Authorization", f"Bearer {token}")
+    try:
+        with urllib.request.urlopen(request, timeout=5) as response:
+            return response.status, response.read()
+    except urllib.error.HTTPError as exc:
+        return exc.code, exc.read()
+
+
+@pytest.fixture
+def served(skyshelve_factory):
+    store = skyshelve_factory()
+    addr = free_addr()
+    store.start_http_server(addr)
+    yield store, addr
+    store.stop_http_server()
+
+
+def test_keys_round_trip(served):
+    store, addr = served
+    store.set("from-python", b"bytes")
+
+    assert _request(addr, "GET", "/keys/from-python") == (200, b"\x00bytes")
+    assert _request(addr, "PUT", "/keys/nested/key", b"\x01over http")[0] == 204
+    assert store.get("nested/key") == "over http"
+    assert _request(addr, "DELETE", "/keys/nested/key")[0] == 204
+    assert "nested/key" not in store
+    assert _request(addr, "GET", "/keys/nested/key")[0] == 404
+
+
+def test_reserved_keys_are_not_served(served):
+    store, addr = served
+    store.blob_put("b", b"data")
+    # The blob's manifest key.
+    manifest = "%FFblob/%00%00%00%01b"
+    batch = [{"op": "delete", "key": base64.b64encode(b"\xffblob/\x00\x00\x00\x01b").decode()}]
+
+    assert _request(addr, "GET", f"/keys/{manifest}")[0] == 404
+    assert _request(addr, "PUT", f"/keys/{manifest}", b"overwritten")[0] == 400
+    assert _request(addr, "DELETE", f"/keys/{manifest}")[0] == 400
+    status, body = _request(addr, "POST", "/batch", json.dumps(batch).encode())
+    assert status == 400
+    assert b"reserved" in body
+    assert store.blob_get("b") == b"data"
+
+
+def test_scan_pages(served):
+    store, addr = served
+    for i in range(5):
+        store.set(f"p:{i}", f"v{i}")
+    store.set("q", "other")
+
+    status, body = _request(addr, "GET", "/scan?prefix=p:&limit=3")
+    page = json.loads(body)
+    assert status == 200
+    assert [base64.b64decode(e["key"]) for e in page["entries"]] == [b"p:0", b"p:1", b"p:2"]
+    assert base64.b64decode(page["entries"][0]["value"]) == b"\x01v0"
+
+    page = json.loads(_request(addr, "GET", f"/scan?prefix=p:&limit=3&start={page['next']}")[1])
+    assert [base64.b64decode(e["key"]) for e in page["entries"]] == [b"p:3", b"p:4"]
+    assert "next" not in page
+
+
+def test_batch_is_applied(served):
+    store, addr = served
+    store.set("old", "x")
+    batch = [
+        {"op": "set", "key": base64.b64encode(b"new").decode(), "value": base64.b64encode(b"\x01y").decode()},
+        {"op": "delete", "key": base64.b64encode(b"old").decode()},
+    ]
+
+    assert _request(addr, "POST", "/batch", json.dumps(batch).encode())[0] == 204
+    assert store.scan() == [(b"new", "y")]
+
+    status, body = _request(addr, "POST", "/batch", b'[{"op": "merge", "key": ""}]')
+    assert status == 400
+    assert b"unknown op" in body
+
+
+def test_bad_requests(served):
+    _, addr = served
+
+    assert _request(addr, "PUT", "/keys/k?ttl=soon", b"v")[0] == 400
+    assert _request(addr, "GET", "/scan?limit=0")[0] == 400
+
+
+def test_auth_token_is_required(skyshelve_factory):
+    store = skyshelve_factory()
+    addr = free_addr()
+    store.start_http_server(addr, auth_token="s3cret")
+    try:
+        store.set("k", b"v")
+        assert _request(addr, "GET", "/keys/k")[0] == 401
+        assert _request(addr, "GET", "/keys/k", token="wrong")[0] == 401
+        assert _request(addr, "GET", "/keys/k", token="s3cret") == (200, b"\x00v")
+    finally:
+        store.stop_http_server()
+
+
+def test_close_stops_the_server(skyshelve_factory):
+    store = skyshelve_factory()
+    addr = free_addr()
+    store.start_http_server(addr)
+    store.close()
+
+    with pytest.raises(OSError):
+        urllib.request.urlopen(f"http://{addr}/keys/k", timeout=2)
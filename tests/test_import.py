@@ -0,0 +1,185 @@
+import struct
+import time
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+# --- Redis RDB files -------------------------------------------------------
+
+
+def _rdb_len(n: int) -> bytes:
+    if n < 64:
+        return bytes([n])
+    if n < 16384:
+        return bytes([0x40 | n >> 8, n & 0xFF])
+    return b"\x80" + struct.pack(">I", n)
+
+
+def _rdb_str(data) -> bytes:
+    data = data.encode() if isinstance(data, str) else data
+    return _rdb_len(len(data)) + data
+
+
+def _rdb(*entries: bytes, version: bytes = b"0009") -> bytes:
+    head = b"REDIS" + version + b"\xfa" + _rdb_str("redis-ver") + _rdb_str("7.0.0")
+    return head + b"\xfe\x00\xfb" + _rdb_len(len(entries)) + b"\x00" + b"".join(entries) + b"\xff" + bytes(8)
+
+
+def _expires(ms: int) -> bytes:
+    return b"\xfc" + struct.pack("<Q", ms)
+
+
+@pytest.fixture
+def rdb_file(tmp_path):
+    now_ms = int(time.time() * 1000)
+    data = _rdb(
+        b"\x00" + _rdb_str("greeting") + _rdb_str("hello"),
+        b"\x00" + _rdb_str("count") + b"\xc0\x2a",
+        _expires(now_ms + 60_000) + b"\x00" + _rdb_str("session") + _rdb_str("token"),
+        _expires(1_000) + b"\x00" + _rdb_str("expired") + _rdb_str("gone"),
+        b"\x04" + _rdb_str("user:1") + _rdb_len(2) + b"".join(map(_rdb_str, ["name", "ada", "lang", "en"])),
+        b"\x02" + _rdb_str("tags") + _rdb_len(2) + _rdb_str("red") + _rdb_str("blue"),
+        b"\x05" + _rdb_str("board") + _rdb_len(2)
+        + _rdb_str("ann") + struct.pack("<d", 30) + _rdb_str("bob") + struct.pack("<d", 12.5),
+        b"\x01" + _rdb_str("jobs") + _rdb_len(2) + _rdb_str("first") + _rdb_str("second"),
+        b"\xfe\x01" + b"\x00" + _rdb_str("db1") + _rdb_str("merged"),
+    )
+    path = tmp_path / "dump.rdb"
+    path.write_bytes(data)
+    return path
+
+
+def test_rdb_maps_redis_types_onto_store_structures(skyshelve_factory, rdb_file):
+    store = skyshelve_factory()
+    store.import_rdb(rdb_file)
+
+    assert store.get_raw("greeting") == b"hello"
+    assert store.get_raw("count") == b"42"
+    assert store.get_raw("session") == b"token"
+    assert store.get_raw("expired") is None
+    assert store.get_raw("db1") == b"merged"
+    assert store.hgetall("user:1") == {b"lang": b"en", b"name": b"ada"}
+    assert store.smembers("tags") == [b"blue", b"red"]
+    assert store.zrange_by_score("board") == [(b"bob", 12.5), (b"ann", 30.0)]
+    assert store.queue_pop("jobs")[1] == b"first"
+    assert store.queue_pop("jobs")[1] == b"second"
+
+
+def test_rdb_strings_keep_their_expiry(skyshelve_factory, rdb_file, tmp_path):
+    store = skyshelve_factory()
+    store.import_rdb(rdb_file)
+    dump = tmp_path / "check.ndjson"
+    store.dump(dump, "ndjson")
+
+    assert dump.read_text().count('"expires_at"') == 1
+
+
+@pytest.mark.parametrize(
+    "data, message",
+    [
+        (b"NOTREDIS0", "not an RDB file"),
+        (b"REDIS", "not an RDB file"),
+        (_rdb(version=b"0099"), "unsupported RDB version"),
+        (_rdb(b"\xf7" + _rdb_len(1)), "module data cannot be imported"),
+        (_rdb(b"\x0f" + _rdb_str("stream") + _rdb_str("listpacks")), "unsupported value type 15"),
+        (_rdb(b"\x00" + _rdb_str("cut"))[:-10], "unexpected EOF"),
+    ],
+)
+def test_bad_rdb_files_are_rejected(skyshelve_factory, tmp_path, data, message):
+    path = tmp_path / "bad.rdb"
+    path.write_bytes(data)
+
+    with pytest.raises(SkyshelveError, match=message):
+        skyshelve_factory().import_rdb(path)
+
+
+def test_missing_rdb_file(skyshelve_factory, tmp_path):
+    with pytest.raises(SkyshelveError, match="no such file"):
+        skyshelve_factory().import_rdb(tmp_path / "missing.rdb")
+
+
+# --- LevelDB directories ---------------------------------------------------
+
+
+def _crc32c(data: bytes) -> int:
+    crc = 0xFFFFFFFF
+    for byte in data:
+        crc ^= byte
+        for _ in range(8):
+            crc = (crc >> 1) ^ (0x82F63B78 if crc & 1 else 0)
+    return crc ^ 0xFFFFFFFF
+
+
+def _log_record(data: bytes) -> bytes:
+    crc = _crc32c(b"\x01" + data)
+    masked = (((crc >> 15) | (crc << 17)) + 0xA282EAD8) & 0xFFFFFFFF
+    return struct.pack("<IHB", masked, len(data), 1) + data
+
+
+def _varint(n: int) -> bytes:
+    out = bytearray()
+    while n >= 0x80:
+        out.append(n & 0x7F | 0x80)
+        n >>= 7
+    out.append(n)
+    return bytes(out)
+
+
+def _prefixed(data: bytes) -> bytes:
+    return _varint(len(data)) + data
+
+
+def _batch(seq: int, *ops) -> bytes:
+    body = b""
+    for op in ops:
+        if op[0] == "put":
+            body += b"\x01" + _prefixed(op[1]) + _prefixed(op[2])
+        else:
+            body += b"\x00" + _prefixed(op[1])
+    return struct.pack("<QI", seq, len(ops)) + body
+
+
+def _leveldb(directory, log_number=3):
+    directory.mkdir()
+    edit = (
+        _varint(1) + _prefixed(b"leveldb.BytewiseComparator")
+        + _varint(2) + _varint(log_number)
+        + _varint(3) + _varint(log_number + 1)
+        + _varint(4) + _varint(0)
+    )
+    (directory / "MANIFEST-000002").write_bytes(_log_record(edit))
+    (directory / "CURRENT").write_text("MANIFEST-000002\n")
+    return directory
+
+
+def test_leveldb_log_entries_are_imported(skyshelve_factory, tmp_path):
+    db = _leveldb(tmp_path / "ldb")
+    (db / "000001.log").write_bytes(_log_record(_batch(1, ("put", b"stale", b"old log"))))
+    (db / "000003.log").write_bytes(
+        _log_record(_batch(10, ("put", b"a", b"1"), ("put", b"b", b"2"), ("del", b"a")))
+        + _log_record(_batch(13, ("put", b"b", b"\x01two"), ("put", b"c", b"3")))
+    )
+    store = skyshelve_factory()
+    store.set("kept", "existing")
+
+    store.import_leveldb(db)
+
+    assert store.scan() == [(b"b", "two"), (b"c", b"3"), (b"kept", "existing")]
+
+
+@pytest.mark.parametrize(
+    "corrupt, message",
+    [
+        (lambda db: (db / "CURRENT").unlink(), "not a LevelDB directory"),
+        (lambda db: (db / "CURRENT").write_text("../escape\n"), "not a manifest"),
+        (lambda db: (db / "000003.log").write_bytes(b"\x00\x00\x00\x00\x01\x00\x01x"), "corrupt log record"),
+        (lambda db: (db / "000003.log").write_bytes(_log_record(b"short")), "corrupt write batch"),
+    ],
+)
+def test_bad_leveldb_directories_are_rejected(skyshelve_factory, tmp_path, corrupt, message):
+    db = _leveldb(tmp_path / "ldb")
+    corrupt(db)
+
+    with pytest.raises(SkyshelveError, match=message):
+        skyshelve_factory().import_leveldb(db)
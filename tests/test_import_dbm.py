@@ -0,0 +1,98 @@
+import dbm.dumb
+import shelve
+import sqlite3
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def _sqlite_dbm(path, items):
+    # The layout written by Python 3.13's dbm.sqlite3.
+    conn = sqlite3.connect(path)
+    conn.execute("CREATE TABLE Dict (key BLOB UNIQUE NOT NULL, value BLOB NOT NULL)")
+    conn.executemany("INSERT INTO Dict (key, value) VALUES (?, ?)", items)
+    conn.commit()
+    conn.close()
+
+
+def test_import_dumb_dbm_values_come_back_as_bytes(skyshelve_factory, tmp_path):
+    name = str(tmp_path / "legacy")
+    with dbm.dumb.open(name, "c") as db:
+        db[b"alpha"] = b"one"
+        db[b"beta"] = b"\x00\xffbinary"
+        db["gamma"] = "three"
+
+    store = skyshelve_factory(in_memory=True)
+    store.import_dbm(name)
+
+    assert store.get(b"alpha") == b"one"
+    assert store.get(b"beta") == b"\x00\xffbinary"
+    assert store.get(b"gamma") == b"three"
+    assert store.count() == 3
+
+
+def test_import_shelf_returns_original_objects(skyshelve_factory, tmp_path):
+    name = str(tmp_path / "shelf")
+    with shelve.Shelf(dbm.dumb.open(name, "c")) as shelf:
+        shelf["config"] = {"retries": 3, "hosts": ["a", "b"]}
+        shelf["numbers"] = [1, 2.5, None]
+        shelf["label"] = "text"
+
+    store = skyshelve_factory(in_memory=True)
+    store.import_dbm(tmp_path / "shelf")
+
+    assert store.get("config") == {"retries": 3, "hosts": ["a", "b"]}
+    assert store.get("numbers") == [1, 2.5, None]
+    assert store.get("label") == "text"
+
+
+def test_import_sqlite_dbm(skyshelve_factory, tmp_path):
+    path = tmp_path / "data.sqlite"
+    _sqlite_dbm(path, [(b"k1", b"v1"), (b"k2", b"v2")])
+
+    store = skyshelve_factory(in_memory=False)
+    store.import_dbm(path)
+
+    assert store.get(b"k1") == b"v1"
+    assert store.get(b"k2") == b"v2"
+
+
+def test_import_overwrites_existing_keys(skyshelve_factory, tmp_path):
+    name = str(tmp_path / "legacy")
+    with dbm.dumb.open(name, "c") as db:
+        db[b"key"] = b"imported"
+
+    store = skyshelve_factory(in_memory=True)
+    store[b"key"] = "existing"
+    store[b"other"] = "kept"
+    store.import_dbm(name)
+
+    assert store.get(b"key") == b"imported"
+    assert store.get(b"other") == "kept"
+
+
+def test_import_missing_database_raises(skyshelve_factory, tmp_path):
+    store = skyshelve_factory(in_memory=True)
+    with pytest.raises(SkyshelveError, match="no such file"):
+        store.import_dbm(tmp_path / "missing")
+
+
+def test_import_unrecognised_file_raises(skyshelve_factory, tmp_path):
+    path = tmp_path / "notes.txt"
+    path.write_bytes(b"just some text, not a dbm file")
+
+    store = skyshelve_factory(in_memory=True)
+    with pytest.raises(SkyshelveError, match="not a GDBM, dumb dbm or SQLite dbm file"):
+        store.import_dbm(path)
+    assert store.count() == 0
+
+
+def test_import_corrupt_dumb_directory_raises(skyshelve_factory, tmp_path):
+    name = tmp_path / "broken"
+    (tmp_path / "broken.dat").write_bytes(b"")
+    (tmp_path / "broken.dir").write_text("this is not a dumb dbm entry\n")
+
+    store = skyshelve_factory(in_memory=True)
+    with pytest.raises(SkyshelveError, match=r"broken\.dir line 1"):
+        store.import_dbm(name)
@@ -0,0 +1,49 @@
+import threading
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_incr_creates_and_updates_counter(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.incr("hits") == 1
+    assert store.incr("hits", 9) == 10
+    assert store.incr("hits", -15) == -5
+    assert store.get("hits") == b"-5"
+
+
+def test_incr_is_atomic_across_threads(skyshelve_factory):
+    store = skyshelve_factory()
+
+    def worker():
+        for _ in range(100):
+            store.incr("counter")
+
+    threads = [threading.Thread(target=worker) for _ in range(4)]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+
+    assert store.incr("counter", 0) == 400
+
+
+def test_incr_rejects_non_integer_values(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("name", "alice")
+
+    with pytest.raises(SkyshelveError, match="not an integer"):
+        store.incr("name")
+    assert store.get("name") == "alice"
+
+
+def test_incr_detects_overflow(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.incr("big", 2**63 - 1)
+
+    with pytest.raises(SkyshelveError, match="overflow"):
+        store.incr("big")
+    assert store.incr("big", 0) == 2**63 - 1
+
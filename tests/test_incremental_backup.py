@@ -0,0 +1,83 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_incremental_chain_restores_latest_state(tmp_path, skyshelve_factory, shared_library):
+    source = skyshelve_factory()
+    source.set("a", 1)
+    source.set("b", 2)
+    version = source.backup_since(0, tmp_path / "full.bak")
+    assert version > 0
+
+    source.set("a", 10)
+    source.set("c", 3)
+    source.delete("b")
+    version = source.backup_since(version, tmp_path / "delta1.bak")
+
+    target = SkyShelve(None, in_memory=True, lib_path=str(shared_library))
+    try:
+        target.restore_into(tmp_path / "full.bak")
+        assert target.scan() == [(b"a", 1), (b"b", 2)]
+        target.restore_into(tmp_path / "delta1.bak")
+        assert target.scan() == [(b"a", 10), (b"c", 3)]
+    finally:
+        target.close()
+
+
+def test_empty_delta_keeps_version(tmp_path, skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+    version = store.backup_since(0, tmp_path / "full.bak")
+
+    assert store.backup_since(version, tmp_path / "empty.bak") == version
+    store.set("b", 2)
+    assert store.backup_since(version, tmp_path / "delta.bak") > version
+
+
+def test_delta_only_holds_changes(tmp_path, skyshelve_factory, shared_library):
+    store = skyshelve_factory(in_memory=True)
+    store.set("old", 1)
+    version = store.backup_since(0, tmp_path / "full.bak")
+    store.set("new", 2)
+    store.backup_since(version, tmp_path / "delta.bak")
+
+    target = SkyShelve(None, in_memory=True, lib_path=str(shared_library))
+    try:
+        target.restore_into(tmp_path / "delta.bak")
+        assert target.scan() == [(b"new", 2)]
+    finally:
+        target.close()
+
+
+def test_backup_since_requires_badger(tmp_path, shared_library):
+    store = SkyShelve(None, lib_path=str(shared_library), options={"backend": "memory"})
+    try:
+        store.set("a", 1)
+        with pytest.raises(SkyshelveError):
+            store.backup_since(5, tmp_path / "delta.bak")
+    finally:
+        store.close()
+
+
+def test_restore_with_options_decodes_codec_backups(tmp_path, shared_library):
+    options = {"compression": {"algorithm": "zstd"}, "checksums": True}
+    source = SkyShelve(str(tmp_path / "src"), lib_path=str(shared_library), options=options)
+    try:
+        source.set("doc", "x" * 4096)
+        source.backup(tmp_path / "codec.bak")
+    finally:
+        source.close()
+
+    SkyShelve.restore(str(tmp_path / "dst"), tmp_path / "codec.bak", lib_path=str(shared_library), options=options)
+
+    restored = SkyShelve(str(tmp_path / "dst"), lib_path=str(shared_library), options=options)
+    try:
+        assert restored.get("doc") == "x" * 4096
+    finally:
+        restored.close()
+
+
+def test_restore_with_invalid_options(tmp_path, shared_library):
+    with pytest.raises(SkyshelveError, match="unknown field"):
+        SkyShelve.restore(str(tmp_path / "dst"), tmp_path / "x.bak", lib_path=str(shared_library), options={"bogus": 1})
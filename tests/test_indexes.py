@@ -0,0 +1,122 @@
+import json
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _indexed(path, shared_library):
+    return SkyShelve(str(path), lib_path=str(shared_library), options={"indexes": True})
+
+
+@pytest.fixture
+def indexed(tmp_path, shared_library):
+    store = _indexed(tmp_path / "db", shared_library)
+    try:
+        yield store
+    finally:
+        store.close()
+
+
+def _doc(**fields):
+    return json.dumps(fields)
+
+
+def test_json_path_index_tracks_writes(indexed):
+    indexed.set("user:1", _doc(email="a@example.com", age=30))
+    indexed.create_index("by_email", "$.email")
+    indexed.set("user:2", _doc(email="b@example.com", age=30))
+    indexed.set("user:3", _doc(email="a@example.com", age=41))
+
+    assert indexed.query_index("by_email", "a@example.com") == [b"user:1", b"user:3"]
+
+    indexed.set("user:1", _doc(email="c@example.com"))
+    indexed.delete("user:3")
+    assert indexed.query_index("by_email", "a@example.com") == []
+    assert indexed.query_index("by_email", "c@example.com") == [b"user:1"]
+
+
+def test_index_entries_commit_with_batches(indexed):
+    indexed.create_index("by_team", "team")
+    indexed.apply([("set", b"u1", _doc(team="red")), ("set", b"u2", _doc(team="red"))])
+
+    assert indexed.query_index("by_team", "red") == [b"u1", b"u2"]
+
+
+def test_numbers_booleans_and_arrays(indexed):
+    indexed.create_index("by_age", "$.age")
+    indexed.create_index("by_active", "$.active")
+    indexed.create_index("by_tag", "$.tags")
+    indexed.set("a", _doc(age=30, active=True, tags=["x", "y"]))
+    indexed.set("b", _doc(age=31, active=False, tags=["y"]))
+
+    assert indexed.query_index("by_age", 30) == [b"a"]
+    assert indexed.query_index("by_active", False) == [b"b"]
+    assert indexed.query_index("by_tag", "y") == [b"a", b"b"]
+
+
+def test_non_json_values_are_not_indexed(indexed):
+    indexed.create_index("by_email", "$.email")
+    indexed.set("pickled", {"email": "a@example.com"})
+    indexed.set("raw", b'{"email": "a@example.com"}')
+
+    assert indexed.query_index("by_email", "a@example.com") == [b"raw"]
+
+
+def test_json_indexes_survive_reopen(tmp_path, shared_library):
+    store = _indexed(tmp_path / "db", shared_library)
+    store.create_index("by_email", "$.email")
+    store.close()
+
+    store = _indexed(tmp_path / "db", shared_library)
+    try:
+        store.set("u", _doc(email="a@example.com"))
+        assert store.list_indexes() == [{"name": "by_email", "json_path": "$.email"}]
+        assert store.query_index("by_email", "a@example.com") == [b"u"]
+    finally:
+        store.close()
+
+
+def test_callback_index(indexed):
+    indexed.set("apple", 3)
+    indexed.create_index_callback("by_parity", lambda key, value: "even" if value % 2 == 0 else "odd")
+    indexed.set("banana", 4)
+    indexed.set("cherry", 5)
+    indexed.create_index_callback("by_initial", lambda key, value: key[:1] if value > 3 else None)
+
+    assert indexed.query_index("by_parity", "odd") == [b"apple", b"cherry"]
+    assert indexed.query_index("by_parity", "even") == [b"banana"]
+    assert indexed.query_index("by_initial", b"a") == []
+    assert indexed.query_index("by_initial", b"c") == [b"cherry"]
+    assert [info["callback"] for info in indexed.list_indexes()] == [True, True]
+
+
+def test_drop_index(indexed):
+    indexed.create_index("by_email", "$.email")
+    indexed.set("u", _doc(email="a@example.com"))
+
+    indexed.drop_index("by_email")
+
+    assert indexed.list_indexes() == []
+    with pytest.raises(SkyshelveError, match="no index named"):
+        indexed.query_index("by_email", "a@example.com")
+    with pytest.raises(SkyshelveError, match="no index named"):
+        indexed.drop_index("by_email")
+
+
+def test_duplicate_and_invalid_indexes_are_rejected(indexed):
+    indexed.create_index("by_email", "$.email")
+    with pytest.raises(SkyshelveError, match="by_email"):
+        indexed.create_index("by_email", "$.other")
+    for path in ("$.items[", "$.items[x]", "$.a..b"):
+        with pytest.raises(SkyshelveError, match="invalid json path"):
+            indexed.create_index("bad_path", path)
+
+
+def test_indexes_need_the_open_option(skyshelve_factory):
+    store = skyshelve_factory()
+
+    with pytest.raises(SkyshelveError, match="not opened with indexes"):
+        store.create_index("by_email", "$.email")
+    with pytest.raises(SkyshelveError, match="not opened with indexes"):
+        store.query_index("by_email", "a@example.com")
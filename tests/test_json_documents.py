@@ -0,0 +1,111 @@
+import json
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_json_get_reads_one_member(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("doc", json.dumps({"user": {"email": "a@example.com"}, "items": [1, 2, 3]}))
+
+    assert store.json_get("doc", "$.user.email") == "a@example.com"
+    assert store.json_get("doc", "items[2]") == 3
+    assert store.json_get("doc") == {"user": {"email": "a@example.com"}, "items": [1, 2, 3]}
+
+
+def test_json_get_defaults_for_missing_keys_and_members(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("doc", json.dumps({"a": None}))
+
+    assert store.json_get("missing", "$.a") is None
+    assert store.json_get("doc", "$.b", default="none") == "none"
+    assert store.json_get("doc", "$.a", default="none") is None
+
+
+def test_json_set_keeps_the_value_type(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("str", json.dumps({"count": 1}))
+    store.set("raw", json.dumps({"count": 1}).encode())
+
+    store.json_set("str", "$.count", 2)
+    store.json_set("raw", "$.count", 2)
+
+    assert json.loads(store.get("str")) == {"count": 2}
+    assert json.loads(store.get("raw")) == {"count": 2}
+    assert isinstance(store.get("str"), str)
+    assert isinstance(store.get("raw"), bytes)
+
+
+def test_json_set_creates_missing_objects(skyshelve_factory):
+    store = skyshelve_factory()
+
+    store.json_set("doc", "$.user.tags", ["a"])
+    store.json_set("doc", "$.user.tags[1]", "b")
+
+    assert store.json_get("doc") == {"user": {"tags": ["a", "b"]}}
+
+
+def test_json_set_root_replaces_the_document(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("doc", json.dumps({"old": True}))
+
+    store.json_set("doc", "$", {"new": True})
+
+    assert store.json_get("doc") == {"new": True}
+
+
+def test_json_merge_patch(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("doc", json.dumps({"name": "a", "tags": ["x"], "nested": {"keep": 1, "drop": 2}}))
+
+    store.json_merge_patch("doc", {"name": "b", "nested": {"drop": None, "add": 3}})
+
+    assert store.json_get("doc") == {"name": "b", "tags": ["x"], "nested": {"keep": 1, "add": 3}}
+
+
+def test_json_merge_patch_on_a_missing_key(skyshelve_factory):
+    store = skyshelve_factory()
+
+    store.json_merge_patch("doc", {"a": 1, "b": None})
+
+    assert store.json_get("doc") == {"a": 1}
+
+
+def test_non_json_values_are_rejected(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("pickled", {"a": 1})
+    store.set("text", "not json")
+
+    for call in (
+        lambda: store.json_get("pickled", "$.a"),
+        lambda: store.json_set("text", "$.a", 1),
+        lambda: store.json_merge_patch("text", {"a": 1}),
+    ):
+        with pytest.raises(SkyshelveError, match="value is not JSON"):
+            call()
+    assert store.get("text") == "not json"
+
+
+def test_invalid_paths_are_rejected(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("doc", json.dumps({"items": [1]}))
+
+    with pytest.raises(SkyshelveError, match="invalid json path"):
+        store.json_get("doc", "$.items[x]")
+    with pytest.raises(SkyshelveError, match="invalid json path"):
+        store.json_set("doc", "$.items[", 1)
+
+
+def test_json_updates_maintain_indexes(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"indexes": True})
+    try:
+        store.create_index("by_email", "$.email")
+        store.set("u", json.dumps({"email": "a@example.com"}))
+
+        store.json_set("u", "$.email", "b@example.com")
+
+        assert store.query_index("by_email", "a@example.com") == []
+        assert store.query_index("by_email", "b@example.com") == [b"u"]
+    finally:
+        store.close()
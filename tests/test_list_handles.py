@@ -0,0 +1,63 @@
+from skyshelve import SkyShelve
+
+
+def _entry(handle):
+    return next((e for e in SkyShelve.list_handles() if e["id"] == handle), None)
+
+
+def test_list_handles_describes_open_stores(tmp_path, shared_library, skyshelve_factory):
+    memory = skyshelve_factory(in_memory=True)
+    disk = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library))
+    sqlite = SkyShelve(f"sqlite:{tmp_path / 'x.db'}", lib_path=str(shared_library))
+    try:
+        entry = _entry(memory.handle)
+        assert entry["backend"] == "badger"
+        assert entry["in_memory"] is True
+        assert "path" not in entry
+        assert entry["opened_at"]
+        assert _entry(disk.handle)["path"] == str(tmp_path / "db")
+        assert _entry(sqlite.handle)["backend"] == "sqlite"
+        assert _entry(sqlite.handle)["path"] == str(tmp_path / "x.db")
+        ids = [e["id"] for e in SkyShelve.list_handles()]
+        assert ids == sorted(ids)
+    finally:
+        disk.close()
+        sqlite.close()
+
+    assert _entry(disk.handle) is None
+    assert disk.handle == 0
+
+
+def test_list_handles_includes_snapshots(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with store.snapshot() as snap:
+        assert _entry(snap._handle)["snapshot_of"] == store.handle
+    assert _entry(snap._handle) is None
+
+
+def test_options_path_is_redacted_to_location(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "o.db"), lib_path=str(shared_library), options={"backend": "bolt"})
+    try:
+        assert _entry(store.handle)["backend"] == "bolt"
+        assert _entry(store.handle)["path"] == str(tmp_path / "o.db")
+    finally:
+        store.close()
+
+
+def test_is_open(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    assert store.is_open()
+
+    store.close()
+
+    assert not store.is_open()
+
+
+def test_is_open_after_close_all(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    SkyShelve.close_all()
+
+    assert store.handle != 0
+    assert not store.is_open()
@@ -0,0 +1,61 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_log_callback_receives_badger_lines(tmp_path, shared_library):
+    lines = []
+
+    def record(level, component, message):
+        lines.append((level, component, message))
+
+    SkyShelve.set_log_callback(record, level="debug", lib_path=str(shared_library))
+    try:
+        store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library))
+        store.set("k", 1)
+        store.close()
+    finally:
+        SkyShelve.set_log_callback(None)
+
+    assert lines
+    assert all(0 <= level <= 3 for level, _, _ in lines)
+    assert any(component == "badger" for _, component, _ in lines)
+
+    count = len(lines)
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library))
+    store.close()
+    assert len(lines) == count
+
+
+def test_log_callback_level_filters(tmp_path, shared_library):
+    lines = []
+    SkyShelve.set_log_callback(lambda level, *_: lines.append(level), level="error", lib_path=str(shared_library))
+    try:
+        store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library))
+        store.close()
+    finally:
+        SkyShelve.set_log_callback(None)
+
+    assert all(level == 3 for level in lines)
+
+
+def test_log_file(tmp_path, shared_library):
+    log_path = tmp_path / "skyshelve.log"
+    SkyShelve.set_log_file(log_path, level=0, lib_path=str(shared_library))
+    try:
+        store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library))
+        store.close()
+    finally:
+        SkyShelve.set_log_file(None)
+
+    text = log_path.read_text()
+    assert "badger" in text
+
+
+def test_invalid_log_settings(tmp_path, shared_library):
+    with pytest.raises(SkyshelveError, match="invalid log level"):
+        SkyShelve.set_log_callback(lambda *args: None, level=7, lib_path=str(shared_library))
+    with pytest.raises(SkyshelveError, match="invalid log level"):
+        SkyShelve.set_log_file(tmp_path / "x.log", level=-1, lib_path=str(shared_library))
+    with pytest.raises(SkyshelveError):
+        SkyShelve.set_log_file(tmp_path / "missing" / "x.log", lib_path=str(shared_library))
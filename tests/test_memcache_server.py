@@ -0,0 +1,123 @@
+import socket
+import time
+
+import pytest
+
+from conftest import free_addr
+
+
+class _Client:
+    """Sends memcached text commands and reads replies up to their terminator."""
+
+    def __init__(self, addr: str) -> None:
+        host, port = addr.rsplit(":", 1)
+        self.sock = socket.create_connection((host, int(port)), timeout=5)
+        self.reader = self.sock.makefile("rb")
+
+    def close(self) -> None:
+        self.reader.close()
+        self.sock.close()
+
+    def line(self, command: str, data: bytes = None) -> bytes:
+        payload = command.encode() + b"\r\n"
+        if data is not None:
+            payload += data + b"\r\n"
+        self.sock.sendall(payload)
+        return self.reader.readline()[:-2]
+
+    def get(self, *keys: str):
+        self.sock.sendall(f"get {' '.join(keys)}\r\n".encode())
+        items = {}
+        while True:
+            header = self.reader.readline()[:-2].split()
+            if header == [b"END"]:
+                return items
+            _, key, flags, size = header
+            items[key.decode()] = (int(flags), self.reader.read(int(size) + 2)[:-2])
+
+
+@pytest.fixture
+def client(skyshelve_factory):
+    store = skyshelve_factory()
+    addr = free_addr()
+    store.start_memcache_server(addr)
+    conn = _Client(addr)
+    yield store, conn
+    conn.close()
+    store.stop_memcache_server()
+
+
+def test_set_get_delete(client):
+    store, conn = client
+    store.set("py", "from python")
+
+    assert conn.get("py", "missing") == {"py": (0, b"\x01from python")}
+    assert conn.line("set mc 42 0 4", b"\x00raw") == b"STORED"
+    assert conn.get("mc") == {"mc": (42, b"\x00raw")}
+    assert store.get("mc") == b"raw"
+    assert store.scan() == [(b"mc", b"raw"), (b"py", "from python")]
+    assert conn.line("delete mc") == b"DELETED"
+    assert conn.line("delete mc") == b"NOT_FOUND"
+    assert conn.get("mc") == {}
+
+
+def test_incr_and_decr(client):
+    store, conn = client
+    conn.line("set n 0 0 1", b"5")
+
+    assert conn.line("incr n 10") == b"15"
+    assert conn.line("decr n 100") == b"0"
+    assert conn.line("incr missing 1") == b"NOT_FOUND"
+    assert store.incr("n") == 1
+    store.set("text", "abc")
+    assert conn.line("incr text 1").startswith(b"CLIENT_ERROR")
+
+
+def test_exptime_maps_to_ttl(client):
+    store, conn = client
+
+    assert conn.line("set short 0 1 1", b"v") == b"STORED"
+    assert conn.line("set gone 0 -1 1", b"v") == b"STORED"
+    assert conn.get("gone") == {}
+    time.sleep(1.5)
+    assert conn.get("short") == {}
+    assert "short" not in store
+
+
+def test_noreply_and_version(client):
+    _, conn = client
+
+    conn.sock.sendall(b"set quiet 0 0 1 noreply\r\nv\r\n")
+    assert conn.line("version").startswith(b"VERSION ")
+    assert conn.get("quiet") == {"quiet": (0, b"v")}
+
+
+def test_reserved_keys_are_refused(client):
+    store, conn = client
+    assert conn.line("set mc 42 0 1", b"v") == b"STORED"
+    # The key holding mc's client flags.
+    flags_key = b"\xffmc/flags/mc"
+
+    def raw(command: bytes) -> bytes:
+        conn.sock.sendall(command + b"\r\n")
+        return conn.reader.readline()[:-2]
+
+    assert raw(b"get " + flags_key) == b"END"
+    for command in (b"set " + flags_key + b" 0 0 1\r\nx", b"delete " + flags_key, b"incr " + flags_key + b" 1"):
+        assert raw(command).startswith(b"CLIENT_ERROR keys starting with 0xff are reserved")
+    assert conn.get("mc") == {"mc": (42, b"v")}
+
+
+@pytest.mark.parametrize(
+    "command, reply",
+    [
+        ("flush_all", b"ERROR"),
+        ("set k x 0 1", b"CLIENT_ERROR bad command line format"),
+        ("incr k many", b"CLIENT_ERROR invalid numeric delta argument"),
+    ],
+)
+def test_bad_commands(client, command, reply):
+    _, conn = client
+
+    assert conn.line(command) == reply
+    assert conn.line("version").startswith(b"VERSION ")
@@ -0,0 +1,109 @@
+import json
+import struct
+import threading
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def _members(raw):
+    out, pos = set(), 0
+    while pos < len(raw):
+        (size,) = struct.unpack_from("<I", raw, pos)
+        out.add(raw[pos + 4 : pos + 4 + size])
+        pos += 4 + size
+    return out
+
+
+def test_int_add_accumulates_concurrently(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set_merge_operator("int-add", "count:")
+
+    def work():
+        for _ in range(100):
+            store.merge("count:hits", 1)
+
+    threads = [threading.Thread(target=work) for _ in range(4)]
+    for thread in threads:
+        thread.start()
+    for thread in threads:
+        thread.join()
+    store.merge("count:hits", -50)
+
+    assert store.get_raw("count:hits") == b"350"
+    assert store.incr("count:hits") == 351
+
+
+def test_append_keeps_the_wrapper_tag(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set_merge_operator("append")
+    store.set("log", "a")
+
+    store.merge("log", "b")
+    store.merge("log", b"c")
+
+    assert store.get("log") == "abc"
+
+
+def test_set_union(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set_merge_operator("set-union", "tags:")
+
+    store.merge("tags:post", {"red", "blue"})
+    store.merge("tags:post", ["blue", b"green"])
+
+    assert _members(store.get_raw("tags:post")) == {b"red", b"blue", b"green"}
+
+
+def test_json_merge_on_a_document_written_from_python(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set_merge_operator("json-merge", "doc:")
+    store.set("doc:1", json.dumps({"name": "ada", "tags": ["x"]}))
+
+    store.merge("doc:1", {"tags": None, "age": 36})
+    store.merge("doc:2", {"fresh": True})
+
+    assert json.loads(store.get("doc:1")) == {"name": "ada", "age": 36}
+    assert store.json_get("doc:2") == {"fresh": True}
+
+
+def test_longest_prefix_wins_and_operators_can_be_removed(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set_merge_operator("append")
+    store.set_merge_operator("int-add", "n:")
+
+    store.merge("n:x", 2)
+    store.merge("s:x", "ab")
+    assert store.get_raw("n:x") == b"2"
+    assert store.get_raw("s:x") == b"ab"
+
+    store.set_merge_operator(None, "n:")
+    store.merge("n:y", "3")
+    assert store.get_raw("n:y") == b"3"
+
+
+def test_get_raw_default(skyshelve_factory):
+    store = skyshelve_factory()
+
+    assert store.get_raw("missing") is None
+    assert store.get_raw("missing", b"") == b""
+
+
+def test_merge_errors(skyshelve_factory):
+    store = skyshelve_factory()
+    with pytest.raises(SkyshelveError, match="no merge operators are registered"):
+        store.merge("k", 1)
+    with pytest.raises(SkyshelveError, match="unknown merge operator"):
+        store.set_merge_operator("concat")
+
+    store.set_merge_operator("int-add", "n:")
+    with pytest.raises(SkyshelveError, match="no merge operator registered for key"):
+        store.merge("other", 1)
+    with pytest.raises(SkyshelveError, match="operand is not an integer"):
+        store.merge("n:x", "one")
+    store.set("n:text", "words")
+    with pytest.raises(SkyshelveError, match="value is not an integer"):
+        store.merge("n:text", 1)
+    with pytest.raises(TypeError):
+        store.merge("n:x", True)
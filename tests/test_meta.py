@@ -0,0 +1,73 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_meta_byte_round_trips(skyshelve_factory):
+    store = skyshelve_factory()
+
+    store.set_with_meta("json", b'{"a": 1}', 1)
+    store.set_with_meta("raw", b"\x00\x01", 255)
+
+    assert store.get_with_meta("json") == (b'{"a": 1}', 1)
+    assert store.get_with_meta("raw") == (b"\x00\x01", 255)
+    assert store.get("json") == b'{"a": 1}'
+
+
+def test_plain_values_report_zero_meta(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("k", {"v": 1})
+
+    assert store.get_with_meta("k") == ({"v": 1}, 0)
+
+
+def test_missing_key_returns_default(skyshelve_factory):
+    store = skyshelve_factory()
+
+    assert store.get_with_meta("missing") == (None, 0)
+    assert store.get_with_meta("missing", default="fallback") == ("fallback", 0)
+
+
+def test_plain_write_clears_meta(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set_with_meta("k", "tagged", 7)
+
+    store.set("k", "untagged")
+
+    assert store.get_with_meta("k") == ("untagged", 0)
+
+
+def test_meta_survives_compression(tmp_path, shared_library):
+    store = SkyShelve(
+        str(tmp_path / "db"),
+        lib_path=str(shared_library),
+        options={"compression": {"algorithm": "zstd", "min_size": 1}},
+    )
+    try:
+        store.set_with_meta("k", b"x" * 1000, 3)
+        assert store.get_with_meta("k") == (b"x" * 1000, 3)
+    finally:
+        store.close()
+
+
+@pytest.mark.parametrize("meta", [-1, 256])
+def test_meta_must_fit_in_a_byte(skyshelve_factory, meta):
+    store = skyshelve_factory()
+
+    with pytest.raises(SkyshelveError, match="does not fit in a byte"):
+        store.set_with_meta("k", "v", meta)
+    assert "k" not in store
+
+
+@pytest.mark.parametrize("backend", ["memory", "sqlite", "bolt"])
+def test_backends_without_meta_reject_it(tmp_path, shared_library, backend):
+    path = None if backend == "memory" else str(tmp_path / "db")
+    store = SkyShelve(path, lib_path=str(shared_library), options={"backend": backend})
+    try:
+        with pytest.raises(SkyshelveError, match="metadata bytes are not supported"):
+            store.set_with_meta("k", "v", 1)
+        assert "k" not in store
+        store.set("k", "v")
+        assert store.get_with_meta("k") == ("v", 0)
+    finally:
+        store.close()
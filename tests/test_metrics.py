@@ -0,0 +1,48 @@
+import urllib.request
+
+import pytest
+
+from conftest import free_addr
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_metrics_server_exports_operations(skyshelve_factory, shared_library):
+    addr = free_addr()
+    SkyShelve.start_metrics_server(addr, lib_path=str(shared_library))
+    try:
+        store = skyshelve_factory()
+        store.set("k", 1)
+        store.get("k")
+        store.get("missing")
+
+        body = urllib.request.urlopen(f"http://{addr}/metrics", timeout=5).read().decode()
+    finally:
+        SkyShelve.stop_metrics_server()
+
+    handle = store._handle
+    assert f'skyshelve_operations_total{{handle="{handle}",op="get"}} 2' in body
+    assert f'skyshelve_operations_total{{handle="{handle}",op="set"}} 1' in body
+    assert "skyshelve_operation_duration_seconds_bucket" in body
+    assert f'skyshelve_store_size_bytes{{handle="{handle}",backend="badger",component="lsm"}}' in body
+
+
+def test_metrics_server_start_twice_fails(shared_library):
+    addr = free_addr()
+    SkyShelve.start_metrics_server(addr, lib_path=str(shared_library))
+    try:
+        with pytest.raises(SkyshelveError, match="already running"):
+            SkyShelve.start_metrics_server(free_addr())
+    finally:
+        SkyShelve.stop_metrics_server()
+
+
+def test_stop_metrics_server_when_not_running(shared_library):
+    SkyShelve._ensure_library(str(shared_library))
+
+    with pytest.raises(SkyshelveError, match="not running"):
+        SkyShelve.stop_metrics_server()
+
+
+def test_metrics_server_bad_address(shared_library):
+    with pytest.raises(SkyshelveError):
+        SkyShelve.start_metrics_server("not-an-address", lib_path=str(shared_library))
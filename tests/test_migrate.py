@@ -0,0 +1,51 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_migrate_copies_and_reports_progress(tmp_path, skyshelve_factory, shared_library):
+    source = skyshelve_factory(in_memory=True)
+    for i in range(250):
+        source.set(f"k{i:03d}", {"n": i})
+
+    dst = tmp_path / "dst"
+    assert source.migrate(str(dst)) == 250
+    assert source.migrate_progress() == (250, 250)
+
+    target = SkyShelve(str(dst), lib_path=str(shared_library))
+    try:
+        assert target.scan() == source.scan()
+    finally:
+        target.close()
+
+
+def test_migrate_to_other_backend(tmp_path, skyshelve_factory, shared_library):
+    source = skyshelve_factory()
+    source.set("a", "one")
+    source.set("b", b"two")
+
+    uri = f"bolt:{tmp_path / 'data.bolt'}"
+    assert source.migrate(uri) == 2
+
+    target = SkyShelve(uri, lib_path=str(shared_library))
+    try:
+        assert target.scan() == [(b"a", "one"), (b"b", b"two")]
+    finally:
+        target.close()
+
+
+def test_migrate_progress_before_any_migration(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(SkyshelveError, match="no migration"):
+        store.migrate_progress()
+
+
+def test_migrate_to_unopenable_destination(tmp_path, skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+    blocker = tmp_path / "file"
+    blocker.write_text("not a store")
+
+    with pytest.raises(SkyshelveError):
+        store.migrate(str(blocker))
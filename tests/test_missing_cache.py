@@ -0,0 +1,72 @@
+import time
+
+import pytest
+
+from skyshelve import SkyShelve
+
+
+@pytest.fixture
+def negative_cached(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"cache": {"max_missing": 1000}})
+    try:
+        yield store
+    finally:
+        store.close()
+
+
+def _wait_for_missing_hit(store, key, timeout=5.0):
+    # Ristretto admits entries asynchronously, so the first reads may miss.
+    deadline = time.monotonic() + timeout
+    while time.monotonic() < deadline:
+        assert store.get(key) is None
+        if store.stats()["missing_cache"]["hits"] > 0:
+            return True
+        time.sleep(0.01)
+    return False
+
+
+def test_repeated_misses_are_answered_from_the_cache(negative_cached):
+    assert _wait_for_missing_hit(negative_cached, "absent")
+    assert "absent" not in negative_cached
+    assert "value_cache" not in negative_cached.stats()
+
+
+@pytest.mark.parametrize(
+    "write",
+    [
+        lambda store: store.set("k", "v"),
+        lambda store: store.set_nx("k", "v"),
+        lambda store: store.apply([("set", b"k", "v")]),
+        lambda store: store.get_set("k", "v"),
+    ],
+)
+def test_writes_invalidate_missing_keys(negative_cached, write):
+    assert _wait_for_missing_hit(negative_cached, "k")
+
+    write(negative_cached)
+
+    assert negative_cached.get("k") == "v"
+    assert "k" in negative_cached
+
+
+def test_transaction_commit_invalidates_missing_keys(negative_cached):
+    assert _wait_for_missing_hit(negative_cached, "k")
+
+    with negative_cached.transaction() as txn:
+        txn.set("k", "v")
+
+    assert negative_cached.get("k") == "v"
+
+
+def test_restored_keys_are_not_reported_missing(tmp_path, shared_library, negative_cached):
+    source = SkyShelve(str(tmp_path / "src"), lib_path=str(shared_library))
+    try:
+        source.set("k", "v")
+        source.backup(tmp_path / "backup")
+    finally:
+        source.close()
+    assert _wait_for_missing_hit(negative_cached, "k")
+
+    negative_cached.restore_into(tmp_path / "backup")
+
+    assert negative_cached.get("k") == "v"
@@ -0,0 +1,50 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_open_with_badger_options(tmp_path, shared_library):
+    options = {"badger": {"compression": "zstd", "sync_writes": True, "value_log_file_size": 1 << 24}}
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options=options)
+    try:
+        store.set("k", {"v": 1})
+        assert store.get("k") == {"v": 1}
+    finally:
+        store.close()
+
+    reopened = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options=options)
+    try:
+        assert reopened.get("k") == {"v": 1}
+    finally:
+        reopened.close()
+
+
+def test_open_with_options_in_memory(shared_library):
+    store = SkyShelve(None, in_memory=True, lib_path=str(shared_library), options={})
+    try:
+        store.set("k", "v")
+        assert store.get("k") == "v"
+    finally:
+        store.close()
+
+
+def test_open_with_options_selects_backend(tmp_path, shared_library):
+    store = SkyShelve(None, lib_path=str(shared_library), options={"backend": "memory"})
+    try:
+        store.set("k", b"v")
+        assert store.scan() == [(b"k", b"v")]
+    finally:
+        store.close()
+
+
+@pytest.mark.parametrize(
+    "options, message",
+    [
+        ({"in_memory": True, "badger": {"sync_write": True}}, "unknown field"),
+        ({"in_memory": True, "badger": {"compression": "lz4"}}, "unknown badger compression"),
+        ({"backend": "nope"}, "nope"),
+    ],
+)
+def test_open_with_invalid_options(shared_library, options, message):
+    with pytest.raises(SkyshelveError, match=message):
+        SkyShelve(None, lib_path=str(shared_library), options=options)
@@ -0,0 +1,35 @@
+import ctypes
+
+from skyshelve import ErrorCode, SkyShelve
+
+
+def test_panic_in_export_returns_panic_code(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", "v")
+
+    # A NULL out-parameter makes the export dereference nil inside Go.
+    status = store._lib.GetInto(store._handle, b"k", 1, None, 0, None)
+
+    assert status == ErrorCode.PANIC
+    message = store.last_error()
+    assert message.startswith("panic: runtime error")
+    assert "goroutine" in message
+    assert store.get("k") == "v"
+    assert store.last_error() is None
+
+
+def test_panic_in_pointer_returning_export(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    command = b"\x03" + (0).to_bytes(4, "little")
+
+    assert not store._lib.Execute(store._handle, command, len(command), None)
+    assert store._last_code() == ErrorCode.PANIC
+    assert "panic" in store._last_error()
+
+
+def test_panic_without_handle_sets_global_error(shared_library):
+    SkyShelve._ensure_library(str(shared_library))
+
+    assert not SkyShelve._lib.ScanNext(ctypes.c_size_t(1), ctypes.c_int(1), None)
+    assert SkyShelve._last_code() == ErrorCode.PANIC
+    assert SkyShelve._last_error().startswith("panic:")
@@ -0,0 +1,41 @@
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+@pytest.mark.parametrize("scheme", ["memory", "sqlite", "bolt"])
+def test_ping_backends(tmp_path, shared_library, scheme):
+    path = "memory:" if scheme == "memory" else f"{scheme}:{tmp_path / 'p.db'}"
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        assert 0 <= store.ping() < 5
+        assert store.count() == 0
+    finally:
+        store.close()
+
+
+def test_ping_badger_and_snapshot(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("k", "v")
+
+    assert store.ping() >= 0
+    with store.snapshot() as snap:
+        assert snap.ping() >= 0
+    assert store.scan() == [(b"k", "v")]
+
+
+def test_ping_after_close_all_reports_invalid_handle(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    SkyShelve.close_all()
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.ping()
+    assert excinfo.value.code == ErrorCode.INVALID_HANDLE
+
+
+def test_ping_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.ping()
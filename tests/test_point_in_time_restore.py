@@ -0,0 +1,102 @@
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def checkpointed(tmp_path, shared_library):
+    """A store with checkpoints "one" and "two", and the times around them."""
+    checkpoint_dir = tmp_path / "checkpoints"
+    store = SkyShelve(
+        str(tmp_path / "db"),
+        lib_path=str(shared_library),
+        options={"checkpoint_dir": str(checkpoint_dir)},
+    )
+    try:
+        before = time.time()
+        time.sleep(0.01)
+        store.set("k", 1)
+        store.create_checkpoint("one")
+        time.sleep(0.01)
+        between = time.time()
+        time.sleep(0.01)
+        store.set("k", 2)
+        store.set("extra", True)
+        store.create_checkpoint("two")
+    finally:
+        store.close()
+    return checkpoint_dir, before, between
+
+
+def test_restore_to_checkpoint(tmp_path, shared_library, checkpointed):
+    checkpoint_dir, _, _ = checkpointed
+    dst = f"sqlite:{tmp_path / 'restored.db'}"
+
+    restored = SkyShelve.restore_to_checkpoint(checkpoint_dir, "one", dst, lib_path=str(shared_library))
+    try:
+        assert restored.get("k") == 1
+        assert "extra" not in restored
+        restored.set("k", "writable")
+    finally:
+        restored.close()
+
+    reopened = SkyShelve(dst, lib_path=str(shared_library))
+    try:
+        assert reopened.get("k") == "writable"
+    finally:
+        reopened.close()
+
+
+def test_restore_to_timestamp_picks_the_newest_earlier_checkpoint(tmp_path, shared_library, checkpointed):
+    checkpoint_dir, _, between = checkpointed
+
+    restored = SkyShelve.restore_to_timestamp(
+        checkpoint_dir, between, str(tmp_path / "between"), lib_path=str(shared_library)
+    )
+    try:
+        assert restored.get("k") == 1
+    finally:
+        restored.close()
+
+    restored = SkyShelve.restore_to_timestamp(
+        checkpoint_dir, time.time(), str(tmp_path / "now"), lib_path=str(shared_library)
+    )
+    try:
+        assert restored.get("k") == 2
+        assert restored.get("extra") is True
+    finally:
+        restored.close()
+
+
+def test_restore_before_the_first_checkpoint_fails(tmp_path, shared_library, checkpointed):
+    checkpoint_dir, before, _ = checkpointed
+
+    with pytest.raises(SkyshelveError, match="no checkpoint taken at or before"):
+        SkyShelve.restore_to_timestamp(checkpoint_dir, before, str(tmp_path / "dst"), lib_path=str(shared_library))
+
+
+def test_restore_needs_an_empty_destination(tmp_path, shared_library, checkpointed):
+    checkpoint_dir, _, _ = checkpointed
+    dst = f"sqlite:{tmp_path / 'busy.db'}"
+    existing = SkyShelve(dst, lib_path=str(shared_library))
+    existing.set("occupied", 1)
+    existing.close()
+
+    with pytest.raises(SkyshelveError, match="restore destination is not empty"):
+        SkyShelve.restore_to_checkpoint(checkpoint_dir, "one", dst, lib_path=str(shared_library))
+
+    existing = SkyShelve(dst, lib_path=str(shared_library))
+    try:
+        assert existing.get("occupied") == 1
+        assert "k" not in existing
+    finally:
+        existing.close()
+
+
+def test_restore_of_a_missing_checkpoint_fails(tmp_path, shared_library, checkpointed):
+    checkpoint_dir, _, _ = checkpointed
+
+    with pytest.raises(SkyshelveError, match="no checkpoint named"):
+        SkyShelve.restore_to_checkpoint(checkpoint_dir, "three", str(tmp_path / "dst"), lib_path=str(shared_library))
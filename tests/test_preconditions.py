@@ -0,0 +1,74 @@
+import pytest
+
+from skyshelve import Durability, ErrorCode, SkyShelve, SkyshelveError
+
+
+def test_batch_commits_when_preconditions_hold(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("balance", 100)
+    store.set("lock", "me")
+
+    store.apply(
+        [
+            ("require_equal", b"balance", 100),
+            ("require_exists", b"lock", None),
+            ("require_absent", b"receipt", None),
+            ("set", b"balance", 60),
+            ("set", b"receipt", "paid 40"),
+            ("delete", b"lock", None),
+        ]
+    )
+
+    assert store.get("balance") == 60
+    assert store.get("receipt") == "paid 40"
+    assert "lock" not in store
+
+
+@pytest.mark.parametrize(
+    "precondition, message",
+    [
+        (("require_equal", b"balance", 99), "precondition 1 failed: key \"balance\" must equal the expected value"),
+        (("require_exists", b"missing", None), "precondition 1 failed: key \"missing\" must exist"),
+        (("require_absent", b"balance", None), "precondition 1 failed: key \"balance\" must not exist"),
+    ],
+)
+def test_failed_precondition_writes_nothing(skyshelve_factory, precondition, message):
+    store = skyshelve_factory(in_memory=True)
+    store.set("balance", 100)
+
+    with pytest.raises(SkyshelveError, match=message) as excinfo:
+        store.apply([("set", b"other", 1), precondition, ("set", b"balance", 0)])
+
+    assert excinfo.value.code == ErrorCode.CONFLICT
+    assert store.get("balance") == 100
+    assert "other" not in store
+
+
+def test_preconditions_on_sqlite(tmp_path, shared_library):
+    store = SkyShelve(f"sqlite:{tmp_path / 'p.db'}", lib_path=str(shared_library))
+    try:
+        store.apply([("require_absent", b"k", None), ("set", b"k", 1)])
+        with pytest.raises(SkyshelveError) as excinfo:
+            store.apply([("require_absent", b"k", None), ("set", b"k", 2)])
+        assert excinfo.value.code == ErrorCode.CONFLICT
+        assert store.get("k") == 1
+    finally:
+        store.close()
+
+
+def test_preconditions_only_supported_by_apply(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    batch = [("require_absent", b"k", None), ("set", b"k", 1)]
+
+    with pytest.raises(SkyshelveError, match="preconditions are only supported by Apply"):
+        store.apply_async(batch)
+    with pytest.raises(SkyshelveError, match="preconditions are only supported by Apply"):
+        store.apply_with_durability(batch, Durability.DEFAULT)
+    assert "k" not in store
+
+
+def test_unknown_operation_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(ValueError, match="unknown operation"):
+        store.apply([("require_greater", b"k", 1)])
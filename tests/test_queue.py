@@ -0,0 +1,91 @@
+import threading
+import time
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_push_pop_is_fifo(skyshelve_factory):
+    store = skyshelve_factory()
+    ids = [store.queue_push("jobs", value) for value in ("a", b"b", {"n": 3})]
+
+    assert ids == sorted(ids)
+    assert store.queue_pop("jobs") == (ids[0], "a")
+    assert store.queue_pop("jobs") == (ids[1], b"b")
+    assert store.queue_pop("jobs") == (ids[2], {"n": 3})
+    assert store.queue_pop("jobs") is None
+
+
+def test_queues_are_independent(skyshelve_factory):
+    store = skyshelve_factory()
+    store.queue_push("a", "one")
+
+    assert store.queue_pop("b") is None
+    assert store.queue_pop("a")[1] == "one"
+
+
+def test_unacknowledged_items_are_redelivered(skyshelve_factory):
+    store = skyshelve_factory()
+    item_id = store.queue_push("jobs", "work")
+
+    assert store.queue_pop("jobs", visibility_timeout=0.2) == (item_id, "work")
+    assert store.queue_pop("jobs") is None
+    time.sleep(0.3)
+    assert store.queue_pop("jobs", visibility_timeout=5) == (item_id, "work")
+    assert store.queue_ack("jobs", item_id) is True
+    assert store.queue_ack("jobs", item_id) is False
+
+
+def test_acknowledged_items_are_not_redelivered(skyshelve_factory):
+    store = skyshelve_factory()
+    item_id = store.queue_push("jobs", "work")
+
+    store.queue_pop("jobs", visibility_timeout=0.1)
+    assert store.queue_ack("jobs", item_id) is True
+    time.sleep(0.2)
+    assert store.queue_pop("jobs") is None
+
+
+def test_concurrent_consumers_each_get_an_item_once(skyshelve_factory):
+    store = skyshelve_factory()
+    for i in range(100):
+        store.queue_push("jobs", i)
+    taken = []
+
+    def consume():
+        while True:
+            item = store.queue_pop("jobs")
+            if item is None:
+                return
+            taken.append(item[1])
+
+    threads = [threading.Thread(target=consume) for _ in range(4)]
+    for thread in threads:
+        thread.start()
+    for thread in threads:
+        thread.join()
+
+    assert sorted(taken) == list(range(100))
+
+
+def test_queue_survives_reopen(tmp_path, shared_library):
+    from skyshelve import SkyShelve
+
+    path = str(tmp_path / "db")
+    with SkyShelve(path, lib_path=str(shared_library)) as store:
+        store.queue_push("jobs", "persisted")
+    with SkyShelve(path, lib_path=str(shared_library)) as store:
+        assert store.queue_pop("jobs")[1] == "persisted"
+        store.queue_push("jobs", "next")
+        assert store.queue_pop("jobs")[1] == "next"
+
+
+def test_queue_on_a_closed_store_fails(skyshelve_factory):
+    store = skyshelve_factory()
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.queue_push("jobs", "x")
+    with pytest.raises(SkyshelveError):
+        store.queue_pop("jobs")
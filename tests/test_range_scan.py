@@ -0,0 +1,47 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def _fill(store):
+    for key in ("a", "b", "c", "d", "e"):
+        store.set(key, key.upper())
+
+
+def test_range_scan_is_half_open(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    _fill(store)
+
+    assert store.range_scan("b", "d") == [(b"b", "B"), (b"c", "C")]
+
+
+def test_range_scan_open_bounds(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    _fill(store)
+
+    assert [k for k, _ in store.range_scan(end="c")] == [b"a", b"b"]
+    assert [k for k, _ in store.range_scan("d")] == [b"d", b"e"]
+    assert len(store.range_scan()) == 5
+
+
+def test_range_scan_limit(skyshelve_factory):
+    store = skyshelve_factory()
+    _fill(store)
+
+    assert store.range_scan("b", limit=2) == [(b"b", "B"), (b"c", "C")]
+
+
+def test_range_scan_empty_range(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    _fill(store)
+
+    assert store.range_scan("x", "z") == []
+    assert store.range_scan("d", "b") == []
+
+
+def test_range_scan_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        store.range_scan("a", "b")
@@ -0,0 +1,180 @@
+import time
+
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+def _open(tmp_path, shared_library, **rate_limit):
+    return SkyShelve(
+        str(tmp_path / "limited"),
+        lib_path=str(shared_library),
+        options={"rate_limit": rate_limit},
+    )
+
+
+@pytest.fixture
+def open_limited(tmp_path, shared_library):
+    stores = []
+
+    def factory(**rate_limit):
+        store = _open(tmp_path, shared_library, **rate_limit)
+        stores.append(store)
+        return store
+
+    yield factory
+    for store in stores:
+        store.close()
+
+
+def test_writes_over_the_ops_limit_are_throttled(open_limited):
+    store = open_limited(ops_per_sec=5)
+    for i in range(5):
+        store.set(f"k{i}", i)
+
+    with pytest.raises(SkyshelveError, match="write throttled: rate limit exceeded, retry in") as excinfo:
+        store.set("k5", 5)
+    assert excinfo.value.code == ErrorCode.THROTTLED
+    assert store.get("k5") is None
+    assert store.get("k4") == 4
+
+    stats = store.stats()["rate_limit"]
+    assert stats["ops_per_sec"] == 5
+    assert stats["throttled"] == 1
+    assert stats["pressure"] == pytest.approx(1, abs=0.1)
+
+
+def test_capacity_refills_over_time(open_limited):
+    store = open_limited(ops_per_sec=20)
+    for i in range(20):
+        store.set(f"k{i}", i)
+    with pytest.raises(SkyshelveError):
+        store.set("late", 1)
+
+    time.sleep(0.2)
+    store.set("late", 1)
+    assert store.get("late") == 1
+
+
+def test_reads_are_not_limited(open_limited):
+    store = open_limited(ops_per_sec=1)
+    store.set("k", "v")
+    for _ in range(50):
+        assert store.get("k") == "v"
+    assert store.scan() == [(b"k", "v")]
+
+
+def test_bytes_limit(open_limited):
+    store = open_limited(bytes_per_sec=1000)
+    store.set("small", b"x" * 100)
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.set("large", b"x" * 950)
+    assert excinfo.value.code == ErrorCode.THROTTLED
+    assert store.stats()["rate_limit"]["bytes_per_sec"] == 1000
+
+
+def test_batches_and_transactions_are_charged_per_write(open_limited):
+    store = open_limited(ops_per_sec=4)
+    store.apply([("set", b"a", 1), ("set", b"b", 2), ("set", b"c", 3)])
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.apply([("set", b"d", 4), ("delete", b"a", None)])
+    assert excinfo.value.code == ErrorCode.THROTTLED
+    assert store.get("d") is None
+    assert store.get("a") == 1
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        with store.transaction() as txn:
+            txn.set("e", 5)
+            txn.set("f", 6)
+    assert excinfo.value.code == ErrorCode.THROTTLED
+    assert store.get("e") is None
+
+
+def test_blocking_mode_waits_for_capacity(open_limited):
+    store = open_limited(ops_per_sec=10, block=True)
+    start = time.monotonic()
+    for i in range(15):
+        store.set(f"k{i}", i)
+    elapsed = time.monotonic() - start
+
+    assert elapsed >= 0.4
+    assert store.get("k14") == 14
+    stats = store.stats()["rate_limit"]
+    assert stats["throttled"] == 0
+    assert stats["waited_ms"] >= 400
+
+
+def test_blocking_mode_gives_up_after_max_wait(open_limited):
+    store = open_limited(ops_per_sec=1, block=True, max_wait="50ms")
+    store.set("a", 1)
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.set("b", 2)
+    assert excinfo.value.code == ErrorCode.THROTTLED
+
+
+def test_set_rate_limit_replaces_the_limits(open_limited):
+    store = open_limited(ops_per_sec=1)
+    store.set("a", 1)
+    with pytest.raises(SkyshelveError):
+        store.set("b", 2)
+
+    store.set_rate_limit(ops_per_sec=0)
+    for i in range(100):
+        store.set(f"k{i}", i)
+    assert store.stats()["rate_limit"]["ops_per_sec"] == 0
+
+    store.set_rate_limit(ops_per_sec=2, burst_seconds=2)
+    for i in range(4):
+        store.set(f"burst{i}", i)
+    with pytest.raises(SkyshelveError):
+        store.set("burst4", 4)
+
+    store.set_rate_limit(ops_per_sec=1, block=True, max_wait=0.05)
+    store.set("c", 3)
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.set("d", 4)
+    assert excinfo.value.code == ErrorCode.THROTTLED
+
+
+@pytest.mark.parametrize(
+    "limits, message",
+    [
+        ({"ops_per_sec": -1}, "must not be negative"),
+        ({"block": True, "max_wait": "soon"}, "invalid rate_limit max_wait"),
+    ],
+)
+def test_invalid_limits_are_rejected_at_open(tmp_path, shared_library, limits, message):
+    with pytest.raises(SkyshelveError, match=message):
+        _open(tmp_path, shared_library, **limits)
+
+
+def test_invalid_limits_are_rejected_by_set_rate_limit(open_limited):
+    store = open_limited(ops_per_sec=10)
+
+    with pytest.raises(SkyshelveError, match="must not be negative"):
+        store.set_rate_limit(bytes_per_sec=-5)
+    assert store.stats()["rate_limit"]["ops_per_sec"] == 10
+
+
+def test_store_without_rate_limit(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(100):
+        store.set(f"k{i}", i)
+
+    assert "rate_limit" not in store.stats()
+    with pytest.raises(SkyshelveError, match="not opened with rate_limit"):
+        store.set_rate_limit(ops_per_sec=10)
+
+
+def test_prefix_deletes_are_admitted_once(open_limited):
+    # Room for the writes below and one more.
+    store = open_limited(ops_per_sec=1, burst_seconds=2501)
+    store.apply([("set", f"user:{i:04}".encode(), i) for i in range(2500)])
+
+    assert store.delete_prefix("user:") == 2500
+    assert store.scan("user:") == []
+    with pytest.raises(SkyshelveError, match="write throttled"):
+        store.delete_range("a", "z")
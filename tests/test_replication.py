@@ -0,0 +1,103 @@
+import time
+
+import pytest
+
+from conftest import wait_for
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def source(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "src"), lib_path=str(shared_library), options={"change_log": True})
+    try:
+        yield store
+    finally:
+        store.close()
+
+
+def test_replica_receives_copy_and_stream(tmp_path, shared_library, source):
+    source.set("existing", 1)
+    replica_path = f"sqlite:{tmp_path / 'replica.db'}"
+
+    source.start_replication(replica_path)
+    assert wait_for(lambda: source.replication_status()["state"] == "streaming")
+    source.set("streamed", 2)
+    source.delete("existing")
+    assert wait_for(lambda: source.replication_status()["lag"] == 0)
+
+    status = source.replication_status()
+    assert status["copied"] == 1
+    assert status["applied_seq"] == status["source_seq"] == source.last_sequence()
+    assert "error" not in status
+    source.stop_replication()
+
+    replica = SkyShelve(replica_path, lib_path=str(shared_library))
+    try:
+        assert replica.get("streamed") == 2
+        assert "existing" not in replica
+    finally:
+        replica.close()
+
+
+def test_copy_keeps_ttls(tmp_path, shared_library, source):
+    source.set("plain", 1)
+    # Badger rounds expiry down to the second, so leave time for the copy.
+    source.set("expiring", 2, ttl=3)
+    replica_path = str(tmp_path / "replica")
+
+    source.start_replication(replica_path)
+    assert wait_for(lambda: source.replication_status()["state"] == "streaming")
+    assert source.replication_status()["copied"] == 2
+    source.stop_replication()
+    time.sleep(3.1)
+
+    replica = SkyShelve(replica_path, lib_path=str(shared_library))
+    try:
+        assert replica.get("plain") == 1
+        assert "expiring" not in replica
+    finally:
+        replica.close()
+
+
+def test_copy_includes_data_structures(tmp_path, shared_library, source):
+    source.hset("h", "field", 1)
+    source.blob_put("b", b"blob data" * 100_000)
+    replica_path = str(tmp_path / "replica")
+
+    source.start_replication(replica_path)
+    assert wait_for(lambda: source.replication_status()["state"] == "streaming")
+    source.stop_replication()
+
+    replica = SkyShelve(replica_path, lib_path=str(shared_library), options={"change_log": True})
+    try:
+        assert replica.hgetall("h") == {b"field": 1}
+        assert replica.blob_get("b") == b"blob data" * 100_000
+        # The source's change log stays behind.
+        assert replica.last_sequence() == 0
+    finally:
+        replica.close()
+
+
+def test_stop_replication_ends_status_reporting(tmp_path, source):
+    source.start_replication(f"sqlite:{tmp_path / 'replica.db'}")
+    source.stop_replication()
+
+    with pytest.raises(SkyshelveError, match="is not replicating"):
+        source.replication_status()
+    with pytest.raises(SkyshelveError, match="is not replicating"):
+        source.stop_replication()
+
+
+def test_a_handle_feeds_one_replica(tmp_path, source):
+    source.start_replication(f"sqlite:{tmp_path / 'a.db'}")
+    try:
+        with pytest.raises(SkyshelveError, match="already replicating"):
+            source.start_replication(f"sqlite:{tmp_path / 'b.db'}")
+    finally:
+        source.stop_replication()
+
+
+def test_replication_requires_change_log(tmp_path, skyshelve_factory):
+    store = skyshelve_factory()
+    with pytest.raises(SkyshelveError, match="change_log"):
+        store.start_replication(f"sqlite:{tmp_path / 'replica.db'}")
@@ -0,0 +1,138 @@
+import socket
+import time
+
+import pytest
+
+from conftest import free_addr
+
+
+class _Client:
+    """Just enough of a Redis client to send commands and read RESP2 replies."""
+
+    def __init__(self, addr: str) -> None:
+        host, port = addr.rsplit(":", 1)
+        self.sock = socket.create_connection((host, int(port)), timeout=5)
+        self.reader = self.sock.makefile("rb")
+
+    def close(self) -> None:
+        self.reader.close()
+        self.sock.close()
+
+    def call(self, *args):
+        parts = [f"*{len(args)}\r\n".encode()]
+        for arg in args:
+            data = arg if isinstance(arg, bytes) else str(arg).encode()
+            parts.append(f"${len(data)}\r\n".encode() + data + b"\r\n")
+        self.sock.sendall(b"".join(parts))
+        return self._read()
+
+    def _read(self):
+        line = self.reader.readline()[:-2]
+        kind, rest = line[:1], line[1:]
+        if kind == b"+":
+            return rest.decode()
+        if kind == b"-":
+            raise RuntimeError(rest.decode())
+        if kind == b":":
+            return int(rest)
+        if kind == b"$":
+            if int(rest) < 0:
+                return None
+            return self.reader.read(int(rest) + 2)[:-2]
+        return [self._read() for _ in range(int(rest))]
+
+
+@pytest.fixture
+def client(skyshelve_factory):
+    store = skyshelve_factory()
+    addr = free_addr()
+    store.start_resp_server(addr)
+    conn = _Client(addr)
+    yield store, conn
+    conn.close()
+    store.stop_resp_server()
+
+
+def test_get_set_del_exists(client):
+    store, conn = client
+    store.set("py", "from python")
+
+    assert conn.call("PING") == "PONG"
+    assert conn.call("GET", "py") == b"\x01from python"
+    assert conn.call("SET", "redis", b"\x00raw") == "OK"
+    assert store.get("redis") == b"raw"
+    assert conn.call("EXISTS", "py", "redis", "nope") == 2
+    assert conn.call("DEL", "py", "nope") == 1
+    assert conn.call("GET", "py") is None
+
+
+def test_set_nx_and_incr(client):
+    store, conn = client
+
+    assert conn.call("SET", "once", "a", "NX") == "OK"
+    assert conn.call("SET", "once", "b", "NX") is None
+    assert conn.call("INCR", "hits") == 1
+    assert conn.call("INCR", "hits") == 2
+    assert store.incr("hits") == 3
+
+
+def test_expiry_and_ttl(client):
+    store, conn = client
+
+    assert conn.call("SET", "short", "v", "PX", 100) == "OK"
+    assert conn.call("SET", "long", "v", "EX", 60) == "OK"
+    # badger keeps expiry times to the second, so a fresh 60s key may report 59.
+    assert conn.call("TTL", "long") in (59, 60)
+    assert conn.call("TTL", "missing") == -2
+    conn.call("SET", "forever", "v")
+    assert conn.call("TTL", "forever") == -1
+    time.sleep(0.3)
+    assert conn.call("GET", "short") is None
+    assert "short" not in store
+
+
+def test_reserved_keys_are_refused(client):
+    store, conn = client
+    store.blob_put("b", b"data")
+    # The blob's manifest key.
+    manifest = b"\xffblob/\x00\x00\x00\x01b"
+
+    assert conn.call("GET", manifest) is None
+    assert conn.call("EXISTS", manifest) == 0
+    assert conn.call("TTL", manifest) == -2
+    for command in (("SET", manifest, "x"), ("DEL", manifest), ("INCR", manifest)):
+        with pytest.raises(RuntimeError, match="reserved"):
+            conn.call(*command)
+    assert store.blob_get("b") == b"data"
+
+
+def test_scan_pages_through_keys(client):
+    store, conn = client
+    for i in range(5):
+        store.set(f"k{i}", "v")
+    store.set("other", "v")
+
+    cursor, keys = conn.call("SCAN", 0, "MATCH", "k*", "COUNT", 3)
+    seen = set(keys)
+    while cursor != b"0":
+        cursor, keys = conn.call("SCAN", cursor, "MATCH", "k*", "COUNT", 3)
+        seen.update(keys)
+    assert seen == {f"k{i}".encode() for i in range(5)}
+
+
+@pytest.mark.parametrize(
+    "command, message",
+    [
+        (("FLUSHALL",), "unknown command 'FLUSHALL'"),
+        (("GET",), "wrong number of arguments"),
+        (("SET", "k", "v", "EX", 0), "invalid expire time"),
+        (("SET", "k", "v", "NX", "EX", 5), "not supported"),
+        (("SELECT", 1), "DB index is out of range"),
+    ],
+)
+def test_errors_are_replied(client, command, message):
+    _, conn = client
+
+    with pytest.raises(RuntimeError, match=message):
+        conn.call(*command)
+    assert conn.call("PING") == "PONG"
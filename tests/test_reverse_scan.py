@@ -0,0 +1,37 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_reverse_scan_descending(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(5):
+        store.set(f"log:{i}", i)
+    store.set("other", 0)
+
+    assert store.reverse_scan("log:") == [(f"log:{i}".encode(), i) for i in reversed(range(5))]
+    assert store.reverse_scan() == list(reversed(store.scan()))
+
+
+def test_reverse_scan_prefix_with_high_bytes(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set(b"p\xff\xff", b"last")
+    store.set(b"p\x00", b"first")
+    store.set(b"q", b"outside")
+
+    assert store.reverse_scan(b"p") == [(b"p\xff\xff", b"last"), (b"p\x00", b"first")]
+
+
+def test_reverse_scan_no_matches(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+
+    assert store.reverse_scan("zzz") == []
+
+
+def test_reverse_scan_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.reverse_scan()
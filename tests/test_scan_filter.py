@@ -0,0 +1,69 @@
+import json
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+@pytest.fixture
+def people(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("user:alice", json.dumps({"name": "alice", "age": 34, "admin": True}))
+    store.set("user:bob", json.dumps({"name": "bob", "age": 19}))
+    store.set("user:carol", json.dumps({"name": "carol", "age": 21}).encode())
+    store.set("team:red", json.dumps({"name": "red", "age": 40}))
+    store.set("note", "remember the milk")
+    return store
+
+
+def _keys(entries):
+    return [key for key, _ in entries]
+
+
+def test_json_comparisons(people):
+    assert _keys(people.scan_filter("$.age >= 21")) == [b"team:red", b"user:alice", b"user:carol"]
+    assert _keys(people.scan_filter('$.name == "bob"')) == [b"user:bob"]
+    assert _keys(people.scan_filter("$.admin == true")) == [b"user:alice"]
+    assert _keys(people.scan_filter("$.age < 20")) == [b"user:bob"]
+
+
+def test_clauses_combine_with_and(people):
+    entries = people.scan_filter('key glob "user:*" and $.age > 20')
+
+    assert _keys(entries) == [b"user:alice", b"user:carol"]
+    assert json.loads(entries[0][1])["name"] == "alice"
+
+
+def test_prefix_limits_the_scan(people):
+    assert _keys(people.scan_filter("$.age > 0", prefix="team:")) == [b"team:red"]
+
+
+def test_value_contains(people):
+    assert _keys(people.scan_filter('value contains "milk"')) == [b"note"]
+    assert people.scan_filter('value contains "cheese"') == []
+
+
+def test_empty_expression_matches_everything(people):
+    assert people.scan_filter("") == people.scan()
+
+
+def test_values_without_the_member_fail_json_clauses(people):
+    assert people.scan_filter("$.admin != true") == []
+    assert _keys(people.scan_filter("$.age != 19")) == [b"team:red", b"user:alice", b"user:carol"]
+
+
+@pytest.mark.parametrize(
+    "expression, message",
+    [
+        ('key glob "user:*" or $.age > 1', 'expected "and"'),
+        ("$.age >=", "incomplete filter clause"),
+        ("$.age ~ 1", "unknown comparison"),
+        ('value contains "open', "unterminated string"),
+        ("value contains milk", "expected a quoted string"),
+        ("size over 3", "unknown filter clause"),
+        ('key glob "[x"', "bad glob"),
+    ],
+)
+def test_invalid_expressions_are_rejected(people, expression, message):
+    with pytest.raises(SkyshelveError, match=message):
+        people.scan_filter(expression)
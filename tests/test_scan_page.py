@@ -0,0 +1,99 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def _fill(store, n=10):
+    for i in range(n):
+        store.set(f"item:{i:02d}", i)
+
+
+def test_scan_page_walks_every_entry(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    _fill(store)
+
+    seen = []
+    after = None
+    pages = 0
+    while True:
+        entries, after = store.scan_page("item:", after=after, limit=3)
+        seen.extend(entries)
+        pages += 1
+        if after is None:
+            break
+
+    assert pages == 4
+    assert seen == store.scan("item:")
+
+
+def test_scan_page_resume_key_is_last_key(skyshelve_factory):
+    store = skyshelve_factory()
+    _fill(store)
+
+    entries, resume = store.scan_page("item:", limit=2)
+    assert [k for k, _ in entries] == [b"item:00", b"item:01"]
+    assert resume == b"item:01"
+
+
+def test_scan_page_max_bytes_still_makes_progress(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("big:a", b"x" * 1000)
+    store.set("big:b", b"y" * 1000)
+
+    entries, resume = store.scan_page("big:", max_bytes=10)
+    assert [k for k, _ in entries] == [b"big:a"]
+    assert resume == b"big:a"
+
+    entries, resume = store.scan_page("big:", after=resume, max_bytes=10)
+    assert [k for k, _ in entries] == [b"big:b"]
+
+
+def test_scan_page_exhausted(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    _fill(store, 2)
+
+    entries, resume = store.scan_page("item:", limit=10)
+    assert len(entries) == 2
+    assert resume is None
+    assert store.scan_page("nothing:") == ([], None)
+
+
+def test_scan_page_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.scan_page()
+
+
+def test_scan_page_max_bytes_bounds_each_page(skyshelve_factory):
+    store = skyshelve_factory()
+    for i in range(20):
+        store.set(f"blob:{i:02d}", b"z" * 100)
+    # Each framed entry is 8 header bytes, a 7-byte key and a 101-byte value.
+    cap = 3 * 116
+
+    seen = []
+    after = None
+    while True:
+        entries, after = store.scan_page("blob:", after=after, max_bytes=cap)
+        assert 1 <= len(entries) <= 3
+        seen.extend(key for key, _ in entries)
+        if after is None:
+            break
+
+    assert seen == [f"blob:{i:02d}".encode() for i in range(20)]
+
+
+def test_scan_page_limit_and_max_bytes_combine(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    for i in range(5):
+        store.set(f"k{i}", b"v")
+
+    entries, resume = store.scan_page(limit=2, max_bytes=1 << 20)
+    assert len(entries) == 2
+    assert resume == b"k1"
+
+    entries, resume = store.scan_page(limit=100, max_bytes=1 << 20)
+    assert len(entries) == 5
+    assert resume is None
@@ -0,0 +1,65 @@
+import threading
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_sequence_counts_from_zero(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert [store.next_sequence("orders") for _ in range(5)] == [0, 1, 2, 3, 4]
+    assert store.next_sequence("invoices") == 0
+
+
+def test_sequence_is_monotonic_across_reopen(tmp_path, shared_library):
+    path = str(tmp_path / "db")
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        issued = [store.next_sequence("ids", bandwidth=10) for _ in range(3)]
+    finally:
+        store.close()
+
+    store = SkyShelve(path, lib_path=str(shared_library))
+    try:
+        after = store.next_sequence("ids", bandwidth=10)
+    finally:
+        store.close()
+
+    assert after > max(issued)
+
+
+def test_sequence_is_unique_across_threads(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    results = []
+    lock = threading.Lock()
+
+    def worker():
+        ids = [store.next_sequence("shared", bandwidth=7) for _ in range(50)]
+        with lock:
+            results.extend(ids)
+
+    threads = [threading.Thread(target=worker) for _ in range(4)]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+
+    assert sorted(results) == list(range(200))
+
+
+def test_sequence_keys_stay_out_of_user_counts(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+    store.next_sequence("ids")
+
+    assert store.count() == 1
+    assert store.scan() == [(b"a", 1)]
+
+
+def test_sequence_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.next_sequence("ids")
@@ -0,0 +1,36 @@
+import socket
+
+import pytest
+
+from conftest import free_addr
+from skyshelve import SkyshelveError
+
+
+@pytest.mark.parametrize(
+    "kind, name",
+    [("http", "HTTP"), ("resp", "RESP"), ("memcache", "memcached"), ("grpc", "gRPC")],
+)
+def test_server_lifecycle_errors(skyshelve_factory, kind, name):
+    store = skyshelve_factory()
+    start = getattr(store, f"start_{kind}_server")
+    stop = getattr(store, f"stop_{kind}_server")
+    with pytest.raises(SkyshelveError, match=f"no {name} server is running"):
+        stop()
+
+    addr = free_addr()
+    start(addr)
+    try:
+        with pytest.raises(SkyshelveError, match="already running"):
+            start(free_addr())
+        other = skyshelve_factory(in_memory=True)
+        with pytest.raises(SkyshelveError):
+            getattr(other, f"start_{kind}_server")(addr)
+    finally:
+        stop()
+    host, port = addr.rsplit(":", 1)
+    with pytest.raises(OSError):
+        socket.create_connection((host, int(port)), timeout=5).close()
+
+    # The address is free again.
+    start(addr)
+    stop()
@@ -0,0 +1,57 @@
+import threading
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_set_nx_only_writes_missing_keys(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.set_nx("lock", "first")
+    assert not store.set_nx("lock", "second")
+    assert store.get("lock") == "first"
+
+
+def test_set_nx_single_winner(skyshelve_factory):
+    store = skyshelve_factory()
+    wins = []
+
+    def worker(n):
+        if store.set_nx("leader", n):
+            wins.append(n)
+
+    threads = [threading.Thread(target=worker, args=(n,)) for n in range(8)]
+    for t in threads:
+        t.start()
+    for t in threads:
+        t.join()
+
+    assert len(wins) == 1
+    assert store.get("leader") == wins[0]
+
+
+def test_get_set_returns_previous_value(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.get_set("k", 1) is None
+    assert store.get_set("k", {"two": 2}, default="unused") == 1
+    assert store.get_set("k", "three") == {"two": 2}
+    assert store.get("k") == "three"
+
+
+def test_get_set_default_for_missing_key(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    assert store.get_set("k", "v", default="none") == "none"
+    assert store.get("k") == "v"
+
+
+def test_set_nx_and_get_set_closed_store_raise(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.set_nx("k", 1)
+    with pytest.raises(SkyshelveError):
+        store.get_set("k", 1)
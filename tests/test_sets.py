@@ -0,0 +1,60 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+@pytest.mark.parametrize("in_memory", [False, True])
+def test_add_remove_and_membership(skyshelve_factory, in_memory):
+    store = skyshelve_factory(in_memory=in_memory)
+
+    assert store.sadd("tags", "red") is True
+    assert store.sadd("tags", b"blue") is True
+    assert store.sadd("tags", "red") is False
+    assert store.sismember("tags", "red") is True
+    assert store.sismember("tags", "green") is False
+    assert store.smembers("tags") == [b"blue", b"red"]
+    assert store.scard("tags") == 2
+
+    assert store.srem("tags", "red") is True
+    assert store.srem("tags", "red") is False
+    assert store.smembers("tags") == [b"blue"]
+    assert store.scard("tags") == 1
+
+
+def test_missing_set_is_empty(skyshelve_factory):
+    store = skyshelve_factory()
+
+    assert store.smembers("none") == []
+    assert store.scard("none") == 0
+    assert store.sismember("none", "x") is False
+
+
+def test_sets_are_separate_and_hidden_from_scans(skyshelve_factory):
+    store = skyshelve_factory()
+    store.sadd("a", "x")
+    store.sadd("ab", "y")
+
+    assert store.smembers("a") == [b"x"]
+    assert store.smembers("ab") == [b"y"]
+    assert store.scan() == []
+
+
+def test_many_members(skyshelve_factory):
+    store = skyshelve_factory()
+    for i in range(300):
+        store.sadd("big", f"m{i:03d}")
+
+    assert store.scard("big") == 300
+    assert store.smembers("big")[:2] == [b"m000", b"m001"]
+
+
+def test_set_on_a_closed_store_fails(skyshelve_factory):
+    store = skyshelve_factory()
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.sadd("s", "x")
+    with pytest.raises(SkyshelveError):
+        store.scard("s")
+    with pytest.raises(SkyshelveError):
+        store.smembers("s")
@@ -0,0 +1,126 @@
+import pytest
+
+from skyshelve import ErrorCode, SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def open_limited(tmp_path, shared_library):
+    stores = []
+
+    def factory(**options):
+        store = SkyShelve(str(tmp_path / "limited"), lib_path=str(shared_library), options=options)
+        stores.append(store)
+        return store
+
+    yield factory
+    for store in stores:
+        store.close()
+
+
+def test_oversized_values_are_rejected(open_limited):
+    store = open_limited(max_value_size=10)
+    # Values carry the wrapper's one-byte type tag.
+    store.set("fits", b"x" * 9)
+
+    with pytest.raises(SkyshelveError, match="value of 11 bytes exceeds the 10 byte limit") as excinfo:
+        store.set("big", b"x" * 10)
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+    assert store.get("big") is None
+    assert store.get("fits") == b"x" * 9
+
+
+def test_oversized_keys_are_rejected(open_limited):
+    store = open_limited(max_key_size=8)
+    store.set("12345678", 1)
+
+    with pytest.raises(SkyshelveError, match="key of 9 bytes exceeds the 8 byte limit") as excinfo:
+        store.set("123456789", 1)
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.delete("123456789")
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+    assert store.get("123456789") is None
+
+
+def test_batch_with_one_oversized_entry_is_rejected_whole(open_limited):
+    store = open_limited(max_value_size=16)
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.apply([("set", b"a", b"small"), ("set", b"b", b"x" * 100), ("set", b"c", b"small")])
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+    assert store.scan() == []
+
+
+def test_transaction_write_over_the_limit_fails(open_limited):
+    store = open_limited(max_value_size=16)
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        with store.transaction() as txn:
+            txn.set("a", b"small")
+            txn.set("b", b"x" * 100)
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+    assert store.get("a") is None
+
+
+def test_ttl_writes_are_checked(open_limited):
+    store = open_limited(max_value_size=16)
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.set("a", b"x" * 100, ttl=60)
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+
+
+def test_sizes_are_measured_before_compression(open_limited):
+    store = open_limited(max_value_size=100, compression={"algorithm": "zstd"})
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        store.set("compressible", b"a" * 1000)
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+
+
+def test_bucket_keys_include_the_bucket_prefix(open_limited):
+    store = open_limited(max_key_size=10)
+    # Bucket "b" keys are stored under a 7-byte prefix.
+    bucket = store.bucket("b")
+    bucket.set("abc", 1)
+
+    with pytest.raises(SkyshelveError) as excinfo:
+        bucket.set("abcd", 1)
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+    store.set("abcd", 1)
+
+
+def test_native_backups_are_not_checked(open_limited, skyshelve_factory, tmp_path):
+    source = skyshelve_factory()
+    source.set("big", b"x" * 1000)
+    backup = tmp_path / "backup.bak"
+    source.backup(backup)
+
+    store = open_limited(max_value_size=16)
+    store.restore_into(backup)
+    assert store.get("big") == b"x" * 1000
+
+
+def test_dumps_are_checked(open_limited, skyshelve_factory, tmp_path):
+    source = skyshelve_factory(in_memory=True)
+    source.set("big", b"x" * 1000)
+    dump = tmp_path / "dump.bin"
+    source.dump(dump)
+
+    store = open_limited(max_value_size=16)
+    with pytest.raises(SkyshelveError, match="value of 1001 bytes exceeds the 16 byte limit") as excinfo:
+        store.load(dump)
+    assert excinfo.value.code == ErrorCode.TOO_LARGE
+
+
+def test_negative_limits_are_rejected(tmp_path, shared_library):
+    with pytest.raises(SkyshelveError, match="must not be negative"):
+        SkyShelve(str(tmp_path / "limited"), lib_path=str(shared_library), options={"max_value_size": -1})
+
+
+def test_blobs_are_not_held_to_the_value_limit(open_limited):
+    store = open_limited(max_value_size=1024)
+    data = bytes(range(256)) * 2048
+
+    store.blob_put("big", data)
+    assert store.blob_get("big") == data
@@ -0,0 +1,38 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError, slatedb_url
+
+
+def test_slatedb_url_formats_s3_parameters():
+    url = slatedb_url("bucket/prefix", region="us-east-1", endpoint="http://localhost:9000", async_writes=True)
+
+    assert url.startswith("slatedb+s3://bucket/prefix?")
+    assert "region=us-east-1" in url
+    assert "endpoint=http%3A%2F%2Flocalhost%3A9000" in url
+    assert "async=true" in url
+
+
+def test_slatedb_url_formats_file_paths(tmp_path):
+    assert slatedb_url(str(tmp_path), provider="file") == f"slatedb+file://{tmp_path}"
+
+
+def test_slatedb_url_rejects_s3_options_for_files(tmp_path):
+    with pytest.raises(ValueError):
+        slatedb_url(str(tmp_path), provider="file", region="us-east-1")
+    with pytest.raises(ValueError):
+        slatedb_url("bucket", provider="gs")
+
+
+@pytest.mark.parametrize(
+    "url, message",
+    [
+        ("slatedb+s3:///prefix", "missing a bucket"),
+        ("slatedb+gs://bucket/prefix", "not available"),
+        ("slatedb+s3://bucket/prefix?regoin=us-east-1", "unknown slatedb URL parameter"),
+        ("slatedb+file:///tmp/x?region=us-east-1", "only applies to slatedb\\+s3"),
+        ("slatedb+s3://bucket?async=maybe", "invalid async flag"),
+    ],
+)
+def test_invalid_slatedb_urls_fail_to_open(shared_library, url, message):
+    with pytest.raises(SkyshelveError, match=message):
+        SkyShelve(url, lib_path=str(shared_library))
@@ -0,0 +1,81 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_snapshot_does_not_see_later_writes(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+    store.set("b", 2)
+
+    with store.snapshot() as snap:
+        store.set("a", 10)
+        store.delete("b")
+        store.set("c", 3)
+
+        assert snap.get("a") == 1
+        assert snap.get("b") == 2
+        assert "c" not in snap
+        assert snap.scan() == [(b"a", 1), (b"b", 2)]
+
+    assert store.scan() == [(b"a", 10), (b"c", 3)]
+
+
+def test_snapshot_is_read_only(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("a", 1)
+    snap = store.snapshot()
+    try:
+        with pytest.raises(SkyshelveError):
+            snap.set("a", 2)
+        assert store.get("a") == 1
+    finally:
+        snap.close()
+
+
+def test_snapshot_closed_by_parent(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+    snap = store.snapshot()
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        snap.get("a")
+    with pytest.raises(SkyshelveError, match="snapshot"):
+        snap.close()
+
+
+def test_snapshot_close_is_idempotent(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    snap = store.snapshot()
+    snap.close()
+    snap.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        snap.get("a")
+
+
+@pytest.mark.parametrize("in_memory", [True, False])
+def test_snapshot_rejects_read_modify_writes(skyshelve_factory, in_memory):
+    store = skyshelve_factory(in_memory=in_memory)
+    store.set("k", "v")
+
+    with store.snapshot() as snap:
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.set_nx("other", 1)
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.compare_and_swap("k", "v", "w")
+        with pytest.raises(SkyshelveError, match="read-only"):
+            snap.transaction()
+    assert store.get("k") == "v"
+    assert "other" not in store
+
+
+def test_memory_backend_snapshot_rejects_read_modify_writes(shared_library):
+    store = SkyShelve("memory:", lib_path=str(shared_library))
+    try:
+        with store.snapshot() as snap:
+            with pytest.raises(SkyshelveError, match="read-only"):
+                snap.get_set("k", 1)
+    finally:
+        store.close()
@@ -0,0 +1,32 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_stats_for_badger(skyshelve_factory):
+    store = skyshelve_factory()
+    for i in range(100):
+        store.set(f"k{i}", b"x" * 100)
+    store.sync()
+
+    stats = store.stats()
+    assert stats["backend"] == "badger"
+    assert "lsm_size_bytes" in stats
+    assert "vlog_size_bytes" in stats
+
+
+def test_stats_for_other_backends(tmp_path, shared_library):
+    store = SkyShelve(f"sqlite:{tmp_path / 'db.sqlite'}", lib_path=str(shared_library))
+    try:
+        store.set("k", 1)
+        assert store.stats()["backend"] == "sqlite"
+    finally:
+        store.close()
+
+
+def test_stats_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.stats()
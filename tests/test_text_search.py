@@ -0,0 +1,77 @@
+import json
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def indexed(tmp_path, shared_library):
+    store = SkyShelve(str(tmp_path / "db"), lib_path=str(shared_library), options={"indexes": True})
+    try:
+        yield store
+    finally:
+        store.close()
+
+
+def test_whole_value_search_ranks_by_term_counts(indexed):
+    indexed.set("doc:1", "The quick brown fox")
+    indexed.enable_text_index("doc:")
+    indexed.set("doc:2", "fox fox FOX and a dog")
+    indexed.set("doc:3", "a lazy dog")
+    indexed.set("note:1", "fox outside the prefix")
+
+    assert indexed.search_text("fox") == [(b"doc:2", 3.0), (b"doc:1", 1.0)]
+    assert indexed.search_text("Fox dog") == [(b"doc:2", 4.0), (b"doc:1", 1.0), (b"doc:3", 1.0)]
+    assert indexed.search_text("fox dog", limit=1) == [(b"doc:2", 4.0)]
+    assert indexed.search_text("cat") == []
+
+
+def test_index_follows_updates_and_deletes(indexed):
+    indexed.enable_text_index()
+    indexed.set("a", "red apple")
+    indexed.set("b", "green apple")
+
+    indexed.set("a", "yellow banana")
+    indexed.delete("b")
+
+    assert indexed.search_text("apple") == []
+    assert indexed.search_text("banana") == [(b"a", 1.0)]
+    assert "text:" in [index["name"] for index in indexed.list_indexes()]
+
+
+def test_json_path_reads_python_written_documents(indexed):
+    indexed.enable_text_index("post:", json_path="$.tags")
+    indexed.set("post:1", json.dumps({"title": "ignored words", "tags": ["python", "storage"]}))
+    indexed.set("post:2", json.dumps({"tags": ["go"]}).encode())
+    indexed.set("post:3", "not json python")
+
+    assert indexed.search_text("python go") == [(b"post:1", 1.0), (b"post:2", 1.0)]
+    assert indexed.search_text("ignored") == []
+
+
+def test_min_token_length(indexed):
+    indexed.enable_text_index(min_token_length=4)
+    indexed.set("k", "an ox ate some hay")
+
+    assert indexed.search_text("ox hay") == []
+    assert indexed.search_text("some") == [(b"k", 1.0)]
+
+
+def test_search_without_an_index_fails(indexed):
+    with pytest.raises(SkyshelveError, match="no text index is enabled"):
+        indexed.search_text("fox")
+
+
+def test_invalid_options_are_rejected(indexed):
+    with pytest.raises(SkyshelveError, match="min_token_length must be at least 1"):
+        indexed.enable_text_index(min_token_length=0)
+    with pytest.raises(SkyshelveError, match="invalid json path"):
+        indexed.enable_text_index(json_path="$.a[")
+
+
+def test_indexes_option_is_required(skyshelve_factory):
+    store = skyshelve_factory()
+
+    with pytest.raises(SkyshelveError):
+        store.enable_text_index()
@@ -0,0 +1,105 @@
+import json
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _tiered(tmp_path, shared_library, **config):
+    config.setdefault("hot", str(tmp_path / "hot"))
+    config.setdefault("cold", f"sqlite:{tmp_path / 'cold.db'}")
+    return SkyShelve(f"tiered:{json.dumps(config)}", lib_path=str(shared_library))
+
+
+def test_sync_persists_writes_to_the_cold_tier(tmp_path, shared_library):
+    store = _tiered(tmp_path, shared_library, flush_interval="1h")
+    store.set("a", 1)
+    store.set("b", 2)
+    store.delete("b")
+    assert store.get("a") == 1
+    store.sync()
+    store.close()
+
+    cold = SkyShelve(f"sqlite:{tmp_path / 'cold.db'}", lib_path=str(shared_library))
+    try:
+        assert cold.get("a") == 1
+        assert "b" not in cold
+    finally:
+        cold.close()
+
+
+def test_evicted_keys_are_read_from_the_cold_tier(tmp_path, shared_library):
+    store = _tiered(tmp_path, shared_library, max_hot_keys=2, flush_interval="20ms")
+    for i in range(5):
+        store.set(f"k{i}", i)
+    time.sleep(0.5)
+    store.close()
+
+    hot = SkyShelve(str(tmp_path / "hot"), lib_path=str(shared_library))
+    try:
+        assert hot.count("k") == 2
+    finally:
+        hot.close()
+
+    store = _tiered(tmp_path, shared_library, max_hot_keys=2)
+    try:
+        assert [store.get(f"k{i}") for i in range(5)] == list(range(5))
+        assert [key for key, _ in store.scan("k")] == [b"k0", b"k1", b"k2", b"k3", b"k4"]
+    finally:
+        store.close()
+
+
+def test_pending_writes_survive_reopen(tmp_path, shared_library):
+    store = _tiered(tmp_path, shared_library)
+    store.set("k", "v")
+    store.close()
+
+    store = _tiered(tmp_path, shared_library)
+    try:
+        assert store.get("k") == "v"
+    finally:
+        store.close()
+
+
+def test_tiered_opens_from_options(tmp_path, shared_library):
+    store = SkyShelve(
+        str(tmp_path / "hot"),
+        lib_path=str(shared_library),
+        options={"backend": "tiered", "tiered": {"cold": f"sqlite:{tmp_path / 'cold.db'}"}},
+    )
+    try:
+        store.set("k", b"v")
+        assert store.get("k") == b"v"
+    finally:
+        store.close()
+
+
+def test_ttl_writes_are_rejected(tmp_path, shared_library):
+    store = _tiered(tmp_path, shared_library)
+    try:
+        with pytest.raises(SkyshelveError):
+            store.set("k", "v", ttl=10)
+        assert "k" not in store
+    finally:
+        store.close()
+
+
+@pytest.mark.parametrize(
+    "config, message",
+    [
+        ({"hot": ""}, "hot tier must be set"),
+        ({"cold": ""}, "cold tier must be set"),
+        ({"max_hot_keys": -1}, "must not be negative"),
+        ({"flush_interval": "later"}, "invalid tiered flush_interval"),
+        ({"flush_batch": -1}, "must not be negative"),
+    ],
+)
+def test_invalid_tiered_configs_are_rejected(tmp_path, shared_library, config, message):
+    with pytest.raises(SkyshelveError, match=message):
+        _tiered(tmp_path, shared_library, **config)
+
+
+def test_tiered_path_needs_json(shared_library):
+    with pytest.raises(SkyshelveError, match="tiered paths take a JSON config"):
+        SkyShelve("tiered:cache", lib_path=str(shared_library))
@@ -0,0 +1,69 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def cpu(skyshelve_factory):
+    store = skyshelve_factory()
+    for ts, value in [(1000, 1.0), (1500, 3.0), (2000, 2.0), (2999, 6.0), (4000, 5.0)]:
+        store.ts_append("cpu", ts, value)
+    return store
+
+
+def test_raw_points_in_time_order(cpu):
+    assert cpu.ts_range("cpu", 1500, 4000) == [
+        (1500, 1, 3.0, 3.0, 3.0),
+        (2000, 1, 2.0, 2.0, 2.0),
+        (2999, 1, 6.0, 6.0, 6.0),
+    ]
+
+
+def test_downsampling_aligns_windows_to_the_epoch(cpu):
+    assert cpu.ts_range("cpu", 0, 10_000, downsample_ms=1000) == [
+        (1000, 2, 4.0, 1.0, 3.0),
+        (2000, 2, 8.0, 2.0, 6.0),
+        (4000, 1, 5.0, 5.0, 5.0),
+    ]
+
+
+def test_append_replaces_a_point_at_the_same_time(cpu):
+    cpu.ts_append("cpu", 2000, 9.5)
+
+    assert cpu.ts_range("cpu", 2000, 2001) == [(2000, 1, 9.5, 9.5, 9.5)]
+
+
+def test_negative_timestamps_sort_first(skyshelve_factory):
+    store = skyshelve_factory()
+    store.ts_append("s", 5, 1.0)
+    store.ts_append("s", -1500, 2.0)
+
+    assert [w[0] for w in store.ts_range("s", -10_000, 10_000)] == [-1500, 5]
+    assert store.ts_range("s", -10_000, 10_000, downsample_ms=1000)[0] == (-2000, 1, 2.0, 2.0, 2.0)
+
+
+def test_series_are_separate_and_missing_series_are_empty(cpu):
+    cpu.ts_append("mem", 1000, 42.0)
+
+    assert cpu.ts_range("mem", 0, 10_000) == [(1000, 1, 42.0, 42.0, 42.0)]
+    assert cpu.ts_range("disk", 0, 10_000) == []
+    assert cpu.ts_range("cpu", 5000, 1000) == []
+    assert cpu.scan() == []
+
+
+def test_series_survive_reopen(tmp_path, shared_library):
+    path = str(tmp_path / "db")
+    with SkyShelve(path, lib_path=str(shared_library)) as store:
+        store.ts_append("cpu", 1, 0.5)
+    with SkyShelve(path, lib_path=str(shared_library)) as store:
+        assert store.ts_range("cpu", 0, 2) == [(1, 1, 0.5, 0.5, 0.5)]
+
+
+def test_series_on_a_closed_store_fails(skyshelve_factory):
+    store = skyshelve_factory()
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.ts_append("cpu", 1, 1.0)
+    with pytest.raises(SkyshelveError):
+        store.ts_range("cpu", 0, 2)
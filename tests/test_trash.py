@@ -0,0 +1,172 @@
+import os
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _open(tmp_path, shared_library, retention=None, **options):
+    soft_delete = {} if retention is None else {"retention": retention}
+    return SkyShelve(
+        str(tmp_path / "trash"),
+        lib_path=str(shared_library),
+        options={"soft_delete": soft_delete, **options},
+    )
+
+
+@pytest.fixture
+def store(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    yield store
+    store.close()
+
+
+def test_delete_moves_entries_to_the_trash(store):
+    store.set("a", {"n": 1})
+    store.set("b", b"raw")
+    before = time.time()
+    assert store.delete("a") is True
+    del store["b"]
+
+    assert store.get("a") is None
+    assert "b" not in store
+    assert store.scan() == []
+    trashed = store.trash_scan()
+    assert [(key, value) for _, key, value in trashed] == [(b"a", {"n": 1}), (b"b", b"raw")]
+    assert all(before - 1 <= at <= time.time() + 1 for at, _, _ in trashed)
+
+
+def test_undelete_restores_the_value(store):
+    store.set("a", [1, 2, 3])
+    store.delete("a")
+
+    store.undelete("a")
+
+    assert store.get("a") == [1, 2, 3]
+    assert store.trash_scan() == []
+
+
+def test_trash_keeps_the_last_deleted_value(store):
+    store.set("a", "first")
+    store.delete("a")
+    store.set("a", "second")
+    store.delete("a")
+
+    assert [value for _, _, value in store.trash_scan()] == ["second"]
+    store.undelete("a")
+    assert store.get("a") == "second"
+
+
+def test_batch_and_prefix_deletes_are_trashed(store):
+    for i in range(3):
+        store.set(f"user:{i}", i)
+    store.set("keep", "x")
+
+    store.apply([("delete", b"keep", None)])
+    assert store.delete_prefix("user:") == 3
+
+    assert [key for _, key, _ in store.trash_scan()] == [b"keep", b"user:0", b"user:1", b"user:2"]
+    assert [key for _, key, _ in store.trash_scan("user:")] == [b"user:0", b"user:1", b"user:2"]
+    assert store.trash_scan("missing:") == []
+
+
+def test_deleting_a_missing_key_trashes_nothing(store):
+    store.delete("never-set")
+    assert store.trash_scan() == []
+
+
+def test_undelete_of_rewritten_key_raises(store):
+    store.set("a", "old")
+    store.delete("a")
+    store.set("a", "new")
+
+    with pytest.raises(SkyshelveError, match="key exists"):
+        store.undelete("a")
+    assert store.get("a") == "new"
+    assert [value for _, _, value in store.trash_scan()] == ["old"]
+
+
+def test_undelete_of_key_not_in_trash_raises(store):
+    with pytest.raises(SkyshelveError, match="not in the trash"):
+        store.undelete("missing")
+
+
+def test_trash_survives_reopen(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library)
+    store.set("a", "value")
+    store.delete("a")
+    store.close()
+
+    store = _open(tmp_path, shared_library)
+    try:
+        store.undelete("a")
+        assert store.get("a") == "value"
+    finally:
+        store.close()
+
+
+def test_retention_purges_old_entries(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library, retention="200ms")
+    try:
+        store.set("a", 1)
+        store.delete("a")
+        assert len(store.trash_scan()) == 1
+
+        deadline = time.time() + 5
+        while store.trash_scan() and time.time() < deadline:
+            time.sleep(0.05)
+        assert store.trash_scan() == []
+        with pytest.raises(SkyshelveError, match="not in the trash"):
+            store.undelete("a")
+    finally:
+        store.close()
+
+
+def test_erase_empties_the_trash_too(store):
+    store.set("pii:1", "alice")
+    store.delete("pii:1")
+    store.set("pii:2", "bob")
+
+    report = store.erase("pii:")
+
+    assert report["deleted"] == 1
+    assert report["remaining"] == 0
+    assert report["verified"] is True
+    assert store.trash_scan() == []
+
+
+@pytest.mark.parametrize(
+    "retention, message",
+    [("soon", "invalid soft_delete retention"), ("-1s", "retention must be positive")],
+)
+def test_invalid_retention_is_rejected(tmp_path, shared_library, retention, message):
+    with pytest.raises(SkyshelveError, match=message):
+        _open(tmp_path, shared_library, retention=retention)
+
+
+def test_store_without_soft_delete_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("a", 1)
+    store.delete("a")
+
+    with pytest.raises(SkyshelveError, match="not opened with soft_delete"):
+        store.undelete("a")
+    with pytest.raises(SkyshelveError, match="not opened with soft_delete"):
+        store.trash_scan()
+
+
+def test_library_records_are_not_trashed(tmp_path, shared_library):
+    store = _open(tmp_path, shared_library, change_log=True)
+    try:
+        for i in range(3):
+            store.set(f"k{i}", i)
+        last = store.changes_since(0)[-1][0]
+        assert store.trim_changes(last) > 0
+        store.blob_put("video", os.urandom(3 * 256 * 1024))
+        store.blob_put("video", b"replacement")
+        store.blob_delete("video")
+
+        assert store.trash_scan() == []
+    finally:
+        store.close()
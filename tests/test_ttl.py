@@ -0,0 +1,56 @@
+import time
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_set_with_ttl_expires(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("short", "lived", ttl=1)
+    store.set("forever", "lives")
+
+    assert store.get("short") == "lived"
+    time.sleep(2.2)
+
+    assert store.get("short") is None
+    assert "short" not in store
+    assert store.get("forever") == "lives"
+    assert [key for key, _ in store.scan()] == [b"forever"]
+
+
+def test_non_positive_ttl_behaves_like_set(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("zero", 1, ttl=0)
+    store.set("negative", 2, ttl=-5)
+    time.sleep(1.1)
+
+    assert store.get("zero") == 1
+    assert store.get("negative") == 2
+
+
+def test_plain_set_clears_ttl(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("k", "old", ttl=1)
+    store.set("k", "new")
+    time.sleep(2.2)
+
+    assert store.get("k") == "new"
+
+
+def test_set_with_ttl_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.set("k", 1, ttl=10)
+
+
+def test_ttl_over_maximum_is_rejected(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+
+    with pytest.raises(SkyshelveError, match="100-year maximum"):
+        store.set("k", 1, ttl=2**62)
+    assert "k" not in store
+    store.set("k", 1, ttl=99 * 365 * 24 * 3600)
+    assert store.get("k") == 1
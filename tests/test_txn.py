@@ -0,0 +1,63 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_transaction_commits_on_exit(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("gone", 1)
+
+    with store.transaction() as txn:
+        txn.set("a", {"n": 1})
+        txn.delete("gone")
+        assert txn.get("a") == {"n": 1}
+        assert txn.get("gone") is None
+        assert store.get("a") is None
+
+    assert store.get("a") == {"n": 1}
+    assert "gone" not in store
+
+
+def test_transaction_rolls_back_on_error(skyshelve_factory):
+    store = skyshelve_factory()
+
+    with pytest.raises(RuntimeError):
+        with store.transaction() as txn:
+            txn.set("a", "pending")
+            raise RuntimeError("abort")
+
+    assert store.get("a") is None
+
+
+def test_transaction_explicit_rollback(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    txn = store.transaction()
+    txn.set("a", b"x")
+    txn.rollback()
+
+    assert store.get("a") is None
+    txn.rollback()
+
+
+def test_transaction_conflict(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("counter", 0)
+
+    first = store.transaction()
+    second = store.transaction()
+    first.set("counter", first.get("counter") + 1)
+    second.set("counter", second.get("counter") + 1)
+    first.commit()
+
+    with pytest.raises(SkyshelveError, match="[Cc]onflict"):
+        second.commit()
+    assert store.get("counter") == 1
+
+
+def test_finished_transaction_rejects_use(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    txn = store.transaction()
+    txn.commit()
+
+    with pytest.raises(SkyshelveError, match="finished"):
+        txn.set("a", 1)
@@ -0,0 +1,75 @@
+import threading
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.mark.parametrize("in_memory", [False, True])
+def test_update_writes_the_computed_value(skyshelve_factory, in_memory):
+    store = skyshelve_factory(in_memory=in_memory)
+    store["tags"] = ["a"]
+
+    assert store.update("tags", lambda tags: tags + ["b"]) is True
+    assert store["tags"] == ["a", "b"]
+
+
+def test_missing_key_sees_the_default(skyshelve_factory):
+    store = skyshelve_factory()
+    seen = []
+
+    def create(current):
+        seen.append(current)
+        return b"fresh"
+
+    assert store.update("new", create, default=b"none") is True
+    assert seen == [b"none"]
+    assert store["new"] == b"fresh"
+
+
+def test_keep_and_delete(skyshelve_factory):
+    store = skyshelve_factory()
+    store["k"] = "v"
+
+    assert store.update("k", lambda _: SkyShelve.KEEP) is False
+    assert store["k"] == "v"
+    assert store.update("k", lambda _: SkyShelve.DELETE) is True
+    assert "k" not in store
+    assert store.update("k", lambda _: SkyShelve.DELETE) is False
+
+
+def test_exception_aborts_the_update(skyshelve_factory):
+    store = skyshelve_factory()
+    store["k"] = 1
+
+    def boom(_):
+        raise ValueError("no thanks")
+
+    with pytest.raises(ValueError, match="no thanks"):
+        store.update("k", boom)
+    assert store["k"] == 1
+
+
+def test_concurrent_updates_do_not_lose_writes(skyshelve_factory):
+    store = skyshelve_factory()
+    store["count"] = 0
+
+    def work():
+        for _ in range(50):
+            store.update("count", lambda n: n + 1)
+
+    threads = [threading.Thread(target=work) for _ in range(4)]
+    for thread in threads:
+        thread.start()
+    for thread in threads:
+        thread.join()
+
+    assert store["count"] == 200
+
+
+def test_update_on_a_closed_store_fails(skyshelve_factory):
+    store = skyshelve_factory()
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.update("k", lambda _: b"v")
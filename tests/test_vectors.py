@@ -0,0 +1,71 @@
+import math
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+@pytest.fixture
+def vectors(skyshelve_factory):
+    store = skyshelve_factory()
+    store.vector_put("east", [1, 0, 0])
+    store.vector_put("north", [0, 1, 0])
+    store.vector_put("northeast", [1, 1, 0])
+    store.vector_put("west", [-1, 0, 0])
+    return store
+
+
+def test_search_ranks_by_cosine_similarity(vectors):
+    hits = vectors.vector_search([2, 0.1, 0], k=3)
+
+    assert [key for key, _ in hits] == [b"east", b"northeast", b"north"]
+    assert hits[0][1] == pytest.approx(2 / math.hypot(2, 0.1), rel=1e-6)
+    assert vectors.vector_search([1, 0, 0], k=0)[-1] == (b"west", pytest.approx(-1.0))
+
+
+def test_put_replaces_and_delete_removes(vectors):
+    vectors.vector_put("west", [1, 0, 0.001])
+    vectors.vector_delete("east")
+    vectors.vector_delete("east")
+
+    assert [key for key, _ in vectors.vector_search([1, 0, 0], k=1)] == [b"west"]
+
+
+def test_embeddings_live_apart_from_values(vectors):
+    vectors.set("east", "a value")
+
+    assert vectors.get("east") == "a value"
+    assert vectors.scan() == [(b"east", "a value")]
+    assert vectors.vector_search([1, 0, 0], k=1)[0][0] == b"east"
+
+
+def test_embeddings_are_reloaded_after_reopen(tmp_path, shared_library):
+    path = str(tmp_path / "db")
+    with SkyShelve(path, lib_path=str(shared_library)) as store:
+        store.vector_put("a", [0.5, 0.5])
+        store.vector_put("b", [0.5, -0.5])
+    with SkyShelve(path, lib_path=str(shared_library)) as store:
+        assert [key for key, _ in store.vector_search([1, 1], k=2)] == [b"a", b"b"]
+
+
+def test_empty_store_has_no_hits(skyshelve_factory):
+    assert skyshelve_factory().vector_search([1.0, 2.0]) == []
+
+
+@pytest.mark.parametrize(
+    "embedding, message",
+    [
+        ([1, 0], "embedding has 2 dimensions, the store uses 3"),
+        ([0, 0, 0], "must not be all zeros"),
+        ([1, math.inf, 0], "must be finite"),
+        ([], "at least one dimension"),
+    ],
+)
+def test_invalid_embeddings_are_rejected(vectors, embedding, message):
+    with pytest.raises(SkyshelveError, match=message):
+        vectors.vector_put("bad", embedding)
+
+
+def test_query_dimension_must_match(vectors):
+    with pytest.raises(SkyshelveError, match="query has 2 dimensions"):
+        vectors.vector_search([1, 0])
@@ -0,0 +1,28 @@
+import platform
+import re
+from pathlib import Path
+
+from skyshelve import SkyShelve
+
+PROJECT_ROOT = Path(__file__).resolve().parents[1]
+
+
+def test_version_matches_package(shared_library):
+    info = SkyShelve.version(lib_path=str(shared_library))
+
+    pyproject = (PROJECT_ROOT / "pyproject.toml").read_text()
+    assert info["version"] == re.search(r'^version = "([^"]+)"', pyproject, re.M).group(1)
+    assert info["go"].startswith("go")
+    assert info["os"] == platform.system().lower()
+    assert info["badger"].startswith("v4.")
+
+
+def test_capabilities_lists_backends_and_features(shared_library):
+    caps = SkyShelve.capabilities(lib_path=str(shared_library))
+
+    assert sorted(caps["backends"]) == sorted(SkyShelve.list_backends())
+    assert {"async", "checksums", "encryption", "execute"} <= set(caps["features"])
+    assert caps["features"] == sorted(caps["features"])
+    assert {"ttl", "transactions", "watch", "snapshots"} <= set(caps["backends"]["badger"])
+    assert "ttl" not in caps["backends"]["memory"]
+    assert "compact" in caps["backends"]["sqlite"]
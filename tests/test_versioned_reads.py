@@ -0,0 +1,98 @@
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def test_get_at_reads_past_values(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("k", "first")
+    first = store.current_version()
+    store.set("k", "second")
+    second = store.current_version()
+    store.delete("k")
+
+    assert first < second < store.current_version()
+    assert store.get_at("k", first) == "first"
+    assert store.get_at("k", second) == "second"
+    assert store.get_at("k", store.current_version()) is None
+    assert store.get_at("k", store.current_version(), default="gone") == "gone"
+
+
+def test_get_at_before_the_first_write_finds_nothing(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("other", 1)
+    before = store.current_version()
+    store.set("k", "v")
+
+    assert store.get_at("k", before) is None
+
+
+def test_get_at_finds_an_empty_value(skyshelve_factory):
+    store = skyshelve_factory()
+    # set() tags every value with its type, so write the empty value directly.
+    assert store._lib.Set(store._handle, b"k", 1, b"", 0) == 0
+    version = store.current_version()
+    store.set("k", "later")
+
+    assert store.get_at("k", version, default="missing") == b""
+
+
+def test_scan_at_sees_the_past_key_set(skyshelve_factory):
+    store = skyshelve_factory()
+    store.set("user:1", "a")
+    store.set("user:2", "b")
+    version = store.current_version()
+    store.delete("user:1")
+    store.set("user:2", "B")
+    store.set("user:3", "c")
+
+    assert store.scan_at("user:", version) == [(b"user:1", "a"), (b"user:2", "b")]
+    assert store.scan_at(None, version) == [(b"user:1", "a"), (b"user:2", "b")]
+    assert store.scan_at("user:", store.current_version()) == store.scan("user:")
+
+
+def test_versioned_reads_decode_compressed_values(tmp_path, shared_library):
+    store = SkyShelve(
+        str(tmp_path / "db"),
+        lib_path=str(shared_library),
+        options={"compression": {"algorithm": "zstd", "min_size": 1}},
+    )
+    try:
+        store.set("k", "x" * 500)
+        version = store.current_version()
+        store.set("k", "y")
+        assert store.get_at("k", version) == "x" * 500
+        assert store.scan_at("k", version) == [(b"k", "x" * 500)]
+    finally:
+        store.close()
+
+
+@pytest.mark.parametrize("version", [0, -5])
+def test_version_must_be_positive(skyshelve_factory, version):
+    store = skyshelve_factory()
+
+    with pytest.raises(SkyshelveError, match="version must be positive"):
+        store.get_at("k", version)
+    with pytest.raises(SkyshelveError, match="version must be positive"):
+        store.scan_at("k", version)
+
+
+@pytest.mark.parametrize("backend", ["memory", "sqlite", "bolt"])
+def test_backends_without_versions_reject_versioned_reads(tmp_path, shared_library, backend):
+    path = None if backend == "memory" else str(tmp_path / "db")
+    store = SkyShelve(path, lib_path=str(shared_library), options={"backend": backend})
+    try:
+        for call in (store.current_version, lambda: store.get_at("k", 1), lambda: store.scan_at("k", 1)):
+            with pytest.raises(SkyshelveError, match="versioned reads are not supported"):
+                call()
+    finally:
+        store.close()
+
+
+def test_negative_num_versions_to_keep_is_rejected(tmp_path, shared_library):
+    with pytest.raises(SkyshelveError, match="num_versions_to_keep must not be negative"):
+        SkyShelve(
+            str(tmp_path / "db"),
+            lib_path=str(shared_library),
+            options={"badger": {"num_versions_to_keep": -1}},
+        )
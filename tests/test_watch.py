@@ -0,0 +1,62 @@
+import time
+
+import pytest
+
+from skyshelve import SkyShelve, SkyshelveError
+
+
+def _drain(watch, want, timeout=5.0):
+    events = []
+    deadline = time.time() + timeout
+    while len(events) < want and time.time() < deadline:
+        events.extend(watch.next(timeout=0.5))
+    return events
+
+
+def test_watch_reports_sets_and_deletes(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    with store.watch("user:") as watch:
+        time.sleep(0.2)
+        store.set("user:1", {"name": "ada"})
+        store.set("other", 1)
+        store.delete("user:1")
+
+        events = _drain(watch, 2)
+
+    assert events == [("set", b"user:1", {"name": "ada"}), ("delete", b"user:1", None)]
+
+
+def test_watch_times_out_without_events(skyshelve_factory):
+    store = skyshelve_factory()
+    with store.watch() as watch:
+        started = time.time()
+        assert watch.next(timeout=0.2) == []
+        assert time.time() - started >= 0.15
+
+
+def test_watch_unsupported_backend(shared_library):
+    store = SkyShelve(None, lib_path=str(shared_library), options={"backend": "memory"})
+    try:
+        with pytest.raises(SkyshelveError, match="not supported"):
+            store.watch()
+    finally:
+        store.close()
+
+
+def test_watch_closed_with_store(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    watch = store.watch()
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        watch.next(timeout=0.1)
+
+
+def test_closed_watch_rejects_next(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    watch = store.watch()
+    watch.close()
+    watch.close()
+
+    with pytest.raises(SkyshelveError, match="closed"):
+        watch.next()
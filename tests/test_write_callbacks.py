@@ -0,0 +1,64 @@
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+def test_write_callback_sees_every_write(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    seen = []
+    store.register_write_callback(lambda op, key, value: seen.append((op, key, value)))
+
+    store.set("a", {"n": 1})
+    store.delete("a")
+    store._apply([("set", b"b", "two"), ("delete", b"c", None)])
+    with store.transaction() as txn:
+        txn.set("d", b"txn")
+
+    assert seen == [
+        ("set", b"a", {"n": 1}),
+        ("delete", b"a", None),
+        ("set", b"b", "two"),
+        ("delete", b"c", None),
+        ("set", b"d", b"txn"),
+    ]
+
+
+def test_failed_writes_are_not_reported(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.set("lock", 1)
+    seen = []
+    store.register_write_callback(lambda op, key, value: seen.append(key))
+
+    assert not store.set_nx("lock", 2)
+    assert seen == []
+
+
+def test_unregister_write_callback(skyshelve_factory):
+    store = skyshelve_factory()
+    first, second = [], []
+    first_id = store.register_write_callback(lambda op, key, value: first.append(key))
+    store.register_write_callback(lambda op, key, value: second.append(key))
+
+    store.set("a", 1)
+    store.unregister_write_callback(first_id)
+    store.set("b", 2)
+
+    assert first == [b"a"]
+    assert second == [b"a", b"b"]
+
+
+def test_unregister_unknown_callback_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    callback_id = store.register_write_callback(lambda *args: None)
+    store.unregister_write_callback(callback_id)
+
+    with pytest.raises(SkyshelveError, match="callback"):
+        store.unregister_write_callback(callback_id)
+
+
+def test_register_on_closed_store_raises(skyshelve_factory):
+    store = skyshelve_factory(in_memory=True)
+    store.close()
+
+    with pytest.raises(SkyshelveError):
+        store.register_write_callback(lambda *args: None)
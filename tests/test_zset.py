@@ -0,0 +1,53 @@
+import math
+
+import pytest
+
+from skyshelve import SkyshelveError
+
+
+@pytest.fixture
+def board(skyshelve_factory):
+    store = skyshelve_factory()
+    for member, score in [("ann", 30), ("bob", 12.5), ("cat", 30), ("dan", -4)]:
+        assert store.zadd("board", member, score) is True
+    return store
+
+
+def test_range_orders_by_score_then_member(board):
+    assert board.zrange_by_score("board") == [(b"dan", -4.0), (b"bob", 12.5), (b"ann", 30.0), (b"cat", 30.0)]
+
+
+def test_range_bounds_are_inclusive_and_limit_applies(board):
+    assert board.zrange_by_score("board", 12.5, 30, limit=2) == [(b"bob", 12.5), (b"ann", 30.0)]
+    assert board.zrange_by_score("board", 31, 100) == []
+
+
+def test_zadd_moves_an_existing_member(board):
+    assert board.zadd("board", "dan", 99) is False
+
+    assert board.zrange_by_score("board", 50) == [(b"dan", 99.0)]
+    assert [m for m, _ in board.zrange_by_score("board")] == [b"bob", b"ann", b"cat", b"dan"]
+
+
+def test_zrem(board):
+    assert board.zrem("board", "bob") is True
+    assert board.zrem("board", "bob") is False
+
+    assert [m for m, _ in board.zrange_by_score("board")] == [b"dan", b"ann", b"cat"]
+
+
+def test_sets_are_separate_and_infinite_scores_work(skyshelve_factory):
+    store = skyshelve_factory()
+    store.zadd("a", "x", math.inf)
+    store.zadd("b", "x", -math.inf)
+
+    assert store.zrange_by_score("a") == [(b"x", math.inf)]
+    assert store.zrange_by_score("b") == [(b"x", -math.inf)]
+    assert store.zrange_by_score("missing") == []
+
+
+def test_nan_is_rejected(board):
+    with pytest.raises(SkyshelveError, match="score must not be NaN"):
+        board.zadd("board", "eve", math.nan)
+    with pytest.raises(SkyshelveError, match="score bounds must not be NaN"):
+        board.zrange_by_score("board", math.nan)
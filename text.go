@@ -0,0 +1,283 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// A text index is a secondary index whose values are terms: each key under
+// the index's prefix has one entry per distinct term in its text, holding
+// the term's count as a big-endian u32.
+const (
+	textIndexNamePrefix   = "text:"
+	defaultMinTokenLength = 2
+	// maxTermBytes drops tokens too long to be words, such as encoded blobs.
+	maxTermBytes = 64
+)
+
+// textOptions is the stored configuration of a text index.
+type textOptions struct {
+	Prefix         []byte `json:"prefix"`
+	MinTokenLength int    `json:"min_token_length"`
+}
+
+// textIndexRequest is the options document EnableTextIndex takes.
+type textIndexRequest struct {
+	JSONPath       string `json:"json_path"`
+	MinTokenLength *int   `json:"min_token_length"`
+}
+
+func textIndexName(prefix []byte) string {
+	return textIndexNamePrefix + string(prefix)
+}
+
+// tokenize lowercases text and splits it into runs of letters and digits,
+// dropping tokens shorter than minLen runes or longer than maxTermBytes.
+func tokenize(text string, minLen int) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := words[:0]
+	for _, w := range words {
+		if utf8.RuneCountInString(w) >= minLen && len(w) <= maxTermBytes {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// indexedText returns the text a text index reads from value: the whole
+// value, or the strings, numbers and booleans at its JSON path. JSON values
+// written by the Python wrapper are read past their tag.
+func (ix *secondaryIndex) indexedText(value []byte) (string, bool) {
+	if ix.def.JSONPath == "" {
+		return string(value), true
+	}
+	doc, err := decodeJSON(value[pythonTagLen(value):])
+	if err != nil {
+		return "", false
+	}
+	node := followJSONPath(doc, ix.path)
+	if v, ok := jsonScalar(node); ok {
+		return string(v), true
+	}
+	list, ok := node.([]any)
+	if !ok {
+		return "", false
+	}
+	var parts []string
+	for _, elem := range list {
+		if v, ok := jsonScalar(elem); ok {
+			parts = append(parts, string(v))
+		}
+	}
+	return strings.Join(parts, " "), len(parts) > 0
+}
+
+// textEntries returns one entry per distinct term in key's text, with the
+// term's count as the payload. Keys outside the index's prefix have none.
+func (ix *secondaryIndex) textEntries(key, value []byte) []indexEntry {
+	opts := ix.def.Text
+	if !bytes.HasPrefix(key, opts.Prefix) {
+		return nil
+	}
+	text, ok := ix.indexedText(value)
+	if !ok {
+		return nil
+	}
+	counts := make(map[string]uint32)
+	var terms []string
+	for _, t := range tokenize(text, opts.MinTokenLength) {
+		if counts[t] == 0 {
+			terms = append(terms, t)
+		}
+		counts[t]++
+	}
+	out := make([]indexEntry, len(terms))
+	for i, t := range terms {
+		out[i] = indexEntry{value: []byte(t), payload: binary.BigEndian.AppendUint32(nil, counts[t])}
+	}
+	return out
+}
+
+// enableTextIndex builds a text index over the keys under prefix.
+func (s *indexStore) enableTextIndex(prefix []byte, rawOptions string) error {
+	var req textIndexRequest
+	if strings.TrimSpace(rawOptions) != "" {
+		dec := json.NewDecoder(strings.NewReader(rawOptions))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return fmt.Errorf("invalid text index options: %w", err)
+		}
+	}
+	minLen := defaultMinTokenLength
+	if req.MinTokenLength != nil {
+		if *req.MinTokenLength < 1 {
+			return errors.New("min_token_length must be at least 1")
+		}
+		minLen = *req.MinTokenLength
+	}
+	path, err := parseJSONPath(req.JSONPath)
+	if err != nil {
+		return err
+	}
+	return s.createIndex(&secondaryIndex{
+		def: indexDef{
+			Name:     textIndexName(prefix),
+			JSONPath: req.JSONPath,
+			Text:     &textOptions{Prefix: prefix, MinTokenLength: minLen},
+		},
+		path: path,
+	})
+}
+
+// textHit is a key matching a text search and its score.
+type textHit struct {
+	key   []byte
+	score float64
+}
+
+// searchText scores each key by the summed counts of the query's terms in
+// its text, across every text index, and returns the best limit keys (all of
+// them when limit is not positive), highest score first and ties in key
+// order. A key in more than one text index keeps its best score.
+func (s *indexStore) searchText(query string, limit int) ([]textHit, error) {
+	s.mu.Lock()
+	var texts []*secondaryIndex
+	for _, ix := range s.indexes {
+		if ix.def.Text != nil {
+			texts = append(texts, ix)
+		}
+	}
+	s.mu.Unlock()
+	if len(texts) == 0 {
+		return nil, errors.New("no text index is enabled")
+	}
+
+	scores := make(map[string]float64)
+	for _, ix := range texts {
+		own := make(map[string]float64)
+		seen := make(map[string]bool)
+		for _, term := range tokenize(query, ix.def.Text.MinTokenLength) {
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			prefix := indexValuePrefix(ix.def.Name, []byte(term))
+			err := s.inner.Iterate(prefix, func(k, v []byte) error {
+				if len(v) != 4 {
+					return errors.New("malformed text index entry")
+				}
+				own[string(k[len(prefix):])] += float64(binary.BigEndian.Uint32(v))
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		for k, score := range own {
+			scores[k] = math.Max(scores[k], score)
+		}
+	}
+
+	hits := make([]textHit, 0, len(scores))
+	for k, score := range scores {
+		hits = append(hits, textHit{key: []byte(k), score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return bytes.Compare(hits[i].key, hits[j].key) < 0
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// EnableTextIndex keeps a full-text index of the values under prefix (every
+// key when prefixLen is 0), built from the existing data and updated with
+// every later write like CreateIndex. options is an optional JSON document:
+// "json_path" indexes the text at that path of JSON values instead of the
+// whole value, and "min_token_length" (default 2) drops shorter words. The
+// index is named "text:" followed by the prefix, for ListIndexes and
+// DropIndex. The store must be opened with "indexes": true.
+//
+//export EnableTextIndex
+func EnableTextIndex(handle C.uintptr_t, prefix *C.char, prefixLen C.int, options *C.char) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	store, err := indexesFor(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	pref := []byte{}
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	var raw string
+	if options != nil {
+		raw = C.GoString(options)
+	}
+	return setHandleError(id, store.enableTextIndex(pref, raw))
+}
+
+// SearchText returns the keys whose indexed text contains any word of query,
+// ranked by how often the query's words occur in them, using Scan's framing
+// with the score as a little-endian f64 value. A non-positive limit returns
+// every match. Release the result with FreeBuffer.
+//
+//export SearchText
+func SearchText(handle C.uintptr_t, query *C.char, limit C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "search_text", time.Now())
+	*resultLen = 0
+	id := uintptr(handle)
+	store, err := indexesFor(id)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	hits, err := store.searchText(C.GoString(query), int(limit))
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	if len(hits) == 0 {
+		setHandleError(id, nil)
+		return nil
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	var score [8]byte
+	for _, h := range hits {
+		binary.LittleEndian.PutUint64(score[:], math.Float64bits(h.score))
+		buffer = appendEntry(buffer, h.key, score[:])
+	}
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(id, nil)
+	return mem
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	defaultTierFlushInterval = time.Second
+	defaultTierFlushBatch    = 1000
+)
+
+// tierDirtyPrefix marks hot-tier keys whose latest write has not reached the
+// cold tier yet. The marker holds the generation of that write; a marker
+// without a hot entry is a pending delete.
+var tierDirtyPrefix = []byte("\xfftier/dirty/")
+
+type tieredConfig struct {
+	// Hot is the local tier, a badger directory or any location Open
+	// accepts whose backend supports transactions.
+	Hot string `json:"hot"`
+	// Cold is the durable tier, normally a slatedb+s3:// or slatedb+file://
+	// location.
+	Cold string `json:"cold"`
+	// MaxHotKeys evicts the least recently used entries already persisted
+	// to the cold tier once the hot tier holds more keys. Zero never evicts.
+	MaxHotKeys int `json:"max_hot_keys,omitempty"`
+	// FlushInterval is how often pending writes are copied to the cold tier,
+	// as a Go duration string; FlushBatch caps the writes per cold batch.
+	FlushInterval string `json:"flush_interval,omitempty"`
+	FlushBatch    int    `json:"flush_batch,omitempty"`
+}
+
+// tieredStore serves reads and writes from a local hot tier and persists
+// them to a cold tier in the background. Keys missing from the hot tier are
+// read from the cold one and promoted. Scans read the cold tier merged with
+// the writes still pending, so they see every key, evicted or not.
+//
+// Writes are acknowledged once they are in the hot tier; Sync waits for
+// them to reach the cold tier. TTL writes are not supported.
+type tieredStore struct {
+	hot, cold kvStore
+	maxKeys   int
+	batch     int
+	gen       atomic.Uint64
+
+	// lruMu guards the recency list of hot-tier keys, most recent first.
+	lruMu sync.Mutex
+	lru   *list.List
+	index map[string]*list.Element
+
+	// flushMu serialises flushes between the background loop and Sync.
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func init() { registerBackend("tiered", openTiered) }
+
+// openTiered opens a "tiered:" path, which is a JSON tieredConfig.
+func openTiered(raw string) (kvStore, error) {
+	configPart := strings.TrimSpace(raw[len("tiered:"):])
+	configPart = strings.TrimPrefix(configPart, "//")
+	if !strings.HasPrefix(configPart, "{") {
+		return nil, errors.New(`tiered paths take a JSON config, e.g. tiered:{"hot": "cache", "cold": "slatedb+file:///data"}`)
+	}
+	var cfg tieredConfig
+	if err := json.Unmarshal([]byte(configPart), &cfg); err != nil {
+		return nil, err
+	}
+	return openTieredConfig(&cfg)
+}
+
+func openTieredConfig(cfg *tieredConfig) (kvStore, error) {
+	if cfg.Hot == "" {
+		return nil, errors.New("tiered hot tier must be set")
+	}
+	if cfg.Cold == "" {
+		return nil, errors.New("tiered cold tier must be set")
+	}
+	if cfg.MaxHotKeys < 0 || cfg.FlushBatch < 0 {
+		return nil, errors.New("tiered max_hot_keys and flush_batch must not be negative")
+	}
+	interval := defaultTierFlushInterval
+	if cfg.FlushInterval != "" {
+		d, err := time.ParseDuration(cfg.FlushInterval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid tiered flush_interval %q", cfg.FlushInterval)
+		}
+		interval = d
+	}
+	hot, err := openStore(cfg.Hot, false)
+	if err != nil {
+		return nil, fmt.Errorf("hot tier: %w", err)
+	}
+	if _, ok := hot.(txnStore); !ok {
+		hot.Close()
+		return nil, errors.New("tiered hot tier must support transactions")
+	}
+	cold, err := openStore(cfg.Cold, false)
+	if err != nil {
+		hot.Close()
+		return nil, fmt.Errorf("cold tier: %w", err)
+	}
+
+	s := &tieredStore{
+		hot:     hot,
+		cold:    cold,
+		maxKeys: cfg.MaxHotKeys,
+		batch:   cfg.FlushBatch,
+		lru:     list.New(),
+		index:   make(map[string]*list.Element),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if s.batch == 0 {
+		s.batch = defaultTierFlushBatch
+	}
+	// Generations only need to differ between writes to one key, including
+	// across restarts.
+	s.gen.Store(uint64(time.Now().UnixNano()))
+	if s.maxKeys > 0 {
+		// Entries already cached start out equally cold, in key order.
+		err = hot.IterateRange(nil, nil, func(k, _ []byte) error {
+			if !bytes.HasPrefix(k, tierDirtyPrefix) {
+				s.index[string(k)] = s.lru.PushBack(string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			hot.Close()
+			cold.Close()
+			return nil, err
+		}
+	}
+	go s.loop(interval)
+	return s, nil
+}
+
+func dirtyKey(key []byte) []byte {
+	return append(append([]byte(nil), tierDirtyPrefix...), key...)
+}
+
+func (s *tieredStore) nextGen() []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], s.gen.Add(1))
+	return buf[:]
+}
+
+// touch records key as the most recently used hot-tier entry.
+func (s *tieredStore) touch(key []byte) {
+	if s.maxKeys == 0 {
+		return
+	}
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+	if el, ok := s.index[string(key)]; ok {
+		s.lru.MoveToFront(el)
+		return
+	}
+	s.index[string(key)] = s.lru.PushFront(string(key))
+}
+
+func (s *tieredStore) forget(key []byte) {
+	if s.maxKeys == 0 {
+		return
+	}
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+	if el, ok := s.index[string(key)]; ok {
+		s.lru.Remove(el)
+		delete(s.index, string(key))
+	}
+}
+
+func (s *tieredStore) Get(key []byte) ([]byte, error) {
+	value, err := s.hot.Get(key)
+	if err == nil {
+		s.touch(key)
+		return value, nil
+	}
+	if !isNotFound(err) {
+		return nil, err
+	}
+	// A marker without an entry is a delete the cold tier has not seen.
+	if _, err := s.hot.Get(dirtyKey(key)); err == nil {
+		return nil, badger.ErrKeyNotFound
+	} else if !isNotFound(err) {
+		return nil, err
+	}
+	value, err = s.cold.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	s.promote(key, value)
+	return value, nil
+}
+
+// promote caches a value read from the cold tier, unless a write to the key
+// landed in the hot tier meanwhile.
+func (s *tieredStore) promote(key, value []byte) {
+	txn, err := beginTxn(s.hot)
+	if err != nil {
+		return
+	}
+	defer txn.Discard()
+	if _, err := txn.Get(key); !isNotFound(err) {
+		return
+	}
+	if _, err := txn.Get(dirtyKey(key)); !isNotFound(err) {
+		return
+	}
+	if txn.Set(key, value) != nil || txn.Commit() != nil {
+		return
+	}
+	s.touch(key)
+}
+
+func (s *tieredStore) Set(key, value []byte) error {
+	return s.Apply([]operation{{op: opSet, key: key, value: value}})
+}
+
+func (s *tieredStore) Delete(key []byte) error {
+	return s.Apply([]operation{{op: opDelete, key: key}})
+}
+
+// Apply writes ops and their dirty markers to the hot tier in one batch.
+func (s *tieredStore) Apply(ops []operation) error {
+	batch := make([]operation, 0, 2*len(ops))
+	for _, op := range ops {
+		if op.op == opSetTTL {
+			return errors.New("TTL writes are not supported by the tiered backend")
+		}
+		batch = append(batch, op, operation{op: opSet, key: dirtyKey(op.key), value: s.nextGen()})
+	}
+	if err := s.hot.Apply(batch); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.op == opDelete {
+			s.forget(op.key)
+		} else {
+			s.touch(op.key)
+		}
+	}
+	return nil
+}
+
+func (s *tieredStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	start, end := prefixRange(prefix)
+	return s.IterateRange(start, end, fn)
+}
+
+type tierPending struct {
+	key, value []byte
+	deleted    bool
+}
+
+// IterateRange walks the cold tier with the pending writes laid over it.
+func (s *tieredStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	markerEnd := nextPrefix(tierDirtyPrefix)
+	if end != nil {
+		markerEnd = dirtyKey(end)
+	}
+	var pending []tierPending
+	err := s.hot.IterateRange(dirtyKey(start), markerEnd, func(mk, _ []byte) error {
+		key := append([]byte(nil), mk[len(tierDirtyPrefix):]...)
+		value, err := s.hot.Get(key)
+		switch {
+		case isNotFound(err):
+			pending = append(pending, tierPending{key: key, deleted: true})
+		case err != nil:
+			return err
+		default:
+			pending = append(pending, tierPending{key: key, value: value})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	emitBefore := func(limit []byte) error {
+		for ; i < len(pending) && (limit == nil || bytes.Compare(pending[i].key, limit) < 0); i++ {
+			if pending[i].deleted {
+				continue
+			}
+			if err := fn(pending[i].key, pending[i].value); err != nil {
+				i++
+				return err
+			}
+		}
+		return nil
+	}
+	err = s.cold.IterateRange(start, end, func(k, v []byte) error {
+		if err := emitBefore(k); err != nil {
+			return err
+		}
+		if i < len(pending) && bytes.Equal(pending[i].key, k) {
+			p := pending[i]
+			i++
+			if p.deleted {
+				return nil
+			}
+			return fn(k, p.value)
+		}
+		return fn(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	return emitBefore(nil)
+}
+
+func (s *tieredStore) loop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := s.flush(); err != nil {
+			logf(logWarn, "tiered", "flush to cold tier: %v", err)
+			continue
+		}
+		if err := s.evict(); err != nil {
+			logf(logWarn, "tiered", "evict: %v", err)
+		}
+	}
+}
+
+// flush copies every pending write to the cold tier.
+func (s *tieredStore) flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	for {
+		n, err := s.flushBatch()
+		if err != nil || n < s.batch {
+			return err
+		}
+	}
+}
+
+// flushBatch copies up to s.batch pending writes to the cold tier and
+// clears their markers, returning how many it found.
+func (s *tieredStore) flushBatch() (int, error) {
+	type marker struct{ key, gen []byte }
+	var markers []marker
+	err := s.hot.Iterate(tierDirtyPrefix, func(mk, gen []byte) error {
+		markers = append(markers, marker{
+			key: append([]byte(nil), mk[len(tierDirtyPrefix):]...),
+			gen: append([]byte(nil), gen...),
+		})
+		if len(markers) == s.batch {
+			return errStopIteration
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return 0, err
+	}
+	if len(markers) == 0 {
+		return 0, nil
+	}
+
+	ops := make([]operation, len(markers))
+	for i, m := range markers {
+		value, err := s.hot.Get(m.key)
+		switch {
+		case isNotFound(err):
+			ops[i] = operation{op: opDelete, key: m.key}
+		case err != nil:
+			return 0, err
+		default:
+			ops[i] = operation{op: opSet, key: m.key, value: value}
+		}
+	}
+	if err := s.cold.Apply(ops); err != nil {
+		return 0, err
+	}
+
+	// A marker rewritten since it was read belongs to a newer write, which
+	// the next flush copies.
+	for _, m := range markers {
+		err := retryConflicts(func() error {
+			txn, err := beginTxn(s.hot)
+			if err != nil {
+				return err
+			}
+			defer txn.Discard()
+			gen, err := txn.Get(dirtyKey(m.key))
+			if err != nil || !bytes.Equal(gen, m.gen) {
+				if isNotFound(err) {
+					err = nil
+				}
+				return err
+			}
+			if err := txn.Delete(dirtyKey(m.key)); err != nil {
+				return err
+			}
+			return txn.Commit()
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(markers), nil
+}
+
+// evict drops the least recently used hot-tier entries beyond maxKeys.
+// Entries with pending writes stay until they have been flushed.
+func (s *tieredStore) evict() error {
+	if s.maxKeys == 0 {
+		return nil
+	}
+	s.lruMu.Lock()
+	excess := s.lru.Len() - s.maxKeys
+	var victims []string
+	for el := s.lru.Back(); el != nil && len(victims) < excess; el = el.Prev() {
+		victims = append(victims, el.Value.(string))
+	}
+	s.lruMu.Unlock()
+
+	for _, key := range victims {
+		evicted := false
+		err := retryConflicts(func() error {
+			txn, err := beginTxn(s.hot)
+			if err != nil {
+				return err
+			}
+			defer txn.Discard()
+			if _, err := txn.Get(dirtyKey([]byte(key))); !isNotFound(err) {
+				return err
+			}
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+			if err := txn.Commit(); err != nil {
+				return err
+			}
+			evicted = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if evicted {
+			s.forget([]byte(key))
+		}
+	}
+	return nil
+}
+
+// Sync copies every pending write to the cold tier and syncs both tiers.
+func (s *tieredStore) Sync() error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if err := s.cold.Sync(); err != nil {
+		return err
+	}
+	return s.hot.Sync()
+}
+
+// Close stops the background flusher, flushes what is pending and closes
+// both tiers. Writes that cannot be flushed stay marked in the hot tier and
+// are copied after the next open.
+func (s *tieredStore) Close() error {
+	close(s.stop)
+	<-s.done
+	err := s.flush()
+	if cerr := s.cold.Close(); err == nil {
+		err = cerr
+	}
+	if herr := s.hot.Close(); err == nil {
+		err = herr
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// A series keeps one key per point under tsPrefix and the series' u32
+// length-prefixed name: the point's Unix millisecond timestamp, as a
+// big-endian u64 with the sign bit flipped so negative times sort first,
+// holding the value as a little-endian f64.
+var tsPrefix = []byte("\xffts/")
+
+func tsBase(series []byte) []byte {
+	return appendLenPrefixed(append([]byte(nil), tsPrefix...), series)
+}
+
+func tsKey(base []byte, ts int64) []byte {
+	return binary.BigEndian.AppendUint64(append([]byte(nil), base...), uint64(ts)^1<<63)
+}
+
+// tsWindow summarises the points of one downsampling window.
+type tsWindow struct {
+	start    int64
+	count    uint64
+	sum      float64
+	min, max float64
+}
+
+func (w *tsWindow) add(v float64) {
+	if w.count == 0 || v < w.min {
+		w.min = v
+	}
+	if w.count == 0 || v > w.max {
+		w.max = v
+	}
+	w.count++
+	w.sum += v
+}
+
+// windowStart aligns ts down to a multiple of window.
+func windowStart(ts, window int64) int64 {
+	start := ts - ts%window
+	if ts%window < 0 {
+		start -= window
+	}
+	return start
+}
+
+// tsRange calls fn with the windows of width window that the points in
+// [from, to) fall in, in time order. A non-positive window gives each point
+// its own window.
+func tsRange(store kvStore, series []byte, from, to, window int64, fn func(tsWindow) error) error {
+	if from >= to {
+		return nil
+	}
+	base := tsBase(series)
+	var cur tsWindow
+	err := store.IterateRange(tsKey(base, from), tsKey(base, to), func(k, v []byte) error {
+		if len(k) != len(base)+8 || len(v) != 8 {
+			return errors.New("malformed time-series point")
+		}
+		ts := int64(binary.BigEndian.Uint64(k[len(base):]) ^ 1<<63)
+		start := ts
+		if window > 0 {
+			start = windowStart(ts, window)
+		}
+		if cur.count > 0 && start != cur.start {
+			if err := fn(cur); err != nil {
+				return err
+			}
+			cur = tsWindow{}
+		}
+		cur.start = start
+		cur.add(math.Float64frombits(binary.LittleEndian.Uint64(v)))
+		return nil
+	})
+	if err != nil || cur.count == 0 {
+		return err
+	}
+	return fn(cur)
+}
+
+// TSAppend records value at timestamp (Unix milliseconds) in series,
+// replacing any point already at that time.
+//
+//export TSAppend
+func TSAppend(handle C.uintptr_t, series *C.char, timestamp C.int64_t, value C.double) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "ts_append", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	key := tsKey(tsBase([]byte(C.GoString(series))), int64(timestamp))
+	raw := binary.LittleEndian.AppendUint64(nil, math.Float64bits(float64(value)))
+	return setHandleError(uintptr(handle), store.Set(key, raw))
+}
+
+// TSRange aggregates the points of series in [from, to) into windows of
+// downsampleMs milliseconds, aligned to the Unix epoch, inside the library.
+// Each non-empty window is a 40-byte little-endian record: i64 window start,
+// u64 count, then f64 sum, min and max. A non-positive downsampleMs returns
+// one record per point. Release the result with FreeBuffer.
+//
+//export TSRange
+func TSRange(handle C.uintptr_t, series *C.char, from C.int64_t, to C.int64_t, downsampleMs C.int64_t, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "ts_range", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	err = tsRange(store, []byte(C.GoString(series)), int64(from), int64(to), int64(downsampleMs), func(w tsWindow) error {
+		buffer = binary.LittleEndian.AppendUint64(buffer, uint64(w.start))
+		buffer = binary.LittleEndian.AppendUint64(buffer, w.count)
+		buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(w.sum))
+		buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(w.min))
+		buffer = binary.LittleEndian.AppendUint64(buffer, math.Float64bits(w.max))
+		return nil
+	})
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
@@ -0,0 +1,469 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// trashPrefix holds entries removed by Delete in soft-delete mode, under
+// trashPrefix+key. A trashed value is a u64 big-endian deletion time in Unix
+// milliseconds followed by the value as it was.
+var trashPrefix = []byte("\xfftrash/")
+
+// maxTrashSweepInterval caps how long expired trash can outlive its
+// retention.
+const maxTrashSweepInterval = time.Hour
+
+var (
+	errNoTrash    = errors.New("the store was not opened with soft_delete")
+	errNotInTrash = errors.New("key is not in the trash")
+	errKeyExists  = errors.New("key exists; delete it before undeleting")
+)
+
+// softDeleteConfig turns Delete into a move to the trash.
+type softDeleteConfig struct {
+	// Retention is how long trashed entries are kept before they are purged
+	// for good, as a Go duration string. Empty keeps them until Undelete.
+	Retention string `json:"retention,omitempty"`
+}
+
+func trashKey(key []byte) []byte {
+	return append(append([]byte(nil), trashPrefix...), key...)
+}
+
+func trashValue(at time.Time, value []byte) []byte {
+	buf := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(value)), uint64(at.UnixMilli()))
+	return append(buf, value...)
+}
+
+func parseTrashValue(raw []byte) (time.Time, []byte, error) {
+	if len(raw) < 8 {
+		return time.Time{}, nil, errors.New("malformed trash entry")
+	}
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(raw))), raw[8:], nil
+}
+
+// trashStore moves the entries deleted through it under trashPrefix, in the
+// same batch as the delete. Writes are serialised so the value moved is the
+// one the delete removed.
+type trashStore struct {
+	inner     kvStore
+	mu        sync.Mutex
+	retention time.Duration
+	// stop ends the background purge; done closes once it exits.
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newTrashStore(store kvStore, cfg *softDeleteConfig) (*trashStore, error) {
+	s := &trashStore{inner: store}
+	if cfg.Retention != "" {
+		var err error
+		if s.retention, err = time.ParseDuration(cfg.Retention); err != nil {
+			return nil, fmt.Errorf("invalid soft_delete retention: %w", err)
+		}
+		if s.retention <= 0 {
+			return nil, errors.New("soft_delete retention must be positive")
+		}
+		s.startPurge(min(s.retention, maxTrashSweepInterval))
+	}
+	return s, nil
+}
+
+func (s *trashStore) startPurge(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if _, err := s.purge(time.Now().Add(-s.retention)); err != nil {
+					logf(logWarn, "trash", "purge failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// purge removes the trashed entries deleted before cutoff and returns how
+// many it removed.
+func (s *trashStore) purge(cutoff time.Time) (int, error) {
+	start, end := prefixRange(trashPrefix)
+	return deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		err := s.inner.IterateRange(from, end, func(k, v []byte) error {
+			if len(keys) >= deleteBatchSize {
+				return errStopIteration
+			}
+			if at, _, err := parseTrashValue(v); err != nil || at.Before(cutoff) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		return keys, nil
+	}, func(keys [][]byte) error {
+		ops := make([]operation, len(keys))
+		for i, k := range keys {
+			ops[i] = operation{op: opDelete, key: k}
+		}
+		return s.inner.Apply(ops)
+	})
+}
+
+// trashed prefixes each delete in ops with a write of the value it removes
+// to the trash. Deletes of missing keys and of reserved keys, the trash and
+// the library's own records, pass through. The caller holds s.mu.
+func (s *trashStore) trashed(ops []operation, get func(key []byte) ([]byte, error)) ([]operation, error) {
+	batch := make([]operation, 0, len(ops))
+	now := time.Now()
+	for _, op := range ops {
+		if op.op == opDelete && !reservedKey(op.key) {
+			value, err := get(op.key)
+			switch {
+			case err == nil:
+				batch = append(batch, operation{op: opSet, key: trashKey(op.key), value: trashValue(now, value)})
+			case !isNotFound(err):
+				return nil, err
+			}
+		}
+		batch = append(batch, op)
+	}
+	return batch, nil
+}
+
+func (s *trashStore) apply(ops []operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, err := s.trashed(ops, s.inner.Get)
+	if err != nil {
+		return err
+	}
+	return s.inner.Apply(batch)
+}
+
+// undelete moves key back out of the trash, failing if it has been written
+// again since it was deleted, and returns the restored value.
+func (s *trashStore) undelete(key []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw, err := s.inner.Get(trashKey(key))
+	if isNotFound(err) {
+		return nil, errNotInTrash
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, value, err := parseTrashValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := hasKey(s.inner, key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errKeyExists
+	}
+	err = s.inner.Apply([]operation{
+		{op: opSet, key: key, value: value},
+		{op: opDelete, key: trashKey(key)},
+	})
+	return value, err
+}
+
+// scan appends the trashed entries whose keys start with prefix to buf,
+// each framed as a u64 little-endian deletion time in Unix milliseconds
+// followed by the entry in Scan's framing.
+func (s *trashStore) scan(buf []byte, prefix []byte) ([]byte, error) {
+	start, end := prefixRange(trashKey(prefix))
+	err := s.inner.IterateRange(start, end, func(k, v []byte) error {
+		at, value, err := parseTrashValue(v)
+		if err != nil {
+			return fmt.Errorf("trash entry %q: %w", k[len(trashPrefix):], err)
+		}
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(at.UnixMilli()))
+		buf = appendEntry(buf, k[len(trashPrefix):], value)
+		return nil
+	})
+	return buf, err
+}
+
+func (s *trashStore) unwrap() kvStore { return s.inner }
+
+func (s *trashStore) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+	}
+	return s.inner.Close()
+}
+
+func (s *trashStore) Set(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inner.Set(key, value)
+}
+
+func (s *trashStore) Get(key []byte) ([]byte, error) { return s.inner.Get(key) }
+
+func (s *trashStore) Has(key []byte) (bool, error) { return hasKey(s.inner, key) }
+
+func (s *trashStore) Delete(key []byte) error {
+	return s.apply([]operation{{op: opDelete, key: key}})
+}
+
+func (s *trashStore) Iterate(prefix []byte, fn func(k, v []byte) error) error {
+	return s.inner.Iterate(prefix, fn)
+}
+
+func (s *trashStore) IterateRange(start, end []byte, fn func(k, v []byte) error) error {
+	return s.inner.IterateRange(start, end, fn)
+}
+
+func (s *trashStore) IterateReverse(start, end []byte, fn func(k, v []byte) error) error {
+	return iterateReverse(s.inner, start, end, fn)
+}
+
+func (s *trashStore) Count(start, end []byte) (int, error) {
+	return countKeys(s.inner, start, end)
+}
+
+func (s *trashStore) Sync() error { return s.inner.Sync() }
+
+func (s *trashStore) Apply(ops []operation) error { return s.apply(ops) }
+
+func (s *trashStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return setWithTTL(s.inner, key, value, ttl)
+}
+
+func (s *trashStore) KeyTTL(key []byte) (time.Duration, error) { return keyTTL(s.inner, key) }
+
+func (s *trashStore) ApplyDurable(ops []operation, level int) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, err := s.trashed(ops, s.inner.Get)
+	if err != nil {
+		return 0, err
+	}
+	return applyDurable(s.inner, batch, level)
+}
+
+func (s *trashStore) AwaitDurable(seq uint64) error { return awaitDurable(s.inner, seq) }
+
+func (s *trashStore) SetWithMeta(key, value []byte, meta byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return setWithMeta(s.inner, key, value, meta)
+}
+
+func (s *trashStore) GetWithMeta(key []byte) ([]byte, byte, error) {
+	return getWithMeta(s.inner, key)
+}
+
+// DeleteRange trashes each deleted user key in the batch that deletes it;
+// reserved keys are deleted without being trashed. The trash itself is
+// skipped, so a range covering it keeps what it moves there.
+func (s *trashStore) DeleteRange(start, end []byte) (int, error) {
+	return deleteInBatches(start, func(from []byte) ([][]byte, error) {
+		var keys [][]byte
+		err := s.inner.IterateRange(from, end, func(k, _ []byte) error {
+			if len(keys) >= deleteBatchSize {
+				return errStopIteration
+			}
+			if !bytes.HasPrefix(k, trashPrefix) {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopIteration) {
+			return nil, err
+		}
+		return keys, nil
+	}, func(keys [][]byte) error {
+		ops := make([]operation, len(keys))
+		for i, k := range keys {
+			ops[i] = operation{op: opDelete, key: k}
+		}
+		return s.apply(ops)
+	})
+}
+
+func (s *trashStore) CurrentVersion() (uint64, error) {
+	return versionsBelow{s.inner}.CurrentVersion()
+}
+
+func (s *trashStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	return versionsBelow{s.inner}.GetAt(key, version)
+}
+
+func (s *trashStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return versionsBelow{s.inner}.IterateAt(prefix, version, fn)
+}
+
+func (s *trashStore) Versions(key []byte) ([]keyVersion, error) {
+	return versionsBelow{s.inner}.Versions(key)
+}
+
+func (s *trashStore) Begin() (kvTxn, error) {
+	txn, err := beginTxn(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return &trashTxn{txn: txn, store: s}, nil
+}
+
+// DropAll empties the trash along with everything else.
+func (s *trashStore) DropAll() error { return dropAll(s.inner) }
+
+func (s *trashStore) Compact() error { return compactStore(s.inner) }
+
+func (s *trashStore) Snapshot() (kvStore, error) { return openSnapshot(s.inner) }
+
+func (s *trashStore) Stats() (storeStats, error) { return collectStats(s.inner) }
+
+// A dump includes the trash. Restoring one writes around it, so keys the
+// restore replaces are not trashed.
+func (s *trashStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return backupStore(s.inner, w, since)
+}
+
+func (s *trashStore) Load(r io.Reader) error { return restoreStore(s.inner, r) }
+
+// trashTxn moves the values a transaction deletes to the trash within the
+// transaction.
+type trashTxn struct {
+	txn   kvTxn
+	store *trashStore
+}
+
+func (t *trashTxn) Get(key []byte) ([]byte, error) { return t.txn.Get(key) }
+
+func (t *trashTxn) Set(key, value []byte) error { return t.txn.Set(key, value) }
+
+func (t *trashTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return txnSetWithTTL(t.txn, key, value, ttl)
+}
+
+func (t *trashTxn) Delete(key []byte) error {
+	ops, err := t.store.trashed([]operation{{op: opDelete, key: key}}, t.txn.Get)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.op == opDelete {
+			err = t.txn.Delete(op.key)
+		} else {
+			err = t.txn.Set(op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *trashTxn) Commit() error { return t.txn.Commit() }
+
+func (t *trashTxn) Discard() { t.txn.Discard() }
+
+// trashOf finds the trash layered into store by OpenWithOptions.
+func trashOf(store kvStore) (*trashStore, bool) {
+	return layerOf[*trashStore](store)
+}
+
+func trashFor(handle C.uintptr_t) (*trashStore, error) {
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return nil, err
+	}
+	trash, ok := trashOf(store)
+	if !ok {
+		return nil, errNoTrash
+	}
+	return trash, nil
+}
+
+// Undelete restores a key deleted in soft-delete mode to the value it had
+// when it was deleted, without its TTL, and removes it from the trash. It
+// fails if the key has been written again since, or is not in the trash.
+//
+//export Undelete
+func Undelete(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	trash, err := trashFor(handle)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if err := admitWrites(uintptr(handle), []operation{{op: opSet, key: gotKey}}); err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	value, err := trash.undelete(gotKey)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	// The restore goes around the handle's notifyStore, so it is reported here.
+	notifyWriteCallbacks(uintptr(handle), []operation{{op: opSet, key: gotKey, value: value}})
+	return setHandleError(uintptr(handle), nil)
+}
+
+// TrashScan returns the trashed entries whose keys start with prefix, in key
+// order, each framed as a u64 deletion time in Unix milliseconds followed by
+// the key and value in Scan's framing. An empty trash returns NULL with a
+// zero status.
+//
+//export TrashScan
+func TrashScan(handle C.uintptr_t, prefix *C.char, prefixLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	*resultLen = 0
+	trash, err := trashFor(handle)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	buffer, err = trash.scan(buffer, pref)
+	if err != nil || len(buffer) == 0 {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
@@ -0,0 +1,296 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+	"unsafe"
+
+	"github.com/dgraph-io/badger/v4"
+	slatedb "slatedb.io/slatedb-go"
+)
+
+// Backends without native TTLs store expiring values inside an envelope:
+// expiryMagic, a big-endian u64 expiry in Unix nanoseconds, then the value.
+// Values written without a TTL are stored as-is, so existing data is read
+// unchanged, unless they start with expiryMagic themselves: those are
+// escaped in an envelope with expiry 0, which never expires.
+var expiryMagic = []byte("\xffskyttl")
+
+const (
+	expiryHeaderLen      = 7 + 8
+	defaultSweepInterval = time.Minute
+	sweepBatchSize       = 1000
+
+	// maxTTL keeps a TTL from overflowing time.Duration, and an expiry from
+	// overflowing Unix nanoseconds.
+	maxTTL = 100 * 365 * 24 * time.Hour
+)
+
+var errTTLTooLong = errors.New("TTL exceeds the 100-year maximum")
+
+// ttlFromSeconds converts a TTL in seconds from the host, rejecting ones
+// over maxTTL.
+func ttlFromSeconds(secs uint64) (time.Duration, error) {
+	if secs > uint64(maxTTL/time.Second) {
+		return 0, errTTLTooLong
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+// ttlSetter is implemented by backends that can store entries with a
+// time-to-live.
+type ttlSetter interface {
+	SetWithTTL(key, value []byte, ttl time.Duration) error
+}
+
+func setWithTTL(store kvStore, key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return store.Set(key, value)
+	}
+	if ttl > maxTTL {
+		return errTTLTooLong
+	}
+	ts, ok := store.(ttlSetter)
+	if !ok {
+		return errors.New("TTLs are not supported by this backend")
+	}
+	return ts.SetWithTTL(key, value, ttl)
+}
+
+// ttlReader is implemented by stores that can report how long a key has
+// left to live.
+type ttlReader interface {
+	KeyTTL(key []byte) (time.Duration, error)
+}
+
+// keyTTL returns the time key has left to live, or 0 when it does not
+// expire. A missing key returns badger.ErrKeyNotFound.
+func keyTTL(store kvStore, key []byte) (time.Duration, error) {
+	if tr, ok := store.(ttlReader); ok {
+		return tr.KeyTTL(key)
+	}
+	_, err := store.Get(key)
+	return 0, err
+}
+
+func wrapExpiry(value []byte, ttl time.Duration) []byte {
+	return envelope(value, time.Now().Add(ttl).UnixNano())
+}
+
+// plainValue frames a value written without a TTL, escaping one that would
+// otherwise read back as an envelope.
+func plainValue(value []byte) []byte {
+	if !bytes.HasPrefix(value, expiryMagic) {
+		return value
+	}
+	return envelope(value, 0)
+}
+
+func envelope(value []byte, expiry int64) []byte {
+	buf := make([]byte, expiryHeaderLen, expiryHeaderLen+len(value))
+	copy(buf, expiryMagic)
+	binary.BigEndian.PutUint64(buf[len(expiryMagic):], uint64(expiry))
+	return append(buf, value...)
+}
+
+func hasEnvelope(raw []byte) bool {
+	return len(raw) >= expiryHeaderLen && bytes.HasPrefix(raw, expiryMagic)
+}
+
+// envelopeExpiry returns raw's expiry in Unix nanoseconds, or 0 when it does
+// not expire.
+func envelopeExpiry(raw []byte) int64 {
+	if !hasEnvelope(raw) {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(raw[len(expiryMagic):expiryHeaderLen]))
+}
+
+// unwrapExpiry strips an expiry envelope from raw, reporting false when the
+// entry has already expired. Values without an envelope are returned as-is.
+func unwrapExpiry(raw []byte, now time.Time) ([]byte, bool) {
+	if !hasEnvelope(raw) {
+		return raw, true
+	}
+	if expiry := envelopeExpiry(raw); expiry != 0 && now.UnixNano() >= expiry {
+		return nil, false
+	}
+	return raw[expiryHeaderLen:], true
+}
+
+func (s *badgerStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(key, value).WithTTL(ttl))
+	})
+}
+
+// KeyTTL is on badgerReader so snapshots report the TTLs they pinned.
+func (r *badgerReader) KeyTTL(key []byte) (time.Duration, error) {
+	var ttl time.Duration
+	err := r.view(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		if exp := item.ExpiresAt(); exp > 0 {
+			ttl = max(time.Until(time.Unix(int64(exp), 0)), time.Nanosecond)
+		}
+		return nil
+	})
+	return ttl, err
+}
+
+func (s *slateStore) KeyTTL(key []byte) (time.Duration, error) {
+	raw, err := s.db.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if _, live := unwrapExpiry(raw, now); !live {
+		return 0, badger.ErrKeyNotFound
+	}
+	expiry := envelopeExpiry(raw)
+	if expiry == 0 {
+		return 0, nil
+	}
+	return time.Duration(expiry - now.UnixNano()), nil
+}
+
+func (s *slateStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	if err := s.preserve(key); err != nil {
+		return err
+	}
+	if err := s.db.PutWithOptions(key, wrapExpiry(value, ttl), nil, s.writeOpts); err != nil {
+		return err
+	}
+	s.startSweeper()
+	s.watchers.notify([]operation{{op: opSet, key: key, value: value}})
+	return nil
+}
+
+// startSweeper starts the expired-entry sweeper unless it is running or
+// disabled. It waits for the first TTL write, so a store that never uses
+// TTLs pays for no full-keyspace scans; entries left expired by an earlier
+// session are purged once it runs.
+func (s *slateStore) startSweeper() {
+	s.sweepOnce.Do(func() {
+		if s.sweepInterval <= 0 {
+			return
+		}
+		s.stop = make(chan struct{})
+		s.sweepDone = make(chan struct{})
+		go func() {
+			defer close(s.sweepDone)
+			ticker := time.NewTicker(s.sweepInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.stop:
+					return
+				case <-ticker.C:
+					// Errors are retried on the next tick; reads already
+					// hide expired entries.
+					_ = s.sweepExpired()
+				}
+			}
+		}()
+	})
+}
+
+// sweepExpired deletes entries whose expiry has passed, in bounded batches.
+func (s *slateStore) sweepExpired() error {
+	now := time.Now()
+	var expired [][]byte
+	err := s.scan(nil, nil, func(k, raw []byte) error {
+		if _, live := unwrapExpiry(raw, now); !live {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for len(expired) > 0 {
+		n := min(len(expired), sweepBatchSize)
+		if err := s.deleteKeys(expired[:n]); err != nil {
+			return err
+		}
+		expired = expired[n:]
+	}
+	return nil
+}
+
+// deleteKeys removes keys that are still expired, re-reading each one so a
+// value rewritten since the sweep started survives.
+func (s *slateStore) deleteKeys(keys [][]byte) error {
+	s.commitMu.RLock()
+	defer s.commitMu.RUnlock()
+	batch, err := slatedb.NewWriteBatch()
+	if err != nil {
+		return err
+	}
+	defer batch.Close()
+	now := time.Now()
+	var deleted []operation
+	for _, key := range keys {
+		raw, err := s.db.Get(key)
+		if err != nil {
+			continue
+		}
+		if _, live := unwrapExpiry(raw, now); live {
+			continue
+		}
+		if err := s.preserve(key); err != nil {
+			return err
+		}
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+		deleted = append(deleted, operation{op: opDelete, key: key})
+	}
+	if err := s.db.Write(batch); err != nil {
+		return err
+	}
+	s.watchers.notify(deleted)
+	return nil
+}
+
+// SetWithTTL stores a value that expires after ttlSeconds. A non-positive TTL
+// behaves like Set; one over 100 years is rejected.
+//
+//export SetWithTTL
+func SetWithTTL(handle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int, ttlSeconds C.int64_t) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "set_with_ttl", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	var ttl time.Duration
+	if ttlSeconds > 0 {
+		if ttl, err = ttlFromSeconds(uint64(ttlSeconds)); err != nil {
+			return setHandleError(uintptr(handle), err)
+		}
+	}
+	gotValue := C.GoBytes(unsafe.Pointer(value), valueLen)
+	err = setWithTTL(store, gotKey, gotValue, ttl)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	return setHandleError(uintptr(handle), nil)
+}
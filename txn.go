@@ -0,0 +1,379 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// kvTxn is an interactive read-your-writes transaction against one store.
+type kvTxn interface {
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	Commit() error
+	Discard()
+}
+
+// txnStore is implemented by backends that support interactive transactions.
+type txnStore interface {
+	Begin() (kvTxn, error)
+}
+
+// ttlTxn is implemented by transactions that can write entries with a
+// time-to-live.
+type ttlTxn interface {
+	SetWithTTL(key, value []byte, ttl time.Duration) error
+}
+
+var errConflict = errors.New("transaction conflict")
+
+// txnSetWithTTL is setWithTTL for a write inside txn.
+func txnSetWithTTL(txn kvTxn, key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return txn.Set(key, value)
+	}
+	tt, ok := txn.(ttlTxn)
+	if !ok {
+		return errors.New("TTLs are not supported by this backend")
+	}
+	return tt.SetWithTTL(key, value, ttl)
+}
+
+func beginTxn(store kvStore) (kvTxn, error) {
+	ts, ok := store.(txnStore)
+	if !ok {
+		return nil, errors.New("transactions are not supported by this backend")
+	}
+	return ts.Begin()
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+func (s *badgerStore) Begin() (kvTxn, error) {
+	return &badgerTxn{txn: s.db.NewTransaction(true)}, nil
+}
+
+func (t *badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func (t *badgerTxn) Set(key, value []byte) error { return t.txn.Set(key, value) }
+
+func (t *badgerTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	return t.txn.SetEntry(badger.NewEntry(key, value).WithTTL(ttl))
+}
+
+func (t *badgerTxn) Delete(key []byte) error { return t.txn.Delete(key) }
+
+func (t *badgerTxn) Commit() error {
+	err := t.txn.Commit()
+	if errors.Is(err, badger.ErrConflict) {
+		return errConflict
+	}
+	return err
+}
+
+func (t *badgerTxn) Discard() { t.txn.Discard() }
+
+// emulatedTxn layers optimistic transactions over a store that only offers
+// atomic batches. Reads are recorded in a read set and writes are buffered;
+// Commit re-reads the read set under the store's commit lock and applies the
+// buffered writes as one batch only if nothing changed underneath. Backend
+// writes hold the same lock shared, so none can land between the check and
+// the batch; apply is the backend's unlocked batch write.
+type emulatedTxn struct {
+	store    kvStore
+	commitMu *sync.RWMutex
+	apply    func([]operation) error
+	reads    map[string]readRecord
+	writes   map[string]int
+	ops      []operation
+}
+
+type readRecord struct {
+	found bool
+	value []byte
+}
+
+func newEmulatedTxn(store kvStore, commitMu *sync.RWMutex, apply func([]operation) error) *emulatedTxn {
+	return &emulatedTxn{
+		store:    store,
+		commitMu: commitMu,
+		apply:    apply,
+		reads:    make(map[string]readRecord),
+		writes:   make(map[string]int),
+	}
+}
+
+func (s *slateStore) Begin() (kvTxn, error) {
+	return newEmulatedTxn(s, &s.commitMu, func(ops []operation) error {
+		_, err := s.applyWith(ops, nil)
+		return err
+	}), nil
+}
+
+func (t *emulatedTxn) Get(key []byte) ([]byte, error) {
+	if idx, ok := t.writes[string(key)]; ok {
+		op := t.ops[idx]
+		if op.op == opDelete {
+			return nil, badger.ErrKeyNotFound
+		}
+		return append([]byte(nil), op.value...), nil
+	}
+
+	value, err := t.store.Get(key)
+	found := true
+	if isNotFound(err) {
+		found = false
+	} else if err != nil {
+		return nil, err
+	}
+	if _, seen := t.reads[string(key)]; !seen {
+		t.reads[string(key)] = readRecord{found: found, value: value}
+	}
+	if !found {
+		return nil, badger.ErrKeyNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (t *emulatedTxn) Set(key, value []byte) error {
+	t.buffer(operation{op: opSet, key: key, value: value})
+	return nil
+}
+
+// SetWithTTL buffers an opSetTTL, which the backend's batch write rejects
+// if it cannot store TTLs.
+func (t *emulatedTxn) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	t.buffer(operation{op: opSetTTL, key: key, value: value, ttl: ttl})
+	return nil
+}
+
+func (t *emulatedTxn) Delete(key []byte) error {
+	t.buffer(operation{op: opDelete, key: key})
+	return nil
+}
+
+func (t *emulatedTxn) buffer(op operation) {
+	if idx, ok := t.writes[string(op.key)]; ok {
+		t.ops[idx] = op
+		return
+	}
+	t.writes[string(op.key)] = len(t.ops)
+	t.ops = append(t.ops, op)
+}
+
+func (t *emulatedTxn) Commit() error {
+	t.commitMu.Lock()
+	defer t.commitMu.Unlock()
+
+	for key, read := range t.reads {
+		current, err := t.store.Get([]byte(key))
+		found := true
+		if isNotFound(err) {
+			found = false
+		} else if err != nil {
+			return err
+		}
+		if found != read.found || !bytes.Equal(current, read.value) {
+			return errConflict
+		}
+	}
+
+	if len(t.ops) == 0 {
+		return nil
+	}
+	return t.apply(t.ops)
+}
+
+func (t *emulatedTxn) Discard() {
+	t.reads = nil
+	t.writes = nil
+	t.ops = nil
+}
+
+// txnEntry serialises host calls on a transaction handle; backend
+// transactions are not safe for concurrent use.
+type txnEntry struct {
+	mu      sync.Mutex
+	storeID uintptr
+	txn     kvTxn
+}
+
+var (
+	txnMu     sync.Mutex
+	txns              = make(map[uintptr]*txnEntry)
+	nextTxnID uintptr = 1
+)
+
+func storeTxn(entry *txnEntry) uintptr {
+	txnMu.Lock()
+	defer txnMu.Unlock()
+	id := nextTxnID
+	nextTxnID++
+	txns[id] = entry
+	return id
+}
+
+func getTxn(id uintptr) (*txnEntry, error) {
+	txnMu.Lock()
+	defer txnMu.Unlock()
+	entry, ok := txns[id]
+	if !ok {
+		return nil, unknownHandleError("transaction")
+	}
+	return entry, nil
+}
+
+func deleteTxn(id uintptr) *txnEntry {
+	txnMu.Lock()
+	defer txnMu.Unlock()
+	entry := txns[id]
+	delete(txns, id)
+	return entry
+}
+
+// discardTxnsFor rolls back every transaction still open on a store handle.
+func discardTxnsFor(storeID uintptr) {
+	txnMu.Lock()
+	var open []*txnEntry
+	for id, entry := range txns {
+		if entry.storeID == storeID {
+			open = append(open, entry)
+			delete(txns, id)
+		}
+	}
+	txnMu.Unlock()
+
+	for _, entry := range open {
+		entry.mu.Lock()
+		entry.txn.Discard()
+		entry.mu.Unlock()
+	}
+}
+
+//export BeginTxn
+func BeginTxn(handle C.uintptr_t) (ret C.uintptr_t) {
+	defer recoverExport(uintptr(handle), &ret, 0)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	txn, err := beginTxn(store)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.uintptr_t(storeTxn(&txnEntry{storeID: uintptr(handle), txn: txn}))
+}
+
+//export TxnSet
+func TxnSet(txnHandle C.uintptr_t, key *C.char, keyLen C.int, value *C.char, valueLen C.int) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	entry, err := getTxn(uintptr(txnHandle))
+	if err != nil {
+		return setError(err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(entry.storeID, err)
+	}
+	gotValue := C.GoBytes(unsafe.Pointer(value), valueLen)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	return setHandleError(entry.storeID, entry.txn.Set(gotKey, gotValue))
+}
+
+//export TxnGet
+func TxnGet(txnHandle C.uintptr_t, key *C.char, keyLen C.int, valueLen *C.int) (ret *C.char) {
+	defer recoverExport(0, &ret, nil)
+	entry, err := getTxn(uintptr(txnHandle))
+	if err != nil {
+		setError(err)
+		return nil
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		setHandleError(entry.storeID, err)
+		return nil
+	}
+
+	entry.mu.Lock()
+	data, err := entry.txn.Get(gotKey)
+	entry.mu.Unlock()
+	if err != nil {
+		setHandleError(entry.storeID, err)
+		return nil
+	}
+	buf, err := returnValue(data, valueLen)
+	setHandleError(entry.storeID, err)
+	return buf
+}
+
+//export TxnDelete
+func TxnDelete(txnHandle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	entry, err := getTxn(uintptr(txnHandle))
+	if err != nil {
+		return setError(err)
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(entry.storeID, err)
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	return setHandleError(entry.storeID, entry.txn.Delete(gotKey))
+}
+
+// TxnCommit commits and releases the transaction handle. The handle is
+// invalid afterwards even when the commit fails with a conflict.
+//
+//export TxnCommit
+func TxnCommit(txnHandle C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	entry := deleteTxn(uintptr(txnHandle))
+	if entry == nil {
+		return setError(unknownHandleError("transaction"))
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	defer entry.txn.Discard()
+	return setHandleError(entry.storeID, entry.txn.Commit())
+}
+
+//export TxnRollback
+func TxnRollback(txnHandle C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	entry := deleteTxn(uintptr(txnHandle))
+	if entry == nil {
+		return setError(unknownHandleError("transaction"))
+	}
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	entry.txn.Discard()
+	return setHandleError(entry.storeID, nil)
+}
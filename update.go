@@ -0,0 +1,132 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+typedef int (*skyshelve_update_cb)(void *user_data, const char *current, int current_len, int found, const char **next, int *next_len);
+
+static inline int skyshelve_call_update_cb(skyshelve_update_cb cb, void *user_data, const char *current, int current_len, int found, const char **next, int *next_len) {
+	return cb(user_data, current, current_len, found, next, next_len);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// Results an update callback returns to say what to do with the key.
+const (
+	updateWrite  = 0
+	updateKeep   = 1
+	updateDelete = 2
+)
+
+// updateDecision is what an update function decided for one attempt.
+type updateDecision struct {
+	action int
+	next   []byte
+}
+
+// updateWith runs fn over key's current value in a transaction and writes,
+// keeps or deletes the key as it decides, retrying the whole attempt on
+// conflicts. It reports whether the key was changed.
+func updateWith(store kvStore, key []byte, fn func(current []byte, found bool) (updateDecision, error)) (bool, error) {
+	var changed bool
+	err := retryConflicts(func() error {
+		changed = false
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+
+		current, err := txn.Get(key)
+		found := err == nil
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		d, err := fn(current, found)
+		if err != nil {
+			return err
+		}
+		switch d.action {
+		case updateWrite:
+			err = txn.Set(key, d.next)
+		case updateDelete:
+			if !found {
+				return nil
+			}
+			err = txn.Delete(key)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		changed = true
+		return txn.Commit()
+	})
+	return changed, err
+}
+
+// Update runs a host read-modify-write on key in one transaction:
+// fn(userData, current, currentLen, found, &next, &nextLen) sees the current
+// value (NULL with found 0 when the key is missing) and returns 0 to store
+// the nextLen bytes at next, 1 to leave the key as it is, 2 to delete it, or
+// anything else to abort the update with an error. next must stay valid
+// until fn is next called or Update returns. When another writer commits
+// first, fn is called again with the newer value, so it must not have side
+// effects. Returns 1 when the key was written or deleted, 0 when it was left
+// alone and a negative status code on error.
+//
+//export Update
+func Update(handle C.uintptr_t, key *C.char, keyLen C.int, fn C.skyshelve_update_cb, userData unsafe.Pointer) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "update", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	if fn == nil {
+		return setHandleError(uintptr(handle), errors.New("update callback must not be NULL"))
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+
+	changed, err := updateWith(store, gotKey, func(current []byte, found bool) (updateDecision, error) {
+		var (
+			next    *C.char
+			nextLen C.int
+			exists  C.int
+		)
+		if found {
+			exists = 1
+		}
+		action := C.skyshelve_call_update_cb(fn, userData, bytesPtr(current), C.int(len(current)), exists, &next, &nextLen)
+		switch action {
+		case updateWrite:
+			if nextLen < 0 || (next == nil && nextLen > 0) {
+				return updateDecision{}, fmt.Errorf("update callback returned an invalid value of length %d", int(nextLen))
+			}
+			return updateDecision{action: updateWrite, next: C.GoBytes(unsafe.Pointer(next), nextLen)}, nil
+		case updateKeep, updateDelete:
+			return updateDecision{action: int(action)}, nil
+		}
+		return updateDecision{}, fmt.Errorf("update callback aborted with %d", int(action))
+	})
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	setHandleError(uintptr(handle), nil)
+	if changed {
+		return 1
+	}
+	return 0
+}
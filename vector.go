@@ -0,0 +1,320 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// An embedding is stored under vectorPrefix and its key as little-endian
+// f32s. Searches run over an in-memory copy of a handle's embeddings, loaded
+// from the store the first time the handle uses them.
+var vectorPrefix = []byte("\xffvec/")
+
+func vectorKey(key []byte) []byte {
+	return append(append([]byte(nil), vectorPrefix...), key...)
+}
+
+func encodeVector(vec []float32) []byte {
+	buf := make([]byte, 0, 4*len(vec))
+	for _, f := range vec {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(raw []byte) ([]float32, error) {
+	if len(raw) == 0 || len(raw)%4 != 0 {
+		return nil, errors.New("malformed stored embedding")
+	}
+	vec := make([]float32, len(raw)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+	}
+	return vec, nil
+}
+
+// vectorNorm returns vec's Euclidean length, rejecting vectors that cannot
+// be compared by cosine similarity.
+func vectorNorm(vec []float32) (float64, error) {
+	var sum float64
+	for _, f := range vec {
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return 0, errors.New("embedding values must be finite")
+		}
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return 0, errors.New("embedding must not be all zeros")
+	}
+	return math.Sqrt(sum), nil
+}
+
+type storedVector struct {
+	vec  []float32
+	norm float64
+}
+
+// vectorIndex is a flat index of a handle's embeddings. Every embedding has
+// the dimension of the first one stored.
+type vectorIndex struct {
+	mu     sync.RWMutex
+	loaded bool
+	dim    int
+	vecs   map[string]storedVector
+}
+
+var (
+	vectorMu      sync.Mutex
+	vectorIndexes = make(map[uintptr]*vectorIndex)
+)
+
+func vectorIndexFor(id uintptr) *vectorIndex {
+	vectorMu.Lock()
+	defer vectorMu.Unlock()
+	vi, ok := vectorIndexes[id]
+	if !ok {
+		vi = &vectorIndex{vecs: make(map[string]storedVector)}
+		vectorIndexes[id] = vi
+	}
+	return vi
+}
+
+func forgetVectors(id uintptr) {
+	vectorMu.Lock()
+	defer vectorMu.Unlock()
+	delete(vectorIndexes, id)
+}
+
+// load reads the stored embeddings once. The caller holds vi.mu for writing.
+func (vi *vectorIndex) load(store kvStore) error {
+	if vi.loaded {
+		return nil
+	}
+	err := store.Iterate(vectorPrefix, func(k, v []byte) error {
+		vec, err := decodeVector(v)
+		if err != nil {
+			return err
+		}
+		norm, err := vectorNorm(vec)
+		if err != nil {
+			return err
+		}
+		if vi.dim == 0 {
+			vi.dim = len(vec)
+		} else if len(vec) != vi.dim {
+			return fmt.Errorf("stored embeddings mix dimensions %d and %d", vi.dim, len(vec))
+		}
+		vi.vecs[string(k[len(vectorPrefix):])] = storedVector{vec: vec, norm: norm}
+		return nil
+	})
+	if err != nil {
+		vi.dim = 0
+		vi.vecs = make(map[string]storedVector)
+		return err
+	}
+	vi.loaded = true
+	return nil
+}
+
+// ready loads the stored embeddings if this handle has not yet.
+func (vi *vectorIndex) ready(store kvStore) error {
+	vi.mu.RLock()
+	loaded := vi.loaded
+	vi.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+	return vi.load(store)
+}
+
+func (vi *vectorIndex) put(store kvStore, key []byte, vec []float32) error {
+	norm, err := vectorNorm(vec)
+	if err != nil {
+		return err
+	}
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+	if err := vi.load(store); err != nil {
+		return err
+	}
+	if vi.dim != 0 && len(vec) != vi.dim {
+		return fmt.Errorf("embedding has %d dimensions, the store uses %d", len(vec), vi.dim)
+	}
+	if err := store.Set(vectorKey(key), encodeVector(vec)); err != nil {
+		return err
+	}
+	vi.dim = len(vec)
+	vi.vecs[string(key)] = storedVector{vec: vec, norm: norm}
+	return nil
+}
+
+func (vi *vectorIndex) remove(store kvStore, key []byte) error {
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+	if err := vi.load(store); err != nil {
+		return err
+	}
+	if err := store.Delete(vectorKey(key)); err != nil && !isNotFound(err) {
+		return err
+	}
+	delete(vi.vecs, string(key))
+	if len(vi.vecs) == 0 {
+		vi.dim = 0
+	}
+	return nil
+}
+
+// vectorHit is a key near a query embedding and its cosine similarity.
+type vectorHit struct {
+	key        []byte
+	similarity float64
+}
+
+// search returns the k embeddings most similar to query by cosine
+// similarity, most similar first and ties in key order.
+func (vi *vectorIndex) search(store kvStore, query []float32, k int) ([]vectorHit, error) {
+	norm, err := vectorNorm(query)
+	if err != nil {
+		return nil, err
+	}
+	if err := vi.ready(store); err != nil {
+		return nil, err
+	}
+	vi.mu.RLock()
+	defer vi.mu.RUnlock()
+	if len(vi.vecs) == 0 {
+		return nil, nil
+	}
+	if len(query) != vi.dim {
+		return nil, fmt.Errorf("query has %d dimensions, the store uses %d", len(query), vi.dim)
+	}
+	hits := make([]vectorHit, 0, len(vi.vecs))
+	for key, sv := range vi.vecs {
+		var dot float64
+		for i, f := range sv.vec {
+			dot += float64(f) * float64(query[i])
+		}
+		hits = append(hits, vectorHit{key: []byte(key), similarity: dot / (sv.norm * norm)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].similarity != hits[j].similarity {
+			return hits[i].similarity > hits[j].similarity
+		}
+		return bytes.Compare(hits[i].key, hits[j].key) < 0
+	})
+	if k > 0 && len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+func goVector(embedding *C.float, dim C.int) ([]float32, error) {
+	if dim <= 0 || embedding == nil {
+		return nil, errors.New("embedding must have at least one dimension")
+	}
+	src := unsafe.Slice((*float32)(unsafe.Pointer(embedding)), int(dim))
+	return append([]float32(nil), src...), nil
+}
+
+// VectorPut stores the dim float32s at embedding as the embedding for key,
+// replacing any it had. Embeddings are kept apart from key's value, under
+// the reserved 0xff prefix, and must all have the same dimension and a
+// non-zero length.
+//
+//export VectorPut
+func VectorPut(handle C.uintptr_t, key *C.char, keyLen C.int, embedding *C.float, dim C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "vector_put", time.Now())
+	id := uintptr(handle)
+	store, err := getHandle(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	vec, err := goVector(embedding, dim)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	return setHandleError(id, vectorIndexFor(id).put(store, gotKey, vec))
+}
+
+// VectorDelete removes key's embedding. Removing a missing embedding is not
+// an error.
+//
+//export VectorDelete
+func VectorDelete(handle C.uintptr_t, key *C.char, keyLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	id := uintptr(handle)
+	store, err := getHandle(id)
+	if err != nil {
+		return setHandleError(id, err)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	return setHandleError(id, vectorIndexFor(id).remove(store, gotKey))
+}
+
+// VectorSearch returns the k keys whose embeddings are most similar to the
+// dim float32s at query by cosine similarity (all of them when k is not
+// positive), most similar first, using Scan's framing with the similarity as
+// a little-endian f64 value. The search is exact, over an in-memory copy of
+// the embeddings that is rebuilt from the store on the handle's first vector
+// call and kept current by VectorPut and VectorDelete. Release the result
+// with FreeBuffer.
+//
+//export VectorSearch
+func VectorSearch(handle C.uintptr_t, query *C.float, dim C.int, k C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "vector_search", time.Now())
+	*resultLen = 0
+	id := uintptr(handle)
+	store, err := getHandle(id)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	vec, err := goVector(query, dim)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	hits, err := vectorIndexFor(id).search(store, vec, int(k))
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	if len(hits) == 0 {
+		setHandleError(id, nil)
+		return nil
+	}
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	var score [8]byte
+	for _, h := range hits {
+		binary.LittleEndian.PutUint64(score[:], math.Float64bits(h.similarity))
+		buffer = appendEntry(buffer, h.key, score[:])
+	}
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(id, err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(id, nil)
+	return mem
+}
@@ -0,0 +1,168 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"runtime"
+	"runtime/debug"
+)
+
+// libraryVersion tracks the package version in pyproject.toml. Release
+// builds can stamp it with -ldflags "-X main.libraryVersion=...".
+var libraryVersion = "0.2.1"
+
+// versionInfo is the document returned by Version.
+type versionInfo struct {
+	Version   string `json:"version"`
+	Go        string `json:"go"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Badger    string `json:"badger,omitempty"`
+	SlateDB   string `json:"slatedb,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+func buildVersion() versionInfo {
+	info := versionInfo{
+		Version: libraryVersion,
+		Go:      runtime.Version(),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, dep := range bi.Deps {
+		version := dep.Version
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			version = dep.Replace.Version
+		}
+		switch dep.Path {
+		case "github.com/dgraph-io/badger/v4":
+			info.Badger = version
+		case "slatedb.io/slatedb-go":
+			info.SlateDB = version
+		}
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// libraryFeatures are available on every backend.
+var libraryFeatures = []string{
+	"async", "audit_log", "blobs", "cache", "cdc", "cdc_kafka",
+	"cdc_nats", "change_log", "checksums", "clone", "compression", "diff",
+	"dump_load", "durability", "encryption", "erase", "execute", "geo",
+	"group_commit", "grpc_server", "http_server", "import_dbm",
+	"import_leveldb", "import_rdb", "indexes", "max_size",
+	"memcache_server", "metrics", "panic_recovery", "rate_limit",
+	"replication", "resp_server", "soft_delete", "text_search",
+	"timeseries", "vectors",
+}
+
+// backendPrototypes lets Capabilities check a backend's optional interfaces
+// without opening it. Schemes missing here report no optional features.
+var backendPrototypes = map[string]kvStore{
+	"badger":       (*badgerStore)(nil),
+	"slatedb":      (*slateStore)(nil),
+	"slatedb+s3":   (*slateStore)(nil),
+	"slatedb+file": (*slateStore)(nil),
+	"bolt":         (*boltStore)(nil),
+	"sqlite":       (*sqliteStore)(nil),
+	"lmdb":         (*lmdbStore)(nil),
+	"tiered":       (*tieredStore)(nil),
+	"memory":       (*memStore)(nil),
+}
+
+func backendFeatures(store kvStore) []string {
+	features := []string{}
+	if _, ok := store.(ttlSetter); ok {
+		features = append(features, "ttl")
+	}
+	if _, ok := store.(txnStore); ok {
+		features = append(features, "transactions")
+	}
+	if _, ok := store.(watcher); ok {
+		features = append(features, "watch")
+	}
+	if _, ok := store.(snapshotter); ok {
+		features = append(features, "snapshots")
+	}
+	if _, ok := store.(compactor); ok {
+		features = append(features, "compact")
+	}
+	if _, ok := store.(durableWriter); ok {
+		features = append(features, "await_durable")
+	}
+	if _, ok := store.(metaStore); ok {
+		features = append(features, "user_meta")
+	}
+	if _, ok := store.(versionReader); ok {
+		features = append(features, "versioned_reads")
+	}
+	return features
+}
+
+// capabilities is the document returned by Capabilities.
+type capabilities struct {
+	Features []string            `json:"features"`
+	Backends map[string][]string `json:"backends"`
+}
+
+// Version returns a JSON document with the library version, the Go
+// toolchain, the badger and SlateDB module versions and VCS build info, for
+// the host to release with FreeCString.
+//
+//export Version
+func Version() (ret *C.char) {
+	defer recoverExport(0, &ret, nil)
+	doc, err := json.Marshal(buildVersion())
+	if err != nil {
+		setError(err)
+		return nil
+	}
+	setError(nil)
+	return C.CString(string(doc))
+}
+
+// Capabilities returns a JSON document listing the library-wide features
+// and, for each backend scheme, the optional features it supports (ttl,
+// transactions, watch, snapshots, compact, await_durable, user_meta,
+// versioned_reads), so hosts can gate features at runtime. Release it with
+// FreeCString.
+//
+//export Capabilities
+func Capabilities() (ret *C.char) {
+	defer recoverExport(0, &ret, nil)
+	caps := capabilities{Features: libraryFeatures, Backends: make(map[string][]string)}
+	for _, scheme := range backendSchemes() {
+		caps.Backends[scheme] = []string{}
+		if proto, ok := backendPrototypes[scheme]; ok {
+			caps.Backends[scheme] = backendFeatures(proto)
+		}
+	}
+	doc, err := json.Marshal(caps)
+	if err != nil {
+		setError(err)
+		return nil
+	}
+	setError(nil)
+	return C.CString(string(doc))
+}
@@ -0,0 +1,448 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+	"unsafe"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var errVersionsUnsupported = errors.New("versioned reads are not supported by this backend")
+
+// versionReader is implemented by backends that keep earlier versions of
+// entries. Versions are the backend's commit timestamps: they increase with
+// every committed write but are not wall-clock times.
+type versionReader interface {
+	CurrentVersion() (uint64, error)
+	GetAt(key []byte, version uint64) ([]byte, error)
+	IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error
+	Versions(key []byte) ([]keyVersion, error)
+}
+
+// Flags in the GetAllVersions framing.
+const (
+	versionDeleted byte = 1 << 0
+	versionExpired byte = 1 << 1
+)
+
+// keyVersion is one retained version of a key. Deleted and expired versions
+// carry no value.
+type keyVersion struct {
+	version uint64
+	flags   byte
+	value   []byte
+}
+
+// appendVersion frames v as u64 version | u8 flags | u32 value length |
+// value, little-endian like Scan.
+func appendVersion(buf []byte, v keyVersion) []byte {
+	buf = binary.LittleEndian.AppendUint64(buf, v.version)
+	buf = append(buf, v.flags)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(v.value)))
+	return append(buf, v.value...)
+}
+
+func versionsOf(store kvStore) (versionReader, error) {
+	if vr, ok := store.(versionReader); ok {
+		return vr, nil
+	}
+	return nil, errVersionsUnsupported
+}
+
+func (s *badgerStore) CurrentVersion() (uint64, error) {
+	txn := s.db.NewTransaction(false)
+	defer txn.Discard()
+	return txn.ReadTs(), nil
+}
+
+// GetAt returns the value key held at version. Badger keeps only
+// NumVersionsToKeep versions of each key (one by default) once compaction
+// has run, so older reads may find the key missing.
+func (s *badgerStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	// Keys extending key sort after it, so the first entry visited decides.
+	var result []byte
+	found := false
+	err := s.IterateAt(key, version, func(k, v []byte) error {
+		if bytes.Equal(k, key) {
+			result, found = v, true
+		}
+		return errStopIteration
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		return nil, err
+	}
+	if !found {
+		return nil, badger.ErrKeyNotFound
+	}
+	return result, nil
+}
+
+// IterateAt visits the entries under prefix as they were at version.
+func (s *badgerStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.AllVersions = true
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Versions of a key come newest first; the first one at or below
+		// version decides the key.
+		var decided []byte
+		seen := false
+		for it.Seek(prefix); it.Valid(); it.Next() {
+			item := it.Item()
+			if seen && bytes.Equal(item.Key(), decided) {
+				continue
+			}
+			if item.Version() > version {
+				continue
+			}
+			decided, seen = item.KeyCopy(decided[:0]), true
+			if item.IsDeletedOrExpired() {
+				continue
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(append([]byte(nil), decided...), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Versions returns every version of key badger still holds, newest first.
+func (s *badgerStore) Versions(key []byte) ([]keyVersion, error) {
+	var versions []keyVersion
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.AllVersions = true
+		opts.Prefix = key
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(key); it.ValidForPrefix(key); it.Next() {
+			item := it.Item()
+			if !bytes.Equal(item.Key(), key) {
+				break
+			}
+			v := keyVersion{version: item.Version()}
+			switch {
+			case item.IsDeletedOrExpired() && item.ExpiresAt() != 0 && item.ExpiresAt() <= uint64(time.Now().Unix()):
+				v.flags = versionExpired
+			case item.IsDeletedOrExpired():
+				v.flags = versionDeleted
+			default:
+				value, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				v.value = value
+			}
+			versions = append(versions, v)
+		}
+		return nil
+	})
+	return versions, err
+}
+
+func (s *codecStore) CurrentVersion() (uint64, error) {
+	vr, err := versionsOf(s.inner)
+	if err != nil {
+		return 0, err
+	}
+	return vr.CurrentVersion()
+}
+
+func (s *codecStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	vr, err := versionsOf(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := vr.GetAt(key, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.codec.decode(key, raw)
+}
+
+func (s *codecStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	vr, err := versionsOf(s.inner)
+	if err != nil {
+		return err
+	}
+	return vr.IterateAt(prefix, version, s.decoding(fn))
+}
+
+func (s *codecStore) Versions(key []byte) ([]keyVersion, error) {
+	vr, err := versionsOf(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := vr.Versions(key)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range versions {
+		if v.flags != 0 {
+			continue
+		}
+		if versions[i].value, err = s.codec.decode(key, v.value); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// versionsBelow forwards versioned reads through wrappers that do not
+// change values.
+type versionsBelow struct{ inner kvStore }
+
+func (v versionsBelow) CurrentVersion() (uint64, error) {
+	vr, err := versionsOf(v.inner)
+	if err != nil {
+		return 0, err
+	}
+	return vr.CurrentVersion()
+}
+
+func (v versionsBelow) GetAt(key []byte, version uint64) ([]byte, error) {
+	vr, err := versionsOf(v.inner)
+	if err != nil {
+		return nil, err
+	}
+	return vr.GetAt(key, version)
+}
+
+func (v versionsBelow) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	vr, err := versionsOf(v.inner)
+	if err != nil {
+		return err
+	}
+	return vr.IterateAt(prefix, version, fn)
+}
+
+func (v versionsBelow) Versions(key []byte) ([]keyVersion, error) {
+	vr, err := versionsOf(v.inner)
+	if err != nil {
+		return nil, err
+	}
+	return vr.Versions(key)
+}
+
+func (s *cacheStore) CurrentVersion() (uint64, error) {
+	return versionsBelow{s.inner}.CurrentVersion()
+}
+
+func (s *cacheStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	return versionsBelow{s.inner}.GetAt(key, version)
+}
+
+func (s *cacheStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return versionsBelow{s.inner}.IterateAt(prefix, version, fn)
+}
+
+func (s *cacheStore) Versions(key []byte) ([]keyVersion, error) {
+	return versionsBelow{s.inner}.Versions(key)
+}
+
+func (s *changeLogStore) CurrentVersion() (uint64, error) {
+	return versionsBelow{s.inner}.CurrentVersion()
+}
+
+func (s *changeLogStore) GetAt(key []byte, version uint64) ([]byte, error) {
+	return versionsBelow{s.inner}.GetAt(key, version)
+}
+
+func (s *changeLogStore) IterateAt(prefix []byte, version uint64, fn func(k, v []byte) error) error {
+	return versionsBelow{s.inner}.IterateAt(prefix, version, fn)
+}
+
+// versionArg validates a version passed by the host.
+func versionArg(version C.int64_t) (uint64, error) {
+	if version <= 0 {
+		return 0, errors.New("version must be positive")
+	}
+	return uint64(version), nil
+}
+
+// CurrentVersion returns the store's latest committed version, for a later
+// GetAt or ScanAt, or a negative status code.
+//
+//export CurrentVersion
+func CurrentVersion(handle C.uintptr_t) (ret C.int64_t) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	vr, err := versionsOf(store)
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	version, err := vr.CurrentVersion()
+	if err != nil {
+		return C.int64_t(setHandleError(uintptr(handle), err))
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.int64_t(version)
+}
+
+// GetAt is Get reading the value key held at version. Release it with
+// FreeBuffer.
+//
+//export GetAt
+func GetAt(handle C.uintptr_t, key *C.char, keyLen C.int, version C.int64_t, valueLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "get_at", time.Now())
+	*valueLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	at, err := versionArg(version)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	vr, err := versionsOf(store)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	data, err := vr.GetAt(gotKey, at)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	buf, err := returnValue(data, valueLen)
+	setHandleError(uintptr(handle), err)
+	return buf
+}
+
+// ScanAt is Scan over the entries as they were at version.
+//
+//export ScanAt
+func ScanAt(handle C.uintptr_t, prefix *C.char, prefixLen C.int, version C.int64_t, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "scan_at", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	at, err := versionArg(version)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	vr, err := versionsOf(store)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	err = vr.IterateAt(pref, at, func(k, v []byte) error {
+		if reservedKey(k) {
+			// Reserved keys sort last, so nothing after this one is listed.
+			return errStopIteration
+		}
+		buffer = appendEntry(buffer, k, v)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopIteration) {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
+
+func (s *changeLogStore) Versions(key []byte) ([]keyVersion, error) {
+	return versionsBelow{s.inner}.Versions(key)
+}
+
+// GetAllVersions returns every version of key the backend still holds,
+// newest first, each framed as u64 version | u8 flags | u32 value length |
+// value (little-endian). Flag 1 marks a delete and flag 2 an expired entry;
+// neither carries a value. A key with no retained versions yields a nil
+// buffer with resultLen set to zero. Release the buffer with FreeBuffer.
+//
+//export GetAllVersions
+func GetAllVersions(handle C.uintptr_t, key *C.char, keyLen C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	vr, err := versionsOf(store)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotKey, err := userKey(key, keyLen)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	versions, err := vr.Versions(gotKey)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(versions) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	var buffer []byte
+	for _, v := range versions {
+		buffer = appendVersion(buffer, v)
+	}
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}
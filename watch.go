@@ -0,0 +1,390 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+)
+
+// watchBufferSize bounds the events queued for a watch the host has not
+// drained yet. Further events are dropped and reported as errWatchOverflow.
+const watchBufferSize = 4096
+
+var (
+	errWatchOverflow    = errors.New("watch fell behind; events were dropped")
+	errWatchClosed      = errors.New("watch closed")
+	errWatchUnsupported = errors.New("watches are not supported by this backend")
+)
+
+type watchEvent struct {
+	op    byte
+	key   []byte
+	value []byte
+}
+
+// watch queues change events for keys under one prefix.
+type watch struct {
+	storeID uintptr
+	// prefix is in the keyspace of the backend serving the watch, which
+	// layers that rewrite keys move it into; see rebase.
+	prefix []byte
+	// reserved is set when the host watches the reserved 0xff keyspace.
+	reserved   bool
+	maps       []func(watchEvent) (watchEvent, bool)
+	events     chan watchEvent
+	overflowed atomic.Bool
+	done       chan struct{}
+	once       sync.Once
+	stop       func()
+}
+
+func newWatch(storeID uintptr, prefix []byte) *watch {
+	return &watch{
+		storeID:  storeID,
+		prefix:   prefix,
+		reserved: reservedKey(prefix),
+		events:   make(chan watchEvent, watchBufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// rebase moves w to prefix in the keyspace below a layer and has its events
+// pass through fn, ahead of any added by the layers above, on the way back
+// up. fn drops an event by returning false.
+func (w *watch) rebase(prefix []byte, fn func(watchEvent) (watchEvent, bool)) {
+	w.prefix = prefix
+	w.maps = append([]func(watchEvent) (watchEvent, bool){fn}, w.maps...)
+}
+
+// publish queues an event without blocking the writer. Writes to the
+// reserved 0xff keyspace only reach watches on a prefix inside it.
+func (w *watch) publish(ev watchEvent) {
+	if !bytes.HasPrefix(ev.key, w.prefix) {
+		return
+	}
+	for _, fn := range w.maps {
+		var ok bool
+		if ev, ok = fn(ev); !ok {
+			return
+		}
+	}
+	if reservedKey(ev.key) && !w.reserved {
+		return
+	}
+	select {
+	case w.events <- ev:
+	default:
+		w.overflowed.Store(true)
+	}
+}
+
+// next appends up to max events to buf, waiting up to timeout for the first.
+func (w *watch) next(buf []byte, max int, timeout time.Duration) ([]byte, error) {
+	if w.overflowed.Swap(false) {
+		return buf, errWatchOverflow
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ev := <-w.events:
+		buf = appendEvent(buf, ev)
+	case <-timer.C:
+		return buf, nil
+	case <-w.done:
+		return buf, errWatchClosed
+	}
+	for n := 1; n < max; n++ {
+		select {
+		case ev := <-w.events:
+			buf = appendEvent(buf, ev)
+		default:
+			return buf, nil
+		}
+	}
+	return buf, nil
+}
+
+func (w *watch) close() {
+	w.once.Do(func() {
+		close(w.done)
+		if w.stop != nil {
+			w.stop()
+		}
+	})
+}
+
+// appendEvent frames an event as u8 op, u32 key length, u32 value length,
+// key, value (little-endian). op uses the Apply operation codes.
+func appendEvent(buf []byte, ev watchEvent) []byte {
+	var tmp [4]byte
+	buf = append(buf, ev.op)
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(ev.key)))
+	buf = append(buf, tmp[:]...)
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(ev.value)))
+	buf = append(buf, tmp[:]...)
+	buf = append(buf, ev.key...)
+	return append(buf, ev.value...)
+}
+
+// watcher is implemented by backends that can report changes to keys.
+type watcher interface {
+	Watch(w *watch) error
+}
+
+// watcherOf finds what serves watches for store, looking through the layers
+// that leave keys and values alone.
+func watcherOf(store kvStore) (watcher, bool) {
+	for {
+		if wt, ok := store.(watcher); ok {
+			return wt, true
+		}
+		l, ok := store.(layer)
+		if !ok {
+			return nil, false
+		}
+		store = l.unwrap()
+	}
+}
+
+// Watch decodes the values of set events on their way up. Events whose
+// values do not decode are dropped.
+func (s *codecStore) Watch(w *watch) error {
+	wt, ok := watcherOf(s.inner)
+	if !ok {
+		return errWatchUnsupported
+	}
+	w.rebase(w.prefix, func(ev watchEvent) (watchEvent, bool) {
+		if ev.op == opDelete {
+			return ev, true
+		}
+		value, err := s.codec.decode(ev.key, ev.value)
+		if err != nil {
+			logf(logWarn, "watch", "dropping event for %q: %v", ev.key, err)
+			return ev, false
+		}
+		ev.value = value
+		return ev, true
+	})
+	return wt.Watch(w)
+}
+
+// Watch watches the bucket's share of the parent store and strips the
+// bucket prefix from event keys.
+func (s *bucketStore) Watch(w *watch) error {
+	wt, ok := watcherOf(s.inner)
+	if !ok {
+		return errWatchUnsupported
+	}
+	w.rebase(s.key(w.prefix), func(ev watchEvent) (watchEvent, bool) {
+		ev.key = ev.key[len(s.prefix):]
+		return ev, true
+	})
+	return wt.Watch(w)
+}
+
+// Watch relays badger's subscription stream. Badger does not flag deletions
+// in that stream, so an event with an empty value is reported as a delete
+// when the key no longer exists. The subscription registers asynchronously;
+// writes racing WatchOpen may be missed.
+func (s *badgerStore) Watch(w *watch) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	w.stop = func() {
+		cancel()
+		<-finished
+	}
+	go func() {
+		defer close(finished)
+		_ = s.db.Subscribe(ctx, func(list *badger.KVList) error {
+			for _, kv := range list.Kv {
+				ev := watchEvent{op: opSet, key: kv.Key, value: kv.Value}
+				if len(kv.Value) == 0 {
+					if found, err := s.Has(kv.Key); err == nil && !found {
+						ev.op = opDelete
+					}
+				}
+				w.publish(ev)
+			}
+			return nil
+		}, []pb.Match{{Prefix: w.prefix}})
+	}()
+	return nil
+}
+
+// slateWatchers fans slateStore writes out to open watches. SlateDB has no
+// change feed, so every write path calls notify after it succeeds.
+type slateWatchers struct {
+	mu      sync.RWMutex
+	watches map[*watch]struct{}
+}
+
+func (h *slateWatchers) notify(ops []operation) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for w := range h.watches {
+		for _, op := range ops {
+			ev := watchEvent{op: opDelete, key: op.key}
+			if op.op != opDelete {
+				ev.op, ev.value = opSet, op.value
+			}
+			w.publish(ev)
+		}
+	}
+}
+
+func (s *slateStore) Watch(w *watch) error {
+	s.watchers.mu.Lock()
+	if s.watchers.watches == nil {
+		s.watchers.watches = make(map[*watch]struct{})
+	}
+	s.watchers.watches[w] = struct{}{}
+	s.watchers.mu.Unlock()
+	w.stop = func() {
+		s.watchers.mu.Lock()
+		delete(s.watchers.watches, w)
+		s.watchers.mu.Unlock()
+	}
+	return nil
+}
+
+var (
+	watchMu     sync.Mutex
+	watches             = make(map[uintptr]*watch)
+	nextWatchID uintptr = 1
+)
+
+func storeWatch(w *watch) uintptr {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	id := nextWatchID
+	nextWatchID++
+	watches[id] = w
+	return id
+}
+
+func getWatch(id uintptr) (*watch, error) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	w, ok := watches[id]
+	if !ok {
+		return nil, unknownHandleError("watch")
+	}
+	return w, nil
+}
+
+func deleteWatch(id uintptr) *watch {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	w := watches[id]
+	delete(watches, id)
+	return w
+}
+
+// closeWatchesFor closes every watch still open on a store handle.
+func closeWatchesFor(storeID uintptr) {
+	watchMu.Lock()
+	var open []*watch
+	for id, w := range watches {
+		if w.storeID == storeID {
+			open = append(open, w)
+			delete(watches, id)
+		}
+	}
+	watchMu.Unlock()
+
+	for _, w := range open {
+		w.close()
+	}
+}
+
+// WatchOpen starts delivering change events for keys under prefix (every key
+// when the prefix is empty). Returns 0 on failure.
+//
+//export WatchOpen
+func WatchOpen(handle C.uintptr_t, prefix *C.char, prefixLen C.int) (ret C.uintptr_t) {
+	defer recoverExport(uintptr(handle), &ret, 0)
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	wt, ok := watcherOf(store)
+	if !ok {
+		setHandleError(uintptr(handle), errWatchUnsupported)
+		return 0
+	}
+
+	var pref []byte
+	if prefixLen > 0 {
+		pref = C.GoBytes(unsafe.Pointer(prefix), prefixLen)
+	}
+	w := newWatch(uintptr(handle), pref)
+	if err := wt.Watch(w); err != nil {
+		setHandleError(uintptr(handle), err)
+		return 0
+	}
+	setHandleError(uintptr(handle), nil)
+	return C.uintptr_t(storeWatch(w))
+}
+
+// WatchNext waits up to timeoutMs for change events and returns up to
+// maxEvents of them framed as u8 op, u32 key length, u32 value length, key,
+// value. A timeout returns NULL with a zero status. If the host fell behind
+// and events were dropped, the call fails once so it can resynchronise.
+//
+//export WatchNext
+func WatchNext(watchHandle C.uintptr_t, maxEvents C.int, timeoutMs C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(0, &ret, nil)
+	*resultLen = 0
+	w, err := getWatch(uintptr(watchHandle))
+	if err != nil {
+		setError(err)
+		return nil
+	}
+	if maxEvents <= 0 {
+		maxEvents = 1
+	}
+
+	buf, err := w.next(nil, int(maxEvents), time.Duration(timeoutMs)*time.Millisecond)
+	if err != nil {
+		setHandleError(w.storeID, err)
+		return nil
+	}
+	if len(buf) == 0 {
+		setHandleError(w.storeID, nil)
+		return nil
+	}
+	mem, err := copyToC(buf)
+	if err != nil {
+		setHandleError(w.storeID, err)
+		return nil
+	}
+	*resultLen = C.int(len(buf))
+	setHandleError(w.storeID, nil)
+	return mem
+}
+
+//export WatchClose
+func WatchClose(watchHandle C.uintptr_t) (ret C.int) {
+	defer recoverExport(0, &ret, codePanic)
+	w := deleteWatch(uintptr(watchHandle))
+	if w == nil {
+		return setError(unknownHandleError("watch"))
+	}
+	w.close()
+	return setError(nil)
+}
@@ -0,0 +1,247 @@
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+	"unsafe"
+)
+
+// A sorted set keeps two records per member under zsetPrefix and the set's
+// u32 length-prefixed name: 'm' + member holds the member's score as a
+// sortable u64, and 's' + that u64 + member is an empty record ordering the
+// members by score, then bytewise.
+var zsetPrefix = []byte("\xffzset/")
+
+func zsetBase(name []byte, kind byte) []byte {
+	return append(appendLenPrefixed(append([]byte(nil), zsetPrefix...), name), kind)
+}
+
+// sortableScore maps a float64 onto a u64 with the same order. Negative
+// zero is folded into zero.
+func sortableScore(score float64) uint64 {
+	if score == 0 {
+		score = 0
+	}
+	bits := math.Float64bits(score)
+	if bits>>63 == 0 {
+		return bits | 1<<63
+	}
+	return ^bits
+}
+
+func scoreFromSortable(u uint64) float64 {
+	if u>>63 == 1 {
+		return math.Float64frombits(u &^ (1 << 63))
+	}
+	return math.Float64frombits(^u)
+}
+
+func zsetScoreKey(name []byte, score uint64, member []byte) []byte {
+	return append(binary.BigEndian.AppendUint64(zsetBase(name, 's'), score), member...)
+}
+
+// zAdd sets member's score in the named set, reporting whether it is new.
+func zAdd(store kvStore, name, member []byte, score float64) (bool, error) {
+	if math.IsNaN(score) {
+		return false, errors.New("score must not be NaN")
+	}
+	memberKey := append(zsetBase(name, 'm'), member...)
+	next := sortableScore(score)
+	var added bool
+	err := retryConflicts(func() error {
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+
+		old, err := txn.Get(memberKey)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		added = err != nil
+		if !added {
+			if len(old) != 8 {
+				return errors.New("malformed sorted set member")
+			}
+			if err := txn.Delete(zsetScoreKey(name, binary.BigEndian.Uint64(old), member)); err != nil {
+				return err
+			}
+		}
+		if err := txn.Set(memberKey, binary.BigEndian.AppendUint64(nil, next)); err != nil {
+			return err
+		}
+		if err := txn.Set(zsetScoreKey(name, next, member), nil); err != nil {
+			return err
+		}
+		return txn.Commit()
+	})
+	return added, err
+}
+
+// zRem removes member from the named set, reporting whether it was there.
+func zRem(store kvStore, name, member []byte) (bool, error) {
+	memberKey := append(zsetBase(name, 'm'), member...)
+	var removed bool
+	err := retryConflicts(func() error {
+		removed = false
+		txn, err := beginTxn(store)
+		if err != nil {
+			return err
+		}
+		defer txn.Discard()
+
+		old, err := txn.Get(memberKey)
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(old) != 8 {
+			return errors.New("malformed sorted set member")
+		}
+		if err := txn.Delete(memberKey); err != nil {
+			return err
+		}
+		if err := txn.Delete(zsetScoreKey(name, binary.BigEndian.Uint64(old), member)); err != nil {
+			return err
+		}
+		removed = true
+		return txn.Commit()
+	})
+	return removed, err
+}
+
+// zRangeByScore calls fn with the members scored in [minScore, maxScore],
+// lowest first, stopping after limit members when limit is positive.
+func zRangeByScore(store kvStore, name []byte, minScore, maxScore float64, limit int, fn func(member []byte, score float64) error) error {
+	if math.IsNaN(minScore) || math.IsNaN(maxScore) {
+		return errors.New("score bounds must not be NaN")
+	}
+	if minScore > maxScore {
+		return nil
+	}
+	base := zsetBase(name, 's')
+	start := binary.BigEndian.AppendUint64(append([]byte(nil), base...), sortableScore(minScore))
+	end := nextPrefix(binary.BigEndian.AppendUint64(append([]byte(nil), base...), sortableScore(maxScore)))
+	n := 0
+	err := store.IterateRange(start, end, func(k, _ []byte) error {
+		if limit > 0 && n >= limit {
+			return errStopIteration
+		}
+		n++
+		rest := k[len(base):]
+		return fn(rest[8:], scoreFromSortable(binary.BigEndian.Uint64(rest)))
+	})
+	if errors.Is(err, errStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// ZAdd adds member to the sorted set named by key with score, or moves it to
+// the new score. Both of a member's records change in one transaction.
+// Returns 1 when the member is new, 0 when its score was updated and a
+// negative status code on error.
+//
+//export ZAdd
+func ZAdd(handle C.uintptr_t, key *C.char, keyLen C.int, member *C.char, memberLen C.int, score C.double) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "zadd", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	gotMember := C.GoBytes(unsafe.Pointer(member), memberLen)
+
+	added, err := zAdd(store, gotKey, gotMember, float64(score))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	setHandleError(uintptr(handle), nil)
+	if added {
+		return 1
+	}
+	return 0
+}
+
+// ZRem removes member from the sorted set named by key. Returns 1 when it
+// was removed, 0 when it was not a member and a negative status code on
+// error.
+//
+//export ZRem
+func ZRem(handle C.uintptr_t, key *C.char, keyLen C.int, member *C.char, memberLen C.int) (ret C.int) {
+	defer recoverExport(uintptr(handle), &ret, codePanic)
+	defer observe(uintptr(handle), "zrem", time.Now())
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+	gotMember := C.GoBytes(unsafe.Pointer(member), memberLen)
+
+	removed, err := zRem(store, gotKey, gotMember)
+	if err != nil {
+		return setHandleError(uintptr(handle), err)
+	}
+	setHandleError(uintptr(handle), nil)
+	if removed {
+		return 1
+	}
+	return 0
+}
+
+// ZRangeByScore returns the members of the sorted set named by key with
+// scores in [minScore, maxScore], lowest score first and ties in member
+// order, using Scan's framing with the member as the key and its score as a
+// little-endian f64 value. A non-positive limit returns every match. Release
+// the result with FreeBuffer.
+//
+//export ZRangeByScore
+func ZRangeByScore(handle C.uintptr_t, key *C.char, keyLen C.int, minScore C.double, maxScore C.double, limit C.int, resultLen *C.int) (ret *C.char) {
+	defer recoverExport(uintptr(handle), &ret, nil)
+	defer observe(uintptr(handle), "zrange", time.Now())
+	*resultLen = 0
+	store, err := getHandle(uintptr(handle))
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	gotKey := C.GoBytes(unsafe.Pointer(key), keyLen)
+
+	buffer := getScratch()
+	defer func() { putScratch(buffer) }()
+	var score [8]byte
+	err = zRangeByScore(store, gotKey, float64(minScore), float64(maxScore), int(limit), func(member []byte, s float64) error {
+		binary.LittleEndian.PutUint64(score[:], math.Float64bits(s))
+		buffer = appendEntry(buffer, member, score[:])
+		return nil
+	})
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	if len(buffer) == 0 {
+		setHandleError(uintptr(handle), nil)
+		return nil
+	}
+
+	mem, err := copyToC(buffer)
+	if err != nil {
+		setHandleError(uintptr(handle), err)
+		return nil
+	}
+	*resultLen = C.int(len(buffer))
+	setHandleError(uintptr(handle), nil)
+	return mem
+}